@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+
+	"auth-plugin/internal/aclrule"
+	"auth-plugin/pkg/topicmatch"
+)
+
+// ACL 规则来自 acls 表；匹配逻辑在 internal/aclrule 与 pkg/topicmatch，与 useradm/aclsim 共用。
+
+const (
+	aclRead        = aclrule.Read
+	aclWrite       = aclrule.Write
+	aclSubscribe   = aclrule.Subscribe
+	aclUnsubscribe = aclrule.Unsubscribe
+)
+
+type aclRule = aclrule.Rule
+
+func expandPattern(pattern, username, clientID string) (string, bool) {
+	return aclrule.Expand(pattern, username, clientID)
+}
+
+func mqttMatch(pattern, topic string) bool {
+	return topicmatch.Match(pattern, topic)
+}
+
+func aclAllows(rules []aclRule, username, clientID, topic string, access int) bool {
+	return aclrule.Allows(rules, username, clientID, topic, access)
+}
+
+// aclDecision 是一组规则对本次访问的判定，允许时记下命中的规则。
+func aclDecision(rules []aclRule, username, clientID, topic string, access int) decision {
+	r, ok := aclrule.Find(rules, username, clientID, topic, access)
+	if !ok {
+		return denied(reasonNoRule)
+	}
+	d := allowed(reasonOK)
+	d.rule = r.Pattern
+	return d
+}
+
+const aclQuery = "SELECT pattern, acc FROM acls WHERE username = $1 OR username = '*'"
+
+func dbACL(parent context.Context, in *instance, username, clientID, topic string, access, port int, pol requestPolicy) (decision, error) {
+	if access == aclUnsubscribe {
+		// 取消订阅不受限，与 mosquitto acl_file 行为一致
+		return allowed(reasonUnsubscribe), nil
+	}
+	if in == primary && databaseDown() {
+		return decision{}, errDatabaseDown
+	}
+	ctx, cancel := ctxWithTimeout(parent, pol.timeout)
+	defer cancel()
+
+	// 任一后端允许即放行，未允许时继续询问下一个
+	d, err := runChain(in.backends(), func(b backend) (decision, bool, error) {
+		d, err := in.authBackend(b.name).checkACL(ctx, username, clientID, topic, access, port, pol)
+		return d, d.allow, err
+	})
+	if in == primary {
+		recordDBResult(err)
+	}
+	return d, err
+}
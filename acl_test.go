@@ -0,0 +1,72 @@
+package main
+
+import "testing"
+
+func TestMqttMatch(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		pattern, topic string
+		want           bool
+	}{
+		{"devices/alice/up", "devices/alice/up", true},
+		{"devices/alice/up", "devices/alice/down", false},
+		{"devices/+/up", "devices/bob/up", true},
+		{"devices/+/up", "devices/bob/x/up", false},
+		{"devices/#", "devices", true},
+		{"devices/#", "devices/a/b/c", true},
+		{"#", "anything/at/all", true},
+		{"devices/alice", "devices/alice/up", false},
+		// 订阅过滤器中的通配符只能被规则中的通配符覆盖
+		{"devices/+/up", "devices/+/up", true},
+		{"devices/alice/up", "devices/+/up", false},
+		{"devices/+", "devices/#", false},
+		{"devices/#", "devices/#", true},
+		{"#", "$CONTROL/mosq-pg/v1", false},
+		{"devices/+/up", "$share/g/devices/bob/up", true},
+	}
+	for _, tc := range tests {
+		if got := mqttMatch(tc.pattern, tc.topic); got != tc.want {
+			t.Fatalf("mqttMatch(%q, %q) = %v, want %v", tc.pattern, tc.topic, got, tc.want)
+		}
+	}
+}
+
+func TestExpandPattern(t *testing.T) {
+	t.Parallel()
+	if got, ok := expandPattern("devices/{username}/{clientid}/#", "alice", "c1"); !ok || got != "devices/alice/c1/#" {
+		t.Fatalf("expandPattern = (%q, %v)", got, ok)
+	}
+	if _, ok := expandPattern("devices/{clientid}/up", "alice", "#"); ok {
+		t.Fatal("wildcard client ids must not expand placeholders")
+	}
+	if _, ok := expandPattern("devices/{username}/up", "", "c1"); ok {
+		t.Fatal("empty usernames must not expand placeholders")
+	}
+}
+
+func TestACLAllows(t *testing.T) {
+	t.Parallel()
+	rules := []aclRule{
+		{Pattern: "devices/{username}/#", Acc: aclRead | aclSubscribe},
+		{Pattern: "devices/{username}/up", Acc: aclWrite},
+		{Pattern: "broadcast/#", Acc: aclSubscribe},
+	}
+	tests := []struct {
+		topic  string
+		access int
+		want   bool
+	}{
+		{"devices/alice/up", aclWrite, true},
+		{"devices/alice/down", aclWrite, false},
+		{"devices/alice/down", aclRead, true},
+		{"devices/bob/up", aclWrite, false},
+		{"devices/alice/#", aclSubscribe, true},
+		{"broadcast/news", aclSubscribe, true},
+		{"broadcast/news", aclRead, false},
+	}
+	for _, tc := range tests {
+		if got := aclAllows(rules, "alice", "c1", tc.topic, tc.access); got != tc.want {
+			t.Fatalf("aclAllows(%q, %d) = %v, want %v", tc.topic, tc.access, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// 首次上线通知：设备第一次通过密码认证时 POST 到 activation_webhook_url，供发货/开通系统把设备标记为已激活。
+//
+//   - “第一次”记录在 iot_devices.activated_at（迁移 0006），多个 broker 之间由
+//     UPDATE ... WHERE activated_at IS NULL 保证只有一个发送；
+//   - 查询与发送都在后台协程完成，认证回调只把事件放进队列，队列满时丢弃（下次登录会再试）；
+//   - 发送失败按指数退避重试，全部失败时清空 activated_at，设备下次登录重新通知；
+//   - 设置 activation_webhook_secret 时带 X-Mosq-Signature: sha256=<HMAC-SHA256(body)>；
+//   - 本 broker 已确认激活过的用户名记在内存中，之后的登录不再查库。
+
+const (
+	activationQueueSize   = 1000
+	activationMaxAttempts = 5
+	activationSeenMax     = 100000
+
+	markActivated  = "UPDATE iot_devices SET activated_at = now() WHERE username = $1 AND activated_at IS NULL RETURNING activated_at"
+	clearActivated = "UPDATE iot_devices SET activated_at = NULL WHERE username = $1 AND activated_at = $2"
+)
+
+var (
+	activationWebhookURL    string
+	activationWebhookSecret string
+	activationRetryBase     = time.Second
+	activationClient        = &http.Client{Timeout: 5 * time.Second}
+
+	activationQueue chan activationEvent
+	activationStop  chan struct{}
+	activationDone  chan struct{}
+	activationSeen  = &seenUsers{names: map[string]struct{}{}}
+
+	activationsNotified atomic.Int64
+	activationsFailed   atomic.Int64
+	activationsDropped  atomic.Int64
+)
+
+// activationEvent 是 webhook 的请求体。
+type activationEvent struct {
+	Event           string `json:"event"`
+	Username        string `json:"username"`
+	ClientID        string `json:"client_id"`
+	Address         string `json:"address"`
+	ProtocolVersion int    `json:"protocol_version"`
+	ConnID          string `json:"conn_id"`
+	Broker          string `json:"broker"`
+	ActivatedAt     string `json:"activated_at"`
+}
+
+// seenUsers 记录已激活的用户名；超过上限时整体清空，代价只是多查一次库。
+type seenUsers struct {
+	mu    sync.Mutex
+	names map[string]struct{}
+}
+
+func (s *seenUsers) has(name string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.names[name]
+	return ok
+}
+
+func (s *seenUsers) add(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.names) >= activationSeenMax {
+		s.names = map[string]struct{}{}
+	}
+	s.names[name] = struct{}{}
+}
+
+func (s *seenUsers) remove(name string) {
+	s.mu.Lock()
+	delete(s.names, name)
+	s.mu.Unlock()
+}
+
+// noteActivation 在认证成功后调用；未开启或已知激活过时立即返回。
+func noteActivation(username, clientID, address, connID string, protocolVersion int) {
+	q := activationQueue
+	if q == nil || !featureFlags.on(flagActivation) || activationSeen.has(username) {
+		return
+	}
+	host, _ := os.Hostname()
+	ev := activationEvent{
+		Event: "device.activated", Username: username, ClientID: clientID, Address: address,
+		ProtocolVersion: protocolVersion, ConnID: connID, Broker: host,
+	}
+	select {
+	case q <- ev:
+	default:
+		activationsDropped.Add(1)
+	}
+}
+
+// signActivation 计算 X-Mosq-Signature 的值。
+func signActivation(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func postActivation(body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, activationWebhookURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if activationWebhookSecret != "" {
+		req.Header.Set("X-Mosq-Signature", signActivation(activationWebhookSecret, body))
+	}
+	return fetchJSON(activationClient, req, nil)
+}
+
+// deliverActivation 发送一次通知，失败时退避重试；stop 关闭时放弃剩余重试。
+func deliverActivation(ev activationEvent, stop <-chan struct{}) error {
+	body, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	delay := activationRetryBase
+	for attempt := 1; attempt <= activationMaxAttempts; attempt++ {
+		if err = postActivation(body); err == nil {
+			return nil
+		}
+		if attempt == activationMaxAttempts {
+			break
+		}
+		select {
+		case <-stop:
+			return err
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+	return err
+}
+
+// processActivation 标记激活并发送通知；设备此前已激活时只记入内存。
+func processActivation(ev activationEvent, stop <-chan struct{}) {
+	ctx, cancel := ctxTimeout()
+	defer cancel()
+	pg, err := openPGStore(ctx)
+	if err != nil {
+		mosqLogDeduped(logWarning, "auth-plugin: activation: "+err.Error())
+		return
+	}
+	var at time.Time
+	err = pg.p.QueryRow(ctx, markActivated, ev.Username).Scan(&at)
+	if errors.Is(err, pgx.ErrNoRows) {
+		activationSeen.add(ev.Username)
+		return
+	}
+	if err != nil {
+		mosqLogDeduped(logWarning, "auth-plugin: activation: "+err.Error())
+		return
+	}
+	activationSeen.add(ev.Username)
+	ev.ActivatedAt = at.UTC().Format(time.RFC3339)
+	if err := deliverActivation(ev, stop); err != nil {
+		activationsFailed.Add(1)
+		activationSeen.remove(ev.Username)
+		ctx, cancel := ctxTimeout()
+		defer cancel()
+		if _, cerr := pg.p.Exec(ctx, clearActivated, ev.Username, at); cerr != nil {
+			err = fmt.Errorf("%w (and resetting activated_at failed: %v)", err, cerr)
+		}
+		mosqLog(logWarning, "auth-plugin: activation webhook for %s not delivered, will retry on next login: %v",
+			redactID(ev.Username), err)
+		return
+	}
+	activationsNotified.Add(1)
+	mosqLog(logInfo, "auth-plugin: device %s activated (client %s, conn %s)",
+		redactID(ev.Username), redactID(ev.ClientID), ev.ConnID)
+}
+
+func startActivation() {
+	if activationWebhookURL == "" {
+		return
+	}
+	q, stop, done := make(chan activationEvent, activationQueueSize), make(chan struct{}), make(chan struct{})
+	activationQueue, activationStop, activationDone = q, stop, done
+	go func() {
+		defer close(done)
+		for {
+			select {
+			case <-stop:
+				// cleanup 时把已排队的激活写完（不再重试通知），到期未处理的计为丢弃
+				activationsDropped.Add(int64(drainQueue(q, drainDeadline, func(ev activationEvent) {
+					processActivation(ev, stop)
+				})))
+				return
+			case ev := <-q:
+				processActivation(ev, stop)
+			}
+		}
+	}()
+}
+
+func stopActivation() {
+	if activationStop == nil {
+		return
+	}
+	close(activationStop)
+	<-activationDone
+	activationQueue, activationStop, activationDone = nil, nil, nil
+}
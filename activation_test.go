@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDeliverActivation(t *testing.T) {
+	oldURL, oldSecret, oldBase := activationWebhookURL, activationWebhookSecret, activationRetryBase
+	t.Cleanup(func() {
+		activationWebhookURL, activationWebhookSecret, activationRetryBase = oldURL, oldSecret, oldBase
+	})
+
+	var calls atomic.Int32
+	var got activationEvent
+	var sig string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) < 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		json.Unmarshal(body, &got)
+		if r.Header.Get("X-Mosq-Signature") == signActivation("hook-secret", body) {
+			sig = "ok"
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	activationWebhookURL, activationWebhookSecret, activationRetryBase = srv.URL, "hook-secret", time.Millisecond
+	ev := activationEvent{Event: "device.activated", Username: "sensor-42", ClientID: "c1", ProtocolVersion: 5}
+	if err := deliverActivation(ev, make(chan struct{})); err != nil {
+		t.Fatal(err)
+	}
+	if calls.Load() != 2 || got.Username != "sensor-42" || got.ProtocolVersion != 5 || sig != "ok" {
+		t.Fatalf("calls = %d, payload = %+v, signature %q", calls.Load(), got, sig)
+	}
+
+	activationWebhookURL = srv.URL + "/unreachable\x7f"
+	if err := deliverActivation(ev, make(chan struct{})); err == nil {
+		t.Fatal("a bad URL should fail")
+	}
+}
+
+func TestNoteActivation(t *testing.T) {
+	oldQueue, oldSeen := activationQueue, activationSeen
+	t.Cleanup(func() { activationQueue, activationSeen = oldQueue, oldSeen })
+
+	activationQueue, activationSeen = nil, &seenUsers{names: map[string]struct{}{}}
+	noteActivation("sensor-42", "c1", "10.0.0.7", "abc", 5) // 未开启时不排队
+
+	q := make(chan activationEvent, 1)
+	activationQueue = q
+	activationSeen.add("known")
+	noteActivation("known", "c0", "10.0.0.6", "def", 4)
+	noteActivation("sensor-42", "c1", "10.0.0.7", "abc", 5)
+	dropped := activationsDropped.Load()
+	noteActivation("sensor-43", "c2", "10.0.0.8", "ghi", 5)
+	if len(q) != 1 || activationsDropped.Load() != dropped+1 {
+		t.Fatalf("queue = %d, dropped = %d", len(q), activationsDropped.Load()-dropped)
+	}
+	if ev := <-q; ev.Username != "sensor-42" || ev.Event != "device.activated" || ev.Address != "10.0.0.7" {
+		t.Fatalf("event = %+v", ev)
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"net/netip"
+	"strings"
+
+	"auth-plugin/pkg/mosqplugin"
+)
+
+// 客户端地址：双栈监听上的 IPv4 客户端由 mosquitto_client_address 报告为 "::ffff:10.0.0.1"，IPv6 地址的
+// 大小写与缩写也不固定，经代理或配置写入时还可能带方括号或端口。比较、计数、脱敏与转发之前统一规范化为
+// netip 的标准文本：IPv4 映射地址还原为 IPv4，IPv6 为小写压缩形式（保留区域）；不是 IP 的地址原样保留。
+
+// parseAddr 解析 IP，接受 "[::1]"、"[::1]:1883"、"10.0.0.1:1883" 与带区域的 "fe80::1%eth0"。
+func parseAddr(s string) (netip.Addr, bool) {
+	s = strings.TrimSpace(s)
+	if ap, err := netip.ParseAddrPort(s); err == nil {
+		return ap.Addr().Unmap(), true
+	}
+	a, err := netip.ParseAddr(strings.TrimSuffix(strings.TrimPrefix(s, "["), "]"))
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return a.Unmap(), true
+}
+
+// normalizeAddr 返回 s 的规范形式。
+func normalizeAddr(s string) string {
+	if a, ok := parseAddr(s); ok {
+		return a.String()
+	}
+	return s
+}
+
+// clientAddress 返回连接的规范化地址。
+func clientAddress(c mosqplugin.Client) string {
+	return normalizeAddr(c.Address())
+}
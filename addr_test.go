@@ -0,0 +1,33 @@
+package main
+
+import "testing"
+
+func TestNormalizeAddr(t *testing.T) {
+	for _, tc := range []struct{ in, want string }{
+		{"10.0.0.1", "10.0.0.1"},
+		{"::ffff:10.0.0.1", "10.0.0.1"},
+		{"::FFFF:a00:1", "10.0.0.1"},
+		{"2001:DB8:0:0::1", "2001:db8::1"},
+		{"[2001:db8::1]", "2001:db8::1"},
+		{"[2001:db8::1]:1883", "2001:db8::1"},
+		{"10.0.0.1:1883", "10.0.0.1"},
+		{"fe80::1%eth0", "fe80::1%eth0"},
+		{" 127.0.0.1 ", "127.0.0.1"},
+		{"", ""},
+		{"/run/mosquitto.sock", "/run/mosquitto.sock"},
+	} {
+		if got := normalizeAddr(tc.in); got != tc.want {
+			t.Errorf("normalizeAddr(%q) = %q, want %q", tc.in, got, tc.want)
+		}
+	}
+
+	// 同一个客户端的不同写法在失败排行中只占一项
+	failuresByAddr.reset()
+	t.Cleanup(failuresByAddr.reset)
+	for _, a := range []string{"::ffff:192.0.2.7", "192.0.2.7"} {
+		recordAuthFailure("u", normalizeAddr(a))
+	}
+	if top := failuresByAddr.top(10); len(top) != 1 || top[0].Count != 2 {
+		t.Fatalf("failures by address = %+v", top)
+	}
+}
@@ -0,0 +1,589 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"golang.org/x/crypto/bcrypt"
+
+	"auth-plugin/internal/aclrule"
+
+	"auth-plugin/pkg/mosqplugin"
+)
+
+// admin_listen：在 broker 进程内开启 HTTPS 管理接口，供不能使用 MQTT $CONTROL 的编排系统
+// （Kubernetes operator、Terraform provider 等）管理用户与 ACL、清缓存、踢下线：
+//
+//	GET    /v1/users/{username}        账号、绑定的 client id 与规则
+//	PUT    /v1/users/{username}        创建或修改：{"password"|"password_hash", "enabled", "client_ids"}
+//	DELETE /v1/users/{username}        删除账号（绑定随外键删除）及其规则
+//	PUT    /v1/users/{username}/acls   整体替换规则：[{"pattern": "...", "access": "read|subscribe"}]
+//	POST   /v1/cache/flush             {"username": "..."} 或 {} 清全部，与 $CONTROL flushCache 相同
+//	POST   /v1/kick                    {"client_id": "..."} 或 {"username": "..."} 断开连接
+//	GET    /v1/status                  与 $CONTROL getStatus 相同
+//
+//   - 只接受 admin_client_ca 签发的客户端证书（mTLS），admin_allowed_clients 可进一步限定证书 CN；
+//   - 写操作按调用方 CN 记录日志；修改用户后清除该用户的 Redis 缓存；
+//   - 踢下线由 TICK 回调在 broker 主线程执行（broker 函数不能在其他线程调用），请求等待执行结果；
+//   - 用户与规则操作只支持 PostgreSQL 后端，不支持 shard_column。
+
+var (
+	adminListen         string
+	adminTLSCert        string
+	adminTLSKey         string
+	adminClientCA       string
+	adminAllowedClients string
+
+	adminServer *http.Server
+	adminKicks  = make(chan adminKick, 64)
+
+	// kick 执行一次踢下线（见 kickClient），测试中替换
+	kick = kickClient
+)
+
+const (
+	adminMaxBody     = 1 << 20
+	adminKickTimeout = 5 * time.Second
+
+	adminUpsertUser = `INSERT INTO iot_devices (username, password_hash, salt, enabled) VALUES ($1, COALESCE($2, ''), '', COALESCE($3, 1))
+ON CONFLICT (username) DO UPDATE SET
+  password_hash = COALESCE($2, iot_devices.password_hash),
+  salt = CASE WHEN $2 IS NULL THEN iot_devices.salt ELSE '' END,
+  enabled = COALESCE($3, iot_devices.enabled)
+RETURNING (xmax = 0)`
+)
+
+// adminRule 是接口中的一条规则；access 与 useradm acl add 的写法相同。
+type adminRule struct {
+	Pattern string `json:"pattern"`
+	Access  string `json:"access"`
+}
+
+type adminUserView struct {
+	Username    string      `json:"username"`
+	Enabled     bool        `json:"enabled"`
+	HasPassword bool        `json:"has_password"`
+	ClientIDs   []string    `json:"client_ids"`
+	ACLs        []adminRule `json:"acls"`
+}
+
+// adminUserUpdate 是 PUT /v1/users/{username} 的请求体；省略的字段保持不变。
+type adminUserUpdate struct {
+	Password     string   `json:"password"`
+	PasswordHash string   `json:"password_hash"`
+	Enabled      *bool    `json:"enabled"`
+	ClientIDs    []string `json:"client_ids"` // 给出（包括 []）时整体替换绑定
+}
+
+type adminKick struct {
+	clientID string
+	username string
+	result   chan error
+}
+
+// adminError 带 HTTP 状态码；其他错误按 500 返回。
+type adminError struct {
+	status int
+	msg    string
+}
+
+func (e *adminError) Error() string { return e.msg }
+
+func adminBadRequest(format string, args ...any) error {
+	return &adminError{http.StatusBadRequest, fmt.Sprintf(format, args...)}
+}
+
+var errAdminNotFound = &adminError{http.StatusNotFound, "user not found"}
+
+func writeAdminJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeAdminError(w http.ResponseWriter, err error) {
+	var ae *adminError
+	if !errors.As(err, &ae) {
+		ae = &adminError{http.StatusInternalServerError, err.Error()}
+	}
+	writeAdminJSON(w, ae.status, map[string]string{"error": ae.msg})
+}
+
+// adminCaller 返回客户端证书的 CN，用于授权与日志。
+func adminCaller(r *http.Request) string {
+	if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+		return ""
+	}
+	return r.TLS.PeerCertificates[0].Subject.CommonName
+}
+
+// adminAllowed 判断 CN 是否在 admin_allowed_clients 中；未设置时 CA 签发的证书都可以。
+func adminAllowed(cn string) bool {
+	if strings.TrimSpace(adminAllowedClients) == "" {
+		return cn != ""
+	}
+	for _, c := range strings.Split(adminAllowedClients, ",") {
+		if strings.TrimSpace(c) == cn {
+			return true
+		}
+	}
+	return false
+}
+
+func adminMux() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v1/users/{username}", adminGetUser)
+	mux.HandleFunc("PUT /v1/users/{username}", adminPutUser)
+	mux.HandleFunc("DELETE /v1/users/{username}", adminDeleteUser)
+	mux.HandleFunc("PUT /v1/users/{username}/acls", adminPutACLs)
+	mux.HandleFunc("POST /v1/cache/flush", adminFlushCache)
+	mux.HandleFunc("POST /v1/kick", adminKickClient)
+	mux.HandleFunc("GET /v1/status", func(w http.ResponseWriter, r *http.Request) {
+		writeAdminJSON(w, http.StatusOK, pluginStatus())
+	})
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if cn := adminCaller(r); !adminAllowed(cn) {
+			mosqLog(logWarning, "auth-plugin: admin API rejected client certificate %q from %s", cn, r.RemoteAddr)
+			writeAdminError(w, &adminError{http.StatusForbidden, "client certificate not allowed"})
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, adminMaxBody)
+		mux.ServeHTTP(w, r)
+	})
+}
+
+func decodeAdmin(r *http.Request, v any) error {
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return adminBadRequest("invalid JSON: %v", err)
+	}
+	return nil
+}
+
+func adminStore(ctx context.Context) (pgStore, error) {
+	if !usesBackend(driverPostgres) {
+		return pgStore{}, &adminError{http.StatusNotImplemented, "user and ACL endpoints need the postgres backend"}
+	}
+	if databaseDown() {
+		return pgStore{}, errDatabaseDown
+	}
+	pg, err := openPGStore(ctx)
+	if err != nil {
+		return pgStore{}, &adminError{http.StatusNotImplemented, "admin API: " + err.Error()}
+	}
+	return pg, nil
+}
+
+func adminUsername(r *http.Request) (string, error) {
+	u := r.PathValue("username")
+	if u == "" || u == "*" {
+		return "", adminBadRequest("username %q is not a user", u)
+	}
+	return u, nil
+}
+
+// loadAdminUser 读取账号、绑定与规则；账号不存在时返回 errAdminNotFound。
+func loadAdminUser(ctx context.Context, tx pgx.Tx, username string) (adminUserView, error) {
+	v := adminUserView{Username: username, ClientIDs: []string{}, ACLs: []adminRule{}}
+	var enabled int16
+	err := tx.QueryRow(ctx, "SELECT enabled, password_hash <> '' FROM iot_devices WHERE username = $1", username).
+		Scan(&enabled, &v.HasPassword)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return v, errAdminNotFound
+	}
+	if err != nil {
+		return v, err
+	}
+	v.Enabled = enabled != 0
+	rows, err := tx.Query(ctx, "SELECT client_id FROM client_bindings WHERE username = $1 ORDER BY client_id", username)
+	if err != nil {
+		return v, err
+	}
+	if v.ClientIDs, err = pgx.CollectRows(rows, pgx.RowTo[string]); err != nil {
+		return v, err
+	}
+	rows, err = tx.Query(ctx, "SELECT pattern, acc FROM acls WHERE username = $1 ORDER BY pattern", username)
+	if err != nil {
+		return v, err
+	}
+	v.ACLs, err = pgx.CollectRows(rows, func(row pgx.CollectableRow) (adminRule, error) {
+		var r adminRule
+		var acc int
+		err := row.Scan(&r.Pattern, &acc)
+		r.Access = aclrule.FormatAcc(acc)
+		return r, err
+	})
+	return v, err
+}
+
+func adminGetUser(w http.ResponseWriter, r *http.Request) {
+	username, err := adminUsername(r)
+	if err != nil {
+		writeAdminError(w, err)
+		return
+	}
+	ctx, cancel := ctxTimeout()
+	defer cancel()
+	pg, err := adminStore(ctx)
+	if err != nil {
+		writeAdminError(w, err)
+		return
+	}
+	var v adminUserView
+	err = pgx.BeginFunc(ctx, pg.p, func(tx pgx.Tx) error {
+		v, err = loadAdminUser(ctx, tx, username)
+		return err
+	})
+	if err != nil {
+		writeAdminError(w, err)
+		return
+	}
+	writeAdminJSON(w, http.StatusOK, v)
+}
+
+// adminHash 返回要写入的密码哈希；都未给出时为 nil（保持不变）。
+func adminHash(u adminUserUpdate) (*string, error) {
+	switch {
+	case u.Password != "" && u.PasswordHash != "":
+		return nil, adminBadRequest("give either password or password_hash")
+	case u.Password != "":
+		h, err := bcrypt.GenerateFromPassword([]byte(u.Password), minBcryptCost)
+		if err != nil {
+			return nil, adminBadRequest("password: %v", err)
+		}
+		s := string(h)
+		return &s, nil
+	case u.PasswordHash != "":
+		if !isBcryptHash(u.PasswordHash) && !isMosquittoHash(u.PasswordHash) {
+			return nil, adminBadRequest("password_hash must be bcrypt or a mosquitto $6$/$7$ hash")
+		}
+		return &u.PasswordHash, nil
+	}
+	return nil, nil
+}
+
+func adminPutUser(w http.ResponseWriter, r *http.Request) {
+	username, err := adminUsername(r)
+	if err != nil {
+		writeAdminError(w, err)
+		return
+	}
+	var in adminUserUpdate
+	if err := decodeAdmin(r, &in); err != nil {
+		writeAdminError(w, err)
+		return
+	}
+	hash, err := adminHash(in)
+	if err != nil {
+		writeAdminError(w, err)
+		return
+	}
+	var enabled *int16
+	if in.Enabled != nil {
+		e := int16(0)
+		if *in.Enabled {
+			e = 1
+		}
+		enabled = &e
+	}
+	ctx, cancel := ctxTimeout()
+	defer cancel()
+	pg, err := adminStore(ctx)
+	if err != nil {
+		writeAdminError(w, err)
+		return
+	}
+	var (
+		created bool
+		v       adminUserView
+	)
+	err = pgx.BeginFunc(ctx, pg.p, func(tx pgx.Tx) error {
+		if err := tx.QueryRow(ctx, adminUpsertUser, username, hash, enabled).Scan(&created); err != nil {
+			return err
+		}
+		if in.ClientIDs != nil {
+			if _, err := tx.Exec(ctx, "DELETE FROM client_bindings WHERE username = $1", username); err != nil {
+				return err
+			}
+			for _, cid := range in.ClientIDs {
+				if _, err := tx.Exec(ctx, "INSERT INTO client_bindings (username, client_id) VALUES ($1, $2) ON CONFLICT DO NOTHING",
+					username, cid); err != nil {
+					return err
+				}
+			}
+		}
+		v, err = loadAdminUser(ctx, tx, username)
+		return err
+	})
+	if err != nil {
+		writeAdminError(w, err)
+		return
+	}
+	adminChanged(r, "updated", username)
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+	writeAdminJSON(w, status, v)
+}
+
+func adminDeleteUser(w http.ResponseWriter, r *http.Request) {
+	username, err := adminUsername(r)
+	if err != nil {
+		writeAdminError(w, err)
+		return
+	}
+	ctx, cancel := ctxTimeout()
+	defer cancel()
+	pg, err := adminStore(ctx)
+	if err != nil {
+		writeAdminError(w, err)
+		return
+	}
+	err = pgx.BeginFunc(ctx, pg.p, func(tx pgx.Tx) error {
+		tag, err := tx.Exec(ctx, "DELETE FROM iot_devices WHERE username = $1", username)
+		if err != nil {
+			return err
+		}
+		if tag.RowsAffected() == 0 {
+			return errAdminNotFound
+		}
+		_, err = tx.Exec(ctx, "DELETE FROM acls WHERE username = $1", username)
+		return err
+	})
+	if err != nil {
+		writeAdminError(w, err)
+		return
+	}
+	adminChanged(r, "deleted", username)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// parseAdminRules 校验规则并合并同一模式的权限。
+func parseAdminRules(in []adminRule) (map[string]int, error) {
+	rules := make(map[string]int, len(in))
+	for _, r := range in {
+		if err := aclrule.ValidatePattern(r.Pattern); err != nil {
+			return nil, adminBadRequest("%v", err)
+		}
+		acc, err := aclrule.ParseAcc(r.Access)
+		if err != nil {
+			return nil, adminBadRequest("pattern %q: %v", r.Pattern, err)
+		}
+		rules[r.Pattern] |= acc
+	}
+	return rules, nil
+}
+
+func adminPutACLs(w http.ResponseWriter, r *http.Request) {
+	username := r.PathValue("username")
+	var in []adminRule
+	if err := decodeAdmin(r, &in); err != nil {
+		writeAdminError(w, err)
+		return
+	}
+	rules, err := parseAdminRules(in)
+	if err != nil {
+		writeAdminError(w, err)
+		return
+	}
+	ctx, cancel := ctxTimeout()
+	defer cancel()
+	pg, err := adminStore(ctx)
+	if err != nil {
+		writeAdminError(w, err)
+		return
+	}
+	// '*' 是全局规则，不要求有对应账号
+	err = pgx.BeginFunc(ctx, pg.p, func(tx pgx.Tx) error {
+		if username != "*" {
+			var exists bool
+			if err := tx.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM iot_devices WHERE username = $1)", username).Scan(&exists); err != nil {
+				return err
+			}
+			if !exists {
+				return errAdminNotFound
+			}
+		}
+		if _, err := tx.Exec(ctx, "DELETE FROM acls WHERE username = $1", username); err != nil {
+			return err
+		}
+		for pattern, acc := range rules {
+			if _, err := tx.Exec(ctx, "INSERT INTO acls (username, pattern, acc) VALUES ($1, $2, $3)", username, pattern, acc); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		writeAdminError(w, err)
+		return
+	}
+	adminChanged(r, fmt.Sprintf("replaced %d rule(s) of", len(rules)), username)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// adminChanged 记录写操作并清除该用户的 Redis 缓存（修改 '*' 时清空全部）。
+func adminChanged(r *http.Request, what, username string) {
+	mosqLog(logNotice, "auth-plugin: admin API %s %s %s", adminCaller(r), what, redactID(username))
+	if redisCacheTTL.get() <= 0 {
+		return
+	}
+	target := username
+	if target == "*" {
+		target = ""
+	}
+	ctx, cancel := ctxTimeout()
+	defer cancel()
+	if _, err := flushCache(ctx, target); err != nil {
+		mosqLog(logWarning, "auth-plugin: admin API: flushing cache for %s: %v", redactID(username), err)
+	}
+}
+
+func adminFlushCache(w http.ResponseWriter, r *http.Request) {
+	var in struct {
+		Username string `json:"username"`
+	}
+	if err := decodeAdmin(r, &in); err != nil {
+		writeAdminError(w, err)
+		return
+	}
+	ctx, cancel := ctxTimeout()
+	defer cancel()
+	n, err := flushCache(ctx, in.Username)
+	if err != nil {
+		writeAdminError(w, err)
+		return
+	}
+	mosqLog(logInfo, "auth-plugin: admin API %s flushed %d cache key(s)", adminCaller(r), n)
+	writeAdminJSON(w, http.StatusOK, map[string]int64{"deleted": n})
+}
+
+func adminKickClient(w http.ResponseWriter, r *http.Request) {
+	var in struct {
+		ClientID string `json:"client_id"`
+		Username string `json:"username"`
+	}
+	if err := decodeAdmin(r, &in); err != nil {
+		writeAdminError(w, err)
+		return
+	}
+	if (in.ClientID == "") == (in.Username == "") {
+		writeAdminError(w, adminBadRequest("give exactly one of client_id or username"))
+		return
+	}
+	// 踢下线在 TICK 回调中执行，插件 API v4 没有 TICK
+	if mosqplugin.APIVersion() < 5 {
+		writeAdminError(w, &adminError{http.StatusNotImplemented, "kicking clients needs plugin API v5"})
+		return
+	}
+	k := adminKick{clientID: in.ClientID, username: in.Username, result: make(chan error, 1)}
+	select {
+	case adminKicks <- k:
+	default:
+		writeAdminError(w, &adminError{http.StatusServiceUnavailable, "too many pending kicks"})
+		return
+	}
+	select {
+	case err := <-k.result:
+		if errors.Is(err, mosqplugin.ErrNotConnected) {
+			writeAdminError(w, &adminError{http.StatusNotFound, "client not connected"})
+			return
+		}
+		if err != nil {
+			writeAdminError(w, fmt.Errorf("kick failed: %w", err))
+			return
+		}
+	case <-time.After(adminKickTimeout):
+		writeAdminError(w, &adminError{http.StatusGatewayTimeout, "broker did not process the kick in time"})
+		return
+	}
+	who := "client " + redactID(in.ClientID)
+	if in.Username != "" {
+		who = "user " + redactID(in.Username)
+	}
+	mosqLog(logNotice, "auth-plugin: admin API %s kicked %s", adminCaller(r), who)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// runAdminKicks 在 TICK 回调（broker 主线程）中执行排队的踢下线请求。
+func runAdminKicks() {
+	for {
+		select {
+		case k := <-adminKicks:
+			k.result <- kick(k.clientID, k.username)
+		default:
+			return
+		}
+	}
+}
+
+// adminTLSConfig 加载服务端证书与客户端 CA，要求并校验客户端证书。
+func adminTLSConfig() (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(adminTLSCert, adminTLSKey)
+	if err != nil {
+		return nil, fmt.Errorf("admin_tls_cert/admin_tls_key: %w", err)
+	}
+	pem, err := os.ReadFile(adminClientCA)
+	if err != nil {
+		return nil, fmt.Errorf("admin_client_ca: %w", err)
+	}
+	cas := x509.NewCertPool()
+	if !cas.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("admin_client_ca: no certificates in %s", adminClientCA)
+	}
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    cas,
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
+
+// startAdmin 同步绑定端口并加载证书，任何一步失败都直接返回错误。
+func startAdmin() error {
+	if adminListen == "" {
+		return nil
+	}
+	cfg, err := adminTLSConfig()
+	if err != nil {
+		return err
+	}
+	ln, err := net.Listen("tcp", adminListen)
+	if err != nil {
+		return fmt.Errorf("admin_listen: %w", err)
+	}
+	srv := &http.Server{Handler: adminMux(), ReadHeaderTimeout: 10 * time.Second}
+	adminServer = srv
+	go srv.Serve(tls.NewListener(ln, cfg))
+	return nil
+}
+
+func stopAdmin() {
+	if adminServer == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	adminServer.Shutdown(ctx)
+	adminServer = nil
+}
+
+// kickClient 断开指定客户端 ID 或用户名的所有连接；只能在 broker 主线程调用。
+func kickClient(clientID, username string) error {
+	if clientID != "" {
+		return mosqplugin.KickClientID(clientID)
+	}
+	return mosqplugin.KickUsername(username)
+}
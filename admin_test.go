@@ -0,0 +1,129 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"auth-plugin/pkg/mosqplugin"
+)
+
+func adminRequest(method, path, body, cn string) *http.Request {
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	if cn != "" {
+		r.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{{Subject: pkix.Name{CommonName: cn}}}}
+	}
+	return r
+}
+
+func TestAdminAllowed(t *testing.T) {
+	old := adminAllowedClients
+	t.Cleanup(func() { adminAllowedClients = old })
+
+	adminAllowedClients = ""
+	if !adminAllowed("anything") || adminAllowed("") {
+		t.Fatal("without admin_allowed_clients any CN from the CA is allowed, an empty one is not")
+	}
+	adminAllowedClients = "operator, terraform"
+	if !adminAllowed("terraform") || adminAllowed("other") {
+		t.Fatal("admin_allowed_clients not applied")
+	}
+
+	h := adminMux()
+	for cn, want := range map[string]int{"": http.StatusForbidden, "other": http.StatusForbidden, "operator": http.StatusBadRequest} {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, adminRequest(http.MethodPost, "/v1/kick", "{}", cn))
+		if rec.Code != want {
+			t.Errorf("CN %q: status %d, want %d", cn, rec.Code, want)
+		}
+	}
+}
+
+func TestAdminHash(t *testing.T) {
+	t.Parallel()
+	if h, err := adminHash(adminUserUpdate{}); h != nil || err != nil {
+		t.Fatalf("no password: %v, %v", h, err)
+	}
+	if _, err := adminHash(adminUserUpdate{Password: "a", PasswordHash: "b"}); err == nil {
+		t.Fatal("password and password_hash together should fail")
+	}
+	if _, err := adminHash(adminUserUpdate{PasswordHash: "5f4dcc3b5aa765d61d8327deb882cf99"}); err == nil {
+		t.Fatal("unsalted hashes should be refused")
+	}
+	h, err := adminHash(adminUserUpdate{Password: "secret"})
+	if err != nil || h == nil || !isBcryptHash(*h) {
+		t.Fatalf("password: %v, %v", h, err)
+	}
+}
+
+func TestParseAdminRules(t *testing.T) {
+	t.Parallel()
+	rules, err := parseAdminRules([]adminRule{
+		{"devices/{username}/#", "read"},
+		{"devices/{username}/#", "subscribe"},
+		{"cmd/{clientid}", "w"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rules) != 2 || rules["devices/{username}/#"] != aclRead|aclSubscribe || rules["cmd/{clientid}"] != aclWrite {
+		t.Fatalf("got %v", rules)
+	}
+	for _, bad := range [][]adminRule{{{"a/#/b", "read"}}, {{"a/b", "delete"}}, {{"a/b", "0"}}} {
+		if _, err := parseAdminRules(bad); err == nil {
+			t.Errorf("parseAdminRules(%v) should fail", bad)
+		}
+	}
+}
+
+func TestAdminKick(t *testing.T) {
+	old := adminAllowedClients
+	t.Cleanup(func() { adminAllowedClients = old })
+	adminAllowedClients = ""
+	h := adminMux()
+
+	for _, body := range []string{`{}`, `{"client_id": "a", "username": "b"}`, `{"clientid": "a"}`} {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, adminRequest(http.MethodPost, "/v1/kick", body, "operator"))
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: status %d, want 400", body, rec.Code)
+		}
+	}
+
+	oldKick := kick
+	t.Cleanup(func() { kick = oldKick })
+	kick = func(clientID, _ string) error {
+		if clientID != "sensor-1" {
+			return mosqplugin.ErrNotConnected
+		}
+		return nil
+	}
+	// 模拟 broker 的 TICK 回调
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case <-time.After(5 * time.Millisecond):
+				runAdminKicks()
+			}
+		}
+	}()
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, adminRequest(http.MethodPost, "/v1/kick", `{"client_id": "sensor-1"}`, "operator"))
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("kick: status %d %s", rec.Code, rec.Body)
+	}
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, adminRequest(http.MethodPost, "/v1/kick", `{"client_id": "sensor-2"}`, "operator"))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("kick of a client that is not connected: status %d %s", rec.Code, rec.Body)
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// 降级告警：进入 fail-open / 宽限模式等降级状态时 POST 到 alert_webhook_url。
+// 同一类告警在 alert_dedup_interval 内只发一次；发送失败按指数退避重试，
+// 全部在后台协程完成，不阻塞 broker 回调。
+
+const (
+	alertQueueSize   = 100
+	alertMaxAttempts = 5
+)
+
+var (
+	alertWebhookURL    string
+	alertDedupInterval = 5 * time.Minute
+	alertRetryBase     = time.Second
+	alertClient        = &http.Client{Timeout: 5 * time.Second}
+
+	alertMu    sync.Mutex
+	alertLast  = map[string]time.Time{}
+	alertQueue chan alertPayload
+	alertStop  chan struct{}
+	alertDone  chan struct{}
+)
+
+type alertPayload struct {
+	Source    string `json:"source"`
+	Host      string `json:"host"`
+	Kind      string `json:"kind"`
+	Message   string `json:"message"`
+	Timestamp string `json:"timestamp"`
+	Text      string `json:"text"` // Slack/Teams 等 incoming webhook 直接展示
+}
+
+// raiseAlert 登记一条降级告警；去重窗口内的重复告警或队列已满时直接丢弃。
+func raiseAlert(kind, format string, args ...any) {
+	q := alertQueue
+	if q == nil || !featureFlags.on(flagAlerts) {
+		return
+	}
+	now := time.Now()
+	alertMu.Lock()
+	if last, ok := alertLast[kind]; ok && now.Sub(last) < alertDedupInterval {
+		alertMu.Unlock()
+		return
+	}
+	alertLast[kind] = now
+	alertMu.Unlock()
+
+	host, _ := os.Hostname()
+	msg := fmt.Sprintf(format, args...)
+	p := alertPayload{
+		Source: "mosq-pg", Host: host, Kind: kind, Message: msg,
+		Timestamp: now.UTC().Format(time.RFC3339),
+		Text:      fmt.Sprintf("[mosq-pg %s] %s: %s", host, kind, msg),
+	}
+	select {
+	case q <- p:
+	default:
+	}
+}
+
+func postAlert(p alertPayload) error {
+	body, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	resp, err := alertClient.Post(alertWebhookURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+// deliverAlert 发送一条告警，失败时退避重试；stop 关闭时放弃剩余重试。
+func deliverAlert(p alertPayload, stop <-chan struct{}) error {
+	delay := alertRetryBase
+	var err error
+	for attempt := 1; attempt <= alertMaxAttempts; attempt++ {
+		if err = postAlert(p); err == nil {
+			return nil
+		}
+		if attempt == alertMaxAttempts {
+			break
+		}
+		select {
+		case <-stop:
+			return err
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+	return err
+}
+
+func startAlerts() {
+	if alertWebhookURL == "" {
+		return
+	}
+	q, stop, done := make(chan alertPayload, alertQueueSize), make(chan struct{}), make(chan struct{})
+	alertQueue, alertStop, alertDone = q, stop, done
+	go func() {
+		defer close(done)
+		for {
+			select {
+			case <-stop:
+				if n := drainQueue(q, drainDeadline, func(p alertPayload) { deliverAlert(p, stop) }); n > 0 {
+					mosqLog(logWarning, "auth-plugin: %d alerts not delivered before shutdown", n)
+				}
+				return
+			case p := <-q:
+				if err := deliverAlert(p, stop); err != nil {
+					mosqLog(logWarning, "auth-plugin: alert %s not delivered: %v", p.Kind, err)
+				}
+			}
+		}
+	}()
+}
+
+func stopAlerts() {
+	if alertStop == nil {
+		return
+	}
+	close(alertStop)
+	<-alertDone
+	alertQueue, alertStop, alertDone = nil, nil, nil
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDeliverAlertRetries(t *testing.T) {
+	oldURL, oldBase := alertWebhookURL, alertRetryBase
+	t.Cleanup(func() { alertWebhookURL, alertRetryBase = oldURL, oldBase })
+
+	var calls atomic.Int32
+	var got alertPayload
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) < 3 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		json.NewDecoder(r.Body).Decode(&got)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	alertWebhookURL, alertRetryBase = srv.URL, time.Millisecond
+	if err := deliverAlert(alertPayload{Kind: "fail_open_acl", Message: "db down"}, make(chan struct{})); err != nil {
+		t.Fatal(err)
+	}
+	if calls.Load() != 3 || got.Kind != "fail_open_acl" {
+		t.Fatalf("calls = %d, payload = %+v", calls.Load(), got)
+	}
+}
+
+func TestRaiseAlertDedup(t *testing.T) {
+	oldQueue, oldLast, oldInterval := alertQueue, alertLast, alertDedupInterval
+	t.Cleanup(func() { alertQueue, alertLast, alertDedupInterval = oldQueue, oldLast, oldInterval })
+
+	alertQueue, alertLast, alertDedupInterval = make(chan alertPayload, 10), map[string]time.Time{}, time.Minute
+	raiseAlert("fail_open_auth", "db down: %s", "timeout")
+	raiseAlert("fail_open_auth", "db down: %s", "timeout")
+	raiseAlert("fail_open_acl", "db down")
+	if n := len(alertQueue); n != 2 {
+		t.Fatalf("queued %d alerts, want 2 (one per kind)", n)
+	}
+	if p := <-alertQueue; p.Message != "db down: timeout" || p.Text == "" {
+		t.Fatalf("unexpected payload %+v", p)
+	}
+}
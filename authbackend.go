@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"errors"
+)
+
+// authBackend 是回调与身份来源之间的接口：dbAuth/dbACL 只通过它认证、检查 ACL，不接触 pgx、
+// database/sql、Redis 或 gRPC 客户端。读表的后端（postgres/mysql/redis）由 storeBackend 在 store
+// 之上实现，gRPC 授权服务由 grpcBackend 实现；新的身份来源或测试中的假后端只需实现这四个方法。
+type authBackend interface {
+	// authenticate 校验密码；found 为 false 表示该后端不认识这个用户，由链上的下一个后端决定。
+	authenticate(ctx context.Context, username, password, clientID, address string, port int, pol requestPolicy) (d decision, found bool, err error)
+	// checkACL 判断用户能否以 access 访问 topic；取消订阅由 dbACL 直接放行，不会到这里。
+	checkACL(ctx context.Context, username, clientID, topic string, access, port int, pol requestPolicy) (decision, error)
+	// bindings 判断用户名与客户端 ID 之间是否有绑定（enforce_bind）。
+	bindings(ctx context.Context, username, clientID string) (bool, error)
+	// close 释放后端的连接；之后再使用时重新建立。
+	close()
+}
+
+// authBackend 返回实例上名为 name 的后端；连接在第一次查询时建立。
+func (in *instance) authBackend(name string) authBackend {
+	if in.backendFor != nil {
+		return in.backendFor(name)
+	}
+	if name == driverGRPC {
+		return grpcBackend{}
+	}
+	return storeBackend{in, name}
+}
+
+// closeBackends 关闭实例的连接；MySQL、Redis（含缓存）与 gRPC 是进程级的，由 primary 关闭。
+func (in *instance) closeBackends() {
+	names := []string{driverPostgres}
+	if in == primary {
+		names = append(names, driverMySQL, driverRedis, driverGRPC)
+	}
+	for _, name := range names {
+		in.authBackend(name).close()
+	}
+}
+
+// storeBackend 是读表的后端，每次请求通过 openStore 取得（可能带缓存的）store。
+type storeBackend struct {
+	in   *instance
+	name string
+}
+
+func (b storeBackend) authenticate(ctx context.Context, username, password, clientID, _ string, _ int, pol requestPolicy) (decision, bool, error) {
+	st, err := openStore(ctx, b.in, b.name)
+	if err != nil {
+		return decision{}, false, err
+	}
+	return storeAuth(ctx, st, username, password, clientID, pol)
+}
+
+func (b storeBackend) checkACL(ctx context.Context, username, clientID, topic string, access, _ int, _ requestPolicy) (decision, error) {
+	st, err := openStore(ctx, b.in, b.name)
+	if err != nil {
+		return decision{}, err
+	}
+	rules, err := st.rules(ctx, username)
+	if err != nil {
+		return decision{}, err
+	}
+	return aclDecision(rules, username, clientID, topic, access), nil
+}
+
+func (b storeBackend) bindings(ctx context.Context, username, clientID string) (bool, error) {
+	st, err := openStore(ctx, b.in, b.name)
+	if err != nil {
+		return false, err
+	}
+	return st.bound(ctx, username, clientID)
+}
+
+func (b storeBackend) close() {
+	switch b.name {
+	case driverMySQL:
+		closeMySQL()
+	case driverRedis:
+		closeRedis()
+	default:
+		b.in.closePool()
+	}
+}
+
+// storeAuth 在一个读表的后端上校验密码；found 为 false 表示该后端没有这个用户。
+func storeAuth(ctx context.Context, st store, username, password, clientID string, pol requestPolicy) (decision, bool, error) {
+	row, found, err := st.user(ctx, username)
+	if err != nil || !found {
+		return denied(reasonUnknownUser), false, err
+	}
+	if !row.enabled {
+		return denied(reasonDisabled), true, nil
+	}
+	var code string
+	if totpRequired(username) {
+		var split bool
+		if password, code, split = splitTOTP(password); !split {
+			return denied(reasonTOTP), true, nil
+		}
+	}
+	hash := row.hash
+	ok, weak := verifyPassword(hash, row.salt, password)
+	if !ok {
+		return denied(reasonBadPassword), true, nil
+	}
+	if weak != "" {
+		if !weakHashAllowed(hash) {
+			weakHashRejected.Add(1)
+			mosqLog(logWarning, "auth-plugin: rejecting %s (conn %s): %s (weak_hash_policy=reject)",
+				redactID(username), connIDFrom(ctx), weak)
+			return denied(reasonWeakHash), true, nil
+		}
+		weakHashLogins.Add(1)
+		if weakHashPolicy != weakHashAllow {
+			mosqLog(logWarning, "auth-plugin: %s (conn %s) authenticated with a weak password hash: %s",
+				redactID(username), connIDFrom(ctx), weak)
+		}
+	}
+	if totpRequired(username) {
+		ok, reason, err := verifyTOTP(ctx, st, username, code)
+		if err != nil {
+			return decision{}, true, err
+		}
+		if !ok {
+			mosqLog(logNotice, "auth-plugin: rejecting %s (conn %s): %s",
+				redactID(username), connIDFrom(ctx), reason)
+			return denied(reasonTOTP), true, nil
+		}
+	}
+
+	if pol.enforceBind {
+		bound, err := st.bound(ctx, username, clientID)
+		if err != nil || !bound {
+			return denied(reasonNotBound), true, err
+		}
+	}
+	return allowed(reasonOK), true, nil
+}
+
+// grpcBackend 是外部授权服务；它总是给出结论，客户端绑定也由它自己判断。
+type grpcBackend struct{}
+
+var errAuthorizerBindings = errors.New("the gRPC authorizer checks client bindings itself")
+
+func (grpcBackend) authenticate(ctx context.Context, username, password, clientID, address string, port int, pol requestPolicy) (decision, bool, error) {
+	// 授权服务不校验一次性验证码，totp_users 中的账号不能经它登录（validateOptions 已报告）
+	if totpRequired(username) {
+		return denied(reasonTOTP), true, nil
+	}
+	d, err := authorizerAuth(ctx, username, password, clientID, address, port, pol)
+	return d, true, err
+}
+
+func (grpcBackend) checkACL(ctx context.Context, username, clientID, topic string, access, port int, pol requestPolicy) (decision, error) {
+	return authorizerACL(ctx, username, clientID, topic, access, port, pol)
+}
+
+func (grpcBackend) bindings(context.Context, string, string) (bool, error) {
+	return false, errAuthorizerBindings
+}
+
+func (grpcBackend) close() { closeGRPC() }
+
+// dbAuth 按 backends 顺序认证；timeout_ms 限制的是整条链的耗时。
+func dbAuth(parent context.Context, in *instance, username, password, clientID, address string, port int, pol requestPolicy) (decision, error) {
+	if username == "" || password == "" {
+		return denied(reasonNoCredentials), nil
+	}
+	if in == primary && databaseDown() {
+		return decision{}, errDatabaseDown
+	}
+	ctx, cancel := ctxWithTimeout(parent, pol.timeout)
+	defer cancel()
+
+	d, err := runChain(in.backends(), func(b backend) (decision, bool, error) {
+		return in.authBackend(b.name).authenticate(ctx, username, password, clientID, address, port, pol)
+	})
+	// 只有真正查询过才更新健康状态，空凭据这类直接得出的结论不说明数据库可用；
+	// 健康状态描述的是 primary 的数据库，其他实例的故障不影响它
+	if in == primary {
+		recordDBResult(err)
+	}
+	if totpRequired(username) {
+		// 密码里带着一次性验证码，结论不能缓存
+		d.ttl = 0
+	}
+	return d, err
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// fakeBackend 按用户名给出认证结论：不在 users 中的用户视为不认识；err 非空时所有调用都失败。
+type fakeBackend struct {
+	users  map[string]bool
+	topics map[string]bool
+	err    error
+	calls  *int
+}
+
+func (f fakeBackend) authenticate(_ context.Context, username, _, _, _ string, _ int, _ requestPolicy) (decision, bool, error) {
+	*f.calls++
+	allow, found := f.users[username]
+	if !found {
+		return denied(reasonUnknownUser), false, f.err
+	}
+	if !allow {
+		return denied(reasonBadPassword), true, f.err
+	}
+	return allowed(reasonOK), true, f.err
+}
+
+func (f fakeBackend) checkACL(_ context.Context, _, _, topic string, _, _ int, _ requestPolicy) (decision, error) {
+	*f.calls++
+	if !f.topics[topic] {
+		return denied(reasonNoRule), f.err
+	}
+	return allowed(reasonOK), f.err
+}
+
+func (f fakeBackend) bindings(context.Context, string, string) (bool, error) { return false, f.err }
+
+func (f fakeBackend) close() {}
+
+func useFakeBackends(t *testing.T, chain string, fakes map[string]fakeBackend) {
+	t.Helper()
+	oldChain, oldFor := backendChain, primary.backendFor
+	t.Cleanup(func() { backendChain, primary.backendFor = oldChain, oldFor })
+	var err error
+	if backendChain, err = parseBackends(chain); err != nil {
+		t.Fatal(err)
+	}
+	primary.backendFor = func(name string) authBackend { return fakes[name] }
+}
+
+func TestDBAuthChain(t *testing.T) {
+	var redisCalls, pgCalls int
+	fakes := map[string]fakeBackend{
+		driverRedis:    {users: map[string]bool{"cached": false}, calls: &redisCalls},
+		driverPostgres: {users: map[string]bool{"sensor-1": true, "cached": true}, calls: &pgCalls},
+	}
+	useFakeBackends(t, "redis,postgres:required", fakes)
+	ctx, pol := context.Background(), primary.defaultPolicy()
+
+	if d, err := dbAuth(ctx, primary, "sensor-1", "pw", "c1", "", 0, pol); !d.allow || err != nil || pgCalls != 1 || d.backend != driverPostgres {
+		t.Fatalf("unknown to redis, allowed by postgres: %+v, %v (postgres calls %d)", d, err, pgCalls)
+	}
+	if d, err := dbAuth(ctx, primary, "cached", "pw", "c1", "", 0, pol); d.allow || err != nil || pgCalls != 1 || d.backend != driverRedis {
+		t.Fatalf("a deny from the first backend that knows the user must stop the chain: %+v, %v", d, err)
+	}
+	if d, _ := dbAuth(ctx, primary, "", "pw", "c1", "", 0, pol); d.allow || d.reason != reasonNoCredentials || redisCalls != 2 {
+		t.Fatal("an empty username must be denied without asking a backend")
+	}
+	if d, _ := dbAuth(ctx, primary, "nobody", "pw", "c1", "", 0, pol); d.allow || d.reason != reasonUnknownUser {
+		t.Fatalf("a user no backend knows: %+v", d)
+	}
+
+	fakes[driverRedis] = fakeBackend{err: errors.New("redis down"), calls: &redisCalls}
+	if d, err := dbAuth(ctx, primary, "sensor-1", "pw", "c1", "", 0, pol); !d.allow || err != nil {
+		t.Fatalf("a failing optional backend should be skipped: %+v, %v", d, err)
+	}
+	fakes[driverPostgres] = fakeBackend{err: errors.New("pg down"), calls: &pgCalls}
+	if _, err := dbAuth(ctx, primary, "sensor-1", "pw", "c1", "", 0, pol); err == nil {
+		t.Fatal("a failing required backend must fail the request")
+	}
+}
+
+func TestDBACLChain(t *testing.T) {
+	var redisCalls, pgCalls int
+	useFakeBackends(t, "redis,postgres", map[string]fakeBackend{
+		driverRedis:    {topics: map[string]bool{"a": true}, calls: &redisCalls},
+		driverPostgres: {topics: map[string]bool{"b": true}, calls: &pgCalls},
+	})
+	ctx, pol := context.Background(), primary.defaultPolicy()
+
+	if d, err := dbACL(ctx, primary, "u", "c", "a", aclRead, 0, pol); !d.allow || err != nil || pgCalls != 0 {
+		t.Fatalf("first allow should win: %+v, %v (postgres calls %d)", d, err, pgCalls)
+	}
+	if d, _ := dbACL(ctx, primary, "u", "c", "b", aclRead, 0, pol); !d.allow || pgCalls != 1 {
+		t.Fatal("a topic allowed by the second backend should be allowed")
+	}
+	if d, _ := dbACL(ctx, primary, "u", "c", "x", aclWrite, 0, pol); d.allow || d.reason != reasonNoRule {
+		t.Fatalf("a topic no backend allows should be denied: %+v", d)
+	}
+	if d, _ := dbACL(ctx, primary, "u", "c", "x", aclUnsubscribe, 0, pol); !d.allow || d.reason != reasonUnsubscribe || redisCalls != 3 {
+		t.Fatal("unsubscribe is always allowed without asking a backend")
+	}
+}
+
+// fakeStore 是只有一个账号的 store。
+type fakeStore struct {
+	d       deviceRow
+	isBound bool
+}
+
+func (s fakeStore) user(_ context.Context, username string) (deviceRow, bool, error) {
+	return s.d, username == "sensor-1", nil
+}
+
+func (s fakeStore) bound(context.Context, string, string) (bool, error) { return s.isBound, nil }
+
+func (s fakeStore) rules(context.Context, string) ([]aclRule, error) { return nil, nil }
+
+func (s fakeStore) ping(context.Context) error { return nil }
+
+func TestStoreAuth(t *testing.T) {
+	ctx := context.Background()
+	hash, _ := bcrypt.GenerateFromPassword([]byte("pw"), bcrypt.MinCost)
+	st := fakeStore{d: deviceRow{hash: string(hash), enabled: true}}
+	pol := requestPolicy{}
+
+	if d, found, err := storeAuth(ctx, st, "other", "pw", "c", pol); d.allow || found || err != nil {
+		t.Fatalf("unknown user: %+v %v %v", d, found, err)
+	}
+	if d, found, _ := storeAuth(ctx, st, "sensor-1", "wrong", "c", pol); d.allow || !found || d.reason != reasonBadPassword {
+		t.Fatal("a wrong password should be a deny from a backend that knows the user")
+	}
+	if d, _, _ := storeAuth(ctx, st, "sensor-1", "pw", "c", pol); !d.allow || d.ttl <= 0 {
+		t.Fatalf("correct password refused: %+v", d)
+	}
+	pol.enforceBind = true
+	if d, _, _ := storeAuth(ctx, st, "sensor-1", "pw", "c", pol); d.allow || d.reason != reasonNotBound {
+		t.Fatal("enforce_bind without a binding should deny")
+	}
+	st.isBound = true
+	if d, _, _ := storeAuth(ctx, st, "sensor-1", "pw", "c", pol); !d.allow {
+		t.Fatal("enforce_bind with a binding should allow")
+	}
+	st.d.enabled = false
+	if d, found, _ := storeAuth(ctx, st, "sensor-1", "pw", "c", pol); d.allow || !found || d.reason != reasonDisabled {
+		t.Fatal("disabled accounts must be denied")
+	}
+}
+
+func TestGRPCBackendRefusesTOTPUsers(t *testing.T) {
+	old := totpUsers
+	t.Cleanup(func() { totpUsers = old })
+	totpUsers = "ops-*"
+
+	// 授权服务不会被调用：验证码无人校验，账号不能经 grpc 登录
+	d, found, err := grpcBackend{}.authenticate(context.Background(), "ops-1", "pw123456", "c1", "", 0, primary.defaultPolicy())
+	if d.allow || !found || err != nil || d.reason != reasonTOTP {
+		t.Fatalf("totp user through grpc: %+v, found=%v, err=%v", d, found, err)
+	}
+}
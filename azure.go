@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Azure AD（Entra ID）令牌认证：Azure Database for PostgreSQL Flexible Server
+// 接受 AAD access token 作为密码。令牌来源依次为：
+//   1. AKS Workload Identity（AZURE_FEDERATED_TOKEN_FILE 等环境变量）
+//   2. 实例元数据服务 IMDS（VM / VMSS 上的托管标识）
+
+const (
+	azureDBResource      = "https://ossrdbms-aad.database.windows.net"
+	azureIMDSTokenURL    = "http://169.254.169.254/metadata/identity/oauth2/token"
+	azureDefaultAuthHost = "https://login.microsoftonline.com/"
+	// 令牌通常有效 1 小时以上，提前 5 分钟刷新
+	azureRefreshBuffer = 5 * time.Minute
+)
+
+var (
+	azureADAuth   bool
+	azureClientID string // 用户分配的托管标识；为空时使用系统分配标识
+
+	azureMu     sync.Mutex
+	azureTokens *azureTokenSource
+)
+
+type azureTokenSource struct {
+	clientID string
+	client   *http.Client
+
+	mu     sync.Mutex
+	token  string
+	expiry time.Time
+}
+
+func currentAzureTokenSource() *azureTokenSource {
+	azureMu.Lock()
+	defer azureMu.Unlock()
+	if azureTokens == nil {
+		azureTokens = &azureTokenSource{
+			clientID: azureClientID,
+			client:   &http.Client{Timeout: 10 * time.Second},
+		}
+	}
+	return azureTokens
+}
+
+// configure 在每次新建连接前注入最新的 AAD 令牌作为密码。
+func (a *azureTokenSource) configure(cfg *pgxpool.Config) {
+	prev := cfg.BeforeConnect
+	cfg.BeforeConnect = func(ctx context.Context, conf *pgx.ConnConfig) error {
+		if prev != nil {
+			if err := prev(ctx, conf); err != nil {
+				return err
+			}
+		}
+		token, err := a.accessToken(ctx)
+		if err != nil {
+			return err
+		}
+		conf.Password = token
+		return nil
+	}
+}
+
+func (a *azureTokenSource) accessToken(ctx context.Context) (string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.token != "" && time.Until(a.expiry) > azureRefreshBuffer {
+		return a.token, nil
+	}
+
+	var (
+		token string
+		ttl   time.Duration
+		err   error
+	)
+	if tokenFile := os.Getenv("AZURE_FEDERATED_TOKEN_FILE"); tokenFile != "" {
+		token, ttl, err = a.workloadIdentityToken(ctx, tokenFile)
+	} else {
+		token, ttl, err = a.imdsToken(ctx)
+	}
+	if err != nil {
+		return "", fmt.Errorf("azure: fetch access token: %w", err)
+	}
+	a.token = token
+	a.expiry = time.Now().Add(ttl)
+	mosqLog(logInfo, "auth-plugin: azure access token refreshed (expires in %s)", ttl.Round(time.Second))
+	return a.token, nil
+}
+
+type azureTokenResponse struct {
+	AccessToken string          `json:"access_token"`
+	ExpiresIn   json.RawMessage `json:"expires_in"` // IMDS 返回字符串，AAD v2 端点返回数字
+}
+
+func (r *azureTokenResponse) result() (string, time.Duration, error) {
+	if r.AccessToken == "" {
+		return "", 0, errors.New("empty access token")
+	}
+	secs, err := strconv.Atoi(strings.Trim(string(r.ExpiresIn), `"`))
+	if err != nil || secs <= 0 {
+		return "", 0, fmt.Errorf("invalid expires_in %s", r.ExpiresIn)
+	}
+	return r.AccessToken, time.Duration(secs) * time.Second, nil
+}
+
+func (a *azureTokenSource) imdsToken(ctx context.Context) (string, time.Duration, error) {
+	q := url.Values{}
+	q.Set("api-version", "2018-02-01")
+	q.Set("resource", azureDBResource)
+	if a.clientID != "" {
+		q.Set("client_id", a.clientID)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, azureIMDSTokenURL+"?"+q.Encode(), nil)
+	if err != nil {
+		return "", 0, err
+	}
+	req.Header.Set("Metadata", "true")
+	var out azureTokenResponse
+	if err := fetchJSON(a.client, req, &out); err != nil {
+		return "", 0, err
+	}
+	return out.result()
+}
+
+// workloadIdentityToken 用投射到 Pod 内的联合令牌换取 AAD 访问令牌（client_credentials + client_assertion）。
+func (a *azureTokenSource) workloadIdentityToken(ctx context.Context, tokenFile string) (string, time.Duration, error) {
+	assertion, err := os.ReadFile(tokenFile)
+	if err != nil {
+		return "", 0, err
+	}
+	tenant := os.Getenv("AZURE_TENANT_ID")
+	if tenant == "" {
+		return "", 0, errors.New("AZURE_TENANT_ID must be set for workload identity")
+	}
+	clientID := a.clientID
+	if clientID == "" {
+		clientID = os.Getenv("AZURE_CLIENT_ID")
+	}
+	if clientID == "" {
+		return "", 0, errors.New("azure_client_id or AZURE_CLIENT_ID must be set for workload identity")
+	}
+	authority := os.Getenv("AZURE_AUTHORITY_HOST")
+	if authority == "" {
+		authority = azureDefaultAuthHost
+	}
+
+	form := url.Values{}
+	form.Set("client_id", clientID)
+	form.Set("grant_type", "client_credentials")
+	form.Set("scope", azureDBResource+"/.default")
+	form.Set("client_assertion_type", "urn:ietf:params:oauth:client-assertion-type:jwt-bearer")
+	form.Set("client_assertion", strings.TrimSpace(string(assertion)))
+
+	endpoint := strings.TrimRight(authority, "/") + "/" + url.PathEscape(tenant) + "/oauth2/v2.0/token"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", 0, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	var out azureTokenResponse
+	if err := fetchJSON(a.client, req, &out); err != nil {
+		return "", 0, err
+	}
+	return out.result()
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestAzureTokenResponseResult(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name    string
+		body    string
+		wantTTL time.Duration
+		wantErr bool
+	}{
+		{"imds string expiry", `{"access_token":"tok","expires_in":"3599"}`, 3599 * time.Second, false},
+		{"aad numeric expiry", `{"access_token":"tok","expires_in":86399}`, 86399 * time.Second, false},
+		{"missing token", `{"expires_in":3600}`, 0, true},
+		{"bad expiry", `{"access_token":"tok","expires_in":"soon"}`, 0, true},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			var r azureTokenResponse
+			if err := json.Unmarshal([]byte(tc.body), &r); err != nil {
+				t.Fatalf("unmarshal: %v", err)
+			}
+			token, ttl, err := r.result()
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("result() err = %v, wantErr %v", err, tc.wantErr)
+			}
+			if !tc.wantErr && (token != "tok" || ttl != tc.wantTTL) {
+				t.Fatalf("result() = (%q, %v), want (tok, %v)", token, ttl, tc.wantTTL)
+			}
+		})
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+)
+
+// backends 把多个身份来源串成一条链，按顺序询问，例如 "redis,postgres:required,grpc"：
+//
+//   - 认证：第一个认识该用户的后端给出结论，允许或拒绝都立即结束（first-allow / first-deny）；
+//     不认识该用户的后端跳过。gRPC 授权服务总是给出结论，一般放在最后。
+//   - ACL：任一后端的规则允许即放行（first-allow），全部后端都未允许才拒绝。
+//   - 出错：标记 required 的后端出错时整个请求按错误处理（fail_open_* / 宽限模式）；
+//     其他后端出错时跳过，但链上没有任何后端给出结论时仍按错误处理，故障不会被当成拒绝。
+//
+// 每项可以带 :required 或 :off（保留在列表中但不启用）。未设置 backends 时只有 db_driver 一个后端。
+
+type backend struct {
+	name     string
+	required bool
+	enabled  bool
+}
+
+var (
+	backendChain []backend
+
+	backendSkipped atomic.Int64 // 非 required 后端出错被跳过的次数
+)
+
+func parseBackends(v string) ([]backend, error) {
+	var out []backend
+	seen := map[string]bool{}
+	enabled := 0
+	for _, item := range strings.Split(v, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		parts := strings.Split(item, ":")
+		name, ok := parseDBDriver(parts[0])
+		if !ok {
+			return nil, fmt.Errorf("unknown backend %q (want postgres, mysql, redis or grpc)", parts[0])
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("backend %s listed twice", name)
+		}
+		seen[name] = true
+		b := backend{name: name, enabled: true}
+		for _, flag := range parts[1:] {
+			switch strings.ToLower(strings.TrimSpace(flag)) {
+			case "required":
+				b.required = true
+			case "off", "disabled":
+				b.enabled = false
+			case "on", "enabled":
+				b.enabled = true
+			default:
+				return nil, fmt.Errorf("backend %s: unknown flag %q (want required or off)", name, flag)
+			}
+		}
+		if b.enabled {
+			enabled++
+		}
+		out = append(out, b)
+	}
+	if enabled == 0 {
+		return nil, errors.New("no backend enabled")
+	}
+	return out, nil
+}
+
+// activeBackends 返回启用的后端，按配置顺序。
+func activeBackends() []backend {
+	if len(backendChain) == 0 {
+		return []backend{{name: dbDriver, required: true, enabled: true}}
+	}
+	var out []backend
+	for _, b := range backendChain {
+		if b.enabled {
+			out = append(out, b)
+		}
+	}
+	return out
+}
+
+func usesBackend(name string) bool {
+	for _, b := range activeBackends() {
+		if b.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// usesStore 判断链上是否有读表的后端（grpc 以外）。
+func usesStore() bool {
+	for _, b := range activeBackends() {
+		if b.name != driverGRPC {
+			return true
+		}
+	}
+	return false
+}
+
+// backendNames 用于日志与选项问题，例如 "db_driver=mysql" 或 "backends=redis,grpc"。
+func backendNames() string {
+	if len(backendChain) == 0 {
+		return "db_driver=" + dbDriver
+	}
+	var names []string
+	for _, b := range activeBackends() {
+		names = append(names, b.name)
+	}
+	return "backends=" + strings.Join(names, ",")
+}
+
+func formatBackends(chain []backend) string {
+	var items []string
+	for _, b := range chain {
+		s := b.name
+		if b.required {
+			s += ":required"
+		}
+		if !b.enabled {
+			s += ":off"
+		}
+		items = append(items, s)
+	}
+	return strings.Join(items, ",")
+}
+
+// runChain 依次执行 step；decided 为 true 时以该后端的判定为结论。没有后端作出结论时返回
+// 最后一个后端的判定（例如 unknown_user、no_rule）。
+func runChain(chain []backend, step func(b backend) (d decision, decided bool, err error)) (decision, error) {
+	var skipped error
+	var last decision
+	for _, b := range chain {
+		d, decided, err := step(b)
+		if err != nil {
+			if len(chain) > 1 {
+				err = fmt.Errorf("backend %s: %w", b.name, err)
+			}
+			if b.required || len(chain) == 1 {
+				return decision{}, err
+			}
+			backendSkipped.Add(1)
+			mosqLogDeduped(logWarning, "auth-plugin: skipping "+err.Error())
+			if skipped == nil {
+				skipped = err
+			}
+			continue
+		}
+		if d.backend == "" {
+			d.backend = b.name
+		}
+		if decided {
+			return d, nil
+		}
+		last = d
+	}
+	return last, skipped
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestParseBackends(t *testing.T) {
+	t.Parallel()
+	chain, err := parseBackends(" redis:off, PG:required ,grpc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := formatBackends(chain); got != "redis:off,postgres:required,grpc" {
+		t.Errorf("parseBackends = %q", got)
+	}
+	for _, bad := range []string{"", "redis:off", "postgres,pg", "sqlite", "grpc:maybe"} {
+		if _, err := parseBackends(bad); err == nil {
+			t.Errorf("parseBackends(%q) should fail", bad)
+		}
+	}
+}
+
+func TestActiveBackends(t *testing.T) {
+	oldChain, oldDriver := backendChain, dbDriver
+	t.Cleanup(func() { backendChain, dbDriver = oldChain, oldDriver })
+
+	backendChain, dbDriver = nil, driverMySQL
+	if got := activeBackends(); len(got) != 1 || got[0].name != driverMySQL || !got[0].required {
+		t.Errorf("without backends the chain should be db_driver alone, got %+v", got)
+	}
+	backendChain, _ = parseBackends("redis:off,postgres,grpc")
+	if usesBackend(driverRedis) || !usesBackend(driverGRPC) || backendNames() != "backends=postgres,grpc" {
+		t.Errorf("disabled backends should be skipped, got %s", backendNames())
+	}
+}
+
+// chainStep 模拟每个后端的结论。
+type chainStep struct {
+	allow, decided bool
+	err            error
+}
+
+func TestRunChain(t *testing.T) {
+	t.Parallel()
+	down := errors.New("connection refused")
+	a := backend{name: driverRedis, enabled: true}
+	b := backend{name: driverPostgres, enabled: true}
+	cases := []struct {
+		name      string
+		chain     []backend
+		steps     map[string]chainStep
+		allow     bool
+		wantErr   string
+		wantCalls int
+	}{
+		{"first allow wins", []backend{a, b},
+			map[string]chainStep{driverRedis: {allow: true, decided: true}}, true, "", 1},
+		{"first deny wins", []backend{a, b},
+			map[string]chainStep{driverRedis: {decided: true}, driverPostgres: {allow: true, decided: true}}, false, "", 1},
+		{"unknown passes on", []backend{a, b},
+			map[string]chainStep{driverPostgres: {allow: true, decided: true}}, true, "", 2},
+		{"nobody decides", []backend{a, b}, nil, false, "", 2},
+		{"optional error skipped", []backend{a, b},
+			map[string]chainStep{driverRedis: {err: down}, driverPostgres: {allow: true, decided: true}}, true, "", 2},
+		{"optional error without decision", []backend{a, b},
+			map[string]chainStep{driverRedis: {err: down}}, false, "backend redis: connection refused", 2},
+		{"required error stops", []backend{{name: driverRedis, enabled: true, required: true}, b},
+			map[string]chainStep{driverRedis: {err: down}, driverPostgres: {allow: true, decided: true}}, false, "backend redis", 1},
+		{"single backend error is not prefixed", []backend{a},
+			map[string]chainStep{driverRedis: {err: down}}, false, "connection refused", 1},
+	}
+	for _, c := range cases {
+		calls := 0
+		d, err := runChain(c.chain, func(b backend) (decision, bool, error) {
+			calls++
+			s := c.steps[b.name]
+			return decision{allow: s.allow}, s.decided, s.err
+		})
+		if allow := d.allow; allow != c.allow || calls != c.wantCalls {
+			t.Errorf("%s: allow=%t after %d calls, want %t after %d", c.name, allow, calls, c.allow, c.wantCalls)
+		}
+		switch {
+		case c.wantErr == "" && err != nil:
+			t.Errorf("%s: unexpected error %v", c.name, err)
+		case c.wantErr != "" && (err == nil || !strings.HasPrefix(err.Error(), c.wantErr)):
+			t.Errorf("%s: error %v, want %q", c.name, err, c.wantErr)
+		case c.wantErr != "" && !errors.Is(err, down):
+			t.Errorf("%s: error %v should wrap the backend error", c.name, err)
+		}
+	}
+}
+
+func TestValidateBackendOptions(t *testing.T) {
+	oldChain, oldDriver, oldTTL := backendChain, dbDriver, redisCacheTTL.get()
+	t.Cleanup(func() {
+		backendChain, dbDriver = oldChain, oldDriver
+		redisCacheTTL.set(oldTTL)
+	})
+
+	backendChain, _ = parseBackends("redis,grpc")
+	problems := strings.Join(validateOptions(primary, map[string]bool{
+		"backends": true, "db_driver": true, "self_test": true, "grpc_addr": true, "enforce_bind": true,
+	}), "; ")
+	for _, want := range []string{"db_driver has no effect when backends is set", "self_test is PostgreSQL-only and has no effect with backends=redis,grpc"} {
+		if !strings.Contains(problems, want) {
+			t.Errorf("validateOptions = %q, want %q", problems, want)
+		}
+	}
+	if strings.Contains(problems, "enforce_bind") {
+		t.Errorf("enforce_bind still applies to the redis backend: %q", problems)
+	}
+	backendChain, _ = parseBackends("postgres,grpc")
+	if problems := validateOptions(primary, map[string]bool{"backends": true, "pg_dsn": true, "grpc_addr": true}); len(problems) != 0 {
+		t.Errorf("validateOptions = %v, want none", problems)
+	}
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// 零接触开通：出厂时所有设备烧录同一个引导账号（bootstrap_users，iot_devices 中的普通账号），
+// 设备首次上线时用它连接，向 bootstrap_topic 发布一条注册消息：
+//
+//	{"device_id": "sensor-42", "model": "th-100", "firmware": "1.4.2"}
+//
+// 插件校验 device_id，新建启用的设备行并生成随机密码（bcrypt 存储），再把凭据只发给这个客户端：
+//
+//	<bootstrap_response_prefix>/<client id>  {"username": "sensor-42", "password": "..."}
+//
+// 失败时响应 {"error": "..."}。设备随后断开，用新凭据重连。
+//
+//   - 引导账号只能发布 bootstrap_topic、订阅/接收自己的响应主题，acls 表中的规则对它们不生效；
+//   - 每个连接只能注册一次（无论成败），再次注册需要重连；
+//   - 已存在的 device_id 不会被覆盖，避免拿到引导凭据的人接管现有设备；
+//   - 新设备没有 client_bindings 与 ACL 规则，需要开通流程补上（或依赖 '*' 规则与 {username} 模式）；
+//   - 只支持 PostgreSQL 后端。
+
+var (
+	bootstrapTopic          string
+	bootstrapUsers          string
+	bootstrapResponsePrefix = "bootstrap/response"
+
+	bootstrapDone       = &bootstrapRegistry{used: map[uintptr]bool{}}
+	bootstrapRegistered atomic.Int64 // 通过引导注册新建的设备数
+)
+
+const (
+	bootstrapMaxPayload = 4096
+	insertBootstrapped  = `INSERT INTO iot_devices (username, password_hash, salt, enabled) VALUES ($1, $2, '', 1)
+ON CONFLICT (username) DO NOTHING`
+)
+
+// deviceIDPattern 限制 device_id 的字符，使它可以直接用作用户名与 {username} 主题层级。
+var deviceIDPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,63}$`)
+
+// bootstrapRegistry 记录已经注册过的连接，键与 connIDs 相同。
+type bootstrapRegistry struct {
+	mu   sync.Mutex
+	used map[uintptr]bool
+}
+
+// claim 在连接第一次注册时返回 true。
+func (r *bootstrapRegistry) claim(key uintptr) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.used[key] {
+		return false
+	}
+	r.used[key] = true
+	return true
+}
+
+func (r *bootstrapRegistry) release(key uintptr) {
+	r.mu.Lock()
+	delete(r.used, key)
+	r.mu.Unlock()
+}
+
+func isBootstrapUser(username string) bool {
+	if bootstrapTopic == "" || username == "" {
+		return false
+	}
+	for _, u := range strings.Split(bootstrapUsers, ",") {
+		if strings.TrimSpace(u) == username {
+			return true
+		}
+	}
+	return false
+}
+
+// checkBootstrap 检查引导选项的组合，返回问题描述（没有问题时为空）。
+func checkBootstrap(topic, users, prefix string) string {
+	switch {
+	case strings.ContainsAny(topic, "+#") || strings.HasPrefix(topic, "$"):
+		return fmt.Sprintf("bootstrap_topic %q must be a plain topic without wildcards or $", topic)
+	case strings.Trim(users, ", ") == "":
+		return "bootstrap_topic needs bootstrap_users"
+	case strings.Trim(prefix, "/") == "" || strings.ContainsAny(prefix, "+#"):
+		return fmt.Sprintf("bootstrap_response_prefix %q must be a non-empty topic without wildcards", prefix)
+	case strings.HasPrefix(topic, strings.TrimSuffix(prefix, "/")+"/"):
+		return "bootstrap_topic must not be under bootstrap_response_prefix"
+	}
+	return ""
+}
+
+func bootstrapResponseTopic(clientID string) string {
+	return strings.TrimSuffix(bootstrapResponsePrefix, "/") + "/" + clientID
+}
+
+// bootstrapRequest 是注册消息；model、firmware 只用于日志。
+type bootstrapRequest struct {
+	DeviceID string `json:"device_id"`
+	Model    string `json:"model"`
+	Firmware string `json:"firmware"`
+}
+
+type bootstrapResponse struct {
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// parseBootstrapRequest 校验注册消息。
+func parseBootstrapRequest(payload []byte) (bootstrapRequest, error) {
+	var req bootstrapRequest
+	if len(payload) > bootstrapMaxPayload {
+		return req, fmt.Errorf("registration larger than %d bytes", bootstrapMaxPayload)
+	}
+	if err := json.Unmarshal(payload, &req); err != nil {
+		return req, errors.New("invalid JSON: " + err.Error())
+	}
+	if !deviceIDPattern.MatchString(req.DeviceID) {
+		return req, errors.New("device_id must be 1-64 characters of A-Z a-z 0-9 . _ - and start with a letter or digit")
+	}
+	if isBootstrapUser(req.DeviceID) {
+		return req, errors.New("device_id is a bootstrap account")
+	}
+	return req, nil
+}
+
+func newDevicePassword() (string, error) {
+	b := make([]byte, 18)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// bootstrapACL 代替 acls 表判定引导账号的访问；发布到 bootstrap_topic 时执行注册。
+// key 是连接的 clientKey，每个连接只能注册一次。
+func bootstrapACL(ctx context.Context, key uintptr, clientID, topic string, access int, payload []byte, pol requestPolicy) (bool, error) {
+	switch access {
+	case aclUnsubscribe:
+		return true, nil
+	case aclRead, aclSubscribe:
+		return topic == bootstrapResponseTopic(clientID), nil
+	case aclWrite:
+		if topic != bootstrapTopic {
+			return false, nil
+		}
+	default:
+		return false, nil
+	}
+	if !bootstrapDone.claim(key) {
+		mosqLog(logNotice, "auth-plugin: bootstrap client %s already registered on this connection", redactID(clientID))
+		return false, nil
+	}
+	resp, err := bootstrapRegister(ctx, clientID, payload, pol)
+	if err != nil {
+		// 数据库错误不消耗本连接的注册机会
+		bootstrapDone.release(key)
+		return false, err
+	}
+	raw, _ := json.Marshal(resp)
+	publishToClient(clientID, bootstrapResponseTopic(clientID), raw)
+	return true, nil
+}
+
+func bootstrapRegister(parent context.Context, clientID string, payload []byte, pol requestPolicy) (bootstrapResponse, error) {
+	req, err := parseBootstrapRequest(payload)
+	if err != nil {
+		mosqLog(logNotice, "auth-plugin: bootstrap registration from client %s refused: %v", redactID(clientID), err)
+		return bootstrapResponse{Error: err.Error()}, nil
+	}
+	password, err := newDevicePassword()
+	if err != nil {
+		return bootstrapResponse{}, err
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), minBcryptCost)
+	if err != nil {
+		return bootstrapResponse{}, err
+	}
+	if databaseDown() {
+		return bootstrapResponse{}, errDatabaseDown
+	}
+	ctx, cancel := ctxWithTimeout(parent, pol.timeout)
+	defer cancel()
+	pg, err := openPGStore(ctx)
+	if err != nil {
+		return bootstrapResponse{}, fmt.Errorf("bootstrap_topic: %w", err)
+	}
+	var created bool
+	err = withRetry(ctx, func() error {
+		tag, err := pg.p.Exec(ctx, insertBootstrapped, req.DeviceID, string(hash))
+		created = err == nil && tag.RowsAffected() > 0
+		return err
+	})
+	if err != nil {
+		return bootstrapResponse{}, err
+	}
+	if !created {
+		mosqLog(logWarning, "auth-plugin: bootstrap client %s tried to register existing device %s",
+			redactID(clientID), redactID(req.DeviceID))
+		return bootstrapResponse{Error: "device_id already registered"}, nil
+	}
+	bootstrapRegistered.Add(1)
+	mosqLog(logNotice, "auth-plugin: bootstrap registered device %s (client %s, model %q, firmware %q)",
+		redactID(req.DeviceID), redactID(clientID), req.Model, req.Firmware)
+	return bootstrapResponse{Username: req.DeviceID, Password: password}, nil
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseBootstrapRequest(t *testing.T) {
+	oldTopic, oldUsers := bootstrapTopic, bootstrapUsers
+	t.Cleanup(func() { bootstrapTopic, bootstrapUsers = oldTopic, oldUsers })
+	bootstrapTopic, bootstrapUsers = "bootstrap/register", "factory, line-2"
+
+	req, err := parseBootstrapRequest([]byte(`{"device_id":"sensor-42","model":"th-100","firmware":"1.4.2","extra":1}`))
+	if err != nil || req.DeviceID != "sensor-42" || req.Model != "th-100" {
+		t.Fatalf("parseBootstrapRequest = %+v, %v", req, err)
+	}
+	for payload, want := range map[string]string{
+		`not json`:                            "invalid JSON",
+		`{}`:                                  "device_id must be",
+		`{"device_id":"a/b"}`:                 "device_id must be",
+		`{"device_id":"-lead"}`:               "device_id must be",
+		`{"device_id":"line-2"}`:              "bootstrap account",
+		strings.Repeat(" ", 4097) + `{"a":1}`: "larger than 4096",
+	} {
+		if _, err := parseBootstrapRequest([]byte(payload)); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("parseBootstrapRequest(%.20q) = %v, want %q", payload, err, want)
+		}
+	}
+}
+
+func TestIsBootstrapUser(t *testing.T) {
+	oldTopic, oldUsers := bootstrapTopic, bootstrapUsers
+	t.Cleanup(func() { bootstrapTopic, bootstrapUsers = oldTopic, oldUsers })
+	bootstrapTopic, bootstrapUsers = "", "factory"
+	if isBootstrapUser("factory") {
+		t.Fatal("bootstrap users need bootstrap_topic")
+	}
+	bootstrapTopic = "bootstrap/register"
+	if !isBootstrapUser("factory") || isBootstrapUser("factory2") || isBootstrapUser("") {
+		t.Fatal("isBootstrapUser should match listed names exactly")
+	}
+}
+
+func TestCheckBootstrap(t *testing.T) {
+	t.Parallel()
+	if p := checkBootstrap("bootstrap/register", "factory", "bootstrap/response"); p != "" {
+		t.Fatalf("valid settings reported %q", p)
+	}
+	for _, tt := range []struct{ topic, users, prefix, want string }{
+		{"bootstrap/+", "factory", "bootstrap/response", "without wildcards"},
+		{"$bootstrap", "factory", "bootstrap/response", "without wildcards or $"},
+		{"bootstrap/register", " , ", "bootstrap/response", "needs bootstrap_users"},
+		{"bootstrap/register", "factory", "/", "non-empty topic"},
+		{"bootstrap/response/x", "factory", "bootstrap/response/", "must not be under"},
+	} {
+		if p := checkBootstrap(tt.topic, tt.users, tt.prefix); !strings.Contains(p, tt.want) || p == "" {
+			t.Errorf("checkBootstrap(%q, %q, %q) = %q, want %q", tt.topic, tt.users, tt.prefix, p, tt.want)
+		}
+	}
+}
+
+func TestBootstrapRegistry(t *testing.T) {
+	t.Parallel()
+	r := &bootstrapRegistry{used: map[uintptr]bool{}}
+	if !r.claim(1) || r.claim(1) || !r.claim(2) {
+		t.Fatal("each connection should register once")
+	}
+	r.release(1)
+	if !r.claim(1) {
+		t.Fatal("release should allow a new registration")
+	}
+	pw, err := newDevicePassword()
+	if err != nil || len(pw) != 24 {
+		t.Fatalf("newDevicePassword = %q, %v", pw, err)
+	}
+}
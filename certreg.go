@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"auth-plugin/pkg/mosqplugin"
+)
+
+// cert_auto_register：客户端出示了 CA 签发的有效证书（broker 已校验，use_identity_as_username /
+// use_subject_as_username 把证书身份作为用户名），但 iot_devices 中没有这个用户名时，
+// 插件在该连接第一次 ACL 检查时建一条停用的设备行，并在 device_registrations 中记下证书与连接信息，
+// 等待开通流程审批（useradm pending 查看，useradm enable 放行），而不是只在日志里留下一次拒绝。
+//
+//   - 开启后证书连接必须对应一条启用的设备行，否则该连接的所有发布/订阅被拒绝；
+//     待审批设备重连时只更新 last_seen 与 attempts；
+//   - 判定按连接缓存，断开时释放，审批后设备重连即可生效；
+//   - 没有证书的连接（用户名密码登录）不受影响；
+//   - 只支持 PostgreSQL 后端，不支持 shard_column。
+
+var (
+	certAutoRegister  bool
+	pendingRegistered atomic.Int64 // 新登记的待审批设备数
+)
+
+const (
+	// 只有本次新建了设备行时才写入登记信息，管理员手动停用的设备不会变成“待审批”。
+	insertPendingDevice = `WITH dev AS (
+  INSERT INTO iot_devices (username, password_hash, salt, enabled) VALUES ($1, '', '', 0)
+  ON CONFLICT (username) DO NOTHING RETURNING username
+)
+INSERT INTO device_registrations (username, cert_subject, cert_issuer, cert_serial, cert_sha256, cert_not_after,
+  client_id, address, protocol_version)
+SELECT username, $2, $3, $4, $5, $6, $7, $8, $9 FROM dev`
+	touchPendingDevice = `UPDATE device_registrations SET last_seen = now(), attempts = attempts + 1, client_id = $2, address = $3
+WHERE username = $1`
+)
+
+// pendingDevice 是一次待审批登记的内容。
+type pendingDevice struct {
+	username        string
+	subject         string
+	issuer          string
+	serial          string
+	sha256          string
+	notAfter        time.Time
+	clientID        string
+	address         string
+	protocolVersion int
+}
+
+// certIdentity 从 DER 编码的客户端证书中取出登记需要的字段。
+func certIdentity(der []byte) (pendingDevice, error) {
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return pendingDevice{}, err
+	}
+	sum := sha256.Sum256(der)
+	return pendingDevice{
+		subject:  cert.Subject.String(),
+		issuer:   cert.Issuer.String(),
+		serial:   cert.SerialNumber.Text(16),
+		sha256:   hex.EncodeToString(sum[:]),
+		notAfter: cert.NotAfter,
+	}, nil
+}
+
+// certGate 记录每个证书连接的判定结果，键与 connIDs 相同。
+type certGate struct {
+	mu      sync.Mutex
+	allowed map[uintptr]bool
+}
+
+var certGates = &certGate{allowed: map[uintptr]bool{}}
+
+func (g *certGate) get(key uintptr) (allowed, ok bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	allowed, ok = g.allowed[key]
+	return allowed, ok
+}
+
+func (g *certGate) set(key uintptr, allowed bool) {
+	g.mu.Lock()
+	g.allowed[key] = allowed
+	g.mu.Unlock()
+}
+
+func (g *certGate) forget(key uintptr) {
+	g.mu.Lock()
+	delete(g.allowed, key)
+	g.mu.Unlock()
+}
+
+// certIdentityAllowed 判断证书连接能否继续做 ACL 检查；未知身份登记为待审批设备。
+// 数据库错误不缓存，下一次 ACL 检查会重试。
+func certIdentityAllowed(parent context.Context, client mosqplugin.Client, username, clientID string, pol requestPolicy) (bool, error) {
+	key := client.Key()
+	if allowed, ok := certGates.get(key); ok {
+		return allowed, nil
+	}
+	der := client.Certificate()
+	if der == nil || username == "" {
+		certGates.set(key, true)
+		return true, nil
+	}
+	if databaseDown() {
+		return false, errDatabaseDown
+	}
+	ctx, cancel := ctxWithTimeout(parent, pol.timeout)
+	defer cancel()
+	pg, err := openPGStore(ctx)
+	if err != nil {
+		return false, fmt.Errorf("cert_auto_register: %w", err)
+	}
+	d, found, err := pg.user(ctx, username)
+	if err != nil {
+		return false, err
+	}
+	if found {
+		if !d.enabled {
+			if _, err := pg.p.Exec(ctx, touchPendingDevice, username, clientID, clientAddress(client)); err != nil {
+				return false, err
+			}
+		}
+		certGates.set(key, d.enabled)
+		return d.enabled, nil
+	}
+
+	pd, err := certIdentity(der)
+	if err != nil {
+		return false, err
+	}
+	pd.username, pd.clientID = username, clientID
+	pd.address = clientAddress(client)
+	pd.protocolVersion = client.ProtocolVersion()
+	created, err := registerPending(ctx, pg, pd)
+	if err != nil {
+		return false, err
+	}
+	if created {
+		pendingRegistered.Add(1)
+		mosqLog(logNotice, "auth-plugin: registered %s as a pending device (client %s, cert %s, sha256 %s)",
+			redactID(username), redactID(clientID), pd.subject, pd.sha256[:16])
+	}
+	certGates.set(key, false)
+	return false, nil
+}
+
+// registerPending 写入待审批设备；设备行已存在（并发登记）时 created 为 false。
+func registerPending(ctx context.Context, pg pgStore, pd pendingDevice) (created bool, err error) {
+	err = withRetry(ctx, func() error {
+		tag, err := pg.p.Exec(ctx, insertPendingDevice, pd.username, pd.subject, pd.issuer, pd.serial, pd.sha256,
+			pd.notAfter, pd.clientID, pd.address, pd.protocolVersion)
+		created = err == nil && tag.RowsAffected() > 0
+		return err
+	})
+	return created, err
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"testing"
+	"time"
+)
+
+func TestCertIdentity(t *testing.T) {
+	t.Parallel()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	notAfter := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(0xbeef),
+		Subject:      pkix.Name{CommonName: "sensor-42", Organization: []string{"Acme"}},
+		NotBefore:    notAfter.AddDate(-1, 0, 0),
+		NotAfter:     notAfter,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pd, err := certIdentity(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pd.subject != "CN=sensor-42,O=Acme" || pd.serial != "beef" || !pd.notAfter.Equal(notAfter) || len(pd.sha256) != 64 {
+		t.Fatalf("certIdentity = %+v", pd)
+	}
+	if _, err := certIdentity([]byte("not a certificate")); err == nil {
+		t.Fatal("garbage should not parse")
+	}
+}
+
+func TestCertGate(t *testing.T) {
+	t.Parallel()
+	g := &certGate{allowed: map[uintptr]bool{}}
+	if _, ok := g.get(1); ok {
+		t.Fatal("unknown connection should not be cached")
+	}
+	g.set(1, false)
+	if allowed, ok := g.get(1); !ok || allowed {
+		t.Fatal("pending connection should stay denied")
+	}
+	g.forget(1)
+	if _, ok := g.get(1); ok {
+		t.Fatal("forget should drop the decision")
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+
+	"cloud.google.com/go/cloudsqlconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Cloud SQL：按实例连接名（project:region:instance）经由 cloudsqlconn 拨号，
+// 由它申请并刷新临时客户端证书、校验服务端证书（含 CAS 签发的证书）。
+// 凭据取自 Application Default Credentials：GOOGLE_APPLICATION_CREDENTIALS 指向的密钥文件、
+// gcloud 登录或 GCE/GKE/Cloud Run 的 metadata server。开启 IAM 认证时令牌随证书下发，DSN 不需要密码。
+
+var (
+	cloudSQLInstance string // project:region:instance
+	cloudSQLIAMAuth  bool
+	cloudSQLIPType   = "public"
+
+	cloudSQLMu     sync.Mutex
+	cloudSQLDialer *cloudsqlconn.Dialer
+
+	// newCloudSQLDialer 建立拨号器，测试中替换
+	newCloudSQLDialer = cloudsqlconn.NewDialer
+)
+
+// parseCloudSQLInstance 拆分实例连接名；project 可能带域名前缀（example.com:project）。
+func parseCloudSQLInstance(name string) (project, region, instance string, err error) {
+	parts := strings.Split(strings.TrimSpace(name), ":")
+	if len(parts) < 3 {
+		return "", "", "", fmt.Errorf("invalid cloudsql_instance %q, want project:region:instance", name)
+	}
+	n := len(parts)
+	project = strings.Join(parts[:n-2], ":")
+	region, instance = parts[n-2], parts[n-1]
+	if project == "" || region == "" || instance == "" {
+		return "", "", "", fmt.Errorf("invalid cloudsql_instance %q, want project:region:instance", name)
+	}
+	return project, region, instance, nil
+}
+
+func parseCloudSQLIPType(v string) (string, bool) {
+	switch s := strings.ToLower(strings.TrimSpace(v)); s {
+	case "public", "private":
+		return s, true
+	default:
+		return "", false
+	}
+}
+
+// cloudSQLOptions 把 cloudsql_* 选项转换为拨号器选项。
+func cloudSQLOptions() []cloudsqlconn.Option {
+	ip := cloudsqlconn.WithPublicIP()
+	if cloudSQLIPType == "private" {
+		ip = cloudsqlconn.WithPrivateIP()
+	}
+	opts := []cloudsqlconn.Option{cloudsqlconn.WithDefaultDialOptions(ip), cloudsqlconn.WithUserAgent("mosq-pg-auth")}
+	if cloudSQLIAMAuth {
+		opts = append(opts, cloudsqlconn.WithIAMAuthN())
+	}
+	return opts
+}
+
+// currentCloudSQLDialer 复用同一个拨号器：它缓存实例元数据与证书，并在后台提前刷新。
+func currentCloudSQLDialer() (*cloudsqlconn.Dialer, error) {
+	cloudSQLMu.Lock()
+	defer cloudSQLMu.Unlock()
+	if cloudSQLDialer != nil {
+		return cloudSQLDialer, nil
+	}
+	d, err := newCloudSQLDialer(context.Background(), cloudSQLOptions()...)
+	if err != nil {
+		return nil, fmt.Errorf("cloudsql: %w", err)
+	}
+	cloudSQLDialer = d
+	return d, nil
+}
+
+// configureCloudSQL 把连接池切换为经由 Cloud SQL 拨号器建连，DSN 中的主机与端口被忽略。
+func configureCloudSQL(cfg *pgxpool.Config) error {
+	d, err := currentCloudSQLDialer()
+	if err != nil {
+		return err
+	}
+	name := strings.TrimSpace(cloudSQLInstance)
+	cc := cfg.ConnConfig
+	// TLS 由拨号器完成，连接建立后不再走 PG 的 SSLRequest 协商
+	cc.TLSConfig = nil
+	cc.Fallbacks = nil
+	cc.LookupFunc = func(ctx context.Context, host string) ([]string, error) {
+		return []string{host}, nil
+	}
+	cc.DialFunc = func(ctx context.Context, _, _ string) (net.Conn, error) {
+		return d.Dial(ctx, name)
+	}
+	return nil
+}
+
+// closeCloudSQL 停止拨号器的后台刷新，在连接池关闭之后调用。
+func closeCloudSQL() {
+	cloudSQLMu.Lock()
+	defer cloudSQLMu.Unlock()
+	if cloudSQLDialer != nil {
+		cloudSQLDialer.Close()
+		cloudSQLDialer = nil
+	}
+}
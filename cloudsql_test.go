@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"cloud.google.com/go/cloudsqlconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"golang.org/x/oauth2"
+)
+
+func TestParseCloudSQLInstance(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		input                     string
+		project, region, instance string
+		wantErr                   bool
+	}{
+		{"proj:us-central1:db", "proj", "us-central1", "db", false},
+		{"example.com:proj:europe-west1:db", "example.com:proj", "europe-west1", "db", false},
+		{" proj:asia-east1:db ", "proj", "asia-east1", "db", false},
+		{"proj:db", "", "", "", true},
+		{"proj::db", "", "", "", true},
+		{"", "", "", "", true},
+	}
+
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.input, func(t *testing.T) {
+			t.Parallel()
+			project, region, instance, err := parseCloudSQLInstance(tc.input)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("parseCloudSQLInstance(%q) err = %v, wantErr %v", tc.input, err, tc.wantErr)
+			}
+			if project != tc.project || region != tc.region || instance != tc.instance {
+				t.Fatalf("parseCloudSQLInstance(%q) = (%q, %q, %q), want (%q, %q, %q)",
+					tc.input, project, region, instance, tc.project, tc.region, tc.instance)
+			}
+		})
+	}
+}
+
+func TestParseCloudSQLIPType(t *testing.T) {
+	t.Parallel()
+	if got, ok := parseCloudSQLIPType(" PRIVATE "); !ok || got != "private" {
+		t.Fatalf("parseCloudSQLIPType(PRIVATE) = (%q, %v)", got, ok)
+	}
+	if _, ok := parseCloudSQLIPType("psc"); ok {
+		t.Fatal("parseCloudSQLIPType should reject unknown ip types")
+	}
+}
+
+func TestConfigureCloudSQL(t *testing.T) {
+	oldInstance, oldNew := cloudSQLInstance, newCloudSQLDialer
+	t.Cleanup(func() {
+		closeCloudSQL()
+		cloudSQLInstance, newCloudSQLDialer = oldInstance, oldNew
+	})
+	cloudSQLInstance = "proj:region:db"
+	calls := 0
+	newCloudSQLDialer = func(ctx context.Context, opts ...cloudsqlconn.Option) (*cloudsqlconn.Dialer, error) {
+		calls++
+		// 静态令牌让拨号器无需 ADC 即可创建；测试不真正拨号
+		opts = append(opts, cloudsqlconn.WithTokenSource(oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "t"})))
+		return cloudsqlconn.NewDialer(ctx, opts...)
+	}
+
+	cfg, err := pgxpool.ParseConfig("postgres://mqtt@ignored:5432/iot?sslmode=require")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := configureCloudSQL(cfg); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.ConnConfig.TLSConfig != nil || cfg.ConnConfig.DialFunc == nil || len(cfg.ConnConfig.Fallbacks) != 0 {
+		t.Fatal("Cloud SQL connections must go through the connector without PG-level TLS")
+	}
+	if err := configureCloudSQL(cfg); err != nil || calls != 1 {
+		t.Fatalf("the dialer must be reused across pools, created %d times (%v)", calls, err)
+	}
+}
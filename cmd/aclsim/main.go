@@ -0,0 +1,79 @@
+// aclsim 离线模拟插件的 ACL 判定：给定 username/clientid/topic/access，
+// 从 PostgreSQL 或 acls 的 CSV 导出读取规则，输出判定结果和命中的规则。
+// 匹配逻辑与插件共用 internal/aclrule；只读，不会修改数据库。
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// 与插件的 aclQuery 相同的过滤条件
+const rulesQuery = "SELECT username, pattern, acc FROM acls WHERE username = $1 OR username = '*'"
+
+func main() {
+	var req request
+	dsn := flag.String("dsn", os.Getenv("PG_DSN"), "PostgreSQL DSN to read acls from (default $PG_DSN)")
+	dump := flag.String("rules", "", "read rules from this CSV dump (username,pattern,acc) instead of the database")
+	flag.StringVar(&req.username, "username", "", "client username")
+	flag.StringVar(&req.clientID, "clientid", "", "client id")
+	flag.StringVar(&req.ip, "ip", "", "client address (informational)")
+	flag.StringVar(&req.topic, "topic", "", "topic or subscription filter")
+	access := flag.String("access", "read", "read, write, subscribe or unsubscribe")
+	verbose := flag.Bool("v", false, "also list rules that did not match and why")
+	flag.Parse()
+
+	var err error
+	if req.access, err = parseAccess(*access); err != nil {
+		fmt.Fprintln(os.Stderr, "aclsim:", err)
+		os.Exit(2)
+	}
+	if req.topic == "" || (*dsn == "" && *dump == "") {
+		fmt.Fprintln(os.Stderr, "aclsim: -topic and one of -rules or -dsn (PG_DSN) are required")
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	rules, err := loadRules(*dump, *dsn, req.username)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "aclsim:", err)
+		os.Exit(2)
+	}
+	res := simulate(rules, req)
+	writeResult(os.Stdout, req, res, *verbose)
+	// 退出码便于脚本使用：0 放行，1 拒绝，2 参数或读取错误
+	if !res.allow {
+		os.Exit(1)
+	}
+}
+
+func loadRules(dump, dsn, username string) ([]userRule, error) {
+	if dump != "" {
+		f, err := os.Open(dump)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		return readDump(f)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	conn, err := pgx.Connect(ctx, dsn)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close(context.Background())
+	rows, err := conn.Query(ctx, rulesQuery, username)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, func(r pgx.CollectableRow) (userRule, error) {
+		var u userRule
+		return u, r.Scan(&u.username, &u.Pattern, &u.Acc)
+	})
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"auth-plugin/internal/aclrule"
+	"auth-plugin/pkg/topicmatch"
+)
+
+type userRule struct {
+	username string
+	aclrule.Rule
+}
+
+type request struct {
+	username, clientID, ip, topic string
+	access                        int
+}
+
+// ruleTrace 记录一条候选规则的判定过程，-v 时全部输出。
+type ruleTrace struct {
+	rule     userRule
+	expanded string // 占位符替换后的 pattern
+	matched  bool
+	reason   string // 未命中的原因
+}
+
+type result struct {
+	allow   bool
+	reason  string // 不经过规则的判定（如取消订阅）
+	matched []ruleTrace
+	trace   []ruleTrace
+}
+
+var accessNames = map[string]int{
+	"read":        aclrule.Read,
+	"write":       aclrule.Write,
+	"subscribe":   aclrule.Subscribe,
+	"unsubscribe": aclrule.Unsubscribe,
+}
+
+func parseAccess(s string) (int, error) {
+	if n, ok := accessNames[strings.ToLower(s)]; ok {
+		return n, nil
+	}
+	if n, err := strconv.Atoi(s); err == nil {
+		for _, v := range accessNames {
+			if n == v {
+				return n, nil
+			}
+		}
+	}
+	return 0, fmt.Errorf("unknown access %q (want read, write, subscribe or unsubscribe)", s)
+}
+
+func accessName(access int) string {
+	for k, v := range accessNames {
+		if v == access {
+			return k
+		}
+	}
+	return strconv.Itoa(access)
+}
+
+func accString(acc int) string {
+	return aclrule.FormatAcc(acc)
+}
+
+// applicable 与插件的 aclQuery 一致：该用户的规则加上 '*' 全局规则，用户规则在前。
+func applicable(rules []userRule, username string) []userRule {
+	var out []userRule
+	for _, r := range rules {
+		if r.username == username || r.username == "*" {
+			out = append(out, r)
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		return out[i].username != "*" && out[j].username == "*"
+	})
+	return out
+}
+
+// simulate 按插件 dbACL 的逻辑判定，并记录每条规则命中或未命中的原因。
+// 插件只要有一条规则命中即放行，规则顺序不影响结果。
+func simulate(rules []userRule, req request) result {
+	if req.access == aclrule.Unsubscribe {
+		return result{allow: true, reason: "unsubscribe is always allowed"}
+	}
+	var res result
+	for _, r := range applicable(rules, req.username) {
+		t := ruleTrace{rule: r}
+		switch expanded, ok := aclrule.Expand(r.Pattern, req.username, req.clientID); {
+		case r.Acc&req.access == 0:
+			t.reason = "does not grant " + accessName(req.access)
+		case !ok:
+			t.reason = "placeholder cannot expand (empty value or one containing + # /)"
+		default:
+			t.expanded = expanded
+			if t.matched = topicmatch.Match(expanded, req.topic); !t.matched {
+				t.reason = "topic does not match " + expanded
+			}
+		}
+		if t.matched {
+			res.allow = true
+			res.matched = append(res.matched, t)
+		}
+		res.trace = append(res.trace, t)
+	}
+	return res
+}
+
+func writeResult(w io.Writer, req request, res result, verbose bool) {
+	decision := "deny"
+	if res.allow {
+		decision = "allow"
+	}
+	fmt.Fprintf(w, "decision: %s\n", decision)
+	if req.ip != "" {
+		fmt.Fprintf(w, "ip:       %s (acls rules have no address condition; not used)\n", req.ip)
+	}
+	switch {
+	case res.reason != "":
+		fmt.Fprintf(w, "reason:   %s\n", res.reason)
+	case len(res.matched) == 0:
+		fmt.Fprintf(w, "reason:   no rule for %q or '*' grants %s on %s\n", req.username, accessName(req.access), req.topic)
+	}
+	for _, t := range res.matched {
+		fmt.Fprintf(w, "matched:  %s\n", describe(t))
+	}
+	if verbose {
+		for _, t := range res.trace {
+			if !t.matched {
+				fmt.Fprintf(w, "skipped:  %s: %s\n", describe(t), t.reason)
+			}
+		}
+	}
+}
+
+func describe(t ruleTrace) string {
+	s := fmt.Sprintf("[%s] %s (%s)", t.rule.username, t.rule.Pattern, accString(t.rule.Acc))
+	if t.expanded != "" && t.expanded != t.rule.Pattern {
+		s += " -> " + t.expanded
+	}
+	return s
+}
+
+// readDump 读取 acls 表的 CSV 导出（username,pattern,acc），例如
+// psql -c "\copy acls (username, pattern, acc) TO 'acls.csv' CSV HEADER"。
+func readDump(r io.Reader) ([]userRule, error) {
+	cr := csv.NewReader(r)
+	cr.Comment = '#'
+	cr.FieldsPerRecord = 3
+	var rules []userRule
+	for first := true; ; first = false {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			return rules, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if first && strings.EqualFold(rec[0], "username") {
+			continue
+		}
+		acc, err := strconv.Atoi(strings.TrimSpace(rec[2]))
+		if err != nil {
+			line, _ := cr.FieldPos(2)
+			return nil, fmt.Errorf("line %d: acc %q is not a number", line, rec[2])
+		}
+		rules = append(rules, userRule{rec[0], aclrule.Rule{Pattern: rec[1], Acc: acc}})
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"auth-plugin/internal/aclrule"
+)
+
+const dump = `username,pattern,acc
+# comment
+alice,devices/{clientid}/#,5
+alice,devices/{username}/up,2
+*,broadcast/#,4
+bob,devices/bob/#,7
+`
+
+func TestSimulate(t *testing.T) {
+	t.Parallel()
+	rules, err := readDump(strings.NewReader(dump))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rules) != 4 {
+		t.Fatalf("readDump = %d rules", len(rules))
+	}
+	tests := []struct {
+		req     request
+		allow   bool
+		matched string
+	}{
+		{request{username: "alice", clientID: "c1", topic: "devices/c1/state", access: aclrule.Read}, true, "devices/{clientid}/#"},
+		{request{username: "alice", clientID: "c1", topic: "devices/alice/up", access: aclrule.Write}, true, "devices/{username}/up"},
+		{request{username: "alice", clientID: "c1", topic: "broadcast/news", access: aclrule.Subscribe}, true, "broadcast/#"},
+		{request{username: "alice", clientID: "c1", topic: "devices/bob/up", access: aclrule.Write}, false, ""},
+		{request{username: "alice", clientID: "#", topic: "devices/x/state", access: aclrule.Read}, false, ""},
+		{request{username: "alice", topic: "anything", access: aclrule.Unsubscribe}, true, ""},
+	}
+	for _, tt := range tests {
+		res := simulate(rules, tt.req)
+		if res.allow != tt.allow {
+			t.Errorf("%+v: allow = %v, want %v", tt.req, res.allow, tt.allow)
+		}
+		if tt.matched != "" && (len(res.matched) == 0 || res.matched[0].rule.Pattern != tt.matched) {
+			t.Errorf("%+v: matched %+v, want %s", tt.req, res.matched, tt.matched)
+		}
+	}
+}
+
+func TestWriteResult(t *testing.T) {
+	t.Parallel()
+	rules, _ := readDump(strings.NewReader(dump))
+	req := request{username: "alice", clientID: "c1", ip: "10.0.0.1", topic: "devices/c1/up", access: aclrule.Write}
+	var buf bytes.Buffer
+	writeResult(&buf, req, simulate(rules, req), true)
+	out := buf.String()
+	for _, want := range []string{
+		"decision: deny",
+		"ip:       10.0.0.1",
+		`no rule for "alice" or '*' grants write on devices/c1/up`,
+		"skipped:  [alice] devices/{clientid}/# (read|subscribe): does not grant write",
+		"skipped:  [alice] devices/{username}/up (write) -> devices/alice/up: topic does not match devices/alice/up",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestReadDumpErrors(t *testing.T) {
+	t.Parallel()
+	for _, in := range []string{"alice,a/b\n", "alice,a/b,x\n"} {
+		if _, err := readDump(strings.NewReader(in)); err == nil {
+			t.Errorf("readDump(%q) should fail", in)
+		}
+	}
+	if _, err := parseAccess("publish"); err == nil {
+		t.Error("parseAccess(publish) should fail")
+	}
+}
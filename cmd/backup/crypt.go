@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// 加密格式：magic(5) | log2(N)(1) | salt(16) | nonce(12) | AES-256-GCM 密文。
+// 密钥由口令经 scrypt(N, r=8, p=1) 派生；头部作为附加数据参与认证，改动任何一字节都无法解密。
+const (
+	cryptMagic = "MQBK1"
+	scryptLogN = 15
+	saltSize   = 16
+	headerSize = len(cryptMagic) + 1 + saltSize + 12
+)
+
+var errDecrypt = errors.New("cannot decrypt: wrong passphrase or corrupted snapshot")
+
+func deriveKey(passphrase string, salt []byte, logN byte) ([]byte, error) {
+	return scrypt.Key([]byte(passphrase), salt, 1<<logN, 8, 1, 32)
+}
+
+func seal(passphrase string, plain []byte) ([]byte, error) {
+	header := make([]byte, headerSize)
+	copy(header, cryptMagic)
+	header[len(cryptMagic)] = scryptLogN
+	if _, err := rand.Read(header[len(cryptMagic)+1:]); err != nil {
+		return nil, err
+	}
+	salt := header[len(cryptMagic)+1 : len(cryptMagic)+1+saltSize]
+	key, err := deriveKey(passphrase, salt, scryptLogN)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	return gcm.Seal(header, header[headerSize-gcm.NonceSize():], plain, header), nil
+}
+
+func unseal(passphrase string, data []byte) ([]byte, error) {
+	if len(data) < headerSize || !bytes.HasPrefix(data, []byte(cryptMagic)) {
+		return nil, errors.New("not an encrypted backup snapshot")
+	}
+	logN := data[len(cryptMagic)]
+	if logN < 10 || logN > 22 {
+		return nil, errDecrypt
+	}
+	header := data[:headerSize]
+	key, err := deriveKey(passphrase, header[len(cryptMagic)+1:len(cryptMagic)+1+saltSize], logN)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	plain, err := gcm.Open(nil, header[headerSize-gcm.NonceSize():], data[headerSize:], header)
+	if err != nil {
+		return nil, errDecrypt
+	}
+	return plain, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,267 @@
+// backup 把身份相关的表（iot_devices、client_bindings、acls）导出为加密快照，保存到 S3、GCS
+// 或本地目录，并能从快照恢复，用于 PostgreSQL 本身丢失时的灾难恢复。
+//
+// 快照是一致的（只读可重复读事务），按 identity-<UTC 时间>.<格式> 命名，-keep 控制保留份数。
+// 格式为 JSON 或 CSV（tar 包），先 gzip 再用口令加密（scrypt + AES-256-GCM）；口令丢失则无法恢复。
+// 恢复写入的是已执行过 migrate 的空库；目标库已有用户时需要 -replace。
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+type options struct {
+	dsn        string
+	dest       string
+	passphrase string
+	st         store
+	logger     *log.Logger
+}
+
+type command struct {
+	name  string
+	usage string
+	run   func(ctx context.Context, o *options, args []string) error
+}
+
+var commands = []command{
+	{"run", "run [-format json|csv] [-keep N] [-interval D]", cmdRun},
+	{"list", "list", cmdList},
+	{"restore", "restore [-replace] [-dry-run] <name|latest>", cmdRestore},
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: backup -dest DEST [-dsn DSN] <command> [args]")
+	fmt.Fprintln(os.Stderr, "\nDEST is s3://bucket/prefix, gs://bucket/prefix or a local directory.")
+	fmt.Fprintln(os.Stderr, "\ncommands:")
+	for _, c := range commands {
+		fmt.Fprintln(os.Stderr, "  "+c.usage)
+	}
+	fmt.Fprintln(os.Stderr, "\nflags:")
+	flag.PrintDefaults()
+}
+
+// errUsage 表示参数错误，main 打印用法并以 2 退出。
+var errUsage = errors.New("usage")
+
+func main() {
+	o := options{logger: log.New(os.Stderr, "backup: ", log.LstdFlags)}
+	flag.StringVar(&o.dsn, "dsn", os.Getenv("PG_DSN"), "PostgreSQL DSN (default $PG_DSN)")
+	flag.StringVar(&o.dest, "dest", os.Getenv("BACKUP_DEST"), "where snapshots are stored (default $BACKUP_DEST)")
+	passFile := flag.String("passphrase-file", "", "file holding the encryption passphrase (default $BACKUP_PASSPHRASE)")
+	flag.Usage = usage
+	flag.Parse()
+
+	var c command
+	for _, cmd := range commands {
+		if cmd.name == flag.Arg(0) {
+			c = cmd
+		}
+	}
+	if c.run == nil {
+		usage()
+		os.Exit(2)
+	}
+	o.passphrase = os.Getenv("BACKUP_PASSPHRASE")
+	if *passFile != "" {
+		b, err := os.ReadFile(*passFile)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "backup:", err)
+			os.Exit(2)
+		}
+		o.passphrase = strings.TrimRight(string(b), "\r\n")
+	}
+	switch {
+	case c.name != "list" && o.dsn == "":
+		fmt.Fprintln(os.Stderr, "backup: -dsn or PG_DSN is required")
+		os.Exit(2)
+	case c.name != "list" && len(o.passphrase) < 12:
+		fmt.Fprintln(os.Stderr, "backup: a passphrase of at least 12 characters is required (-passphrase-file or BACKUP_PASSPHRASE)")
+		os.Exit(2)
+	}
+	st, err := openStore(o.dest)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "backup:", err)
+		os.Exit(2)
+	}
+	o.st = st
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if err := c.run(ctx, &o, flag.Args()[1:]); err != nil {
+		if errors.Is(err, errUsage) {
+			fmt.Fprintln(os.Stderr, "usage: backup "+c.usage)
+			os.Exit(2)
+		}
+		fmt.Fprintln(os.Stderr, "backup:", err)
+		os.Exit(1)
+	}
+}
+
+func cmdRun(ctx context.Context, o *options, args []string) error {
+	fs := flag.NewFlagSet("run", flag.ContinueOnError)
+	format := fs.String("format", "json", "snapshot format: json or csv")
+	keep := fs.Int("keep", 30, "keep this many snapshots and delete older ones (0 = keep all)")
+	interval := fs.Duration("interval", 0, "take a snapshot every interval (0 = once and exit)")
+	if err := fs.Parse(args); err != nil || fs.NArg() != 0 || formats[*format] == "" || *keep < 0 {
+		return errUsage
+	}
+	if *interval <= 0 {
+		return backupOnce(ctx, o, *format, *keep)
+	}
+
+	// 守护模式：单轮失败只记录，下一轮重试
+	o.logger.Printf("snapshotting to %s every %s", o.st, *interval)
+	tick := time.NewTicker(*interval)
+	defer tick.Stop()
+	for {
+		if err := backupOnce(ctx, o, *format, *keep); err != nil {
+			o.logger.Println(err)
+		}
+		select {
+		case <-ctx.Done():
+			o.logger.Println("stopping")
+			return nil
+		case <-tick.C:
+		}
+	}
+}
+
+func backupOnce(ctx context.Context, o *options, format string, keep int) error {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Minute)
+	defer cancel()
+	conn, err := pgx.Connect(ctx, o.dsn)
+	if err != nil {
+		return err
+	}
+	snap, err := dump(ctx, conn)
+	conn.Close(context.Background())
+	if err != nil {
+		return err
+	}
+	plain, err := encode(snap, format)
+	if err != nil {
+		return err
+	}
+	data, err := seal(o.passphrase, plain)
+	if err != nil {
+		return err
+	}
+	name := objectName(snap.CreatedAt, format)
+	if err := o.st.put(ctx, name, data); err != nil {
+		return fmt.Errorf("upload %s: %w", name, err)
+	}
+	o.logger.Printf("wrote %s (%s, %d bytes)", name, snap, len(data))
+	if keep == 0 {
+		return nil
+	}
+
+	names, err := o.st.list(ctx)
+	if err != nil {
+		return fmt.Errorf("listing for retention: %w", err)
+	}
+	for _, old := range expired(names, keep) {
+		if err := o.st.remove(ctx, old); err != nil {
+			return fmt.Errorf("remove %s: %w", old, err)
+		}
+		o.logger.Printf("removed %s", old)
+	}
+	return nil
+}
+
+// expired 返回超出保留份数的旧快照；names 为升序。不认识的对象不计入也不删除。
+func expired(names []string, keep int) []string {
+	var snaps []string
+	for _, n := range names {
+		if _, ok := nameFormat(n); ok {
+			snaps = append(snaps, n)
+		}
+	}
+	if len(snaps) <= keep {
+		return nil
+	}
+	return snaps[:len(snaps)-keep]
+}
+
+func cmdList(ctx context.Context, o *options, args []string) error {
+	if len(args) != 0 {
+		return errUsage
+	}
+	names, err := o.st.list(ctx)
+	if err != nil {
+		return err
+	}
+	for _, n := range names {
+		if _, ok := nameFormat(n); ok {
+			fmt.Println(n)
+		}
+	}
+	return nil
+}
+
+func cmdRestore(ctx context.Context, o *options, args []string) error {
+	fs := flag.NewFlagSet("restore", flag.ContinueOnError)
+	replace := fs.Bool("replace", false, "delete the existing users, bindings and rules first")
+	dryRun := fs.Bool("dry-run", false, "decrypt and check the snapshot without touching the database")
+	if err := fs.Parse(args); err != nil || fs.NArg() != 1 {
+		return errUsage
+	}
+	name := fs.Arg(0)
+	if name == "latest" {
+		names, err := o.st.list(ctx)
+		if err != nil {
+			return err
+		}
+		name = ""
+		for _, n := range names {
+			if _, ok := nameFormat(n); ok {
+				name = n
+			}
+		}
+		if name == "" {
+			return fmt.Errorf("no snapshots in %s", o.st)
+		}
+	}
+	format, ok := nameFormat(name)
+	if !ok {
+		return fmt.Errorf("%s is not a snapshot name (see backup list)", name)
+	}
+	data, err := o.st.get(ctx, name)
+	if err != nil {
+		return err
+	}
+	plain, err := unseal(o.passphrase, data)
+	if err != nil {
+		return err
+	}
+	snap, err := decode(plain, format)
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	o.logger.Printf("%s: %s taken at %s", name, snap, snap.CreatedAt.Format(time.RFC3339))
+	if *dryRun {
+		return nil
+	}
+
+	conn, err := pgx.Connect(ctx, o.dsn)
+	if err != nil {
+		return err
+	}
+	defer conn.Close(context.Background())
+	if err := restore(ctx, conn, snap, *replace); err != nil {
+		return err
+	}
+	o.logger.Printf("restored %s", name)
+	return nil
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+type s3Config struct {
+	endpoint     string // 默认 https://s3.<region>.amazonaws.com；MinIO 等兼容服务用 AWS_ENDPOINT_URL
+	region       string
+	accessKey    string
+	secretKey    string
+	sessionToken string
+}
+
+// s3Store 用 SigV4 签名的 path-style 请求访问 S3 兼容存储。离线构建环境里没有 AWS SDK，
+// 这里只实现 PUT/GET/DELETE Object 与 ListObjectsV2。
+type s3Store struct {
+	dest   string
+	bucket string
+	prefix string
+	cfg    s3Config
+	client *http.Client
+}
+
+func newS3Store(dest, path string, cfg s3Config) (*s3Store, error) {
+	bucket, prefix, _ := strings.Cut(path, "/")
+	if bucket == "" {
+		return nil, fmt.Errorf("%s: missing bucket", dest)
+	}
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	if cfg.accessKey == "" || cfg.secretKey == "" {
+		return nil, fmt.Errorf("%s: credentials are not set", dest)
+	}
+	if cfg.region == "" {
+		cfg.region = "us-east-1"
+	}
+	if cfg.endpoint == "" {
+		cfg.endpoint = "https://s3." + cfg.region + ".amazonaws.com"
+	}
+	return &s3Store{dest: dest, bucket: bucket, prefix: prefix, cfg: cfg, client: &http.Client{Timeout: 5 * time.Minute}}, nil
+}
+
+func (s *s3Store) String() string { return s.dest }
+
+// do 发送签名请求；key 为空时请求 bucket 本身。非 2xx 响应转为错误。
+func (s *s3Store) do(ctx context.Context, method, key string, query url.Values, body []byte) ([]byte, error) {
+	u, err := url.Parse(s.cfg.endpoint)
+	if err != nil {
+		return nil, err
+	}
+	// SigV4 要求路径按 RFC 3986 编码，与 net/url 的默认编码不同，所以显式设置 RawPath
+	base, p := strings.TrimSuffix(u.Path, "/"), s.bucket+"/"+key
+	u.Path = base + "/" + p
+	u.RawPath = awsEscape(base, true) + "/" + awsEscape(p, true)
+	u.RawQuery = canonicalQuery(query)
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/octet-stream")
+	}
+	signV4(req, s.cfg, body, time.Now())
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		msg := strings.TrimSpace(string(data))
+		if len(msg) > 512 {
+			msg = msg[:512]
+		}
+		return nil, fmt.Errorf("%s %s: %s: %s", method, u.Path, resp.Status, msg)
+	}
+	return data, nil
+}
+
+func (s *s3Store) put(ctx context.Context, name string, data []byte) error {
+	_, err := s.do(ctx, http.MethodPut, s.prefix+name, nil, data)
+	return err
+}
+
+func (s *s3Store) get(ctx context.Context, name string) ([]byte, error) {
+	return s.do(ctx, http.MethodGet, s.prefix+name, nil, nil)
+}
+
+func (s *s3Store) remove(ctx context.Context, name string) error {
+	_, err := s.do(ctx, http.MethodDelete, s.prefix+name, nil, nil)
+	return err
+}
+
+type listResult struct {
+	Contents []struct {
+		Key string
+	}
+	IsTruncated           bool
+	NextContinuationToken string
+}
+
+func (s *s3Store) list(ctx context.Context) ([]string, error) {
+	var names []string
+	q := url.Values{"list-type": {"2"}, "prefix": {s.prefix + namePrefix}}
+	for {
+		data, err := s.do(ctx, http.MethodGet, "", q, nil)
+		if err != nil {
+			return nil, err
+		}
+		var res listResult
+		if err := xml.Unmarshal(data, &res); err != nil {
+			return nil, fmt.Errorf("list %s: %w", s.dest, err)
+		}
+		for _, c := range res.Contents {
+			// 只取前缀下一层的对象
+			if name := strings.TrimPrefix(c.Key, s.prefix); !strings.Contains(name, "/") {
+				names = append(names, name)
+			}
+		}
+		if !res.IsTruncated || res.NextContinuationToken == "" {
+			break
+		}
+		q.Set("continuation-token", res.NextContinuationToken)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// signV4 按 AWS Signature Version 4 给请求签名，签入 host 与请求上已有的全部头。
+func signV4(req *http.Request, cfg s3Config, body []byte, now time.Time) {
+	sum := sha256.Sum256(body)
+	payload := hex.EncodeToString(sum[:])
+	amzDate := now.UTC().Format("20060102T150405Z")
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payload)
+	if cfg.sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", cfg.sessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for k, v := range req.Header {
+		headers[strings.ToLower(k)] = strings.TrimSpace(strings.Join(v, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var canonHeaders strings.Builder
+	for _, k := range names {
+		canonHeaders.WriteString(k + ":" + headers[k] + "\n")
+	}
+	signed := strings.Join(names, ";")
+
+	canonReq := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		canonicalQuery(req.URL.Query()),
+		canonHeaders.String(),
+		signed,
+		payload,
+	}, "\n")
+	scope := amzDate[:8] + "/" + cfg.region + "/s3/aws4_request"
+	reqSum := sha256.Sum256([]byte(canonReq))
+	toSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(reqSum[:])
+
+	key := []byte("AWS4" + cfg.secretKey)
+	for _, part := range []string{amzDate[:8], cfg.region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s,SignedHeaders=%s,Signature=%s",
+		cfg.accessKey, scope, signed, hex.EncodeToString(hmacSHA256(key, toSign))))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	m := hmac.New(sha256.New, key)
+	m.Write([]byte(data))
+	return m.Sum(nil)
+}
+
+// canonicalQuery 按 SigV4 的规则排序并编码查询参数。
+func canonicalQuery(q url.Values) string {
+	keys := make([]string, 0, len(q))
+	for k := range q {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var parts []string
+	for _, k := range keys {
+		vs := append([]string(nil), q[k]...)
+		sort.Strings(vs)
+		for _, v := range vs {
+			parts = append(parts, awsEscape(k, false)+"="+awsEscape(v, false))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// awsEscape 按 RFC 3986 编码，只保留非保留字符；keepSlash 时保留 '/'（对象路径）。
+func awsEscape(s string, keepSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~', c == '/' && keepSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
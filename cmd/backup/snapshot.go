@@ -0,0 +1,336 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	snapshotVersion = 1
+	namePrefix      = "identity-"
+	nameTime        = "20060102T150405Z"
+)
+
+// 快照格式与对象后缀。内容先 gzip 再加密。
+var formats = map[string]string{
+	"json": ".json.gz.enc",
+	"csv":  ".csv.tar.gz.enc", // users.csv、client_bindings.csv、acls.csv 打包成 tar
+}
+
+type user struct {
+	Username     string     `json:"username"`
+	PasswordHash string     `json:"password_hash"`
+	Salt         string     `json:"salt"`
+	Enabled      int16      `json:"enabled"`
+	TOTPSecret   *string    `json:"totp_secret,omitempty"`
+	ActivatedAt  *time.Time `json:"activated_at,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+type binding struct {
+	Username string `json:"username"`
+	ClientID string `json:"client_id"`
+}
+
+type rule struct {
+	Username string `json:"username"`
+	Pattern  string `json:"pattern"`
+	Acc      int    `json:"acc"`
+}
+
+// snapshot 是身份相关三张表的完整内容。acls 包括 '*' 全局规则和角色模板等不在 iot_devices 中的用户名。
+type snapshot struct {
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+	Users     []user    `json:"users"`
+	Bindings  []binding `json:"client_bindings"`
+	ACLs      []rule    `json:"acls"`
+}
+
+func (s *snapshot) String() string {
+	return fmt.Sprintf("%d user(s), %d binding(s), %d rule(s)", len(s.Users), len(s.Bindings), len(s.ACLs))
+}
+
+// objectName 返回快照的对象名；名字按时间排序。
+func objectName(t time.Time, format string) string {
+	return namePrefix + t.UTC().Format(nameTime) + formats[format]
+}
+
+// nameFormat 从对象名识别格式。
+func nameFormat(name string) (string, bool) {
+	for f, suffix := range formats {
+		if strings.HasPrefix(name, namePrefix) && strings.HasSuffix(name, suffix) {
+			return f, true
+		}
+	}
+	return "", false
+}
+
+// dump 在一个只读的可重复读事务中读取三张表，得到一致的快照。
+func dump(ctx context.Context, conn *pgx.Conn) (*snapshot, error) {
+	snap := &snapshot{Version: snapshotVersion, CreatedAt: time.Now().UTC()}
+	err := pgx.BeginTxFunc(ctx, conn, pgx.TxOptions{IsoLevel: pgx.RepeatableRead, AccessMode: pgx.ReadOnly}, func(tx pgx.Tx) error {
+		rows, _ := tx.Query(ctx, `SELECT username, password_hash, salt, enabled, totp_secret, activated_at, created_at
+FROM iot_devices ORDER BY username`)
+		users, err := pgx.CollectRows(rows, func(r pgx.CollectableRow) (user, error) {
+			var u user
+			err := r.Scan(&u.Username, &u.PasswordHash, &u.Salt, &u.Enabled, &u.TOTPSecret, &u.ActivatedAt, &u.CreatedAt)
+			return u, err
+		})
+		if err != nil {
+			return fmt.Errorf("iot_devices: %w", err)
+		}
+		rows, _ = tx.Query(ctx, "SELECT username, client_id FROM client_bindings ORDER BY username, client_id")
+		bindings, err := pgx.CollectRows(rows, func(r pgx.CollectableRow) (binding, error) {
+			var b binding
+			err := r.Scan(&b.Username, &b.ClientID)
+			return b, err
+		})
+		if err != nil {
+			return fmt.Errorf("client_bindings: %w", err)
+		}
+		rows, _ = tx.Query(ctx, "SELECT username, pattern, acc FROM acls ORDER BY username, pattern")
+		acls, err := pgx.CollectRows(rows, func(r pgx.CollectableRow) (rule, error) {
+			var a rule
+			err := r.Scan(&a.Username, &a.Pattern, &a.Acc)
+			return a, err
+		})
+		if err != nil {
+			return fmt.Errorf("acls: %w", err)
+		}
+		snap.Users, snap.Bindings, snap.ACLs = users, bindings, acls
+		return nil
+	})
+	return snap, err
+}
+
+// errNotEmpty 表示目标库已有用户，恢复需要 -replace。
+var errNotEmpty = errors.New("iot_devices is not empty; use -replace to overwrite it")
+
+// restore 在一个事务中写回快照。replace 时先清空三张表（级联删除引用 iot_devices 的 SCIM、注册等记录）。
+func restore(ctx context.Context, conn *pgx.Conn, snap *snapshot, replace bool) error {
+	return pgx.BeginFunc(ctx, conn, func(tx pgx.Tx) error {
+		if replace {
+			for _, table := range []string{"acls", "client_bindings", "iot_devices"} {
+				if _, err := tx.Exec(ctx, "DELETE FROM "+table); err != nil {
+					return fmt.Errorf("%s: %w", table, err)
+				}
+			}
+		} else {
+			var exists bool
+			if err := tx.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM iot_devices)").Scan(&exists); err != nil {
+				return err
+			}
+			if exists {
+				return errNotEmpty
+			}
+		}
+		_, err := tx.CopyFrom(ctx, pgx.Identifier{"iot_devices"},
+			[]string{"username", "password_hash", "salt", "enabled", "totp_secret", "activated_at", "created_at"},
+			pgx.CopyFromSlice(len(snap.Users), func(i int) ([]any, error) {
+				u := snap.Users[i]
+				return []any{u.Username, u.PasswordHash, u.Salt, u.Enabled, u.TOTPSecret, u.ActivatedAt, u.CreatedAt}, nil
+			}))
+		if err != nil {
+			return fmt.Errorf("iot_devices: %w", err)
+		}
+		_, err = tx.CopyFrom(ctx, pgx.Identifier{"client_bindings"}, []string{"username", "client_id"},
+			pgx.CopyFromSlice(len(snap.Bindings), func(i int) ([]any, error) {
+				return []any{snap.Bindings[i].Username, snap.Bindings[i].ClientID}, nil
+			}))
+		if err != nil {
+			return fmt.Errorf("client_bindings: %w", err)
+		}
+		_, err = tx.CopyFrom(ctx, pgx.Identifier{"acls"}, []string{"username", "pattern", "acc"},
+			pgx.CopyFromSlice(len(snap.ACLs), func(i int) ([]any, error) {
+				return []any{snap.ACLs[i].Username, snap.ACLs[i].Pattern, snap.ACLs[i].Acc}, nil
+			}))
+		if err != nil {
+			return fmt.Errorf("acls: %w", err)
+		}
+		return nil
+	})
+}
+
+// encode 序列化并压缩快照（未加密）。
+func encode(snap *snapshot, format string) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	var err error
+	if format == "csv" {
+		err = writeCSV(zw, snap)
+	} else {
+		err = json.NewEncoder(zw).Encode(snap)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// decode 是 encode 的逆操作。
+func decode(data []byte, format string) (*snapshot, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	var snap *snapshot
+	if format == "csv" {
+		snap, err = readCSV(zr)
+	} else {
+		snap = &snapshot{}
+		err = json.NewDecoder(zr).Decode(snap)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if snap.Version != snapshotVersion {
+		return nil, fmt.Errorf("unsupported snapshot version %d", snap.Version)
+	}
+	return snap, nil
+}
+
+var csvHeaders = map[string][]string{
+	"meta.csv":            {"version", "created_at"},
+	"users.csv":           {"username", "password_hash", "salt", "enabled", "totp_secret", "activated_at", "created_at"},
+	"client_bindings.csv": {"username", "client_id"},
+	"acls.csv":            {"username", "pattern", "acc"},
+}
+
+func writeCSV(w io.Writer, snap *snapshot) error {
+	files := map[string][][]string{
+		"meta.csv": {{strconv.Itoa(snap.Version), snap.CreatedAt.Format(time.RFC3339Nano)}},
+	}
+	for _, u := range snap.Users {
+		files["users.csv"] = append(files["users.csv"], []string{u.Username, u.PasswordHash, u.Salt,
+			strconv.Itoa(int(u.Enabled)), deref(u.TOTPSecret), formatTime(u.ActivatedAt), u.CreatedAt.Format(time.RFC3339Nano)})
+	}
+	for _, b := range snap.Bindings {
+		files["client_bindings.csv"] = append(files["client_bindings.csv"], []string{b.Username, b.ClientID})
+	}
+	for _, a := range snap.ACLs {
+		files["acls.csv"] = append(files["acls.csv"], []string{a.Username, a.Pattern, strconv.Itoa(a.Acc)})
+	}
+
+	tw := tar.NewWriter(w)
+	for _, name := range []string{"meta.csv", "users.csv", "client_bindings.csv", "acls.csv"} {
+		var buf bytes.Buffer
+		cw := csv.NewWriter(&buf)
+		cw.Write(csvHeaders[name])
+		cw.WriteAll(files[name])
+		if err := cw.Error(); err != nil {
+			return err
+		}
+		hdr := &tar.Header{Name: name, Mode: 0o600, Size: int64(buf.Len()), ModTime: snap.CreatedAt}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if _, err := tw.Write(buf.Bytes()); err != nil {
+			return err
+		}
+	}
+	return tw.Close()
+}
+
+func readCSV(r io.Reader) (*snapshot, error) {
+	files := map[string][][]string{}
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		want, ok := csvHeaders[hdr.Name]
+		if !ok {
+			continue
+		}
+		cr := csv.NewReader(tr)
+		cr.FieldsPerRecord = len(want)
+		recs, err := cr.ReadAll()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", hdr.Name, err)
+		}
+		if len(recs) == 0 || strings.Join(recs[0], ",") != strings.Join(want, ",") {
+			return nil, fmt.Errorf("%s: unexpected header", hdr.Name)
+		}
+		files[hdr.Name] = recs[1:]
+	}
+	if len(files["meta.csv"]) != 1 {
+		return nil, errors.New("meta.csv missing")
+	}
+
+	snap := &snapshot{}
+	var err error
+	meta := files["meta.csv"][0]
+	if snap.Version, err = strconv.Atoi(meta[0]); err != nil {
+		return nil, fmt.Errorf("meta.csv: %w", err)
+	}
+	if snap.CreatedAt, err = time.Parse(time.RFC3339Nano, meta[1]); err != nil {
+		return nil, fmt.Errorf("meta.csv: %w", err)
+	}
+	for i, rec := range files["users.csv"] {
+		u := user{Username: rec[0], PasswordHash: rec[1], Salt: rec[2]}
+		enabled, err := strconv.ParseInt(rec[3], 10, 16)
+		if err != nil {
+			return nil, fmt.Errorf("users.csv line %d: enabled: %w", i+2, err)
+		}
+		u.Enabled = int16(enabled)
+		if rec[4] != "" {
+			u.TOTPSecret = &rec[4]
+		}
+		if rec[5] != "" {
+			t, err := time.Parse(time.RFC3339Nano, rec[5])
+			if err != nil {
+				return nil, fmt.Errorf("users.csv line %d: activated_at: %w", i+2, err)
+			}
+			u.ActivatedAt = &t
+		}
+		if u.CreatedAt, err = time.Parse(time.RFC3339Nano, rec[6]); err != nil {
+			return nil, fmt.Errorf("users.csv line %d: created_at: %w", i+2, err)
+		}
+		snap.Users = append(snap.Users, u)
+	}
+	for _, rec := range files["client_bindings.csv"] {
+		snap.Bindings = append(snap.Bindings, binding{Username: rec[0], ClientID: rec[1]})
+	}
+	for i, rec := range files["acls.csv"] {
+		acc, err := strconv.Atoi(rec[2])
+		if err != nil {
+			return nil, fmt.Errorf("acls.csv line %d: acc: %w", i+2, err)
+		}
+		snap.ACLs = append(snap.ACLs, rule{Username: rec[0], Pattern: rec[1], Acc: acc})
+	}
+	return snap, nil
+}
+
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.Format(time.RFC3339Nano)
+}
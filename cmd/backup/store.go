@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// store 保存快照对象；名字只包含文件名，前缀（目录、bucket 路径）由实现负责。
+type store interface {
+	put(ctx context.Context, name string, data []byte) error
+	get(ctx context.Context, name string) ([]byte, error)
+	// list 按名字升序返回以 namePrefix 开头的对象；快照名带时间戳，升序即时间顺序。
+	list(ctx context.Context) ([]string, error)
+	remove(ctx context.Context, name string) error
+	String() string
+}
+
+// openStore 按 -dest 选择存储：s3://bucket/prefix、gs://bucket/prefix，其余视为本地目录。
+func openStore(dest string) (store, error) {
+	switch {
+	case strings.HasPrefix(dest, "s3://"):
+		return newS3Store(dest, strings.TrimPrefix(dest, "s3://"), s3Config{
+			endpoint:     os.Getenv("AWS_ENDPOINT_URL"),
+			region:       os.Getenv("AWS_REGION"),
+			accessKey:    os.Getenv("AWS_ACCESS_KEY_ID"),
+			secretKey:    os.Getenv("AWS_SECRET_ACCESS_KEY"),
+			sessionToken: os.Getenv("AWS_SESSION_TOKEN"),
+		})
+	case strings.HasPrefix(dest, "gs://"):
+		// GCS 的 XML API 兼容 S3，使用 HMAC 密钥签名
+		return newS3Store(dest, strings.TrimPrefix(dest, "gs://"), s3Config{
+			endpoint:  "https://storage.googleapis.com",
+			region:    "auto",
+			accessKey: os.Getenv("GOOGLE_HMAC_ACCESS_ID"),
+			secretKey: os.Getenv("GOOGLE_HMAC_SECRET"),
+		})
+	case dest == "":
+		return nil, fmt.Errorf("-dest is required")
+	}
+	dir := strings.TrimPrefix(dest, "file://")
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	return dirStore(dir), nil
+}
+
+// dirStore 是本地目录（可以是挂载的网络盘）。
+type dirStore string
+
+func (d dirStore) String() string { return string(d) }
+
+// put 先写临时文件再改名，中断时不会留下半个快照。
+func (d dirStore) put(_ context.Context, name string, data []byte) error {
+	tmp, err := os.CreateTemp(string(d), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filepath.Join(string(d), name))
+}
+
+func (d dirStore) get(_ context.Context, name string) ([]byte, error) {
+	return os.ReadFile(filepath.Join(string(d), name))
+}
+
+func (d dirStore) list(context.Context) ([]string, error) {
+	entries, err := os.ReadDir(string(d))
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, e := range entries {
+		if e.Type().IsRegular() && strings.HasPrefix(e.Name(), namePrefix) {
+			names = append(names, e.Name())
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (d dirStore) remove(_ context.Context, name string) error {
+	return os.Remove(filepath.Join(string(d), name))
+}
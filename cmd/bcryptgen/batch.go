@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// 批量模式：从 stdin 或 CSV 文件读取 username,password，每行输出 username,hash，
+// 或 -format sql 时输出可直接交给 psql 的 UPDATE 语句，-format passwd 时输出 mosquitto password_file 行。首行为 username,password 表头时跳过，
+// # 开头的行视为注释。
+
+type credential struct {
+	username, password string
+}
+
+func readBatch(r io.Reader) ([]credential, error) {
+	cr := csv.NewReader(r)
+	cr.Comment = '#'
+	cr.FieldsPerRecord = 2
+	cr.TrimLeadingSpace = true
+
+	var creds []credential
+	for first := true; ; first = false {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			return creds, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if first && strings.EqualFold(rec[0], "username") && strings.EqualFold(rec[1], "password") {
+			continue
+		}
+		if rec[0] == "" {
+			line, _ := cr.FieldPos(0)
+			return nil, fmt.Errorf("line %d: empty username", line)
+		}
+		creds = append(creds, credential{username: rec[0], password: rec[1]})
+	}
+}
+
+// sqlQuote 按 SQL 标准转义单引号。
+func sqlQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// saltColumn 为 true 时 csv 多输出一列 salt（-algo sha256-salt 的盐每行不同，必须随哈希一起保存）。
+func writeBatch(w io.Writer, rows []deviceRow, format string, saltColumn bool) error {
+	if format != "csv" && format != "sql" && format != "passwd" {
+		return fmt.Errorf("unknown format %q (want csv, sql or passwd)", format)
+	}
+	cw := csv.NewWriter(w)
+	for _, r := range rows {
+		var err error
+		switch format {
+		case "csv":
+			if saltColumn {
+				cw.Write([]string{r.username, r.hash, r.salt})
+				continue
+			}
+			cw.Write([]string{r.username, r.hash})
+		case "sql":
+			_, err = fmt.Fprintf(w, "UPDATE iot_devices SET password_hash = %s, salt = %s WHERE username = %s;\n",
+				sqlQuote(r.hash), sqlQuote(r.salt), sqlQuote(r.username))
+		case "passwd":
+			if strings.Contains(r.username, ":") {
+				return fmt.Errorf("%s: username cannot contain ':' in a password_file", r.username)
+			}
+			_, err = fmt.Fprintf(w, "%s:%s\n", r.username, r.mosqHash)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
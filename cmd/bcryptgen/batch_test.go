@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha512"
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/pbkdf2"
+
+	"auth-plugin/internal/pwhash"
+)
+
+func TestReadBatch(t *testing.T) {
+	t.Parallel()
+	in := "username,password\n# fleet A\nalice,pw1\n\"o'brien\",\"p,w 2\"\n"
+	creds, err := readBatch(strings.NewReader(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []credential{{"alice", "pw1"}, {"o'brien", "p,w 2"}}
+	if len(creds) != len(want) {
+		t.Fatalf("got %v, want %v", creds, want)
+	}
+	for i := range want {
+		if creds[i] != want[i] {
+			t.Fatalf("cred %d = %v, want %v", i, creds[i], want[i])
+		}
+	}
+
+	for _, bad := range []string{"alice\n", "alice,pw,extra\n", ",pw\n"} {
+		if _, err := readBatch(strings.NewReader(bad)); err == nil {
+			t.Fatalf("readBatch(%q) should fail", bad)
+		}
+	}
+}
+
+func TestWriteBatch(t *testing.T) {
+	t.Parallel()
+	creds := []credential{{"o'brien", "password"}}
+
+	hf, err := pwhash.New(pwhash.Params{Algo: "sha256", Salt: "salt"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows, err := hashCredentials(creds, hf, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := writeBatch(&buf, rows, "csv", false); err != nil {
+		t.Fatal(err)
+	}
+	const hash = "7a37b85c8918eac19a9089c0fa5a2ab4dce3f90528dcdeec108b23ddf3607b99"
+	if got := buf.String(); got != "o'brien,"+hash+"\n" {
+		t.Fatalf("csv = %q", got)
+	}
+
+	buf.Reset()
+	if err := writeBatch(&buf, rows, "sql", false); err != nil {
+		t.Fatal(err)
+	}
+	want := "UPDATE iot_devices SET password_hash = '" + hash + "', salt = 'salt' WHERE username = 'o''brien';\n"
+	if got := buf.String(); got != want {
+		t.Fatalf("sql = %q, want %q", got, want)
+	}
+
+	if err := writeBatch(&buf, rows, "xml", false); err == nil {
+		t.Fatal("unknown format should fail")
+	}
+}
+
+func TestSHA256RandomSalt(t *testing.T) {
+	t.Parallel()
+	hf, err := pwhash.New(pwhash.Params{Algo: "sha256-salt", Salt: "ignored"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows, err := hashCredentials([]credential{{"alice", "pw"}, {"bob", "pw"}}, hf, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range rows {
+		if len(r.salt) != 32 || r.hash != pwhash.SHA256Salt("pw", r.salt) {
+			t.Fatalf("%s: hash %q salt %q does not verify", r.username, r.hash, r.salt)
+		}
+	}
+	if rows[0].salt == rows[1].salt {
+		t.Fatal("salt should be random per password")
+	}
+
+	var buf bytes.Buffer
+	if err := writeBatch(&buf, rows[:1], "csv", true); err != nil {
+		t.Fatal(err)
+	}
+	if want := "alice," + rows[0].hash + "," + rows[0].salt + "\n"; buf.String() != want {
+		t.Fatalf("csv = %q, want %q", buf.String(), want)
+	}
+}
+
+func TestMosquittoPasswd(t *testing.T) {
+	t.Parallel()
+	hf, err := pwhash.New(pwhash.Params{Algo: "sha256", Salt: "salt"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows, err := hashCredentials([]credential{{"alice", "secret"}}, hf, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := writeBatch(&buf, rows, "passwd", false); err != nil {
+		t.Fatal(err)
+	}
+	user, hash, ok := strings.Cut(strings.TrimSuffix(buf.String(), "\n"), ":")
+	if !ok || user != "alice" {
+		t.Fatalf("passwd line = %q", buf.String())
+	}
+	// $7$<iterations>$<salt>$<hash>，按 mosquitto_passwd 的方式重新计算校验
+	parts := strings.Split(hash, "$")
+	if len(parts) != 5 || parts[1] != "7" || parts[2] != "101" {
+		t.Fatalf("hash = %q", hash)
+	}
+	salt, err := base64.StdEncoding.DecodeString(parts[3])
+	if err != nil || len(salt) != 12 {
+		t.Fatalf("salt = %q (%v)", parts[3], err)
+	}
+	want := base64.StdEncoding.EncodeToString(pbkdf2.Key([]byte("secret"), salt, 101, sha512.Size, sha512.New))
+	if parts[4] != want {
+		t.Fatalf("hash = %q, want %q", parts[4], want)
+	}
+
+	if err := writeBatch(&buf, []deviceRow{{username: "a:b"}}, "passwd", false); err == nil {
+		t.Fatal("username with ':' should fail")
+	}
+}
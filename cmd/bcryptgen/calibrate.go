@@ -0,0 +1,49 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// -calibrate：从最小 cost 开始逐级测量 bcrypt 耗时，返回不超过目标的最大 cost。
+// cost 每加 1 耗时翻倍，超过目标后即可停止，不会测到 31 这种需要数分钟的值。
+
+// calibrateRuns 每个 cost 测量的次数，取最快一次以排除调度抖动。
+const calibrateRuns = 3
+
+func measureBcrypt(cost int) (time.Duration, error) {
+	best := time.Duration(-1)
+	for range calibrateRuns {
+		start := time.Now()
+		if _, err := bcrypt.GenerateFromPassword([]byte("calibrate-password"), cost); err != nil {
+			return 0, err
+		}
+		if d := time.Since(start); best < 0 || d < best {
+			best = d
+		}
+	}
+	return best, nil
+}
+
+// calibrateCost 逐级测量并把每一级的耗时写到 log；连最小 cost 都超过目标时返回错误。
+func calibrateCost(target time.Duration, measure func(cost int) (time.Duration, error), log io.Writer) (int, error) {
+	best := 0
+	for cost := bcrypt.MinCost; cost <= bcrypt.MaxCost; cost++ {
+		d, err := measure(cost)
+		if err != nil {
+			return 0, err
+		}
+		fmt.Fprintf(log, "cost %2d: %v\n", cost, d.Round(time.Microsecond))
+		if d > target {
+			break
+		}
+		best = cost
+	}
+	if best == 0 {
+		return 0, fmt.Errorf("even bcrypt cost %d takes longer than %v", bcrypt.MinCost, target)
+	}
+	return best, nil
+}
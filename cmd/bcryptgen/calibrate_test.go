@@ -0,0 +1,33 @@
+package main
+
+import (
+	"io"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestCalibrateCost(t *testing.T) {
+	t.Parallel()
+	// 模拟 cost 4 耗时 1ms、每级翻倍：cost 10 = 64ms，cost 11 = 128ms
+	fake := func(cost int) (time.Duration, error) {
+		return time.Millisecond << (cost - bcrypt.MinCost), nil
+	}
+	tests := []struct {
+		target time.Duration
+		want   int
+		ok     bool
+	}{
+		{100 * time.Millisecond, 10, true},
+		{128 * time.Millisecond, 11, true},
+		{time.Millisecond, bcrypt.MinCost, true},
+		{time.Microsecond, 0, false},
+	}
+	for _, tt := range tests {
+		got, err := calibrateCost(tt.target, fake, io.Discard)
+		if (err == nil) != tt.ok || got != tt.want {
+			t.Errorf("calibrateCost(%v) = %d, %v; want %d", tt.target, got, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"auth-plugin/internal/pwhash"
+)
+
+// -dsn：把生成的哈希直接写入 iot_devices（按 username upsert），批量模式在同一事务中完成。
+
+const upsertDevice = `INSERT INTO iot_devices (username, password_hash, salt, enabled)
+VALUES ($1, $2, $3, $4)
+ON CONFLICT (username) DO UPDATE
+SET password_hash = EXCLUDED.password_hash, salt = EXCLUDED.salt, enabled = EXCLUDED.enabled`
+
+type deviceRow struct {
+	username, hash, salt string
+	mosqHash             string // 仅 -format passwd
+}
+
+func hashCredentials(creds []credential, hf pwhash.Func, passwd bool) ([]deviceRow, error) {
+	rows := make([]deviceRow, 0, len(creds))
+	for _, c := range creds {
+		hash, salt, err := hf(c.password)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", c.username, err)
+		}
+		r := deviceRow{username: c.username, hash: hash, salt: salt}
+		if passwd {
+			if r.mosqHash, err = pwhash.Mosquitto(c.password); err != nil {
+				return nil, fmt.Errorf("%s: %w", c.username, err)
+			}
+		}
+		rows = append(rows, r)
+	}
+	return rows, nil
+}
+
+func upsertDevices(dsn string, rows []deviceRow, enabled bool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	conn, err := pgx.Connect(ctx, dsn)
+	if err != nil {
+		return err
+	}
+	defer conn.Close(context.Background())
+
+	// 插件把 enabled 读成 int16，这里同样写 1/0
+	var en int16
+	if enabled {
+		en = 1
+	}
+	return pgx.BeginFunc(ctx, conn, func(tx pgx.Tx) error {
+		for _, r := range rows {
+			if _, err := tx.Exec(ctx, upsertDevice, r.username, r.hash, r.salt, en); err != nil {
+				return fmt.Errorf("%s: %w", r.username, err)
+			}
+		}
+		return nil
+	})
+}
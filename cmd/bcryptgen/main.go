@@ -2,32 +2,186 @@ package main
 
 import (
 	"bufio"
-	"crypto/sha256"
-	"encoding/hex"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"os"
 	"strings"
+	"time"
+
+	"auth-plugin/internal/pwhash"
+
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/term"
 )
 
 func main() {
-	salt := flag.String("salt", "", "salt")
+	var p pwhash.Params
+	var argonTime, argonMemory, argonThreads uint
+	flag.StringVar(&p.Algo, "algo", "sha256", "hash format: sha256, sha256-salt, bcrypt, argon2id or pbkdf2")
+	flag.StringVar(&p.Salt, "salt", "", "salt (sha256 only)")
+	flag.IntVar(&p.Cost, "cost", bcrypt.DefaultCost, "bcrypt cost")
+	flag.UintVar(&argonTime, "argon-time", 3, "argon2id iterations")
+	flag.UintVar(&argonMemory, "argon-memory", 64*1024, "argon2id memory in KiB")
+	flag.UintVar(&argonThreads, "argon-threads", 2, "argon2id parallelism")
+	flag.IntVar(&p.PBKDF2Iter, "pbkdf2-iter", 600000, "pbkdf2 iterations")
+	flag.StringVar(&p.PBKDF2Hash, "pbkdf2-hash", "sha256", "pbkdf2 hash: sha256 or sha512")
+	batch := flag.Bool("batch", false, "read username,password lines from stdin or the CSV file given as argument")
+	format := flag.String("format", "csv", "batch output: csv (username,hash), sql (UPDATE statements) or passwd (mosquitto password_file)")
+	dsn := flag.String("dsn", "", "write the hash into iot_devices in this database instead of printing it")
+	username := flag.String("username", "", "device username to upsert (with -dsn)")
+	enabled := flag.Bool("enabled", true, "enabled flag written with -dsn")
+	calibrate := flag.Int("calibrate", 0, "benchmark bcrypt and print the highest cost within this many milliseconds")
 	flag.Parse()
 
+	if *calibrate > 0 {
+		cost, err := calibrateCost(time.Duration(*calibrate)*time.Millisecond, measureBcrypt, os.Stderr)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "bcryptgen:", err)
+			os.Exit(1)
+		}
+		fmt.Println(cost)
+		return
+	}
+	p.ArgonTime, p.ArgonMemory = uint32(min(argonTime, 1<<32-1)), uint32(min(argonMemory, 1<<32-1))
+	p.ArgonThreads = uint8(min(argonThreads, 255))
+
+	hf, err := pwhash.New(p)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "bcryptgen:", err)
+		os.Exit(2)
+	}
+
+	if *dsn != "" && !*batch && *username == "" {
+		fmt.Fprintln(os.Stderr, "bcryptgen: -dsn needs -username (or -batch)")
+		os.Exit(2)
+	}
+	if *format == "passwd" && !*batch && *username == "" {
+		fmt.Fprintln(os.Stderr, "bcryptgen: -format passwd needs -username (or -batch)")
+		os.Exit(2)
+	}
+
+	if *batch {
+		if err := runBatch(flag.Arg(0), hf, *format, *dsn, *enabled, p.Algo == "sha256-salt"); err != nil {
+			fmt.Fprintln(os.Stderr, "bcryptgen:", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	var pwd string
 	if flag.NArg() > 0 {
 		pwd = flag.Arg(0)
 	} else {
-		fmt.Print("Password: ")
-		s, _ := bufio.NewReader(os.Stdin).ReadString('\n')
-		pwd = strings.TrimRight(s, "\r\n")
+		var err error
+		if pwd, err = readPassword(os.Stdin); err != nil {
+			fmt.Fprintln(os.Stderr, "bcryptgen:", err)
+			os.Exit(1)
+		}
+	}
+
+	en_pwd, salt, err := hf(pwd)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "bcryptgen:", err)
+		os.Exit(1)
+	}
+	if *dsn != "" {
+		if err := upsertDevices(*dsn, []deviceRow{{username: *username, hash: en_pwd, salt: salt}}, *enabled); err != nil {
+			fmt.Fprintln(os.Stderr, "bcryptgen:", err)
+			os.Exit(1)
+		}
+		fmt.Fprintf(os.Stderr, "updated %s\n", *username)
+		if *format != "passwd" {
+			return
+		}
+	}
+	if *format == "passwd" {
+		mosq, err := pwhash.Mosquitto(pwd)
+		if err == nil {
+			err = writeBatch(os.Stdout, []deviceRow{{username: *username, mosqHash: mosq}}, "passwd", false)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "bcryptgen:", err)
+			os.Exit(1)
+		}
+		return
 	}
+	if p.Algo == "sha256-salt" {
+		// 盐是随机生成的，必须一并输出，否则哈希无法使用
+		fmt.Print(en_pwd, " ", salt)
+		return
+	}
+	fmt.Print(en_pwd)
+}
 
-	en_pwd := sha256PwdSalt(pwd, *salt)
-	fmt.Printf(en_pwd)
+func runBatch(path string, hf pwhash.Func, format, dsn string, enabled, saltColumn bool) error {
+	in := io.Reader(os.Stdin)
+	if path != "" && path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+	creds, err := readBatch(in)
+	if err != nil {
+		return err
+	}
+	rows, err := hashCredentials(creds, hf, format == "passwd")
+	if err != nil {
+		return err
+	}
+	if dsn != "" {
+		if err := upsertDevices(dsn, rows, enabled); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "updated %d device(s)\n", len(rows))
+		if format != "passwd" {
+			// 同时生成 password_file 时继续输出，其余格式写库后不再打印
+			return nil
+		}
+	}
+	out := bufio.NewWriter(os.Stdout)
+	if err := writeBatch(out, rows, format, saltColumn); err != nil {
+		return err
+	}
+	return out.Flush()
 }
 
-func sha256PwdSalt(pwd, salt string) string {
-	sum := sha256.Sum256([]byte(pwd + salt))
-	return hex.EncodeToString(sum[:])
+// readPassword 在终端上不回显读取并要求再次输入确认；stdin 为管道时直接读取一行。
+// 提示写到 stderr，stdout 只输出结果，便于脚本捕获。
+func readPassword(in *os.File) (string, error) {
+	fd := int(in.Fd())
+	if !term.IsTerminal(fd) {
+		return readLine(in)
+	}
+	fmt.Fprint(os.Stderr, "Password: ")
+	first, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", err
+	}
+	if len(first) == 0 {
+		return "", errors.New("empty password")
+	}
+	fmt.Fprint(os.Stderr, "Confirm password: ")
+	second, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", err
+	}
+	if string(first) != string(second) {
+		return "", errors.New("passwords do not match")
+	}
+	return string(first), nil
+}
+
+func readLine(r io.Reader) (string, error) {
+	s, err := bufio.NewReader(r).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	return strings.TrimRight(s, "\r\n"), nil
 }
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"auth-plugin/internal/optnames"
+)
+
+// mosquitto.conf 中与插件有关的部分：plugin/auth_plugin 行和 plugin_opt_*/auth_opt_* 选项。
+
+type confOption struct {
+	value string
+	line  int
+}
+
+type mosqConf struct {
+	plugins []string
+	opts    map[string]confOption
+	dupes   []string // 重复出现的选项（后者覆盖前者）
+}
+
+func parseConf(r io.Reader) (*mosqConf, error) {
+	c := &mosqConf{opts: map[string]confOption{}}
+	sc := bufio.NewScanner(r)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, _ := strings.Cut(line, " ")
+		value = strings.TrimSpace(value)
+		switch {
+		case key == "plugin" || key == "auth_plugin":
+			c.plugins = append(c.plugins, value)
+		case strings.HasPrefix(key, "plugin_opt_") || strings.HasPrefix(key, "auth_opt_"):
+			name := strings.TrimPrefix(strings.TrimPrefix(key, "plugin_opt_"), "auth_opt_")
+			if _, dup := c.opts[name]; dup {
+				c.dupes = append(c.dupes, name)
+			}
+			c.opts[name] = confOption{value, n}
+		}
+	}
+	return c, sc.Err()
+}
+
+func (c *mosqConf) opt(name string) string { return c.opts[name].value }
+
+// dsn 按插件的优先级得到 DSN：环境变量 PG_DSN 为默认值，pg_dsn 覆盖它，pg_dsn_file 优先于两者。
+func (c *mosqConf) dsn() (string, string, error) {
+	file := c.opt("pg_dsn_file")
+	if file == "" {
+		file = os.Getenv("PG_DSN_FILE")
+	}
+	if file != "" {
+		b, err := os.ReadFile(file)
+		if err != nil {
+			return "", "pg_dsn_file", err
+		}
+		return strings.TrimSpace(string(b)), "pg_dsn_file", nil
+	}
+	if v := c.opt("pg_dsn"); v != "" {
+		return v, "pg_dsn", nil
+	}
+	return os.Getenv("PG_DSN"), "PG_DSN", nil
+}
+
+func checkConf(r *report, c *mosqConf, path string) {
+	const check = "config"
+	if len(c.plugins) == 0 {
+		r.add(critical, check, path+" has no plugin line, so the broker does not load the auth plugin",
+			"add: plugin /mosquitto/plugins/mosq_pg_auth.so")
+	}
+	for _, p := range c.plugins {
+		if _, err := os.Stat(p); err != nil {
+			r.add(critical, check, fmt.Sprintf("plugin %s: %v", p, err),
+				"use an absolute path to mosq_pg_auth.so (relative paths resolve against the broker's working directory)")
+		} else {
+			r.ok(check, "plugin "+p+" exists")
+		}
+	}
+
+	unknownSev := warning
+	if isTrue(c.opt("strict_options")) {
+		unknownSev = critical // strict_options 下未知选项会导致启动失败
+	}
+	for name, o := range c.opts {
+		if optnames.Known(name) {
+			continue
+		}
+		fix := "remove it"
+		if s := optnames.Suggest(name); s != "" {
+			fix = "did you mean plugin_opt_" + s + "?"
+		}
+		r.add(unknownSev, check, fmt.Sprintf("line %d: unknown option plugin_opt_%s is ignored", o.line, name), fix)
+	}
+	for _, d := range c.dupes {
+		r.add(warning, check, "plugin_opt_"+d+" is set more than once; the last value wins", "keep a single line")
+	}
+
+	dsn, source, err := c.dsn()
+	switch {
+	case err != nil:
+		r.add(critical, check, "cannot read "+source+": "+err.Error(), "fix the path or file permissions")
+	case dsn == "":
+		r.add(critical, check, "no database DSN: plugin_opt_pg_dsn, plugin_opt_pg_dsn_file and PG_DSN are all unset",
+			"set plugin_opt_pg_dsn_file (preferred) or PG_DSN")
+	default:
+		if mode := sslMode(dsn); mode == "disable" || mode == "allow" || mode == "prefer" || mode == "" {
+			r.add(warning, check, fmt.Sprintf("DSN from %s uses sslmode=%s; credentials and password hashes may cross the network unencrypted", source, orDefault(mode, "prefer")),
+				"use sslmode=verify-full with sslrootcert")
+		}
+		if source == "pg_dsn" && dsnHasPassword(dsn) {
+			r.add(info, check, "plugin_opt_pg_dsn contains a password in mosquitto.conf",
+				"move it to plugin_opt_pg_password_file or plugin_opt_pg_dsn_file")
+		}
+	}
+
+	if isTrue(c.opt("fail_open_auth")) || isTrue(c.opt("fail_open")) {
+		r.add(warning, check, "fail_open_auth lets every client connect while the database is unreachable",
+			"prefer plugin_opt_auth_grace_minutes, which only admits recently verified credentials")
+	}
+	if ms, err := strconv.Atoi(c.opt("timeout_ms")); err == nil && ms > 5000 {
+		r.add(warning, check, fmt.Sprintf("timeout_ms=%d; callbacks block the broker's main loop for up to that long", ms),
+			"keep timeout_ms at a few hundred to 2000 ms")
+	}
+}
+
+func isTrue(v string) bool {
+	b, _ := strconv.ParseBool(v)
+	return b
+}
+
+func orDefault(v, def string) string {
+	if v == "" {
+		return def
+	}
+	return v
+}
+
+// sslMode 支持 URL 与 key=value 两种 DSN 写法。
+func sslMode(dsn string) string {
+	if u, err := url.Parse(dsn); err == nil && (u.Scheme == "postgres" || u.Scheme == "postgresql") {
+		return u.Query().Get("sslmode")
+	}
+	for _, f := range strings.Fields(dsn) {
+		if k, v, ok := strings.Cut(f, "="); ok && k == "sslmode" {
+			return strings.Trim(v, "'")
+		}
+	}
+	return ""
+}
+
+func dsnHasPassword(dsn string) bool {
+	if u, err := url.Parse(dsn); err == nil && (u.Scheme == "postgres" || u.Scheme == "postgresql") {
+		_, ok := u.User.Password()
+		return ok || u.Query().Has("password")
+	}
+	for _, f := range strings.Fields(dsn) {
+		if strings.HasPrefix(f, "password=") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"auth-plugin/internal/migrations"
+)
+
+// 数据库侧检查：连通性与 TLS、插件查询依赖的表/列/索引、迁移版本、在用的哈希格式和时钟偏差。
+
+type tableSpec struct {
+	name    string
+	columns []string
+	index   string // 需要以该列开头的索引
+}
+
+// requiredTables 与插件内置查询（plugin.go authQuery/bindQuery、acl.go aclQuery）一致。
+var requiredTables = []tableSpec{
+	{"iot_devices", []string{"username", "password_hash", "salt", "enabled"}, "username"},
+	{"client_bindings", []string{"username", "client_id"}, "username"},
+	{"acls", []string{"username", "pattern", "acc"}, "username"},
+}
+
+// maxClockSkew 超过后 auth_grace_minutes、Vault 租约等基于时间的判断会出偏差。
+const maxClockSkew = 2 * time.Second
+
+func checkDB(ctx context.Context, r *report, dsn, schema string) {
+	conn, err := pgx.Connect(ctx, dsn)
+	if err != nil {
+		r.add(critical, "postgres", "cannot connect: "+err.Error(),
+			"check host/port reachability, credentials and pg_hba.conf for this client address")
+		return
+	}
+	defer conn.Close(context.Background())
+	r.ok("postgres", "connected to "+conn.Config().Host)
+
+	if schema != "" {
+		// 与插件一样把 pg_schema 作为 search_path
+		if _, err := conn.Exec(ctx, "SET search_path TO "+pgx.Identifier{schema}.Sanitize()); err != nil {
+			r.add(critical, "postgres", "cannot set search_path to pg_schema "+schema+": "+err.Error(), "")
+			return
+		}
+	}
+
+	checkTLS(ctx, r, conn)
+	checkClock(ctx, r, conn)
+	if checkSchema(ctx, r, conn) {
+		checkMigrations(ctx, r, conn)
+		checkHashes(ctx, r, conn)
+	}
+}
+
+func checkTLS(ctx context.Context, r *report, conn *pgx.Conn) {
+	var ssl bool
+	var version string
+	err := conn.QueryRow(ctx,
+		"SELECT ssl, coalesce(version, '') FROM pg_stat_ssl WHERE pid = pg_backend_pid()").Scan(&ssl, &version)
+	switch {
+	case err != nil:
+		r.add(info, "tls", "cannot read pg_stat_ssl: "+err.Error(), "")
+	case !ssl:
+		r.add(warning, "tls", "connection to PostgreSQL is not encrypted",
+			"enable ssl on the server and use sslmode=verify-full")
+	default:
+		r.ok("tls", "connection encrypted with "+version)
+	}
+}
+
+func checkClock(ctx context.Context, r *report, conn *pgx.Conn) {
+	before := time.Now()
+	var dbNow time.Time
+	if err := conn.QueryRow(ctx, "SELECT clock_timestamp()").Scan(&dbNow); err != nil {
+		r.add(info, "clock", "cannot read the database clock: "+err.Error(), "")
+		return
+	}
+	// 以往返中点为本机时间，扣除网络延迟的影响
+	local := before.Add(time.Since(before) / 2)
+	skew := dbNow.Sub(local)
+	if skew.Abs() > maxClockSkew {
+		r.add(warning, "clock", fmt.Sprintf("database clock differs from this host by %v", skew.Round(time.Millisecond)),
+			"run NTP (chrony/systemd-timesyncd) on both hosts")
+		return
+	}
+	r.ok("clock", fmt.Sprintf("skew %v", skew.Round(time.Millisecond)))
+}
+
+// checkSchema 返回表结构是否完整，不完整时不再做依赖这些表的检查。
+func checkSchema(ctx context.Context, r *report, conn *pgx.Conn) bool {
+	complete := true
+	for _, t := range requiredTables {
+		rows, err := conn.Query(ctx,
+			"SELECT attname FROM pg_attribute WHERE attrelid = to_regclass($1) AND attnum > 0 AND NOT attisdropped", t.name)
+		if err != nil {
+			r.add(critical, "schema", "cannot inspect "+t.name+": "+err.Error(), "")
+			return false
+		}
+		cols, err := pgx.CollectRows(rows, pgx.RowTo[string])
+		if err != nil {
+			r.add(critical, "schema", "cannot inspect "+t.name+": "+err.Error(), "")
+			return false
+		}
+		if len(cols) == 0 {
+			r.add(critical, "schema", "table "+t.name+" not found in search_path",
+				"run ./build/migrate up, or set plugin_opt_pg_schema to the schema holding the tables")
+			complete = false
+			continue
+		}
+		var missing []string
+		for _, want := range t.columns {
+			found := false
+			for _, c := range cols {
+				found = found || c == want
+			}
+			if !found {
+				missing = append(missing, want)
+			}
+		}
+		if len(missing) > 0 {
+			r.add(critical, "schema", fmt.Sprintf("table %s is missing column(s) %s", t.name, strings.Join(missing, ", ")),
+				"compare with internal/migrations/sql/0001_core.up.sql")
+			complete = false
+			continue
+		}
+		var indexed bool
+		if err := conn.QueryRow(ctx, `SELECT EXISTS (
+			SELECT 1 FROM pg_index i
+			JOIN pg_attribute a ON a.attrelid = i.indrelid AND a.attnum = i.indkey[0]
+			WHERE i.indrelid = to_regclass($1) AND a.attname = $2)`, t.name, t.index).Scan(&indexed); err != nil {
+			r.add(info, "schema", "cannot inspect indexes on "+t.name+": "+err.Error(), "")
+			continue
+		}
+		if !indexed {
+			r.add(warning, "schema", fmt.Sprintf("no index on %s(%s); every lookup scans the table", t.name, t.index),
+				fmt.Sprintf("CREATE INDEX CONCURRENTLY ON %s(%s)", t.name, t.index))
+			continue
+		}
+		r.ok("schema", t.name)
+	}
+	return complete
+}
+
+func checkMigrations(ctx context.Context, r *report, conn *pgx.Conn) {
+	var tracked bool
+	if err := conn.QueryRow(ctx, "SELECT to_regclass('schema_migrations') IS NOT NULL").Scan(&tracked); err != nil || !tracked {
+		r.add(info, "schema", "schema is not managed by migrate (no schema_migrations table)",
+			"run ./build/migrate up once to adopt it; existing tables are kept")
+		return
+	}
+	var version int
+	if err := conn.QueryRow(ctx, migrations.VersionQuery).Scan(&version); err == nil && version > migrations.Latest() {
+		r.add(critical, "schema", fmt.Sprintf("database is at schema version %d, newer than this build (%d); the plugin refuses to start",
+			version, migrations.Latest()), "upgrade the plugin before migrating the database")
+		return
+	}
+	states, err := migrations.Status(ctx, conn)
+	if err != nil {
+		r.add(warning, "schema", "migration status: "+err.Error(), "")
+		return
+	}
+	var pending []string
+	for _, s := range states {
+		if !s.Applied() {
+			pending = append(pending, fmt.Sprintf("%04d_%s", s.Version, s.Name))
+		}
+	}
+	if len(pending) > 0 {
+		r.add(warning, "schema", "pending migrations: "+strings.Join(pending, ", "), "run ./build/migrate up")
+		return
+	}
+	r.ok("schema", "migrations up to date")
+}
+
+// hashCounts 按插件的校验方式对 password_hash 分类。
+type hashCounts struct {
+	bcrypt, weakBcrypt, sha256, mosquitto, unsupported, disabled int64
+}
+
+const hashQuery = `SELECT
+  count(*) FILTER (WHERE password_hash ~ '^\$2[aby]\$'),
+  count(*) FILTER (WHERE password_hash ~ '^\$2[aby]\$(0[4-9])\$'),
+  count(*) FILTER (WHERE password_hash ~ '^[0-9a-fA-F]{64}$'),
+  count(*) FILTER (WHERE password_hash ~ '^\$[67]\$'),
+  count(*) FILTER (WHERE password_hash !~ '^(\$2[aby]\$|\$[67]\$|[0-9a-fA-F]{64}$)'),
+  count(*) FILTER (WHERE enabled = 0)
+FROM iot_devices`
+
+func checkHashes(ctx context.Context, r *report, conn *pgx.Conn) {
+	var h hashCounts
+	if err := conn.QueryRow(ctx, hashQuery).Scan(&h.bcrypt, &h.weakBcrypt, &h.sha256, &h.mosquitto, &h.unsupported, &h.disabled); err != nil {
+		r.add(info, "hashes", "cannot classify password hashes: "+err.Error(), "")
+		return
+	}
+	hashFindings(r, h)
+}
+
+func hashFindings(r *report, h hashCounts) {
+	if h.unsupported > 0 {
+		r.add(critical, "hashes", fmt.Sprintf("%d user(s) have a password_hash the plugin cannot verify (not bcrypt, mosquitto $6$/$7$ or hex sha256); they can never log in", h.unsupported),
+			"reset them with ./build/useradm set-password")
+	}
+	if h.sha256 > 0 {
+		r.add(warning, "hashes", fmt.Sprintf("%d user(s) still use legacy sha256+salt hashes", h.sha256),
+			"re-hash with bcrypt (useradm set-password, or bcryptgen -algo bcrypt -dsn); track progress with weak_hash_logins")
+	}
+	if h.mosquitto > 0 {
+		r.add(warning, "hashes", fmt.Sprintf("%d user(s) use mosquitto password_file hashes ($6$/$7$) imported from files", h.mosquitto),
+			"re-hash with bcrypt; weak_hash_policy=reject denies these logins")
+	}
+	if h.weakBcrypt > 0 {
+		r.add(info, "hashes", fmt.Sprintf("%d bcrypt hash(es) use cost below 10", h.weakBcrypt),
+			"pick a cost with bcryptgen -calibrate and re-hash")
+	}
+	if h.unsupported == 0 && h.sha256 == 0 && h.mosquitto == 0 {
+		r.ok("hashes", fmt.Sprintf("%d bcrypt, %d disabled user(s)", h.bcrypt, h.disabled))
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheckConf(t *testing.T) {
+	dir := t.TempDir()
+	so := filepath.Join(dir, "mosq_pg_auth.so")
+	if err := os.WriteFile(so, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PG_DSN", "")
+	t.Setenv("PG_DSN_FILE", "")
+	conf := `# comment
+listener 1883
+plugin ` + so + `
+plugin_opt_pg_dsn postgres://u:secret@db/iot?sslmode=disable
+plugin_opt_timout_ms 500
+plugin_opt_listener_8883.fail_open_acl true
+plugin_opt_enforce_bind true
+plugin_opt_enforce_bind false
+plugin_opt_fail_open_auth true
+`
+	c, err := parseConf(strings.NewReader(conf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var r report
+	checkConf(&r, c, "mosquitto.conf")
+	var buf bytes.Buffer
+	r.write(&buf, false)
+	out := buf.String()
+	for _, want := range []string{
+		"line 5: unknown option plugin_opt_timout_ms is ignored",
+		"did you mean plugin_opt_timeout_ms?",
+		"plugin_opt_enforce_bind is set more than once",
+		"sslmode=disable",
+		"contains a password",
+		"fail_open_auth lets every client connect",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("report missing %q:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "listener_8883") || strings.Contains(out, "CRITICAL") {
+		t.Errorf("unexpected finding:\n%s", out)
+	}
+	if sev, any := r.worst(); !any || sev != warning {
+		t.Errorf("worst = %v, %v", sev, any)
+	}
+
+	// 没有 plugin 行也没有 DSN：两项 critical 排在最前
+	c, _ = parseConf(strings.NewReader("plugin_opt_strict_options true\nplugin_opt_bogus 1\n"))
+	r = report{}
+	checkConf(&r, c, "mosquitto.conf")
+	buf.Reset()
+	r.write(&buf, false)
+	lines := strings.Split(buf.String(), "\n")
+	if !strings.HasPrefix(lines[0], "1. [CRITICAL]") || !strings.Contains(buf.String(), "[CRITICAL] config: line 2: unknown option") {
+		t.Errorf("strict report:\n%s", buf.String())
+	}
+}
+
+func TestSSLMode(t *testing.T) {
+	t.Parallel()
+	tests := map[string]string{
+		"postgres://u@h/db?sslmode=verify-full":  "verify-full",
+		"postgresql://u@h/db":                    "",
+		"host=h user=u sslmode='require' dbname": "require",
+		"host=h user=u":                          "",
+	}
+	for dsn, want := range tests {
+		if got := sslMode(dsn); got != want {
+			t.Errorf("sslMode(%q) = %q, want %q", dsn, got, want)
+		}
+	}
+	if !dsnHasPassword("host=h password=x") || dsnHasPassword("postgres://u@h/db") {
+		t.Error("dsnHasPassword")
+	}
+}
+
+func TestHashFindings(t *testing.T) {
+	t.Parallel()
+	var r report
+	hashFindings(&r, hashCounts{bcrypt: 10, weakBcrypt: 2, sha256: 3, mosquitto: 4, unsupported: 1})
+	if len(r.findings) != 4 || r.findings[0].sev != critical {
+		t.Fatalf("findings = %+v", r.findings)
+	}
+	r = report{}
+	hashFindings(&r, hashCounts{bcrypt: 10})
+	if len(r.findings) != 0 || len(r.passed) != 1 {
+		t.Fatalf("clean counts: %+v", r)
+	}
+}
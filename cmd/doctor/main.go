@@ -0,0 +1,62 @@
+// doctor 检查一套 broker + 插件部署的常见问题：mosquitto.conf 里的插件选项、PostgreSQL
+// 连通性与 TLS、表结构与索引、在用的哈希格式和时钟偏差，并按严重程度输出修复清单。
+// 只读，不修改配置或数据库。
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+)
+
+func defaultConfig() string {
+	for _, p := range []string{"/mosquitto/config/mosquitto.conf", "/etc/mosquitto/mosquitto.conf"} {
+		if _, err := os.Stat(p); err == nil {
+			return p
+		}
+	}
+	return "mosquitto.conf"
+}
+
+func main() {
+	config := flag.String("config", defaultConfig(), "mosquitto.conf to check")
+	dsn := flag.String("dsn", "", "DSN to check instead of the one configured for the plugin")
+	timeout := flag.Duration("timeout", 15*time.Second, "overall timeout")
+	verbose := flag.Bool("v", false, "also list checks that passed")
+	flag.Parse()
+
+	var r report
+	conf := &mosqConf{opts: map[string]confOption{}}
+	if f, err := os.Open(*config); err != nil {
+		r.add(critical, "config", err.Error(), "pass the broker's config with -config")
+	} else {
+		conf, err = parseConf(f)
+		f.Close()
+		if err != nil {
+			r.add(critical, "config", "reading "+*config+": "+err.Error(), "")
+		}
+		checkConf(&r, conf, *config)
+	}
+
+	target := *dsn
+	if target == "" {
+		target, _, _ = conf.dsn()
+	}
+	if target != "" {
+		ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+		checkDB(ctx, &r, target, conf.opt("pg_schema"))
+		cancel()
+	}
+
+	r.write(os.Stdout, *verbose)
+	// 退出码：0 无问题或仅有建议，1 有 warning，2 有 critical
+	if sev, any := r.worst(); any && sev != info {
+		fmt.Fprintf(os.Stderr, "doctor: worst finding is %s\n", sev)
+		if sev == critical {
+			os.Exit(2)
+		}
+		os.Exit(1)
+	}
+}
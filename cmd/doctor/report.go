@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+)
+
+// 每项检查产出若干 finding；报告按严重程度排序，先修 critical。
+
+type severity int
+
+const (
+	critical severity = iota // 插件无法工作或存在安全问题
+	warning                  // 能工作，但会在负载或故障时出问题
+	info                     // 建议
+)
+
+func (s severity) String() string {
+	switch s {
+	case critical:
+		return "CRITICAL"
+	case warning:
+		return "WARNING"
+	}
+	return "INFO"
+}
+
+type finding struct {
+	sev     severity
+	check   string // 检查项，如 config / postgres / schema
+	problem string
+	fix     string
+}
+
+type report struct {
+	findings []finding
+	passed   []string // 通过的检查，-v 时输出
+}
+
+func (r *report) add(sev severity, check, problem, fix string) {
+	r.findings = append(r.findings, finding{sev, check, problem, fix})
+}
+
+func (r *report) ok(check, what string) {
+	r.passed = append(r.passed, check+": "+what)
+}
+
+func (r *report) worst() (severity, bool) {
+	if len(r.findings) == 0 {
+		return info, false
+	}
+	w := info
+	for _, f := range r.findings {
+		w = min(w, f.sev)
+	}
+	return w, true
+}
+
+func (r *report) write(w io.Writer, verbose bool) {
+	sort.SliceStable(r.findings, func(i, j int) bool { return r.findings[i].sev < r.findings[j].sev })
+	if verbose {
+		for _, p := range r.passed {
+			fmt.Fprintf(w, "ok        %s\n", p)
+		}
+	}
+	if len(r.findings) == 0 {
+		fmt.Fprintln(w, "no problems found")
+		return
+	}
+	for i, f := range r.findings {
+		fmt.Fprintf(w, "%d. [%s] %s: %s\n", i+1, f.sev, f.check, f.problem)
+		if f.fix != "" {
+			fmt.Fprintf(w, "   fix: %s\n", f.fix)
+		}
+	}
+}
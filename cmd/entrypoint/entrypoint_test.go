@@ -0,0 +1,83 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMosquittoArgs(t *testing.T) {
+	t.Parallel()
+	cases := []struct {
+		in   []string
+		want string
+	}{
+		{nil, "mosquitto -c /c.conf"},
+		{[]string{"mosquitto", "-v"}, "mosquitto -v -c /c.conf"},
+		{[]string{"/usr/sbin/mosquitto", "-c", "/other.conf"}, "/usr/sbin/mosquitto -c /other.conf"},
+		{[]string{"sh", "-c", "id"}, "sh -c id"},
+	}
+	for _, tc := range cases {
+		if got := strings.Join(mosquittoArgs(tc.in, "/c.conf"), " "); got != tc.want {
+			t.Errorf("mosquittoArgs(%q) = %q, want %q", tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestBuildConfig(t *testing.T) {
+	t.Parallel()
+	env := []string{
+		"MOSQUITTO_LISTENERS=1883,8883:tls",
+		"MOSQUITTO_TLS_CERTFILE=/tls/cert.pem", "MOSQUITTO_TLS_KEYFILE=/tls/key.pem",
+		"PLUGIN_OPT_PG_DSN_FILE=/run/secrets/dsn", "PLUGIN_OPT_TIMEOUT_MS=1000",
+	}
+	c, err := buildConfig(env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p := c.Validate(); len(p) > 0 {
+		t.Errorf("Validate = %q", p)
+	}
+	if len(c.Listeners) != 2 || !c.Listeners[1].TLS || c.Options["pg_dsn_file"] != "/run/secrets/dsn" {
+		t.Errorf("config = %+v", c)
+	}
+	if p := strings.Join(checkFiles(c), "; "); !strings.Contains(p, "TLS certificate") || !strings.Contains(p, "pg_dsn_file") {
+		t.Errorf("checkFiles = %q", p)
+	}
+
+	c, err = buildConfig([]string{"MOSQUITTO_LISTENERS=8883:tls"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p := strings.Join(c.Validate(), "; "); !strings.Contains(p, "certificate and a key") {
+		t.Errorf("TLS listener without files should fail, got %q", p)
+	}
+	if _, err := buildConfig([]string{"MOSQUITTO_TLS_REQUIRE_CERT=sometimes"}); err == nil {
+		t.Error("invalid MOSQUITTO_TLS_REQUIRE_CERT should fail")
+	}
+}
+
+func TestWriteConfigKeepsMountedFile(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	c, _ := buildConfig(nil)
+
+	path := filepath.Join(dir, "config", "mosquitto.conf")
+	if wrote, err := writeConfig(path, c); err != nil || !wrote {
+		t.Fatalf("writeConfig = %v, %v", wrote, err)
+	}
+	// 再次启动时覆盖自己生成的文件
+	if wrote, err := writeConfig(path, c); err != nil || !wrote {
+		t.Fatalf("regenerate = %v, %v", wrote, err)
+	}
+
+	mounted := filepath.Join(dir, "mounted.conf")
+	os.WriteFile(mounted, []byte("listener 1883\n"), 0o600)
+	if wrote, err := writeConfig(mounted, c); err != nil || wrote {
+		t.Fatalf("mounted file should be kept, got %v, %v", wrote, err)
+	}
+	if b, _ := os.ReadFile(mounted); string(b) != "listener 1883\n" {
+		t.Errorf("mounted file changed: %q", b)
+	}
+}
@@ -0,0 +1,194 @@
+// entrypoint 是 Docker 镜像的入口：根据环境变量生成 mosquitto.conf（监听端口、TLS 文件、插件选项），
+// 校验通过后 exec mosquitto，取代原来的 shell 脚本。校验失败时不启动 broker，以退出码 1 结束，
+// 让容器编排立即看到错误而不是带着无效配置运行。
+//
+// 环境变量：
+//   - MOSQUITTO_CONFIG          生成的配置路径（默认 /mosquitto/config/mosquitto.conf）
+//   - MOSQUITTO_LISTENERS       <port>[:tls|:ws|:wss]，逗号分隔（默认 1883）
+//   - MOSQUITTO_TLS_CERTFILE / MOSQUITTO_TLS_KEYFILE / MOSQUITTO_TLS_CAFILE / MOSQUITTO_TLS_REQUIRE_CERT
+//   - MOSQUITTO_PLUGIN          插件路径（默认 /mosquitto/plugins/auth-plugin）
+//   - PLUGIN_OPT_<NAME>         任意插件选项，如 PLUGIN_OPT_PG_DSN_FILE
+//
+// 已存在且不是生成的配置文件（用户挂载的）不会被覆盖，直接使用。
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"auth-plugin/internal/mosqconf"
+)
+
+const defaultConfig = "/mosquitto/config/mosquitto.conf"
+
+func logf(format string, args ...any) {
+	fmt.Fprintf(os.Stderr, "entrypoint: "+format+"\n", args...)
+}
+
+func getenv(environ []string, key, def string) string {
+	for i := len(environ) - 1; i >= 0; i-- {
+		if v, ok := strings.CutPrefix(environ[i], key+"="); ok {
+			return v
+		}
+	}
+	return def
+}
+
+func buildConfig(environ []string) (mosqconf.Config, error) {
+	c := mosqconf.Config{
+		Generator: "entrypoint",
+		Plugin:    getenv(environ, "MOSQUITTO_PLUGIN", mosqconf.DefaultPlugin),
+		Full:      true,
+		Options:   mosqconf.EnvOptions(environ),
+		TLS: mosqconf.TLS{
+			CertFile: getenv(environ, "MOSQUITTO_TLS_CERTFILE", ""),
+			KeyFile:  getenv(environ, "MOSQUITTO_TLS_KEYFILE", ""),
+			CAFile:   getenv(environ, "MOSQUITTO_TLS_CAFILE", ""),
+		},
+	}
+	if v := getenv(environ, "MOSQUITTO_TLS_REQUIRE_CERT", ""); v != "" {
+		var ok bool
+		if c.TLS.RequireCert, ok = mosqconf.ParseBool(v); !ok {
+			return c, fmt.Errorf("MOSQUITTO_TLS_REQUIRE_CERT=%q is not a boolean", v)
+		}
+	}
+	var err error
+	c.Listeners, err = mosqconf.ParseListeners([]string{getenv(environ, "MOSQUITTO_LISTENERS", "1883")})
+	if err == nil && len(c.Listeners) == 0 {
+		err = errors.New("MOSQUITTO_LISTENERS has no ports")
+	}
+	return c, err
+}
+
+// checkFiles 检查配置引用的文件在容器里确实存在，mosquitto 启动时才发现会更难排查。
+func checkFiles(c mosqconf.Config) []string {
+	var problems []string
+	for _, f := range []struct{ what, path string }{
+		{"plugin", c.Plugin},
+		{"TLS certificate", c.TLS.CertFile},
+		{"TLS key", c.TLS.KeyFile},
+		{"TLS CA", c.TLS.CAFile},
+		{"pg_dsn_file", c.Options["pg_dsn_file"]},
+		{"pg_password_file", c.Options["pg_password_file"]},
+	} {
+		if f.path == "" {
+			continue
+		}
+		if _, err := os.Stat(f.path); err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", f.what, err))
+		}
+	}
+	return problems
+}
+
+// writeConfig 生成配置；已有的非生成文件保持不动，返回 false。
+func writeConfig(path string, c mosqconf.Config) (bool, error) {
+	if old, err := os.ReadFile(path); err == nil && !mosqconf.IsGenerated(old) {
+		return false, nil
+	}
+	var b bytes.Buffer
+	if err := c.Render(&b); err != nil {
+		return false, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return false, err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, b.Bytes(), 0o640); err != nil {
+		return false, err
+	}
+	return true, os.Rename(tmp, path)
+}
+
+// mosquittoArgs 补全命令：未给参数时运行 mosquitto，运行 mosquitto 且未指定配置时加上 -c。
+func mosquittoArgs(args []string, config string) []string {
+	if len(args) == 0 {
+		args = []string{"mosquitto"}
+	}
+	if filepath.Base(args[0]) != "mosquitto" {
+		return args
+	}
+	for _, a := range args[1:] {
+		if a == "-c" || a == "--config-file" {
+			return args
+		}
+	}
+	return append(append([]string{}, args...), "-c", config)
+}
+
+// chownTree 与原 shell 入口一致：以 root 运行时把 /mosquitto 交给 mosquitto 用户。
+func chownTree(root string) error {
+	u, err := user.Lookup("mosquitto")
+	if err != nil {
+		return nil // 镜像里没有该用户时不处理
+	}
+	uid, _ := strconv.Atoi(u.Uid)
+	gid, _ := strconv.Atoi(u.Gid)
+	return filepath.WalkDir(root, func(p string, _ fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		return os.Lchown(p, uid, gid)
+	})
+}
+
+func main() {
+	environ := os.Environ()
+	path := getenv(environ, "MOSQUITTO_CONFIG", defaultConfig)
+	args := mosquittoArgs(os.Args[1:], path)
+
+	// 只有启动 mosquitto 时才生成配置，docker run image sh 之类的调试命令直接执行
+	if filepath.Base(args[0]) == "mosquitto" {
+		c, err := buildConfig(environ)
+		if err != nil {
+			logf("%v", err)
+			os.Exit(1)
+		}
+		problems := append(c.Validate(), checkFiles(c)...)
+		if len(problems) > 0 {
+			for _, p := range problems {
+				logf("error: %s", p)
+			}
+			os.Exit(1)
+		}
+		for _, w := range c.Warnings() {
+			logf("warning: %s", w)
+		}
+		wrote, err := writeConfig(path, c)
+		switch {
+		case err != nil:
+			logf("write %s: %v", path, err)
+			os.Exit(1)
+		case wrote:
+			logf("wrote %s", path)
+		default:
+			logf("using mounted %s as is", path)
+		}
+	}
+
+	if os.Getuid() == 0 {
+		if _, err := os.Stat("/mosquitto"); err == nil {
+			if err := chownTree("/mosquitto"); err != nil {
+				logf("chown /mosquitto: %v", err)
+			}
+		}
+	}
+	bin, err := exec.LookPath(args[0])
+	if err != nil {
+		logf("%v", err)
+		os.Exit(127)
+	}
+	if err := syscall.Exec(bin, args, environ); err != nil {
+		logf("exec %s: %v", bin, err)
+		os.Exit(126)
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"auth-plugin/internal/aclrule"
+)
+
+// dynamic-security 插件的 JSON：客户端密码为 PBKDF2-SHA512（password/salt 为 base64，另有 iterations），
+// 与 $7$ 哈希同源，可以直接转换；其他哈希无法转换，跳过并告警。
+// 每个用户的规则放进角色 "user:<name>"，'*' 规则放进所有客户端共享的角色 "global"；dynsec 同样支持 %u/%c。
+
+type dynsecConfig struct {
+	DefaultACLAccess dynsecDefaults `json:"defaultACLAccess"`
+	Clients          []dynsecClient `json:"clients"`
+	Groups           []struct{}     `json:"groups"`
+	Roles            []dynsecRole   `json:"roles"`
+}
+
+// 插件默认拒绝，导出的 dynsec 也只放行显式规则；取消订阅始终允许。
+type dynsecDefaults struct {
+	PublishClientSend    bool `json:"publishClientSend"`
+	PublishClientReceive bool `json:"publishClientReceive"`
+	Subscribe            bool `json:"subscribe"`
+	Unsubscribe          bool `json:"unsubscribe"`
+}
+
+type dynsecClient struct {
+	Username   string          `json:"username"`
+	Password   string          `json:"password"`
+	Salt       string          `json:"salt"`
+	Iterations int             `json:"iterations"`
+	Roles      []dynsecRoleRef `json:"roles"`
+}
+
+type dynsecRoleRef struct {
+	Rolename string `json:"rolename"`
+}
+
+type dynsecRole struct {
+	Rolename string      `json:"rolename"`
+	ACLs     []dynsecACL `json:"acls"`
+}
+
+type dynsecACL struct {
+	ACLType  string `json:"acltype"`
+	Topic    string `json:"topic"`
+	Priority int    `json:"priority"`
+	Allow    bool   `json:"allow"`
+}
+
+const globalRole = "global"
+
+// splitPBKDF2 拆开 $7$<iterations>$<salt>$<hash>。
+func splitPBKDF2(h string) (iter int, salt, hash string, ok bool) {
+	parts := strings.Split(h, "$")
+	if len(parts) != 5 || parts[1] != "7" {
+		return 0, "", "", false
+	}
+	iter, err := strconv.Atoi(parts[2])
+	return iter, parts[3], parts[4], err == nil && iter > 0
+}
+
+func dynsecACLs(r aclrule.Rule) []dynsecACL {
+	topic := strings.NewReplacer("{username}", "%u", "{clientid}", "%c").Replace(r.Pattern)
+	var out []dynsecACL
+	for _, m := range []struct {
+		bit  int
+		kind string
+	}{
+		{aclrule.Write, "publishClientSend"},
+		{aclrule.Read, "publishClientReceive"},
+		{aclrule.Subscribe, "subscribePattern"},
+	} {
+		if r.Acc&m.bit != 0 {
+			out = append(out, dynsecACL{ACLType: m.kind, Topic: topic, Allow: true})
+		}
+	}
+	return out
+}
+
+func buildDynsec(devices []device, rules []userRule, warn func(string)) dynsecConfig {
+	cfg := dynsecConfig{
+		DefaultACLAccess: dynsecDefaults{Unsubscribe: true},
+		Clients:          []dynsecClient{},
+		Groups:           []struct{}{},
+		Roles:            []dynsecRole{},
+	}
+	perUser := map[string][]dynsecACL{}
+	var global []dynsecACL
+	for _, r := range rules {
+		if r.username == "*" {
+			global = append(global, dynsecACLs(r.Rule)...)
+		} else {
+			perUser[r.username] = append(perUser[r.username], dynsecACLs(r.Rule)...)
+		}
+	}
+	if len(global) > 0 {
+		cfg.Roles = append(cfg.Roles, dynsecRole{Rolename: globalRole, ACLs: global})
+	}
+	for _, d := range devices {
+		if !d.enabled {
+			continue
+		}
+		iter, salt, hash, ok := splitPBKDF2(d.hash)
+		if !ok {
+			warn(fmt.Sprintf("dynsec: %s has a hash dynamic-security cannot use (only $7$ PBKDF2), skipped", d.username))
+			continue
+		}
+		c := dynsecClient{Username: d.username, Password: hash, Salt: salt, Iterations: iter, Roles: []dynsecRoleRef{}}
+		if acls := perUser[d.username]; len(acls) > 0 {
+			role := "user:" + d.username
+			cfg.Roles = append(cfg.Roles, dynsecRole{Rolename: role, ACLs: acls})
+			c.Roles = append(c.Roles, dynsecRoleRef{role})
+		}
+		if len(global) > 0 {
+			c.Roles = append(c.Roles, dynsecRoleRef{globalRole})
+		}
+		cfg.Clients = append(cfg.Clients, c)
+	}
+	return cfg
+}
+
+func writeDynsec(w io.Writer, cfg dynsecConfig) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "\t")
+	return enc.Encode(cfg)
+}
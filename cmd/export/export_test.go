@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"auth-plugin/internal/aclrule"
+)
+
+const mosq7 = "$7$101$MDEyMzQ1Njc4OWFi$EO/lLlkeUgIiBaS8G8UK0ZMP1u508TA7Tl+AdJ1cEsmlbGyEPAERErpfq84j1kepISs0UzmcdL4ucgZ2uodxfQ=="
+
+var testDevices = []device{
+	{username: "alice", hash: mosq7, enabled: true},
+	{username: "bob", hash: "$2a$04$abcdefghijklmnopqrstuuLnCFpb0SEv6VMgpiRM7SA7OvJ/1Ygpm", enabled: true},
+	{username: "carol", hash: mosq7, enabled: false},
+}
+
+func rule(user, pattern string, acc int) userRule {
+	return userRule{username: user, Rule: aclrule.Rule{Pattern: pattern, Acc: acc}}
+}
+
+var testRules = []userRule{
+	rule("*", "devices/{username}/{clientid}/#", aclrule.Read|aclrule.Subscribe),
+	rule("alice", "cmd/{username}", aclrule.Write),
+	rule("alice", "sessions/{clientid}", aclrule.Read),
+	rule("alice", "telemetry/#", aclrule.Read|aclrule.Write|aclrule.Subscribe),
+	rule("carol", "carol/#", aclrule.Read),
+}
+
+func TestWritePasswd(t *testing.T) {
+	t.Parallel()
+	var b bytes.Buffer
+	var warnings []string
+	n, err := writePasswd(&b, testDevices, false, func(s string) { warnings = append(warnings, s) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 || b.String() != "alice:"+mosq7+"\n" {
+		t.Fatalf("n = %d, output:\n%s", n, b.String())
+	}
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "bob") {
+		t.Errorf("warnings = %q", warnings)
+	}
+}
+
+func TestWritePasswdBcrypt(t *testing.T) {
+	t.Parallel()
+	var b bytes.Buffer
+	n, err := writePasswd(&b, testDevices, true, func(s string) { t.Errorf("unexpected warning %q", s) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 || !strings.Contains(b.String(), "\nbob:$2a$04$") {
+		t.Fatalf("n = %d, output:\n%s", n, b.String())
+	}
+}
+
+func TestWriteACL(t *testing.T) {
+	t.Parallel()
+	var b bytes.Buffer
+	var warnings []string
+	n, err := writeACL(&b, testRules, map[string]bool{"carol": true}, func(s string) { warnings = append(warnings, s) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `pattern read devices/%u/%c/#
+
+user alice
+topic write cmd/alice
+topic readwrite telemetry/#
+`
+	if n != 3 || b.String() != want {
+		t.Fatalf("n = %d, output:\n%s", n, b.String())
+	}
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "sessions/{clientid}") {
+		t.Errorf("warnings = %q", warnings)
+	}
+}
+
+func TestBuildDynsec(t *testing.T) {
+	t.Parallel()
+	var warnings []string
+	cfg := buildDynsec(testDevices, testRules, func(s string) { warnings = append(warnings, s) })
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "bob") {
+		t.Errorf("warnings = %q", warnings)
+	}
+	if len(cfg.Clients) != 1 {
+		t.Fatalf("clients = %+v", cfg.Clients)
+	}
+	c := cfg.Clients[0]
+	if c.Username != "alice" || c.Iterations != 101 || c.Salt != "MDEyMzQ1Njc4OWFi" || !strings.HasPrefix(c.Password, "EO/lLl") {
+		t.Errorf("client = %+v", c)
+	}
+	if len(c.Roles) != 2 || c.Roles[0].Rolename != "user:alice" || c.Roles[1].Rolename != globalRole {
+		t.Errorf("roles = %+v", c.Roles)
+	}
+	// carol 已停用，不导出其角色
+	if len(cfg.Roles) != 2 {
+		t.Fatalf("roles = %+v", cfg.Roles)
+	}
+	if g := cfg.Roles[0]; g.Rolename != globalRole || len(g.ACLs) != 2 || g.ACLs[0].Topic != "devices/%u/%c/#" {
+		t.Errorf("global role = %+v", g)
+	}
+	if acls := cfg.Roles[1].ACLs; len(acls) != 5 || acls[0].ACLType != "publishClientSend" || acls[0].Topic != "cmd/%u" {
+		t.Errorf("alice's acls = %+v", acls)
+	}
+
+	var b bytes.Buffer
+	if err := writeDynsec(&b, cfg); err != nil {
+		t.Fatal(err)
+	}
+	var back map[string]any
+	if err := json.Unmarshal(b.Bytes(), &back); err != nil {
+		t.Fatal(err)
+	}
+	if def := back["defaultACLAccess"].(map[string]any); def["publishClientSend"] != false || def["unsubscribe"] != true {
+		t.Errorf("defaultACLAccess = %v", def)
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"auth-plugin/internal/aclrule"
+)
+
+// password_file 只能写 mosquitto 自己能校验的哈希（$7$/$6$）；bcrypt 和 sha256 无法转换，跳过并告警。
+// -bcrypt 时 bcrypt 也写出：mosquitto 不认，但插件的 fallback_password_file 能校验。
+// acl_file：'*' 规则写成 pattern 行（{username}/{clientid} -> %u/%c），用户规则写在 user 段下的 topic 行，
+// {username} 直接替换为用户名；topic 行不支持 %c，含 {clientid} 的用户规则跳过。
+// mosquitto 的 read 同时允许订阅，acc 只有 read 或只有 subscribe 的规则都写成 read（权限会放宽）。
+
+type device struct {
+	username string
+	hash     string
+	enabled  bool
+}
+
+type userRule struct {
+	username string
+	aclrule.Rule
+}
+
+func mosquittoHash(h string) bool {
+	return strings.HasPrefix(h, "$7$") || strings.HasPrefix(h, "$6$")
+}
+
+func bcryptHash(h string) bool {
+	return strings.HasPrefix(h, "$2a$") || strings.HasPrefix(h, "$2b$") || strings.HasPrefix(h, "$2y$")
+}
+
+func writePasswd(w io.Writer, devices []device, withBcrypt bool, warn func(string)) (int, error) {
+	n := 0
+	for _, d := range devices {
+		switch {
+		case !d.enabled:
+			continue
+		case strings.Contains(d.username, ":"):
+			warn(fmt.Sprintf("password_file: %s contains ':', skipped", d.username))
+			continue
+		case withBcrypt && bcryptHash(d.hash):
+		case !mosquittoHash(d.hash):
+			warn(fmt.Sprintf("password_file: %s has a hash mosquitto cannot verify (only $7$/$6$), skipped", d.username))
+			continue
+		}
+		if _, err := fmt.Fprintf(w, "%s:%s\n", d.username, d.hash); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+func fileAccess(acc int) string {
+	read := acc&(aclrule.Read|aclrule.Subscribe) != 0
+	write := acc&aclrule.Write != 0
+	switch {
+	case read && write:
+		return "readwrite"
+	case write:
+		return "write"
+	case read:
+		return "read"
+	}
+	return ""
+}
+
+// writeACL 按 username 排序后的规则输出；disabled 为已停用的用户，其规则不导出。
+func writeACL(w io.Writer, rules []userRule, disabled map[string]bool, warn func(string)) (int, error) {
+	var b strings.Builder
+	n := 0
+	for _, r := range rules {
+		if r.username != "*" {
+			continue
+		}
+		access := fileAccess(r.Acc)
+		if access == "" {
+			continue
+		}
+		p := strings.NewReplacer("{username}", "%u", "{clientid}", "%c").Replace(r.Pattern)
+		fmt.Fprintf(&b, "pattern %s %s\n", access, p)
+		n++
+	}
+	current := ""
+	for _, r := range rules {
+		if r.username == "*" || disabled[r.username] {
+			continue
+		}
+		access := fileAccess(r.Acc)
+		if access == "" {
+			continue
+		}
+		if strings.Contains(r.Pattern, "{clientid}") {
+			warn(fmt.Sprintf("acl_file: %s %s uses {clientid}, which topic lines cannot express, skipped", r.username, r.Pattern))
+			continue
+		}
+		if r.username != current {
+			current = r.username
+			fmt.Fprintf(&b, "\nuser %s\n", r.username)
+		}
+		fmt.Fprintf(&b, "topic %s %s\n", access, strings.ReplaceAll(r.Pattern, "{username}", r.username))
+		n++
+	}
+	_, err := io.WriteString(w, b.String())
+	return n, err
+}
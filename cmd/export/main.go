@@ -0,0 +1,156 @@
+// export 是 import 的逆操作：把插件表中的用户和 ACL 导出为 mosquitto 的 password_file/acl_file
+// 或 dynamic-security JSON，供没有 PostgreSQL 的灾备 broker 使用。转换规则见 files.go 与 dynsec.go；
+// 无法表达的用户和规则跳过并在 stderr 告警。client_bindings 在文件格式中没有对应物，不导出。
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+func main() {
+	passwdFile := flag.String("passwd", "", "write a mosquitto password_file here (- for stdout)")
+	aclFile := flag.String("acl", "", "write a mosquitto acl_file here (- for stdout)")
+	withBcrypt := flag.Bool("bcrypt", false, "also write bcrypt hashes to -passwd (for the plugin's fallback_password_file; mosquitto cannot verify them)")
+	dynsecFile := flag.String("dynsec", "", "write a dynamic-security JSON config here (- for stdout)")
+	dsn := flag.String("dsn", os.Getenv("PG_DSN"), "PostgreSQL DSN (default $PG_DSN)")
+	flag.Parse()
+
+	if *passwdFile == "" && *aclFile == "" && *dynsecFile == "" {
+		fmt.Fprintln(os.Stderr, "export: give -passwd, -acl and/or -dynsec")
+		flag.Usage()
+		os.Exit(2)
+	}
+	if *dsn == "" {
+		fmt.Fprintln(os.Stderr, "export: -dsn or PG_DSN is required")
+		os.Exit(2)
+	}
+	warn := func(msg string) { fmt.Fprintln(os.Stderr, "warning:", msg) }
+
+	devices, rules, err := fetch(*dsn)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "export:", err)
+		os.Exit(1)
+	}
+	disabled := map[string]bool{}
+	for _, d := range devices {
+		if !d.enabled {
+			disabled[d.username] = true
+		}
+	}
+
+	if *passwdFile != "" {
+		var b bytes.Buffer
+		n, err := writePasswd(&b, devices, *withBcrypt, warn)
+		if err == nil {
+			err = writeOut(*passwdFile, b.Bytes())
+		}
+		exitOn(err)
+		fmt.Fprintf(os.Stderr, "password_file: %d user(s)\n", n)
+	}
+	if *aclFile != "" {
+		var b bytes.Buffer
+		n, err := writeACL(&b, rules, disabled, warn)
+		if err == nil {
+			err = writeOut(*aclFile, b.Bytes())
+		}
+		exitOn(err)
+		fmt.Fprintf(os.Stderr, "acl_file: %d rule(s)\n", n)
+	}
+	if *dynsecFile != "" {
+		cfg := buildDynsec(devices, rules, warn)
+		var b bytes.Buffer
+		err := writeDynsec(&b, cfg)
+		if err == nil {
+			err = writeOut(*dynsecFile, b.Bytes())
+		}
+		exitOn(err)
+		fmt.Fprintf(os.Stderr, "dynsec: %d client(s), %d role(s)\n", len(cfg.Clients), len(cfg.Roles))
+	}
+}
+
+func exitOn(err error) {
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "export:", err)
+		os.Exit(1)
+	}
+}
+
+// fetch 在一个只读事务中读取，保证用户和 ACL 来自同一快照。
+func fetch(dsn string) ([]device, []userRule, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+	conn, err := pgx.Connect(ctx, dsn)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer conn.Close(context.Background())
+
+	var devices []device
+	var rules []userRule
+	err = pgx.BeginTxFunc(ctx, conn, pgx.TxOptions{AccessMode: pgx.ReadOnly, IsoLevel: pgx.RepeatableRead}, func(tx pgx.Tx) error {
+		rows, err := tx.Query(ctx, `SELECT username, password_hash, enabled FROM iot_devices ORDER BY username`)
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			var d device
+			var enabled int16
+			if err := rows.Scan(&d.username, &d.hash, &enabled); err != nil {
+				return err
+			}
+			d.enabled = enabled != 0
+			devices = append(devices, d)
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		rows, err = tx.Query(ctx, `SELECT username, pattern, acc FROM acls ORDER BY username, pattern`)
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			var r userRule
+			if err := rows.Scan(&r.username, &r.Pattern, &r.Acc); err != nil {
+				return err
+			}
+			rules = append(rules, r)
+		}
+		return rows.Err()
+	})
+	return devices, rules, err
+}
+
+// writeOut 先写临时文件再 rename，broker 重载时不会读到写了一半的文件。
+func writeOut(path string, data []byte) error {
+	if path == "-" {
+		_, err := io.Copy(os.Stdout, bytes.NewReader(data))
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	// 文件中包含密码哈希，只允许属主读取
+	if err := tmp.Chmod(0o600); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestParseFlagsSources(t *testing.T) {
+	t.Parallel()
+	env := []string{"PLUGIN_OPT_TIMEOUT_MS=800", "PLUGIN_OPT_LOG_LEVEL=debug", "MOSQUITTO_LISTENERS=1883,8883", "HOME=/root"}
+	c, err := parseFlags([]string{"-timeout-ms", "1000", "-opt", "plugin_opt_log_level=warn", "-dsn-file", "/run/secrets/dsn"}, env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"timeout_ms": "1000", "log_level": "warn", "pg_dsn_file": "/run/secrets/dsn"}
+	if len(c.Options) != len(want) {
+		t.Fatalf("opts = %v, want %v", c.Options, want)
+	}
+	for k, v := range want {
+		if c.Options[k] != v {
+			t.Errorf("opts[%s] = %q, want %q", k, c.Options[k], v)
+		}
+	}
+	if len(c.Listeners) != 2 || c.Listeners[0].Port != 1883 || c.Listeners[1].Port != 8883 {
+		t.Errorf("listeners = %v", c.Listeners)
+	}
+
+	c, err = parseFlags([]string{"-full"}, nil)
+	if err != nil || len(c.Listeners) != 1 || c.Listeners[0].Port != 1883 {
+		t.Errorf("-full should default to listener 1883, got %v (%v)", c.Listeners, err)
+	}
+	for _, args := range [][]string{{"-opt", "novalue"}, {"-listener", "http"}, {"extra"}} {
+		if _, err := parseFlags(args, nil); err == nil {
+			t.Errorf("parseFlags(%q) should fail", args)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+// genconfig 根据参数和环境变量生成 mosquitto.conf 中的插件配置块（-full 时生成 Docker 镜像可直接使用的完整配置），
+// 并在 broker 启动前检查取值和组合是否有效；有问题时不输出任何内容，以退出码 1 结束。
+//
+// 选项来源按优先级从低到高：环境变量 PLUGIN_OPT_<NAME>（如 PLUGIN_OPT_TIMEOUT_MS），常用选项的专用参数，
+// -opt name=value。监听端口来自 -listener 或 MOSQUITTO_LISTENERS（逗号分隔）。生成与校验见 internal/mosqconf。
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"auth-plugin/internal/mosqconf"
+)
+
+// 常用选项的专用参数，未在命令行给出的不写入配置（由插件使用默认值）。
+var flagOptions = []struct{ flag, option, usage string }{
+	{"dsn", "pg_dsn", "PostgreSQL DSN (prefer -dsn-file; a password here ends up in mosquitto.conf)"},
+	{"dsn-file", "pg_dsn_file", "file containing the DSN"},
+	{"password-file", "pg_password_file", "file containing the PostgreSQL password"},
+	{"timeout-ms", "timeout_ms", "query timeout in milliseconds"},
+	{"fail-open-auth", "fail_open_auth", "allow CONNECT while the database is unavailable"},
+	{"acl-check", "acl_check", "check publish/subscribe against the acls table"},
+	{"fail-open-acl", "fail_open_acl", "allow publish/subscribe while the database is unavailable"},
+	{"grace-minutes", "auth_grace_minutes", "credential cache: admit recently verified clients while the database is down"},
+	{"enforce-bind", "enforce_bind", "require a client_bindings row"},
+	{"health-down-after", "health_down_after", "consecutive failures before the database is marked down"},
+	{"log-level", "log_level", "error, warn, info, debug or trace"},
+}
+
+type config struct {
+	mosqconf.Config
+	out string
+}
+
+type multiFlag []string
+
+func (m *multiFlag) String() string     { return strings.Join(*m, ",") }
+func (m *multiFlag) Set(v string) error { *m = append(*m, v); return nil }
+
+func parseFlags(args, environ []string) (config, error) {
+	c := config{Config: mosqconf.Config{Generator: "genconfig", Options: mosqconf.EnvOptions(environ)}}
+	fs := flag.NewFlagSet("genconfig", flag.ContinueOnError)
+	fs.StringVar(&c.Plugin, "plugin", mosqconf.DefaultPlugin, "path of the plugin shared object")
+	fs.BoolVar(&c.Full, "full", false, "emit a complete mosquitto.conf (listeners, persistence, logging) instead of only the plugin block")
+	fs.StringVar(&c.out, "o", "-", "output file")
+	fs.StringVar(&c.TLS.CertFile, "tls-cert", "", "server certificate for :tls/:wss listeners")
+	fs.StringVar(&c.TLS.KeyFile, "tls-key", "", "server key for :tls/:wss listeners")
+	fs.StringVar(&c.TLS.CAFile, "tls-ca", "", "CA file for client certificates")
+	fs.BoolVar(&c.TLS.RequireCert, "require-cert", false, "require client certificates on TLS listeners")
+	var listeners, extra multiFlag
+	fs.Var(&listeners, "listener", "listener <port>[:tls|:ws|:wss], repeatable or comma-separated (default $MOSQUITTO_LISTENERS, or 1883 with -full)")
+	fs.Var(&extra, "opt", "any plugin option as name=value (without plugin_opt_), repeatable")
+	typed := make(map[string]*string, len(flagOptions))
+	for _, f := range flagOptions {
+		typed[f.flag] = fs.String(f.flag, "", f.usage+" (plugin_opt_"+f.option+")")
+	}
+	if err := fs.Parse(args); err != nil {
+		return c, err
+	}
+	if fs.NArg() > 0 {
+		return c, fmt.Errorf("unexpected argument %q", fs.Arg(0))
+	}
+	fs.Visit(func(f *flag.Flag) {
+		for _, fo := range flagOptions {
+			if fo.flag == f.Name {
+				c.Options[fo.option] = *typed[f.Name]
+			}
+		}
+	})
+	for _, kv := range extra {
+		k, v, ok := strings.Cut(kv, "=")
+		if !ok {
+			return c, fmt.Errorf("-opt %q: want name=value", kv)
+		}
+		c.Options[strings.TrimPrefix(strings.TrimSpace(k), "plugin_opt_")] = v
+	}
+
+	if len(listeners) == 0 {
+		for _, kv := range environ {
+			if v, ok := strings.CutPrefix(kv, "MOSQUITTO_LISTENERS="); ok && v != "" {
+				listeners = multiFlag{v}
+			}
+		}
+	}
+	var err error
+	if c.Listeners, err = mosqconf.ParseListeners(listeners); err != nil {
+		return c, err
+	}
+	if c.Full && len(c.Listeners) == 0 {
+		c.Listeners = []mosqconf.Listener{{Port: 1883}}
+	}
+	return c, nil
+}
+
+func main() {
+	c, err := parseFlags(os.Args[1:], os.Environ())
+	if err != nil {
+		if !errors.Is(err, flag.ErrHelp) {
+			fmt.Fprintln(os.Stderr, "genconfig:", err)
+		}
+		os.Exit(2)
+	}
+	if problems := c.Validate(); len(problems) > 0 {
+		for _, p := range problems {
+			fmt.Fprintln(os.Stderr, "error:", p)
+		}
+		os.Exit(1)
+	}
+	for _, w := range c.Warnings() {
+		fmt.Fprintln(os.Stderr, "warning:", w)
+	}
+
+	out := io.Writer(os.Stdout)
+	if c.out != "-" {
+		f, err := os.OpenFile(c.out, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o640)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "genconfig:", err)
+			os.Exit(1)
+		}
+		defer f.Close()
+		out = f
+	}
+	if err := c.Render(out); err != nil {
+		fmt.Fprintln(os.Stderr, "genconfig:", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,166 @@
+// healthcheck 供 Docker HEALTHCHECK / Kubernetes exec 探针使用：连接本机 broker，
+// 订阅一个专用主题并发布一条随机消息，收到回环即说明 broker 与认证插件（CONNECT 认证、
+// PUBLISH/SUBSCRIBE ACL）都在工作；可选再 ping 一次 PostgreSQL。
+//
+// 退出码：0 健康，1 不健康（原因写到 stderr）。Docker 把 2 保留为其他含义，这里不使用。
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/jackc/pgx/v5"
+)
+
+type config struct {
+	broker   string
+	username string
+	password string
+	clientID string
+	topic    string
+	dsn      string
+	timeout  time.Duration
+}
+
+// envOr 让凭据可以走环境变量，避免出现在 docker inspect 的 HEALTHCHECK 命令行里。
+func envOr(key, def string) string {
+	if v, ok := os.LookupEnv(key); ok {
+		return v
+	}
+	return def
+}
+
+func randomSuffix() string {
+	b := make([]byte, 4)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func parseFlags(args []string) (config, error) {
+	var c config
+	fs := flag.NewFlagSet("healthcheck", flag.ContinueOnError)
+	fs.StringVar(&c.broker, "broker", envOr("HEALTHCHECK_BROKER", "tcp://127.0.0.1:1883"), "broker URL (env HEALTHCHECK_BROKER)")
+	fs.StringVar(&c.username, "username", envOr("HEALTHCHECK_USERNAME", ""), "MQTT username (env HEALTHCHECK_USERNAME)")
+	fs.StringVar(&c.password, "password", envOr("HEALTHCHECK_PASSWORD", ""), "MQTT password (env HEALTHCHECK_PASSWORD)")
+	fs.StringVar(&c.clientID, "clientid", "", "client id (default healthcheck-<random>)")
+	fs.StringVar(&c.topic, "topic", "", "round-trip topic (default healthcheck/<clientid>)")
+	fs.StringVar(&c.dsn, "dsn", envOr("HEALTHCHECK_PG_DSN", ""), "also ping PostgreSQL with this DSN (env HEALTHCHECK_PG_DSN)")
+	fs.DurationVar(&c.timeout, "timeout", 5*time.Second, "overall timeout")
+	if err := fs.Parse(args); err != nil {
+		return c, err
+	}
+	if fs.NArg() > 0 {
+		return c, fmt.Errorf("unexpected argument %q", fs.Arg(0))
+	}
+	if c.timeout <= 0 {
+		return c, errors.New("-timeout must be positive")
+	}
+	if c.clientID == "" {
+		c.clientID = "healthcheck-" + randomSuffix()
+	}
+	if c.topic == "" {
+		c.topic = "healthcheck/" + c.clientID
+	}
+	return c, nil
+}
+
+func main() {
+	c, err := parseFlags(os.Args[1:])
+	if err != nil {
+		if !errors.Is(err, flag.ErrHelp) {
+			fmt.Fprintln(os.Stderr, "healthcheck:", err)
+		}
+		os.Exit(1)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+
+	if err := checkMQTT(ctx, c); err != nil {
+		fmt.Fprintln(os.Stderr, "healthcheck: mqtt:", err)
+		os.Exit(1)
+	}
+	if c.dsn != "" {
+		if err := checkPG(ctx, c.dsn); err != nil {
+			fmt.Fprintln(os.Stderr, "healthcheck: postgres:", err)
+			os.Exit(1)
+		}
+	}
+}
+
+// wait 等待 paho token 完成，同时受 ctx 截止时间约束。
+func wait(ctx context.Context, what string, t mqtt.Token) error {
+	select {
+	case <-t.Done():
+		if err := t.Error(); err != nil {
+			return fmt.Errorf("%s: %w", what, err)
+		}
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("%s: %w", what, ctx.Err())
+	}
+}
+
+func checkMQTT(ctx context.Context, c config) error {
+	opts := mqtt.NewClientOptions().
+		AddBroker(c.broker).
+		SetClientID(c.clientID).
+		SetUsername(c.username).
+		SetPassword(c.password).
+		SetCleanSession(true).
+		SetAutoReconnect(false).
+		SetConnectRetry(false)
+	if dl, ok := ctx.Deadline(); ok {
+		opts.SetConnectTimeout(time.Until(dl))
+	}
+	client := mqtt.NewClient(opts)
+	if err := wait(ctx, "connect", client.Connect()); err != nil {
+		return err
+	}
+	defer client.Disconnect(100)
+
+	nonce := randomSuffix()
+	got := make(chan struct{}, 1)
+	sub := client.Subscribe(c.topic, 1, func(_ mqtt.Client, m mqtt.Message) {
+		if string(m.Payload()) == nonce {
+			select {
+			case got <- struct{}{}:
+			default:
+			}
+		}
+	})
+	if err := wait(ctx, "subscribe "+c.topic, sub); err != nil {
+		return err
+	}
+	// SUBACK 中的 0x80 表示 broker（插件 ACL）拒绝了订阅
+	if st, ok := sub.(*mqtt.SubscribeToken); ok {
+		if qos, ok := st.Result()[c.topic]; ok && qos == 0x80 {
+			return fmt.Errorf("subscribe %s: denied by broker", c.topic)
+		}
+	}
+	if err := wait(ctx, "publish "+c.topic, client.Publish(c.topic, 1, false, nonce)); err != nil {
+		return err
+	}
+	select {
+	case <-got:
+		return nil
+	case <-ctx.Done():
+		// 常见原因：用户没有该主题的 write 权限，broker 静默丢弃了消息
+		return fmt.Errorf("no round trip on %s: %w (check the user's read/write ACL)", c.topic, ctx.Err())
+	}
+}
+
+func checkPG(ctx context.Context, dsn string) error {
+	conn, err := pgx.Connect(ctx, dsn)
+	if err != nil {
+		return err
+	}
+	defer conn.Close(context.Background())
+	return conn.Ping(ctx)
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseFlags(t *testing.T) {
+	t.Setenv("HEALTHCHECK_USERNAME", "probe")
+	t.Setenv("HEALTHCHECK_PASSWORD", "secret")
+
+	c, err := parseFlags(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.username != "probe" || c.password != "secret" || c.broker != "tcp://127.0.0.1:1883" || c.timeout != 5*time.Second {
+		t.Fatalf("defaults = %+v", c)
+	}
+	if !strings.HasPrefix(c.clientID, "healthcheck-") || c.topic != "healthcheck/"+c.clientID {
+		t.Fatalf("clientID %q topic %q", c.clientID, c.topic)
+	}
+
+	c, err = parseFlags([]string{"-username", "other", "-clientid", "hc", "-topic", "probe/x"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.username != "other" || c.clientID != "hc" || c.topic != "probe/x" {
+		t.Fatalf("flags = %+v", c)
+	}
+
+	for _, bad := range [][]string{{"-timeout", "0s"}, {"extra"}, {"-nope"}} {
+		if _, err := parseFlags(bad); err == nil {
+			t.Errorf("parseFlags(%q) should fail", bad)
+		}
+	}
+}
@@ -0,0 +1,15 @@
+package main
+
+import (
+	"io"
+
+	"auth-plugin/internal/aclrule"
+)
+
+// acl_file 的解析与插件的 fallback_acl_file 共用，见 aclrule.ParseFile。
+
+type aclEntry = aclrule.FileRule
+
+func parseACLFile(r io.Reader, warn func(string)) ([]aclEntry, error) {
+	return aclrule.ParseFile(r, warn)
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"auth-plugin/internal/aclrule"
+)
+
+// mosquitto dynamic-security 插件的 JSON（dynamic-security.json）：
+//
+//   - 客户端密码是 PBKDF2-SHA512（password/salt 为 base64，另有 iterations），拼成 $7$ 哈希原样保留；
+//     没有密码的客户端无法用密码登录，跳过；disabled 的客户端导入为 enabled=0；
+//     设置了 clientid 的客户端写入 client_bindings（配合 enforce_bind）。
+//   - 客户端的角色加上所在组的角色展开成该用户自己的规则；插件没有组和角色，修改组需要重新导入。
+//   - publishClientSend → write，publishClientReceive → read，subscribePattern → subscribe；
+//     subscribeLiteral 不含通配符时同样是 subscribe，含通配符时只允许字面订阅，插件无法表达，跳过。
+//     unsubscribe* 规则忽略（插件总是允许取消订阅）。
+//   - 插件只有放行规则：deny 规则跳过并告警；defaultACLAccess 中默认允许的类型写成全局 '#' 规则。
+//   - anonymousGroup 对应匿名客户端，插件没有匿名访问，跳过。
+
+type dynsecInput struct {
+	DefaultACLAccess map[string]bool `json:"defaultACLAccess"`
+	Clients          []struct {
+		Username   string `json:"username"`
+		ClientID   string `json:"clientid"`
+		Password   string `json:"password"`
+		Salt       string `json:"salt"`
+		Iterations int    `json:"iterations"`
+		Disabled   bool   `json:"disabled"`
+		Roles      []struct {
+			Rolename string `json:"rolename"`
+		} `json:"roles"`
+		Groups []struct {
+			Groupname string `json:"groupname"`
+		} `json:"groups"`
+	} `json:"clients"`
+	Groups []struct {
+		Groupname string `json:"groupname"`
+		Roles     []struct {
+			Rolename string `json:"rolename"`
+		} `json:"roles"`
+	} `json:"groups"`
+	Roles []struct {
+		Rolename string `json:"rolename"`
+		ACLs     []struct {
+			ACLType string `json:"acltype"`
+			Topic   string `json:"topic"`
+			Allow   bool   `json:"allow"`
+		} `json:"acls"`
+	} `json:"roles"`
+	AnonymousGroup string `json:"anonymousGroup"`
+}
+
+type binding struct {
+	username, clientID string
+}
+
+var dynsecAccess = map[string]int{
+	"publishClientSend":    aclrule.Write,
+	"publishClientReceive": aclrule.Read,
+	"subscribePattern":     aclrule.Subscribe,
+	"subscribeLiteral":     aclrule.Subscribe,
+}
+
+// dynsecDefaults 是 defaultACLAccess 的各项；def 为 dynamic-security 的默认值，JSON 中缺省的项按它处理。
+var dynsecDefaults = []struct {
+	kind string
+	bit  int
+	def  bool
+}{
+	{"publishClientSend", aclrule.Write, false},
+	{"publishClientReceive", aclrule.Read, true},
+	{"subscribe", aclrule.Subscribe, false},
+}
+
+func parseDynsec(r io.Reader, warn func(string)) ([]account, []aclEntry, []binding, error) {
+	var in dynsecInput
+	if err := json.NewDecoder(r).Decode(&in); err != nil {
+		return nil, nil, nil, fmt.Errorf("dynsec: %w", err)
+	}
+	var rules []aclEntry
+	index := map[[2]string]int{}
+	add := func(username, pattern string, acc int) {
+		key := [2]string{username, pattern}
+		if i, dup := index[key]; dup {
+			rules[i].Acc |= acc
+			return
+		}
+		index[key] = len(rules)
+		rules = append(rules, aclEntry{Username: username, Rule: aclrule.Rule{Pattern: pattern, Acc: acc}})
+	}
+
+	// 默认允许的访问类型：插件默认拒绝，用全局 '#' 规则补上
+	defaults := 0
+	for _, d := range dynsecDefaults {
+		allow, ok := in.DefaultACLAccess[d.kind]
+		if !ok {
+			allow = d.def
+		}
+		if allow {
+			defaults |= d.bit
+		}
+	}
+	if defaults != 0 {
+		add("*", "#", defaults)
+		warn(fmt.Sprintf("dynsec: defaultACLAccess allows %s, stored as a global '#' rule", aclrule.FormatAcc(defaults)))
+	}
+
+	// 角色转换一次，客户端按角色名引用
+	roleRules := map[string][]aclrule.Rule{}
+	for _, role := range in.Roles {
+		roleRules[role.Rolename] = nil
+		perPattern := map[string]int{}
+		var order []string
+		for _, a := range role.ACLs {
+			where := fmt.Sprintf("dynsec role %s: %s %s", role.Rolename, a.ACLType, a.Topic)
+			if strings.HasPrefix(a.ACLType, "unsubscribe") {
+				if !a.Allow {
+					warn(where + ": unsubscribe deny ignored (the plugin always allows unsubscribing)")
+				}
+				continue
+			}
+			acc, ok := dynsecAccess[a.ACLType]
+			switch {
+			case !ok:
+				warn(where + ": unknown acltype, skipped")
+				continue
+			case !a.Allow:
+				warn(where + ": deny rules cannot be expressed in acls (access is allow-only), skipped")
+				continue
+			case a.ACLType == "subscribeLiteral" && strings.ContainsAny(a.Topic, "+#"):
+				warn(where + ": literal subscriptions to wildcard filters cannot be expressed, skipped")
+				continue
+			}
+			pattern := strings.NewReplacer("%u", "{username}", "%c", "{clientid}").Replace(a.Topic)
+			if err := aclrule.ValidatePattern(pattern); err != nil {
+				warn(fmt.Sprintf("%s: %v, skipped", where, err))
+				continue
+			}
+			if _, seen := perPattern[pattern]; !seen {
+				order = append(order, pattern)
+			}
+			perPattern[pattern] |= acc
+		}
+		for _, p := range order {
+			roleRules[role.Rolename] = append(roleRules[role.Rolename], aclrule.Rule{Pattern: p, Acc: perPattern[p]})
+		}
+	}
+	groupRoles := map[string][]string{}
+	for _, g := range in.Groups {
+		groupRoles[g.Groupname] = nil
+		for _, r := range g.Roles {
+			groupRoles[g.Groupname] = append(groupRoles[g.Groupname], r.Rolename)
+		}
+	}
+	if in.AnonymousGroup != "" {
+		warn(fmt.Sprintf("dynsec: anonymousGroup %s skipped (the plugin has no anonymous access)", in.AnonymousGroup))
+	}
+
+	var accounts []account
+	var bindings []binding
+	for i, c := range in.Clients {
+		if c.Username == "" {
+			warn(fmt.Sprintf("dynsec client %d: no username, skipped", i+1))
+			continue
+		}
+		if c.Password == "" || c.Salt == "" || c.Iterations <= 0 {
+			warn(fmt.Sprintf("dynsec client %s: no password, skipped (the plugin authenticates by password)", c.Username))
+			continue
+		}
+		accounts = append(accounts, account{
+			username: c.Username,
+			hash:     fmt.Sprintf("$7$%d$%s$%s", c.Iterations, c.Salt, c.Password),
+			disabled: c.Disabled,
+			line:     i + 1,
+		})
+		if c.ClientID != "" {
+			bindings = append(bindings, binding{c.Username, c.ClientID})
+		}
+		roles := map[string]bool{}
+		for _, r := range c.Roles {
+			roles[r.Rolename] = true
+		}
+		for _, g := range c.Groups {
+			if _, ok := groupRoles[g.Groupname]; !ok {
+				warn(fmt.Sprintf("dynsec client %s: unknown group %s", c.Username, g.Groupname))
+			}
+			for _, r := range groupRoles[g.Groupname] {
+				roles[r] = true
+			}
+		}
+		names := make([]string, 0, len(roles))
+		for r := range roles {
+			names = append(names, r)
+		}
+		sort.Strings(names)
+		for _, r := range names {
+			rs, ok := roleRules[r]
+			if !ok {
+				warn(fmt.Sprintf("dynsec client %s: unknown role %s", c.Username, r))
+			}
+			for _, rule := range rs {
+				add(c.Username, rule.Pattern, rule.Acc)
+			}
+		}
+	}
+	return accounts, rules, bindings, nil
+}
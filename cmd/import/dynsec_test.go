@@ -0,0 +1,75 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"auth-plugin/internal/aclrule"
+)
+
+func TestParseDynsec(t *testing.T) {
+	t.Parallel()
+	in := `{
+	"defaultACLAccess": {"publishClientSend": false, "subscribe": false, "unsubscribe": true},
+	"clients": [
+		{"username": "alice", "clientid": "alice-1", "password": "aGFzaA==", "salt": "c2FsdA==", "iterations": 101,
+		 "roles": [{"rolename": "writer"}], "groups": [{"groupname": "sensors"}]},
+		{"username": "bob", "password": "aGFzaA==", "salt": "c2FsdA==", "iterations": 101, "disabled": true,
+		 "groups": [{"groupname": "sensors"}, {"groupname": "nope"}]},
+		{"username": "certonly", "roles": [{"rolename": "writer"}]}
+	],
+	"groups": [{"groupname": "sensors", "roles": [{"rolename": "reader"}]}],
+	"roles": [
+		{"rolename": "writer", "acls": [
+			{"acltype": "publishClientSend", "topic": "cmd/%u/#", "allow": true},
+			{"acltype": "publishClientSend", "topic": "secret/#", "allow": false}
+		]},
+		{"rolename": "reader", "acls": [
+			{"acltype": "subscribePattern", "topic": "readings/#", "allow": true},
+			{"acltype": "publishClientReceive", "topic": "readings/#", "allow": true},
+			{"acltype": "subscribeLiteral", "topic": "literal/#", "allow": true},
+			{"acltype": "unsubscribePattern", "topic": "#", "allow": false}
+		]}
+	],
+	"anonymousGroup": "guests"
+}`
+	var warnings []string
+	accounts, rules, bindings, err := parseDynsec(strings.NewReader(in), func(s string) { warnings = append(warnings, s) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(accounts) != 2 || accounts[0].hash != "$7$101$c2FsdA==$aGFzaA==" || accounts[0].disabled || !accounts[1].disabled {
+		t.Fatalf("accounts = %+v", accounts)
+	}
+	if len(bindings) != 1 || bindings[0] != (binding{"alice", "alice-1"}) {
+		t.Errorf("bindings = %+v", bindings)
+	}
+	want := []aclEntry{
+		{Username: "*", Rule: aclrule.Rule{Pattern: "#", Acc: aclrule.Read}},
+		{Username: "alice", Rule: aclrule.Rule{Pattern: "readings/#", Acc: aclrule.Read | aclrule.Subscribe}},
+		{Username: "alice", Rule: aclrule.Rule{Pattern: "cmd/{username}/#", Acc: aclrule.Write}},
+		{Username: "bob", Rule: aclrule.Rule{Pattern: "readings/#", Acc: aclrule.Read | aclrule.Subscribe}},
+	}
+	if len(rules) != len(want) {
+		t.Fatalf("rules = %+v", rules)
+	}
+	for i := range want {
+		if rules[i] != want[i] {
+			t.Errorf("rule %d = %+v, want %+v", i, rules[i], want[i])
+		}
+	}
+	joined := strings.Join(warnings, "\n")
+	for _, want := range []string{
+		"defaultACLAccess allows read",
+		"publishClientSend secret/#: deny rules",
+		"subscribeLiteral literal/#: literal subscriptions",
+		"unsubscribe deny ignored",
+		"anonymousGroup guests skipped",
+		"bob: unknown group nope",
+		"certonly: no password",
+	} {
+		if !strings.Contains(joined, want) {
+			t.Errorf("missing warning %q in:\n%s", want, joined)
+		}
+	}
+}
@@ -0,0 +1,404 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"auth-plugin/internal/aclrule"
+)
+
+// EMQX 内置数据库与 SQL 认证/授权数据。输入可以是 JSON 或带表头的 CSV（按首个非空字符区分）：
+//
+//   用户：EMQX 5 内置数据库导出/导入格式 user_id,password_hash,salt,is_superuser（JSON 数组或 {"data": [...]}），
+//         或 SQL 表 mqtt_user 导出的 username,password_hash,salt,is_superuser。
+//   规则：EMQX 5 REST API /authorization/sources/built_in_database/rules/{users,clients,all} 的返回，
+//         EMQX 4 data export 中的 acl_mnesia，或 SQL 表 mqtt_acl 导出（EMQX 5 的 action/permission
+//         列或 EMQX 4 的 access/allow 列）。
+//
+// 哈希算法在 EMQX 中是认证器配置而不是每行数据，由 -emqx-hash 与 -emqx-salt-position 给出。
+// 插件能校验 bcrypt 和后缀加盐的 sha256（与 iot_devices.salt 的旧格式相同）；plain 用 bcrypt 重新哈希。
+//
+// 规则映射：publish → write，subscribe → read+subscribe（mosquitto 用 read 检查投递），all 为三者；
+// ${username}/${clientid}（EMQX 4 为 %u/%c）换成 {username}/{clientid}；$all 与 all 规则写入全局用户 '*'；
+// superuser 映射为该用户的 '#' 全部权限。插件只有按用户名的放行规则，因此 deny、按 clientid 或 IP 的规则、
+// 限定 qos/retain 的规则与 "eq " 精确匹配的主题都跳过并告警（放宽这些限制会扩大权限）。
+
+type emqxHash struct {
+	algo    string // plain、bcrypt、sha256
+	saltPos string // suffix、prefix、disable
+}
+
+func (h emqxHash) check() error {
+	switch h.algo {
+	case "plain", "bcrypt", "sha256":
+	default:
+		return fmt.Errorf("-emqx-hash %q: want plain, bcrypt or sha256 (the plugin cannot verify other EMQX algorithms)", h.algo)
+	}
+	switch h.saltPos {
+	case "suffix", "disable":
+	case "prefix":
+		if h.algo == "sha256" {
+			return fmt.Errorf("-emqx-salt-position prefix: the plugin verifies sha256(password+salt) only")
+		}
+	default:
+		return fmt.Errorf("-emqx-salt-position %q: want suffix, prefix or disable", h.saltPos)
+	}
+	return nil
+}
+
+// emqxRecord 是一条扁平化的记录，JSON 值统一转换成字符串。
+type emqxRecord struct {
+	where string
+	f     map[string]string
+}
+
+func (r emqxRecord) get(keys ...string) string {
+	for _, k := range keys {
+		if v, ok := r.f[k]; ok && v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// readEMQX 读取 JSON 或 CSV。lists 是 JSON 对象中依次尝试的数组字段，例如 "data"、"acl_mnesia"。
+func readEMQX(r io.Reader, what string, lists ...string) ([]emqxRecord, error) {
+	br := bufio.NewReader(r)
+	if b, _ := br.Peek(3); bytes.Equal(b, []byte("\xef\xbb\xbf")) { // Excel 导出的 CSV 带 BOM
+		br.Discard(3)
+	}
+	head, err := br.Peek(br.Size())
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return nil, err
+	}
+	head = bytes.TrimLeft(head, " \t\r\n")
+	if len(head) == 0 {
+		return nil, nil
+	}
+	if head[0] == '[' || head[0] == '{' {
+		return readEMQXJSON(br, what, lists)
+	}
+	return readEMQXCSV(br, what)
+}
+
+func readEMQXCSV(r io.Reader, what string) ([]emqxRecord, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", what, err)
+	}
+	for i, h := range header {
+		header[i] = strings.ToLower(strings.TrimSpace(h))
+	}
+	var out []emqxRecord
+	for {
+		row, err := cr.Read()
+		if err == io.EOF {
+			return out, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", what, err)
+		}
+		line, _ := cr.FieldPos(0)
+		rec := emqxRecord{where: fmt.Sprintf("%s line %d", what, line), f: map[string]string{}}
+		for i, v := range row {
+			if i < len(header) {
+				rec.f[header[i]] = strings.TrimSpace(v)
+			}
+		}
+		out = append(out, rec)
+	}
+}
+
+func readEMQXJSON(r io.Reader, what string, lists []string) ([]emqxRecord, error) {
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	var top any
+	if err := dec.Decode(&top); err != nil {
+		return nil, fmt.Errorf("%s: %w", what, err)
+	}
+	var items []any
+	global := false // EMQX 5 /rules/all 返回 {"rules": [...]}，规则不属于任何用户
+	switch v := top.(type) {
+	case []any:
+		items = v
+	case map[string]any:
+		found := false
+		for _, k := range lists {
+			if l, ok := v[k].([]any); ok {
+				items, found = l, true
+				global = k == "rules"
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("%s: no %s array in the JSON object", what, strings.Join(lists, " or "))
+		}
+	default:
+		return nil, fmt.Errorf("%s: want a JSON array or object", what)
+	}
+	var out []emqxRecord
+	for i, it := range items {
+		m, ok := it.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("%s entry %d: want a JSON object", what, i+1)
+		}
+		where := fmt.Sprintf("%s entry %d", what, i+1)
+		parent := flattenEMQX(m)
+		if global {
+			parent["username"] = "$all"
+		}
+		// /rules/users 与 /rules/clients 每项带一个 rules 数组，展开成多条记录
+		nested, ok := m["rules"].([]any)
+		if !ok {
+			out = append(out, emqxRecord{where: where, f: parent})
+			continue
+		}
+		for j, n := range nested {
+			nm, ok := n.(map[string]any)
+			if !ok {
+				return nil, fmt.Errorf("%s rule %d: want a JSON object", where, j+1)
+			}
+			f := flattenEMQX(nm)
+			for _, k := range []string{"username", "clientid"} {
+				if parent[k] != "" {
+					f[k] = parent[k]
+				}
+			}
+			out = append(out, emqxRecord{where: fmt.Sprintf("%s rule %d", where, j+1), f: f})
+		}
+	}
+	return out, nil
+}
+
+func flattenEMQX(m map[string]any) map[string]string {
+	f := map[string]string{}
+	for k, v := range m {
+		f[strings.ToLower(k)] = emqxString(v)
+	}
+	return f
+}
+
+func emqxString(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return strings.TrimSpace(v)
+	case bool:
+		return strconv.FormatBool(v)
+	case json.Number:
+		return v.String()
+	case []any:
+		parts := make([]string, len(v))
+		for i, e := range v {
+			parts[i] = emqxString(e)
+		}
+		return strings.Join(parts, ",")
+	}
+	return fmt.Sprint(v)
+}
+
+func emqxTrue(v string) bool {
+	b, err := strconv.ParseBool(v)
+	return err == nil && b
+}
+
+// parseEMQXUsers 返回账号，以及 superuser 对应的 '#' 规则。
+func parseEMQXUsers(r io.Reader, h emqxHash, cost int, warn func(string)) ([]account, []aclEntry, error) {
+	recs, err := readEMQX(r, "emqx users", "data", "auth_mnesia")
+	if err != nil {
+		return nil, nil, err
+	}
+	var out []account
+	var supers []aclEntry
+	seen := map[string]int{}
+	for n, rec := range recs {
+		if rec.f["login"] != "" {
+			// EMQX 4 auth_mnesia 存的是 base64(salt+sha256(salt+password))，前缀加盐，插件无法校验
+			warn(fmt.Sprintf("%s: EMQX 4 auth_mnesia hashes cannot be verified by the plugin, %s skipped (reset it with useradm set-password)", rec.where, rec.f["login"]))
+			continue
+		}
+		user := rec.get("user_id", "username")
+		hash := rec.get("password_hash", "password")
+		if user == "" || hash == "" {
+			warn(fmt.Sprintf("%s: want user_id and password_hash, skipped", rec.where))
+			continue
+		}
+		a := account{username: user, line: n + 1}
+		switch h.algo {
+		case "bcrypt":
+			if _, err := bcrypt.Cost([]byte(hash)); err != nil {
+				warn(fmt.Sprintf("%s: %s does not have a bcrypt hash, skipped", rec.where, user))
+				continue
+			}
+			a.hash = hash
+		case "sha256":
+			if b, err := hex.DecodeString(hash); err != nil || len(b) != 32 {
+				warn(fmt.Sprintf("%s: %s does not have a hex sha256 hash, skipped", rec.where, user))
+				continue
+			}
+			a.hash = strings.ToLower(hash)
+			if h.saltPos == "suffix" {
+				a.salt = rec.f["salt"]
+			}
+		case "plain":
+			b, err := bcrypt.GenerateFromPassword([]byte(hash), cost)
+			if err != nil {
+				return nil, nil, fmt.Errorf("%s: %w", rec.where, err)
+			}
+			a.hash = string(b)
+			warn(fmt.Sprintf("%s: %s had a plaintext password, stored as bcrypt", rec.where, user))
+		}
+		if i, dup := seen[user]; dup {
+			warn(fmt.Sprintf("%s: %s repeats an earlier entry, the later entry wins", rec.where, user))
+			out[i] = a
+		} else {
+			seen[user] = len(out)
+			out = append(out, a)
+		}
+		if emqxTrue(rec.f["is_superuser"]) {
+			supers = append(supers, aclEntry{Username: user, Rule: aclrule.Rule{Pattern: "#", Acc: aclrule.StoredAccess}})
+		}
+	}
+	if len(supers) > 0 {
+		warn(fmt.Sprintf("%d superuser(s) get a '#' rule with all access", len(supers)))
+	}
+	return out, supers, nil
+}
+
+var emqxPlaceholders = strings.NewReplacer(
+	"${username}", "{username}", "${clientid}", "{clientid}",
+	"%u", "{username}", "%c", "{clientid}",
+)
+
+// emqxAccess 接受 EMQX 5 的 action 与 EMQX 4 的 access（1 subscribe、2 publish、3 pubsub）。
+func emqxAccess(v string) (int, bool) {
+	switch strings.ToLower(v) {
+	case "publish", "pub", "2":
+		return aclrule.Write, true
+	case "subscribe", "sub", "1":
+		return aclrule.Read | aclrule.Subscribe, true
+	case "all", "pubsub", "3":
+		return aclrule.StoredAccess, true
+	}
+	return 0, false
+}
+
+// emqxAllow 接受 EMQX 5 的 permission 与 EMQX 4 的 allow（1/true 放行、0/false 拒绝）。
+func emqxAllow(rec emqxRecord) (allow, ok bool) {
+	if p := rec.f["permission"]; p != "" {
+		switch strings.ToLower(p) {
+		case "allow":
+			return true, true
+		case "deny":
+			return false, true
+		}
+		return false, false
+	}
+	v := rec.f["allow"]
+	if v == "" {
+		return true, true
+	}
+	b, err := strconv.ParseBool(v)
+	return b, err == nil
+}
+
+// emqxRestricted 判断 qos/retain 是否限制了规则；缺省或覆盖全部取值时不算限制。
+func emqxRestricted(rec emqxRecord) bool {
+	if q := rec.f["qos"]; q != "" {
+		have := map[string]bool{}
+		for _, s := range strings.Split(q, ",") {
+			have[strings.TrimSpace(s)] = true
+		}
+		if !have["0"] || !have["1"] || !have["2"] {
+			return true
+		}
+	}
+	switch strings.ToLower(rec.f["retain"]) {
+	case "", "all":
+		return false
+	}
+	return true
+}
+
+func parseEMQXACL(r io.Reader, warn func(string)) ([]aclEntry, error) {
+	recs, err := readEMQX(r, "emqx acl", "data", "rules", "acl_mnesia")
+	if err != nil {
+		return nil, err
+	}
+	var out []aclEntry
+	index := map[[2]string]int{}
+	for _, rec := range recs {
+		username, clientID := rec.get("username"), rec.get("clientid")
+		if login := rec.f["login"]; login != "" { // EMQX 4 acl_mnesia
+			switch rec.f["type"] {
+			case "username":
+				username = login
+			case "clientid":
+				clientID = login
+			}
+		}
+		if rec.f["type"] == "$all" || username == "$all" {
+			username = "*"
+		}
+		topic := rec.f["topic"]
+		acc, accOK := emqxAccess(rec.get("action", "access"))
+		allow, allowOK := emqxAllow(rec)
+		switch {
+		case topic == "":
+			warn(fmt.Sprintf("%s: no topic, skipped", rec.where))
+			continue
+		case !accOK:
+			warn(fmt.Sprintf("%s: unknown action %q, skipped", rec.where, rec.get("action", "access")))
+			continue
+		case !allowOK:
+			warn(fmt.Sprintf("%s: unknown permission, skipped", rec.where))
+			continue
+		case !allow:
+			warn(fmt.Sprintf("%s: deny rules cannot be expressed in acls (access is allow-only), skipped", rec.where))
+			continue
+		case rec.get("ipaddress", "ipaddr", "peerhost") != "":
+			warn(fmt.Sprintf("%s: rules limited to an IP address cannot be expressed, skipped", rec.where))
+			continue
+		case username == "" && clientID != "":
+			warn(fmt.Sprintf("%s: rule for client ID %s skipped (acls are keyed by username)", rec.where, clientID))
+			continue
+		case username == "":
+			warn(fmt.Sprintf("%s: rule without a username, skipped", rec.where))
+			continue
+		case emqxRestricted(rec):
+			warn(fmt.Sprintf("%s: rules limited by qos or retain cannot be expressed, skipped", rec.where))
+			continue
+		case strings.HasPrefix(topic, "eq "):
+			warn(fmt.Sprintf("%s: 'eq' topics match wildcards literally and cannot be expressed, skipped", rec.where))
+			continue
+		}
+		if clientID != "" {
+			warn(fmt.Sprintf("%s: client ID %s dropped, the rule applies to every client of %s", rec.where, clientID, username))
+		}
+		pattern := emqxPlaceholders.Replace(topic)
+		if err := aclrule.ValidatePattern(pattern); err != nil {
+			warn(fmt.Sprintf("%s: %v, skipped", rec.where, err))
+			continue
+		}
+		key := [2]string{username, pattern}
+		if i, dup := index[key]; dup {
+			out[i].Acc |= acc
+			continue
+		}
+		index[key] = len(out)
+		out = append(out, aclEntry{Username: username, Rule: aclrule.Rule{Pattern: pattern, Acc: acc}})
+	}
+	return out, nil
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"auth-plugin/internal/aclrule"
+)
+
+func TestParseEMQXUsers(t *testing.T) {
+	t.Parallel()
+	sum := sha256.Sum256([]byte("secret" + "pepper"))
+	hash := hex.EncodeToString(sum[:])
+	in := `{"data": [
+  {"user_id": "alice", "password_hash": "` + strings.ToUpper(hash) + `", "salt": "pepper", "is_superuser": false},
+  {"user_id": "root", "password_hash": "` + hash + `", "salt": "pepper", "is_superuser": true},
+  {"user_id": "bob", "password_hash": "not-hex", "salt": "x"},
+  {"password_hash": "` + hash + `"},
+  {"login": "old", "type": "username", "password": "c2FsdGhhc2g="}
+], "meta": {"page": 1}}`
+	var warnings []string
+	got, supers, err := parseEMQXUsers(strings.NewReader(in), emqxHash{"sha256", "suffix"}, bcrypt.MinCost, func(s string) { warnings = append(warnings, s) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0].username != "alice" || got[1].username != "root" {
+		t.Fatalf("accounts = %+v", got)
+	}
+	if got[0].hash != hash || got[0].salt != "pepper" {
+		t.Errorf("alice = %+v, want lower-case hash with salt", got[0])
+	}
+	if len(supers) != 1 || supers[0].Username != "root" || supers[0].Pattern != "#" || supers[0].Acc != aclrule.StoredAccess {
+		t.Errorf("superuser rules = %+v", supers)
+	}
+	joined := strings.Join(warnings, "\n")
+	for _, want := range []string{"entry 3: bob does not have a hex sha256", "entry 4: want user_id", "entry 5: EMQX 4 auth_mnesia", "1 superuser(s)"} {
+		if !strings.Contains(joined, want) {
+			t.Errorf("missing warning %q in:\n%s", want, joined)
+		}
+	}
+}
+
+func TestParseEMQXUsersCSV(t *testing.T) {
+	t.Parallel()
+	in := "\xef\xbb\xbfusername,password_hash,salt,is_superuser\r\n" +
+		"carol,plain-secret,,0\r\n" +
+		"dave,other,,1\r\n"
+	got, supers, err := parseEMQXUsers(strings.NewReader(in), emqxHash{"plain", "disable"}, bcrypt.MinCost, func(string) {})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || bcrypt.CompareHashAndPassword([]byte(got[0].hash), []byte("plain-secret")) != nil {
+		t.Fatalf("accounts = %+v", got)
+	}
+	if len(supers) != 1 || supers[0].Username != "dave" {
+		t.Errorf("superuser rules = %+v", supers)
+	}
+}
+
+func TestEMQXHashCheck(t *testing.T) {
+	t.Parallel()
+	for _, tc := range []struct {
+		h  emqxHash
+		ok bool
+	}{
+		{emqxHash{"sha256", "suffix"}, true},
+		{emqxHash{"bcrypt", "prefix"}, true},
+		{emqxHash{"plain", "disable"}, true},
+		{emqxHash{"sha256", "prefix"}, false},
+		{emqxHash{"md5", "suffix"}, false},
+		{emqxHash{"sha256", "middle"}, false},
+	} {
+		if err := tc.h.check(); (err == nil) != tc.ok {
+			t.Errorf("%+v: err = %v", tc.h, err)
+		}
+	}
+}
+
+func TestParseEMQXACL(t *testing.T) {
+	t.Parallel()
+	rw := aclrule.StoredAccess
+	sub := aclrule.Read | aclrule.Subscribe
+	for _, tc := range []struct {
+		name, in string
+		want     []aclEntry
+		warnings []string
+	}{
+		{
+			name: "rules/users",
+			in: `{"data": [{"username": "alice", "rules": [
+  {"topic": "t/${username}/#", "action": "publish", "permission": "allow", "qos": [0, 1, 2], "retain": "all"},
+  {"topic": "t/${username}/#", "action": "subscribe", "permission": "allow"},
+  {"topic": "secret/#", "action": "all", "permission": "deny"},
+  {"topic": "q0/#", "action": "publish", "permission": "allow", "qos": [0]},
+  {"topic": "eq cmd/#", "action": "subscribe", "permission": "allow"}
+]}], "meta": {}}`,
+			want:     []aclEntry{{Username: "alice", Rule: aclrule.Rule{Pattern: "t/{username}/#", Acc: rw}}},
+			warnings: []string{"entry 1 rule 3: deny rules", "entry 1 rule 4: rules limited by qos", "entry 1 rule 5: 'eq' topics"},
+		},
+		{
+			name:     "rules/all",
+			in:       `{"rules": [{"topic": "${clientid}/status", "action": "publish", "permission": "allow"}]}`,
+			want:     []aclEntry{{Username: "*", Rule: aclrule.Rule{Pattern: "{clientid}/status", Acc: aclrule.Write}}},
+			warnings: nil,
+		},
+		{
+			name:     "rules/clients",
+			in:       `{"data": [{"clientid": "c1", "rules": [{"topic": "x", "action": "all", "permission": "allow"}]}]}`,
+			warnings: []string{"rule for client ID c1 skipped"},
+		},
+		{
+			name: "acl_mnesia",
+			in: `{"version": "4.3", "acl_mnesia": [
+  {"login": "bob", "type": "username", "topic": "a/%c", "action": "pubsub", "allow": true},
+  {"type": "$all", "topic": "pub/#", "action": "sub", "allow": true}
+]}`,
+			want: []aclEntry{
+				{Username: "bob", Rule: aclrule.Rule{Pattern: "a/{clientid}", Acc: rw}},
+				{Username: "*", Rule: aclrule.Rule{Pattern: "pub/#", Acc: sub}},
+			},
+		},
+		{
+			name: "mqtt_acl csv",
+			in: "allow,ipaddr,username,clientid,access,topic\n" +
+				"1,,$all,,1,$SYS/#\n" +
+				"1,127.0.0.1,,,2,#\n" +
+				"1,,carol,,2,cmd/bad/#/x\n" +
+				"0,,carol,,3,x\n",
+			want:     []aclEntry{{Username: "*", Rule: aclrule.Rule{Pattern: "$SYS/#", Acc: sub}}},
+			warnings: []string{"line 3: rules limited to an IP", "line 4: '#' must be", "line 5: deny rules"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var warnings []string
+			got, err := parseEMQXACL(strings.NewReader(tc.in), func(s string) { warnings = append(warnings, s) })
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != len(tc.want) {
+				t.Fatalf("rules = %+v, want %+v", got, tc.want)
+			}
+			for i := range tc.want {
+				if got[i] != tc.want[i] {
+					t.Errorf("rule %d = %+v, want %+v", i, got[i], tc.want[i])
+				}
+			}
+			joined := strings.Join(warnings, "\n")
+			for _, want := range tc.warnings {
+				if !strings.Contains(joined, want) {
+					t.Errorf("missing warning %q in:\n%s", want, joined)
+				}
+			}
+		})
+	}
+}
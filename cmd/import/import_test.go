@@ -0,0 +1,90 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"auth-plugin/internal/aclrule"
+)
+
+func TestParsePasswd(t *testing.T) {
+	t.Parallel()
+	in := `# mosquitto password file
+alice:$7$101$MDEyMzQ1Njc4OWFi$EO/lLlkeUgIiBaS8G8UK0ZMP1u508TA7Tl+AdJ1cEsmlbGyEPAERErpfq84j1kepISs0UzmcdL4ucgZ2uodxfQ==
+bob:$6$MDEyMzQ1Njc4OWFi$qEXipeLbgxRlwd06QHfY5WITkUZg0jLg9SZbXzq3ifXjfj+v3GbJGrSfC5PAg3UNCS+UFfbhUIZX4bmIAs330w==
+carol:plain-secret
+dave:$argon2id$v=19$m=64,t=1,p=1$c2FsdA$aGFzaA
+broken line
+alice:$2a$04$abcdefghijklmnopqrstuuLnCFpb0SEv6VMgpiRM7SA7OvJ/1Ygpm
+erin:$5$saltstring$5B8vYYiY.CVt1RlTTf8KbXBH3hsxY/GNooZaBBGWEc5
+`
+	var warnings []string
+	got, err := parsePasswd(strings.NewReader(in), bcrypt.MinCost, func(s string) { warnings = append(warnings, s) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 4 || got[0].username != "alice" || got[1].username != "bob" || got[2].username != "carol" || got[3].username != "erin" {
+		t.Fatalf("accounts = %+v", got)
+	}
+	if !strings.HasPrefix(got[0].hash, "$2a$04$") {
+		t.Errorf("later alice entry should win, got %q", got[0].hash)
+	}
+	if !strings.HasPrefix(got[1].hash, "$6$") {
+		t.Errorf("bob's $6$ hash should be kept, got %q", got[1].hash)
+	}
+	if bcrypt.CompareHashAndPassword([]byte(got[2].hash), []byte("plain-secret")) != nil {
+		t.Errorf("carol's plaintext password should be bcrypt-hashed, got %q", got[2].hash)
+	}
+	joined := strings.Join(warnings, "\n")
+	for _, want := range []string{"line 4: carol had a plaintext", "line 5: dave has an unsupported", "line 6: want username:hash", "line 7: alice repeats line 2"} {
+		if !strings.Contains(joined, want) {
+			t.Errorf("missing warning %q in:\n%s", want, joined)
+		}
+	}
+}
+
+func TestParseACLFile(t *testing.T) {
+	t.Parallel()
+	in := `topic read $SYS/#
+pattern readwrite devices/%u/%c/#
+
+user alice
+topic write cmd/alice
+topic cmd/alice
+topic read readings/with space
+topic deny secret/#
+topic read bad/#/x
+
+user bob
+topic readings
+frobnicate x
+`
+	var warnings []string
+	got, err := parseACLFile(strings.NewReader(in), func(s string) { warnings = append(warnings, s) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	rw := aclrule.Read | aclrule.Write | aclrule.Subscribe
+	want := []aclEntry{
+		{Username: "*", Rule: aclrule.Rule{Pattern: "devices/{username}/{clientid}/#", Acc: rw}},
+		{Username: "alice", Rule: aclrule.Rule{Pattern: "cmd/alice", Acc: rw}},
+		{Username: "alice", Rule: aclrule.Rule{Pattern: "readings/with space", Acc: aclrule.Read | aclrule.Subscribe}},
+		{Username: "bob", Rule: aclrule.Rule{Pattern: "readings", Acc: rw}},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("rules = %+v", got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("rule %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+	joined := strings.Join(warnings, "\n")
+	for _, want := range []string{"line 1: topic rule for anonymous", "line 8: deny rules", "line 9: '#' must be", `line 13: unknown keyword "frobnicate"`} {
+		if !strings.Contains(joined, want) {
+			t.Errorf("missing warning %q in:\n%s", want, joined)
+		}
+	}
+}
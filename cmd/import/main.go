@@ -0,0 +1,245 @@
+// import 把 mosquitto 的 password_file、acl_file 和 dynamic-security JSON、VerneMQ 的 vmq_acl，
+// EMQX 的内置数据库/SQL 用户与规则，或 Linux 的 /etc/shadow 导入插件的表，
+// 便于从文件认证、dynsec、VerneMQ、EMQX 或设备本地账号迁移。
+// 解析规则见 passwd.go、aclfile.go、dynsec.go、vmq.go、emqx.go 与 shadow.go；无法表达的行跳过并在 stderr 告警。
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	insertAccount = `INSERT INTO iot_devices (username, password_hash, salt, enabled)
+VALUES ($1, $2, $3, $4) ON CONFLICT (username) DO NOTHING`
+	upsertAccount = `INSERT INTO iot_devices (username, password_hash, salt, enabled)
+VALUES ($1, $2, $3, $4) ON CONFLICT (username) DO UPDATE SET password_hash = EXCLUDED.password_hash, salt = EXCLUDED.salt`
+	// 已有规则与文件中的权限取并集，重复导入不会收窄权限
+	mergeACL = `INSERT INTO acls (username, pattern, acc) VALUES ($1, $2, $3)
+ON CONFLICT (username, pattern) DO UPDATE SET acc = acls.acc | EXCLUDED.acc`
+	insertBinding = `INSERT INTO client_bindings (username, client_id) VALUES ($1, $2) ON CONFLICT DO NOTHING`
+)
+
+type summary struct {
+	users, usersSkipped, acls, bindings int
+}
+
+func main() {
+	passwdFile := flag.String("passwd", "", "mosquitto password_file to import")
+	aclFile := flag.String("acl", "", "mosquitto acl_file to import")
+	shadowFile := flag.String("shadow", "", "Linux shadow file to import (SHA-crypt and bcrypt hashes are kept)")
+	dynsecFile := flag.String("dynsec", "", "mosquitto dynamic-security JSON to import (clients, groups, roles)")
+	vmqACL := flag.String("vmq-acl", "", "VerneMQ vmq_acl file to import")
+	reportFile := flag.String("report", "", "write the vmq_acl conversion report to this file ('-' for stdout)")
+	emqxUsers := flag.String("emqx-users", "", "EMQX built-in database or mqtt_user export (JSON or CSV) to import")
+	emqxACL := flag.String("emqx-acl", "", "EMQX authorization rules or mqtt_acl export (JSON or CSV) to import")
+	var h emqxHash
+	flag.StringVar(&h.algo, "emqx-hash", "sha256", "password_hash_algorithm of the EMQX authenticator: plain, bcrypt or sha256")
+	flag.StringVar(&h.saltPos, "emqx-salt-position", "suffix", "salt_position of the EMQX authenticator: suffix, prefix or disable")
+	dsn := flag.String("dsn", os.Getenv("PG_DSN"), "PostgreSQL DSN (default $PG_DSN)")
+	overwrite := flag.Bool("overwrite", false, "replace password hashes of users that already exist (default: keep them)")
+	cost := flag.Int("cost", bcrypt.DefaultCost, "bcrypt cost for plaintext passwords")
+	dryRun := flag.Bool("dry-run", false, "parse and report without writing to the database")
+	flag.Parse()
+
+	if *passwdFile == "" && *aclFile == "" && *dynsecFile == "" && *vmqACL == "" && *emqxUsers == "" && *emqxACL == "" && *shadowFile == "" {
+		fmt.Fprintln(os.Stderr, "import: give -passwd and/or -acl, -shadow, -dynsec, -vmq-acl, or -emqx-users and/or -emqx-acl")
+		flag.Usage()
+		os.Exit(2)
+	}
+	if *emqxUsers != "" {
+		if err := h.check(); err != nil {
+			fmt.Fprintln(os.Stderr, "import:", err)
+			os.Exit(2)
+		}
+	}
+	if *dsn == "" && !*dryRun {
+		fmt.Fprintln(os.Stderr, "import: -dsn or PG_DSN is required (or use -dry-run)")
+		os.Exit(2)
+	}
+	warn := func(msg string) { fmt.Fprintln(os.Stderr, "warning:", msg) }
+
+	var accounts []account
+	var rules []aclEntry
+	var bindings []binding
+	if *passwdFile != "" {
+		f, err := os.Open(*passwdFile)
+		if err == nil {
+			accounts, err = parsePasswd(f, *cost, warn)
+			f.Close()
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "import:", err)
+			os.Exit(1)
+		}
+	}
+	if *shadowFile != "" {
+		f, err := os.Open(*shadowFile)
+		if err == nil {
+			var more []account
+			more, err = parseShadow(f, warn)
+			f.Close()
+			accounts = append(accounts, more...)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "import:", err)
+			os.Exit(1)
+		}
+	}
+	if *aclFile != "" {
+		f, err := os.Open(*aclFile)
+		if err == nil {
+			rules, err = parseACLFile(f, warn)
+			f.Close()
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "import:", err)
+			os.Exit(1)
+		}
+	}
+
+	if *dynsecFile != "" {
+		f, err := os.Open(*dynsecFile)
+		if err == nil {
+			var more []account
+			var moreRules []aclEntry
+			more, moreRules, bindings, err = parseDynsec(f, warn)
+			f.Close()
+			accounts = append(accounts, more...)
+			rules = append(rules, moreRules...)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "import:", err)
+			os.Exit(1)
+		}
+	}
+	if *vmqACL != "" {
+		f, err := os.Open(*vmqACL)
+		if err == nil {
+			var more []aclEntry
+			var notes []vmqNote
+			more, notes, err = parseVMQACL(f)
+			f.Close()
+			for _, n := range notes {
+				warn(n.String())
+			}
+			if err == nil && *reportFile != "" {
+				err = writeReport(*reportFile, more, notes)
+			}
+			rules = append(rules, more...)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "import:", err)
+			os.Exit(1)
+		}
+	}
+	if *emqxUsers != "" {
+		f, err := os.Open(*emqxUsers)
+		if err == nil {
+			var more []account
+			var supers []aclEntry
+			more, supers, err = parseEMQXUsers(f, h, *cost, warn)
+			f.Close()
+			accounts = append(accounts, more...)
+			rules = append(rules, supers...)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "import:", err)
+			os.Exit(1)
+		}
+	}
+	if *emqxACL != "" {
+		f, err := os.Open(*emqxACL)
+		if err == nil {
+			var more []aclEntry
+			more, err = parseEMQXACL(f, warn)
+			f.Close()
+			rules = append(rules, more...)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "import:", err)
+			os.Exit(1)
+		}
+	}
+
+	if *dryRun {
+		fmt.Printf("would import %d user(s), %d acl rule(s) and %d client binding(s)\n", len(accounts), len(rules), len(bindings))
+		return
+	}
+	s, err := load(*dsn, accounts, rules, bindings, *overwrite)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "import:", err)
+		os.Exit(1)
+	}
+	fmt.Printf("imported %d user(s) (%d existing kept), %d acl rule(s), %d client binding(s)\n", s.users, s.usersSkipped, s.acls, s.bindings)
+}
+
+func writeReport(path string, rules []aclEntry, notes []vmqNote) error {
+	if path == "-" {
+		return writeVMQReport(os.Stdout, rules, notes)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := writeVMQReport(f, rules, notes); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// load 在一个事务中写入，失败时整体回滚。
+func load(dsn string, accounts []account, rules []aclEntry, bindings []binding, overwrite bool) (summary, error) {
+	var s summary
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+	conn, err := pgx.Connect(ctx, dsn)
+	if err != nil {
+		return s, err
+	}
+	defer conn.Close(context.Background())
+
+	stmt := insertAccount
+	if overwrite {
+		stmt = upsertAccount
+	}
+	err = pgx.BeginFunc(ctx, conn, func(tx pgx.Tx) error {
+		for _, a := range accounts {
+			enabled := 1
+			if a.disabled {
+				enabled = 0
+			}
+			tag, err := tx.Exec(ctx, stmt, a.username, a.hash, a.salt, enabled)
+			if err != nil {
+				return fmt.Errorf("user %s: %w", a.username, err)
+			}
+			if tag.RowsAffected() == 0 {
+				s.usersSkipped++
+			} else {
+				s.users++
+			}
+		}
+		for _, r := range rules {
+			if _, err := tx.Exec(ctx, mergeACL, r.Username, r.Pattern, r.Acc); err != nil {
+				return fmt.Errorf("acl %s %s: %w", r.Username, r.Pattern, err)
+			}
+			s.acls++
+		}
+		for _, b := range bindings {
+			tag, err := tx.Exec(ctx, insertBinding, b.username, b.clientID)
+			if err != nil {
+				return fmt.Errorf("binding %s %s: %w", b.username, b.clientID, err)
+			}
+			s.bindings += int(tag.RowsAffected())
+		}
+		return nil
+	})
+	return s, err
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"auth-plugin/internal/shacrypt"
+)
+
+// mosquitto password_file：每行 username:hash。插件能校验的哈希（mosquitto $7$/$6$、SHA-crypt $5$/$6$、bcrypt）原样保留；
+// 明文行（尚未经过 mosquitto_passwd -U）用 bcrypt 重新哈希；其他格式跳过并告警。
+
+type account struct {
+	username string
+	hash     string
+	salt     string // 仅 EMQX 的 sha256 哈希使用
+	disabled bool   // dynsec 中 disabled 的客户端
+	line     int
+}
+
+func keepHash(h string) bool {
+	parts := strings.Split(h, "$")
+	switch {
+	case shacrypt.Is(h):
+		return true
+	case strings.HasPrefix(h, "$7$"):
+		return len(parts) == 5
+	case strings.HasPrefix(h, "$6$"):
+		return len(parts) == 4
+	case strings.HasPrefix(h, "$2a$"), strings.HasPrefix(h, "$2b$"), strings.HasPrefix(h, "$2y$"):
+		_, err := bcrypt.Cost([]byte(h))
+		return err == nil
+	}
+	return false
+}
+
+func parsePasswd(r io.Reader, cost int, warn func(string)) ([]account, error) {
+	var out []account
+	seen := map[string]int{}
+	sc := bufio.NewScanner(r)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimRight(sc.Text(), "\r")
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		user, secret, ok := strings.Cut(line, ":")
+		if !ok || user == "" || secret == "" {
+			warn(fmt.Sprintf("password_file line %d: want username:hash, skipped", n))
+			continue
+		}
+		a := account{username: user, hash: secret, line: n}
+		switch {
+		case keepHash(secret):
+		case strings.HasPrefix(secret, "$"):
+			warn(fmt.Sprintf("password_file line %d: %s has an unsupported hash format, skipped (reset it with useradm set-password)", n, user))
+			continue
+		default:
+			h, err := bcrypt.GenerateFromPassword([]byte(secret), cost)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", n, err)
+			}
+			a.hash = string(h)
+			warn(fmt.Sprintf("password_file line %d: %s had a plaintext password, stored as bcrypt", n, user))
+		}
+		if i, dup := seen[user]; dup {
+			warn(fmt.Sprintf("password_file line %d: %s repeats line %d, the later entry wins", n, user, out[i].line))
+			out[i] = a
+			continue
+		}
+		seen[user] = len(out)
+		out = append(out, a)
+	}
+	return out, sc.Err()
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// /etc/shadow（嵌入式 Linux 设备上的账号）：每行 username:hash:lastchg:...，只用前两个字段。
+//   - SHA-crypt（$5$/$6$）与 bcrypt 哈希原样导入，插件直接校验，设备上的密码不用重置；
+//   - 以 ! 开头的哈希是被锁定的账号，去掉 ! 后导入为 enabled=0；
+//   - 空密码、*、! 等没有可用密码的账号跳过；MD5-crypt（$1$）、yescrypt（$y$）等插件不支持的格式跳过并告警。
+
+func parseShadow(r io.Reader, warn func(string)) ([]account, error) {
+	var out []account
+	seen := map[string]int{}
+	sc := bufio.NewScanner(r)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimRight(sc.Text(), "\r")
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Split(line, ":")
+		if len(fields) < 2 || fields[0] == "" {
+			warn(fmt.Sprintf("shadow line %d: want username:hash:..., skipped", n))
+			continue
+		}
+		user, hash := fields[0], fields[1]
+		a := account{username: user, line: n}
+		if locked, ok := strings.CutPrefix(hash, "!"); ok {
+			hash, a.disabled = locked, true
+		}
+		switch {
+		case hash == "" && !a.disabled:
+			warn(fmt.Sprintf("shadow line %d: %s has an empty password, skipped", n, user))
+			continue
+		case hash == "" || hash == "*" || hash == "!" || hash == "x":
+			// 锁定或没有密码的系统账号
+			continue
+		case !strings.HasPrefix(hash, "$") || !keepHash(hash):
+			scheme := "unknown"
+			if strings.HasPrefix(hash, "$") {
+				scheme = "$" + strings.SplitN(hash[1:], "$", 2)[0] + "$"
+			}
+			warn(fmt.Sprintf("shadow line %d: %s has an unsupported hash format (%s), skipped (reset it with useradm set-password)", n, user, scheme))
+			continue
+		}
+		a.hash = hash
+		if i, dup := seen[user]; dup {
+			warn(fmt.Sprintf("shadow line %d: %s repeats line %d, the later entry wins", n, user, out[i].line))
+			out[i] = a
+			continue
+		}
+		seen[user] = len(out)
+		out = append(out, a)
+	}
+	return out, sc.Err()
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseShadow(t *testing.T) {
+	t.Parallel()
+	const sha512 = "$6$saltstring$svn8UoSVapNtMuq1ukKS4tPQd8iKwSMHWjl/O817G3uBnIFNjnQJuesI68u4OTLiBFdcbYEdFCoEOfaS35inz1"
+	const sha256 = "$5$rounds=10000$saltstringsaltst$3xv.VbSHBb41AL9AvLeujZkZRBAwqFMz2.opqey6IcA"
+	in := "root:*:19000:0:99999:7:::\n" +
+		"daemon:!!:19000::::::\n" +
+		"sensor:" + sha512 + ":19000:0:99999:7:::\n" +
+		"gateway:" + sha256 + ":19000:0:99999:7:::\n" +
+		"retired:!" + sha512 + ":19000:0:99999:7:::\n" +
+		"legacy:$1$abcdefgh$0123456789abcdefghijkl:19000::::::\n" +
+		"modern:$y$j9T$salt$hash:19000::::::\n" +
+		"open::19000::::::\n" +
+		"broken\n"
+	var warnings []string
+	got, err := parseShadow(strings.NewReader(in), func(s string) { warnings = append(warnings, s) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 3 {
+		t.Fatalf("accounts = %+v", got)
+	}
+	if got[0].username != "sensor" || got[0].hash != sha512 || got[0].disabled {
+		t.Errorf("sensor = %+v", got[0])
+	}
+	if got[1].username != "gateway" || got[1].hash != sha256 {
+		t.Errorf("gateway = %+v", got[1])
+	}
+	if got[2].username != "retired" || got[2].hash != sha512 || !got[2].disabled {
+		t.Errorf("locked account should be imported disabled without the '!', got %+v", got[2])
+	}
+	joined := strings.Join(warnings, "\n")
+	for _, want := range []string{"legacy has an unsupported hash format ($1$)", "modern has an unsupported hash format ($y$)", "open has an empty password", "line 9: want username:hash"} {
+		if !strings.Contains(joined, want) {
+			t.Errorf("missing warning %q in:\n%s", want, joined)
+		}
+	}
+	if strings.Contains(joined, "root") || strings.Contains(joined, "daemon") {
+		t.Errorf("accounts without a password should be skipped silently:\n%s", joined)
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"auth-plugin/internal/aclrule"
+)
+
+// VerneMQ vmq_acl 文件与 mosquitto acl_file 写法相近，但语义有几处不同：
+//
+//   - user 行之前的 topic 行对所有客户端生效（vmq_acl 的 read_all/write_all），而不是只对匿名客户端，
+//     因此写入全局用户 '*'；
+//   - 访问类型只有 read 和 write，省略时两者都有；没有 readwrite 与 deny，"topic readwrite x" 在 vmq
+//     中是主题 "readwrite x"；
+//   - pattern 除 %u/%c 外还有挂载点 %m，插件没有挂载点，含 %m 的规则跳过。
+//
+// 与插件语义不完全一致的写法记入转换报告（vmqNote），转换时原样保留主题的行不记录。
+
+// vmqNote 是转换报告中的一项。
+type vmqNote struct {
+	line      int
+	text      string // 原始行
+	construct string // 无法直接对应的写法，报告按它分组
+	outcome   string // converted 或 skipped
+	detail    string
+}
+
+func (n vmqNote) String() string {
+	return fmt.Sprintf("vmq_acl line %d: %s %s (%s): %s", n.line, n.construct, n.outcome, n.detail, n.text)
+}
+
+var vmqAccess = map[string]int{
+	"read":  aclrule.Read | aclrule.Subscribe,
+	"write": aclrule.Write,
+	"":      aclrule.StoredAccess,
+}
+
+func parseVMQACL(r io.Reader) ([]aclEntry, []vmqNote, error) {
+	var out []aclEntry
+	var notes []vmqNote
+	index := map[[2]string]int{}
+	user := "*"
+	sc := bufio.NewScanner(r)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		note := func(construct, outcome, detail string) {
+			notes = append(notes, vmqNote{n, line, construct, outcome, detail})
+		}
+		kw, rest, _ := strings.Cut(line, " ")
+		rest = strings.TrimSpace(rest)
+		switch kw {
+		case "user":
+			if rest == "" {
+				note("user without a name", "skipped", "the following topic lines stay with the previous user")
+				continue
+			}
+			user = rest
+			continue
+		case "topic", "pattern":
+		default:
+			note("unknown keyword "+kw, "skipped", "vmq_acl knows user, topic and pattern")
+			continue
+		}
+		access, topic := "", rest
+		if first, t, ok := strings.Cut(rest, " "); ok && (first == "read" || first == "write") {
+			access, topic = first, strings.TrimSpace(t)
+		}
+		if strings.HasPrefix(topic, "readwrite ") || strings.HasPrefix(topic, "deny ") {
+			note("mosquitto access keyword", "skipped", "vmq_acl reads it as part of the topic; check what the rule was meant to do")
+			continue
+		}
+		username, pattern := user, topic
+		if kw == "pattern" {
+			if strings.Contains(topic, "%m") {
+				note("%m mountpoint placeholder", "skipped", "the plugin has no mountpoints")
+				continue
+			}
+			username = "*"
+			pattern = strings.NewReplacer("%u", "{username}", "%c", "{clientid}").Replace(topic)
+		} else if user == "*" {
+			note("topic before the first user line", "converted", "applies to every client, stored as a global (*) rule")
+		}
+		if err := aclrule.ValidatePattern(pattern); err != nil {
+			note("invalid topic", "skipped", err.Error())
+			continue
+		}
+		key := [2]string{username, pattern}
+		if i, dup := index[key]; dup {
+			out[i].Acc |= vmqAccess[access]
+			continue
+		}
+		index[key] = len(out)
+		out = append(out, aclEntry{Username: username, Rule: aclrule.Rule{Pattern: pattern, Acc: vmqAccess[access]}})
+	}
+	return out, notes, sc.Err()
+}
+
+// writeVMQReport 按写法分组输出转换报告，便于逐类核对。
+func writeVMQReport(w io.Writer, rules []aclEntry, notes []vmqNote) error {
+	bw := bufio.NewWriter(w)
+	skipped := 0
+	groups := map[string][]vmqNote{}
+	for _, n := range notes {
+		if n.outcome == "skipped" {
+			skipped++
+		}
+		groups[n.construct] = append(groups[n.construct], n)
+	}
+	fmt.Fprintf(bw, "vmq_acl conversion: %d rule(s) imported, %d line(s) skipped, %d line(s) converted with a change\n",
+		len(rules), skipped, len(notes)-skipped)
+	names := make([]string, 0, len(groups))
+	for k := range groups {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	for _, k := range names {
+		g := groups[k]
+		fmt.Fprintf(bw, "\n%s: %d line(s) %s\n", k, len(g), g[0].outcome)
+		for _, n := range g {
+			fmt.Fprintf(bw, "  line %d: %s  (%s)\n", n.line, n.text, n.detail)
+		}
+	}
+	return bw.Flush()
+}
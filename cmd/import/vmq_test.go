@@ -0,0 +1,76 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"auth-plugin/internal/aclrule"
+)
+
+func TestParseVMQACL(t *testing.T) {
+	t.Parallel()
+	in := `# vmq_acl
+topic read $SYS/#
+pattern write devices/%u/%c/#
+pattern read %m/shared/#
+
+user alice
+topic cmd/alice
+topic read cmd/alice
+topic write readings/alice
+topic readwrite x
+topic bad/#/x
+token abc
+`
+	got, notes, err := parseVMQACL(strings.NewReader(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rw := aclrule.StoredAccess
+	want := []aclEntry{
+		{Username: "*", Rule: aclrule.Rule{Pattern: "$SYS/#", Acc: aclrule.Read | aclrule.Subscribe}},
+		{Username: "*", Rule: aclrule.Rule{Pattern: "devices/{username}/{clientid}/#", Acc: aclrule.Write}},
+		{Username: "alice", Rule: aclrule.Rule{Pattern: "cmd/alice", Acc: rw}},
+		{Username: "alice", Rule: aclrule.Rule{Pattern: "readings/alice", Acc: aclrule.Write}},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("rules = %+v", got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("rule %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+	wantNotes := []struct {
+		line      int
+		construct string
+		outcome   string
+	}{
+		{2, "topic before the first user line", "converted"},
+		{4, "%m mountpoint placeholder", "skipped"},
+		{10, "mosquitto access keyword", "skipped"},
+		{11, "invalid topic", "skipped"},
+		{12, "unknown keyword token", "skipped"},
+	}
+	if len(notes) != len(wantNotes) {
+		t.Fatalf("notes = %+v", notes)
+	}
+	for i, w := range wantNotes {
+		if n := notes[i]; n.line != w.line || n.construct != w.construct || n.outcome != w.outcome {
+			t.Errorf("note %d = %+v, want %+v", i, n, w)
+		}
+	}
+
+	var report strings.Builder
+	if err := writeVMQReport(&report, got, notes); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"4 rule(s) imported, 4 line(s) skipped, 1 line(s) converted",
+		"%m mountpoint placeholder: 1 line(s) skipped\n  line 4: pattern read %m/shared/#",
+	} {
+		if !strings.Contains(report.String(), want) {
+			t.Errorf("report missing %q:\n%s", want, report.String())
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"auth-plugin/internal/aclrule"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// 事件操作。
+const (
+	opUpsertUser = "upsert_user"
+	opDeleteUser = "delete_user"
+	opSetACLs    = "set_acls"
+	opAddACL     = "add_acl"
+	opDeleteACL  = "delete_acl"
+)
+
+// eventRule 是事件中的一条规则；access 与 useradm acl add 的写法相同。
+type eventRule struct {
+	Pattern string `json:"pattern"`
+	Access  string `json:"access"`
+}
+
+// event 是 topic 中的一条消息（JSON）。字段按 op 使用，缺省的字段保持库中原值。
+type event struct {
+	Op           string      `json:"op"`
+	Username     string      `json:"username"`
+	PasswordHash *string     `json:"password_hash"`
+	Enabled      *bool       `json:"enabled"`
+	ClientIDs    *[]string   `json:"client_ids"`
+	ACLs         []eventRule `json:"acls"`
+	Pattern      string      `json:"pattern"`
+	Access       string      `json:"access"`
+
+	acc   int // 解析后的 Access
+	rules []aclrule.Rule
+}
+
+// parseEvent 解析并校验一条消息；返回错误的消息被跳过，不会重试。
+func parseEvent(b []byte) (event, error) {
+	var ev event
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&ev); err != nil {
+		return ev, fmt.Errorf("invalid JSON: %w", err)
+	}
+	if ev.Username == "" || ev.Username == "*" {
+		return ev, errors.New("username is required and cannot be '*'")
+	}
+	switch ev.Op {
+	case opUpsertUser:
+		if ev.PasswordHash != nil && *ev.PasswordHash != "" && !usableHash(*ev.PasswordHash) {
+			return ev, errors.New("password_hash must be bcrypt or a mosquitto $6$/$7$ hash")
+		}
+		if ev.ClientIDs != nil {
+			for _, id := range *ev.ClientIDs {
+				if id == "" {
+					return ev, errors.New("empty client id")
+				}
+			}
+		}
+	case opDeleteUser:
+	case opSetACLs:
+		seen := map[string]bool{}
+		for _, r := range ev.ACLs {
+			rule, err := parseRule(r.Pattern, r.Access)
+			if err != nil {
+				return ev, err
+			}
+			if seen[rule.Pattern] {
+				return ev, fmt.Errorf("duplicate pattern %q", rule.Pattern)
+			}
+			seen[rule.Pattern] = true
+			ev.rules = append(ev.rules, rule)
+		}
+	case opAddACL:
+		rule, err := parseRule(ev.Pattern, ev.Access)
+		if err != nil {
+			return ev, err
+		}
+		ev.acc = rule.Acc
+	case opDeleteACL:
+		if ev.Pattern == "" {
+			return ev, errors.New("pattern is required")
+		}
+	default:
+		return ev, fmt.Errorf("unknown op %q", ev.Op)
+	}
+	return ev, nil
+}
+
+func parseRule(pattern, access string) (aclrule.Rule, error) {
+	if err := aclrule.ValidatePattern(pattern); err != nil {
+		return aclrule.Rule{}, err
+	}
+	acc, err := aclrule.ParseAcc(access)
+	if err != nil {
+		return aclrule.Rule{}, err
+	}
+	return aclrule.Rule{Pattern: pattern, Acc: acc}, nil
+}
+
+// usableHash 只接受加盐的哈希：消息会长期留在 topic 里，不允许明文或无盐哈希。
+func usableHash(h string) bool {
+	for _, p := range []string{"$2a$", "$2b$", "$2y$", "$7$", "$6$"} {
+		if strings.HasPrefix(h, p) {
+			return true
+		}
+	}
+	return false
+}
+
+const (
+	upsertUser = `INSERT INTO iot_devices (username, password_hash, salt, enabled) VALUES ($1, COALESCE($2, ''), '', COALESCE($3, 1))
+ON CONFLICT (username) DO UPDATE SET
+  password_hash = COALESCE($2, iot_devices.password_hash),
+  salt = CASE WHEN $2 IS NULL THEN iot_devices.salt ELSE '' END,
+  enabled = COALESCE($3, iot_devices.enabled)`
+	upsertRule = `INSERT INTO acls (username, pattern, acc) VALUES ($1, $2, $3)
+ON CONFLICT (username, pattern) DO UPDATE SET acc = EXCLUDED.acc`
+)
+
+// applyEvent 在 tx 中执行一条事件。所有操作都是幂等的：重放同一条消息结果不变，
+// 删除不存在的用户或规则不算错误。
+func applyEvent(ctx context.Context, tx pgx.Tx, ev event) error {
+	var err error
+	switch ev.Op {
+	case opUpsertUser:
+		var enabled *int16
+		if ev.Enabled != nil {
+			v := int16(0)
+			if *ev.Enabled {
+				v = 1
+			}
+			enabled = &v
+		}
+		if _, err = tx.Exec(ctx, upsertUser, ev.Username, ev.PasswordHash, enabled); err != nil || ev.ClientIDs == nil {
+			break
+		}
+		if _, err = tx.Exec(ctx, "DELETE FROM client_bindings WHERE username = $1", ev.Username); err != nil {
+			break
+		}
+		for _, id := range *ev.ClientIDs {
+			if _, err = tx.Exec(ctx, "INSERT INTO client_bindings (username, client_id) VALUES ($1, $2) ON CONFLICT DO NOTHING",
+				ev.Username, id); err != nil {
+				break
+			}
+		}
+	case opDeleteUser:
+		// acls 没有外键，单独删除；client_bindings 随 iot_devices 级联删除
+		if _, err = tx.Exec(ctx, "DELETE FROM acls WHERE username = $1", ev.Username); err == nil {
+			_, err = tx.Exec(ctx, "DELETE FROM iot_devices WHERE username = $1", ev.Username)
+		}
+	case opSetACLs:
+		if _, err = tx.Exec(ctx, "DELETE FROM acls WHERE username = $1", ev.Username); err != nil {
+			break
+		}
+		for _, r := range ev.rules {
+			if _, err = tx.Exec(ctx, upsertRule, ev.Username, r.Pattern, r.Acc); err != nil {
+				break
+			}
+		}
+	case opAddACL:
+		_, err = tx.Exec(ctx, upsertRule, ev.Username, ev.Pattern, ev.acc)
+	case opDeleteACL:
+		_, err = tx.Exec(ctx, "DELETE FROM acls WHERE username = $1 AND pattern = $2", ev.Username, ev.Pattern)
+	}
+	if err != nil {
+		return fmt.Errorf("%s %s: %w", ev.Op, ev.Username, err)
+	}
+	return nil
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"github.com/twmb/franz-go/pkg/sasl"
+)
+
+// pollMaxRecords 限制每轮处理的记录数，使分区转移不会因为一轮处理过久而拖延。
+const pollMaxRecords = 1000
+
+// errOffsetMoved 表示分区已被另一个实例推进：本批回滚，重新加入消费组后从保存的 offset 继续。
+var errOffsetMoved = errors.New("offset already advanced by another kafkasync instance")
+
+// consumer 以消费组成员的身份读取 topic，多个实例分摊分区，某个实例退出时分区转给其他成员。
+// offset 保存在 kafka_offsets 表中，与事件在同一个事务里提交；加入消费组后用保存的 offset
+// 覆盖 Kafka 侧的位置，没有记录的分区从 -start 开始。
+type consumer struct {
+	brokers  []string
+	topic    string
+	group    string
+	clientID string
+	tls      *tls.Config
+	sasl     sasl.Mechanism // nil 表示不使用 SASL
+	start    kgo.Offset     // 没有保存的 offset 时从哪里开始
+	maxWait  time.Duration
+	pool     *pgxpool.Pool
+	logger   *log.Logger
+}
+
+func (c *consumer) newClient() (*kgo.Client, error) {
+	opts := []kgo.Opt{
+		kgo.SeedBrokers(c.brokers...),
+		kgo.ClientID(c.clientID),
+		kgo.ConsumerGroup(c.group),
+		kgo.ConsumeTopics(c.topic),
+		kgo.ConsumeResetOffset(c.start),
+		kgo.FetchMaxWait(c.maxWait),
+		kgo.DisableAutoCommit(),
+		// 处理完一轮拉取之前不交出分区，避免两个实例同时应用同一分区
+		kgo.BlockRebalanceOnPoll(),
+		kgo.AdjustFetchOffsetsFn(c.storedOffsets),
+		kgo.OnPartitionsAssigned(func(_ context.Context, _ *kgo.Client, assigned map[string][]int32) {
+			c.logger.Printf("assigned %s partition(s) %v", c.topic, assigned[c.topic])
+		}),
+		kgo.OnPartitionsRevoked(func(_ context.Context, _ *kgo.Client, revoked map[string][]int32) {
+			c.logger.Printf("revoked %s partition(s) %v", c.topic, revoked[c.topic])
+		}),
+	}
+	if c.tls != nil {
+		opts = append(opts, kgo.DialTLSConfig(c.tls))
+	}
+	if c.sasl != nil {
+		opts = append(opts, kgo.SASL(c.sasl))
+	}
+	return kgo.NewClient(opts...)
+}
+
+// storedOffsets 在加入消费组后调用：分配到的分区如果在 kafka_offsets 中有记录，就从那里继续。
+func (c *consumer) storedOffsets(ctx context.Context, offsets map[string]map[int32]kgo.Offset) (map[string]map[int32]kgo.Offset, error) {
+	parts := offsets[c.topic]
+	if len(parts) == 0 {
+		return offsets, nil
+	}
+	rows, err := c.pool.Query(ctx, "SELECT partition, next_offset FROM kafka_offsets WHERE topic = $1", c.topic)
+	if err != nil {
+		return nil, err
+	}
+	stored, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) ([2]int64, error) {
+		var r [2]int64
+		err := row.Scan(&r[0], &r[1])
+		return r, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range stored {
+		if _, ok := parts[int32(r[0])]; ok {
+			// 不带 epoch，避免客户端把位置的回退当作数据丢失
+			parts[int32(r[0])] = kgo.NewOffset().At(r[1]).WithEpoch(-1)
+		}
+	}
+	return offsets, nil
+}
+
+// applyRecords 在一个事务中应用一个分区的记录并推进 offset。无效的消息记录后跳过，
+// offset 照常推进；数据库错误整体回滚，由 run 重新加入消费组后从保存的位置重试。
+func (c *consumer) applyRecords(ctx context.Context, part int32, recs []*kgo.Record) (int, error) {
+	if len(recs) == 0 {
+		return 0, nil
+	}
+	applied := 0
+	err := pgx.BeginFunc(ctx, c.pool, func(tx pgx.Tx) error {
+		for _, r := range recs {
+			ev, err := parseEvent(r.Value)
+			if err != nil {
+				c.logger.Printf("partition %d offset %d: skipping: %v", part, r.Offset, err)
+				continue
+			}
+			if err := applyEvent(ctx, tx, ev); err != nil {
+				return err
+			}
+			applied++
+		}
+		// 保存的 offset 已经超过本批起点时，说明另一个实例在分区转移期间应用过这些记录
+		tag, err := tx.Exec(ctx, `INSERT INTO kafka_offsets (topic, partition, next_offset) VALUES ($1, $2, $3)
+ON CONFLICT (topic, partition) DO UPDATE SET next_offset = EXCLUDED.next_offset, updated_at = now()
+WHERE kafka_offsets.next_offset <= $4`, c.topic, part, recs[len(recs)-1].Offset+1, recs[0].Offset)
+		if err == nil && tag.RowsAffected() == 0 {
+			err = errOffsetMoved
+		}
+		return err
+	})
+	if err != nil {
+		return 0, fmt.Errorf("partition %d: %w", part, err)
+	}
+	return applied, nil
+}
+
+// consume 拉取并应用事件，直到 ctx 结束或出错。
+func (c *consumer) consume(ctx context.Context, cl *kgo.Client) error {
+	for {
+		fs := cl.PollRecords(ctx, pollMaxRecords)
+		if ctx.Err() != nil || fs.IsClientClosed() {
+			return nil
+		}
+		var err error
+		fs.EachError(func(topic string, part int32, e error) {
+			if err == nil {
+				err = fmt.Errorf("fetch %s partition %d: %w", topic, part, e)
+			}
+		})
+		total := 0
+		fs.EachPartition(func(p kgo.FetchTopicPartition) {
+			if err != nil {
+				return
+			}
+			var n int
+			n, err = c.applyRecords(ctx, p.Partition, p.Records)
+			total += n
+		})
+		if total > 0 {
+			c.logger.Printf("applied %d event(s)", total)
+		}
+		if err != nil {
+			return err
+		}
+		cl.AllowRebalance()
+	}
+}
+
+// run 持续消费直到 ctx 结束。出错时关闭客户端（离开消费组），退避后重新加入并从保存的 offset 继续，
+// 已拉取但未提交的记录会被重新读取。
+func (c *consumer) run(ctx context.Context) {
+	backoff := time.Second
+	for ctx.Err() == nil {
+		started := time.Now()
+		cl, err := c.newClient()
+		if err == nil {
+			c.logger.Printf("consuming %s as group %s", c.topic, c.group)
+			err = c.consume(ctx, cl)
+			cl.Close()
+		}
+		if err == nil || ctx.Err() != nil {
+			return
+		}
+		c.logger.Println(err)
+		if time.Since(started) > time.Minute {
+			backoff = time.Second
+		}
+		sleep(ctx, backoff)
+		backoff = min(backoff*2, time.Minute)
+	}
+}
+
+func sleep(ctx context.Context, d time.Duration) {
+	select {
+	case <-ctx.Done():
+	case <-time.After(d):
+	}
+}
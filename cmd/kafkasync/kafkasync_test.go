@@ -0,0 +1,61 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseEvent(t *testing.T) {
+	t.Parallel()
+	ev, err := parseEvent([]byte(`{"op": "upsert_user", "username": "sensor-1", "enabled": false, "client_ids": []}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ev.PasswordHash != nil || ev.Enabled == nil || *ev.Enabled || ev.ClientIDs == nil || len(*ev.ClientIDs) != 0 {
+		t.Fatalf("got %+v", ev)
+	}
+	ev, err = parseEvent([]byte(`{"op": "set_acls", "username": "sensor-1", "acls": [
+		{"pattern": "devices/{username}/#", "access": "read|subscribe"},
+		{"pattern": "cmd/{clientid}", "access": "2"}
+	]}`))
+	if err != nil || len(ev.rules) != 2 || ev.rules[0].Acc != 5 || ev.rules[1].Acc != 2 {
+		t.Fatalf("set_acls: %+v, %v", ev.rules, err)
+	}
+	ev, err = parseEvent([]byte(`{"op": "add_acl", "username": "sensor-1", "pattern": "a/b", "access": "w"}`))
+	if err != nil || ev.acc != 2 {
+		t.Fatalf("add_acl: %+v, %v", ev, err)
+	}
+
+	for _, bad := range []string{
+		`not json`,
+		`{"op": "upsert_user"}`,
+		`{"op": "upsert_user", "username": "*"}`,
+		`{"op": "upsert_user", "username": "a", "password": "secret"}`,
+		`{"op": "upsert_user", "username": "a", "password_hash": "5f4dcc3b5aa765d61d8327deb882cf99"}`,
+		`{"op": "upsert_user", "username": "a", "client_ids": [""]}`,
+		`{"op": "set_acls", "username": "a", "acls": [{"pattern": "a/#/b", "access": "read"}]}`,
+		`{"op": "set_acls", "username": "a", "acls": [{"pattern": "a", "access": "r"}, {"pattern": "a", "access": "w"}]}`,
+		`{"op": "add_acl", "username": "a", "pattern": "a/b", "access": "delete"}`,
+		`{"op": "delete_acl", "username": "a"}`,
+		`{"op": "rename_user", "username": "a"}`,
+	} {
+		if _, err := parseEvent([]byte(bad)); err == nil {
+			t.Errorf("parseEvent(%s) should fail", bad)
+		}
+	}
+}
+
+func TestUsableHash(t *testing.T) {
+	t.Parallel()
+	for h, want := range map[string]bool{
+		"$2b$10$abcdefghijklmnopqrstuv": true,
+		"$7$101$c2FsdA==$aGFzaA==":      true,
+		"$6$salt$hash":                  true,
+		strings.Repeat("a", 64):         false,
+		"plain":                         false,
+	} {
+		if got := usableHash(h); got != want {
+			t.Errorf("usableHash(%q) = %v, want %v", h, got, want)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+// kafkasync 从 Kafka topic 读取用户/ACL 变更事件并写入 iot_devices、client_bindings 与 acls，
+// 让设备身份可以像代码一样通过流水线发布（GitOps）：变更提交到仓库，CI 把事件写入 topic，
+// 每个环境的 kafkasync 各自应用。
+//
+// 每条消息是一个 JSON 对象，op 为：
+//
+//	upsert_user  {"username", "password_hash", "enabled", "client_ids"}  缺省的字段保持不变
+//	delete_user  {"username"}                                           同时删除其规则与绑定
+//	set_acls     {"username", "acls": [{"pattern", "access"}]}          替换该用户的全部规则
+//	add_acl      {"username", "pattern", "access"}
+//	delete_acl   {"username", "pattern"}
+//
+// 所有操作都是幂等的；offset 与变更在同一个事务中写入 kafka_offsets（迁移 0008），重启后从
+// 上次位置继续，不会重复或遗漏。无效的消息记录日志后跳过。多个实例以同一个 -group 加入消费组，
+// 分区在它们之间分配，实例退出时由其他成员接手。
+// 只支持 PostgreSQL；password_hash 只接受 bcrypt 与 mosquitto $6$/$7$，不接受明文。
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/twmb/franz-go/pkg/kgo"
+
+	"auth-plugin/internal/kafkasasl"
+)
+
+func main() {
+	brokers := flag.String("brokers", "", "comma-separated bootstrap brokers (host:port)")
+	c := consumer{logger: log.New(os.Stderr, "kafkasync: ", log.LstdFlags)}
+	flag.StringVar(&c.topic, "topic", "", "topic carrying the user/ACL events")
+	flag.StringVar(&c.group, "group", "mosquitto-kafkasync", "consumer group; instances in the same group share the partitions")
+	flag.StringVar(&c.clientID, "client-id", "mosquitto-kafkasync", "Kafka client id")
+	useTLS := flag.Bool("tls", false, "connect to the brokers over TLS")
+	mechanism := flag.String("sasl-mechanism", "", "SASL mechanism: plain, scram-sha-256 or scram-sha-512 (default none)")
+	saslUser := flag.String("sasl-username", "", "SASL username")
+	saslPasswordFile := flag.String("sasl-password-file", "", "file holding the SASL password (default $KAFKA_PASSWORD)")
+	start := flag.String("start", "earliest", "where to begin on partitions without a stored offset: earliest or latest")
+	flag.DurationVar(&c.maxWait, "max-wait", time.Second, "how long a fetch waits for new events")
+	dsn := flag.String("dsn", os.Getenv("PG_DSN"), "PostgreSQL DSN (default $PG_DSN)")
+	flag.Parse()
+
+	for _, b := range strings.Split(*brokers, ",") {
+		if b = strings.TrimSpace(b); b != "" {
+			c.brokers = append(c.brokers, b)
+		}
+	}
+	switch *start {
+	case "earliest":
+		c.start = kgo.NewOffset().AtStart()
+	case "latest":
+		c.start = kgo.NewOffset().AtEnd()
+	default:
+		fmt.Fprintln(os.Stderr, "kafkasync: -start must be earliest or latest")
+		os.Exit(2)
+	}
+	switch {
+	case len(c.brokers) == 0 || c.topic == "" || c.group == "":
+		fmt.Fprintln(os.Stderr, "kafkasync: -brokers, -topic and -group are required")
+		flag.Usage()
+		os.Exit(2)
+	case *dsn == "":
+		fmt.Fprintln(os.Stderr, "kafkasync: -dsn or PG_DSN is required")
+		os.Exit(2)
+	case c.maxWait <= 0:
+		fmt.Fprintln(os.Stderr, "kafkasync: -max-wait must be positive")
+		os.Exit(2)
+	}
+	if *useTLS {
+		c.tls = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+	password := os.Getenv("KAFKA_PASSWORD")
+	if *saslPasswordFile != "" {
+		raw, err := os.ReadFile(*saslPasswordFile)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "kafkasync:", err)
+			os.Exit(2)
+		}
+		password = strings.TrimSpace(string(raw))
+	}
+	m, err := kafkasasl.Mechanism(*mechanism, *saslUser, password)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "kafkasync: -sasl-mechanism:", err)
+		os.Exit(2)
+	}
+	c.sasl = m
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	pool, err := pgxpool.New(ctx, *dsn)
+	if err != nil {
+		c.logger.Fatal(err)
+	}
+	defer pool.Close()
+	c.pool = pool
+	c.run(ctx)
+	c.logger.Println("stopping")
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// 凭据 CSV：username,password[,clientid]，首行表头可选，# 开头为注释。
+// clientid 为空时使用 loadtest-<username>-<序号>；连接数多于凭据行时循环使用。
+
+type credential struct {
+	username, password, clientID string
+}
+
+func readCreds(r io.Reader) ([]credential, error) {
+	cr := csv.NewReader(r)
+	cr.Comment = '#'
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+
+	var creds []credential
+	for first := true; ; first = false {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		line, _ := cr.FieldPos(0)
+		if len(rec) < 2 || len(rec) > 3 {
+			return nil, fmt.Errorf("line %d: want username,password[,clientid]", line)
+		}
+		if first && strings.EqualFold(rec[0], "username") && strings.EqualFold(rec[1], "password") {
+			continue
+		}
+		if rec[0] == "" {
+			return nil, fmt.Errorf("line %d: empty username", line)
+		}
+		c := credential{username: rec[0], password: rec[1]}
+		if len(rec) == 3 {
+			c.clientID = rec[2]
+		}
+		creds = append(creds, c)
+	}
+	if len(creds) == 0 {
+		return nil, errors.New("no credentials")
+	}
+	return creds, nil
+}
+
+// pick 返回第 i 个连接使用的凭据。同一凭据被多个连接复用时给 client id 加序号，避免互相踢下线。
+func pick(creds []credential, i int) credential {
+	c := creds[i%len(creds)]
+	round := i / len(creds)
+	switch {
+	case c.clientID == "":
+		c.clientID = fmt.Sprintf("loadtest-%s-%d", c.username, i)
+	case round > 0:
+		c.clientID = fmt.Sprintf("%s-%d", c.clientID, round)
+	}
+	return c
+}
+
+// expandTopic 展开主题模板中的 {username}/{clientid}，与插件 ACL 的占位符一致。
+func expandTopic(tmpl string, c credential) string {
+	return strings.NewReplacer("{username}", c.username, "{clientid}", c.clientID).Replace(tmpl)
+}
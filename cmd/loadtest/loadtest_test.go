@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/eclipse/paho.mqtt.golang/packets"
+)
+
+func TestReadCreds(t *testing.T) {
+	t.Parallel()
+	in := "username,password,clientid\n# comment\nalice,secret\nbob,pw,bob-1\n"
+	got, err := readCreds(strings.NewReader(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []credential{{"alice", "secret", ""}, {"bob", "pw", "bob-1"}}
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+	for _, bad := range []string{"", "alice\n", ",pw\n", "a,b,c,d\n"} {
+		if _, err := readCreds(strings.NewReader(bad)); err == nil {
+			t.Errorf("readCreds(%q) should fail", bad)
+		}
+	}
+}
+
+func TestPick(t *testing.T) {
+	t.Parallel()
+	creds := []credential{{"alice", "x", ""}, {"bob", "y", "bob-1"}}
+	var ids []string
+	for i := range 4 {
+		ids = append(ids, pick(creds, i).clientID)
+	}
+	want := "loadtest-alice-0 bob-1 loadtest-alice-2 bob-1-1"
+	if got := strings.Join(ids, " "); got != want {
+		t.Errorf("client ids = %q, want %q", got, want)
+	}
+	if got := expandTopic("t/{username}/{clientid}", pick(creds, 3)); got != "t/bob/bob-1-1" {
+		t.Errorf("expandTopic = %q", got)
+	}
+}
+
+func TestClassify(t *testing.T) {
+	t.Parallel()
+	cases := []struct {
+		err  error
+		want string
+	}{
+		{packets.ErrorRefusedBadUsernameOrPassword, failBadCredentials},
+		{fmt.Errorf("connect: %w", packets.ErrorRefusedNotAuthorised), failNotAuthorized},
+		{packets.ErrorRefusedServerUnavailable, failUnavailable},
+		{context.DeadlineExceeded, failTimeout},
+		{packets.ErrorNetworkError, failNetwork},
+		{errors.New("boom"), failOther},
+	}
+	for _, c := range cases {
+		if got := classify(c.err); got != c.want {
+			t.Errorf("classify(%v) = %q, want %q", c.err, got, c.want)
+		}
+	}
+}
+
+func TestReport(t *testing.T) {
+	t.Parallel()
+	r := newRecorder()
+	for i := 1; i <= 100; i++ {
+		r.connected(time.Duration(i) * time.Millisecond)
+	}
+	r.connectFailed(packets.ErrorRefusedBadUsernameOrPassword)
+	r.connectFailed(packets.ErrorRefusedBadUsernameOrPassword)
+	r.connectFailed(context.DeadlineExceeded)
+	var b bytes.Buffer
+	r.write(&b, time.Second)
+	out := b.String()
+	for _, want := range []string{
+		"connect (CONNACK): 100 ok, 3 failed",
+		"p50=50ms p90=90ms p99=99ms max=100ms",
+		"bad username or password:  2",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("report missing %q:\n%s", want, out)
+		}
+	}
+	if strings.Index(out, "bad username") > strings.Index(out, "timeout") {
+		t.Errorf("more frequent reasons should come first:\n%s", out)
+	}
+	if strings.Contains(out, "publish") {
+		t.Errorf("connect-only run should not report publishes:\n%s", out)
+	}
+}
+
+func TestParseFlags(t *testing.T) {
+	t.Parallel()
+	if _, err := parseFlags([]string{"-creds", "c.csv"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, args := range [][]string{
+		{},
+		{"-creds", "c.csv", "-qos", "2"},
+		{"-creds", "c.csv", "-ramp", "1m", "-duration", "30s"},
+		{"-creds", "c.csv", "-rate", "-1"},
+	} {
+		if _, err := parseFlags(args); err == nil {
+			t.Errorf("parseFlags(%q) should fail", args)
+		}
+	}
+}
@@ -0,0 +1,182 @@
+// loadtest 是认证/ACL 的压测工具：按 CSV 中的凭据并发建立 N 个 MQTT 连接，可选按固定速率发布，
+// 最后报告 CONNACK 延迟分位数和按原因归类的失败数，使插件 + PostgreSQL 的容量评估可重复。
+//
+// 每次 CONNECT 都会触发插件的认证查询（缓存未命中时访问 PG），每次 PUBLISH 触发一次 ACL 检查。
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+type config struct {
+	broker         string
+	credsFile      string
+	conns          int
+	ramp           time.Duration
+	duration       time.Duration
+	rate           float64
+	topic          string
+	qos            int
+	size           int
+	connectTimeout time.Duration
+}
+
+func parseFlags(args []string) (config, error) {
+	var c config
+	fs := flag.NewFlagSet("loadtest", flag.ContinueOnError)
+	fs.StringVar(&c.broker, "broker", "tcp://127.0.0.1:1883", "broker URL")
+	fs.StringVar(&c.credsFile, "creds", "", "CSV of username,password[,clientid] (required)")
+	fs.IntVar(&c.conns, "n", 0, "concurrent connections (default: one per credential)")
+	fs.DurationVar(&c.ramp, "ramp", 0, "spread the connects evenly over this long (0 = all at once)")
+	fs.DurationVar(&c.duration, "duration", 30*time.Second, "how long to run, counted from the first connect")
+	fs.Float64Var(&c.rate, "rate", 0, "publishes per second per connection (0 = connect only)")
+	fs.StringVar(&c.topic, "topic", "loadtest/{username}", "publish topic; {username} and {clientid} are expanded")
+	fs.IntVar(&c.qos, "qos", 1, "publish QoS (0 or 1; latency is measured to PUBACK for QoS 1)")
+	fs.IntVar(&c.size, "size", 64, "payload size in bytes")
+	fs.DurationVar(&c.connectTimeout, "connect-timeout", 10*time.Second, "per-connection CONNACK timeout")
+	if err := fs.Parse(args); err != nil {
+		return c, err
+	}
+	switch {
+	case fs.NArg() > 0:
+		return c, fmt.Errorf("unexpected argument %q", fs.Arg(0))
+	case c.credsFile == "":
+		return c, errors.New("-creds is required")
+	case c.conns < 0, c.rate < 0, c.size < 0, c.ramp < 0:
+		return c, errors.New("-n, -rate, -size and -ramp must not be negative")
+	case c.duration <= 0 || c.connectTimeout <= 0:
+		return c, errors.New("-duration and -connect-timeout must be positive")
+	case c.qos != 0 && c.qos != 1:
+		return c, errors.New("-qos must be 0 or 1")
+	case c.ramp >= c.duration:
+		return c, errors.New("-ramp must be shorter than -duration")
+	}
+	return c, nil
+}
+
+func main() {
+	c, err := parseFlags(os.Args[1:])
+	if err != nil {
+		if !errors.Is(err, flag.ErrHelp) {
+			fmt.Fprintln(os.Stderr, "loadtest:", err)
+		}
+		os.Exit(2)
+	}
+	f, err := os.Open(c.credsFile)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "loadtest:", err)
+		os.Exit(1)
+	}
+	creds, err := readCreds(f)
+	f.Close()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "loadtest:", err)
+		os.Exit(1)
+	}
+	if c.conns == 0 {
+		c.conns = len(creds)
+	}
+
+	// Ctrl-C 提前结束时仍输出已收集的结果
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	ctx, cancel := context.WithTimeout(ctx, c.duration)
+	defer cancel()
+
+	fmt.Fprintf(os.Stderr, "loadtest: %d connection(s) to %s for %s\n", c.conns, c.broker, c.duration)
+	rec := newRecorder()
+	payload := make([]byte, c.size)
+	rand.Read(payload)
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < c.conns; i++ {
+		delay := time.Duration(0)
+		if c.conns > 1 {
+			delay = c.ramp * time.Duration(i) / time.Duration(c.conns-1)
+		}
+		wg.Add(1)
+		go func(cred credential) {
+			defer wg.Done()
+			select {
+			case <-time.After(delay):
+			case <-ctx.Done():
+				return
+			}
+			runConn(ctx, c, cred, payload, rec)
+		}(pick(creds, i))
+	}
+	wg.Wait()
+	rec.write(os.Stdout, time.Since(start))
+}
+
+// wait 等待 paho token 完成，同时受 ctx 约束。
+func wait(ctx context.Context, t mqtt.Token) error {
+	select {
+	case <-t.Done():
+		return t.Error()
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// runConn 建立一个连接并保持到 ctx 结束；rate > 0 时按速率发布。
+func runConn(ctx context.Context, c config, cred credential, payload []byte, rec *recorder) {
+	opts := mqtt.NewClientOptions().
+		AddBroker(c.broker).
+		SetClientID(cred.clientID).
+		SetUsername(cred.username).
+		SetPassword(cred.password).
+		SetCleanSession(true).
+		SetAutoReconnect(false).
+		SetConnectRetry(false).
+		SetConnectTimeout(c.connectTimeout)
+	client := mqtt.NewClient(opts)
+
+	connCtx, cancel := context.WithTimeout(ctx, c.connectTimeout)
+	t0 := time.Now()
+	err := wait(connCtx, client.Connect())
+	cancel()
+	if err != nil {
+		// 压测正常结束时尚未完成的连接不计为失败
+		if ctx.Err() == nil {
+			rec.connectFailed(err)
+		}
+		return
+	}
+	rec.connected(time.Since(t0))
+	defer client.Disconnect(250)
+
+	if c.rate == 0 {
+		<-ctx.Done()
+		return
+	}
+	topic := expandTopic(c.topic, cred)
+	tick := time.NewTicker(time.Duration(float64(time.Second) / c.rate))
+	defer tick.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick.C:
+		}
+		t0 := time.Now()
+		err := wait(ctx, client.Publish(topic, byte(c.qos), false, payload))
+		switch {
+		case err == nil:
+			rec.published(time.Since(t0))
+		case ctx.Err() == nil:
+			rec.publishFailed(err)
+		}
+	}
+}
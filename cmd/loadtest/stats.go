@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/eclipse/paho.mqtt.golang/packets"
+)
+
+// 失败按原因归类：CONNACK 拒绝码区分认证失败（插件查库拒绝）与 not authorized（如 client_id 绑定不符），
+// 超时和网络错误通常意味着 broker 或 PG 已过载。
+const (
+	failBadCredentials = "bad username or password"
+	failNotAuthorized  = "not authorized"
+	failUnavailable    = "server unavailable"
+	failTimeout        = "timeout"
+	failNetwork        = "network"
+	failOther          = "other"
+)
+
+func classify(err error) string {
+	var ne net.Error
+	switch {
+	case errors.Is(err, packets.ErrorRefusedBadUsernameOrPassword):
+		return failBadCredentials
+	case errors.Is(err, packets.ErrorRefusedNotAuthorised):
+		return failNotAuthorized
+	case errors.Is(err, packets.ErrorRefusedServerUnavailable):
+		return failUnavailable
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, os.ErrDeadlineExceeded), errors.As(err, &ne) && ne.Timeout():
+		return failTimeout
+	case errors.As(err, &ne), errors.Is(err, packets.ErrorNetworkError):
+		return failNetwork
+	}
+	return failOther
+}
+
+// recorder 汇总各连接上报的结果，并发安全。
+type recorder struct {
+	mu           sync.Mutex
+	connect      []time.Duration
+	publish      []time.Duration
+	connectFails map[string]int
+	publishFails map[string]int
+}
+
+func newRecorder() *recorder {
+	return &recorder{connectFails: map[string]int{}, publishFails: map[string]int{}}
+}
+
+func (r *recorder) connected(d time.Duration) {
+	r.mu.Lock()
+	r.connect = append(r.connect, d)
+	r.mu.Unlock()
+}
+
+func (r *recorder) connectFailed(err error) {
+	r.mu.Lock()
+	r.connectFails[classify(err)]++
+	r.mu.Unlock()
+}
+
+func (r *recorder) published(d time.Duration) {
+	r.mu.Lock()
+	r.publish = append(r.publish, d)
+	r.mu.Unlock()
+}
+
+func (r *recorder) publishFailed(err error) {
+	r.mu.Lock()
+	r.publishFails[classify(err)]++
+	r.mu.Unlock()
+}
+
+// percentile 返回已排序样本的第 p 百分位（最近秩法）。
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := int(float64(len(sorted))*p/100+0.5) - 1
+	return sorted[max(0, min(i, len(sorted)-1))]
+}
+
+func writeLatency(w io.Writer, name string, samples []time.Duration, fails map[string]int) {
+	sorted := append([]time.Duration(nil), samples...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	total := 0
+	for _, n := range fails {
+		total += n
+	}
+	fmt.Fprintf(w, "%s: %d ok, %d failed\n", name, len(sorted), total)
+	if len(sorted) > 0 {
+		fmt.Fprintf(w, "  latency p50=%s p90=%s p99=%s max=%s\n",
+			percentile(sorted, 50).Round(time.Microsecond), percentile(sorted, 90).Round(time.Microsecond),
+			percentile(sorted, 99).Round(time.Microsecond), sorted[len(sorted)-1].Round(time.Microsecond))
+	}
+	reasons := make([]string, 0, len(fails))
+	for k := range fails {
+		reasons = append(reasons, k)
+	}
+	// 次数多的原因排前面
+	sort.Slice(reasons, func(i, j int) bool {
+		if fails[reasons[i]] != fails[reasons[j]] {
+			return fails[reasons[i]] > fails[reasons[j]]
+		}
+		return reasons[i] < reasons[j]
+	})
+	for _, k := range reasons {
+		fmt.Fprintf(w, "  %-26s %d\n", k+":", fails[k])
+	}
+}
+
+func (r *recorder) write(w io.Writer, elapsed time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	fmt.Fprintf(w, "elapsed %s\n", elapsed.Round(time.Millisecond))
+	writeLatency(w, "connect (CONNACK)", r.connect, r.connectFails)
+	if len(r.publish) > 0 || len(r.publishFails) > 0 {
+		writeLatency(w, "publish", r.publish, r.publishFails)
+		if s := elapsed.Seconds(); s > 0 {
+			fmt.Fprintf(w, "  throughput %.1f msg/s\n", float64(len(r.publish))/s)
+		}
+	}
+	fmt.Fprintln(w, strings.Repeat("-", 40))
+}
@@ -0,0 +1,159 @@
+// migrate 执行 internal/migrations 内嵌的 schema 迁移：
+//
+//	migrate [-dsn DSN] up [version]   执行到指定版本（默认最新）
+//	migrate [-dsn DSN] down [n]       回滚最近 n 个版本（默认 1）
+//	migrate [-dsn DSN] status         列出各版本及执行时间
+//	migrate [-dsn DSN] [-interval day|week|month] [-retain-days N] [-premake N] partition native|timescale [table...]
+//	                                  把日志表（默认 mosq_pg_stats 与 mosq_pg_config_audit）按 ts 分区；
+//	                                  native 需要定期执行以预建分区、删除过期分区
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"auth-plugin/internal/migrations"
+)
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: migrate [-dsn DSN] up [version] | down [n] | status | partition native|timescale [table...]")
+	flag.PrintDefaults()
+}
+
+func main() {
+	dsn := flag.String("dsn", os.Getenv("PG_DSN"), "PostgreSQL DSN (default $PG_DSN); needs CREATE privileges")
+	timeout := flag.Duration("timeout", 5*time.Minute, "overall timeout")
+	interval := flag.String("interval", "day", "partition: partition/chunk size (day, week or month)")
+	retainDays := flag.Int("retain-days", 0, "partition: drop data older than this many days (0 keeps everything)")
+	premake := flag.Int("premake", 3, "partition native: partitions to create ahead of the current one")
+	flag.Usage = usage
+	flag.Parse()
+
+	cmd, n, err := parseCommand(flag.Args())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "migrate:", err)
+		usage()
+		os.Exit(2)
+	}
+	if *dsn == "" {
+		fmt.Fprintln(os.Stderr, "migrate: -dsn or PG_DSN is required")
+		os.Exit(2)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+	conn, err := pgx.Connect(ctx, *dsn)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "migrate:", err)
+		os.Exit(1)
+	}
+	defer conn.Close(context.Background())
+
+	report := func(verb string) func(migrations.Migration) {
+		return func(m migrations.Migration) {
+			fmt.Fprintf(os.Stderr, "%s %04d_%s\n", verb, m.Version, m.Name)
+		}
+	}
+	switch cmd {
+	case "up":
+		err = migrations.Up(ctx, conn, n, report("applied"))
+	case "down":
+		err = migrations.Down(ctx, conn, n, report("reverted"))
+	case "partition":
+		mode, tables, _ := parsePartition(flag.Args()[1:])
+		opts := migrations.PartitionOptions{
+			Mode:     mode,
+			Interval: *interval,
+			Retain:   time.Duration(*retainDays) * 24 * time.Hour,
+			Premake:  *premake,
+		}
+		err = migrations.Partition(ctx, conn, tables, opts, func(s string) { fmt.Fprintln(os.Stderr, s) })
+	case "status":
+		var states []migrations.State
+		if states, err = migrations.Status(ctx, conn); err == nil {
+			err = writeStatus(os.Stdout, states)
+		}
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "migrate:", err)
+		os.Exit(1)
+	}
+}
+
+// parseCommand 返回子命令及其数字参数：up 的目标版本（0 为最新）或 down 的步数。
+func parseCommand(args []string) (string, int, error) {
+	if len(args) == 0 {
+		return "", 0, fmt.Errorf("missing command")
+	}
+	cmd, rest := args[0], args[1:]
+	n := 0
+	switch cmd {
+	case "status":
+		if len(rest) > 0 {
+			return "", 0, fmt.Errorf("status takes no arguments")
+		}
+		return cmd, 0, nil
+	case "partition":
+		if _, _, err := parsePartition(rest); err != nil {
+			return "", 0, err
+		}
+		return cmd, 0, nil
+	case "down":
+		n = 1
+	case "up":
+	default:
+		return "", 0, fmt.Errorf("unknown command %q", cmd)
+	}
+	if len(rest) > 1 {
+		return "", 0, fmt.Errorf("%s takes at most one argument", cmd)
+	}
+	if len(rest) == 1 {
+		v, err := strconv.Atoi(rest[0])
+		if err != nil || v < 1 {
+			return "", 0, fmt.Errorf("%s: want a positive number, got %q", cmd, rest[0])
+		}
+		n = v
+	}
+	return cmd, n, nil
+}
+
+// parsePartition 返回 partition 的模式与要分区的表；没有指定表时为全部日志表。
+func parsePartition(args []string) (string, []string, error) {
+	if len(args) == 0 {
+		return "", nil, fmt.Errorf("partition: want native or timescale")
+	}
+	mode, tables := args[0], args[1:]
+	if mode != migrations.PartitionNative && mode != migrations.PartitionTimescale {
+		return "", nil, fmt.Errorf("partition: want native or timescale, got %q", mode)
+	}
+	for _, t := range tables {
+		if _, ok := migrations.LogTables[t]; !ok {
+			return "", nil, fmt.Errorf("partition: %s is not a log table", t)
+		}
+	}
+	if len(tables) == 0 {
+		tables = []string{"mosq_pg_config_audit", "mosq_pg_stats"}
+	}
+	return mode, tables, nil
+}
+
+func writeStatus(w io.Writer, states []migrations.State) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "VERSION\tNAME\tAPPLIED")
+	for _, s := range states {
+		applied := "pending"
+		if s.Applied() {
+			applied = s.AppliedAt.UTC().Format(time.RFC3339)
+		}
+		fmt.Fprintf(tw, "%04d\t%s\t%s\n", s.Version, s.Name, applied)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"auth-plugin/internal/migrations"
+)
+
+func TestParseCommand(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		args []string
+		cmd  string
+		n    int
+		ok   bool
+	}{
+		{[]string{"up"}, "up", 0, true},
+		{[]string{"up", "2"}, "up", 2, true},
+		{[]string{"down"}, "down", 1, true},
+		{[]string{"down", "3"}, "down", 3, true},
+		{[]string{"status"}, "status", 0, true},
+		{nil, "", 0, false},
+		{[]string{"sideways"}, "", 0, false},
+		{[]string{"down", "0"}, "", 0, false},
+		{[]string{"up", "x"}, "", 0, false},
+		{[]string{"up", "1", "2"}, "", 0, false},
+		{[]string{"status", "1"}, "", 0, false},
+		{[]string{"partition", "native"}, "partition", 0, true},
+		{[]string{"partition", "timescale", "mosq_pg_stats"}, "partition", 0, true},
+		{[]string{"partition"}, "", 0, false},
+		{[]string{"partition", "citus"}, "", 0, false},
+		{[]string{"partition", "native", "iot_devices"}, "", 0, false},
+	}
+	for _, tt := range tests {
+		cmd, n, err := parseCommand(tt.args)
+		if (err == nil) != tt.ok || cmd != tt.cmd || n != tt.n {
+			t.Errorf("parseCommand(%q) = %q, %d, %v", tt.args, cmd, n, err)
+		}
+	}
+}
+
+func TestParsePartition(t *testing.T) {
+	t.Parallel()
+	mode, tables, err := parsePartition([]string{"native"})
+	if err != nil || mode != "native" || len(tables) != 2 {
+		t.Fatalf("parsePartition(native) = %q, %q, %v", mode, tables, err)
+	}
+	_, tables, _ = parsePartition([]string{"timescale", "mosq_pg_config_audit"})
+	if len(tables) != 1 || tables[0] != "mosq_pg_config_audit" {
+		t.Fatalf("tables = %q", tables)
+	}
+}
+
+func TestWriteStatus(t *testing.T) {
+	t.Parallel()
+	at := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	var buf bytes.Buffer
+	err := writeStatus(&buf, []migrations.State{
+		{Migration: migrations.Migration{Version: 1, Name: "core"}, AppliedAt: at},
+		{Migration: migrations.Migration{Version: 2, Name: "config"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "VERSION  NAME    APPLIED\n0001     core    2024-05-01T12:00:00Z\n0002     config  pending\n"
+	if buf.String() != want {
+		t.Fatalf("status =\n%q\nwant\n%q", buf.String(), want)
+	}
+}
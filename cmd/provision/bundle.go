@@ -0,0 +1,104 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	qrcode "github.com/skip2/go-qrcode"
+
+	"auth-plugin/internal/aclrule"
+)
+
+// 每台设备一个 JSON 凭据包，供产线烧录；可选再生成一张二维码 PNG。
+// 二维码内容是不含 CA 证书的单行 JSON（证书太大，一般随固件下发）。
+
+type bundle struct {
+	Broker      string `json:"broker"`
+	Username    string `json:"username"`
+	Password    string `json:"password"`
+	ClientID    string `json:"client_id"`
+	TopicPrefix string `json:"topic_prefix"`
+	Enabled     bool   `json:"enabled"`
+	CAPEM       string `json:"ca_pem,omitempty"`
+}
+
+type device struct {
+	bundle
+	hash string
+}
+
+type spec struct {
+	broker      string
+	prefix      string
+	clientID    string // 模板，支持 {username}
+	topicPrefix string // 模板，支持 {username}/{clientid}
+	enabled     bool
+	passwordLen int
+	caPEM       string
+}
+
+func randomHex(n int) string {
+	b := make([]byte, (n+1)/2)
+	rand.Read(b)
+	return hex.EncodeToString(b)[:n]
+}
+
+// randomPassword 生成 URL 安全的随机密码，n 为字符数。
+func randomPassword(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)[:n]
+}
+
+func newBundle(s spec) bundle {
+	b := bundle{
+		Broker:   s.broker,
+		Username: s.prefix + randomHex(10),
+		Password: randomPassword(s.passwordLen),
+		Enabled:  s.enabled,
+		CAPEM:    s.caPEM,
+	}
+	b.ClientID = strings.ReplaceAll(s.clientID, "{username}", b.Username)
+	b.TopicPrefix, _ = aclrule.Expand(s.topicPrefix, b.Username, b.ClientID)
+	return b
+}
+
+// qrPayload 是写进二维码的单行 JSON。
+func (b bundle) qrPayload() ([]byte, error) {
+	b.CAPEM = ""
+	return json.Marshal(b)
+}
+
+// writeBundle 写 <dir>/<username>.json（以及可选的 .png），文件只允许属主读取，返回写出的路径。
+func writeBundle(dir string, b bundle, qr bool) ([]string, error) {
+	data, err := json.MarshalIndent(b, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	base := filepath.Join(dir, b.Username)
+	if err := os.WriteFile(base+".json", append(data, '\n'), 0o600); err != nil {
+		return nil, err
+	}
+	paths := []string{base + ".json"}
+	if !qr {
+		return paths, nil
+	}
+	payload, err := b.qrPayload()
+	if err != nil {
+		return paths, err
+	}
+	png, err := qrcode.Encode(string(payload), qrcode.Medium, 512)
+	if err != nil {
+		return paths, fmt.Errorf("%s: qr code: %w", b.Username, err)
+	}
+	if err := os.WriteFile(base+".png", png, 0o600); err != nil {
+		return paths, err
+	}
+	return append(paths, base+".png"), nil
+}
@@ -0,0 +1,209 @@
+// provision 批量生成设备：随机用户名和密码，写入 iot_devices（启用或待激活），
+// 并为每台设备输出 JSON 凭据包（可选二维码 PNG），包含 broker 地址、用户名、密码、client id 和主题前缀，供产线烧录。
+//
+// 先写凭据包再在一个事务中入库；入库失败时删除已写出的文件，保证文件和库里的设备一一对应。
+// stdout 输出不含密码的清单 CSV（username,client_id,enabled）。
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"golang.org/x/crypto/bcrypt"
+
+	"auth-plugin/internal/aclrule"
+)
+
+const (
+	insertDevice = `INSERT INTO iot_devices (username, password_hash, salt, enabled)
+VALUES ($1, $2, '', $3) ON CONFLICT (username) DO NOTHING`
+	insertBinding = "INSERT INTO client_bindings (username, client_id) VALUES ($1, $2) ON CONFLICT DO NOTHING"
+	upsertACL     = `INSERT INTO acls (username, pattern, acc) VALUES ($1, $2, $3)
+ON CONFLICT (username, pattern) DO UPDATE SET acc = EXCLUDED.acc`
+)
+
+type options struct {
+	spec
+	n       int
+	cost    int
+	bind    bool
+	acc     int
+	outDir  string
+	qr      bool
+	pending bool
+}
+
+func main() {
+	var o options
+	var access, caFile string
+	flag.IntVar(&o.n, "n", 1, "number of devices to create")
+	flag.StringVar(&o.broker, "broker", "", "broker address written into the bundles, e.g. mqtts://mqtt.example.com:8883 (required)")
+	flag.StringVar(&o.prefix, "prefix", "dev-", "username prefix; a random 10-hex-digit suffix is appended")
+	flag.StringVar(&o.clientID, "clientid", "{username}", "client id template")
+	flag.StringVar(&o.topicPrefix, "topic-prefix", "devices/{username}", "topic prefix template ({username}, {clientid})")
+	flag.IntVar(&o.passwordLen, "password-length", 24, "generated password length")
+	flag.IntVar(&o.cost, "cost", bcrypt.DefaultCost, "bcrypt cost")
+	flag.BoolVar(&o.pending, "pending", false, "create the devices disabled until activated (useradm enable)")
+	flag.BoolVar(&o.bind, "bind", false, "also bind each username to its client id in client_bindings")
+	flag.StringVar(&access, "acl", "", "also grant this access on <topic-prefix>/#, e.g. read,write,subscribe")
+	flag.StringVar(&caFile, "ca-file", "", "CA certificate (PEM) embedded in the JSON bundles")
+	flag.StringVar(&o.outDir, "out", "bundles", "directory for the per-device bundles")
+	flag.BoolVar(&o.qr, "qr", false, "also write a QR code PNG per device")
+	dsn := flag.String("dsn", os.Getenv("PG_DSN"), "PostgreSQL DSN (default $PG_DSN)")
+	flag.Parse()
+
+	o.enabled = !o.pending
+	if err := o.check(access, caFile); err != nil {
+		fmt.Fprintln(os.Stderr, "provision:", err)
+		os.Exit(2)
+	}
+	if *dsn == "" {
+		fmt.Fprintln(os.Stderr, "provision: -dsn or PG_DSN is required")
+		os.Exit(2)
+	}
+	devices, err := generate(o)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "provision:", err)
+		os.Exit(1)
+	}
+	if err := run(*dsn, o, devices); err != nil {
+		fmt.Fprintln(os.Stderr, "provision:", err)
+		os.Exit(1)
+	}
+	fmt.Fprintf(os.Stderr, "provisioned %d device(s), bundles in %s\n", len(devices), o.outDir)
+}
+
+func (o *options) check(access, caFile string) error {
+	switch {
+	case o.n <= 0:
+		return errors.New("-n must be positive")
+	case o.broker == "":
+		return errors.New("-broker is required")
+	case o.passwordLen < 12 || o.passwordLen > 128:
+		return errors.New("-password-length must be 12-128")
+	case o.cost < bcrypt.MinCost || o.cost > bcrypt.MaxCost:
+		return fmt.Errorf("-cost must be %d-%d", bcrypt.MinCost, bcrypt.MaxCost)
+	case strings.ContainsAny(o.prefix, "+#/:"):
+		return errors.New("-prefix cannot contain +, #, / or :")
+	case strings.ContainsAny(o.clientID, "+#/"):
+		return errors.New("-clientid cannot contain +, # or /")
+	}
+	if err := aclrule.ValidatePattern(o.topicPrefix + "/#"); err != nil {
+		return fmt.Errorf("-topic-prefix: %w", err)
+	}
+	if access != "" {
+		acc, err := aclrule.ParseAcc(access)
+		if err != nil {
+			return fmt.Errorf("-acl: %w", err)
+		}
+		o.acc = acc
+	}
+	if caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return err
+		}
+		o.caPEM = string(pem)
+	}
+	return nil
+}
+
+// generate 并行计算 bcrypt，cost 较高时批量生成也不会太慢。
+func generate(o options) ([]device, error) {
+	devices := make([]device, o.n)
+	errs := make([]error, o.n)
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, runtime.GOMAXPROCS(0))
+	for i := range devices {
+		devices[i].bundle = newBundle(o.spec)
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(d *device, err *error) {
+			defer func() { <-sem; wg.Done() }()
+			h, e := bcrypt.GenerateFromPassword([]byte(d.Password), o.cost)
+			d.hash, *err = string(h), e
+		}(&devices[i], &errs[i])
+	}
+	wg.Wait()
+	return devices, errors.Join(errs...)
+}
+
+func run(dsn string, o options, devices []device) error {
+	if err := os.MkdirAll(o.outDir, 0o700); err != nil {
+		return err
+	}
+	var written []string
+	cleanup := func() {
+		for _, p := range written {
+			os.Remove(p)
+		}
+	}
+	for _, d := range devices {
+		paths, err := writeBundle(o.outDir, d.bundle, o.qr)
+		written = append(written, paths...)
+		if err != nil {
+			cleanup()
+			return err
+		}
+	}
+	if err := insert(dsn, o, devices); err != nil {
+		cleanup()
+		return fmt.Errorf("%w (no device was created, bundles removed)", err)
+	}
+	w := csv.NewWriter(os.Stdout)
+	w.Write([]string{"username", "client_id", "enabled"})
+	for _, d := range devices {
+		w.Write([]string{d.Username, d.ClientID, strconv.FormatBool(d.Enabled)})
+	}
+	w.Flush()
+	return w.Error()
+}
+
+func enabledFlag(enabled bool) int16 {
+	if enabled {
+		return 1
+	}
+	return 0
+}
+
+func insert(dsn string, o options, devices []device) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+	conn, err := pgx.Connect(ctx, dsn)
+	if err != nil {
+		return err
+	}
+	defer conn.Close(context.Background())
+	return pgx.BeginFunc(ctx, conn, func(tx pgx.Tx) error {
+		for _, d := range devices {
+			tag, err := tx.Exec(ctx, insertDevice, d.Username, d.hash, enabledFlag(d.Enabled))
+			if err != nil {
+				return fmt.Errorf("%s: %w", d.Username, err)
+			}
+			if tag.RowsAffected() == 0 {
+				return fmt.Errorf("%s already exists; rerun to draw new usernames", d.Username)
+			}
+			if o.bind {
+				if _, err := tx.Exec(ctx, insertBinding, d.Username, d.ClientID); err != nil {
+					return fmt.Errorf("%s: bind: %w", d.Username, err)
+				}
+			}
+			if o.acc != 0 {
+				if _, err := tx.Exec(ctx, upsertACL, d.Username, d.TopicPrefix+"/#", o.acc); err != nil {
+					return fmt.Errorf("%s: acl: %w", d.Username, err)
+				}
+			}
+		}
+		return nil
+	})
+}
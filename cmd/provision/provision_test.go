@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func testOptions() options {
+	return options{
+		spec: spec{broker: "mqtts://mqtt.example.com:8883", prefix: "line1-", clientID: "{username}-fw",
+			topicPrefix: "devices/{clientid}", enabled: false, passwordLen: 20},
+		n:    3,
+		cost: bcrypt.MinCost,
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	t.Parallel()
+	devices, err := generate(testOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	seen := map[string]bool{}
+	for _, d := range devices {
+		if !strings.HasPrefix(d.Username, "line1-") || len(d.Username) != len("line1-")+10 {
+			t.Errorf("username = %q", d.Username)
+		}
+		if seen[d.Username] || seen[d.Password] {
+			t.Errorf("duplicate credentials in %+v", d.bundle)
+		}
+		seen[d.Username], seen[d.Password] = true, true
+		if len(d.Password) != 20 || bcrypt.CompareHashAndPassword([]byte(d.hash), []byte(d.Password)) != nil {
+			t.Errorf("password %q does not match hash %q", d.Password, d.hash)
+		}
+		if d.ClientID != d.Username+"-fw" || d.TopicPrefix != "devices/"+d.ClientID || d.Enabled {
+			t.Errorf("bundle = %+v", d.bundle)
+		}
+	}
+}
+
+func TestCheck(t *testing.T) {
+	t.Parallel()
+	o := testOptions()
+	if err := o.check("read,write", ""); err != nil || o.acc != 3 {
+		t.Fatalf("check = %v, acc = %d", err, o.acc)
+	}
+	for _, mut := range []func(*options){
+		func(o *options) { o.broker = "" },
+		func(o *options) { o.prefix = "a/b" },
+		func(o *options) { o.topicPrefix = "devices/#" },
+		func(o *options) { o.passwordLen = 8 },
+	} {
+		o := testOptions()
+		mut(&o)
+		if err := o.check("", ""); err == nil {
+			t.Errorf("check(%+v) should fail", o)
+		}
+	}
+	if o := testOptions(); o.check("publish", "") == nil {
+		t.Error("invalid -acl should fail")
+	}
+}
+
+func TestWriteBundle(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	b := bundle{Broker: "mqtt://b:1883", Username: "dev-1", Password: "pw", ClientID: "dev-1", TopicPrefix: "devices/dev-1", Enabled: true, CAPEM: "-----BEGIN CERTIFICATE-----"}
+	paths, err := writeBundle(dir, b, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) != 2 || filepath.Ext(paths[1]) != ".png" {
+		t.Fatalf("paths = %v", paths)
+	}
+	st, err := os.Stat(paths[0])
+	if err != nil || st.Mode().Perm() != 0o600 {
+		t.Errorf("bundle mode = %v, %v", st.Mode(), err)
+	}
+	data, _ := os.ReadFile(paths[0])
+	var back bundle
+	if err := json.Unmarshal(data, &back); err != nil || back != b {
+		t.Errorf("bundle round trip = %+v, %v", back, err)
+	}
+	payload, _ := b.qrPayload()
+	if strings.Contains(string(payload), "CERTIFICATE") || !strings.Contains(string(payload), `"password":"pw"`) {
+		t.Errorf("qr payload = %s", payload)
+	}
+}
@@ -0,0 +1,315 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+)
+
+const maxBody = 1 << 20
+
+type server struct {
+	db     *db
+	token  string
+	logger *log.Logger
+}
+
+func (s *server) routes() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /scim/v2/ServiceProviderConfig", s.serviceProviderConfig)
+	mux.HandleFunc("GET /scim/v2/Users", s.listUsers)
+	mux.HandleFunc("POST /scim/v2/Users", s.createUser)
+	mux.HandleFunc("GET /scim/v2/Users/{id}", s.getUser)
+	mux.HandleFunc("PUT /scim/v2/Users/{id}", s.replaceUser)
+	mux.HandleFunc("PATCH /scim/v2/Users/{id}", s.patchUser)
+	mux.HandleFunc("DELETE /scim/v2/Users/{id}", s.deleteUser)
+	mux.HandleFunc("GET /scim/v2/Groups", s.listGroups)
+	mux.HandleFunc("POST /scim/v2/Groups", s.createGroup)
+	mux.HandleFunc("GET /scim/v2/Groups/{id}", s.getGroup)
+	mux.HandleFunc("PUT /scim/v2/Groups/{id}", s.replaceGroup)
+	mux.HandleFunc("PATCH /scim/v2/Groups/{id}", s.patchGroup)
+	mux.HandleFunc("DELETE /scim/v2/Groups/{id}", s.deleteGroup)
+	return s.authenticate(mux)
+}
+
+// authenticate 要求 Authorization: Bearer <token>（IdP 中配置的 Secret Token）。
+func (s *server) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(got), []byte(s.token)) != 1 {
+			writeError(w, &scimError{status: http.StatusUnauthorized, detail: "missing or wrong bearer token"})
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, maxBody)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// fail 写错误响应；非 SCIM 错误（数据库故障等）记录日志，只向客户端返回 500。
+func (s *server) fail(w http.ResponseWriter, r *http.Request, err error) {
+	var se *scimError
+	if !errors.As(err, &se) {
+		s.logger.Printf("%s %s: %v", r.Method, r.URL.Path, err)
+	}
+	writeError(w, err)
+}
+
+func decode(r *http.Request, v any) error {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		return badRequest("invalidSyntax", "invalid JSON: %v", err)
+	}
+	return nil
+}
+
+func location(r *http.Request, kind, id string) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host + "/scim/v2/" + kind + "/" + id
+}
+
+func list(start int, total int, items []any) listResponse {
+	if items == nil {
+		items = []any{}
+	}
+	return listResponse{Schemas: []string{schemaList}, TotalResults: total, StartIndex: start, ItemsPerPage: len(items), Resources: items}
+}
+
+func (s *server) serviceProviderConfig(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{
+		"schemas":        []string{schemaSPConfig},
+		"patch":          map[string]bool{"supported": true},
+		"bulk":           map[string]any{"supported": false, "maxOperations": 0, "maxPayloadSize": 0},
+		"filter":         map[string]any{"supported": true, "maxResults": maxPageSize},
+		"changePassword": map[string]bool{"supported": true},
+		"sort":           map[string]bool{"supported": false},
+		"etag":           map[string]bool{"supported": false},
+		"authenticationSchemes": []map[string]any{{
+			"type": "oauthbearertoken", "name": "Bearer token", "description": "Static bearer token", "primary": true,
+		}},
+	})
+}
+
+func (s *server) listUsers(w http.ResponseWriter, r *http.Request) {
+	f, err := parseFilter(r.URL.Query().Get("filter"), "username", "externalid")
+	if err != nil {
+		s.fail(w, r, err)
+		return
+	}
+	start, count := page(r)
+	users, total, err := s.db.listUsers(r.Context(), f, start, count)
+	if err != nil {
+		s.fail(w, r, err)
+		return
+	}
+	items := make([]any, 0, len(users))
+	for _, u := range users {
+		u.Meta.Location = location(r, "Users", u.ID)
+		items = append(items, u)
+	}
+	writeJSON(w, http.StatusOK, list(start, total, items))
+}
+
+func (s *server) writeUser(w http.ResponseWriter, r *http.Request, status int, id string) {
+	u, err := s.db.getUser(r.Context(), id)
+	if err != nil {
+		s.fail(w, r, err)
+		return
+	}
+	u.Meta.Location = location(r, "Users", u.ID)
+	if status == http.StatusCreated {
+		w.Header().Set("Location", u.Meta.Location)
+	}
+	writeJSON(w, status, u)
+}
+
+func (s *server) getUser(w http.ResponseWriter, r *http.Request) {
+	s.writeUser(w, r, http.StatusOK, r.PathValue("id"))
+}
+
+func (s *server) createUser(w http.ResponseWriter, r *http.Request) {
+	var in scimUser
+	if err := decode(r, &in); err != nil {
+		s.fail(w, r, err)
+		return
+	}
+	id, err := s.db.createUser(r.Context(), in)
+	if err != nil {
+		s.fail(w, r, err)
+		return
+	}
+	s.logger.Printf("created user %s (%s)", in.UserName, id)
+	s.writeUser(w, r, http.StatusCreated, id)
+}
+
+// replaceUser 处理 PUT：userName 必须与现有值相同，未给出的 active 视为 true，未给出的 password 保持不变。
+func (s *server) replaceUser(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	var in scimUser
+	if err := decode(r, &in); err != nil {
+		s.fail(w, r, err)
+		return
+	}
+	cur, err := s.db.getUser(r.Context(), id)
+	if err != nil {
+		s.fail(w, r, err)
+		return
+	}
+	if in.UserName != cur.UserName {
+		s.fail(w, r, badRequest("mutability", "userName cannot be changed; delete and recreate the user"))
+		return
+	}
+	active := in.Active == nil || *in.Active
+	c := userChange{displayName: &in.DisplayName, externalID: &in.ExternalID, active: &active}
+	if in.Password != "" {
+		c.password = &in.Password
+	}
+	if err := s.db.updateUser(r.Context(), id, c); err != nil {
+		s.fail(w, r, err)
+		return
+	}
+	s.writeUser(w, r, http.StatusOK, id)
+}
+
+func (s *server) patchUser(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	var in patchRequest
+	if err := decode(r, &in); err != nil {
+		s.fail(w, r, err)
+		return
+	}
+	c, err := applyUserPatch(in.Operations)
+	if err == nil {
+		err = s.db.updateUser(r.Context(), id, c)
+	}
+	if err != nil {
+		s.fail(w, r, err)
+		return
+	}
+	if c.active != nil {
+		s.logger.Printf("user %s active=%t", id, *c.active)
+	}
+	s.writeUser(w, r, http.StatusOK, id)
+}
+
+func (s *server) deleteUser(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if err := s.db.deleteUser(r.Context(), id); err != nil {
+		s.fail(w, r, err)
+		return
+	}
+	s.logger.Printf("deleted user %s", id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// wantMembers 在请求用 excludedAttributes=members 排除成员时返回 false（Entra ID 查询组时会这样做）。
+func wantMembers(r *http.Request) bool {
+	for _, a := range strings.Split(r.URL.Query().Get("excludedAttributes"), ",") {
+		if strings.EqualFold(strings.TrimSpace(a), "members") {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *server) listGroups(w http.ResponseWriter, r *http.Request) {
+	f, err := parseFilter(r.URL.Query().Get("filter"), "displayname", "externalid")
+	if err != nil {
+		s.fail(w, r, err)
+		return
+	}
+	start, count := page(r)
+	groups, total, err := s.db.listGroups(r.Context(), f, start, count, wantMembers(r))
+	if err != nil {
+		s.fail(w, r, err)
+		return
+	}
+	items := make([]any, 0, len(groups))
+	for _, g := range groups {
+		g.Meta.Location = location(r, "Groups", g.ID)
+		items = append(items, g)
+	}
+	writeJSON(w, http.StatusOK, list(start, total, items))
+}
+
+func (s *server) writeGroup(w http.ResponseWriter, r *http.Request, status int, id string) {
+	g, err := s.db.getGroup(r.Context(), id, wantMembers(r))
+	if err != nil {
+		s.fail(w, r, err)
+		return
+	}
+	g.Meta.Location = location(r, "Groups", g.ID)
+	if status == http.StatusCreated {
+		w.Header().Set("Location", g.Meta.Location)
+	}
+	writeJSON(w, status, g)
+}
+
+func (s *server) getGroup(w http.ResponseWriter, r *http.Request) {
+	s.writeGroup(w, r, http.StatusOK, r.PathValue("id"))
+}
+
+func (s *server) createGroup(w http.ResponseWriter, r *http.Request) {
+	var in scimGroup
+	if err := decode(r, &in); err != nil {
+		s.fail(w, r, err)
+		return
+	}
+	id, err := s.db.createGroup(r.Context(), in)
+	if err != nil {
+		s.fail(w, r, err)
+		return
+	}
+	s.logger.Printf("created group %q (%s)", in.DisplayName, id)
+	s.writeGroup(w, r, http.StatusCreated, id)
+}
+
+func (s *server) replaceGroup(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	var in scimGroup
+	if err := decode(r, &in); err != nil {
+		s.fail(w, r, err)
+		return
+	}
+	if strings.TrimSpace(in.DisplayName) == "" {
+		s.fail(w, r, badRequest("invalidValue", "displayName is required"))
+		return
+	}
+	if err := s.db.updateGroup(r.Context(), id, groupChange{displayName: &in.DisplayName, replace: refIDs(in.Members)}); err != nil {
+		s.fail(w, r, err)
+		return
+	}
+	s.writeGroup(w, r, http.StatusOK, id)
+}
+
+func (s *server) patchGroup(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	var in patchRequest
+	if err := decode(r, &in); err != nil {
+		s.fail(w, r, err)
+		return
+	}
+	c, err := applyGroupPatch(in.Operations)
+	if err == nil {
+		err = s.db.updateGroup(r.Context(), id, c)
+	}
+	if err != nil {
+		s.fail(w, r, err)
+		return
+	}
+	s.writeGroup(w, r, http.StatusOK, id)
+}
+
+func (s *server) deleteGroup(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	if err := s.db.deleteGroup(r.Context(), id); err != nil {
+		s.fail(w, r, err)
+		return
+	}
+	s.logger.Printf("deleted group %s", id)
+	w.WriteHeader(http.StatusNoContent)
+}
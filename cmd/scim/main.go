@@ -0,0 +1,126 @@
+// scim 是 SCIM 2.0 开通服务：企业 IdP（Entra ID、Okta 等）通过 /scim/v2/Users 与 /scim/v2/Groups
+// 创建、停用、删除看板/运维账号，账号直接写入插件的 iot_devices；SCIM 元数据保存在迁移 0007 的 scim_* 表中。
+//
+// 角色映射（-role-map "MQTT Admins=ops-admin"）：用户所在组映射到的角色模板（acls 中的普通用户名，
+// 只用来存放规则）的规则合并后写成该用户的 acls，组成员变化时立即重算，-refresh-interval 定期重算
+// 以应用模板规则的修改。配置了 -role-map 时 SCIM 用户的 acls 完全由组决定，手工添加的规则会被覆盖。
+//
+//   - active=false 停用账号（enabled=0），DELETE 删除账号及其规则；
+//   - password 可选，按 bcrypt 存储；不给时账号没有密码，只能通过其他方式认证；
+//   - userName 不能修改；与已有的非 SCIM 账号同名时返回 409，不接管现有账号；
+//   - 只支持 PostgreSQL。
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func main() {
+	dsn := flag.String("dsn", os.Getenv("PG_DSN"), "PostgreSQL DSN (default $PG_DSN)")
+	listen := flag.String("listen", ":8443", "listen address")
+	tlsCert := flag.String("tls-cert", "", "TLS certificate (PEM); without it the server speaks plain HTTP and must sit behind a TLS proxy")
+	tlsKey := flag.String("tls-key", "", "TLS private key (PEM)")
+	tokenFile := flag.String("token-file", "", "file holding the bearer token configured in the IdP (default $SCIM_TOKEN)")
+	roleMap := flag.String("role-map", "", "comma-separated group=role pairs; role is an acls username whose rules members inherit")
+	refresh := flag.Duration("refresh-interval", 5*time.Minute, "re-expand role rules for all SCIM users every interval (0 = only on group changes)")
+	cost := flag.Int("cost", bcrypt.DefaultCost, "bcrypt cost for passwords sent by the IdP")
+	flag.Parse()
+
+	token := os.Getenv("SCIM_TOKEN")
+	if *tokenFile != "" {
+		b, err := os.ReadFile(*tokenFile)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "scim:", err)
+			os.Exit(2)
+		}
+		token = strings.TrimSpace(string(b))
+	}
+	roles, err := parseRoleMap(*roleMap)
+	switch {
+	case *dsn == "":
+		fmt.Fprintln(os.Stderr, "scim: -dsn or PG_DSN is required")
+		os.Exit(2)
+	case len(token) < 16:
+		fmt.Fprintln(os.Stderr, "scim: a bearer token of at least 16 characters is required (-token-file or SCIM_TOKEN)")
+		os.Exit(2)
+	case (*tlsCert == "") != (*tlsKey == ""):
+		fmt.Fprintln(os.Stderr, "scim: -tls-cert and -tls-key go together")
+		os.Exit(2)
+	case *cost < bcrypt.MinCost || *cost > bcrypt.MaxCost:
+		fmt.Fprintf(os.Stderr, "scim: -cost must be %d-%d\n", bcrypt.MinCost, bcrypt.MaxCost)
+		os.Exit(2)
+	case err != nil:
+		fmt.Fprintln(os.Stderr, "scim:", err)
+		os.Exit(2)
+	}
+
+	logger := log.New(os.Stderr, "scim: ", log.LstdFlags)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	pool, err := pgxpool.New(ctx, *dsn)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	defer pool.Close()
+	d := &db{p: pool, cost: *cost, roles: roles}
+	if len(roles) > 0 && *refresh > 0 {
+		go refreshLoop(ctx, d, *refresh, logger)
+	}
+
+	srv := &http.Server{
+		Addr:              *listen,
+		Handler:           (&server{db: d, token: token, logger: logger}).routes(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		<-ctx.Done()
+		shutdown, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdown)
+	}()
+	if *tlsCert == "" {
+		logger.Printf("serving plain HTTP on %s; terminate TLS in front of it", *listen)
+		err = srv.ListenAndServe()
+	} else {
+		logger.Printf("serving HTTPS on %s", *listen)
+		err = srv.ListenAndServeTLS(*tlsCert, *tlsKey)
+	}
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		logger.Fatal(err)
+	}
+	logger.Println("stopping")
+}
+
+// refreshLoop 定期重算角色规则；单轮失败只记录，下一轮重试。
+func refreshLoop(ctx context.Context, d *db, every time.Duration, logger *log.Logger) {
+	tick := time.NewTicker(every)
+	defer tick.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick.C:
+		}
+		rctx, cancel := context.WithTimeout(ctx, time.Minute)
+		n, err := d.refreshRoles(rctx)
+		cancel()
+		if err != nil {
+			logger.Println("refreshing roles:", err)
+			continue
+		}
+		logger.Printf("re-expanded roles for %d user(s)", n)
+	}
+}
@@ -0,0 +1,344 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SCIM 2.0（RFC 7643/7644）中本服务用到的部分：User、Group、ListResponse、PatchOp 与错误响应。
+
+const (
+	schemaUser      = "urn:ietf:params:scim:schemas:core:2.0:User"
+	schemaGroup     = "urn:ietf:params:scim:schemas:core:2.0:Group"
+	schemaList      = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	schemaError     = "urn:ietf:params:scim:api:messages:2.0:Error"
+	schemaSPConfig  = "urn:ietf:params:scim:schemas:core:2.0:ServiceProviderConfig"
+	scimContentType = "application/scim+json"
+
+	maxPageSize = 200
+)
+
+type meta struct {
+	ResourceType string `json:"resourceType"`
+	Created      string `json:"created,omitempty"`
+	LastModified string `json:"lastModified,omitempty"`
+	Location     string `json:"location,omitempty"`
+}
+
+type memberRef struct {
+	Value   string `json:"value"`
+	Display string `json:"display,omitempty"`
+}
+
+type scimUser struct {
+	Schemas     []string    `json:"schemas"`
+	ID          string      `json:"id,omitempty"`
+	ExternalID  string      `json:"externalId,omitempty"`
+	UserName    string      `json:"userName"`
+	DisplayName string      `json:"displayName,omitempty"`
+	Active      *bool       `json:"active,omitempty"`
+	Password    string      `json:"password,omitempty"` // 只写，响应中不返回
+	Groups      []memberRef `json:"groups,omitempty"`
+	Meta        *meta       `json:"meta,omitempty"`
+}
+
+type scimGroup struct {
+	Schemas     []string    `json:"schemas"`
+	ID          string      `json:"id,omitempty"`
+	ExternalID  string      `json:"externalId,omitempty"`
+	DisplayName string      `json:"displayName"`
+	Members     []memberRef `json:"members,omitempty"`
+	Meta        *meta       `json:"meta,omitempty"`
+}
+
+type listResponse struct {
+	Schemas      []string `json:"schemas"`
+	TotalResults int      `json:"totalResults"`
+	StartIndex   int      `json:"startIndex"`
+	ItemsPerPage int      `json:"itemsPerPage"`
+	Resources    []any    `json:"Resources"`
+}
+
+type patchRequest struct {
+	Schemas    []string  `json:"schemas"`
+	Operations []patchOp `json:"Operations"`
+}
+
+type patchOp struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	Value json.RawMessage `json:"value"`
+}
+
+// scimError 是带 HTTP 状态与 scimType 的错误，按 RFC 7644 3.12 输出。
+type scimError struct {
+	status   int
+	scimType string
+	detail   string
+}
+
+func (e *scimError) Error() string { return e.detail }
+
+func badRequest(scimType, format string, args ...any) error {
+	return &scimError{http.StatusBadRequest, scimType, fmt.Sprintf(format, args...)}
+}
+
+var (
+	errNotFound = &scimError{status: http.StatusNotFound, detail: "resource not found"}
+	errConflict = &scimError{status: http.StatusConflict, scimType: "uniqueness", detail: "resource already exists"}
+)
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", scimContentType)
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	var se *scimError
+	if !errors.As(err, &se) {
+		se = &scimError{status: http.StatusInternalServerError, detail: "internal error"}
+	}
+	body := map[string]any{
+		"schemas": []string{schemaError},
+		"status":  strconv.Itoa(se.status),
+		"detail":  se.detail,
+	}
+	if se.scimType != "" {
+		body["scimType"] = se.scimType
+	}
+	writeJSON(w, se.status, body)
+}
+
+// filter 是支持的唯一过滤形式：<attr> eq "<value>"，IdP 查找已有账号时用的就是它。
+type filter struct {
+	attr  string
+	value string
+}
+
+var filterRe = regexp.MustCompile(`^\s*([A-Za-z.]+)\s+(?i:eq)\s+"((?:[^"\\]|\\.)*)"\s*$`)
+
+// parseFilter 解析 filter 参数；allowed 为可过滤的属性（小写）。空串返回 nil。
+func parseFilter(s string, allowed ...string) (*filter, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+	m := filterRe.FindStringSubmatch(s)
+	if m == nil {
+		return nil, badRequest("invalidFilter", "only `attribute eq \"value\"` filters are supported")
+	}
+	attr := strings.ToLower(m[1])
+	for _, a := range allowed {
+		if attr == a {
+			var v string
+			if err := json.Unmarshal([]byte(`"`+m[2]+`"`), &v); err != nil {
+				return nil, badRequest("invalidFilter", "bad string in filter")
+			}
+			return &filter{attr: attr, value: v}, nil
+		}
+	}
+	return nil, badRequest("invalidFilter", "cannot filter on %s", m[1])
+}
+
+// page 解析 startIndex（从 1 开始）与 count。
+func page(r *http.Request) (start, count int) {
+	start, count = 1, maxPageSize
+	if n, err := strconv.Atoi(r.URL.Query().Get("startIndex")); err == nil && n > 1 {
+		start = n
+	}
+	if n, err := strconv.Atoi(r.URL.Query().Get("count")); err == nil && n >= 0 && n < maxPageSize {
+		count = n
+	}
+	return start, count
+}
+
+// newID 生成随机的 UUIDv4 作为资源 id。
+func newID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	h := hex.EncodeToString(b[:])
+	return h[:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:]
+}
+
+func timestamp(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
+
+// userChange 是一次用户修改的结果，nil 字段表示不变。
+type userChange struct {
+	displayName *string
+	externalID  *string
+	active      *bool
+	password    *string
+}
+
+// applyUserPatch 把 PATCH 操作转换为 userChange；userName 与未知属性被拒绝。
+// 支持 Entra ID / Okta 常见的两种写法：带 path 的单属性操作，和不带 path、value 为对象的 replace。
+func applyUserPatch(ops []patchOp) (userChange, error) {
+	var c userChange
+	for _, op := range ops {
+		kind := strings.ToLower(op.Op)
+		if kind != "replace" && kind != "add" {
+			return c, badRequest("invalidValue", "operation %q is not supported on users", op.Op)
+		}
+		values := map[string]json.RawMessage{}
+		if op.Path == "" {
+			if err := json.Unmarshal(op.Value, &values); err != nil {
+				return c, badRequest("invalidValue", "patch without path needs an object value")
+			}
+		} else {
+			values[op.Path] = op.Value
+		}
+		for path, raw := range values {
+			if err := c.set(path, raw); err != nil {
+				return c, err
+			}
+		}
+	}
+	return c, nil
+}
+
+func (c *userChange) set(path string, raw json.RawMessage) error {
+	switch strings.ToLower(path) {
+	case "active":
+		var b bool
+		// Entra ID 早期版本把布尔值写成字符串 "True"/"False"
+		if err := json.Unmarshal(raw, &b); err != nil {
+			var s string
+			if json.Unmarshal(raw, &s) != nil {
+				return badRequest("invalidValue", "active must be a boolean")
+			}
+			parsed, err := strconv.ParseBool(strings.ToLower(s))
+			if err != nil {
+				return badRequest("invalidValue", "active must be a boolean")
+			}
+			b = parsed
+		}
+		c.active = &b
+	case "displayname", "externalid", "password":
+		var s string
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return badRequest("invalidValue", "%s must be a string", path)
+		}
+		switch strings.ToLower(path) {
+		case "displayname":
+			c.displayName = &s
+		case "externalid":
+			c.externalID = &s
+		default:
+			c.password = &s
+		}
+	case "username":
+		return badRequest("mutability", "userName cannot be changed; delete and recreate the user")
+	default:
+		// 姓名、邮箱等属性不存储，忽略而不是报错，IdP 的默认映射里通常都有
+	}
+	return nil
+}
+
+// groupChange 是一次组修改的结果。
+type groupChange struct {
+	displayName *string
+	add         []string
+	remove      []string
+	replace     []string // 非 nil 时整体替换成员
+}
+
+var memberPathRe = regexp.MustCompile(`(?i)^members\[value\s+eq\s+"([^"]+)"\]$`)
+
+// applyGroupPatch 把 PATCH 操作转换为 groupChange，支持成员的 add/remove/replace 与 displayName 的 replace。
+func applyGroupPatch(ops []patchOp) (groupChange, error) {
+	var c groupChange
+	for _, op := range ops {
+		kind, path := strings.ToLower(op.Op), strings.TrimSpace(op.Path)
+		switch {
+		case strings.EqualFold(path, "members"):
+			var refs []memberRef
+			if kind != "remove" || len(op.Value) > 0 {
+				if err := json.Unmarshal(op.Value, &refs); err != nil {
+					return c, badRequest("invalidValue", "members must be a list of {\"value\": id}")
+				}
+			}
+			ids := refIDs(refs)
+			switch kind {
+			case "add":
+				c.add = append(c.add, ids...)
+			case "remove":
+				if len(op.Value) == 0 {
+					c.replace = []string{}
+				} else {
+					c.remove = append(c.remove, ids...)
+				}
+			case "replace":
+				c.replace = ids
+			default:
+				return c, badRequest("invalidValue", "operation %q is not supported", op.Op)
+			}
+		case memberPathRe.MatchString(path) && kind == "remove":
+			c.remove = append(c.remove, memberPathRe.FindStringSubmatch(path)[1])
+		case strings.EqualFold(path, "displayName") && kind == "replace":
+			var s string
+			if err := json.Unmarshal(op.Value, &s); err != nil || s == "" {
+				return c, badRequest("invalidValue", "displayName must be a non-empty string")
+			}
+			c.displayName = &s
+		case path == "" && kind == "replace":
+			var v struct {
+				DisplayName *string     `json:"displayName"`
+				Members     []memberRef `json:"members"`
+			}
+			if err := json.Unmarshal(op.Value, &v); err != nil {
+				return c, badRequest("invalidValue", "patch without path needs an object value")
+			}
+			if v.DisplayName != nil {
+				c.displayName = v.DisplayName
+			}
+			if v.Members != nil {
+				c.replace = refIDs(v.Members)
+			}
+		default:
+			return c, badRequest("invalidPath", "unsupported patch %s %q on groups", op.Op, op.Path)
+		}
+	}
+	return c, nil
+}
+
+func refIDs(refs []memberRef) []string {
+	ids := make([]string, 0, len(refs))
+	for _, r := range refs {
+		ids = append(ids, r.Value)
+	}
+	return ids
+}
+
+// parseRoleMap 解析 -role-map："MQTT Admins=ops-admin,MQTT Viewers=ops-viewer"。
+// 键是 SCIM 组的 displayName（不区分大小写），值是 acls 中作为模板的用户名。
+func parseRoleMap(s string) (map[string]string, error) {
+	m := map[string]string{}
+	for _, item := range strings.Split(s, ",") {
+		if strings.TrimSpace(item) == "" {
+			continue
+		}
+		group, role, ok := strings.Cut(item, "=")
+		group, role = strings.TrimSpace(group), strings.TrimSpace(role)
+		if !ok || group == "" || role == "" || role == "*" {
+			return nil, fmt.Errorf("role map entry %q: want group=role", item)
+		}
+		key := strings.ToLower(group)
+		if _, dup := m[key]; dup {
+			return nil, fmt.Errorf("role map: group %q mapped twice", group)
+		}
+		m[key] = role
+	}
+	return m, nil
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestParseFilter(t *testing.T) {
+	t.Parallel()
+	f, err := parseFilter(`userName eq "ops\"1"`, "username", "externalid")
+	if err != nil || f == nil || f.attr != "username" || f.value != `ops"1` {
+		t.Fatalf("got %+v, %v", f, err)
+	}
+	if f, err := parseFilter("", "username"); f != nil || err != nil {
+		t.Fatalf("empty filter: %+v, %v", f, err)
+	}
+	for _, bad := range []string{`userName co "ops"`, `emails eq "a@b"`, `userName eq ops`, `userName eq "a" and active eq true`} {
+		if _, err := parseFilter(bad, "username", "externalid"); err == nil {
+			t.Errorf("parseFilter(%q) should fail", bad)
+		}
+	}
+}
+
+func TestPage(t *testing.T) {
+	t.Parallel()
+	for q, want := range map[string][2]int{
+		"":                        {1, maxPageSize},
+		"startIndex=3&count=10":   {3, 10},
+		"startIndex=0&count=5000": {1, maxPageSize},
+		"count=0":                 {1, 0},
+	} {
+		start, count := page(httptest.NewRequest(http.MethodGet, "/scim/v2/Users?"+q, nil))
+		if start != want[0] || count != want[1] {
+			t.Errorf("page(%q) = %d, %d, want %v", q, start, count, want)
+		}
+	}
+}
+
+func TestNewID(t *testing.T) {
+	t.Parallel()
+	re := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+	if a, b := newID(), newID(); !re.MatchString(a) || a == b {
+		t.Fatalf("newID = %q, %q", a, b)
+	}
+}
+
+func ops(t *testing.T, s string) []patchOp {
+	t.Helper()
+	var p patchRequest
+	if err := json.Unmarshal([]byte(s), &p); err != nil {
+		t.Fatal(err)
+	}
+	return p.Operations
+}
+
+func TestApplyUserPatch(t *testing.T) {
+	t.Parallel()
+	c, err := applyUserPatch(ops(t, `{"Operations": [
+		{"op": "Replace", "path": "active", "value": "False"},
+		{"op": "replace", "value": {"displayName": "Ops One", "name.givenName": "Ops"}}
+	]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.active == nil || *c.active || c.displayName == nil || *c.displayName != "Ops One" || c.password != nil {
+		t.Fatalf("got %+v", c)
+	}
+	for _, bad := range []string{
+		`{"Operations": [{"op": "replace", "path": "userName", "value": "other"}]}`,
+		`{"Operations": [{"op": "remove", "path": "displayName"}]}`,
+		`{"Operations": [{"op": "replace", "path": "active", "value": "maybe"}]}`,
+	} {
+		if _, err := applyUserPatch(ops(t, bad)); err == nil {
+			t.Errorf("applyUserPatch(%s) should fail", bad)
+		}
+	}
+}
+
+func TestApplyGroupPatch(t *testing.T) {
+	t.Parallel()
+	c, err := applyGroupPatch(ops(t, `{"Operations": [
+		{"op": "add", "path": "members", "value": [{"value": "u1"}, {"value": "u2"}]},
+		{"op": "remove", "path": "members[value eq \"u3\"]"},
+		{"op": "replace", "path": "displayName", "value": "MQTT Admins"}
+	]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(c.add, ",") != "u1,u2" || strings.Join(c.remove, ",") != "u3" || c.replace != nil ||
+		c.displayName == nil || *c.displayName != "MQTT Admins" {
+		t.Fatalf("got %+v", c)
+	}
+	c, err = applyGroupPatch(ops(t, `{"Operations": [{"op": "remove", "path": "members"}]}`))
+	if err != nil || c.replace == nil || len(c.replace) != 0 {
+		t.Fatalf("remove all members: %+v, %v", c, err)
+	}
+	if _, err := applyGroupPatch(ops(t, `{"Operations": [{"op": "add", "path": "owners", "value": []}]}`)); err == nil {
+		t.Error("unknown path should fail")
+	}
+}
+
+func TestParseRoleMap(t *testing.T) {
+	t.Parallel()
+	m, err := parseRoleMap("MQTT Admins=ops-admin, MQTT Viewers = ops-viewer,")
+	if err != nil || len(m) != 2 || m["mqtt admins"] != "ops-admin" || m["mqtt viewers"] != "ops-viewer" {
+		t.Fatalf("got %v, %v", m, err)
+	}
+	for _, bad := range []string{"Admins", "Admins=", "Admins=*", "A=x,a=y"} {
+		if _, err := parseRoleMap(bad); err == nil {
+			t.Errorf("parseRoleMap(%q) should fail", bad)
+		}
+	}
+	got := rolesFor(m, []string{"mqtt viewers", "Other", "MQTT Admins", "MQTT VIEWERS"})
+	if strings.Join(got, ",") != "ops-viewer,ops-admin" {
+		t.Fatalf("rolesFor = %v", got)
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	t.Parallel()
+	s := &server{token: "0123456789abcdef", logger: log.New(io.Discard, "", 0)}
+	h := s.routes()
+	for auth, want := range map[string]int{
+		"":                         http.StatusUnauthorized,
+		"Bearer wrong":             http.StatusUnauthorized,
+		"Basic MDEyMzQ1Njc4OWFiY2": http.StatusUnauthorized,
+		"Bearer 0123456789abcdef":  http.StatusOK,
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/scim/v2/ServiceProviderConfig", nil)
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != want {
+			t.Errorf("Authorization %q: status %d, want %d", auth, rec.Code, want)
+		}
+		if ct := rec.Header().Get("Content-Type"); ct != scimContentType {
+			t.Errorf("Content-Type %q", ct)
+		}
+	}
+}
+
+func TestWriteError(t *testing.T) {
+	t.Parallel()
+	rec := httptest.NewRecorder()
+	writeError(rec, badRequest("mutability", "userName cannot be changed"))
+	var body map[string]any
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Code != http.StatusBadRequest || body["status"] != "400" || body["scimType"] != "mutability" {
+		t.Fatalf("got %d %v", rec.Code, body)
+	}
+	rec = httptest.NewRecorder()
+	writeError(rec, io.ErrUnexpectedEOF)
+	if rec.Code != http.StatusInternalServerError || strings.Contains(rec.Body.String(), "EOF") {
+		t.Fatalf("internal errors must not leak: %d %s", rec.Code, rec.Body)
+	}
+}
@@ -0,0 +1,443 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// SCIM 资源保存在迁移 0007 的 scim_users / scim_groups / scim_group_members 中；
+// 账号本身（密码、启用状态）在 iot_devices，角色展开后的规则在 acls。
+
+const (
+	selectUser = `SELECT u.id, u.username, u.external_id, u.display_name, d.enabled, u.created_at, u.modified_at
+FROM scim_users u JOIN iot_devices d USING (username)`
+	selectGroup = `SELECT id, display_name, external_id, created_at, modified_at FROM scim_groups`
+)
+
+type db struct {
+	p     *pgxpool.Pool
+	cost  int
+	roles map[string]string // 小写组名 -> acls 中的角色模板用户名
+}
+
+// mapDBError 把约束冲突转换为 SCIM 错误。
+func mapDBError(err error) error {
+	var pe *pgconn.PgError
+	if errors.As(err, &pe) {
+		switch pe.Code {
+		case "23505":
+			return errConflict
+		case "23503":
+			return badRequest("invalidValue", "referenced resource does not exist")
+		}
+	}
+	if errors.Is(err, pgx.ErrNoRows) {
+		return errNotFound
+	}
+	return err
+}
+
+func scanUser(row pgx.Row) (scimUser, error) {
+	var (
+		u                 scimUser
+		enabled           int
+		created, modified time.Time
+	)
+	if err := row.Scan(&u.ID, &u.UserName, &u.ExternalID, &u.DisplayName, &enabled, &created, &modified); err != nil {
+		return u, mapDBError(err)
+	}
+	active := enabled != 0
+	u.Schemas, u.Active = []string{schemaUser}, &active
+	u.Meta = &meta{ResourceType: "User", Created: timestamp(created), LastModified: timestamp(modified)}
+	return u, nil
+}
+
+func (d *db) userGroups(ctx context.Context, q pgx.Tx, u *scimUser) error {
+	rows, err := q.Query(ctx, `SELECT g.id, g.display_name FROM scim_group_members m JOIN scim_groups g ON g.id = m.group_id
+WHERE m.user_id = $1 ORDER BY g.display_name`, u.ID)
+	if err != nil {
+		return err
+	}
+	u.Groups, err = pgx.CollectRows(rows, func(r pgx.CollectableRow) (memberRef, error) {
+		var m memberRef
+		return m, r.Scan(&m.Value, &m.Display)
+	})
+	return err
+}
+
+func (d *db) getUser(ctx context.Context, id string) (u scimUser, err error) {
+	err = pgx.BeginFunc(ctx, d.p, func(tx pgx.Tx) error {
+		if u, err = scanUser(tx.QueryRow(ctx, selectUser+" WHERE u.id = $1", id)); err != nil {
+			return err
+		}
+		return d.userGroups(ctx, tx, &u)
+	})
+	return u, err
+}
+
+// listUsers 返回一页用户与总数；filter 支持 userName 与 externalId。
+func (d *db) listUsers(ctx context.Context, f *filter, start, count int) (users []scimUser, total int, err error) {
+	where, args := "", []any{}
+	if f != nil {
+		col := map[string]string{"username": "u.username", "externalid": "u.external_id"}[f.attr]
+		where, args = " WHERE "+col+" = $1", append(args, f.value)
+	}
+	err = pgx.BeginFunc(ctx, d.p, func(tx pgx.Tx) error {
+		if err := tx.QueryRow(ctx, "SELECT count(*) FROM scim_users u"+where, args...).Scan(&total); err != nil {
+			return err
+		}
+		rows, err := tx.Query(ctx, fmt.Sprintf("%s%s ORDER BY u.username OFFSET %d LIMIT %d", selectUser, where, start-1, count), args...)
+		if err != nil {
+			return err
+		}
+		if users, err = pgx.CollectRows(rows, func(r pgx.CollectableRow) (scimUser, error) { return scanUser(r) }); err != nil {
+			return err
+		}
+		for i := range users {
+			if err := d.userGroups(ctx, tx, &users[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return users, total, err
+}
+
+func (d *db) hash(password string) (string, error) {
+	if password == "" {
+		return "", nil
+	}
+	h, err := bcrypt.GenerateFromPassword([]byte(password), d.cost)
+	return string(h), err
+}
+
+func validUserName(name string) error {
+	if name == "" || len(name) > 256 || strings.ContainsAny(name, "\x00\r\n\t") {
+		return badRequest("invalidValue", "userName must be 1-256 characters without control characters")
+	}
+	if name == "*" {
+		return badRequest("invalidValue", "userName \"*\" is reserved for global ACL rules")
+	}
+	return nil
+}
+
+// createUser 新建设备账号与 SCIM 记录。已存在的同名账号（不是经 SCIM 创建的）不会被接管，返回 409。
+func (d *db) createUser(ctx context.Context, in scimUser) (string, error) {
+	if err := validUserName(in.UserName); err != nil {
+		return "", err
+	}
+	if d.isRole(in.UserName) {
+		return "", badRequest("invalidValue", "userName %q is a role template", in.UserName)
+	}
+	hash, err := d.hash(in.Password)
+	if err != nil {
+		return "", err
+	}
+	enabled := 1
+	if in.Active != nil && !*in.Active {
+		enabled = 0
+	}
+	id := newID()
+	err = pgx.BeginFunc(ctx, d.p, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, "INSERT INTO iot_devices (username, password_hash, salt, enabled) VALUES ($1, $2, '', $3)",
+			in.UserName, hash, enabled); err != nil {
+			return err
+		}
+		_, err := tx.Exec(ctx, "INSERT INTO scim_users (id, username, external_id, display_name) VALUES ($1, $2, $3, $4)",
+			id, in.UserName, in.ExternalID, in.DisplayName)
+		return err
+	})
+	return id, mapDBError(err)
+}
+
+// updateUser 应用一次修改；密码为空串时清空哈希（账号无法再用密码登录）。
+func (d *db) updateUser(ctx context.Context, id string, c userChange) error {
+	var hash *string
+	if c.password != nil {
+		h, err := d.hash(*c.password)
+		if err != nil {
+			return err
+		}
+		hash = &h
+	}
+	var enabled *int
+	if c.active != nil {
+		v := 0
+		if *c.active {
+			v = 1
+		}
+		enabled = &v
+	}
+	err := pgx.BeginFunc(ctx, d.p, func(tx pgx.Tx) error {
+		var username string
+		err := tx.QueryRow(ctx, `UPDATE scim_users SET display_name = COALESCE($2, display_name),
+  external_id = COALESCE($3, external_id), modified_at = now() WHERE id = $1 RETURNING username`,
+			id, c.displayName, c.externalID).Scan(&username)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(ctx, `UPDATE iot_devices SET enabled = COALESCE($2, enabled),
+  password_hash = COALESCE($3, password_hash) WHERE username = $1`, username, enabled, hash)
+		return err
+	})
+	return mapDBError(err)
+}
+
+// deleteUser 删除设备账号；client_bindings、scim_users、组成员关系随外键级联删除，acls 单独删除。
+func (d *db) deleteUser(ctx context.Context, id string) error {
+	err := pgx.BeginFunc(ctx, d.p, func(tx pgx.Tx) error {
+		var username string
+		if err := tx.QueryRow(ctx, "SELECT username FROM scim_users WHERE id = $1", id).Scan(&username); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(ctx, "DELETE FROM acls WHERE username = $1", username); err != nil {
+			return err
+		}
+		_, err := tx.Exec(ctx, "DELETE FROM iot_devices WHERE username = $1", username)
+		return err
+	})
+	return mapDBError(err)
+}
+
+func scanGroup(row pgx.Row) (scimGroup, error) {
+	var (
+		g                 scimGroup
+		created, modified time.Time
+	)
+	if err := row.Scan(&g.ID, &g.DisplayName, &g.ExternalID, &created, &modified); err != nil {
+		return g, mapDBError(err)
+	}
+	g.Schemas = []string{schemaGroup}
+	g.Meta = &meta{ResourceType: "Group", Created: timestamp(created), LastModified: timestamp(modified)}
+	return g, nil
+}
+
+func (d *db) groupMembers(ctx context.Context, tx pgx.Tx, g *scimGroup) error {
+	rows, err := tx.Query(ctx, `SELECT u.id, u.username FROM scim_group_members m JOIN scim_users u ON u.id = m.user_id
+WHERE m.group_id = $1 ORDER BY u.username`, g.ID)
+	if err != nil {
+		return err
+	}
+	g.Members, err = pgx.CollectRows(rows, func(r pgx.CollectableRow) (memberRef, error) {
+		var m memberRef
+		return m, r.Scan(&m.Value, &m.Display)
+	})
+	return err
+}
+
+func (d *db) getGroup(ctx context.Context, id string, members bool) (g scimGroup, err error) {
+	err = pgx.BeginFunc(ctx, d.p, func(tx pgx.Tx) error {
+		if g, err = scanGroup(tx.QueryRow(ctx, selectGroup+" WHERE id = $1", id)); err != nil || !members {
+			return err
+		}
+		return d.groupMembers(ctx, tx, &g)
+	})
+	return g, err
+}
+
+// listGroups 返回一页组与总数；filter 支持 displayName 与 externalId。
+func (d *db) listGroups(ctx context.Context, f *filter, start, count int, members bool) (groups []scimGroup, total int, err error) {
+	where, args := "", []any{}
+	if f != nil {
+		col := map[string]string{"displayname": "lower(display_name)", "externalid": "external_id"}[f.attr]
+		v := f.value
+		if f.attr == "displayname" {
+			v = strings.ToLower(v)
+		}
+		where, args = " WHERE "+col+" = $1", append(args, v)
+	}
+	err = pgx.BeginFunc(ctx, d.p, func(tx pgx.Tx) error {
+		if err := tx.QueryRow(ctx, "SELECT count(*) FROM scim_groups"+where, args...).Scan(&total); err != nil {
+			return err
+		}
+		rows, err := tx.Query(ctx, fmt.Sprintf("%s%s ORDER BY display_name OFFSET %d LIMIT %d", selectGroup, where, start-1, count), args...)
+		if err != nil {
+			return err
+		}
+		if groups, err = pgx.CollectRows(rows, func(r pgx.CollectableRow) (scimGroup, error) { return scanGroup(r) }); err != nil {
+			return err
+		}
+		for i := range groups {
+			if !members {
+				continue
+			}
+			if err := d.groupMembers(ctx, tx, &groups[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return groups, total, err
+}
+
+func (d *db) createGroup(ctx context.Context, in scimGroup) (string, error) {
+	if strings.TrimSpace(in.DisplayName) == "" {
+		return "", badRequest("invalidValue", "displayName is required")
+	}
+	id := newID()
+	err := pgx.BeginFunc(ctx, d.p, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, "INSERT INTO scim_groups (id, display_name, external_id) VALUES ($1, $2, $3)",
+			id, in.DisplayName, in.ExternalID); err != nil {
+			return err
+		}
+		return d.changeMembers(ctx, tx, id, groupChange{replace: refIDs(in.Members)})
+	})
+	return id, mapDBError(err)
+}
+
+// updateGroup 修改组名与成员，并重新展开受影响用户的角色。
+func (d *db) updateGroup(ctx context.Context, id string, c groupChange) error {
+	err := pgx.BeginFunc(ctx, d.p, func(tx pgx.Tx) error {
+		tag, err := tx.Exec(ctx, "UPDATE scim_groups SET display_name = COALESCE($2, display_name), modified_at = now() WHERE id = $1",
+			id, c.displayName)
+		if err != nil {
+			return err
+		}
+		if tag.RowsAffected() == 0 {
+			return pgx.ErrNoRows
+		}
+		return d.changeMembers(ctx, tx, id, c)
+	})
+	return mapDBError(err)
+}
+
+// deleteGroup 删除组；原成员的角色随之重新展开。
+func (d *db) deleteGroup(ctx context.Context, id string) error {
+	err := pgx.BeginFunc(ctx, d.p, func(tx pgx.Tx) error {
+		affected, err := d.members(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		tag, err := tx.Exec(ctx, "DELETE FROM scim_groups WHERE id = $1", id)
+		if err != nil {
+			return err
+		}
+		if tag.RowsAffected() == 0 {
+			return pgx.ErrNoRows
+		}
+		return d.applyRoles(ctx, tx, affected)
+	})
+	return mapDBError(err)
+}
+
+func (d *db) members(ctx context.Context, tx pgx.Tx, groupID string) ([]string, error) {
+	rows, err := tx.Query(ctx, "SELECT user_id FROM scim_group_members WHERE group_id = $1", groupID)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, pgx.RowTo[string])
+}
+
+// changeMembers 应用成员变化；组名或成员变化后，原成员与新成员的角色都重新展开。
+func (d *db) changeMembers(ctx context.Context, tx pgx.Tx, groupID string, c groupChange) error {
+	before, err := d.members(ctx, tx, groupID)
+	if err != nil {
+		return err
+	}
+	if c.replace != nil {
+		if _, err := tx.Exec(ctx, "DELETE FROM scim_group_members WHERE group_id = $1", groupID); err != nil {
+			return err
+		}
+		c.add = append(c.replace, c.add...)
+	}
+	for _, uid := range c.remove {
+		if _, err := tx.Exec(ctx, "DELETE FROM scim_group_members WHERE group_id = $1 AND user_id = $2", groupID, uid); err != nil {
+			return err
+		}
+	}
+	for _, uid := range c.add {
+		if _, err := tx.Exec(ctx, "INSERT INTO scim_group_members (group_id, user_id) VALUES ($1, $2) ON CONFLICT DO NOTHING",
+			groupID, uid); err != nil {
+			return err
+		}
+	}
+	return d.applyRoles(ctx, tx, append(before, c.add...))
+}
+
+func (d *db) isRole(username string) bool {
+	for _, r := range d.roles {
+		if r == username {
+			return true
+		}
+	}
+	return false
+}
+
+// applyRoles 把用户的 acls 规则替换为其所在组映射到的角色模板规则之并（同一主题模式的权限按位或）。
+// 没有配置 -role-map 时不管理 acls。
+func (d *db) applyRoles(ctx context.Context, tx pgx.Tx, userIDs []string) error {
+	if len(d.roles) == 0 {
+		return nil
+	}
+	seen := map[string]bool{}
+	for _, uid := range userIDs {
+		if seen[uid] {
+			continue
+		}
+		seen[uid] = true
+		var (
+			username string
+			groups   []string
+		)
+		err := tx.QueryRow(ctx, `SELECT u.username, COALESCE(array_agg(g.display_name) FILTER (WHERE g.id IS NOT NULL), '{}')
+FROM scim_users u LEFT JOIN scim_group_members m ON m.user_id = u.id LEFT JOIN scim_groups g ON g.id = m.group_id
+WHERE u.id = $1 GROUP BY u.username`, uid).Scan(&username, &groups)
+		if errors.Is(err, pgx.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		templates := rolesFor(d.roles, groups)
+		if _, err := tx.Exec(ctx, "DELETE FROM acls WHERE username = $1", username); err != nil {
+			return err
+		}
+		if len(templates) == 0 {
+			continue
+		}
+		if _, err := tx.Exec(ctx, `INSERT INTO acls (username, pattern, acc)
+SELECT $1, pattern, bit_or(acc) FROM acls WHERE username = ANY($2) GROUP BY pattern`, username, templates); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rolesFor 返回组名列表映射到的角色模板（去重）。
+func rolesFor(roles map[string]string, groups []string) []string {
+	var out []string
+	seen := map[string]bool{}
+	for _, g := range groups {
+		if r, ok := roles[strings.ToLower(g)]; ok && !seen[r] {
+			seen[r] = true
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// refreshRoles 重新展开所有 SCIM 用户的角色，使角色模板规则的修改生效。
+func (d *db) refreshRoles(ctx context.Context) (int, error) {
+	var n int
+	err := pgx.BeginFunc(ctx, d.p, func(tx pgx.Tx) error {
+		rows, err := tx.Query(ctx, "SELECT id FROM scim_users")
+		if err != nil {
+			return err
+		}
+		ids, err := pgx.CollectRows(rows, pgx.RowTo[string])
+		if err != nil {
+			return err
+		}
+		n = len(ids)
+		return d.applyRoles(ctx, tx, ids)
+	})
+	return n, err
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/jackc/pgx/v5"
+
+	"auth-plugin/internal/aclrule"
+)
+
+// 把数据源与库的差异算成变更列表，先输出再（非 dry-run 时）在一个事务里应用。
+// 源里没有的库用户只停用不删除，误配置的数据源可以通过恢复数据源撤销。
+
+type dbUser struct {
+	hash    string
+	enabled bool
+}
+
+type dbState struct {
+	users map[string]dbUser
+	rules map[string]map[string]int // username -> pattern -> acc
+}
+
+type op int
+
+const (
+	opAddUser op = iota
+	opSetHash
+	opSetEnabled
+	opAddRule
+	opSetRule
+	opRemoveRule
+)
+
+type change struct {
+	op       op
+	username string
+	hash     string
+	enabled  bool
+	pattern  string
+	acc, old int
+}
+
+func enabledWord(b bool) string {
+	if b {
+		return "enabled"
+	}
+	return "disabled"
+}
+
+func (c change) String() string {
+	switch c.op {
+	case opAddUser:
+		return fmt.Sprintf("+ user %s (%s)", c.username, enabledWord(c.enabled))
+	case opSetHash:
+		return fmt.Sprintf("~ user %s password hash", c.username)
+	case opSetEnabled:
+		return fmt.Sprintf("~ user %s %s -> %s", c.username, enabledWord(!c.enabled), enabledWord(c.enabled))
+	case opAddRule:
+		return fmt.Sprintf("+ acl %s %s %s", c.username, c.pattern, aclrule.FormatAcc(c.acc))
+	case opSetRule:
+		return fmt.Sprintf("~ acl %s %s %s -> %s", c.username, c.pattern, aclrule.FormatAcc(c.old), aclrule.FormatAcc(c.acc))
+	case opRemoveRule:
+		return fmt.Sprintf("- acl %s %s", c.username, c.pattern)
+	}
+	return "?"
+}
+
+func enabledFlag(enabled bool) int16 {
+	if enabled {
+		return 1
+	}
+	return 0
+}
+
+type diffOptions struct {
+	disableMissing bool
+}
+
+func computeDiff(src snapshot, db dbState, opts diffOptions, warn func(string)) []change {
+	var changes []change
+	managed := map[string]bool{}
+	for _, u := range src.users {
+		managed[u.username] = true
+		if u.hash != "" && !usableHash(u.hash) {
+			warn(fmt.Sprintf("%s: password hash format is not supported by the plugin, keeping the stored one", u.username))
+			u.hash = ""
+		}
+		cur, exists := db.users[u.username]
+		switch {
+		case !exists && u.hash == "":
+			warn(fmt.Sprintf("%s: new user without a usable password hash, skipped", u.username))
+			managed[u.username] = false
+			continue
+		case !exists:
+			changes = append(changes, change{op: opAddUser, username: u.username, hash: u.hash, enabled: u.enabled})
+			continue
+		}
+		if u.hash != "" && u.hash != cur.hash {
+			changes = append(changes, change{op: opSetHash, username: u.username, hash: u.hash})
+		}
+		if u.enabled != cur.enabled {
+			changes = append(changes, change{op: opSetEnabled, username: u.username, enabled: u.enabled})
+		}
+	}
+	if opts.disableMissing {
+		for name, cur := range db.users {
+			if _, listed := managed[name]; !listed && cur.enabled {
+				changes = append(changes, change{op: opSetEnabled, username: name, enabled: false})
+			}
+		}
+	}
+
+	if src.hasRules {
+		want := map[string]map[string]int{}
+		for _, r := range src.rules {
+			if r.username != "*" && !managed[r.username] {
+				warn(fmt.Sprintf("acl %s %s: user is not synced, skipped", r.username, r.Pattern))
+				continue
+			}
+			if want[r.username] == nil {
+				want[r.username] = map[string]int{}
+			}
+			want[r.username][r.Pattern] |= r.Acc
+		}
+		// 数据源里出现过 '*' 规则时才接管全局规则，否则保持库里的全局规则
+		if _, ok := want["*"]; ok {
+			managed["*"] = true
+		}
+		for name, ok := range managed {
+			if !ok {
+				continue
+			}
+			for pattern, acc := range want[name] {
+				old, exists := db.rules[name][pattern]
+				switch {
+				case !exists:
+					changes = append(changes, change{op: opAddRule, username: name, pattern: pattern, acc: acc})
+				case old != acc:
+					changes = append(changes, change{op: opSetRule, username: name, pattern: pattern, acc: acc, old: old})
+				}
+			}
+			for pattern := range db.rules[name] {
+				if _, keep := want[name][pattern]; !keep {
+					changes = append(changes, change{op: opRemoveRule, username: name, pattern: pattern})
+				}
+			}
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		a, b := changes[i], changes[j]
+		if a.username != b.username {
+			return a.username < b.username
+		}
+		if a.op != b.op {
+			return a.op < b.op
+		}
+		return a.pattern < b.pattern
+	})
+	return changes
+}
+
+func writeDiff(w io.Writer, changes []change) {
+	for _, c := range changes {
+		fmt.Fprintln(w, c)
+	}
+}
+
+func loadDB(ctx context.Context, conn *pgx.Conn) (dbState, error) {
+	db := dbState{users: map[string]dbUser{}, rules: map[string]map[string]int{}}
+	rows, err := conn.Query(ctx, "SELECT username, password_hash, enabled FROM iot_devices")
+	if err != nil {
+		return db, err
+	}
+	for rows.Next() {
+		var name string
+		var u dbUser
+		var enabled int16
+		if err := rows.Scan(&name, &u.hash, &enabled); err != nil {
+			return db, err
+		}
+		u.enabled = enabled != 0
+		db.users[name] = u
+	}
+	if err := rows.Err(); err != nil {
+		return db, err
+	}
+	rows, err = conn.Query(ctx, "SELECT username, pattern, acc FROM acls")
+	if err != nil {
+		return db, err
+	}
+	for rows.Next() {
+		var name, pattern string
+		var acc int
+		if err := rows.Scan(&name, &pattern, &acc); err != nil {
+			return db, err
+		}
+		if db.rules[name] == nil {
+			db.rules[name] = map[string]int{}
+		}
+		db.rules[name][pattern] = acc
+	}
+	return db, rows.Err()
+}
+
+const (
+	insertUser = `INSERT INTO iot_devices (username, password_hash, salt, enabled) VALUES ($1, $2, '', $3)`
+	updateHash = `UPDATE iot_devices SET password_hash = $2, salt = '' WHERE username = $1`
+	updateFlag = `UPDATE iot_devices SET enabled = $2 WHERE username = $1`
+	upsertRule = `INSERT INTO acls (username, pattern, acc) VALUES ($1, $2, $3)
+ON CONFLICT (username, pattern) DO UPDATE SET acc = EXCLUDED.acc`
+	deleteRule = `DELETE FROM acls WHERE username = $1 AND pattern = $2`
+)
+
+// apply 在一个事务中执行全部变更，任何一条失败都整体回滚。
+func apply(ctx context.Context, conn *pgx.Conn, changes []change) error {
+	return pgx.BeginFunc(ctx, conn, func(tx pgx.Tx) error {
+		for _, c := range changes {
+			var err error
+			switch c.op {
+			case opAddUser:
+				_, err = tx.Exec(ctx, insertUser, c.username, c.hash, enabledFlag(c.enabled))
+			case opSetHash:
+				_, err = tx.Exec(ctx, updateHash, c.username, c.hash)
+			case opSetEnabled:
+				_, err = tx.Exec(ctx, updateFlag, c.username, enabledFlag(c.enabled))
+			case opAddRule, opSetRule:
+				_, err = tx.Exec(ctx, upsertRule, c.username, c.pattern, c.acc)
+			case opRemoveRule:
+				_, err = tx.Exec(ctx, deleteRule, c.username, c.pattern)
+			}
+			if err != nil {
+				return fmt.Errorf("%s: %w", c, err)
+			}
+		}
+		return nil
+	})
+}
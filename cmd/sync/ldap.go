@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// ldapSource 按过滤条件搜索设备条目，属性映射：
+//   - userAttr：用户名（默认 cn）
+//   - hashAttr：密码哈希（默认 userPassword），{CRYPT} 前缀会去掉；其他 {SCHEME} 插件无法校验
+//   - enabledAttr：可选，布尔值；未配置或缺失时视为启用
+//   - aclAttr：可选，多值属性，每个值为 "<pattern> <access>"；未配置时不管理 ACL
+type ldapSource struct {
+	url          string
+	bindDN       string
+	bindPassword string
+	baseDN       string
+	filter       string
+	startTLS     bool
+	userAttr     string
+	hashAttr     string
+	enabledAttr  string
+	aclAttr      string
+}
+
+func (s ldapSource) String() string { return "ldap " + s.url }
+
+func (s ldapSource) attrs() []string {
+	a := []string{s.userAttr, s.hashAttr}
+	for _, x := range []string{s.enabledAttr, s.aclAttr} {
+		if x != "" {
+			a = append(a, x)
+		}
+	}
+	return a
+}
+
+func (s ldapSource) load(ctx context.Context) (snapshot, error) {
+	conn, err := ldap.DialURL(s.url)
+	if err != nil {
+		return snapshot{}, err
+	}
+	defer conn.Close()
+	if dl, ok := ctx.Deadline(); ok {
+		conn.SetTimeout(time.Until(dl))
+	}
+	if s.startTLS {
+		host := strings.TrimPrefix(strings.TrimPrefix(s.url, "ldap://"), "ldaps://")
+		host, _, _ = strings.Cut(host, ":")
+		if err := conn.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return snapshot{}, fmt.Errorf("starttls: %w", err)
+		}
+	}
+	if s.bindDN != "" {
+		if err := conn.Bind(s.bindDN, s.bindPassword); err != nil {
+			return snapshot{}, fmt.Errorf("bind: %w", err)
+		}
+	}
+	req := ldap.NewSearchRequest(s.baseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, 0, false,
+		s.filter, s.attrs(), nil)
+	res, err := conn.SearchWithPaging(req, 500)
+	if err != nil {
+		return snapshot{}, fmt.Errorf("search: %w", err)
+	}
+	return s.fromEntries(res.Entries)
+}
+
+func (s ldapSource) fromEntries(entries []*ldap.Entry) (snapshot, error) {
+	snap := snapshot{hasRules: s.aclAttr != ""}
+	seen := map[string]string{}
+	for _, e := range entries {
+		name := e.GetAttributeValue(s.userAttr)
+		if name == "" || name == "*" {
+			return snap, fmt.Errorf("%s: invalid %s %q", e.DN, s.userAttr, name)
+		}
+		if prev, dup := seen[name]; dup {
+			return snap, fmt.Errorf("%s: %s %q already used by %s", e.DN, s.userAttr, name, prev)
+		}
+		seen[name] = e.DN
+		u := srcUser{username: name, hash: ldapHash(e.GetAttributeValue(s.hashAttr)), enabled: true}
+		if s.enabledAttr != "" {
+			if v := e.GetAttributeValue(s.enabledAttr); v != "" {
+				var ok bool
+				if u.enabled, ok = parseBool(v); !ok {
+					return snap, fmt.Errorf("%s: %s %q is not a boolean", e.DN, s.enabledAttr, v)
+				}
+			}
+		}
+		snap.users = append(snap.users, u)
+		if s.aclAttr == "" {
+			continue
+		}
+		for _, v := range e.GetAttributeValues(s.aclAttr) {
+			pattern, access, ok := strings.Cut(strings.TrimSpace(v), " ")
+			if !ok {
+				return snap, fmt.Errorf("%s: %s value %q: want \"<pattern> <access>\"", e.DN, s.aclAttr, v)
+			}
+			rule, err := parseRule(name, pattern, strings.TrimSpace(access))
+			if err != nil {
+				return snap, fmt.Errorf("%s: %s value %q: %w", e.DN, s.aclAttr, v, err)
+			}
+			snap.rules = append(snap.rules, rule)
+		}
+	}
+	return snap, nil
+}
+
+// ldapHash 去掉 RFC 2307 的 {CRYPT} 前缀；其他方案原样返回，由 usableHash 判断能否使用。
+func ldapHash(v string) string {
+	if len(v) > 7 && strings.EqualFold(v[:7], "{CRYPT}") {
+		return v[7:]
+	}
+	return v
+}
@@ -0,0 +1,148 @@
+// sync 是独立的同步守护进程：按间隔从 CSV 或 LDAP 读取设备清单，与 iot_devices/acls 比较，
+// 输出差异并在一个事务中应用，供设备台账保存在其他系统里的组织使用。
+//
+// 差异格式：'+' 新增、'~' 修改、'-' 删除，每行一条。源中没有的用户只停用（-disable-missing），不删除。
+// 变更数超过 -max-changes 时只输出差异、不应用，防止数据源出错（如 LDAP 过滤条件写错）时停用大批设备。
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+var errTooMany = errors.New("too many changes")
+
+type syncer struct {
+	src            source
+	dsn            string
+	dryRun         bool
+	maxChanges     int
+	disableMissing bool
+	logger         *log.Logger
+}
+
+// runOnce 执行一轮同步，返回变更条数。
+func (s *syncer) runOnce(ctx context.Context) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Minute)
+	defer cancel()
+	snap, err := s.src.load(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("load %s: %w", s.src, err)
+	}
+	if len(snap.users) == 0 {
+		return 0, fmt.Errorf("%s returned no users, refusing to sync", s.src)
+	}
+	conn, err := pgx.Connect(ctx, s.dsn)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close(context.Background())
+	db, err := loadDB(ctx, conn)
+	if err != nil {
+		return 0, err
+	}
+
+	warn := func(msg string) { s.logger.Println("warning:", msg) }
+	changes := computeDiff(snap, db, diffOptions{disableMissing: s.disableMissing}, warn)
+	writeDiff(os.Stdout, changes)
+	switch {
+	case len(changes) == 0 || s.dryRun:
+		return len(changes), nil
+	case s.maxChanges > 0 && len(changes) > s.maxChanges:
+		return len(changes), fmt.Errorf("%w: %d exceed -max-changes %d, nothing applied", errTooMany, len(changes), s.maxChanges)
+	}
+	return len(changes), apply(ctx, conn, changes)
+}
+
+func main() {
+	usersFile := flag.String("users", "", "CSV of username,password_hash[,enabled]")
+	aclsFile := flag.String("acls", "", "CSV of username,pattern,access; when given, the synced users' rules are replaced by it")
+	var ls ldapSource
+	flag.StringVar(&ls.url, "ldap-url", "", "LDAP URL, e.g. ldaps://ldap.example.com (instead of -users)")
+	flag.StringVar(&ls.bindDN, "ldap-bind-dn", "", "bind DN (password from $LDAP_BIND_PASSWORD)")
+	flag.StringVar(&ls.baseDN, "ldap-base", "", "search base DN")
+	flag.StringVar(&ls.filter, "ldap-filter", "(objectClass=device)", "search filter")
+	flag.BoolVar(&ls.startTLS, "ldap-starttls", false, "upgrade an ldap:// connection with StartTLS")
+	flag.StringVar(&ls.userAttr, "ldap-user-attr", "cn", "attribute holding the username")
+	flag.StringVar(&ls.hashAttr, "ldap-hash-attr", "userPassword", "attribute holding the password hash ({CRYPT} prefix is stripped)")
+	flag.StringVar(&ls.enabledAttr, "ldap-enabled-attr", "", "boolean attribute for the enabled flag (default: all enabled)")
+	flag.StringVar(&ls.aclAttr, "ldap-acl-attr", "", "multi-valued attribute of \"<pattern> <access>\" rules (default: ACLs not managed)")
+	s := syncer{logger: log.New(os.Stderr, "sync: ", log.LstdFlags)}
+	flag.StringVar(&s.dsn, "dsn", os.Getenv("PG_DSN"), "PostgreSQL DSN (default $PG_DSN)")
+	flag.BoolVar(&s.dryRun, "dry-run", false, "print the diff without applying it")
+	flag.BoolVar(&s.disableMissing, "disable-missing", true, "disable database users that the source no longer lists")
+	flag.IntVar(&s.maxChanges, "max-changes", 100, "refuse to apply more changes than this in one run (0 = no limit)")
+	interval := flag.Duration("interval", 0, "sync every interval (0 = run once and exit)")
+	flag.Parse()
+
+	switch {
+	case (*usersFile == "") == (ls.url == ""):
+		fmt.Fprintln(os.Stderr, "sync: give exactly one of -users or -ldap-url")
+		flag.Usage()
+		os.Exit(2)
+	case *aclsFile != "" && ls.url != "":
+		fmt.Fprintln(os.Stderr, "sync: -acls only applies to -users; use -ldap-acl-attr with LDAP")
+		os.Exit(2)
+	case s.dsn == "":
+		fmt.Fprintln(os.Stderr, "sync: -dsn or PG_DSN is required")
+		os.Exit(2)
+	}
+	if ls.url != "" {
+		if ls.baseDN == "" {
+			fmt.Fprintln(os.Stderr, "sync: -ldap-base is required")
+			os.Exit(2)
+		}
+		ls.bindPassword = os.Getenv("LDAP_BIND_PASSWORD")
+		s.src = ls
+	} else {
+		s.src = csvSource{usersPath: *usersFile, aclsPath: *aclsFile}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if *interval <= 0 {
+		n, err := s.runOnce(ctx)
+		if err != nil {
+			s.logger.Println(err)
+			os.Exit(1)
+		}
+		s.logger.Printf("%d change(s)%s", n, dryRunNote(s.dryRun))
+		return
+	}
+
+	// 守护模式：单轮失败只记录，下一轮重试
+	s.logger.Printf("syncing from %s every %s", s.src, *interval)
+	tick := time.NewTicker(*interval)
+	defer tick.Stop()
+	for {
+		n, err := s.runOnce(ctx)
+		switch {
+		case err != nil:
+			s.logger.Println(err)
+		case n > 0:
+			s.logger.Printf("%d change(s)%s", n, dryRunNote(s.dryRun))
+		}
+		select {
+		case <-ctx.Done():
+			s.logger.Println("stopping")
+			return
+		case <-tick.C:
+		}
+	}
+}
+
+func dryRunNote(dryRun bool) string {
+	if dryRun {
+		return " (dry run, not applied)"
+	}
+	return ""
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"auth-plugin/internal/aclrule"
+)
+
+// 数据源给出期望状态：用户（可选哈希与启用状态）和可选的 ACL。
+// 源中哈希为空的已有用户保留库里的哈希；新用户没有哈希时跳过。
+
+type srcUser struct {
+	username string
+	hash     string
+	enabled  bool
+}
+
+type srcRule struct {
+	username string
+	aclrule.Rule
+}
+
+type snapshot struct {
+	users []srcUser
+	rules []srcRule
+	// hasRules 为 false 时数据源不管理 ACL，库里的规则保持不动
+	hasRules bool
+}
+
+type source interface {
+	load(ctx context.Context) (snapshot, error)
+	String() string
+}
+
+// csvSource 读取 username,password_hash[,enabled] 与可选的 username,pattern,acc 两个文件，每次同步重新读取。
+type csvSource struct {
+	usersPath, aclsPath string
+}
+
+func (s csvSource) String() string { return "csv " + s.usersPath }
+
+func (s csvSource) load(context.Context) (snapshot, error) {
+	var snap snapshot
+	f, err := os.Open(s.usersPath)
+	if err != nil {
+		return snap, err
+	}
+	snap.users, err = readUsers(f)
+	f.Close()
+	if err != nil {
+		return snap, fmt.Errorf("%s: %w", s.usersPath, err)
+	}
+	if s.aclsPath == "" {
+		return snap, nil
+	}
+	if f, err = os.Open(s.aclsPath); err != nil {
+		return snap, err
+	}
+	snap.rules, err = readRules(f)
+	f.Close()
+	if err != nil {
+		return snap, fmt.Errorf("%s: %w", s.aclsPath, err)
+	}
+	snap.hasRules = true
+	return snap, nil
+}
+
+func newCSVReader(r io.Reader) *csv.Reader {
+	cr := csv.NewReader(r)
+	cr.Comment = '#'
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+	return cr
+}
+
+func readUsers(r io.Reader) ([]srcUser, error) {
+	cr := newCSVReader(r)
+	seen := map[string]int{}
+	var users []srcUser
+	for first := true; ; first = false {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			return users, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		line, _ := cr.FieldPos(0)
+		if len(rec) < 2 || len(rec) > 3 {
+			return nil, fmt.Errorf("line %d: want username,password_hash[,enabled]", line)
+		}
+		if first && strings.EqualFold(rec[0], "username") {
+			continue
+		}
+		u := srcUser{username: rec[0], hash: rec[1], enabled: true}
+		if u.username == "" || u.username == "*" {
+			return nil, fmt.Errorf("line %d: invalid username %q", line, u.username)
+		}
+		if len(rec) == 3 && rec[2] != "" {
+			var ok bool
+			if u.enabled, ok = parseBool(rec[2]); !ok {
+				return nil, fmt.Errorf("line %d: enabled %q is not a boolean", line, rec[2])
+			}
+		}
+		if prev, dup := seen[u.username]; dup {
+			return nil, fmt.Errorf("line %d: %s already listed on line %d", line, u.username, prev)
+		}
+		seen[u.username] = line
+		users = append(users, u)
+	}
+}
+
+func readRules(r io.Reader) ([]srcRule, error) {
+	cr := newCSVReader(r)
+	cr.FieldsPerRecord = 3
+	var rules []srcRule
+	for first := true; ; first = false {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			return rules, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if first && strings.EqualFold(rec[0], "username") {
+			continue
+		}
+		line, _ := cr.FieldPos(0)
+		rule, err := parseRule(rec[0], rec[1], rec[2])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		rules = append(rules, rule)
+	}
+}
+
+// parseRule 用插件同一套规则校验，避免把插件不认的规则写进库。
+func parseRule(username, pattern, access string) (srcRule, error) {
+	if username == "" {
+		return srcRule{}, fmt.Errorf("empty username")
+	}
+	if err := aclrule.ValidatePattern(pattern); err != nil {
+		return srcRule{}, err
+	}
+	acc, err := aclrule.ParseAcc(access)
+	if err != nil {
+		return srcRule{}, err
+	}
+	return srcRule{username: username, Rule: aclrule.Rule{Pattern: pattern, Acc: acc}}, nil
+}
+
+func parseBool(v string) (bool, bool) {
+	switch strings.ToLower(strings.TrimSpace(v)) {
+	case "1", "true", "t", "yes", "y", "on":
+		return true, true
+	case "0", "false", "f", "no", "n", "off":
+		return false, true
+	}
+	return false, false
+}
+
+// usableHash 判断哈希是否为插件能校验的格式：bcrypt、mosquitto $7$/$6$，或无盐的 sha256 十六进制。
+func usableHash(h string) bool {
+	switch {
+	case strings.HasPrefix(h, "$2a$"), strings.HasPrefix(h, "$2b$"), strings.HasPrefix(h, "$2y$"),
+		strings.HasPrefix(h, "$7$"), strings.HasPrefix(h, "$6$"):
+		return true
+	}
+	if len(h) != 64 {
+		return false
+	}
+	_, err := hex.DecodeString(h)
+	return err == nil
+}
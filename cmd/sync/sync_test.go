@@ -0,0 +1,121 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/go-ldap/ldap/v3"
+
+	"auth-plugin/internal/aclrule"
+)
+
+const bcryptHash = "$2a$04$abcdefghijklmnopqrstuuLnCFpb0SEv6VMgpiRM7SA7OvJ/1Ygpm"
+
+func TestReadUsers(t *testing.T) {
+	t.Parallel()
+	in := "username,password_hash,enabled\n# c\nalice," + bcryptHash + "\nbob,,false\n"
+	got, err := readUsers(strings.NewReader(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0] != (srcUser{"alice", bcryptHash, true}) || got[1] != (srcUser{"bob", "", false}) {
+		t.Fatalf("got %+v", got)
+	}
+	for _, bad := range []string{"alice\n", "alice,x,maybe\n", "*,x\n", "a,x\na,y\n"} {
+		if _, err := readUsers(strings.NewReader(bad)); err == nil {
+			t.Errorf("readUsers(%q) should fail", bad)
+		}
+	}
+	if _, err := readRules(strings.NewReader("alice,devices/#/x,r\n")); err == nil {
+		t.Error("readRules should reject patterns the plugin rejects")
+	}
+}
+
+func TestComputeDiff(t *testing.T) {
+	t.Parallel()
+	src := snapshot{
+		users: []srcUser{
+			{"alice", bcryptHash, true},
+			{"bob", "", false},
+			{"carol", "{SSHA}abc", true},
+			{"dave", "$7$101$c2FsdA$aGFzaA==", true},
+		},
+		rules: []srcRule{
+			{"alice", aclrule.Rule{Pattern: "devices/alice/#", Acc: aclrule.Read | aclrule.Write}},
+			{"bob", aclrule.Rule{Pattern: "b/#", Acc: aclrule.Read}},
+			{"zed", aclrule.Rule{Pattern: "z/#", Acc: aclrule.Read}},
+		},
+		hasRules: true,
+	}
+	db := dbState{
+		users: map[string]dbUser{
+			"alice": {"old", true},
+			"bob":   {bcryptHash, true},
+			"eve":   {bcryptHash, true},
+			"frank": {bcryptHash, false},
+		},
+		rules: map[string]map[string]int{
+			"alice": {"devices/alice/#": aclrule.Read, "old/#": aclrule.Read},
+			"eve":   {"e/#": aclrule.Read},
+			"*":     {"broadcast/#": aclrule.Subscribe},
+		},
+	}
+	var warnings []string
+	changes := computeDiff(src, db, diffOptions{disableMissing: true}, func(s string) { warnings = append(warnings, s) })
+	var got []string
+	for _, c := range changes {
+		got = append(got, c.String())
+	}
+	want := []string{
+		"~ user alice password hash",
+		"~ acl alice devices/alice/# read -> read|write",
+		"- acl alice old/#",
+		"~ user bob enabled -> disabled",
+		"+ acl bob b/# read",
+		"+ user dave (enabled)",
+		"~ user eve enabled -> disabled",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("diff:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	w := strings.Join(warnings, "\n")
+	for _, s := range []string{"carol: password hash format is not supported", "carol: new user without a usable", "acl zed z/#"} {
+		if !strings.Contains(w, s) {
+			t.Errorf("warnings missing %q:\n%s", s, w)
+		}
+	}
+
+	// 不管理 ACL、不停用缺失用户时只剩用户本身的变化
+	src.hasRules = false
+	changes = computeDiff(src, db, diffOptions{}, func(string) {})
+	if len(changes) != 3 {
+		t.Errorf("changes = %v", changes)
+	}
+}
+
+func TestLDAPEntries(t *testing.T) {
+	t.Parallel()
+	s := ldapSource{userAttr: "cn", hashAttr: "userPassword", enabledAttr: "deviceEnabled", aclAttr: "mqttACL"}
+	entries := []*ldap.Entry{
+		ldap.NewEntry("cn=alice,ou=devices", map[string][]string{
+			"cn": {"alice"}, "userPassword": {"{CRYPT}" + bcryptHash}, "deviceEnabled": {"FALSE"},
+			"mqttACL": {"devices/{username}/# r,w", "cmd/alice s"},
+		}),
+		ldap.NewEntry("cn=bob,ou=devices", map[string][]string{"cn": {"bob"}}),
+	}
+	snap, err := s.fromEntries(entries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snap.users) != 2 || snap.users[0] != (srcUser{"alice", bcryptHash, false}) || snap.users[1] != (srcUser{"bob", "", true}) {
+		t.Errorf("users = %+v", snap.users)
+	}
+	if !snap.hasRules || len(snap.rules) != 2 || snap.rules[0].Acc != aclrule.Read|aclrule.Write || snap.rules[1].Acc != aclrule.Subscribe {
+		t.Errorf("rules = %+v", snap.rules)
+	}
+
+	bad := []*ldap.Entry{ldap.NewEntry("cn=x", map[string][]string{"cn": {"x"}, "mqttACL": {"no-access"}})}
+	if _, err := s.fromEntries(bad); err == nil {
+		t.Error("ACL value without access should fail")
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"github.com/jackc/pgx/v5"
+
+	"auth-plugin/internal/aclrule"
+)
+
+// acl 子命令管理 acls 表。username 为 '*' 时操作全局规则（schema 里没有角色表，
+// 全局规则是唯一的共享层）。写入前用插件同一套规则校验 pattern 和 access。
+
+const (
+	upsertACL = `INSERT INTO acls (username, pattern, acc) VALUES ($1, $2, $3)
+ON CONFLICT (username, pattern) DO UPDATE SET acc = EXCLUDED.acc`
+	deleteACL = "DELETE FROM acls WHERE username = $1 AND pattern = $2"
+	// 指定用户时同时列出作用于该用户的全局规则
+	listACLs = `SELECT username, pattern, acc FROM acls
+WHERE $1 = '' OR username = $1 OR username = '*'
+ORDER BY username = '*', username, pattern`
+)
+
+const aclUsage = "acl add <username|*> <pattern> <access> | acl remove <username|*> <pattern> | acl list [username]"
+
+func cmdACL(ctx context.Context, conn *pgx.Conn, args []string) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+	switch args[0] {
+	case "add":
+		return aclAdd(ctx, conn, args[1:])
+	case "remove":
+		return aclRemove(ctx, conn, args[1:])
+	case "list":
+		return aclList(ctx, conn, args[1:])
+	}
+	return errUsage
+}
+
+// parseAccess 接受位掩码数字，或 read/write/subscribe（可缩写为 r/w/s）用 ',' 或 '|' 连接。
+func parseAccess(s string) (int, error) {
+	return aclrule.ParseAcc(s)
+}
+
+func aclAdd(ctx context.Context, conn *pgx.Conn, args []string) error {
+	pos, err := parseArgs(flag.NewFlagSet("acl add", flag.ContinueOnError), args, 3)
+	if err != nil {
+		return err
+	}
+	username, pattern := pos[0], pos[1]
+	if err := aclrule.ValidatePattern(pattern); err != nil {
+		return err
+	}
+	acc, err := parseAccess(pos[2])
+	if err != nil {
+		return err
+	}
+	// acls 没有外键，这里拦住拼错的用户名
+	if username != "*" {
+		if err := requireUser(ctx, conn, username); err != nil {
+			return err
+		}
+	}
+	if _, err := conn.Exec(ctx, upsertACL, username, pattern, acc); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "set %s %s (%s)\n", username, pattern, accString(acc))
+	return nil
+}
+
+func aclRemove(ctx context.Context, conn *pgx.Conn, args []string) error {
+	pos, err := parseArgs(flag.NewFlagSet("acl remove", flag.ContinueOnError), args, 2)
+	if err != nil {
+		return err
+	}
+	tag, err := conn.Exec(ctx, deleteACL, pos[0], pos[1])
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("no rule %q for %s", pos[1], pos[0])
+	}
+	fmt.Fprintf(os.Stderr, "removed %s %s\n", pos[0], pos[1])
+	return nil
+}
+
+type userRule struct {
+	username string
+	aclrule.Rule
+}
+
+func aclList(ctx context.Context, conn *pgx.Conn, args []string) error {
+	fs := flag.NewFlagSet("acl list", flag.ContinueOnError)
+	if err := fs.Parse(args); err != nil || fs.NArg() > 1 {
+		return errUsage
+	}
+	rows, err := conn.Query(ctx, listACLs, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	list, err := pgx.CollectRows(rows, func(r pgx.CollectableRow) (userRule, error) {
+		var u userRule
+		return u, r.Scan(&u.username, &u.Pattern, &u.Acc)
+	})
+	if err != nil {
+		return err
+	}
+	return writeACLs(os.Stdout, list)
+}
+
+// writeACLs 输出规则；表里已有的非法 pattern 标记出来，便于清理。
+func writeACLs(w io.Writer, list []userRule) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "USERNAME\tPATTERN\tACCESS\t")
+	for _, u := range list {
+		note := ""
+		if err := aclrule.ValidatePattern(u.Pattern); err != nil {
+			note = "invalid: " + err.Error()
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", u.username, u.Pattern, accString(u.Acc), note)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/jackc/pgx/v5"
+	"golang.org/x/crypto/bcrypt"
+
+	"auth-plugin/internal/aclrule"
+)
+
+// enabled 列按插件的读取方式（Scan 到 int16）写入 1/0。
+const (
+	insertDevice = `INSERT INTO iot_devices (username, password_hash, salt, enabled)
+VALUES ($1, $2, '', $3) ON CONFLICT (username) DO NOTHING`
+	updatePassword = "UPDATE iot_devices SET password_hash = $2, salt = '' WHERE username = $1"
+	updateEnabled  = "UPDATE iot_devices SET enabled = $2 WHERE username = $1"
+	insertBinding  = "INSERT INTO client_bindings (username, client_id) VALUES ($1, $2) ON CONFLICT DO NOTHING"
+	deleteBinding  = "DELETE FROM client_bindings WHERE username = $1 AND client_id = $2"
+	deviceExists   = "SELECT EXISTS (SELECT 1 FROM iot_devices WHERE username = $1)"
+	listDevices    = `SELECT d.username, d.enabled, count(b.client_id)
+FROM iot_devices d LEFT JOIN client_bindings b ON b.username = d.username
+WHERE NOT $1 OR d.enabled = 0
+GROUP BY d.username, d.enabled ORDER BY d.username`
+	selectDevice   = "SELECT password_hash, enabled FROM iot_devices WHERE username = $1"
+	selectBindings = "SELECT client_id FROM client_bindings WHERE username = $1 ORDER BY client_id"
+	selectACLs     = "SELECT pattern, acc FROM acls WHERE username = $1 ORDER BY pattern"
+)
+
+func noSuchUser(username string) error {
+	return fmt.Errorf("no such user %q", username)
+}
+
+func enabledFlag(enabled bool) int16 {
+	if enabled {
+		return 1
+	}
+	return 0
+}
+
+func cmdAdd(ctx context.Context, conn *pgx.Conn, args []string) error {
+	fs := flag.NewFlagSet("add", flag.ContinueOnError)
+	cost := fs.Int("cost", bcrypt.DefaultCost, "bcrypt cost")
+	disabled := fs.Bool("disabled", false, "create the user disabled")
+	pos, err := parseArgs(fs, args, 1)
+	if err != nil {
+		return err
+	}
+	hash, err := promptHash(*cost)
+	if err != nil {
+		return err
+	}
+	tag, err := conn.Exec(ctx, insertDevice, pos[0], hash, enabledFlag(!*disabled))
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("user %q already exists (use set-password)", pos[0])
+	}
+	fmt.Fprintf(os.Stderr, "added %s\n", pos[0])
+	return nil
+}
+
+func cmdSetPassword(ctx context.Context, conn *pgx.Conn, args []string) error {
+	fs := flag.NewFlagSet("set-password", flag.ContinueOnError)
+	cost := fs.Int("cost", bcrypt.DefaultCost, "bcrypt cost")
+	pos, err := parseArgs(fs, args, 1)
+	if err != nil {
+		return err
+	}
+	// 先确认用户存在，避免输完密码才报错
+	if err := requireUser(ctx, conn, pos[0]); err != nil {
+		return err
+	}
+	hash, err := promptHash(*cost)
+	if err != nil {
+		return err
+	}
+	return execUser(ctx, conn, pos[0], "updated password for", updatePassword, pos[0], hash)
+}
+
+func cmdDisable(ctx context.Context, conn *pgx.Conn, args []string) error {
+	return setEnabled(ctx, conn, "disable", args, false)
+}
+
+func cmdEnable(ctx context.Context, conn *pgx.Conn, args []string) error {
+	return setEnabled(ctx, conn, "enable", args, true)
+}
+
+func setEnabled(ctx context.Context, conn *pgx.Conn, name string, args []string, enabled bool) error {
+	pos, err := parseArgs(flag.NewFlagSet(name, flag.ContinueOnError), args, 1)
+	if err != nil {
+		return err
+	}
+	return execUser(ctx, conn, pos[0], name+"d", updateEnabled, pos[0], enabledFlag(enabled))
+}
+
+func cmdBindClientID(ctx context.Context, conn *pgx.Conn, args []string) error {
+	fs := flag.NewFlagSet("bind-clientid", flag.ContinueOnError)
+	remove := fs.Bool("remove", false, "remove the binding instead of adding it")
+	pos, err := parseArgs(fs, args, 2)
+	if err != nil {
+		return err
+	}
+	if *remove {
+		tag, err := conn.Exec(ctx, deleteBinding, pos[0], pos[1])
+		if err != nil {
+			return err
+		}
+		if tag.RowsAffected() == 0 {
+			return fmt.Errorf("%s is not bound to %q", pos[0], pos[1])
+		}
+		fmt.Fprintf(os.Stderr, "unbound %s from %s\n", pos[1], pos[0])
+		return nil
+	}
+	// client_bindings 的外键也会拒绝，但这里给出更清楚的错误
+	if err := requireUser(ctx, conn, pos[0]); err != nil {
+		return err
+	}
+	if _, err := conn.Exec(ctx, insertBinding, pos[0], pos[1]); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "bound %s to %s\n", pos[1], pos[0])
+	return nil
+}
+
+type deviceSummary struct {
+	username string
+	enabled  int16
+	bindings int64
+}
+
+func cmdList(ctx context.Context, conn *pgx.Conn, args []string) error {
+	fs := flag.NewFlagSet("list", flag.ContinueOnError)
+	onlyDisabled := fs.Bool("disabled", false, "only list disabled users")
+	if _, err := parseArgs(fs, args, 0); err != nil {
+		return err
+	}
+	rows, err := conn.Query(ctx, listDevices, *onlyDisabled)
+	if err != nil {
+		return err
+	}
+	var list []deviceSummary
+	for rows.Next() {
+		var d deviceSummary
+		if err := rows.Scan(&d.username, &d.enabled, &d.bindings); err != nil {
+			return err
+		}
+		list = append(list, d)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	return writeList(os.Stdout, list)
+}
+
+func writeList(w io.Writer, list []deviceSummary) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "USERNAME\tENABLED\tCLIENT IDS")
+	for _, d := range list {
+		fmt.Fprintf(tw, "%s\t%t\t%d\n", d.username, d.enabled != 0, d.bindings)
+	}
+	return tw.Flush()
+}
+
+type deviceDetail struct {
+	username string
+	hash     string
+	enabled  int16
+	clientID []string
+	acls     []aclrule.Rule
+}
+
+func cmdShow(ctx context.Context, conn *pgx.Conn, args []string) error {
+	pos, err := parseArgs(flag.NewFlagSet("show", flag.ContinueOnError), args, 1)
+	if err != nil {
+		return err
+	}
+	d := deviceDetail{username: pos[0]}
+	err = conn.QueryRow(ctx, selectDevice, d.username).Scan(&d.hash, &d.enabled)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return noSuchUser(d.username)
+	}
+	if err != nil {
+		return err
+	}
+	rows, err := conn.Query(ctx, selectBindings, d.username)
+	if err != nil {
+		return err
+	}
+	if d.clientID, err = pgx.CollectRows(rows, pgx.RowTo[string]); err != nil {
+		return err
+	}
+	if rows, err = conn.Query(ctx, selectACLs, d.username); err != nil {
+		return err
+	}
+	if d.acls, err = pgx.CollectRows(rows, func(r pgx.CollectableRow) (aclrule.Rule, error) {
+		var a aclrule.Rule
+		return a, r.Scan(&a.Pattern, &a.Acc)
+	}); err != nil {
+		return err
+	}
+	return writeDetail(os.Stdout, d)
+}
+
+func writeDetail(w io.Writer, d deviceDetail) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 1, ' ', 0)
+	fmt.Fprintf(tw, "username:\t%s\n", d.username)
+	fmt.Fprintf(tw, "enabled:\t%t\n", d.enabled != 0)
+	fmt.Fprintf(tw, "password:\t%s\n", hashScheme(d.hash))
+	fmt.Fprintf(tw, "client ids:\t%s\n", listOrNone(d.clientID))
+	var acls []string
+	for _, a := range d.acls {
+		acls = append(acls, fmt.Sprintf("%s (%s)", a.Pattern, accString(a.Acc)))
+	}
+	fmt.Fprintf(tw, "acls:\t%s\n", listOrNone(acls))
+	return tw.Flush()
+}
+
+func listOrNone(items []string) string {
+	if len(items) == 0 {
+		return "-"
+	}
+	return strings.Join(items, ", ")
+}
+
+// accString 把 acls.acc 位掩码（1=read 2=write 4=subscribe）显示为 read|write|subscribe。
+func accString(acc int) string {
+	return aclrule.FormatAcc(acc)
+}
+
+func promptHash(cost int) (string, error) {
+	pw, err := readPassword(os.Stdin)
+	if err != nil {
+		return "", err
+	}
+	return hashPassword(pw, cost)
+}
+
+func requireUser(ctx context.Context, conn *pgx.Conn, username string) error {
+	var ok bool
+	if err := conn.QueryRow(ctx, deviceExists, username).Scan(&ok); err != nil {
+		return err
+	}
+	if !ok {
+		return noSuchUser(username)
+	}
+	return nil
+}
+
+// execUser 执行只影响一个用户的语句，没有匹配行时报告用户不存在。
+func execUser(ctx context.Context, conn *pgx.Conn, username, done, sql string, args ...any) error {
+	tag, err := conn.Exec(ctx, sql, args...)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return noSuchUser(username)
+	}
+	fmt.Fprintf(os.Stderr, "%s %s\n", done, username)
+	return nil
+}
@@ -0,0 +1,107 @@
+// useradm 管理插件使用的 PostgreSQL 表（iot_devices、client_bindings），替代手写 SQL。
+// 表名和列名与插件内置查询一致（见 plugin.go 的 authQuery/bindQuery）。
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+type command struct {
+	name  string
+	usage string
+	run   func(ctx context.Context, conn *pgx.Conn, args []string) error
+}
+
+var commands = []command{
+	{"add", "add [-cost N] [-disabled] <username>", cmdAdd},
+	{"set-password", "set-password [-cost N] <username>", cmdSetPassword},
+	{"disable", "disable <username>", cmdDisable},
+	{"enable", "enable <username>", cmdEnable},
+	{"bind-clientid", "bind-clientid [-remove] <username> <clientid>", cmdBindClientID},
+	{"list", "list [-disabled]", cmdList},
+	{"show", "show <username>", cmdShow},
+	{"pending", "pending [-reject <username>]", cmdPending},
+	{"acl", aclUsage, cmdACL},
+	{"totp", "totp [-issuer NAME] [-remove] <username>", cmdTOTP},
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: useradm [-dsn DSN] <command> [args]")
+	fmt.Fprintln(os.Stderr, "\ncommands:")
+	for _, c := range commands {
+		fmt.Fprintln(os.Stderr, "  "+c.usage)
+	}
+	fmt.Fprintln(os.Stderr, "\nflags:")
+	flag.PrintDefaults()
+}
+
+func findCommand(name string) (command, bool) {
+	for _, c := range commands {
+		if c.name == name {
+			return c, true
+		}
+	}
+	return command{}, false
+}
+
+// errUsage 表示参数错误，main 打印用法并以 2 退出。
+var errUsage = errors.New("usage")
+
+func main() {
+	dsn := flag.String("dsn", os.Getenv("PG_DSN"), "PostgreSQL DSN (default $PG_DSN)")
+	timeout := flag.Duration("timeout", 30*time.Second, "overall timeout per command")
+	flag.Usage = usage
+	flag.Parse()
+
+	c, ok := findCommand(flag.Arg(0))
+	if !ok {
+		usage()
+		os.Exit(2)
+	}
+	if *dsn == "" {
+		fmt.Fprintln(os.Stderr, "useradm: -dsn or PG_DSN is required")
+		os.Exit(2)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+	conn, err := pgx.Connect(ctx, *dsn)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "useradm:", err)
+		os.Exit(1)
+	}
+	defer conn.Close(context.Background())
+
+	if err := c.run(ctx, conn, flag.Args()[1:]); err != nil {
+		if errors.Is(err, errUsage) {
+			fmt.Fprintln(os.Stderr, "usage: useradm "+c.usage)
+			os.Exit(2)
+		}
+		fmt.Fprintln(os.Stderr, "useradm:", err)
+		os.Exit(1)
+	}
+}
+
+// parseArgs 解析子命令的 flag 并要求恰好 n 个位置参数。
+func parseArgs(fs *flag.FlagSet, args []string, n int) ([]string, error) {
+	fs.SetOutput(os.Stderr)
+	if err := fs.Parse(args); err != nil {
+		return nil, errUsage
+	}
+	if fs.NArg() != n {
+		return nil, errUsage
+	}
+	for _, a := range fs.Args() {
+		if a == "" {
+			return nil, errUsage
+		}
+	}
+	return fs.Args(), nil
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"auth-plugin/internal/aclrule"
+)
+
+func TestParseArgs(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		args []string
+		n    int
+		want []string
+		ok   bool
+	}{
+		{[]string{"alice"}, 1, []string{"alice"}, true},
+		{[]string{"-remove", "alice", "c1"}, 2, []string{"alice", "c1"}, true},
+		{[]string{}, 1, nil, false},
+		{[]string{"alice", "extra"}, 1, nil, false},
+		{[]string{""}, 1, nil, false},
+		{[]string{"-bogus", "alice"}, 1, nil, false},
+	}
+	for _, tt := range tests {
+		fs := flag.NewFlagSet("t", flag.ContinueOnError)
+		fs.Bool("remove", false, "")
+		fs.SetOutput(io.Discard)
+		got, err := parseArgs(fs, tt.args, tt.n)
+		if tt.ok != (err == nil) || strings.Join(got, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("parseArgs(%q, %d) = %q, %v", tt.args, tt.n, got, err)
+		}
+		if err != nil && !errors.Is(err, errUsage) {
+			t.Errorf("parseArgs(%q) error %v, want errUsage", tt.args, err)
+		}
+	}
+	for _, c := range commands {
+		if got, ok := findCommand(c.name); !ok || got.name != c.name {
+			t.Errorf("findCommand(%q) failed", c.name)
+		}
+	}
+	if _, ok := findCommand("drop"); ok {
+		t.Error("unknown command should not be found")
+	}
+}
+
+func TestHashScheme(t *testing.T) {
+	t.Parallel()
+	bc, err := hashPassword("pw", 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := map[string]string{
+		bc:                         "bcrypt (cost 4)",
+		"":                         "none",
+		"$argon2id$v=19$m=64$x$y":  "unsupported (argon2id)",
+		"7a37b85c8918eac19a9089c0": "sha256+salt (weak)",
+		"$6$saltstring$svn8UoSVapNtMuq1ukKS4tPQd8iKwSMHWjl/O817G3uBnIFNjnQJuesI68u4OTLiBFdcbYEdFCoEOfaS35inz1": "sha512-crypt (5000 rounds, weak)",
+	}
+	for hash, want := range tests {
+		if got := hashScheme(hash); got != want {
+			t.Errorf("hashScheme(%q) = %q, want %q", hash, got, want)
+		}
+	}
+	if _, err := hashPassword("pw", 99); err == nil {
+		t.Error("cost 99 should be rejected")
+	}
+}
+
+func TestWriteDetail(t *testing.T) {
+	t.Parallel()
+	var buf bytes.Buffer
+	err := writeDetail(&buf, deviceDetail{
+		username: "alice",
+		hash:     "abc",
+		enabled:  1,
+		clientID: []string{"c1", "c2"},
+		acls:     []aclrule.Rule{{Pattern: "devices/alice/#", Acc: 3}, {Pattern: "cmd/+", Acc: 4}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `username:   alice
+enabled:    true
+password:   sha256+salt (weak)
+client ids: c1, c2
+acls:       devices/alice/# (read|write), cmd/+ (subscribe)
+`
+	if buf.String() != want {
+		t.Fatalf("detail =\n%s\nwant\n%s", buf.String(), want)
+	}
+}
+
+func TestParseAccess(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		in   string
+		want int
+		ok   bool
+	}{
+		{"3", 3, true},
+		{"read|write", 3, true},
+		{"r,s", 5, true},
+		{"read|write|subscribe", 7, true},
+		{"8", 0, false},
+		{"0", 0, false},
+		{"publish", 0, false},
+		{"", 0, false},
+	}
+	for _, tt := range tests {
+		got, err := parseAccess(tt.in)
+		if (err == nil) != tt.ok || (tt.ok && got != tt.want) {
+			t.Errorf("parseAccess(%q) = %d, %v; want %d", tt.in, got, err, tt.want)
+		}
+	}
+	// accString 的输出可以原样传回 parseAccess
+	if got, err := parseAccess(accString(7)); err != nil || got != 7 {
+		t.Errorf("round trip = %d, %v", got, err)
+	}
+}
+
+func TestWriteACLs(t *testing.T) {
+	t.Parallel()
+	var buf bytes.Buffer
+	err := writeACLs(&buf, []userRule{
+		{"alice", aclrule.Rule{Pattern: "devices/alice/#", Acc: 1}},
+		{"*", aclrule.Rule{Pattern: "bad/#/x", Acc: 4}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	if !strings.Contains(out, "alice     devices/alice/#  read") || !strings.Contains(out, "invalid: '#' must be the whole last level") {
+		t.Fatalf("unexpected output:\n%s", out)
+	}
+}
+
+func TestOTPAuthURI(t *testing.T) {
+	t.Parallel()
+	secret, err := newTOTPSecret()
+	if err != nil || len(secret) != 32 {
+		t.Fatalf("newTOTPSecret = %q, %v", secret, err)
+	}
+	got := otpauthURI("ACME MQTT", "dashboard", "JBSWY3DPEHPK3PXP")
+	want := "otpauth://totp/ACME%20MQTT:dashboard?algorithm=SHA1&digits=6&issuer=ACME+MQTT&period=30&secret=JBSWY3DPEHPK3PXP"
+	if got != want {
+		t.Fatalf("otpauthURI = %s, want %s", got, want)
+	}
+}
+
+func TestWritePending(t *testing.T) {
+	t.Parallel()
+	var buf bytes.Buffer
+	seen := time.Date(2024, 3, 1, 8, 0, 0, 0, time.UTC)
+	err := writePending(&buf, []pendingSummary{{
+		username: "sensor-42", subject: "CN=sensor-42,O=Acme", sha256: strings.Repeat("ab", 32),
+		address: "10.0.0.7", firstSeen: seen, lastSeen: seen.Add(time.Hour), attempts: 3,
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	if !strings.Contains(out, "sensor-42  CN=sensor-42,O=Acme  abababababababab  10.0.0.7  2024-03-01T08:00:00Z  2024-03-01T09:00:00Z  3") {
+		t.Fatalf("unexpected output:\n%s", out)
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/term"
+
+	"auth-plugin/internal/shacrypt"
+)
+
+// 新密码统一使用 bcrypt；插件仍能校验旧的 sha256+salt，但会计为弱哈希（见 weak_hash_policy）。
+
+func hashPassword(password string, cost int) (string, error) {
+	if cost < bcrypt.MinCost || cost > bcrypt.MaxCost {
+		return "", fmt.Errorf("bcrypt cost must be %d-%d", bcrypt.MinCost, bcrypt.MaxCost)
+	}
+	h, err := bcrypt.GenerateFromPassword([]byte(password), cost)
+	return string(h), err
+}
+
+// hashScheme 给 show 输出存储哈希的类型，不暴露哈希本身。
+func hashScheme(hash string) string {
+	switch {
+	case hash == "":
+		return "none"
+	case strings.HasPrefix(hash, "$2a$"), strings.HasPrefix(hash, "$2b$"), strings.HasPrefix(hash, "$2y$"):
+		if cost, err := bcrypt.Cost([]byte(hash)); err == nil {
+			return fmt.Sprintf("bcrypt (cost %d)", cost)
+		}
+		return "bcrypt"
+	case shacrypt.Is(hash):
+		p, _ := shacrypt.Parse(hash)
+		bits := map[string]string{"5": "256", "6": "512"}[p.Variant]
+		return fmt.Sprintf("sha%s-crypt (%d rounds, weak)", bits, p.Rounds)
+	case strings.HasPrefix(hash, "$7$"):
+		return "mosquitto pbkdf2 (weak)"
+	case strings.HasPrefix(hash, "$6$"):
+		return "mosquitto sha512 (weak)"
+	case strings.HasPrefix(hash, "$"):
+		return "unsupported (" + strings.SplitN(hash[1:], "$", 2)[0] + ")"
+	}
+	return "sha256+salt (weak)"
+}
+
+// readPassword 与 bcryptgen 相同：终端上不回显并要求确认，stdin 为管道时读取一行。
+func readPassword(in *os.File) (string, error) {
+	fd := int(in.Fd())
+	if !term.IsTerminal(fd) {
+		return readLine(in)
+	}
+	fmt.Fprint(os.Stderr, "Password: ")
+	first, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", err
+	}
+	if len(first) == 0 {
+		return "", errors.New("empty password")
+	}
+	fmt.Fprint(os.Stderr, "Confirm password: ")
+	second, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", err
+	}
+	if string(first) != string(second) {
+		return "", errors.New("passwords do not match")
+	}
+	return string(first), nil
+}
+
+func readLine(r io.Reader) (string, error) {
+	s, err := bufio.NewReader(r).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	s = strings.TrimRight(s, "\r\n")
+	if s == "" {
+		return "", errors.New("empty password")
+	}
+	return s, nil
+}
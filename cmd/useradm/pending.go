@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// 待审批设备：插件 cert_auto_register 建的停用设备行（见 device_registrations）。
+// 审批用 enable，拒绝用 pending -reject（删除设备行，登记随外键一起删除）。
+const (
+	listPending = `SELECT r.username, r.cert_subject, r.cert_sha256, r.address, r.first_seen, r.last_seen, r.attempts
+FROM device_registrations r JOIN iot_devices d ON d.username = r.username
+WHERE d.enabled = 0 ORDER BY r.first_seen`
+	deletePending = `DELETE FROM iot_devices d USING device_registrations r
+WHERE d.username = $1 AND r.username = d.username AND d.enabled = 0`
+)
+
+type pendingSummary struct {
+	username  string
+	subject   string
+	sha256    string
+	address   string
+	firstSeen time.Time
+	lastSeen  time.Time
+	attempts  int64
+}
+
+func cmdPending(ctx context.Context, conn *pgx.Conn, args []string) error {
+	fs := flag.NewFlagSet("pending", flag.ContinueOnError)
+	reject := fs.String("reject", "", "delete this pending device instead of listing")
+	if _, err := parseArgs(fs, args, 0); err != nil {
+		return err
+	}
+	if *reject != "" {
+		return execUser(ctx, conn, *reject, "rejected pending device", deletePending, *reject)
+	}
+	rows, err := conn.Query(ctx, listPending)
+	if err != nil {
+		return err
+	}
+	list, err := pgx.CollectRows(rows, func(r pgx.CollectableRow) (pendingSummary, error) {
+		var p pendingSummary
+		return p, r.Scan(&p.username, &p.subject, &p.sha256, &p.address, &p.firstSeen, &p.lastSeen, &p.attempts)
+	})
+	if err != nil {
+		return err
+	}
+	return writePending(os.Stdout, list)
+}
+
+func writePending(w io.Writer, list []pendingSummary) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "USERNAME\tCERT SUBJECT\tSHA256\tADDRESS\tFIRST SEEN\tLAST SEEN\tATTEMPTS")
+	for _, p := range list {
+		fmt.Fprintf(tw, "%s\t%s\t%.16s\t%s\t%s\t%s\t%d\n", p.username, p.subject, p.sha256, p.address,
+			p.firstSeen.UTC().Format(time.RFC3339), p.lastSeen.UTC().Format(time.RFC3339), p.attempts)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,157 @@
+// waitfor 在 broker 启动前等待依赖就绪：PostgreSQL 能接受连接，并且 schema_migrations
+// 已达到期望版本（默认为本二进制内嵌的最新迁移）。用于 docker-compose 的 depends_on 之前一步
+// 或 Kubernetes initContainer。
+//
+// 每次失败后按指数退避重试，-timeout 到期仍未就绪则以退出码 1 结束，最后一次的原因写到 stderr。
+// 只读：不会创建 schema_migrations，也不会执行迁移。
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"auth-plugin/internal/migrations"
+)
+
+type config struct {
+	dsn         string
+	schema      int
+	timeout     time.Duration
+	attempt     time.Duration
+	interval    time.Duration
+	maxInterval time.Duration
+	quiet       bool
+}
+
+func parseFlags(args []string, latest int) (config, error) {
+	var c config
+	var dsnFile string
+	fs := flag.NewFlagSet("waitfor", flag.ContinueOnError)
+	fs.StringVar(&c.dsn, "dsn", os.Getenv("PG_DSN"), "PostgreSQL DSN (default $PG_DSN)")
+	fs.StringVar(&dsnFile, "dsn-file", "", "read the DSN from this file (e.g. a mounted secret)")
+	fs.IntVar(&c.schema, "schema", latest, "minimum schema_migrations version; 0 only waits for a connection")
+	fs.DurationVar(&c.timeout, "timeout", 2*time.Minute, "give up after this long")
+	fs.DurationVar(&c.attempt, "attempt-timeout", 5*time.Second, "timeout of a single attempt")
+	fs.DurationVar(&c.interval, "interval", 500*time.Millisecond, "delay after the first failure")
+	fs.DurationVar(&c.maxInterval, "max-interval", 10*time.Second, "upper bound of the backoff delay")
+	fs.BoolVar(&c.quiet, "q", false, "only report the final failure")
+	if err := fs.Parse(args); err != nil {
+		return c, err
+	}
+	if fs.NArg() > 0 {
+		return c, fmt.Errorf("unexpected argument %q", fs.Arg(0))
+	}
+	if dsnFile != "" {
+		b, err := os.ReadFile(dsnFile)
+		if err != nil {
+			return c, err
+		}
+		c.dsn = strings.TrimSpace(string(b))
+	}
+	switch {
+	case c.dsn == "":
+		return c, errors.New("-dsn, -dsn-file or PG_DSN is required")
+	case c.schema < 0:
+		return c, errors.New("-schema must not be negative")
+	case c.timeout <= 0 || c.attempt <= 0 || c.interval <= 0:
+		return c, errors.New("-timeout, -attempt-timeout and -interval must be positive")
+	case c.maxInterval < c.interval:
+		return c, errors.New("-max-interval must not be less than -interval")
+	}
+	return c, nil
+}
+
+// backoff 返回第 n 次（从 0 开始）失败后的等待时间：指数增长，封顶 max，
+// 再减去最多 20% 的随机抖动，避免多个副本同时重连。
+func backoff(n int, base, max time.Duration) time.Duration {
+	d := base
+	for i := 0; i < n && d < max; i++ {
+		d *= 2
+	}
+	d = min(d, max)
+	return d - time.Duration(rand.Int64N(int64(d)/5+1))
+}
+
+// schemaVersion 返回已执行的最高迁移版本；没有 schema_migrations 表时为 0。
+func schemaVersion(ctx context.Context, conn *pgx.Conn) (int, error) {
+	var v int
+	err := conn.QueryRow(ctx, migrations.VersionQuery).Scan(&v)
+	return v, err
+}
+
+func probe(ctx context.Context, c config) error {
+	conn, err := pgx.Connect(ctx, c.dsn)
+	if err != nil {
+		return err
+	}
+	defer conn.Close(context.Background())
+	if c.schema == 0 {
+		return conn.Ping(ctx)
+	}
+	v, err := schemaVersion(ctx, conn)
+	if err != nil {
+		return err
+	}
+	if v < c.schema {
+		return fmt.Errorf("schema is at version %d, waiting for %d (run migrate up)", v, c.schema)
+	}
+	return nil
+}
+
+// wait 重复调用 check 直到成功或 ctx 结束，返回最后一次的错误。
+func wait(ctx context.Context, c config, check func(context.Context) error, logf func(string, ...any)) error {
+	for n := 0; ; n++ {
+		actx, cancel := context.WithTimeout(ctx, c.attempt)
+		err := check(actx)
+		cancel()
+		if err == nil {
+			return nil
+		}
+		d := backoff(n, c.interval, c.maxInterval)
+		if !c.quiet {
+			logf("attempt %d: %v; retrying in %s", n+1, err, d.Round(time.Millisecond))
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(d):
+		}
+	}
+}
+
+func main() {
+	all, err := migrations.All()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "waitfor:", err)
+		os.Exit(1)
+	}
+	c, err := parseFlags(os.Args[1:], len(all))
+	if err != nil {
+		if !errors.Is(err, flag.ErrHelp) {
+			fmt.Fprintln(os.Stderr, "waitfor:", err)
+		}
+		os.Exit(2)
+	}
+	logf := func(format string, args ...any) {
+		fmt.Fprintf(os.Stderr, "waitfor: "+format+"\n", args...)
+	}
+
+	start := time.Now()
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+	if err := wait(ctx, c, func(ctx context.Context) error { return probe(ctx, c) }, logf); err != nil {
+		logf("not ready after %s: %v", c.timeout, err)
+		os.Exit(1)
+	}
+	if !c.quiet {
+		logf("ready after %s", time.Since(start).Round(time.Millisecond))
+	}
+}
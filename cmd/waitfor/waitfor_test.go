@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	t.Parallel()
+	base, max := 100*time.Millisecond, time.Second
+	for n, want := range []time.Duration{100, 200, 400, 800, 1000, 1000} {
+		want *= time.Millisecond
+		for i := 0; i < 20; i++ {
+			if d := backoff(n, base, max); d > want || d < want*4/5 {
+				t.Fatalf("backoff(%d) = %s, want within 20%% below %s", n, d, want)
+			}
+		}
+	}
+}
+
+func TestParseFlags(t *testing.T) {
+	t.Setenv("PG_DSN", "")
+	if _, err := parseFlags(nil, 3); err == nil {
+		t.Error("missing DSN should fail")
+	}
+	c, err := parseFlags([]string{"-dsn", "postgres://x"}, 3)
+	if err != nil || c.schema != 3 {
+		t.Fatalf("parseFlags = %+v, %v; want schema defaulting to the latest migration", c, err)
+	}
+	if _, err := parseFlags([]string{"-dsn", "postgres://x", "-interval", "5s", "-max-interval", "1s"}, 3); err == nil {
+		t.Error("-max-interval below -interval should fail")
+	}
+}
+
+func TestWait(t *testing.T) {
+	t.Parallel()
+	c := config{attempt: time.Second, interval: time.Millisecond, maxInterval: 2 * time.Millisecond}
+	var logged int
+	logf := func(string, ...any) { logged++ }
+
+	calls := 0
+	err := wait(context.Background(), c, func(context.Context) error {
+		if calls++; calls < 3 {
+			return errors.New("connection refused")
+		}
+		return nil
+	}, logf)
+	if err != nil || calls != 3 || logged != 2 {
+		t.Errorf("wait = %v after %d calls and %d log lines", err, calls, logged)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	err = wait(ctx, c, func(context.Context) error { return errors.New("schema is at version 1") }, logf)
+	if err == nil || err.Error() != "schema is at version 1" {
+		t.Errorf("wait should return the last error on timeout, got %v", err)
+	}
+}
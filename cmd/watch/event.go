@@ -0,0 +1,156 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"auth-plugin/pkg/topicmatch"
+)
+
+// record 对应插件 log_format=json 输出的字段（见 eventlog.go 的 logRecord）。
+type record struct {
+	Timestamp  string   `json:"timestamp"`
+	Level      string   `json:"level"`
+	Event      string   `json:"event"`
+	ConnID     string   `json:"conn_id"`
+	Username   string   `json:"username"`
+	ClientID   string   `json:"clientid"`
+	Topic      string   `json:"topic"`
+	Result     string   `json:"result"`
+	Backend    string   `json:"backend"`
+	LatencyMS  *float64 `json:"latency_ms"`
+	SampleRate int      `json:"sample_rate"`
+	Error      string   `json:"error"`
+	Message    string   `json:"msg"`
+}
+
+// parseLine 解析一行事件；非 JSON 行（与事件流混在一起的 mosquitto 文本日志）返回 false。
+func parseLine(line []byte) (record, bool) {
+	var r record
+	line = []byte(strings.TrimSpace(string(line)))
+	if len(line) == 0 || line[0] != '{' {
+		return r, false
+	}
+	if err := json.Unmarshal(line, &r); err != nil || r.Event == "" {
+		return r, false
+	}
+	return r, true
+}
+
+// filter 的各字段为空表示不过滤。username/clientid 支持 path.Match 通配（如 dev-*），
+// topic 按 MQTT 过滤器匹配（如 devices/+/telemetry）。
+type filter struct {
+	events   map[string]bool
+	results  map[string]bool
+	username string
+	clientID string
+	topic    string
+	connID   string
+}
+
+func splitSet(s string) map[string]bool {
+	if s == "" {
+		return nil
+	}
+	m := map[string]bool{}
+	for _, f := range strings.Split(s, ",") {
+		if f = strings.TrimSpace(strings.ToLower(f)); f != "" {
+			m[f] = true
+		}
+	}
+	return m
+}
+
+func globMatch(pattern, s string) bool {
+	if pattern == "" {
+		return true
+	}
+	ok, err := path.Match(pattern, s)
+	return ok && err == nil
+}
+
+func (f filter) match(r record) bool {
+	switch {
+	case f.events != nil && !f.events[r.Event]:
+		return false
+	case f.results != nil && !f.results[r.Result]:
+		return false
+	case f.connID != "" && r.ConnID != f.connID:
+		return false
+	case !globMatch(f.username, r.Username), !globMatch(f.clientID, r.ClientID):
+		return false
+	case f.topic != "" && (r.Topic == "" || !topicmatch.Match(f.topic, r.Topic)):
+		return false
+	}
+	return true
+}
+
+const (
+	ansiReset  = "\x1b[0m"
+	ansiRed    = "\x1b[31m"
+	ansiGreen  = "\x1b[32m"
+	ansiYellow = "\x1b[33m"
+	ansiDim    = "\x1b[2m"
+)
+
+func resultColor(result string) string {
+	switch result {
+	case "allow":
+		return ansiGreen
+	case "deny", "error":
+		return ansiRed
+	case "fail_open", "grace":
+		return ansiYellow
+	}
+	return ""
+}
+
+// format 输出一行：时间 结果 事件 用户/client 主题 耗时 后端 [错误或消息]。
+func format(w io.Writer, r record, color bool) {
+	ts := r.Timestamp
+	if t, err := time.Parse(time.RFC3339Nano, r.Timestamp); err == nil {
+		ts = t.Local().Format("15:04:05.000")
+	}
+	result := strings.ToUpper(r.Result)
+	if result == "" {
+		result = strings.ToUpper(r.Level)
+	}
+	if color {
+		if c := resultColor(r.Result); c != "" {
+			result = c + fmt.Sprintf("%-9s", result) + ansiReset
+		}
+	}
+	who := r.Username
+	if r.ClientID != "" {
+		who += "/" + r.ClientID
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s %-9s %-10s %s", ts, result, r.Event, who)
+	if r.Topic != "" {
+		fmt.Fprintf(&b, " %s", r.Topic)
+	}
+	if r.LatencyMS != nil {
+		fmt.Fprintf(&b, " %.2fms", *r.LatencyMS)
+	}
+	if r.Backend != "" {
+		fmt.Fprintf(&b, " via %s", r.Backend)
+	}
+	if r.SampleRate > 1 {
+		fmt.Fprintf(&b, " (1/%d sampled)", r.SampleRate)
+	}
+	detail := r.Error
+	if detail == "" {
+		detail = r.Message
+	}
+	if detail != "" {
+		if color {
+			detail = ansiDim + detail + ansiReset
+		}
+		fmt.Fprintf(&b, " %s", detail)
+	}
+	fmt.Fprintln(w, b.String())
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"time"
+)
+
+// follow 像 tail -F 一样跟随文件：从末尾（fromStart 时从头）开始读，
+// 文件被轮转（路径指向新文件）或截断时重新打开，每读到一整行调用 emit。
+func follow(ctx context.Context, path string, fromStart bool, poll time.Duration, emit func([]byte)) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func() { f.Close() }()
+	if !fromStart {
+		if _, err := f.Seek(0, io.SeekEnd); err != nil {
+			return err
+		}
+	}
+	r := bufio.NewReader(f)
+	var partial []byte
+	for {
+		line, err := r.ReadBytes('\n')
+		partial = append(partial, line...)
+		if err == nil {
+			emit(partial)
+			partial = partial[:0]
+			continue
+		}
+		if !errors.Is(err, io.EOF) {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(poll):
+		}
+		if reopen, err := changed(f, path); err != nil {
+			return err
+		} else if reopen {
+			nf, err := os.Open(path)
+			if err != nil {
+				// 轮转过程中新文件可能还没创建，下次再试
+				continue
+			}
+			f.Close()
+			f, partial = nf, partial[:0]
+			r.Reset(f)
+		}
+	}
+}
+
+// changed 判断 path 是否已指向另一个文件，或当前文件被截断到读位置之前。
+func changed(f *os.File, path string) (bool, error) {
+	st, err := os.Stat(path)
+	if err != nil {
+		return errors.Is(err, os.ErrNotExist), nil
+	}
+	cur, err := f.Stat()
+	if err != nil {
+		return false, err
+	}
+	if !os.SameFile(st, cur) {
+		return true, nil
+	}
+	pos, err := f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return false, err
+	}
+	return st.Size() < pos, nil
+}
@@ -0,0 +1,138 @@
+// watch 实时跟随插件的 JSON 事件流（plugin_opt_log_format json），按用户名/client id/主题/结果过滤后
+// 逐行美化输出，用于设备联调时交互式排查认证和 ACL 判定。
+//
+// 插件不把单条判定写进数据库，事件流就是判定的审计记录：plugin_opt_log_file 指定的文件用 -file 跟随
+// （支持轮转和截断），输出到 stderr 时通过管道传入，如 docker logs -f mosquitto 2>&1 | watch。
+// 非 JSON 行（mosquitto 自身日志）直接忽略。
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"golang.org/x/term"
+
+	"auth-plugin/pkg/topicmatch"
+)
+
+// printer 可能在读取 goroutine 与主 goroutine（退出时的汇总）间共享，用 mu 保护。
+type printer struct {
+	mu     sync.Mutex
+	f      filter
+	out    io.Writer
+	raw    bool
+	color  bool
+	counts map[string]int
+}
+
+func (p *printer) line(line []byte) {
+	r, ok := parseLine(line)
+	if !ok || !p.f.match(r) {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if r.Result != "" {
+		p.counts[r.Result]++
+	}
+	if p.raw {
+		fmt.Fprintln(p.out, strings.TrimSpace(string(line)))
+		return
+	}
+	format(p.out, r, p.color)
+}
+
+func (p *printer) summary(w io.Writer) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.counts) == 0 {
+		return
+	}
+	keys := make([]string, 0, len(p.counts))
+	for k := range p.counts {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := make([]string, len(keys))
+	for i, k := range keys {
+		parts[i] = fmt.Sprintf("%s=%d", k, p.counts[k])
+	}
+	fmt.Fprintln(w, "watch:", strings.Join(parts, " "))
+}
+
+func main() {
+	file := flag.String("file", "-", "event log to follow (plugin_opt_log_file); - reads stdin")
+	fromStart := flag.Bool("from-start", false, "with -file, print the existing lines first instead of only new ones")
+	events := flag.String("event", "auth,acl,disconnect", "comma-separated events to show (auth, acl, disconnect, log, config_change); empty shows all")
+	results := flag.String("result", "", "comma-separated results to show (allow, deny, error, fail_open, grace)")
+	var f filter
+	flag.StringVar(&f.username, "username", "", "only this username (wildcards like dev-* allowed)")
+	flag.StringVar(&f.clientID, "clientid", "", "only this client id (wildcards allowed)")
+	flag.StringVar(&f.topic, "topic", "", "only topics matching this MQTT filter, e.g. devices/+/telemetry")
+	flag.StringVar(&f.connID, "conn", "", "only this conn_id (one connection's session)")
+	raw := flag.Bool("json", false, "print matching events as the original JSON lines")
+	color := flag.String("color", "auto", "auto, always or never")
+	flag.Parse()
+
+	if f.topic != "" {
+		if err := topicmatch.ValidFilter(f.topic); err != nil {
+			fmt.Fprintln(os.Stderr, "watch: -topic:", err)
+			os.Exit(2)
+		}
+	}
+	f.events, f.results = splitSet(*events), splitSet(*results)
+	p := &printer{f: f, out: os.Stdout, raw: *raw, counts: map[string]int{}}
+	switch *color {
+	case "always":
+		p.color = true
+	case "auto":
+		p.color = term.IsTerminal(int(os.Stdout.Fd()))
+	case "never":
+	default:
+		fmt.Fprintln(os.Stderr, "watch: -color must be auto, always or never")
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	var err error
+	if *file == "-" {
+		err = readAll(ctx, os.Stdin, p.line)
+	} else {
+		err = follow(ctx, *file, *fromStart, 250*time.Millisecond, p.line)
+	}
+	p.summary(os.Stderr)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "watch:", err)
+		os.Exit(1)
+	}
+}
+
+// readAll 逐行读取管道，直到 EOF 或被中断。
+func readAll(ctx context.Context, r io.Reader, emit func([]byte)) error {
+	done := make(chan error, 1)
+	go func() {
+		sc := bufio.NewScanner(r)
+		sc.Buffer(make([]byte, 64*1024), 1024*1024)
+		for sc.Scan() {
+			emit(sc.Bytes())
+		}
+		done <- sc.Err()
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return nil
+	}
+}
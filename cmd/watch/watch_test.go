@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const (
+	denyLine  = `{"timestamp":"2026-01-02T03:04:05.5Z","level":"info","event":"acl","conn_id":"c1","username":"dev-1","clientid":"fw","topic":"devices/dev-1/cmd","result":"deny","backend":"pg","latency_ms":1.25}`
+	allowLine = `{"timestamp":"2026-01-02T03:04:06Z","level":"info","event":"auth","conn_id":"c2","username":"other","result":"allow","backend":"pg","latency_ms":0.5}`
+)
+
+func TestFilter(t *testing.T) {
+	t.Parallel()
+	deny, ok := parseLine([]byte(denyLine))
+	if !ok {
+		t.Fatal("parseLine failed")
+	}
+	if _, ok := parseLine([]byte("1700000000: New connection from 10.0.0.1")); ok {
+		t.Error("mosquitto text lines should be skipped")
+	}
+	cases := []struct {
+		f    filter
+		want bool
+	}{
+		{filter{}, true},
+		{filter{username: "dev-*"}, true},
+		{filter{username: "other"}, false},
+		{filter{topic: "devices/+/cmd"}, true},
+		{filter{topic: "devices/+/up"}, false},
+		{filter{results: splitSet("allow,error")}, false},
+		{filter{events: splitSet("acl"), results: splitSet("deny")}, true},
+		{filter{connID: "c2"}, false},
+	}
+	for _, tc := range cases {
+		if got := tc.f.match(deny); got != tc.want {
+			t.Errorf("%+v.match = %v, want %v", tc.f, got, tc.want)
+		}
+	}
+}
+
+func TestFormat(t *testing.T) {
+	t.Parallel()
+	r, _ := parseLine([]byte(denyLine))
+	r.Timestamp = "not a time"
+	var b bytes.Buffer
+	format(&b, r, false)
+	want := "not a time DENY      acl        dev-1/fw devices/dev-1/cmd 1.25ms via pg\n"
+	if b.String() != want {
+		t.Errorf("format = %q, want %q", b.String(), want)
+	}
+	b.Reset()
+	format(&b, r, true)
+	if !strings.Contains(b.String(), ansiRed) {
+		t.Errorf("deny should be red: %q", b.String())
+	}
+}
+
+func TestFollowRotation(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	path := filepath.Join(dir, "events.log")
+	if err := os.WriteFile(path, []byte("old\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	var mu sync.Mutex
+	var got []string
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- follow(ctx, path, false, 5*time.Millisecond, func(l []byte) {
+			mu.Lock()
+			got = append(got, strings.TrimSpace(string(l)))
+			mu.Unlock()
+		})
+	}()
+	waitFor := func(n int) {
+		t.Helper()
+		for i := 0; i < 400; i++ {
+			mu.Lock()
+			l := len(got)
+			mu.Unlock()
+			if l >= n {
+				return
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+		t.Fatalf("timed out waiting for %d lines, got %q", n, got)
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	appendTo(t, path, "a\npart")
+	appendTo(t, path, "ial\n")
+	waitFor(2)
+	// 轮转：旧文件改名，新文件出现在原路径
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatal(err)
+	}
+	appendTo(t, path, "b\n")
+	waitFor(3)
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(got, ",") != "a,partial,b" {
+		t.Errorf("lines = %q", got)
+	}
+}
+
+func appendTo(t *testing.T, path, s string) {
+	t.Helper()
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	f.WriteString(s)
+}
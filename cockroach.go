@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// pg_flavor cockroachdb：在（多区域）CockroachDB 集群上运行时的差异处理。
+//
+//   - CockroachDB 只有 SERIALIZABLE 隔离，争用时连单条语句也会返回 40001（restart transaction），
+//     这类错误按 crdb_max_retries 重试，间隔递增并带抖动，总耗时仍受 timeout_ms 限制；
+//   - crdb_follower_reads：认证、绑定与 ACL 查询加 AS OF SYSTEM TIME follower_read_timestamp()，
+//     由最近的副本应答，省去到 leaseholder 的跨区域往返；代价是读到约 5 秒前的数据，
+//     禁用账号或撤销规则要晚几秒生效；
+//   - self_test 的索引检查改用 information_schema.statistics（CockroachDB 的 pg_index 不支持 indkey 下标）。
+
+const (
+	flavorPostgres  = "postgres"
+	flavorCockroach = "cockroachdb"
+)
+
+var (
+	pgFlavor          = flavorPostgres
+	crdbMaxRetries    = 3
+	crdbFollowerReads bool
+
+	dbRetries atomic.Int64 // 因 40001 重试的次数
+)
+
+// 40001 serialization_failure；CockroachDB 的 "restart transaction" 错误都用这个代码。
+const sqlStateSerializationFailure = "40001"
+
+const crdbRetryBase = 20 * time.Millisecond
+
+func parsePGFlavor(v string) (string, bool) {
+	switch strings.ToLower(strings.TrimSpace(v)) {
+	case flavorPostgres, "postgresql", "pg":
+		return flavorPostgres, true
+	case flavorCockroach, "cockroach", "crdb":
+		return flavorCockroach, true
+	}
+	return "", false
+}
+
+func isSerializationFailure(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == sqlStateSerializationFailure
+}
+
+// withRetry 执行 fn，cockroachdb 下遇到 40001 时重试；fn 必须可以安全重复执行。
+func withRetry(ctx context.Context, fn func() error) error {
+	err := fn()
+	if pgFlavor != flavorCockroach {
+		return err
+	}
+	for attempt := 1; attempt <= crdbMaxRetries && isSerializationFailure(err); attempt++ {
+		dbRetries.Add(1)
+		delay := time.Duration(attempt)*crdbRetryBase + rand.N(crdbRetryBase)
+		t := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return err
+		case <-t.C:
+		}
+		err = fn()
+	}
+	return err
+}
+
+// asOfFollower 在 FROM 表名之后加上 follower read 子句。
+func asOfFollower(query, table string) string {
+	return strings.Replace(query, "FROM "+table+" ", "FROM "+table+" AS OF SYSTEM TIME follower_read_timestamp() ", 1)
+}
+
+var (
+	crdbAuthQuery = asOfFollower(authQuery, "iot_devices")
+	crdbBindQuery = asOfFollower(bindQuery, "client_bindings")
+	crdbACLQuery  = asOfFollower(aclQuery, "acls")
+)
+
+// pgQueries 返回认证、绑定与 ACL 查询；shard_column 设置时带分布列条件，
+// crdb_follower_reads 开启时使用 follower read 版本。
+func pgQueries() (auth, bind, acl string) {
+	follower := pgFlavor == flavorCockroach && crdbFollowerReads
+	switch {
+	case shardColumn != "" && follower:
+		return crdbShardQ.auth, crdbShardQ.bind, crdbShardQ.acl
+	case shardColumn != "":
+		return shardQ.auth, shardQ.bind, shardQ.acl
+	case follower:
+		return crdbAuthQuery, crdbBindQuery, crdbACLQuery
+	}
+	return authQuery, bindQuery, aclQuery
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+func TestWithRetry(t *testing.T) {
+	oldFlavor, oldMax := pgFlavor, crdbMaxRetries
+	t.Cleanup(func() { pgFlavor, crdbMaxRetries = oldFlavor, oldMax })
+
+	restart := fmt.Errorf("query: %w", &pgconn.PgError{Code: "40001", Message: "restart transaction"})
+	failing := func(n int, err error) (func() error, *int) {
+		calls := 0
+		return func() error {
+			calls++
+			if calls <= n {
+				return err
+			}
+			return nil
+		}, &calls
+	}
+	ctx := context.Background()
+
+	pgFlavor = flavorPostgres
+	fn, calls := failing(1, restart)
+	if err := withRetry(ctx, fn); err == nil || *calls != 1 {
+		t.Errorf("postgres: err = %v after %d call(s), want no retry", err, *calls)
+	}
+
+	pgFlavor, crdbMaxRetries = flavorCockroach, 3
+	before := dbRetries.Load()
+	fn, calls = failing(2, restart)
+	if err := withRetry(ctx, fn); err != nil || *calls != 3 {
+		t.Errorf("cockroachdb: err = %v after %d call(s), want success on the third", err, *calls)
+	}
+	if got := dbRetries.Load() - before; got != 2 {
+		t.Errorf("dbRetries grew by %d, want 2", got)
+	}
+	fn, calls = failing(10, restart)
+	if err := withRetry(ctx, fn); !isSerializationFailure(err) || *calls != 4 {
+		t.Errorf("cockroachdb: err = %v after %d call(s), want the 40001 error after 4", err, *calls)
+	}
+	other := errors.New("connection refused")
+	fn, calls = failing(1, other)
+	if err := withRetry(ctx, fn); err != other || *calls != 1 {
+		t.Errorf("other errors: err = %v after %d call(s), want no retry", err, *calls)
+	}
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	fn, calls = failing(10, restart)
+	if err := withRetry(cancelled, fn); err == nil || *calls != 1 {
+		t.Errorf("cancelled: err = %v after %d call(s), want to stop after the first", err, *calls)
+	}
+}
+
+func TestFollowerReadQueries(t *testing.T) {
+	oldFlavor, oldFollower := pgFlavor, crdbFollowerReads
+	t.Cleanup(func() { pgFlavor, crdbFollowerReads = oldFlavor, oldFollower })
+
+	pgFlavor, crdbFollowerReads = flavorCockroach, true
+	auth, bind, acl := pgQueries()
+	for _, q := range []string{auth, bind, acl} {
+		if !strings.Contains(q, " AS OF SYSTEM TIME follower_read_timestamp() WHERE ") {
+			t.Errorf("query %q has no follower read clause before WHERE", q)
+		}
+	}
+	pgFlavor = flavorPostgres
+	if auth, _, _ := pgQueries(); auth != authQuery {
+		t.Errorf("postgres auth query = %q", auth)
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"sort"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// 配置变更审计：setConfig、setDSN、Secret 文件轮换与 SIGHUP 重载引起的选项变化，逐项输出
+// before/after 记录到 mosquitto 日志与 JSON 事件流；config_audit_table=true 时同时写入
+// mosq_pg_config_audit。值按 getStatus 的规则遮蔽（密码、token 等只显示 xxxxx）。
+
+const configAuditInsert = `INSERT INTO mosq_pg_config_audit (instance, source, actor, key, old_value, new_value)
+VALUES ($1, $2, $3, $4, $5, $6)`
+
+var configAuditTable bool
+
+type configChange struct {
+	Source string `json:"source"` // setConfig / setDSN / secret_file / reload
+	Actor  string `json:"actor,omitempty"`
+	Key    string `json:"key"`
+	Old    string `json:"old"`
+	New    string `json:"new"`
+}
+
+// diffOptions 返回 before 与 after 中值不同的键（按键排序），值已遮蔽。
+func diffOptions(source, actor string, before, after map[string]string) []configChange {
+	var changes []configChange
+	for k, v := range after {
+		if old, ok := before[k]; ok && old == v {
+			continue
+		}
+		changes = append(changes, configChange{
+			Source: source, Actor: actor, Key: k,
+			Old: redactOptionValue(k, before[k]), New: redactOptionValue(k, v),
+		})
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Key < changes[j].Key })
+	return changes
+}
+
+// auditConfigChange 记录一组选项变化；没有变化时不输出。
+func auditConfigChange(source, actor string, before, after map[string]string) {
+	changes := diffOptions(source, actor, before, after)
+	for i := range changes {
+		c := changes[i]
+		mosqLog(logNotice, "auth-plugin: config change via %s by %s: %s %q -> %q", c.Source, c.Actor, c.Key, c.Old, c.New)
+		if logFormat == logFormatJSON {
+			writeEvent(logRecord{Level: "notice", Event: "config_change", Change: &c})
+		}
+	}
+	if configAuditTable && featureFlags.on(flagConfigAudit) && len(changes) > 0 {
+		if err := writeConfigAudit(changes); err != nil {
+			mosqLogDeduped(logWarning, "auth-plugin: cannot write mosq_pg_config_audit: %v%s", err, partitionHint(err))
+		}
+	}
+}
+
+func writeConfigAudit(changes []configChange) error {
+	if databaseDown() {
+		return errDatabaseDown
+	}
+	ctx, cancel := ctxWithTimeout(context.Background(), primary.timeout.get())
+	defer cancel()
+	p, err := primary.ensurePool(ctx)
+	if err != nil {
+		return err
+	}
+	// 一组变化在一个 batch 中写入，只有一次往返；分区表下同一时刻的行落在同一分区
+	instance := statsInstance()
+	batch := &pgx.Batch{}
+	for _, c := range changes {
+		batch.Queue(configAuditInsert, instance, c.Source, c.Actor, c.Key, c.Old, c.New)
+	}
+	return withRetry(ctx, func() error {
+		return p.SendBatch(ctx, batch).Close()
+	})
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// 连接标识：为每个池连接设置 application_name（可含 broker 主机名）和可选的会话参数，
+// 便于 DBA 在 pg_stat_activity / pg_stat_statements 中区分本插件带来的负载。
+
+const defaultAppName = "mosq-pg@{hostname}"
+
+// maxAppNameLen 服务端会把 application_name 截断到 NAMEDATALEN-1 字节。
+const maxAppNameLen = 63
+
+// expandAppName 替换 {hostname} 占位符并截断到服务端上限。
+func expandAppName(name string) string {
+	if strings.Contains(name, "{hostname}") {
+		host, err := os.Hostname()
+		if err != nil || host == "" {
+			host = "unknown"
+		}
+		name = strings.ReplaceAll(name, "{hostname}", host)
+	}
+	if len(name) > maxAppNameLen {
+		name = name[:maxAppNameLen]
+	}
+	return name
+}
+
+// parseSessionParams 解析 "statement_timeout=2s,lock_timeout=500ms"。
+func parseSessionParams(v string) (map[string]string, error) {
+	params := map[string]string{}
+	for _, kv := range strings.Split(v, ",") {
+		if kv = strings.TrimSpace(kv); kv == "" {
+			continue
+		}
+		k, val, ok := strings.Cut(kv, "=")
+		k = strings.TrimSpace(k)
+		if !ok || k == "" {
+			return nil, fmt.Errorf("want name=value pairs, got %q", kv)
+		}
+		switch strings.ToLower(k) {
+		case "search_path", "application_name":
+			return nil, fmt.Errorf("%s has its own option", k)
+		}
+		params[k] = strings.TrimSpace(val)
+	}
+	return params, nil
+}
+
+// applyConnLabels 写入连接启动参数；DSN 中已显式给出的 application_name 优先于默认值。
+func (in *instance) applyConnLabels(rp map[string]string) {
+	for k, v := range in.pgSessionParams {
+		rp[k] = v
+	}
+	if in.pgAppName == "" {
+		return
+	}
+	if _, ok := rp["application_name"]; ok && in.pgAppName == defaultAppName {
+		return
+	}
+	rp["application_name"] = expandAppName(in.pgAppName)
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"os"
+	"testing"
+)
+
+func TestParseSessionParams(t *testing.T) {
+	t.Parallel()
+	got, err := parseSessionParams(" statement_timeout=2s , lock_timeout=500ms,")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got["statement_timeout"] != "2s" || got["lock_timeout"] != "500ms" {
+		t.Fatalf("parseSessionParams = %v", got)
+	}
+	for _, v := range []string{"statement_timeout", "=1", "search_path=iot", "Application_Name=x"} {
+		if _, err := parseSessionParams(v); err == nil {
+			t.Fatalf("parseSessionParams(%q) should fail", v)
+		}
+	}
+}
+
+func TestApplyConnLabels(t *testing.T) {
+	oldName, oldParams := primary.pgAppName, primary.pgSessionParams
+	t.Cleanup(func() { primary.pgAppName, primary.pgSessionParams = oldName, oldParams })
+	host, _ := os.Hostname()
+
+	primary.pgAppName, primary.pgSessionParams = defaultAppName, map[string]string{"statement_timeout": "2s"}
+	rp := map[string]string{}
+	primary.applyConnLabels(rp)
+	if rp["application_name"] != expandAppName("mosq-pg@"+host) || rp["statement_timeout"] != "2s" {
+		t.Fatalf("applyConnLabels = %v", rp)
+	}
+
+	rp = map[string]string{"application_name": "from-dsn"}
+	primary.applyConnLabels(rp)
+	if rp["application_name"] != "from-dsn" {
+		t.Fatalf("DSN application_name should win over the default, got %q", rp["application_name"])
+	}
+
+	primary.pgAppName = "broker-a"
+	primary.applyConnLabels(rp)
+	if rp["application_name"] != "broker-a" {
+		t.Fatalf("explicit application_name should win, got %q", rp["application_name"])
+	}
+}
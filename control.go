@@ -0,0 +1,376 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"auth-plugin/pkg/mosqplugin"
+)
+
+// $CONTROL/mosq-pg/v1：运行时查询与调整选项，消息格式与 dynamic-security 插件一致：
+//   请求 {"commands":[{"command":"getConfig"},{"command":"setConfig","options":{"fail_open_acl":true}}]}
+//   响应发布到 $CONTROL/mosq-pg/v1/response，{"responses":[{"command":"...","data":{...}|"error":"..."}]}
+//   setDSN {"command":"setDSN","dsn":"postgres://..."} 先用新 DSN 建池并 Ping，成功后原子替换连接池，
+//   旧池在后台排空关闭；用于不停机迁移数据库端点。建池在后台进行，不阻塞 broker 主线程，
+//   切换与整条请求的响应在随后的 TICK 回调中完成；同一时间只能有一个 setDSN。
+//   getAuthFailures 返回认证失败最多的用户名与来源地址（top-K，见 topk.go）。
+//   getStats 返回插件统计（与 $SYS/mosq-pg/# 相同的计数器，见 stats.go）。
+//   getStatus 返回数据库健康、连接池、缓存、选项（密钥遮蔽）、运行时长与计数器的整体快照（见 status.go）。
+//   getLatency 返回认证/ACL 耗时直方图与最近一个窗口的 p50/p99（见 latency.go）。
+//   flushCache 删除 Redis 缓存中一个用户（"options":{"username":...}）或全部用户的条目（见 redis.go）。
+// 只有 control_users 中列出的用户名可以下发命令。
+
+const (
+	controlTopic         = "$CONTROL/mosq-pg/v1"
+	controlResponseTopic = controlTopic + "/response"
+)
+
+// dsnRotateTimeout 建立并验证新连接池的时限。
+const dsnRotateTimeout = 10 * time.Second
+
+var (
+	controlUsers = map[string]bool{}
+
+	dsnRotating atomic.Bool                  // 有 setDSN 正在建池或等待切换
+	dsnRotated  = make(chan *dsnRotation, 1) // 建池已结束（成功或失败），等待 TICK 回调处理
+
+	// replyControl 把响应发给发送命令的客户端，测试中替换
+	replyControl = func(clientID string, raw []byte) {
+		publishToClient(clientID, controlResponseTopic, raw)
+	}
+)
+
+// tunableOptions 可在运行时修改的选项及其当前值（与 plugin_opt_* 同名）。
+var tunableOptions = map[string]func() string{
+	"fail_open_auth":        func() string { return strconv.FormatBool(primary.failOpenAuth) },
+	"fail_open_acl":         func() string { return strconv.FormatBool(primary.failOpenACL) },
+	"enforce_bind":          func() string { return strconv.FormatBool(primary.enforceBind) },
+	"auth_grace_minutes":    func() string { return strconv.Itoa(int(authGrace / time.Minute)) },
+	"weak_hash_policy":      func() string { return weakHashPolicy },
+	"log_level":             func() string { return logLevelNames[logLevel.Load()] },
+	"log_sample_auth_allow": func() string { return strconv.Itoa(authAllowSampler.every) },
+	"log_sample_acl_allow":  func() string { return strconv.Itoa(aclAllowSampler.every) },
+	"timeout_ms":            func() string { return strconv.Itoa(int(primary.timeout.get() / time.Millisecond)) },
+	"redis_cache_ttl":       func() string { return strconv.Itoa(int(redisCacheTTL.get() / time.Second)) },
+}
+
+func parseControlUsers(v string) map[string]bool {
+	users := map[string]bool{}
+	for _, u := range strings.Split(v, ",") {
+		if u = strings.TrimSpace(u); u != "" {
+			users[u] = true
+		}
+	}
+	return users
+}
+
+// effectiveConfig 返回可调选项与监听端口覆盖项的当前值。
+func effectiveConfig() map[string]string {
+	cfg := make(map[string]string, len(tunableOptions))
+	for k, get := range tunableOptions {
+		cfg[k] = get()
+	}
+	for port, opts := range copyListenerOverrides() {
+		for opt, v := range opts {
+			cfg[fmt.Sprintf("%s%d.%s", listenerOptionPrefix, port, opt)] = v
+		}
+	}
+	return cfg
+}
+
+func isTunable(k string) bool {
+	if strings.HasPrefix(k, listenerOptionPrefix) {
+		_, opt, err := parseListenerOption(k)
+		return err == nil && policyOverrides[opt] != nil
+	}
+	return tunableOptions[k] != nil
+}
+
+// setRuntimeOptions 原子地应用一组选项：任一项失败则全部回滚。
+func setRuntimeOptions(opts map[string]string) error {
+	keys := make([]string, 0, len(opts))
+	for k := range opts {
+		if !isTunable(k) {
+			return fmt.Errorf("option %s cannot be changed at runtime", k)
+		}
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	before := effectiveConfig()
+	savedOverrides := copyListenerOverrides()
+	rollback := func() {
+		for k, get := range tunableOptions {
+			if get() != before[k] {
+				applyOption(primary, k, before[k])
+			}
+		}
+		optionsMu.Lock()
+		listenerOverrides = savedOverrides
+		optionsMu.Unlock()
+	}
+
+	for _, k := range keys {
+		if err := applyOption(primary, k, opts[k]); err != nil {
+			rollback()
+			return err
+		}
+	}
+	if primary.timeout.get() > maxTimeout {
+		rollback()
+		return fmt.Errorf("timeout_ms exceeds %dms", int(maxTimeout/time.Millisecond))
+	}
+	if redisCacheTTL.get() > 0 {
+		if err := checkRedisURL(); err != nil {
+			rollback()
+			return err
+		}
+	}
+	return nil
+}
+
+type controlCommand struct {
+	Command string                     `json:"command"`
+	Options map[string]json.RawMessage `json:"options,omitempty"`
+	DSN     string                     `json:"dsn,omitempty"`
+}
+
+// dsnRotation 是一次进行中的 setDSN：新池在后台建立，responses 是所在请求的全部响应，
+// 其中 responses[idx] 由 finishDSNRotation 填入 setDSN 的结果。
+type dsnRotation struct {
+	username  string
+	clientID  string
+	dsn       string
+	cfg       *pgxpool.Config
+	responses []controlResponse
+	idx       int
+
+	pool *pgxpool.Pool
+	err  error
+}
+
+// startDSNRotation 同步完成不需要网络的检查；通过后占用 dsnRotating，由调用方在后台建池。
+func startDSNRotation(dsn string) (*dsnRotation, error) {
+	dsn = strings.TrimSpace(dsn)
+	if dsn == "" {
+		return nil, errors.New("dsn is required")
+	}
+	if !usesBackend(driverPostgres) {
+		return nil, errors.New("setDSN rotates the PostgreSQL pool and is not available with " + backendNames())
+	}
+	if pgDSNFile != "" {
+		return nil, errors.New("pg_dsn is managed by pg_dsn_file; update the file instead")
+	}
+	_, password := pgCredentials()
+	cfg, err := primary.poolConfigFor(dsn, password)
+	if err != nil {
+		return nil, fmt.Errorf("invalid dsn: %w", err)
+	}
+	if !dsnRotating.CompareAndSwap(false, true) {
+		return nil, errors.New("another setDSN is in progress")
+	}
+	return &dsnRotation{dsn: dsn, cfg: cfg}, nil
+}
+
+// open 在后台建立并 Ping 新连接池，结果交给 TICK 回调。
+func (r *dsnRotation) open() {
+	ctx, cancel := context.WithTimeout(context.Background(), dsnRotateTimeout)
+	defer cancel()
+	r.pool, r.err = openPool(ctx, r.cfg)
+	dsnRotated <- r
+}
+
+// finishDSNRotation 在 TICK 回调（broker 主线程）中切换已建好的连接池并回复整条请求；
+// 建池失败时保持原连接池不变。
+func finishDSNRotation() {
+	var r *dsnRotation
+	select {
+	case r = <-dsnRotated:
+	default:
+		return
+	}
+	defer dsnRotating.Store(false)
+	resp := &r.responses[r.idx]
+	if r.err != nil {
+		resp.Error = fmt.Sprintf("new dsn not usable: %v", r.err)
+	} else {
+		old, _ := pgCredentials()
+		credMu.Lock()
+		primary.pgDSN = r.dsn
+		credMu.Unlock()
+		primary.swapPool(r.pool)
+		auditConfigChange("setDSN", r.username, map[string]string{"pg_dsn": old}, map[string]string{"pg_dsn": r.dsn})
+		mosqLog(logInfo, "auth-plugin: pool swapped after setDSN, old pool draining")
+		resp.Data = map[string]string{"pg_dsn": safeDSN(r.dsn)}
+	}
+	raw, _ := json.Marshal(controlReply{Responses: r.responses})
+	replyControl(r.clientID, raw)
+}
+
+// stopDSNRotation 等待进行中的 setDSN 建池结束（最长 dsnRotateTimeout），关闭没有换上的新连接池。
+func stopDSNRotation() {
+	if !dsnRotating.Load() {
+		return
+	}
+	if r := <-dsnRotated; r.pool != nil {
+		r.pool.Close()
+	}
+	dsnRotating.Store(false)
+}
+
+type controlResponse struct {
+	Command string `json:"command"`
+	Data    any    `json:"data,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+type controlReply struct {
+	Responses []controlResponse `json:"responses"`
+}
+
+// optionValue 接受 JSON 字符串、布尔或数字形式的选项值。
+func optionValue(raw json.RawMessage) string {
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return s
+	}
+	return strings.TrimSpace(string(raw))
+}
+
+func handleControlCommand(username string, cmd controlCommand) controlResponse {
+	resp := controlResponse{Command: cmd.Command}
+	switch cmd.Command {
+	case "getConfig":
+		resp.Data = effectiveConfig()
+	case "getStats":
+		resp.Data = statsMap()
+	case "getStatus":
+		resp.Data = pluginStatus()
+	case "dumpConfig":
+		resp.Data = dumpConfig()
+	case "getLatency":
+		resp.Data = map[string]any{"auth": authLatency.snapshot(), "acl": aclLatency.snapshot()}
+	case "getAuthFailures":
+		// 可选 "count" 限制返回条数，"reset":true 在读取后清零
+		n := 10
+		if raw, ok := cmd.Options["count"]; ok {
+			if v, err := strconv.Atoi(optionValue(raw)); err == nil && v > 0 {
+				n = v
+			}
+		}
+		resp.Data = map[string][]topKEntry{
+			"usernames": failuresByUser.top(n),
+			"addresses": failuresByAddr.top(n),
+		}
+		if raw, ok := cmd.Options["reset"]; ok {
+			if reset, _ := parseBoolOption(optionValue(raw)); reset {
+				failuresByUser.reset()
+				failuresByAddr.reset()
+			}
+		}
+	case "flushCache":
+		// 可选 "username" 只清该用户；否则清空全部（修改了 '*' 全局规则时需要）
+		target := ""
+		if raw, ok := cmd.Options["username"]; ok {
+			target = optionValue(raw)
+		}
+		ctx, cancel := ctxTimeout()
+		n, err := flushCache(ctx, target)
+		cancel()
+		if err != nil {
+			resp.Error = err.Error()
+			return resp
+		}
+		scope := "all users"
+		if target != "" {
+			scope = redactID(target)
+		}
+		mosqLog(logInfo, "auth-plugin: flushCache by %s removed %d cache key(s) for %s", username, n, scope)
+		resp.Data = map[string]int64{"deleted": n}
+	case "setConfig":
+		opts := make(map[string]string, len(cmd.Options))
+		for k, raw := range cmd.Options {
+			opts[k] = optionValue(raw)
+		}
+		before := effectiveConfig()
+		if err := setRuntimeOptions(opts); err != nil {
+			resp.Error = err.Error()
+			return resp
+		}
+		after := effectiveConfig()
+		auditConfigChange("setConfig", username, before, after)
+		resp.Data = after
+	default:
+		resp.Error = "unknown command"
+	}
+	return resp
+}
+
+// handleControlPayload 解析一条 $CONTROL 消息并返回响应 JSON；
+// 含 setDSN 时返回 nil，响应在新连接池建好后由 finishDSNRotation 发出。
+func handleControlPayload(username, clientID string, payload []byte) []byte {
+	var req struct {
+		Commands []controlCommand `json:"commands"`
+	}
+	var out controlReply
+	if err := json.Unmarshal(payload, &req); err != nil {
+		out.Responses = append(out.Responses, controlResponse{Error: "invalid JSON: " + err.Error()})
+	}
+	var rotation *dsnRotation
+	for _, cmd := range req.Commands {
+		if cmd.Command != "setDSN" {
+			out.Responses = append(out.Responses, handleControlCommand(username, cmd))
+			continue
+		}
+		resp := controlResponse{Command: cmd.Command}
+		if r, err := startDSNRotation(cmd.DSN); err != nil {
+			resp.Error = err.Error()
+		} else {
+			r.idx, rotation = len(out.Responses), r
+		}
+		out.Responses = append(out.Responses, resp)
+	}
+	if rotation != nil {
+		rotation.username, rotation.clientID, rotation.responses = username, clientID, out.Responses
+		go rotation.open()
+		return nil
+	}
+	raw, _ := json.Marshal(out)
+	return raw
+}
+
+// registerControl 在配置了 control_users 时接管 $CONTROL/mosq-pg/v1。
+func registerControl(h *mosqplugin.Handle) error {
+	if len(controlUsers) == 0 {
+		return nil
+	}
+	return h.OnControl(controlTopic, controlMessage)
+}
+
+// publishToClient 向单个客户端发布消息（broker 复制 payload）。
+func publishToClient(clientID, topic string, payload []byte) {
+	mosqplugin.Publish(clientID, topic, payload, false)
+}
+
+// controlMessage 是 CONTROL 回调：只接受 control_users 中的用户，回复发给发送者。
+func controlMessage(c mosqplugin.Client, payload []byte) mosqplugin.Result {
+	username, clientID := c.Username(), c.ID()
+	if !controlUsers[username] {
+		mosqLog(logWarning, "auth-plugin: rejected $CONTROL command from user %q (client %s)",
+			redactID(username), redactID(clientID))
+		return mosqplugin.ACLDenied
+	}
+	if raw := handleControlPayload(username, clientID, payload); raw != nil {
+		replyControl(clientID, raw)
+	}
+	return mosqplugin.Success
+}
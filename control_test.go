@@ -0,0 +1,157 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHandleControlPayload(t *testing.T) {
+	oldFailOpen, oldTimeout, oldOverrides := primary.failOpenACL, primary.timeout.get(), listenerOverrides
+	t.Cleanup(func() {
+		primary.failOpenACL, listenerOverrides = oldFailOpen, oldOverrides
+		primary.timeout.set(oldTimeout)
+	})
+	primary.failOpenACL, listenerOverrides = false, map[int]map[string]string{}
+	primary.timeout.set(1500 * time.Millisecond)
+
+	var resp struct {
+		Responses []struct {
+			Command string            `json:"command"`
+			Data    map[string]string `json:"data"`
+			Error   string            `json:"error"`
+		} `json:"responses"`
+	}
+	decode := func(raw []byte) {
+		t.Helper()
+		resp.Responses = nil
+		if err := json.Unmarshal(raw, &resp); err != nil {
+			t.Fatalf("invalid response %s: %v", raw, err)
+		}
+	}
+
+	decode(handleControlPayload("admin", "ops-1", []byte(`{"commands":[
+		{"command":"setConfig","options":{"fail_open_acl":true,"timeout_ms":800,"listener_8883.fail_open_acl":"false"}},
+		{"command":"getConfig"}]}`)))
+	if len(resp.Responses) != 2 || resp.Responses[0].Error != "" {
+		t.Fatalf("unexpected responses %+v", resp.Responses)
+	}
+	if !primary.failOpenACL || primary.timeout.get() != 800*time.Millisecond {
+		t.Fatalf("setConfig not applied: fail_open_acl=%v timeout=%v", primary.failOpenACL, primary.timeout.get())
+	}
+	if got := resp.Responses[1].Data["listener_8883.fail_open_acl"]; got != "false" {
+		t.Fatalf("getConfig listener override = %q", got)
+	}
+
+	// 任一项非法时整体回滚
+	decode(handleControlPayload("admin", "ops-1", []byte(`{"commands":[
+		{"command":"setConfig","options":{"fail_open_acl":false,"timeout_ms":"abc"}}]}`)))
+	if resp.Responses[0].Error == "" || !primary.failOpenACL || primary.timeout.get() != 800*time.Millisecond {
+		t.Fatalf("failed setConfig must roll back: %+v fail_open_acl=%v timeout=%v", resp.Responses[0], primary.failOpenACL, primary.timeout.get())
+	}
+
+	decode(handleControlPayload("admin", "ops-1", []byte(`{"commands":[{"command":"setConfig","options":{"pg_dsn":"x"}}]}`)))
+	if resp.Responses[0].Error == "" {
+		t.Fatal("non-tunable options must be rejected")
+	}
+
+	decode(handleControlPayload("admin", "ops-1", []byte(`not json`)))
+	if len(resp.Responses) != 1 || resp.Responses[0].Error == "" {
+		t.Fatalf("invalid JSON should produce an error response, got %+v", resp.Responses)
+	}
+}
+
+func TestStartDSNRotationRejects(t *testing.T) {
+	oldDSN, oldFile := primary.pgDSN, pgDSNFile
+	t.Cleanup(func() { primary.pgDSN, pgDSNFile = oldDSN, oldFile })
+	primary.pgDSN, pgDSNFile = "postgres://u:p@db1/iot", ""
+
+	for _, dsn := range []string{"", "  ", "postgres://u:p@db2:notaport/iot"} {
+		if _, err := startDSNRotation(dsn); err == nil {
+			t.Fatalf("startDSNRotation(%q) should fail", dsn)
+		}
+	}
+	pgDSNFile = "/run/secrets/pg_dsn"
+	if _, err := startDSNRotation("postgres://u:p@db2/iot"); err == nil {
+		t.Fatal("setDSN must refuse while pg_dsn_file manages the DSN")
+	}
+	if dsnRotating.Load() {
+		t.Fatal("a rejected setDSN must not hold the rotation slot")
+	}
+}
+
+func TestSetDSNRepliesFromTick(t *testing.T) {
+	oldDSN, oldReply := primary.pgDSN, replyControl
+	t.Cleanup(func() { primary.pgDSN, replyControl = oldDSN, oldReply })
+	primary.pgDSN = "postgres://u:p@db1/iot"
+	var replies [][]byte
+	replyControl = func(clientID string, raw []byte) {
+		if clientID != "ops-1" {
+			t.Errorf("reply sent to %q", clientID)
+		}
+		replies = append(replies, raw)
+	}
+
+	// 端口 1 上没有 PostgreSQL，建池失败；回调本身立即返回，不等待建池
+	if raw := handleControlPayload("admin", "ops-1", []byte(`{"commands":[
+		{"command":"setDSN","dsn":"postgres://u:p@127.0.0.1:1/iot?connect_timeout=2"},
+		{"command":"setDSN","dsn":"postgres://u:p@127.0.0.1:2/iot"},
+		{"command":"getConfig"}]}`)); raw != nil {
+		t.Fatalf("a request with setDSN must be answered from TICK, got %s", raw)
+	}
+	deadline := time.Now().Add(dsnRotateTimeout + time.Second)
+	for len(replies) == 0 && time.Now().Before(deadline) {
+		finishDSNRotation()
+		time.Sleep(10 * time.Millisecond)
+	}
+	if len(replies) != 1 {
+		t.Fatalf("got %d replies, want one after the rotation finished", len(replies))
+	}
+	var resp controlReply
+	if err := json.Unmarshal(replies[0], &resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Responses) != 3 || !strings.HasPrefix(resp.Responses[0].Error, "new dsn not usable") ||
+		!strings.Contains(resp.Responses[1].Error, "in progress") || resp.Responses[2].Error != "" {
+		t.Fatalf("unexpected responses %+v", resp.Responses)
+	}
+	if primary.pgDSN != "postgres://u:p@db1/iot" || dsnRotating.Load() {
+		t.Fatalf("failed rotation changed pg_dsn to %q or kept the slot", primary.pgDSN)
+	}
+}
+
+func TestSetRuntimeCacheTTL(t *testing.T) {
+	oldTTL, oldURL, oldTimeout, oldLevel := redisCacheTTL.get(), redisURL, primary.timeout.get(), logLevel.Load()
+	t.Cleanup(func() {
+		redisCacheTTL.set(oldTTL)
+		primary.timeout.set(oldTimeout)
+		logLevel.Store(oldLevel)
+		redisURL = oldURL
+	})
+	redisCacheTTL.set(0)
+	redisURL = ""
+	if err := setRuntimeOptions(map[string]string{"redis_cache_ttl": "30"}); err == nil || redisCacheTTL.get() != 0 {
+		t.Fatalf("setRuntimeOptions = %v, ttl=%s; want redis_url error and rollback", err, redisCacheTTL.get())
+	}
+
+	// 管理 API 与 getStatus 在其他协程读取可调选项（go test -race 可检测）
+	redisURL = "redis://cache:6379/0"
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			effectiveConfig()
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		opts := map[string]string{"redis_cache_ttl": "30", "timeout_ms": "900", "log_level": "debug"}
+		if err := setRuntimeOptions(opts); err != nil {
+			t.Fatal(err)
+		}
+	}
+	<-done
+	if cfg := effectiveConfig(); cfg["redis_cache_ttl"] != "30" || cfg["timeout_ms"] != "900" || cfg["log_level"] != "debug" {
+		t.Fatalf("effectiveConfig = %v", cfg)
+	}
+}
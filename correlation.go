@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+
+	"auth-plugin/pkg/mosqplugin"
+)
+
+// 连接关联 ID：basic_auth 时为每个连接生成 conn_id，之后该连接的 ACL 判定、日志、
+// JSON/Kafka 事件与 trace 都带上它，DISCONNECT 时输出一条 disconnect 事件并释放。
+// 以 struct mosquitto 指针为键：同一 client id 被新连接接管时，旧连接的断开不会误删新连接的 ID。
+
+type connInfo struct {
+	id    string
+	since time.Time
+}
+
+type connRegistry struct {
+	mu    sync.Mutex
+	conns map[uintptr]connInfo
+	// untracked：broker 没有 DISCONNECT 事件（插件 API v4），记录永远不会释放，
+	// 连接对象被复用后还会把旧 ID 交给新连接，因此不分配 ID
+	untracked bool
+}
+
+var connIDs = &connRegistry{conns: map[uintptr]connInfo{}}
+
+func newConnID() string {
+	var b [8]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// assign 为连接生成新 ID（重复认证时替换旧值）；untracked 时返回空串。
+func (r *connRegistry) assign(key uintptr) string {
+	id := newConnID()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.untracked {
+		return ""
+	}
+	r.conns[key] = connInfo{id: id, since: time.Now()}
+	return id
+}
+
+// untrack 在没有 DISCONNECT 事件时调用，之后不再分配 ID。
+func (r *connRegistry) untrack() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.untracked = true
+	clear(r.conns)
+}
+
+// get 返回连接的 ID；未经本插件认证的连接（如 disable_basic_auth）在首次 ACL 检查时补发。
+func (r *connRegistry) get(key uintptr) string {
+	r.mu.Lock()
+	info, ok := r.conns[key]
+	r.mu.Unlock()
+	if ok {
+		return info.id
+	}
+	return r.assign(key)
+}
+
+func (r *connRegistry) remove(key uintptr) (connInfo, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	info, ok := r.conns[key]
+	delete(r.conns, key)
+	return info, ok
+}
+
+func (r *connRegistry) size() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.conns)
+}
+
+type connIDKey struct{}
+
+func withConnID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, connIDKey{}, id)
+}
+
+func connIDFrom(ctx context.Context) string {
+	id, _ := ctx.Value(connIDKey{}).(string)
+	return id
+}
+
+// logDisconnect 输出连接结束事件，与判定事件使用相同的输出目标。
+func logDisconnect(connID, username, clientID string, session time.Duration, reason int) {
+	if logFormat != logFormatJSON && logLevel.Load() < logLevelDebug && kafkaClient == nil {
+		return
+	}
+	username, clientID = redactID(username), redactID(clientID)
+	msg := fmt.Sprintf("session %s, reason %d", session.Round(time.Second), reason)
+	if logLevel.Load() >= logLevelDebug {
+		mosqLog(logDebug, "auth-plugin: disconnect conn=%s user=%q client=%q %s", connID, username, clientID, msg)
+	}
+	rec := logRecord{Level: "info", Event: "disconnect", ConnID: connID, Username: username, ClientID: clientID, Message: msg}
+	publishDecision(rec)
+	if logFormat == logFormatJSON {
+		writeEvent(rec)
+	}
+}
+
+// clientDisconnected 是 DISCONNECT 回调：清理按连接记录的状态并记录会话时长。
+func clientDisconnected(c mosqplugin.Client, reason int) {
+	certGates.forget(c.Key())
+	bootstrapDone.release(c.Key())
+	info, ok := connIDs.remove(c.Key())
+	if !ok {
+		return
+	}
+	logDisconnect(info.id, c.Username(), c.ID(), time.Since(info.since), reason)
+}
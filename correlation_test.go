@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+func TestConnRegistry(t *testing.T) {
+	t.Parallel()
+	r := &connRegistry{conns: map[uintptr]connInfo{}}
+
+	id := r.assign(1)
+	if len(id) != 16 {
+		t.Fatalf("conn id %q, want 16 hex chars", id)
+	}
+	if got := r.get(1); got != id {
+		t.Fatalf("get = %q, want %q", got, id)
+	}
+	if again := r.assign(1); again == id {
+		t.Fatal("re-authentication must issue a new conn id")
+	}
+
+	// 未经认证回调的连接在首次查询时补发，且之后保持不变
+	lazy := r.get(2)
+	if lazy == "" || r.get(2) != lazy {
+		t.Fatalf("lazy conn id not stable: %q", lazy)
+	}
+
+	if info, ok := r.remove(2); !ok || info.id != lazy {
+		t.Fatalf("remove = (%v, %v)", info, ok)
+	}
+	if _, ok := r.remove(2); ok {
+		t.Fatal("second remove should find nothing")
+	}
+}
+
+// 没有 DISCONNECT 事件时不分配 ID，否则记录永远不会释放。
+func TestConnRegistryUntracked(t *testing.T) {
+	t.Parallel()
+	r := &connRegistry{conns: map[uintptr]connInfo{}}
+	r.assign(1)
+	r.untrack()
+	if id := r.assign(2); id != "" || r.get(1) != "" || r.get(3) != "" || r.size() != 0 {
+		t.Fatalf("untracked registry assigned %q and holds %d connection(s)", id, r.size())
+	}
+}
+
+func TestConnIDContext(t *testing.T) {
+	t.Parallel()
+	if got := connIDFrom(context.Background()); got != "" {
+		t.Fatalf("empty context conn id = %q", got)
+	}
+	if got := connIDFrom(withConnID(context.Background(), "abc")); got != "abc" {
+		t.Fatalf("conn id = %q, want abc", got)
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// 从数据库加载共享配置：用最小 DSN 连上之后，按实例名读取 mosq_pg_config，
+// 让一组 broker 共用在 SQL 中维护的选项。instance='*' 的行对所有实例生效，
+// 同名键以具体实例的行为准；mosquitto.conf 中显式设置的 plugin_opt_* 始终优先。
+
+var configInstance string
+
+// bootstrapOnlyOptions 决定如何连上数据库，只能在本地配置；db_driver、backends、health_* 与 go_*
+// 在读取配置表之前就已生效。
+var bootstrapOnlyOptions = map[string]bool{
+	"pg_dsn":                    true,
+	"pg_dsn_file":               true,
+	"pg_password_file":          true,
+	"pg_schema":                 true, // mosq_pg_config 本身就在该 schema 中
+	"application_name":          true,
+	"pg_session_params":         true,
+	"config_instance":           true,
+	"log_format":                true,
+	"log_file":                  true,
+	"otel_endpoint":             true,
+	"pprof_listen":              true,
+	"admin_listen":              true,
+	"admin_tls_cert":            true,
+	"admin_tls_key":             true,
+	"admin_client_ca":           true,
+	"pyroscope_url":             true,
+	"statsd_addr":               true,
+	"kafka_brokers":             true,
+	"alert_webhook_url":         true,
+	"activation_webhook_url":    true,
+	"activation_webhook_secret": true,
+	"kafka_topic":               true,
+	"kafka_tls":                 true,
+	"kafka_sasl_mechanism":      true,
+	"kafka_username":            true,
+	"kafka_password":            true,
+	"kafka_password_file":       true,
+	"kafka_format":              true,
+	"kafka_schema_registry":     true,
+	"statsd_prefix":             true,
+	"statsd_tags":               true,
+	"statsd_interval":           true,
+	"otel_service_name":         true,
+	"otel_sample_ratio":         true,
+	"cloudsql_instance":         true,
+	"cloudsql_iam_auth":         true,
+	"cloudsql_ip_type":          true,
+	"azure_ad_auth":             true,
+	"azure_client_id":           true,
+	"vault_addr":                true,
+	"vault_token":               true,
+	"vault_token_file":          true,
+	"vault_namespace":           true,
+	"vault_ca_file":             true,
+	"vault_db_mount":            true,
+	"vault_db_role":             true,
+	"db_driver":                 true,
+	"backends":                  true,
+	"health_down_after":         true,
+	"health_ping_interval":      true,
+	"go_memory_limit":           true,
+	"go_gc_percent":             true,
+	"go_memory_ballast":         true,
+}
+
+// loadDBConfig 读取实例的配置行；'*' 在前，实例专属行在后，后者覆盖前者。
+func loadDBConfig(ctx context.Context, p *pgxpool.Pool, instance string) (map[string]string, error) {
+	rows, err := p.Query(ctx,
+		"SELECT key, value FROM mosq_pg_config WHERE instance IN ('*', $1) ORDER BY instance = $1, key",
+		instance)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	opts := make(map[string]string)
+	for rows.Next() {
+		var k, v string
+		if err := rows.Scan(&k, &v); err != nil {
+			return nil, err
+		}
+		opts[strings.TrimSpace(k)] = v
+	}
+	return opts, rows.Err()
+}
+
+// applyDBConfig 应用配置表中的选项，跳过本地已设置的键与引导专用键；
+// 返回新发现的选项问题（reported 为本地阶段已报告过的问题，避免重复）。
+func applyDBConfig(ctx context.Context, p *pgxpool.Pool, localOpts map[string]bool, reported []string) []string {
+	opts, err := loadDBConfig(ctx, p, configInstance)
+	if err != nil {
+		mosqLog(logWarning, "auth-plugin: cannot load mosq_pg_config for instance %q: %v (using local options only)",
+			configInstance, err)
+		return nil
+	}
+	return applyConfigRows(opts, localOpts, reported)
+}
+
+// applyConfigRows 应用从 mosq_pg_config 读到的选项（见 applyDBConfig）。
+func applyConfigRows(opts map[string]string, localOpts map[string]bool, reported []string) []string {
+	var applied, problems []string
+	set := make(map[string]bool, len(localOpts)+len(opts))
+	for k := range localOpts {
+		set[k] = true
+	}
+	for k, v := range opts {
+		switch {
+		case localOpts[k]:
+			continue
+		case bootstrapOnlyOptions[k]:
+			problems = append(problems, "option "+k+" cannot be set from mosq_pg_config, ignoring")
+		default:
+			if err := applyOption(primary, k, v); err != nil {
+				problems = append(problems, "mosq_pg_config: "+err.Error())
+				continue
+			}
+			set[k] = true
+			applied = append(applied, k)
+		}
+	}
+	sort.Strings(applied)
+	sort.Strings(problems)
+	mosqLog(logInfo, "auth-plugin: loaded %d option(s) from mosq_pg_config for instance %q: %s",
+		len(applied), configInstance, strings.Join(applied, ","))
+
+	seen := make(map[string]bool, len(reported))
+	for _, r := range reported {
+		seen[r] = true
+	}
+	for _, v := range validateOptions(primary, set) {
+		if !seen[v] {
+			problems = append(problems, v)
+		}
+	}
+	return problems
+}
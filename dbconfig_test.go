@@ -0,0 +1,27 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestApplyConfigRows(t *testing.T) {
+	oldOpts, oldDownAfter, oldEvery := configuredOptions, healthDownAfter, aclAllowSampler.every
+	t.Cleanup(func() {
+		configuredOptions, healthDownAfter, aclAllowSampler.every = oldOpts, oldDownAfter, oldEvery
+	})
+	configuredOptions, healthDownAfter = map[string]string{}, 0
+
+	// 模拟 mosq_pg_config 中读到的行：health_down_after 在连接数据库之前就已决定，不能从表中设置
+	rows := map[string]string{"health_down_after": "3", "log_sample_acl_allow": "10", "timeout_ms": "900"}
+	problems := applyConfigRows(rows, map[string]bool{"timeout_ms": true}, nil)
+	if healthDownAfter != 0 || !strings.Contains(strings.Join(problems, "; "), "option health_down_after cannot be set from mosq_pg_config") {
+		t.Fatalf("health_down_after from the table: value %d, problems %v", healthDownAfter, problems)
+	}
+	if aclAllowSampler.every != 10 {
+		t.Fatalf("log_sample_acl_allow = %d, want 10 from the table", aclAllowSampler.every)
+	}
+	if _, ok := configuredOptions["timeout_ms"]; ok {
+		t.Fatal("a locally set option must not be overridden by the table")
+	}
+}
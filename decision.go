@@ -0,0 +1,126 @@
+package main
+
+import (
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"auth-plugin/pkg/mosqplugin"
+)
+
+// 判定：dbAuth/dbACL 返回 decision 而不是 bool。除了结论，它还带着原因、给出结论的后端、
+// 命中的 ACL 规则和建议的缓存时长，日志（reason/rule/mqtt_rc 字段）、按原因的拒绝计数、
+// 宽限缓存和返回给 broker 的值都从它得出。数据库出错、fail-open、宽限与兜底文件不经过后端，
+// 没有 decision，仍由 result*（见 eventlog.go）描述。
+
+const (
+	reasonOK            = "ok"
+	reasonUnsubscribe   = "unsubscribe"    // 取消订阅不受限
+	reasonNoCredentials = "no_credentials" // 用户名或密码为空
+	reasonUnknownUser   = "unknown_user"   // 链上没有后端认识这个用户
+	reasonDisabled      = "disabled"
+	reasonBadPassword   = "bad_password"
+	reasonWeakHash      = "weak_hash"  // weak_hash_policy=reject
+	reasonTOTP          = "totp"       // 缺少验证码或验证码错误
+	reasonNotBound      = "not_bound"  // enforce_bind 时用户名与客户端 ID 没有绑定
+	reasonNoRule        = "no_rule"    // 没有允许本次访问的 ACL 规则
+	reasonAuthorizer    = "authorizer" // gRPC 授权服务的结论，理由见 rule
+)
+
+// ttlUnlimited 表示后端对缓存时长没有要求，缓存多久由 auth_grace_minutes 等选项决定。
+const ttlUnlimited = time.Duration(1<<63 - 1)
+
+// decision 是一次认证或 ACL 判定。
+type decision struct {
+	allow   bool
+	reason  string
+	backend string        // 给出结论的后端（backends 中的名字）
+	rule    string        // 允许本次访问的 ACL 规则，或授权服务给出的理由
+	ttl     time.Duration // 结论最多可以被缓存多久；0 表示不要缓存
+}
+
+func allowed(reason string) decision { return decision{allow: true, reason: reason, ttl: ttlUnlimited} }
+
+func denied(reason string) decision { return decision{reason: reason} }
+
+// result 是返回给 broker 的值；event 为 auth 或 acl。
+func (d decision) result(event string) mosqplugin.Result {
+	switch {
+	case d.allow:
+		return mosqplugin.Success
+	case event == "acl":
+		return mosqplugin.ACLDenied
+	}
+	return mosqplugin.AuthDenied
+}
+
+// MQTT 5 原因码。
+const (
+	mqttSuccess         = 0x00
+	mqttBadClientID     = 0x85
+	mqttBadCredentials  = 0x86
+	mqttNotAuthorized   = 0x87
+	mqttBanned          = 0x8A
+	mqttUnspecifiedFail = 0x80
+)
+
+// mqttReason 是与判定对应的 MQTT 5 原因码，写入日志的 mqtt_rc 字段。broker 实际发给客户端的
+// CONNACK/SUBACK 原因码由 mosquitto 根据 result 的值决定，插件无法指定。
+func (d decision) mqttReason(event string) int {
+	switch {
+	case d.allow:
+		return mqttSuccess
+	case d.reason == "":
+		return mqttUnspecifiedFail
+	case event == "acl":
+		return mqttNotAuthorized
+	}
+	switch d.reason {
+	case reasonNoCredentials, reasonUnknownUser, reasonBadPassword, reasonWeakHash, reasonTOTP:
+		return mqttBadCredentials
+	case reasonDisabled:
+		return mqttBanned
+	case reasonNotBound:
+		return mqttBadClientID
+	}
+	return mqttNotAuthorized
+}
+
+// 按原因的拒绝计数，键为 event/reason；顺序即 getStats 与 $SYS 中的顺序。
+var denyReasons = []string{
+	"auth/" + reasonNoCredentials,
+	"auth/" + reasonUnknownUser,
+	"auth/" + reasonDisabled,
+	"auth/" + reasonBadPassword,
+	"auth/" + reasonWeakHash,
+	"auth/" + reasonTOTP,
+	"auth/" + reasonNotBound,
+	"auth/" + reasonAuthorizer,
+	"acl/" + reasonNoRule,
+	"acl/" + reasonAuthorizer,
+}
+
+var denyCounts = func() map[string]*atomic.Int64 {
+	m := make(map[string]*atomic.Int64, len(denyReasons))
+	for _, k := range denyReasons {
+		m[k] = new(atomic.Int64)
+	}
+	return m
+}()
+
+// countDenial 记录一次被拒绝的判定；不在 denyReasons 中的原因只计入 auth_denied/acl_denied。
+func countDenial(event string, d decision) {
+	if n, ok := denyCounts[event+"/"+d.reason]; ok {
+		n.Add(1)
+	}
+}
+
+// denyStats 是 statsSnapshot 中按原因的拒绝计数，例如 auth_denied_bad_password（$SYS 为 auth/denied/bad_password）。
+func denyStats() []statValue {
+	out := make([]statValue, 0, len(denyReasons))
+	for _, k := range denyReasons {
+		event, reason, _ := strings.Cut(k, "/")
+		out = append(out, statValue{event + "_denied_" + reason, event + "/denied/" + reason, denyCounts[k].Load()})
+	}
+	return out
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"testing"
+
+	"auth-plugin/pkg/mosqplugin"
+)
+
+func TestDecisionResult(t *testing.T) {
+	t.Parallel()
+	for _, tc := range []struct {
+		d      decision
+		event  string
+		result mosqplugin.Result
+		rc     int
+	}{
+		{allowed(reasonOK), "auth", mosqplugin.Success, mqttSuccess},
+		{denied(reasonBadPassword), "auth", mosqplugin.AuthDenied, mqttBadCredentials},
+		{denied(reasonUnknownUser), "auth", mosqplugin.AuthDenied, mqttBadCredentials},
+		{denied(reasonDisabled), "auth", mosqplugin.AuthDenied, mqttBanned},
+		{denied(reasonNotBound), "auth", mosqplugin.AuthDenied, mqttBadClientID},
+		{denied(reasonAuthorizer), "auth", mosqplugin.AuthDenied, mqttNotAuthorized},
+		{decision{}, "auth", mosqplugin.AuthDenied, mqttUnspecifiedFail},
+		{allowed(reasonUnsubscribe), "acl", mosqplugin.Success, mqttSuccess},
+		{denied(reasonNoRule), "acl", mosqplugin.ACLDenied, mqttNotAuthorized},
+	} {
+		if got := tc.d.result(tc.event); got != tc.result {
+			t.Errorf("%s %+v: result %d, want %d", tc.event, tc.d, got, tc.result)
+		}
+		if got := tc.d.mqttReason(tc.event); got != tc.rc {
+			t.Errorf("%s %+v: mqttReason %#x, want %#x", tc.event, tc.d, got, tc.rc)
+		}
+	}
+	if denied(reasonBadPassword).ttl != 0 {
+		t.Fatal("denials must not be cacheable")
+	}
+}
+
+func TestACLDecision(t *testing.T) {
+	t.Parallel()
+	rules := []aclRule{{Pattern: "devices/{username}/#", Acc: aclRead | aclWrite}}
+	if d := aclDecision(rules, "alice", "c1", "devices/alice/up", aclWrite); !d.allow || d.rule != "devices/{username}/#" {
+		t.Fatalf("aclDecision = %+v, want the matched rule", d)
+	}
+	if d := aclDecision(rules, "alice", "c1", "devices/bob/up", aclWrite); d.allow || d.reason != reasonNoRule || d.rule != "" {
+		t.Fatalf("aclDecision = %+v, want no_rule", d)
+	}
+}
+
+func TestDenyStats(t *testing.T) {
+	key := "auth/" + reasonDisabled
+	before := denyCounts[key].Load()
+	countDenial("auth", denied(reasonDisabled))
+	countDenial("auth", denied("not-a-reason"))
+	for _, s := range denyStats() {
+		if s.name == "auth_denied_disabled" {
+			if s.topic != "auth/denied/disabled" || s.value != before+1 {
+				t.Fatalf("deny stat %+v, want %d", s, before+1)
+			}
+			return
+		}
+	}
+	t.Fatal("auth_denied_disabled missing from denyStats")
+}
@@ -1,10 +0,0 @@
-#!/bin/bash
-set -e
-
-# Set permissions
-user="$(id -u)"
-if [ "$user" = '0' ]; then
-	[ -d "/mosquitto" ] && chown -R mosquitto:mosquitto /mosquitto || true
-fi
-
-exec "$@"
\ No newline at end of file
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"errors"
+	"sync/atomic"
+	"time"
+)
+
+// plugin_cleanup 的排空：先停止接受新工作（不再建立连接池、停止管理接口与后台任务），再在
+// drain_timeout_ms 之内把激活通知与告警队列中剩余的条目处理完、等待借出的连接归还，最后关闭连接池。
+// 到期仍未完成的查询不再等待：连接池在后台关闭，broker 不会卡在退出上。
+
+var (
+	drainTimeout = 5 * time.Second
+
+	// draining 在 cleanup 开始后为 true；drainDeadline 在关闭各 stop channel 之前写入，
+	// 后台 goroutine 在 stop 关闭之后读取。
+	draining      atomic.Bool
+	drainDeadline time.Time
+)
+
+var errDraining = errors.New("plugin is shutting down")
+
+// beginDrain 停止接受新工作并返回排空的截止时间。
+func beginDrain() time.Time {
+	draining.Store(true)
+	drainDeadline = time.Now().Add(drainTimeout)
+	return drainDeadline
+}
+
+// drainQueue 在 stop 关闭之后调用：把 q 中剩余的条目交给 handle，直到队列为空或 deadline 到期；
+// 返回没来得及处理的条目数。
+func drainQueue[T any](q chan T, deadline time.Time, handle func(T)) int {
+	for {
+		select {
+		case v := <-q:
+			if time.Now().After(deadline) {
+				return 1 + len(q)
+			}
+			handle(v)
+		default:
+			return 0
+		}
+	}
+}
+
+// waitIdle 每 10ms 检查一次 busy，直到它为 0 或 deadline 到期；返回最后一次的值。
+func waitIdle(deadline time.Time, busy func() int32) int32 {
+	for {
+		n := busy()
+		if n == 0 || !time.Now().Before(deadline) {
+			return n
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// drainPool 取下实例的连接池，等借出的连接归还后关闭；deadline 到期时改为在后台关闭，
+// 返回仍在进行的查询数。
+func (in *instance) drainPool(deadline time.Time) int32 {
+	in.poolMu.Lock()
+	p := in.pool
+	in.pool = nil
+	in.poolMu.Unlock()
+	if p == nil {
+		return 0
+	}
+	n := waitIdle(deadline, func() int32 { return p.Stat().AcquiredConns() })
+	if n > 0 {
+		go p.Close()
+		return n
+	}
+	p.Close()
+	return 0
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestDrainQueue(t *testing.T) {
+	q := make(chan int, 4)
+	q <- 1
+	q <- 2
+	var got []int
+	if left := drainQueue(q, time.Now().Add(time.Second), func(v int) { got = append(got, v) }); left != 0 || len(got) != 2 {
+		t.Fatalf("drained %v, %d left", got, left)
+	}
+	q <- 3
+	q <- 4
+	if left := drainQueue(q, time.Now().Add(-time.Second), func(int) { t.Fatal("handled after the deadline") }); left != 2 {
+		t.Fatalf("past the deadline, left = %d, want 2", left)
+	}
+}
+
+func TestWaitIdle(t *testing.T) {
+	calls := int32(0)
+	busy := func() int32 { calls++; return 3 - calls }
+	if n := waitIdle(time.Now().Add(time.Second), busy); n != 0 || calls != 3 {
+		t.Fatalf("waitIdle = %d after %d calls", n, calls)
+	}
+	if n := waitIdle(time.Now(), func() int32 { return 2 }); n != 2 {
+		t.Fatalf("at the deadline waitIdle should report the busy count, got %d", n)
+	}
+}
+
+func TestNoPoolWhileDraining(t *testing.T) {
+	t.Cleanup(func() { draining.Store(false) })
+	in := &instance{pgDSN: "postgres://127.0.0.1:1/x"}
+	in.timeout.set(time.Second)
+	beginDrain()
+	if _, err := in.ensurePool(context.Background()); !errors.Is(err, errDraining) {
+		t.Fatalf("ensurePool while draining = %v", err)
+	}
+	if n := in.drainPool(time.Now()); n != 0 {
+		t.Fatalf("drainPool without a pool = %d", n)
+	}
+}
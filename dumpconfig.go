@@ -0,0 +1,65 @@
+package main
+
+import (
+	"time"
+
+	"auth-plugin/internal/optnames"
+)
+
+// dumpConfig 控制命令：返回插件实际运行的完整配置，供支持人员确认远端 broker 用的是什么配置。
+// 与 getStatus 的 options 不同，它列出所有已知选项（没有设置的为 null，即使用默认值），
+// 并给出生效的后端链、缓存设置和其他插件实例的连接选项。密钥按 getStatus 的规则遮蔽。
+
+func dumpConfig() map[string]any {
+	opts := statusOptions()
+	all := make(map[string]any, len(optnames.Names)+len(opts))
+	for _, k := range optnames.Names {
+		all[k] = nil
+	}
+	for k, v := range opts {
+		all[k] = v
+	}
+
+	chain := make([]map[string]any, 0, len(backendChain))
+	for _, b := range activeBackends() {
+		chain = append(chain, map[string]any{"name": b.name, "required": b.required})
+	}
+
+	var others []map[string]any
+	instancesMu.Lock()
+	for _, in := range instances[1:] {
+		if in != nil {
+			others = append(others, instanceConfig(in))
+		}
+	}
+	instancesMu.Unlock()
+
+	return map[string]any{
+		"build":    currentBuild(),
+		"instance": statsInstance(),
+		"options":  all,
+		"backends": chain,
+		"caches": map[string]any{
+			"redis_cache_ttl_seconds": int64(redisCacheTTL.get() / time.Second),
+			"redis_prefix":            redisPrefix,
+			"auth_grace_minutes":      int64(authGrace / time.Minute),
+		},
+		"instances": others,
+	}
+}
+
+// instanceConfig 是 primary 之外的一个实例的选项（见 instanceOptions）。
+func instanceConfig(in *instance) map[string]any {
+	return map[string]any{
+		"slot":               in.slot,
+		"pg_dsn":             redactOptionValue("pg_dsn", in.pgDSN),
+		"pg_schema":          in.pgSchema,
+		"application_name":   in.pgAppName,
+		"timeout_ms":         int64(in.timeout.get() / time.Millisecond),
+		"fail_open_auth":     in.failOpenAuth,
+		"fail_open_acl":      in.failOpenACL,
+		"enforce_bind":       in.enforceBind,
+		"acl_check":          in.enableACLCheck,
+		"disable_basic_auth": in.disableBasicAuth,
+	}
+}
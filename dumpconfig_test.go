@@ -0,0 +1,45 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestDumpConfig(t *testing.T) {
+	oldOpts, oldDSN, oldToken, oldChain := configuredOptions, primary.pgDSN, vaultToken, backendChain
+	t.Cleanup(func() {
+		configuredOptions, primary.pgDSN, vaultToken, backendChain = oldOpts, oldDSN, oldToken, oldChain
+	})
+
+	configuredOptions = map[string]string{}
+	for k, v := range map[string]string{"vault_token": "s.topsecret", "mysql_dsn": "mqtt:hunter2@tcp(db:3306)/iot", "backends": "redis,postgres:required"} {
+		if err := applyOption(primary, k, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	primary.pgDSN = "postgres://mosq:pw@db/mqtt"
+
+	dump := dumpConfig()
+	raw, err := json.Marshal(dump)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{"topsecret", "hunter2", ":pw@"} {
+		if strings.Contains(string(raw), secret) {
+			t.Fatalf("dumpConfig leaks %q: %s", secret, raw)
+		}
+	}
+
+	opts := dump["options"].(map[string]any)
+	if v, ok := opts["pg_sslmode"]; !ok || v != nil {
+		t.Fatalf("unset options should be listed as null, got %v (present %t)", v, ok)
+	}
+	if opts["vault_token"] != "xxxxx" {
+		t.Fatalf("vault_token = %v", opts["vault_token"])
+	}
+	chain := dump["backends"].([]map[string]any)
+	if len(chain) != 2 || chain[0]["name"] != driverRedis || chain[1]["required"] != true {
+		t.Fatalf("backends = %v", chain)
+	}
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// log_format json：每个事件（认证/ACL 判定、插件日志）输出一行 JSON 到 stderr 或 log_file，
+// 供 Loki/ELK 直接解析；mosquitto 自身日志照常输出文本。
+
+const (
+	logFormatText = "text"
+	logFormatJSON = "json"
+
+	resultAllow    = "allow"
+	resultDeny     = "deny"
+	resultError    = "error"
+	resultFailOpen = "fail_open"
+	resultGrace    = "grace"
+	resultFallback = "fallback" // 数据库 down 时由 fallback_* 文件允许
+
+	// 产生判定的后端；链式后端加入后在此扩展
+	backendPG       = "pg"
+	backendCache    = "cache" // auth_grace_minutes 缓存
+	backendNone     = "none"  // 未咨询任何后端：fail-open，或数据库已标记为 down
+	backendFile     = "file"  // fallback_password_file / fallback_acl_file
+	backendKerberos = "kerberos"
+)
+
+var (
+	logFormat = logFormatText
+	logFile   string
+
+	eventMu   sync.Mutex
+	eventSink io.Writer
+	eventFile *os.File
+)
+
+type logRecord struct {
+	Timestamp  string        `json:"timestamp"`
+	Level      string        `json:"level"`
+	Event      string        `json:"event"`
+	ConnID     string        `json:"conn_id,omitempty"`
+	Username   string        `json:"username,omitempty"`
+	ClientID   string        `json:"clientid,omitempty"`
+	Topic      string        `json:"topic,omitempty"`
+	Result     string        `json:"result,omitempty"`
+	Backend    string        `json:"backend,omitempty"`
+	Reason     string        `json:"reason,omitempty"`
+	Rule       string        `json:"rule,omitempty"`
+	MQTTReason int           `json:"mqtt_rc,omitempty"`
+	LatencyMS  *float64      `json:"latency_ms,omitempty"`
+	SampleRate int           `json:"sample_rate,omitempty"`
+	Error      string        `json:"error,omitempty"`
+	Message    string        `json:"msg,omitempty"`
+	Change     *configChange `json:"change,omitempty"`
+}
+
+func parseLogFormat(v string) (string, bool) {
+	switch f := strings.ToLower(strings.TrimSpace(v)); f {
+	case logFormatText, logFormatJSON:
+		return f, true
+	}
+	return "", false
+}
+
+func levelName(level int) string {
+	switch level {
+	case logErr:
+		return "error"
+	case logWarning:
+		return "warn"
+	case logNotice:
+		return "notice"
+	case logDebug:
+		return "debug"
+	default:
+		return "info"
+	}
+}
+
+// openEventLog 在 log_format=json 时打开输出目标。
+func openEventLog() error {
+	if logFormat != logFormatJSON {
+		return nil
+	}
+	eventMu.Lock()
+	defer eventMu.Unlock()
+	if logFile == "" {
+		eventSink = os.Stderr
+		return nil
+	}
+	f, err := os.OpenFile(logFile, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o640)
+	if err != nil {
+		return fmt.Errorf("open log_file: %w", err)
+	}
+	eventSink, eventFile = f, f
+	return nil
+}
+
+func closeEventLog() {
+	eventMu.Lock()
+	defer eventMu.Unlock()
+	if eventFile != nil {
+		eventFile.Close()
+	}
+	eventSink, eventFile = nil, nil
+}
+
+func writeEvent(rec logRecord) {
+	eventMu.Lock()
+	defer eventMu.Unlock()
+	if eventSink == nil {
+		return
+	}
+	if rec.Timestamp == "" {
+		rec.Timestamp = time.Now().UTC().Format(time.RFC3339Nano)
+	}
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return
+	}
+	eventSink.Write(append(line, '\n'))
+}
+
+// logMessage 把插件日志同时写入 JSON 事件流。
+func logMessage(level int, msg string) {
+	if logFormat != logFormatJSON {
+		return
+	}
+	writeEvent(logRecord{Level: levelName(level), Event: "log", Message: strings.TrimPrefix(msg, "auth-plugin: ")})
+}
+
+// decisionBackend 返回给出判定的一层：后端的判定用后端的名字（postgres 记为 pg），其余按结果推断。
+func decisionBackend(result string, d decision, err error) string {
+	switch {
+	case result == resultGrace:
+		return backendCache
+	case result == resultFallback:
+		return backendFile
+	case result == resultFailOpen, errors.Is(err, errDatabaseDown):
+		return backendNone
+	case d.backend != "" && d.backend != driverPostgres:
+		return d.backend
+	}
+	return backendPG
+}
+
+// logDecision 记录一次认证/ACL 判定及其耗时：debug 级别写入 mosquitto 日志，
+// log_format=json 写入事件流，配置了 Kafka 时同时发送。allow 按 log_sample_* 采样。
+func logDecision(event, connID, username, clientID, topic string, start time.Time, result string, d decision, err error) {
+	if logFormat != logFormatJSON && logLevel.Load() < logLevelDebug && kafkaClient == nil {
+		return
+	}
+	keep, rate := samplerFor(event).keep(result)
+	if !keep {
+		return
+	}
+	latency := float64(time.Since(start).Microseconds()) / 1000
+	username, clientID = redactID(username), redactID(clientID)
+	backend := decisionBackend(result, d, err)
+	if logLevel.Load() >= logLevelDebug {
+		mosqLog(logDebug, "auth-plugin: %s conn=%s user=%q client=%q topic=%q -> %s (%s) via %s in %.3fms",
+			event, connID, username, clientID, topic, result, d.reason, backend, latency)
+	}
+	rec := logRecord{
+		Level: "info", Event: event, ConnID: connID, Username: username, ClientID: clientID, Topic: topic,
+		Result: result, Backend: backend, Reason: d.reason, Rule: d.rule, LatencyMS: &latency,
+	}
+	if d.reason != "" {
+		rec.MQTTReason = d.mqttReason(event)
+	}
+	if rate > 1 {
+		rec.SampleRate = rate
+	}
+	if err != nil {
+		rec.Level, rec.Error = "warn", err.Error()
+	}
+	publishDecision(rec)
+	if logFormat == logFormatJSON {
+		writeEvent(rec)
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestLogDecisionJSON(t *testing.T) {
+	oldFormat, oldSink := logFormat, eventSink
+	t.Cleanup(func() { logFormat, eventSink = oldFormat, oldSink })
+
+	var buf bytes.Buffer
+	logFormat, eventSink = logFormatJSON, &buf
+	logDecision("acl", "0123456789abcdef", "alice", "c1", "devices/alice/up", time.Now().Add(-5*time.Millisecond), resultError, decision{}, errors.New("timeout"))
+	logDecision("auth", "", "bob", "c2", "", time.Now(), resultAllow, allowed(reasonOK), nil)
+
+	lines := bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n"))
+	if len(lines) != 2 {
+		t.Fatalf("got %d lines, want 2: %s", len(lines), buf.String())
+	}
+	var rec map[string]any
+	if err := json.Unmarshal(lines[0], &rec); err != nil {
+		t.Fatal(err)
+	}
+	if rec["event"] != "acl" || rec["conn_id"] != "0123456789abcdef" || rec["topic"] != "devices/alice/up" || rec["error"] != "timeout" || rec["level"] != "warn" || rec["backend"] != backendPG {
+		t.Fatalf("unexpected record %v", rec)
+	}
+	if _, ok := rec["reason"]; ok {
+		t.Fatalf("an error has no decision, got reason %v", rec["reason"])
+	}
+	if ms, _ := rec["latency_ms"].(float64); ms < 5 {
+		t.Fatalf("latency_ms = %v, want >= 5", rec["latency_ms"])
+	}
+	if _, err := time.Parse(time.RFC3339Nano, rec["timestamp"].(string)); err != nil {
+		t.Fatalf("bad timestamp: %v", err)
+	}
+
+	rec = nil
+	if err := json.Unmarshal(lines[1], &rec); err != nil {
+		t.Fatal(err)
+	}
+	if rec["reason"] != reasonOK || rec["mqtt_rc"] != nil {
+		t.Fatalf("allow record %v, want reason ok and no mqtt_rc", rec)
+	}
+
+	buf.Reset()
+	logFormat = logFormatText
+	logDecision("auth", "", "bob", "c2", "", time.Now(), resultAllow, allowed(reasonOK), nil)
+	if buf.Len() != 0 {
+		t.Fatalf("text mode must not write JSON events: %s", buf.String())
+	}
+}
+
+func TestDecisionBackend(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		result  string
+		backend string
+		err     error
+		want    string
+	}{
+		{resultAllow, "", nil, backendPG},
+		{resultAllow, driverPostgres, nil, backendPG},
+		{resultDeny, driverRedis, nil, driverRedis},
+		{resultAllow, driverGRPC, nil, driverGRPC},
+		{resultError, "", errors.New("timeout"), backendPG},
+		{resultGrace, "", errors.New("timeout"), backendCache},
+		{resultFailOpen, "", errors.New("timeout"), backendNone},
+		{resultError, "", errDatabaseDown, backendNone},
+	}
+	for _, tc := range tests {
+		if got := decisionBackend(tc.result, decision{backend: tc.backend}, tc.err); got != tc.want {
+			t.Fatalf("decisionBackend(%s, %v) = %s, want %s", tc.result, tc.err, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// fail-open 用量：统计仅因 fail_open_auth / fail_open_acl 放行的请求，避免"悄悄开着跑了一周"。
+// 计数见 getStats / $SYS；fail_open_warn_per_minute>0 时，任一分钟内放行数超过阈值即输出警告并发送告警，
+// 每分钟最多一次，故障持续期间会持续提醒。
+
+var (
+	authFailOpen atomic.Int64
+	aclFailOpen  atomic.Int64
+
+	failOpenWarnPerMinute int64 // 0 表示不检查
+	failOpenRate          = &minuteCounter{now: time.Now}
+)
+
+// minuteCounter 按自然分钟计数。
+type minuteCounter struct {
+	mu     sync.Mutex
+	minute time.Time
+	count  int64
+	now    func() time.Time
+}
+
+// add 计数一次，返回本分钟内的累计值。
+func (m *minuteCounter) add() int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if cur := m.now().Truncate(time.Minute); !cur.Equal(m.minute) {
+		m.minute, m.count = cur, 0
+	}
+	m.count++
+	return m.count
+}
+
+// recordFailOpen 在 fail-open 放行时调用；刚越过阈值时告警。
+func recordFailOpen(event string) {
+	if event == "auth" {
+		authFailOpen.Add(1)
+	} else {
+		aclFailOpen.Add(1)
+	}
+	if failOpenWarnPerMinute <= 0 {
+		return
+	}
+	if n := failOpenRate.add(); n == failOpenWarnPerMinute+1 {
+		mosqLog(logWarning, "auth-plugin: more than %d requests allowed by fail-open in the last minute (auth total %d, acl total %d)",
+			failOpenWarnPerMinute, authFailOpen.Load(), aclFailOpen.Load())
+		raiseAlert("fail_open_rate", "more than %d requests per minute are being allowed without database checks", failOpenWarnPerMinute)
+	}
+}
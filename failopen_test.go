@@ -0,0 +1,43 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMinuteCounter(t *testing.T) {
+	t.Parallel()
+	now := time.Date(2026, 10, 16, 8, 0, 10, 0, time.UTC)
+	m := &minuteCounter{now: func() time.Time { return now }}
+
+	for i := int64(1); i <= 3; i++ {
+		if got := m.add(); got != i {
+			t.Fatalf("add #%d = %d", i, got)
+		}
+	}
+	now = now.Add(49 * time.Second) // 08:00:59，同一分钟
+	if got := m.add(); got != 4 {
+		t.Fatalf("same minute count = %d, want 4", got)
+	}
+	now = now.Add(2 * time.Second) // 08:01:01
+	if got := m.add(); got != 1 {
+		t.Fatalf("new minute count = %d, want 1", got)
+	}
+}
+
+func TestRecordFailOpenCounters(t *testing.T) {
+	oldWarn := failOpenWarnPerMinute
+	t.Cleanup(func() { failOpenWarnPerMinute = oldWarn })
+	failOpenWarnPerMinute = 0
+
+	auth, acl := authFailOpen.Load(), aclFailOpen.Load()
+	recordFailOpen("auth")
+	recordFailOpen("acl")
+	recordFailOpen("acl")
+	if authFailOpen.Load()-auth != 1 || aclFailOpen.Load()-acl != 2 {
+		t.Fatalf("fail-open counters auth +%d acl +%d, want +1 +2", authFailOpen.Load()-auth, aclFailOpen.Load()-acl)
+	}
+	if stats := statsMap(); stats["auth_fail_open"] != authFailOpen.Load() || stats["acl_fail_open"] != aclFailOpen.Load() {
+		t.Fatalf("stats missing fail-open counters: %v", stats)
+	}
+}
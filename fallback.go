@@ -0,0 +1,198 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"auth-plugin/internal/aclrule"
+	"auth-plugin/internal/shacrypt"
+)
+
+// fallback_password_file / fallback_acl_file：数据库被健康状态机标记为 down 时的本地兜底，
+// 格式与 mosquitto 的 password_file/acl_file 相同（可以是 export 定期导出的快照）。
+// 只在 down 状态下使用；文件里有的用户按文件判定（允许或拒绝），文件里没有的用户
+// 仍按 fail_open_* / 宽限模式处理。文件没有 client_bindings，enforce_bind 生效的连接不走兜底。
+// 健康检查每次探测时比较文件的修改时间与大小，有变化就重新加载。
+
+var (
+	fallbackPasswordFile string
+	fallbackACLFile      string
+
+	fallbackData atomic.Pointer[fallbackSnapshot]
+	fallbackMu   sync.Mutex // 串行化加载
+
+	authFallback atomic.Int64
+	aclFallback  atomic.Int64
+)
+
+type fileStamp struct {
+	mod  time.Time
+	size int64
+}
+
+type fallbackSnapshot struct {
+	hashes map[string]string
+	rules  map[string][]aclRule // 用户名 -> 规则，'*' 为 pattern 行
+	hasACL bool
+
+	passwdStamp, aclStamp fileStamp
+}
+
+func statFile(path string) (fileStamp, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return fileStamp{}, err
+	}
+	return fileStamp{fi.ModTime(), fi.Size()}, nil
+}
+
+// parseFallbackPasswd 读取 username:hash；只接受插件能校验的 bcrypt 与 mosquitto $7$/$6$ 哈希。
+func parseFallbackPasswd(r io.Reader, warn func(string)) (map[string]string, error) {
+	out := map[string]string{}
+	sc := bufio.NewScanner(r)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimRight(sc.Text(), "\r")
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		user, hash, ok := strings.Cut(line, ":")
+		switch {
+		case !ok || user == "" || hash == "":
+			warn(fmt.Sprintf("line %d: want username:hash, skipped", n))
+			continue
+		case !isBcryptHash(hash) && !isMosquittoHash(hash) && !shacrypt.Is(hash):
+			warn(fmt.Sprintf("line %d: %s has no bcrypt, mosquitto or SHA-crypt hash, skipped", n, user))
+			continue
+		}
+		out[user] = hash
+	}
+	return out, sc.Err()
+}
+
+func loadFallbackFile(path string, parse func(io.Reader) error) (fileStamp, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return fileStamp{}, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return fileStamp{}, err
+	}
+	if err := parse(f); err != nil {
+		return fileStamp{}, fmt.Errorf("%s: %w", path, err)
+	}
+	return fileStamp{fi.ModTime(), fi.Size()}, nil
+}
+
+// loadFallback 读取两个兜底文件；读取失败时保留上一次成功加载的内容。
+func loadFallback() error {
+	if fallbackPasswordFile == "" && fallbackACLFile == "" {
+		return nil
+	}
+	fallbackMu.Lock()
+	defer fallbackMu.Unlock()
+	snap := &fallbackSnapshot{}
+	if old := fallbackData.Load(); old != nil {
+		*snap = *old
+	}
+	var errs []error
+	warn := func(file string) func(string) {
+		return func(msg string) {
+			mosqLog(logWarning, "auth-plugin: %s %s", file, msg)
+		}
+	}
+	if fallbackPasswordFile != "" {
+		stamp, err := loadFallbackFile(fallbackPasswordFile, func(r io.Reader) error {
+			hashes, err := parseFallbackPasswd(r, warn("fallback_password_file"))
+			if err == nil {
+				snap.hashes = hashes
+			}
+			return err
+		})
+		if err != nil {
+			errs = append(errs, err)
+		} else {
+			snap.passwdStamp = stamp
+		}
+	}
+	if fallbackACLFile != "" {
+		stamp, err := loadFallbackFile(fallbackACLFile, func(r io.Reader) error {
+			entries, err := aclrule.ParseFile(r, warn("fallback_acl_file"))
+			if err != nil {
+				return err
+			}
+			rules := map[string][]aclRule{}
+			for _, e := range entries {
+				rules[e.Username] = append(rules[e.Username], e.Rule)
+			}
+			snap.rules, snap.hasACL = rules, true
+			return nil
+		})
+		if err != nil {
+			errs = append(errs, err)
+		} else {
+			snap.aclStamp = stamp
+		}
+	}
+	fallbackData.Store(snap)
+	mosqLog(logInfo, "auth-plugin: fallback files loaded: %d user(s), %d ACL owner(s)", len(snap.hashes), len(snap.rules))
+	return errors.Join(errs...)
+}
+
+// refreshFallback 在文件变化后重新加载，由健康检查定期调用。
+func refreshFallback() {
+	snap := fallbackData.Load()
+	if snap == nil {
+		return
+	}
+	changed := false
+	if fallbackPasswordFile != "" {
+		st, err := statFile(fallbackPasswordFile)
+		changed = changed || err == nil && st != snap.passwdStamp
+	}
+	if fallbackACLFile != "" {
+		st, err := statFile(fallbackACLFile)
+		changed = changed || err == nil && st != snap.aclStamp
+	}
+	if !changed {
+		return
+	}
+	if err := loadFallback(); err != nil {
+		mosqLogDeduped(logWarning, "auth-plugin: reloading fallback files: "+err.Error())
+	}
+}
+
+// fallbackAuth 在数据库 down 时按兜底文件认证；known 为 false 表示文件里没有该用户（或无法判定）。
+func fallbackAuth(username, password string, pol requestPolicy) (allow, known bool) {
+	snap := fallbackData.Load()
+	if snap == nil || pol.enforceBind {
+		return false, false
+	}
+	hash, ok := snap.hashes[username]
+	if !ok {
+		return false, false
+	}
+	ok, weak := verifyPassword(hash, "", password)
+	if ok && weak != "" && !weakHashAllowed(hash) {
+		ok = false
+	}
+	return ok, true
+}
+
+// fallbackACL 在数据库 down 时按兜底 acl_file 判定；没有配置 acl 文件时 ok 为 false。
+func fallbackACL(username, clientID, topic string, access int) (allow, ok bool) {
+	snap := fallbackData.Load()
+	if snap == nil || !snap.hasACL {
+		return false, false
+	}
+	rules := append(append([]aclRule(nil), snap.rules[username]...), snap.rules["*"]...)
+	return aclAllows(rules, username, clientID, topic, access), true
+}
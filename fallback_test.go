@@ -0,0 +1,115 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestParseFallbackPasswd(t *testing.T) {
+	t.Parallel()
+	in := `# snapshot
+alice:$2a$04$abcdefghijklmnopqrstuuLnCFpb0SEv6VMgpiRM7SA7OvJ/1Ygpm
+bob:plain
+broken
+`
+	var warnings []string
+	got, err := parseFallbackPasswd(strings.NewReader(in), func(s string) { warnings = append(warnings, s) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got["alice"] == "" {
+		t.Errorf("hashes = %v, want alice only", got)
+	}
+	if len(warnings) != 2 || !strings.Contains(warnings[0], "line 3: bob") || !strings.Contains(warnings[1], "line 4") {
+		t.Errorf("warnings = %q", warnings)
+	}
+}
+
+func TestFallbackFiles(t *testing.T) {
+	oldPW, oldACL := fallbackPasswordFile, fallbackACLFile
+	t.Cleanup(func() {
+		fallbackPasswordFile, fallbackACLFile = oldPW, oldACL
+		fallbackData.Store(nil)
+	})
+
+	dir := t.TempDir()
+	hash, _ := bcrypt.GenerateFromPassword([]byte("pw"), bcrypt.MinCost)
+	fallbackPasswordFile = filepath.Join(dir, "passwd")
+	fallbackACLFile = filepath.Join(dir, "acl")
+	if err := os.WriteFile(fallbackPasswordFile, []byte("alice:"+string(hash)+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := loadFallback(); err == nil {
+		t.Error("a missing acl file should be reported")
+	}
+
+	if allow, known := fallbackAuth("alice", "pw", requestPolicy{}); !known || !allow {
+		t.Errorf("fallbackAuth(alice) = %t, %t", allow, known)
+	}
+	if allow, known := fallbackAuth("alice", "wrong", requestPolicy{}); !known || allow {
+		t.Errorf("a wrong password for a user in the file should be a known deny")
+	}
+	if _, known := fallbackAuth("mallory", "pw", requestPolicy{}); known {
+		t.Error("users missing from the file should take the normal error path")
+	}
+	if _, known := fallbackAuth("alice", "pw", requestPolicy{enforceBind: true}); known {
+		t.Error("enforce_bind cannot be checked against the file")
+	}
+	if _, ok := fallbackACL("alice", "c1", "devices/alice/up", aclWrite); ok {
+		t.Error("without an acl file ACL checks should take the normal error path")
+	}
+
+	acl := "pattern write devices/%u/#\nuser alice\ntopic read cmd/alice\n"
+	if err := os.WriteFile(fallbackACLFile, []byte(acl), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	refreshFallback()
+	for _, c := range []struct {
+		user, topic string
+		access      int
+		want        bool
+	}{
+		{"alice", "devices/alice/up", aclWrite, true},
+		{"bob", "devices/bob/up", aclWrite, true},
+		{"bob", "devices/alice/up", aclWrite, false},
+		{"alice", "cmd/alice", aclRead, true},
+		{"alice", "cmd/alice", aclWrite, false},
+	} {
+		if allow, ok := fallbackACL(c.user, "c1", c.topic, c.access); !ok || allow != c.want {
+			t.Errorf("fallbackACL(%s, %s, %d) = %t, %t; want %t", c.user, c.topic, c.access, allow, ok, c.want)
+		}
+	}
+
+	// 快照被替换后重新加载
+	later := time.Now().Add(time.Minute)
+	if err := os.WriteFile(fallbackPasswordFile, []byte("bob:"+string(hash)+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	os.Chtimes(fallbackPasswordFile, later, later)
+	refreshFallback()
+	if _, known := fallbackAuth("alice", "pw", requestPolicy{}); known {
+		t.Error("alice should be gone after the password file changed")
+	}
+	if allow, _ := fallbackAuth("bob", "pw", requestPolicy{}); !allow {
+		t.Error("bob should be loaded from the new snapshot")
+	}
+}
+
+func TestValidateFallbackOptions(t *testing.T) {
+	old := healthDownAfter
+	t.Cleanup(func() { healthDownAfter = old })
+
+	healthDownAfter = 0
+	if problems := strings.Join(validateOptions(primary, map[string]bool{"fallback_password_file": true}), "; "); !strings.Contains(problems, "need health_down_after") {
+		t.Errorf("validateOptions = %q", problems)
+	}
+	healthDownAfter = 3
+	if problems := validateOptions(primary, map[string]bool{"fallback_password_file": true, "health_down_after": true}); len(problems) != 0 {
+		t.Errorf("validateOptions = %v, want none", problems)
+	}
+}
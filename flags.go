@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// 运行时功能开关：flags_poll_interval>0 时后台每隔这么多秒读取 mosq_pg_flags，按 broker 实例
+// （config_instance，否则主机名；instance='*' 对所有实例生效，具体实例的行优先）开关已配置的子系统，
+// 无需重启或 SIGHUP。没有对应行的开关保持开启，所以开关只能关闭或重新打开 mosquitto.conf 中已启用的功能：
+// 灰度上线时先插入 enabled=false 的行再发布配置，出问题时把行改为 false 即可在一个轮询周期内止损。
+// 读表失败时保持上一次的状态。
+
+const (
+	flagConfigAudit = "config_audit" // config_audit_table
+	flagStatsTable  = "stats_table"  // stats_table_interval
+	flagKafka       = "kafka_events" // kafka_brokers
+	flagActivation  = "activation"   // activation_webhook_url
+	flagAlerts      = "alerts"       // alert_webhook_url
+	flagTracing     = "tracing"      // otel_endpoint
+)
+
+const flagsQuery = "SELECT flag, enabled FROM mosq_pg_flags WHERE instance IN ('*', $1) ORDER BY instance = $1, flag"
+
+var (
+	flagsPollInterval time.Duration // 0 表示不读表
+
+	flagsStop chan struct{}
+	flagsDone chan struct{}
+)
+
+// flagSet 是一组开关，开关的名字在创建时固定。
+type flagSet map[string]*atomic.Bool
+
+func newFlagSet(names ...string) flagSet {
+	f := make(flagSet, len(names))
+	for _, n := range names {
+		b := new(atomic.Bool)
+		b.Store(true)
+		f[n] = b
+	}
+	return f
+}
+
+var featureFlags = newFlagSet(flagConfigAudit, flagStatsTable, flagKafka, flagActivation, flagAlerts, flagTracing)
+
+// on 报告开关是否开启；不认识的名字视为开启。
+func (f flagSet) on(name string) bool {
+	b, ok := f[name]
+	return !ok || b.Load()
+}
+
+// apply 按表中的行设置开关，没有行的开关恢复开启；返回状态变化的开关与表中不认识的名字（均已排序）。
+func (f flagSet) apply(rows map[string]bool) (changed, unknown []string) {
+	for name, b := range f {
+		want, ok := rows[name]
+		if !ok {
+			want = true
+		}
+		if b.Swap(want) != want {
+			changed = append(changed, name)
+		}
+	}
+	for name := range rows {
+		if _, ok := f[name]; !ok {
+			unknown = append(unknown, name)
+		}
+	}
+	sort.Strings(changed)
+	sort.Strings(unknown)
+	return changed, unknown
+}
+
+// snapshot 返回全部开关的当前状态，用于 getStatus。
+func (f flagSet) snapshot() map[string]bool {
+	out := make(map[string]bool, len(f))
+	for name, b := range f {
+		out[name] = b.Load()
+	}
+	return out
+}
+
+// loadFlags 读取实例的开关行；instance 专属的行排在 '*' 之后，覆盖前者。
+func loadFlags(ctx context.Context, instance string) (map[string]bool, error) {
+	p, err := primary.ensurePool(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := p.Query(ctx, flagsQuery, instance)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := map[string]bool{}
+	for rows.Next() {
+		var name string
+		var enabled bool
+		if err := rows.Scan(&name, &enabled); err != nil {
+			return nil, err
+		}
+		out[strings.TrimSpace(name)] = enabled
+	}
+	return out, rows.Err()
+}
+
+// pollFlags 读取一次开关并记录变化。
+func pollFlags(instance string) {
+	ctx, cancel := ctxTimeout()
+	defer cancel()
+	rows, err := loadFlags(ctx, instance)
+	if err != nil {
+		mosqLogDeduped(logWarning, "auth-plugin: cannot read mosq_pg_flags: %v (keeping current flags)", err)
+		return
+	}
+	changed, unknown := featureFlags.apply(rows)
+	for _, name := range changed {
+		state := "off"
+		if featureFlags.on(name) {
+			state = "on"
+		}
+		mosqLog(logNotice, "auth-plugin: feature flag %s turned %s by mosq_pg_flags", name, state)
+	}
+	if len(unknown) > 0 {
+		mosqLogDeduped(logWarning, "auth-plugin: mosq_pg_flags has unknown flags: %s", strings.Join(unknown, ","))
+	}
+}
+
+func startFlags() {
+	if flagsPollInterval <= 0 {
+		return
+	}
+	instance := statsInstance()
+	pollFlags(instance)
+	stop, done := make(chan struct{}), make(chan struct{})
+	flagsStop, flagsDone = stop, done
+	go func() {
+		defer close(done)
+		t := time.NewTicker(flagsPollInterval)
+		defer t.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-t.C:
+				pollFlags(instance)
+			}
+		}
+	}()
+}
+
+func stopFlags() {
+	if flagsStop == nil {
+		return
+	}
+	close(flagsStop)
+	<-flagsDone
+	flagsStop, flagsDone = nil, nil
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFlagSetApply(t *testing.T) {
+	t.Parallel()
+	f := newFlagSet("a", "b", "c")
+	if !f.on("a") || !f.on("missing") {
+		t.Fatal("flags should start on, and unknown names count as on")
+	}
+
+	changed, unknown := f.apply(map[string]bool{"b": false, "c": true, "zz": false})
+	if !reflect.DeepEqual(changed, []string{"b"}) || !reflect.DeepEqual(unknown, []string{"zz"}) {
+		t.Fatalf("apply = %v, %v", changed, unknown)
+	}
+	if f.on("b") || !f.on("c") {
+		t.Fatalf("state after apply = %v", f.snapshot())
+	}
+
+	changed, unknown = f.apply(map[string]bool{"b": false})
+	if changed != nil || unknown != nil {
+		t.Fatalf("unchanged rows reported %v, %v", changed, unknown)
+	}
+
+	// 删除行后开关恢复开启
+	changed, _ = f.apply(nil)
+	if !reflect.DeepEqual(changed, []string{"b"}) || !f.on("b") {
+		t.Fatalf("a removed row should turn the flag back on, changed %v", changed)
+	}
+	if want := map[string]bool{"a": true, "b": true, "c": true}; !reflect.DeepEqual(f.snapshot(), want) {
+		t.Fatalf("snapshot = %v", f.snapshot())
+	}
+}
+
+func TestStartFlagsDisabled(t *testing.T) {
+	old := flagsPollInterval
+	t.Cleanup(func() { flagsPollInterval = old })
+
+	flagsPollInterval = 0
+	startFlags()
+	if flagsStop != nil {
+		t.Fatal("flags_poll_interval 0 must not start the poller")
+	}
+	stopFlags()
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// compat mosquitto-go-auth：沿用 mosquitto-go-auth postgres 后端的选项名、查询与哈希格式，
+// 现有部署换插件时不用改表结构，mosquitto.conf 里的 auth_opt_* 行也能原样保留
+// （mosquitto 2.x 把 auth_opt_ 当作 plugin_opt_ 传给插件）。
+//
+//   pg_userquery   $1=用户名，返回一列密码哈希
+//   pg_superquery  $1=用户名，返回计数，大于 0 为超级用户（跳过 ACL）
+//   pg_aclquery    $1=用户名 $2=访问类型（1 read、2 write、4 subscribe），返回主题，%u/%c 为用户名/客户端 ID
+//
+// go-auth 没有 client_bindings，enforce_bind 不可用。
+
+const compatGoAuth = "mosquitto-go-auth"
+
+var (
+	compatMode string
+
+	goAuthHost, goAuthPort, goAuthUser, goAuthPassword, goAuthDBName string
+	goAuthSSLMode, goAuthSSLCert, goAuthSSLKey, goAuthSSLRootCert    string
+
+	goAuthUserQuery, goAuthSuperQuery, goAuthACLQuery string
+	goAuthMaxLifeTime                                 time.Duration
+	goAuthDisableSuperuser                            bool
+)
+
+// goAuthConnOptions 拼成 DSN 的 go-auth 连接选项，pg_dsn 已设置时不生效。
+var goAuthConnOptions = []string{
+	"pg_host", "pg_port", "pg_user", "pg_password", "pg_dbname",
+	"pg_sslmode", "pg_sslcert", "pg_sslkey", "pg_sslrootcert",
+}
+
+// goAuthOnlyOptions 只在 compat mosquitto-go-auth 下有意义。
+var goAuthOnlyOptions = append([]string{
+	"pg_userquery", "pg_superquery", "pg_aclquery", "pg_max_life_time", "disable_superuser", "hasher_salt_encoding",
+}, goAuthConnOptions...)
+
+// goAuthIgnoredOptions 是 go-auth 中本插件没有对应功能的选项：接受以免迁移时改配置，但不生效。
+// hasher_* 只影响 go-auth 生成新哈希，校验时参数从哈希本身读取。
+var goAuthIgnoredOptions = []string{
+	"hasher", "hasher_salt_size", "hasher_iterations", "hasher_algorithm", "hasher_keylen",
+	"hasher_memory", "hasher_parallelism", "hasher_cost",
+	"cache", "cache_type", "cache_reset", "cache_refresh", "auth_cache_seconds", "acl_cache_seconds",
+	"auth_jitter_seconds", "acl_jitter_seconds", "log_dest", "pg_connect_tries",
+}
+
+func parseCompatMode(v string) (string, bool) {
+	switch strings.ToLower(strings.TrimSpace(v)) {
+	case "", "none", "off":
+		return "", true
+	case compatGoAuth, "go-auth", "goauth":
+		return compatGoAuth, true
+	}
+	return "", false
+}
+
+func parseSaltEncoding(v string) error {
+	switch strings.ToLower(strings.TrimSpace(v)) {
+	case "base64":
+		goAuthSaltUTF8 = false
+	case "utf-8", "utf8":
+		goAuthSaltUTF8 = true
+	default:
+		return fmt.Errorf("want base64 or utf-8, keeping existing value")
+	}
+	return nil
+}
+
+// goAuthDSN 按 go-auth 的默认值（localhost:5432，sslmode disable）拼出 keyword/value 形式的 DSN。
+func goAuthDSN() string {
+	kv := []struct{ k, v, def string }{
+		{"host", goAuthHost, "localhost"},
+		{"port", goAuthPort, "5432"},
+		{"user", goAuthUser, ""},
+		{"password", goAuthPassword, ""},
+		{"dbname", goAuthDBName, ""},
+		{"sslmode", goAuthSSLMode, "disable"},
+		{"sslcert", goAuthSSLCert, ""},
+		{"sslkey", goAuthSSLKey, ""},
+		{"sslrootcert", goAuthSSLRootCert, ""},
+	}
+	var parts []string
+	for _, p := range kv {
+		v := p.v
+		if v == "" {
+			v = p.def
+		}
+		if v == "" {
+			continue
+		}
+		parts = append(parts, p.k+"="+quoteDSNValue(v))
+	}
+	return strings.Join(parts, " ")
+}
+
+func quoteDSNValue(v string) string {
+	if v != "" && !strings.ContainsAny(v, ` '\`) {
+		return v
+	}
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(v) + "'"
+}
+
+var errNoBindings = errors.New("client bindings are not available with compat mosquitto-go-auth")
+
+var goAuthPlaceholders = strings.NewReplacer("%u", "{username}", "%c", "{clientid}")
+
+type goAuthStore struct{ p *pgxpool.Pool }
+
+func (s goAuthStore) user(ctx context.Context, username string) (deviceRow, bool, error) {
+	d := deviceRow{enabled: true}
+	err := withRetry(ctx, func() error {
+		return s.p.QueryRow(ctx, goAuthUserQuery, username).Scan(&d.hash)
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return d, false, nil
+	}
+	return d, err == nil, err
+}
+
+func (s goAuthStore) bound(context.Context, string, string) (bool, error) {
+	return false, errNoBindings
+}
+
+func (s goAuthStore) rules(ctx context.Context, username string) ([]aclRule, error) {
+	var rules []aclRule
+	err := withRetry(ctx, func() (err error) {
+		rules, err = s.batchRules(ctx, username)
+		return err
+	})
+	return rules, err
+}
+
+// batchRules 在一次往返中查询超级用户与三种访问类型的主题，转换成本插件的规则。
+func (s goAuthStore) batchRules(ctx context.Context, username string) ([]aclRule, error) {
+	b := &pgx.Batch{}
+	super := goAuthSuperQuery != "" && !goAuthDisableSuperuser
+	if super {
+		b.Queue(goAuthSuperQuery, username)
+	}
+	accs := []int{aclRead, aclWrite, aclSubscribe}
+	if goAuthACLQuery != "" {
+		for _, acc := range accs {
+			b.Queue(goAuthACLQuery, username, acc)
+		}
+	}
+	if b.Len() == 0 {
+		return nil, nil
+	}
+	br := s.p.SendBatch(ctx, b)
+	defer br.Close()
+	if super {
+		var n int64
+		if err := br.QueryRow().Scan(&n); err != nil {
+			return nil, fmt.Errorf("pg_superquery: %w", err)
+		}
+		if n > 0 {
+			return []aclRule{{Pattern: "#", Acc: aclRead | aclWrite | aclSubscribe}}, nil
+		}
+	}
+	if goAuthACLQuery == "" {
+		return nil, nil
+	}
+	index := map[string]int{}
+	var rules []aclRule
+	for _, acc := range accs {
+		rows, err := br.Query()
+		if err != nil {
+			return nil, fmt.Errorf("pg_aclquery: %w", err)
+		}
+		topics, err := pgx.CollectRows(rows, pgx.RowTo[string])
+		if err != nil {
+			return nil, fmt.Errorf("pg_aclquery: %w", err)
+		}
+		for _, t := range topics {
+			pattern := goAuthPlaceholders.Replace(t)
+			if i, ok := index[pattern]; ok {
+				rules[i].Acc |= acc
+				continue
+			}
+			index[pattern] = len(rules)
+			rules = append(rules, aclRule{Pattern: pattern, Acc: acc})
+		}
+	}
+	return rules, nil
+}
+
+func (s goAuthStore) ping(ctx context.Context) error { return s.p.Ping(ctx) }
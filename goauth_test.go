@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/argon2"
+)
+
+func TestVerifyGoAuthHash(t *testing.T) {
+	const pbkdf2SHA512 = "PBKDF2$sha512$100000$MDEyMzQ1Njc4OWFiY2RlZg==$RR+QpzTpOdzLAInfl1+WH3TwXhVK7F0udn1mMKvdoR1ZrAwr05XpreGu5vfzKpFLcF+2GH2YQ0mVwg8C/wjxXg=="
+	const pbkdf2UTF8 = "PBKDF2$sha256$1000$plainsalt$PqiWDPlDmX2soIgw/6e087Dt/1ZHUdRNwMgopwCjRTg="
+	salt := []byte("saltsaltsaltsalt")
+	argon := "$argon2id$v=19$m=4096,t=3,p=2$" + base64.RawStdEncoding.EncodeToString(salt) + "$" +
+		base64.RawStdEncoding.EncodeToString(argon2.IDKey([]byte("secret"), salt, 3, 4096, 2, 32))
+
+	old := goAuthSaltUTF8
+	t.Cleanup(func() { goAuthSaltUTF8 = old })
+
+	goAuthSaltUTF8 = false
+	if ok, weak := verifyPassword(pbkdf2SHA512, "", "secret"); !ok || weak != "" {
+		t.Errorf("pbkdf2 sha512 = %t, %q", ok, weak)
+	}
+	if ok, _ := verifyPassword(pbkdf2SHA512, "", "wrong"); ok {
+		t.Error("wrong password matched")
+	}
+	if ok, _ := verifyPassword(argon, "", "secret"); !ok {
+		t.Error("argon2id did not match")
+	}
+	if ok, _ := verifyPassword(argon, "", "wrong"); ok {
+		t.Error("argon2id matched a wrong password")
+	}
+	if ok, _ := verifyPassword(pbkdf2UTF8, "", "secret"); ok {
+		t.Error("a utf-8 salt should not decode as base64")
+	}
+
+	goAuthSaltUTF8 = true
+	if ok, weak := verifyPassword(pbkdf2UTF8, "", "secret"); !ok || !strings.Contains(weak, "1000 iterations") {
+		t.Errorf("pbkdf2 sha256 utf-8 salt = %t, %q; want a weak match", ok, weak)
+	}
+	for _, bad := range []string{"PBKDF2$md5$1000$c2FsdA==$aGFzaA==", "PBKDF2$sha256$x$a$b", "$argon2id$v=16$m=1,t=1,p=1$a$b"} {
+		if ok, _ := verifyPassword(bad, "", "secret"); ok {
+			t.Errorf("%q should not verify", bad)
+		}
+	}
+}
+
+func TestGoAuthDSN(t *testing.T) {
+	oldHost, oldUser, oldPass, oldDB := goAuthHost, goAuthUser, goAuthPassword, goAuthDBName
+	t.Cleanup(func() { goAuthHost, goAuthUser, goAuthPassword, goAuthDBName = oldHost, oldUser, oldPass, oldDB })
+
+	goAuthHost, goAuthUser, goAuthPassword, goAuthDBName = "", "go_auth", `it's secret`, "mqtt"
+	want := `host=localhost port=5432 user=go_auth password='it\'s secret' dbname=mqtt sslmode=disable`
+	if got := goAuthDSN(); got != want {
+		t.Errorf("goAuthDSN = %q, want %q", got, want)
+	}
+	cfg, err := primary.poolConfigFor(goAuthDSN(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.ConnConfig.Password != "it's secret" || cfg.ConnConfig.Database != "mqtt" {
+		t.Errorf("parsed DSN = %+v", cfg.ConnConfig)
+	}
+}
+
+func TestValidateGoAuthOptions(t *testing.T) {
+	oldMode, oldQuery := compatMode, goAuthUserQuery
+	t.Cleanup(func() { compatMode, goAuthUserQuery = oldMode, oldQuery })
+
+	compatMode, goAuthUserQuery = "", ""
+	if problems := strings.Join(validateOptions(primary, map[string]bool{"pg_userquery": true}), "; "); !strings.Contains(problems, "pg_userquery is a mosquitto-go-auth option") {
+		t.Errorf("validateOptions = %q", problems)
+	}
+	compatMode = compatGoAuth
+	problems := strings.Join(validateOptions(primary, map[string]bool{"compat": true, "enforce_bind": true, "pg_dsn": true, "pg_host": true}), "; ")
+	for _, want := range []string{"needs pg_userquery", "enforce_bind has no effect", "pg_host is ignored"} {
+		if !strings.Contains(problems, want) {
+			t.Errorf("validateOptions = %q, want %q", problems, want)
+		}
+	}
+	goAuthUserQuery = "SELECT password_hash FROM test_user WHERE username = $1 LIMIT 1"
+	if problems := validateOptions(primary, map[string]bool{"compat": true, "pg_userquery": true, "pg_host": true, "hasher": true}); len(problems) != 0 {
+		t.Errorf("validateOptions = %v, want none", problems)
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"hash"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// mosquitto-go-auth 生成的哈希格式（bcrypt 与本插件相同）：
+//   PBKDF2$<sha256|sha512>$<iterations>$<salt>$<hash>  盐默认 base64，hasher_salt_encoding utf-8 时为原文
+//   $argon2id$v=19$m=<KiB>,t=<time>,p=<threads>$<salt>$<hash>  盐与哈希为无填充 base64
+// 哈希长度按存储的值推算，与 go-auth 一致。PBKDF2 迭代次数低于 minGoAuthIterations 时按弱哈希计。
+
+const minGoAuthIterations = 10000
+
+var goAuthSaltUTF8 bool // hasher_salt_encoding utf-8
+
+func isGoAuthHash(hash string) bool {
+	return strings.HasPrefix(hash, "PBKDF2$") || strings.HasPrefix(hash, "$argon2id$")
+}
+
+// verifyGoAuthHash 返回是否匹配与弱哈希原因；格式错误视为不匹配。
+func verifyGoAuthHash(stored, password string) (ok bool, weak string) {
+	if strings.HasPrefix(stored, "$argon2id$") {
+		return verifyArgon2id(stored, password), ""
+	}
+	parts := strings.Split(stored, "$")
+	if len(parts) != 5 {
+		return false, ""
+	}
+	var h func() hash.Hash
+	switch parts[1] {
+	case "sha256":
+		h = sha256.New
+	case "sha512":
+		h = sha512.New
+	default:
+		return false, ""
+	}
+	iter, err := strconv.Atoi(parts[2])
+	if err != nil || iter < 1 {
+		return false, ""
+	}
+	salt := []byte(parts[3])
+	if !goAuthSaltUTF8 {
+		if salt, err = base64.StdEncoding.DecodeString(parts[3]); err != nil {
+			return false, ""
+		}
+	}
+	want, err := base64.StdEncoding.DecodeString(parts[4])
+	if err != nil || len(want) == 0 {
+		return false, ""
+	}
+	got := pbkdf2.Key([]byte(password), salt, iter, len(want), h)
+	if subtle.ConstantTimeCompare(got, want) != 1 {
+		return false, ""
+	}
+	if iter < minGoAuthIterations {
+		return true, fmt.Sprintf("pbkdf2 with %d iterations", iter)
+	}
+	return true, ""
+}
+
+func verifyArgon2id(stored, password string) bool {
+	parts := strings.Split(stored, "$")
+	if len(parts) != 6 || parts[2] != "v=19" {
+		return false
+	}
+	var mem, t uint32
+	var threads uint8
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &mem, &t, &threads); err != nil || t == 0 || threads == 0 {
+		return false
+	}
+	salt, err1 := base64.RawStdEncoding.DecodeString(parts[4])
+	want, err2 := base64.RawStdEncoding.DecodeString(parts[5])
+	if err1 != nil || err2 != nil || len(want) == 0 {
+		return false
+	}
+	got := argon2.IDKey([]byte(password), salt, t, mem, threads, uint32(len(want)))
+	return subtle.ConstantTimeCompare(got, want) == 1
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"strings"
+)
+
+// Go 运行时调优：插件的 Go 运行时与 mosquitto 共用一个进程，GC 只看得到 Go 堆，堆按 GOGC 翻倍增长时
+// 会和 broker 自己的内存（会话、保留消息、队列）争抢容器的内存上限。
+//   - go_memory_limit：软内存上限（同 GOMEMLIMIT），接近时 GC 更频繁地回收；
+//   - go_gc_percent：同 GOGC，off 表示只按 go_memory_limit 回收；
+//   - go_memory_ballast：启动时分配一块不使用的内存，抬高 GC 的触发点，减少小堆时的 GC 次数。
+//     没有写入的页不会驻留物理内存；设置了 go_memory_limit 时通常不需要。
+// 未设置的选项保持运行时的默认值（即 broker 进程的 GOMEMLIMIT/GOGC 环境变量）。Cleanup 时恢复原值。
+
+const gcPercentUnset = math.MinInt // go_gc_percent 未设置
+
+var (
+	goMemoryLimit   int64 // 字节，0 表示不设置
+	goGCPercent     = gcPercentUnset
+	goMemoryBallast int64 // 字节
+
+	ballast []byte
+
+	prevMemoryLimit int64 = -1 // -1 表示没有改动过
+	prevGCPercent         = gcPercentUnset
+)
+
+var sizeUnits = []struct {
+	suffix string
+	mult   int64
+}{
+	{"TiB", 1 << 40}, {"GiB", 1 << 30}, {"MiB", 1 << 20}, {"KiB", 1 << 10}, {"B", 1},
+}
+
+// parseByteSize 接受 GOMEMLIMIT 的写法：字节数，可带 B、KiB、MiB、GiB、TiB 后缀；off 等同 0。
+func parseByteSize(v string) (int64, error) {
+	v = strings.TrimSpace(v)
+	if strings.EqualFold(v, "off") || v == "" {
+		return 0, nil
+	}
+	num, mult := v, int64(1)
+	for _, u := range sizeUnits {
+		if n, ok := strings.CutSuffix(v, u.suffix); ok {
+			num, mult = strings.TrimSpace(n), u.mult
+			break
+		}
+	}
+	n, err := strconv.ParseInt(num, 10, 64)
+	if err != nil || n < 0 || n > math.MaxInt64/mult {
+		return 0, fmt.Errorf("want a size such as 512MiB or 2GiB, got %q", v)
+	}
+	return n * mult, nil
+}
+
+func parseGCPercent(v string) (int, error) {
+	v = strings.TrimSpace(v)
+	if strings.EqualFold(v, "off") {
+		return -1, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < -1 {
+		return 0, fmt.Errorf("want a percentage >= 0 or off, got %q", v)
+	}
+	return n, nil
+}
+
+// startGoTuning 应用运行时选项；只由 primary 在 Init 中调用。
+func startGoTuning() {
+	if goMemoryLimit > 0 {
+		prevMemoryLimit = debug.SetMemoryLimit(goMemoryLimit)
+	}
+	if goGCPercent != gcPercentUnset {
+		prevGCPercent = debug.SetGCPercent(goGCPercent)
+	}
+	if goMemoryBallast > 0 {
+		ballast = make([]byte, goMemoryBallast)
+	}
+	if goMemoryLimit > 0 || goGCPercent != gcPercentUnset || goMemoryBallast > 0 {
+		mosqLog(logInfo, "auth-plugin: go runtime memory_limit=%d gc_percent=%s ballast=%d",
+			debug.SetMemoryLimit(-1), formatGCPercent(currentGCPercent()), len(ballast))
+	}
+}
+
+// stopGoTuning 恢复 startGoTuning 之前的设置并释放 ballast，插件卸载后不影响进程里的其他 Go 代码。
+func stopGoTuning() {
+	if prevMemoryLimit >= 0 {
+		debug.SetMemoryLimit(prevMemoryLimit)
+		prevMemoryLimit = -1
+	}
+	if prevGCPercent != gcPercentUnset {
+		debug.SetGCPercent(prevGCPercent)
+		prevGCPercent = gcPercentUnset
+	}
+	ballast = nil
+}
+
+// currentGCPercent 读取当前的 GOGC（SetGCPercent 没有只读的形式，设置后立即恢复）。
+func currentGCPercent() int {
+	n := debug.SetGCPercent(100)
+	debug.SetGCPercent(n)
+	return n
+}
+
+func formatGCPercent(n int) string {
+	if n < 0 {
+		return "off"
+	}
+	return strconv.Itoa(n)
+}
+
+// goRuntimeStatus 是 getStatus 中的 go_runtime。
+func goRuntimeStatus() map[string]any {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	return map[string]any{
+		"memory_limit_bytes": debug.SetMemoryLimit(-1),
+		"gc_percent":         formatGCPercent(currentGCPercent()),
+		"ballast_bytes":      len(ballast),
+		"heap_alloc_bytes":   ms.HeapAlloc,
+		"heap_sys_bytes":     ms.HeapSys,
+		"num_gc":             ms.NumGC,
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"runtime/debug"
+	"strings"
+	"testing"
+)
+
+func TestParseByteSize(t *testing.T) {
+	t.Parallel()
+	for in, want := range map[string]int64{
+		"":       0,
+		"off":    0,
+		"1024":   1024,
+		"512MiB": 512 << 20,
+		"2 GiB":  2 << 30,
+		"64KiB":  64 << 10,
+		" 100B ": 100,
+		"1TiB":   1 << 40,
+	} {
+		if got, err := parseByteSize(in); err != nil || got != want {
+			t.Errorf("parseByteSize(%q) = %d, %v; want %d", in, got, err, want)
+		}
+	}
+	for _, bad := range []string{"512MB", "-1", "1.5GiB", "lots", "99999999999TiB"} {
+		if _, err := parseByteSize(bad); err == nil {
+			t.Errorf("parseByteSize(%q) should fail", bad)
+		}
+	}
+	if n, err := parseGCPercent("off"); err != nil || n != -1 {
+		t.Fatalf("parseGCPercent(off) = %d, %v", n, err)
+	}
+	if _, err := parseGCPercent("-2"); err == nil {
+		t.Fatal("parseGCPercent(-2) should fail")
+	}
+}
+
+func TestGoTuningRestores(t *testing.T) {
+	oldLimit, oldGC, oldBallast := goMemoryLimit, goGCPercent, goMemoryBallast
+	t.Cleanup(func() { goMemoryLimit, goGCPercent, goMemoryBallast = oldLimit, oldGC, oldBallast })
+
+	limit, gc := debug.SetMemoryLimit(-1), currentGCPercent()
+	goMemoryLimit, goGCPercent, goMemoryBallast = 1<<40, gc+17, 1<<20
+	startGoTuning()
+	st := goRuntimeStatus()
+	if st["memory_limit_bytes"] != int64(1<<40) || st["ballast_bytes"] != 1<<20 || st["gc_percent"] != formatGCPercent(gc+17) {
+		t.Fatalf("go_runtime after start = %v", st)
+	}
+	stopGoTuning()
+	if debug.SetMemoryLimit(-1) != limit || currentGCPercent() != gc || ballast != nil {
+		t.Fatal("stopGoTuning must restore the previous runtime settings")
+	}
+}
+
+func TestGoTuningProblems(t *testing.T) {
+	oldLimit, oldGC := goMemoryLimit, goGCPercent
+	t.Cleanup(func() { goMemoryLimit, goGCPercent = oldLimit, oldGC })
+
+	goMemoryLimit, goGCPercent = 0, -1
+	if problems := strings.Join(validateOptions(primary, nil), "; "); !strings.Contains(problems, "grow without bound") {
+		t.Fatalf("validateOptions = %q", problems)
+	}
+}
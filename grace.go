@@ -0,0 +1,113 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 宽限模式：PG 不可用时，只放行最近 auth_grace_minutes 分钟内成功校验过的
+// username/clientid/password 组合，介于 fail_open_auth 的全放与全拒之间。
+// 缓存只保存加了进程内随机盐的 SHA-256 摘要，不保存明文密码。
+
+// graceMaxEntries 限制缓存大小；超过时先清理过期项，仍超过则不再记录新客户端。
+const graceMaxEntries = 100000
+
+var authGrace time.Duration
+
+type graceEntry struct {
+	digest     [sha256.Size]byte
+	verifiedAt time.Time
+}
+
+type graceCache struct {
+	mu      sync.Mutex
+	salt    [16]byte
+	entries map[string]graceEntry
+	now     func() time.Time
+}
+
+var recentAuth = newGraceCache()
+
+func newGraceCache() *graceCache {
+	c := &graceCache{entries: map[string]graceEntry{}, now: time.Now}
+	rand.Read(c.salt[:])
+	return c
+}
+
+func (c *graceCache) digest(username, clientID, password string) [sha256.Size]byte {
+	h := sha256.New()
+	h.Write(c.salt[:])
+	for _, s := range []string{username, clientID, password} {
+		h.Write([]byte(s))
+		h.Write([]byte{0})
+	}
+	var d [sha256.Size]byte
+	copy(d[:], h.Sum(nil))
+	return d
+}
+
+// remember 记录一次成功的数据库校验。
+func (c *graceCache) remember(username, clientID, password string, window time.Duration) {
+	if window <= 0 {
+		return
+	}
+	key := username + "\x00" + clientID
+	now := c.now()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.entries[key]; !ok && len(c.entries) >= graceMaxEntries {
+		for k, e := range c.entries {
+			if now.Sub(e.verifiedAt) > window {
+				delete(c.entries, k)
+			}
+		}
+		if len(c.entries) >= graceMaxEntries {
+			return
+		}
+	}
+	c.entries[key] = graceEntry{digest: c.digest(username, clientID, password), verifiedAt: now}
+}
+
+// allow 判断凭据是否在 window 内成功校验过。
+func (c *graceCache) allow(username, clientID, password string, window time.Duration) bool {
+	if window <= 0 {
+		return false
+	}
+	key := username + "\x00" + clientID
+	c.mu.Lock()
+	e, ok := c.entries[key]
+	c.mu.Unlock()
+	if !ok || c.now().Sub(e.verifiedAt) > window {
+		return false
+	}
+	d := c.digest(username, clientID, password)
+	return subtle.ConstantTimeCompare(d[:], e.digest[:]) == 1
+}
+
+// forget 在数据库明确拒绝时移除记录，避免已吊销的凭据在故障期间复活。
+func (c *graceCache) forget(username, clientID string) {
+	c.mu.Lock()
+	delete(c.entries, username+"\x00"+clientID)
+	c.mu.Unlock()
+}
+
+// size 返回缓存条目数（含尚未清理的过期条目）。
+func (c *graceCache) size() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.entries)
+}
+
+func parseGraceMinutes(v string) (time.Duration, error) {
+	n, err := strconv.Atoi(strings.TrimSpace(v))
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("keeping existing value %d", int(authGrace/time.Minute))
+	}
+	return time.Duration(n) * time.Minute, nil
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGraceCache(t *testing.T) {
+	t.Parallel()
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := newGraceCache()
+	c.now = func() time.Time { return now }
+	window := 5 * time.Minute
+
+	c.remember("alice", "c1", "secret", window)
+	if !c.allow("alice", "c1", "secret", window) {
+		t.Fatal("recently verified credentials should be allowed")
+	}
+	if c.allow("alice", "c1", "wrong", window) {
+		t.Fatal("wrong password must not be allowed")
+	}
+	if c.allow("alice", "c2", "secret", window) {
+		t.Fatal("other client id must not be allowed")
+	}
+	if c.allow("alice", "c1", "secret", 0) {
+		t.Fatal("grace mode disabled must not allow")
+	}
+
+	now = now.Add(window + time.Second)
+	if c.allow("alice", "c1", "secret", window) {
+		t.Fatal("expired entry must not be allowed")
+	}
+
+	c.remember("bob", "c3", "pw", window)
+	c.forget("bob", "c3")
+	if c.allow("bob", "c3", "pw", window) {
+		t.Fatal("forgotten entry must not be allowed")
+	}
+}
+
+func TestParseGraceMinutes(t *testing.T) {
+	t.Parallel()
+	if d, err := parseGraceMinutes(" 15 "); err != nil || d != 15*time.Minute {
+		t.Fatalf("parseGraceMinutes = (%v, %v)", d, err)
+	}
+	for _, v := range []string{"-1", "abc", ""} {
+		if _, err := parseGraceMinutes(v); err == nil {
+			t.Fatalf("parseGraceMinutes(%q) should fail", v)
+		}
+	}
+}
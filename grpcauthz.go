@@ -0,0 +1,222 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+
+	"auth-plugin/internal/authzpb"
+)
+
+// db_driver=grpc：认证与 ACL 判定交给外部授权服务（proto/mosqauth/v1/authorizer.proto）。
+// 请求的 deadline 即 timeout_ms（或按端口的覆盖值），由 gRPC 传给服务端；服务端返回的错误
+// 与数据库错误一样走 fail_open_* / 宽限模式。健康探测使用标准 grpc.health.v1 服务，
+// 服务端未实现时视为可达。
+
+var (
+	grpcAddr     string // dns:///authz.internal:9000
+	grpcTLS      bool
+	grpcCAFile   string
+	grpcCertFile string
+	grpcKeyFile  string
+	grpcConns    = 2
+
+	grpcPool   *grpcClients
+	grpcPoolMu sync.Mutex
+)
+
+// grpcClients 是固定数量的 ClientConn，轮流使用：单个 HTTP/2 连接的并发流有上限，
+// 多个连接也能让 round_robin 把请求分到服务端的多个实例。
+type grpcClients struct {
+	conns []*grpc.ClientConn
+	next  atomic.Uint64
+}
+
+func (g *grpcClients) conn() *grpc.ClientConn {
+	return g.conns[g.next.Add(1)%uint64(len(g.conns))]
+}
+
+func (g *grpcClients) close() {
+	for _, c := range g.conns {
+		c.Close()
+	}
+}
+
+func grpcCredentials() (credentials.TransportCredentials, error) {
+	if !grpcTLS {
+		return insecure.NewCredentials(), nil
+	}
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+	if grpcCAFile != "" {
+		pem, err := os.ReadFile(grpcCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("read grpc_ca_file: %w", err)
+		}
+		cfg.RootCAs = x509.NewCertPool()
+		if !cfg.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("grpc_ca_file %s has no PEM certificates", grpcCAFile)
+		}
+	}
+	if grpcCertFile != "" || grpcKeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(grpcCertFile, grpcKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load grpc_cert_file/grpc_key_file: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return credentials.NewTLS(cfg), nil
+}
+
+// isLoopbackTarget 判断 gRPC 目标（host:port、dns:///host:port、unix:...）是否只在本机。
+func isLoopbackTarget(target string) bool {
+	if strings.HasPrefix(target, "unix:") {
+		return true
+	}
+	if _, rest, ok := strings.Cut(target, ":///"); ok {
+		target = rest
+	}
+	return isLoopbackAddr(target)
+}
+
+func dialGRPC(target string, n int, extra ...grpc.DialOption) (*grpcClients, error) {
+	creds, err := grpcCredentials()
+	if err != nil {
+		return nil, err
+	}
+	opts := append([]grpc.DialOption{
+		grpc.WithTransportCredentials(creds),
+		grpc.WithDefaultServiceConfig(`{"loadBalancingConfig":[{"round_robin":{}}]}`),
+		grpc.WithUserAgent("auth-plugin/" + version),
+	}, extra...)
+	g := &grpcClients{}
+	for i := 0; i < n; i++ {
+		// NewClient 不会立即连接，第一次调用时才建立连接
+		c, err := grpc.NewClient(target, opts...)
+		if err != nil {
+			g.close()
+			return nil, err
+		}
+		g.conns = append(g.conns, c)
+	}
+	return g, nil
+}
+
+func ensureGRPC() (*grpcClients, error) {
+	grpcPoolMu.Lock()
+	defer grpcPoolMu.Unlock()
+	if grpcPool != nil {
+		return grpcPool, nil
+	}
+	g, err := dialGRPC(grpcAddr, grpcConns)
+	if err != nil {
+		return nil, err
+	}
+	grpcPool = g
+	return g, nil
+}
+
+func closeGRPC() {
+	grpcPoolMu.Lock()
+	defer grpcPoolMu.Unlock()
+	if grpcPool != nil {
+		grpcPool.close()
+		grpcPool = nil
+	}
+}
+
+func grpcAuth(parent context.Context, g *grpcClients, req *authzpb.AuthenticateRequest, pol requestPolicy) (decision, error) {
+	if req.Username == "" || req.Password == "" {
+		return denied(reasonNoCredentials), nil
+	}
+	ctx, cancel := ctxWithTimeout(parent, pol.timeout)
+	defer cancel()
+	resp, err := authzpb.NewAuthorizerClient(g.conn()).Authenticate(ctx, req)
+	if err != nil {
+		return decision{}, fmt.Errorf("authorizer: %w", err)
+	}
+	if !resp.Allow && resp.Reason != "" {
+		mosqLog(logDebug, "auth-plugin: authorizer denied %s (conn %s): %s", redactID(req.Username), req.ConnId, resp.Reason)
+	}
+	return authorizerDecision(resp.Allow, resp.Reason), nil
+}
+
+func grpcACL(parent context.Context, g *grpcClients, req *authzpb.CheckACLRequest, pol requestPolicy) (decision, error) {
+	if req.Access == authzpb.Access(aclUnsubscribe) {
+		// 与数据库模式一致，取消订阅不受限
+		return allowed(reasonUnsubscribe), nil
+	}
+	ctx, cancel := ctxWithTimeout(parent, pol.timeout)
+	defer cancel()
+	resp, err := authzpb.NewAuthorizerClient(g.conn()).CheckACL(ctx, req)
+	if err != nil {
+		return decision{}, fmt.Errorf("authorizer: %w", err)
+	}
+	if !resp.Allow && resp.Reason != "" {
+		mosqLog(logDebug, "auth-plugin: authorizer denied %s on %s (conn %s): %s",
+			redactID(req.Username), req.Topic, req.ConnId, resp.Reason)
+	}
+	return authorizerDecision(resp.Allow, resp.Reason), nil
+}
+
+// authorizerDecision 把授权服务的回答转换为 decision，它给出的理由记在 rule 中。
+func authorizerDecision(allow bool, reason string) decision {
+	d := denied(reasonAuthorizer)
+	if allow {
+		d = allowed(reasonAuthorizer)
+	}
+	d.rule = reason
+	return d
+}
+
+// authorizerAuth / authorizerACL 是 grpc 后端在认证链中的一步，健康状态与取消订阅由 dbAuth/dbACL 处理。
+func authorizerAuth(ctx context.Context, username, password, clientID, address string, port int, pol requestPolicy) (decision, error) {
+	g, err := ensureGRPC()
+	if err != nil {
+		return decision{}, err
+	}
+	return grpcAuth(ctx, g, &authzpb.AuthenticateRequest{
+		Username: username, Password: password, ClientId: clientID, Address: address,
+		ListenerPort: int32(port), ConnId: connIDFrom(ctx),
+	}, pol)
+}
+
+func authorizerACL(ctx context.Context, username, clientID, topic string, access, port int, pol requestPolicy) (decision, error) {
+	g, err := ensureGRPC()
+	if err != nil {
+		return decision{}, err
+	}
+	return grpcACL(ctx, g, &authzpb.CheckACLRequest{
+		Username: username, ClientId: clientID, Topic: topic, Access: authzpb.Access(access),
+		ListenerPort: int32(port), ConnId: connIDFrom(ctx),
+	}, pol)
+}
+
+// pingGRPC 调用标准健康检查；服务端没有注册健康服务时能收到 Unimplemented，也说明服务可达。
+func pingGRPC(ctx context.Context) error {
+	g, err := ensureGRPC()
+	if err != nil {
+		return err
+	}
+	resp, err := healthpb.NewHealthClient(g.conn()).Check(ctx, &healthpb.HealthCheckRequest{Service: authzpb.Authorizer_ServiceDesc.ServiceName})
+	switch {
+	case status.Code(err) == codes.Unimplemented:
+		return nil
+	case err != nil:
+		return fmt.Errorf("authorizer: %w", err)
+	case resp.Status != healthpb.HealthCheckResponse_SERVING:
+		return fmt.Errorf("authorizer health is %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"auth-plugin/internal/authzpb"
+)
+
+type fakeAuthorizer struct {
+	authzpb.UnimplementedAuthorizerServer
+	deadline time.Duration
+	acls     int
+}
+
+func (f *fakeAuthorizer) Authenticate(ctx context.Context, req *authzpb.AuthenticateRequest) (*authzpb.AuthenticateResponse, error) {
+	if d, ok := ctx.Deadline(); ok {
+		f.deadline = time.Until(d)
+	}
+	if req.Username == "broken" {
+		return nil, status.Error(codes.Unavailable, "backend down")
+	}
+	return &authzpb.AuthenticateResponse{Allow: req.Username == "alice" && req.Password == "pw" && req.ListenerPort == 8883}, nil
+}
+
+func (f *fakeAuthorizer) CheckACL(_ context.Context, req *authzpb.CheckACLRequest) (*authzpb.CheckACLResponse, error) {
+	f.acls++
+	return &authzpb.CheckACLResponse{Allow: req.Access == authzpb.Access_ACCESS_READ && req.Topic == "devices/alice/up"}, nil
+}
+
+func startFakeAuthorizer(t *testing.T) (*fakeAuthorizer, *grpcClients) {
+	t.Helper()
+	lis := bufconn.Listen(1 << 16)
+	srv := grpc.NewServer()
+	fake := &fakeAuthorizer{}
+	authzpb.RegisterAuthorizerServer(srv, fake)
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	g, err := dialGRPC("passthrough:///bufnet", 2, grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+		return lis.DialContext(ctx)
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(g.close)
+	return fake, g
+}
+
+func TestGRPCAuthorizer(t *testing.T) {
+	t.Parallel()
+	fake, g := startFakeAuthorizer(t)
+	ctx := context.Background()
+	pol := requestPolicy{timeout: 800 * time.Millisecond}
+
+	d, err := grpcAuth(ctx, g, &authzpb.AuthenticateRequest{Username: "alice", Password: "pw", ListenerPort: 8883}, pol)
+	if err != nil || !d.allow || d.reason != reasonAuthorizer {
+		t.Fatalf("grpcAuth(alice) = %+v, %v", d, err)
+	}
+	if fake.deadline <= 0 || fake.deadline > pol.timeout {
+		t.Errorf("server saw deadline %s, want the %s request timeout propagated", fake.deadline, pol.timeout)
+	}
+	if d, _ := grpcAuth(ctx, g, &authzpb.AuthenticateRequest{Username: "alice", Password: "wrong", ListenerPort: 8883}, pol); d.allow {
+		t.Error("wrong password should be denied")
+	}
+	if _, err := grpcAuth(ctx, g, &authzpb.AuthenticateRequest{Username: "broken", Password: "pw"}, pol); status.Code(err) != codes.Unavailable {
+		t.Errorf("server error should surface as an error, got %v", err)
+	}
+
+	if d, err := grpcACL(ctx, g, &authzpb.CheckACLRequest{Username: "alice", Topic: "devices/alice/up", Access: authzpb.Access_ACCESS_READ}, pol); err != nil || !d.allow {
+		t.Errorf("grpcACL(read) = %+v, %v", d, err)
+	}
+	if d, _ := grpcACL(ctx, g, &authzpb.CheckACLRequest{Username: "alice", Topic: "devices/alice/up", Access: authzpb.Access_ACCESS_WRITE}, pol); d.allow {
+		t.Error("write should be denied")
+	}
+	if d, _ := grpcACL(ctx, g, &authzpb.CheckACLRequest{Username: "alice", Topic: "x", Access: authzpb.Access(aclUnsubscribe)}, pol); !d.allow || fake.acls != 2 {
+		t.Errorf("unsubscribe should be allowed locally without a call, calls=%d", fake.acls)
+	}
+}
+
+func TestIsLoopbackTarget(t *testing.T) {
+	t.Parallel()
+	for target, want := range map[string]bool{
+		"127.0.0.1:9000":            true,
+		"dns:///localhost:9000":     true,
+		"unix:///run/authz.sock":    true,
+		"dns:///authz.svc:9000":     false,
+		"passthrough:///10.0.0.1:1": false,
+	} {
+		if got := isLoopbackTarget(target); got != want {
+			t.Errorf("isLoopbackTarget(%q) = %t, want %t", target, got, want)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync/atomic"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"auth-plugin/internal/shacrypt"
+)
+
+// 存储的密码哈希：bcrypt（$2a$/$2b$/$2y$）、从 password_file 导入的 mosquitto 格式（见 mosqhash.go）、
+// 从 /etc/shadow 导入的 SHA-crypt（$5$/$6$，见 internal/shacrypt）、
+// mosquitto-go-auth 的 PBKDF2/argon2id（见 goauthhash.go）或旧的 sha256(password+salt) 十六进制。
+// weak_hash_policy 决定对低强度哈希（bcrypt cost < min_bcrypt_cost，或未标记迁移中的 sha256）
+// 的登录是放行、告警还是拒绝；weakHashLogins 计数用于推进哈希迁移。
+
+const (
+	weakHashAllow  = "allow"
+	weakHashWarn   = "warn"
+	weakHashReject = "reject"
+)
+
+var (
+	weakHashPolicy  = weakHashAllow
+	minBcryptCost   = bcrypt.DefaultCost
+	sha256Migration bool // sha256 哈希正在迁移，reject 模式下仍放行（但计为弱哈希）
+
+	weakHashLogins   atomic.Int64 // 使用弱哈希成功校验的次数
+	weakHashRejected atomic.Int64 // 因 reject 策略被拒绝的次数
+)
+
+func parseWeakHashPolicy(v string) (string, bool) {
+	switch p := strings.ToLower(strings.TrimSpace(v)); p {
+	case weakHashAllow, weakHashWarn, weakHashReject:
+		return p, true
+	}
+	return "", false
+}
+
+func isBcryptHash(hash string) bool {
+	return strings.HasPrefix(hash, "$2a$") || strings.HasPrefix(hash, "$2b$") || strings.HasPrefix(hash, "$2y$")
+}
+
+// verifyPassword 校验密码；weak 说明哈希低于强度要求的原因，空表示达标。
+func verifyPassword(hash, salt, password string) (ok bool, weak string) {
+	if isBcryptHash(hash) {
+		if bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) != nil {
+			return false, ""
+		}
+		if cost, err := bcrypt.Cost([]byte(hash)); err == nil && cost < minBcryptCost {
+			return true, fmt.Sprintf("bcrypt cost %d below %d", cost, minBcryptCost)
+		}
+		return true, ""
+	}
+	if p, ok := shacrypt.Parse(hash); ok {
+		if !shacrypt.Verify(hash, password) {
+			return false, ""
+		}
+		// 迭代次数远低于 bcrypt 的强度，与 mosquitto 格式一样按弱哈希计
+		return true, fmt.Sprintf("sha%s-crypt hash (%d rounds)", map[string]string{"5": "256", "6": "512"}[p.Variant], p.Rounds)
+	}
+	if isMosquittoHash(hash) {
+		if !verifyMosquittoHash(hash, password) {
+			return false, ""
+		}
+		return true, "mosquitto " + hash[:3] + " hash"
+	}
+	if isGoAuthHash(hash) {
+		return verifyGoAuthHash(hash, password)
+	}
+	if subtle.ConstantTimeCompare([]byte(hash), []byte(sha256PwdSalt(password, salt))) != 1 {
+		return false, ""
+	}
+	return true, "sha256 hash"
+}
+
+// weakHashAllowed 按策略决定弱哈希登录是否放行；sha256_migration 下 sha256 仍放行。
+func weakHashAllowed(hash string) bool {
+	if weakHashPolicy != weakHashReject {
+		return true
+	}
+	return !isBcryptHash(hash) && !isMosquittoHash(hash) && !shacrypt.Is(hash) && !isGoAuthHash(hash) && sha256Migration
+}
+
+func sha256PwdSalt(pwd, salt string) string {
+	sum := sha256.Sum256([]byte(pwd + salt))
+	return hex.EncodeToString(sum[:])
+}
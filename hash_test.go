@@ -0,0 +1,104 @@
+package main
+
+import (
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"auth-plugin/internal/pwhash"
+)
+
+const (
+	mosq7 = "$7$101$MDEyMzQ1Njc4OWFi$EO/lLlkeUgIiBaS8G8UK0ZMP1u508TA7Tl+AdJ1cEsmlbGyEPAERErpfq84j1kepISs0UzmcdL4ucgZ2uodxfQ=="
+	mosq6 = "$6$MDEyMzQ1Njc4OWFi$qEXipeLbgxRlwd06QHfY5WITkUZg0jLg9SZbXzq3ifXjfj+v3GbJGrSfC5PAg3UNCS+UFfbhUIZX4bmIAs330w=="
+
+	shaCrypt6 = "$6$saltstring$svn8UoSVapNtMuq1ukKS4tPQd8iKwSMHWjl/O817G3uBnIFNjnQJuesI68u4OTLiBFdcbYEdFCoEOfaS35inz1"
+)
+
+func TestVerifyPassword(t *testing.T) {
+	oldCost := minBcryptCost
+	t.Cleanup(func() { minBcryptCost = oldCost })
+	minBcryptCost = 10
+
+	weakBcrypt, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	strongBcrypt, err := bcrypt.GenerateFromPassword([]byte("secret"), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name, hash, salt, password string
+		ok, weak                   bool
+	}{
+		{"sha256", sha256PwdSalt("secret", "s1"), "s1", "secret", true, true},
+		{"sha256 wrong", sha256PwdSalt("secret", "s1"), "s1", "nope", false, false},
+		{"bcrypt low cost", string(weakBcrypt), "", "secret", true, true},
+		{"bcrypt", string(strongBcrypt), "", "secret", true, false},
+		{"bcrypt wrong", string(strongBcrypt), "", "nope", false, false},
+		// "secret" 按 mosquitto_passwd 的算法以固定盐生成（$7$ 为 2.x，$6$ 为 1.x）
+		{"mosquitto pbkdf2", mosq7, "", "secret", true, true},
+		{"mosquitto pbkdf2 wrong", mosq7, "", "nope", false, false},
+		{"mosquitto sha512", mosq6, "", "secret", true, true},
+		{"mosquitto sha512 wrong", mosq6, "", "nope", false, false},
+		{"mosquitto malformed", "$7$x$AAAA$AAAA", "", "secret", false, false},
+		// glibc crypt(3) 生成的 "Hello world!"
+		{"sha512-crypt", shaCrypt6, "", "Hello world!", true, true},
+		{"sha512-crypt wrong", shaCrypt6, "", "secret", false, false},
+		{"sha256-crypt", "$5$rounds=10000$saltstringsaltst$3xv.VbSHBb41AL9AvLeujZkZRBAwqFMz2.opqey6IcA", "", "Hello world!", true, true},
+	}
+	for _, tc := range tests {
+		ok, weak := verifyPassword(tc.hash, tc.salt, tc.password)
+		if ok != tc.ok || (weak != "") != tc.weak {
+			t.Fatalf("%s: verifyPassword = (%v, %q), want ok=%v weak=%v", tc.name, ok, weak, tc.ok, tc.weak)
+		}
+	}
+}
+
+func TestWeakHashAllowed(t *testing.T) {
+	oldPolicy, oldMigration := weakHashPolicy, sha256Migration
+	t.Cleanup(func() { weakHashPolicy, sha256Migration = oldPolicy, oldMigration })
+
+	sha, bc := sha256PwdSalt("secret", "s1"), "$2a$04$abcdefghijklmnopqrstuu"
+	weakHashPolicy, sha256Migration = weakHashWarn, false
+	if !weakHashAllowed(sha) || !weakHashAllowed(bc) {
+		t.Fatal("warn policy must allow weak hashes")
+	}
+	weakHashPolicy = weakHashReject
+	if weakHashAllowed(sha) || weakHashAllowed(bc) {
+		t.Fatal("reject policy must reject weak hashes")
+	}
+	sha256Migration = true
+	if !weakHashAllowed(sha) || weakHashAllowed(bc) || weakHashAllowed(mosq7) {
+		t.Fatal("sha256_migration must only exempt sha256 hashes")
+	}
+}
+
+// 每种 bcryptgen -algo 的输出都必须能登录
+func TestVerifyGeneratedHashes(t *testing.T) {
+	for _, p := range []pwhash.Params{
+		{Algo: "sha256", Salt: "salt"},
+		{Algo: "sha256-salt"},
+		{Algo: "bcrypt", Cost: bcrypt.MinCost},
+		{Algo: "argon2id", ArgonTime: 1, ArgonMemory: 64, ArgonThreads: 1},
+		{Algo: "pbkdf2", PBKDF2Iter: minGoAuthIterations, PBKDF2Hash: "sha256"},
+		{Algo: "pbkdf2", PBKDF2Iter: minGoAuthIterations, PBKDF2Hash: "sha512"},
+	} {
+		hf, err := pwhash.New(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		hash, salt, err := hf("s3cret")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ok, _ := verifyPassword(hash, salt, "s3cret"); !ok {
+			t.Errorf("%s %s: generated hash %q does not verify", p.Algo, p.PBKDF2Hash, hash)
+		}
+		if ok, _ := verifyPassword(hash, salt, "wrong"); ok {
+			t.Errorf("%s %s: wrong password accepted", p.Algo, p.PBKDF2Hash)
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// 数据库健康状态机：healthy -> degraded（出现连续失败）-> down（连续失败达到 health_down_after）。
+// down 状态下回调不再访问数据库，直接按 fail_open_* / 宽限模式处理，避免每个请求都等到超时；
+// 后台按 health_ping_interval 探测，Ping 成功即恢复 healthy。health_down_after=0 关闭状态机。
+
+type healthState int32
+
+const (
+	healthHealthy healthState = iota
+	healthDegraded
+	healthDown
+)
+
+func (s healthState) String() string {
+	switch s {
+	case healthDegraded:
+		return "degraded"
+	case healthDown:
+		return "down"
+	default:
+		return "healthy"
+	}
+}
+
+var errDatabaseDown = errors.New("database marked down by health check, not queried")
+
+var (
+	healthDownAfter    int
+	healthPingInterval = 5 * time.Second
+
+	health = &healthMachine{}
+
+	healthStop chan struct{}
+	healthDone chan struct{}
+)
+
+type healthMachine struct {
+	mu          sync.Mutex
+	state       healthState
+	consecutive int
+}
+
+// observe 根据一次数据库访问结果推进状态机，返回状态是否变化及新旧状态。
+func (h *healthMachine) observe(err error, downAfter int) (from, to healthState, changed bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	from = h.state
+	switch {
+	case err == nil:
+		h.consecutive = 0
+		h.state = healthHealthy
+	case downAfter <= 0:
+		h.consecutive++
+		h.state = healthDegraded
+	default:
+		h.consecutive++
+		if h.consecutive >= downAfter {
+			h.state = healthDown
+		} else if h.state != healthDown {
+			h.state = healthDegraded
+		}
+	}
+	return from, h.state, from != h.state
+}
+
+func (h *healthMachine) current() healthState {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.state
+}
+
+// databaseDown 为 true 时回调跳过数据库查询。
+func databaseDown() bool {
+	return healthDownAfter > 0 && health.current() == healthDown
+}
+
+func observeHealth(err error) {
+	if errors.Is(err, errDatabaseDown) {
+		return
+	}
+	from, to, changed := health.observe(err, healthDownAfter)
+	if !changed {
+		return
+	}
+	switch to {
+	case healthDown:
+		mosqLog(logErr, "auth-plugin: database health %s -> down after %d consecutive failures; applying fail policy without querying",
+			from, healthDownAfter)
+		raiseAlert("db_down", "database marked down after %d consecutive failures: %v", healthDownAfter, err)
+	case healthDegraded:
+		mosqLog(logWarning, "auth-plugin: database health %s -> degraded: %v", from, err)
+	default:
+		mosqLog(logNotice, "auth-plugin: database health %s -> healthy", from)
+	}
+}
+
+func pingDatabase() error {
+	ctx, cancel := ctxWithTimeout(context.Background(), primary.timeout.get())
+	defer cancel()
+	// 与请求一致：required 后端失败即不健康，其他后端只要有一个可用就算健康
+	chain := activeBackends()
+	var firstErr error
+	reachable := false
+	for _, b := range chain {
+		err := pingBackend(ctx, b.name)
+		if err == nil {
+			reachable = true
+			continue
+		}
+		if len(chain) > 1 {
+			err = fmt.Errorf("backend %s: %w", b.name, err)
+		}
+		if b.required {
+			return err
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	if reachable {
+		return nil
+	}
+	return firstErr
+}
+
+func pingBackend(ctx context.Context, name string) error {
+	if name == driverGRPC {
+		return pingGRPC(ctx)
+	}
+	st, err := openStore(ctx, primary, name)
+	if err != nil {
+		return err
+	}
+	return st.ping(ctx)
+}
+
+func startHealthChecks() {
+	if healthDownAfter <= 0 {
+		return
+	}
+	stop, done := make(chan struct{}), make(chan struct{})
+	healthStop, healthDone = stop, done
+	go func() {
+		defer close(done)
+		t := time.NewTicker(healthPingInterval)
+		defer t.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-t.C:
+				err := pingDatabase()
+				recordDBResult(err)
+				refreshFallback()
+			}
+		}
+	}()
+}
+
+func stopHealthChecks() {
+	if healthStop == nil {
+		return
+	}
+	close(healthStop)
+	<-healthDone
+	healthStop, healthDone = nil, nil
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestHealthMachine(t *testing.T) {
+	t.Parallel()
+	h := &healthMachine{}
+	fail := errors.New("timeout")
+
+	steps := []struct {
+		err  error
+		want healthState
+	}{
+		{fail, healthDegraded},
+		{fail, healthDegraded},
+		{fail, healthDown},
+		{fail, healthDown},
+		{nil, healthHealthy},
+		{fail, healthDegraded},
+		{nil, healthHealthy},
+	}
+	for i, st := range steps {
+		if _, got, _ := h.observe(st.err, 3); got != st.want {
+			t.Fatalf("step %d: state = %s, want %s", i, got, st.want)
+		}
+	}
+
+	// health_down_after=0：只区分 healthy / degraded，从不进入 down
+	h = &healthMachine{}
+	for i := 0; i < 10; i++ {
+		h.observe(fail, 0)
+	}
+	if got := h.current(); got != healthDegraded {
+		t.Fatalf("state without down threshold = %s, want degraded", got)
+	}
+}
+
+// 不查询数据库就得出的结论（空凭据、取消订阅）不更新健康状态。
+func TestHealthIgnoresUnqueriedDecisions(t *testing.T) {
+	var calls int
+	useFakeBackends(t, "postgres", map[string]fakeBackend{driverPostgres: {topics: map[string]bool{"t": true}, calls: &calls}})
+	oldHealth, oldHealthy := health, dbHealthy.Load()
+	t.Cleanup(func() {
+		health = oldHealth
+		dbHealthy.Store(oldHealthy)
+	})
+	health = &healthMachine{}
+	health.observe(errors.New("timeout"), 0)
+	dbHealthy.Store(false)
+
+	ctx, pol := context.Background(), primary.defaultPolicy()
+	dbAuth(ctx, primary, "", "pw", "c1", "", 0, pol)
+	dbACL(ctx, primary, "u", "c1", "t", aclUnsubscribe, 0, pol)
+	if got := health.current(); got != healthDegraded || dbHealthy.Load() || calls != 0 {
+		t.Fatalf("decisions without a query changed health to %s (db_up %t)", got, dbHealthy.Load())
+	}
+	if d, err := dbACL(ctx, primary, "u", "c1", "t", aclRead, 0, pol); !d.allow || err != nil {
+		t.Fatalf("dbACL = %+v, %v", d, err)
+	}
+	if got := health.current(); got != healthHealthy || !dbHealthy.Load() {
+		t.Fatalf("a successful query left health %s (db_up %t)", got, dbHealthy.Load())
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"auth-plugin/pkg/mosqplugin"
+)
+
+func TestInstances(t *testing.T) {
+	ha, hb := &mosqplugin.Handle{}, &mosqplugin.Handle{}
+	a, b := addInstance(ha), addInstance(hb)
+	if a == nil || b == nil || a.slot == 0 || a.slot == b.slot {
+		t.Fatalf("addInstance slots: %+v, %+v", a, b)
+	}
+	t.Cleanup(func() { removeInstance(a); removeInstance(b) })
+	if instanceFor(ha) != a || instanceFor(hb) != b {
+		t.Fatal("instanceFor does not map the handle back to the instance")
+	}
+	if instanceFor(nil) != primary || instanceFor(&mosqplugin.Handle{}) != primary {
+		t.Fatal("unknown handles belong to the primary instance")
+	}
+	removeInstance(b)
+	if instanceFor(hb) != primary {
+		t.Fatal("a removed instance should fall back to primary")
+	}
+	removeInstance(primary)
+	if instanceFor(nil) != primary {
+		t.Fatal("primary must never be removed")
+	}
+}
+
+func TestInstanceOptions(t *testing.T) {
+	in := newInstance(1)
+	if err := applyOption(in, "pg_dsn", "postgres://u@db2/iot"); err != nil || in.pgDSN != "postgres://u@db2/iot" {
+		t.Fatalf("pg_dsn: %v, %q", err, in.pgDSN)
+	}
+	if err := applyOption(in, "fail_open", "true"); err != nil || !in.failOpenAuth || !in.failOpenACL {
+		t.Fatalf("fail_open: %v", err)
+	}
+	if primary.failOpenAuth || primary.pgDSN == in.pgDSN {
+		t.Fatal("instance options leaked into primary")
+	}
+	for _, k := range []string{"redis_url", "listener_1883.timeout_ms"} {
+		if err := applyOption(in, k, "1"); err == nil || !strings.Contains(err.Error(), "first plugin instance") {
+			t.Errorf("applyOption(%s) on a second instance = %v, want process-wide error", k, err)
+		}
+	}
+	if configuredOptions["pg_dsn"] == in.pgDSN {
+		t.Fatal("options of other instances must not be recorded as the primary configuration")
+	}
+
+	in.timeout.set(2 * maxTimeout)
+	in.disableBasicAuth, in.enableACLCheck = true, false
+	if problems := validateOptions(in, map[string]bool{"pg_dsn": true}); len(problems) != 2 {
+		t.Fatalf("validateOptions(instance) = %v, want timeout and nothing-checked problems", problems)
+	}
+}
+
+func TestInstancePolicyIgnoresListenerOverrides(t *testing.T) {
+	oldOverrides := listenerOverrides
+	t.Cleanup(func() { listenerOverrides = oldOverrides })
+	listenerOverrides = map[int]map[string]string{1883: {"timeout_ms": "300"}}
+
+	in := newInstance(1)
+	if p := in.policyForPort(1883); p.timeout != 1500*time.Millisecond {
+		t.Fatalf("policyForPort(1883) = %+v, want the instance's own timeout", p)
+	}
+}
+
+// health 与 db_up 描述 primary 的数据库：另一个实例的连接池连不上时不能把 primary 标记为故障。
+func TestInstanceHealthIsolated(t *testing.T) {
+	var calls int
+	useFakeBackends(t, "postgres", map[string]fakeBackend{driverPostgres: {users: map[string]bool{"alice": true}, calls: &calls}})
+	oldHealth, oldHealthy := health, dbHealthy.Load()
+	t.Cleanup(func() {
+		health = oldHealth
+		dbHealthy.Store(oldHealthy)
+	})
+	health = &healthMachine{}
+	dbHealthy.Store(true)
+
+	down := addInstance(&mosqplugin.Handle{})
+	t.Cleanup(func() {
+		down.closeBackends()
+		removeInstance(down)
+	})
+	down.pgDSN = "postgres://127.0.0.1:1/x"
+	down.timeout.set(time.Second)
+	ctx, pol := context.Background(), down.defaultPolicy()
+	if _, err := dbAuth(ctx, down, "alice", "pw", "c1", "", 0, pol); err == nil {
+		t.Fatal("dbAuth on an instance whose database is down must fail")
+	}
+	if _, err := dbACL(ctx, down, "alice", "c1", "t", aclRead, 0, pol); err == nil {
+		t.Fatal("dbACL on an instance whose database is down must fail")
+	}
+	if got := health.current(); got != healthHealthy || !dbHealthy.Load() {
+		t.Fatalf("a failing second instance changed primary health to %s (db_up %t)", got, dbHealthy.Load())
+	}
+
+	if d, err := dbAuth(ctx, primary, "alice", "pw", "c1", "", 0, primary.defaultPolicy()); !d.allow || err != nil || calls != 1 {
+		t.Fatalf("primary dbAuth = %+v, %v", d, err)
+	}
+}
@@ -0,0 +1,98 @@
+package aclrule
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// mosquitto acl_file：
+//   user <username>                    之后的 topic 行属于该用户
+//   topic [read|write|readwrite|deny] <topic>
+//   pattern [read|write|readwrite|deny] <pattern>  对所有用户生效，%u/%c 为用户名/客户端 ID
+// 映射到 acls：pattern 行写入全局用户 '*'，%u/%c 换成 {username}/{clientid}；read 同时授予订阅，
+// 与 mosquitto 用 read 规则检查订阅一致。插件没有匿名用户也没有 deny 规则，这两类行跳过并告警。
+
+// FileRule 是 acl_file 中的一条规则，Username 为 '*' 表示 pattern 行（对所有用户生效）。
+type FileRule struct {
+	Username string
+	Rule
+}
+
+var fileAccess = map[string]int{
+	"read":      Read | Subscribe,
+	"write":     Write,
+	"readwrite": Read | Write | Subscribe,
+}
+
+// splitFileAccess 拆出可选的访问类型；省略时为 readwrite。主题本身可以包含空格。
+func splitFileAccess(rest string) (string, string) {
+	first, topic, ok := strings.Cut(rest, " ")
+	switch first {
+	case "read", "write", "readwrite", "deny":
+		if ok {
+			return first, strings.TrimSpace(topic)
+		}
+	}
+	return "readwrite", rest
+}
+
+// ParseFile 解析 mosquitto acl_file，无法表达的行跳过并通过 warn 告警。
+func ParseFile(r io.Reader, warn func(string)) ([]FileRule, error) {
+	var out []FileRule
+	index := map[[2]string]int{} // (username, pattern) -> out 下标，重复行合并权限
+	user := ""
+	inUser := false
+	sc := bufio.NewScanner(r)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		kw, rest, _ := strings.Cut(line, " ")
+		rest = strings.TrimSpace(rest)
+		var username, pattern string
+		switch kw {
+		case "user":
+			if rest == "" {
+				warn(fmt.Sprintf("acl_file line %d: user without a name, skipped", n))
+				continue
+			}
+			user, inUser = rest, true
+			continue
+		case "topic":
+			if !inUser {
+				warn(fmt.Sprintf("acl_file line %d: topic rule for anonymous clients skipped (the plugin has no anonymous access)", n))
+				continue
+			}
+			username = user
+		case "pattern":
+			username = "*"
+		default:
+			warn(fmt.Sprintf("acl_file line %d: unknown keyword %q, skipped", n, kw))
+			continue
+		}
+		access, topic := splitFileAccess(rest)
+		if access == "deny" {
+			warn(fmt.Sprintf("acl_file line %d: deny rules cannot be expressed in acls (access is allow-only), skipped", n))
+			continue
+		}
+		pattern = topic
+		if kw == "pattern" {
+			pattern = strings.NewReplacer("%u", "{username}", "%c", "{clientid}").Replace(topic)
+		}
+		if err := ValidatePattern(pattern); err != nil {
+			warn(fmt.Sprintf("acl_file line %d: %v, skipped", n, err))
+			continue
+		}
+		key := [2]string{username, pattern}
+		if i, dup := index[key]; dup {
+			out[i].Acc |= fileAccess[access]
+			continue
+		}
+		index[key] = len(out)
+		out = append(out, FileRule{username, Rule{Pattern: pattern, Acc: fileAccess[access]}})
+	}
+	return out, sc.Err()
+}
@@ -0,0 +1,135 @@
+// Package aclrule 是 acls 表规则的匹配与校验，以及 mosquitto acl_file 的解析，
+// 插件和命令行工具（useradm、aclsim、sync、import）共用，保证写进表里的规则和插件运行时的判定一致。
+//
+// 规则：username 为具体用户或 '*'（全局），pattern 支持 +/# 通配以及
+// {username}/{clientid} 占位符，acc 为位掩码 1=read 2=write 4=subscribe。
+// 主题匹配本身在 pkg/topicmatch。
+package aclrule
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"auth-plugin/pkg/topicmatch"
+)
+
+const (
+	Read        = 0x01
+	Write       = 0x02
+	Subscribe   = 0x04
+	Unsubscribe = 0x08
+
+	// StoredAccess 是 acls.acc 中有意义的位；取消订阅不受限，不存表。
+	StoredAccess = Read | Write | Subscribe
+)
+
+type Rule struct {
+	Pattern string
+	Acc     int
+}
+
+var placeholders = []string{"{username}", "{clientid}"}
+
+// Expand 替换占位符；占位符对应的值为空或含通配/分隔符时返回 false，
+// 防止 clientid 为 "#" 之类的值把规则放大成任意主题。
+func Expand(pattern, username, clientID string) (string, bool) {
+	for _, ph := range []struct{ key, val string }{
+		{placeholders[0], username},
+		{placeholders[1], clientID},
+	} {
+		if !strings.Contains(pattern, ph.key) {
+			continue
+		}
+		if ph.val == "" || strings.ContainsAny(ph.val, "+#/") {
+			return "", false
+		}
+		pattern = strings.ReplaceAll(pattern, ph.key, ph.val)
+	}
+	return pattern, true
+}
+
+// Find 返回第一条允许本次访问的规则。
+func Find(rules []Rule, username, clientID, topic string, access int) (Rule, bool) {
+	for _, r := range rules {
+		if r.Acc&access == 0 {
+			continue
+		}
+		pattern, ok := Expand(r.Pattern, username, clientID)
+		if !ok {
+			continue
+		}
+		if topicmatch.Match(pattern, topic) {
+			return r, true
+		}
+	}
+	return Rule{}, false
+}
+
+// Allows 判断一组规则是否允许本次访问。
+func Allows(rules []Rule, username, clientID, topic string, access int) bool {
+	_, ok := Find(rules, username, clientID, topic, access)
+	return ok
+}
+
+// ValidatePattern 检查 pattern 能否作为规则写入 acls 表：合法的 MQTT 主题过滤器（见 topicmatch.ValidFilter），
+// 花括号只能用于已知占位符。
+func ValidatePattern(pattern string) error {
+	if err := topicmatch.ValidFilter(pattern); err != nil {
+		return fmt.Errorf("%w: %q", err, pattern)
+	}
+	rest := pattern
+	for _, ph := range placeholders {
+		rest = strings.ReplaceAll(rest, ph, "")
+	}
+	if strings.ContainsAny(rest, "{}") {
+		return fmt.Errorf("unknown placeholder in %q (only {username} and {clientid} are expanded)", pattern)
+	}
+	return nil
+}
+
+// ValidateAcc 检查 acc 位掩码。
+func ValidateAcc(acc int) error {
+	if acc <= 0 || acc&^StoredAccess != 0 {
+		return fmt.Errorf("access must combine read(1), write(2) and subscribe(4), got %d", acc)
+	}
+	return nil
+}
+
+// ParseAcc 接受位掩码数字，或 read/write/subscribe（可缩写为 r/w/s）用 ',' 或 '|' 连接。
+func ParseAcc(s string) (int, error) {
+	if n, err := strconv.Atoi(s); err == nil {
+		return n, ValidateAcc(n)
+	}
+	acc := 0
+	for _, f := range strings.FieldsFunc(strings.ToLower(s), func(r rune) bool { return r == ',' || r == '|' }) {
+		switch strings.TrimSpace(f) {
+		case "read", "r":
+			acc |= Read
+		case "write", "w":
+			acc |= Write
+		case "subscribe", "s":
+			acc |= Subscribe
+		default:
+			return 0, fmt.Errorf("unknown access %q (want read, write, subscribe or a bitmask)", f)
+		}
+	}
+	return acc, ValidateAcc(acc)
+}
+
+// FormatAcc 把位掩码显示为 read|write|subscribe，输出可以原样交给 ParseAcc。
+func FormatAcc(acc int) string {
+	var parts []string
+	for _, b := range []struct {
+		bit  int
+		name string
+	}{{Read, "read"}, {Write, "write"}, {Subscribe, "subscribe"}} {
+		if acc&b.bit != 0 {
+			parts = append(parts, b.name)
+		}
+	}
+	if len(parts) == 0 {
+		return fmt.Sprintf("none(%d)", acc)
+	}
+	return strings.Join(parts, "|")
+}
@@ -0,0 +1,73 @@
+package aclrule
+
+import "testing"
+
+func TestValidatePattern(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		pattern string
+		ok      bool
+	}{
+		{"devices/{username}/#", true},
+		{"devices/+/up", true},
+		{"#", true},
+		{"dev-{clientid}/state", true},
+		{"/leading/slash", true},
+		{"", false},
+		{"devices/#/up", false},
+		{"devices/a#", false},
+		{"devices/a+/up", false},
+		{"devices/{user}/up", false},
+		{"devices/{username/up", false},
+		{"bad\x00topic", false},
+		{"bad\xfftopic", false},
+	}
+	for _, tc := range tests {
+		if err := ValidatePattern(tc.pattern); (err == nil) != tc.ok {
+			t.Errorf("ValidatePattern(%q) = %v, want ok=%v", tc.pattern, err, tc.ok)
+		}
+	}
+}
+
+func TestValidateAcc(t *testing.T) {
+	t.Parallel()
+	for acc, ok := range map[int]bool{1: true, 3: true, 7: true, 0: false, 8: false, 9: false, -1: false} {
+		if err := ValidateAcc(acc); (err == nil) != ok {
+			t.Errorf("ValidateAcc(%d) = %v, want ok=%v", acc, err, ok)
+		}
+	}
+}
+
+func TestFind(t *testing.T) {
+	t.Parallel()
+	rules := []Rule{
+		{Pattern: "devices/{clientid}/#", Acc: Read},
+		{Pattern: "devices/+/up", Acc: Write},
+	}
+	if r, ok := Find(rules, "alice", "c1", "devices/c1/up", Write); !ok || r.Pattern != "devices/+/up" {
+		t.Fatalf("Find = %+v, %v", r, ok)
+	}
+	if r, ok := Find(rules, "alice", "c1", "devices/c1/up", Read); !ok || r.Pattern != "devices/{clientid}/#" {
+		t.Fatalf("Find = %+v, %v", r, ok)
+	}
+	if _, ok := Find(rules, "alice", "c1", "devices/c2/down", Read); ok {
+		t.Fatal("other client's topic should not match")
+	}
+}
+
+func TestParseAcc(t *testing.T) {
+	t.Parallel()
+	for in, want := range map[string]int{"r": Read, "read|subscribe": Read | Subscribe, "w, s": Write | Subscribe, "7": 7} {
+		if got, err := ParseAcc(in); err != nil || got != want {
+			t.Errorf("ParseAcc(%q) = %d, %v; want %d", in, got, err, want)
+		}
+	}
+	for _, in := range []string{"", "8", "publish", "r,x"} {
+		if _, err := ParseAcc(in); err == nil {
+			t.Errorf("ParseAcc(%q) should fail", in)
+		}
+	}
+	if got, err := ParseAcc(FormatAcc(Read | Write)); err != nil || got != Read|Write {
+		t.Errorf("FormatAcc output should parse back, got %d, %v", got, err)
+	}
+}
@@ -0,0 +1,51 @@
+// Package kafkasasl 把 SASL 机制名与用户名/密码转换为 franz-go 的认证机制，
+// 供插件的判定事件生产者与 kafkasync 共用，保证两边接受相同的写法。
+package kafkasasl
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/twmb/franz-go/pkg/sasl"
+	"github.com/twmb/franz-go/pkg/sasl/plain"
+	"github.com/twmb/franz-go/pkg/sasl/scram"
+)
+
+// Mechanisms 是支持的机制名；空串表示不使用 SASL。
+var Mechanisms = []string{"plain", "scram-sha-256", "scram-sha-512"}
+
+// Parse 规范化机制名（不区分大小写）。
+func Parse(v string) (string, bool) {
+	s := strings.ToLower(strings.TrimSpace(v))
+	if s == "" {
+		return "", true
+	}
+	for _, m := range Mechanisms {
+		if s == m {
+			return s, true
+		}
+	}
+	return "", false
+}
+
+// Mechanism 返回 name 对应的认证机制；name 为空时返回 nil。
+func Mechanism(name, user, pass string) (sasl.Mechanism, error) {
+	m, ok := Parse(name)
+	switch {
+	case !ok:
+		return nil, fmt.Errorf("unknown SASL mechanism %q, want %s", name, strings.Join(Mechanisms, ", "))
+	case m == "":
+		return nil, nil
+	case user == "":
+		return nil, errors.New("SASL " + m + " needs a username")
+	}
+	switch m {
+	case "plain":
+		return plain.Auth{User: user, Pass: pass}.AsMechanism(), nil
+	case "scram-sha-256":
+		return scram.Auth{User: user, Pass: pass}.AsSha256Mechanism(), nil
+	default:
+		return scram.Auth{User: user, Pass: pass}.AsSha512Mechanism(), nil
+	}
+}
@@ -0,0 +1,35 @@
+package kafkasasl
+
+import "testing"
+
+func TestParse(t *testing.T) {
+	for in, want := range map[string]string{"": "", " PLAIN ": "plain", "SCRAM-SHA-256": "scram-sha-256", "scram-sha-512": "scram-sha-512"} {
+		if got, ok := Parse(in); !ok || got != want {
+			t.Errorf("Parse(%q) = %q, %v; want %q", in, got, ok, want)
+		}
+	}
+	if _, ok := Parse("scram_sha_256"); ok {
+		t.Error("Parse accepted a misspelled mechanism")
+	}
+	if _, ok := Parse("gssapi"); ok {
+		t.Error("Parse accepted an unsupported mechanism")
+	}
+}
+
+func TestMechanism(t *testing.T) {
+	if m, err := Mechanism("", "", ""); m != nil || err != nil {
+		t.Fatalf("no mechanism = (%v, %v), want (nil, nil)", m, err)
+	}
+	for name, want := range map[string]string{"plain": "PLAIN", "scram-sha-256": "SCRAM-SHA-256", "SCRAM-SHA-512": "SCRAM-SHA-512"} {
+		m, err := Mechanism(name, "mqtt", "secret")
+		if err != nil || m.Name() != want {
+			t.Errorf("Mechanism(%s) = (%v, %v), want %s", name, m, err, want)
+		}
+	}
+	if _, err := Mechanism("plain", "", "secret"); err == nil {
+		t.Error("SASL without a username must be rejected")
+	}
+	if _, err := Mechanism("gssapi", "mqtt", "secret"); err == nil {
+		t.Error("unsupported mechanism must be rejected")
+	}
+}
@@ -0,0 +1,220 @@
+// Package migrations 内嵌插件所用表的版本化 DDL，由 cmd/migrate 执行。
+//
+// 文件名为 NNNN_name.up.sql / NNNN_name.down.sql，版本号连续递增；
+// 已执行的版本记录在 schema_migrations 表中，每个版本在独立事务里执行。
+package migrations
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+//go:embed sql/*.sql
+var files embed.FS
+
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// State 是某个版本在目标库中的状态；AppliedAt 为零值表示尚未执行。
+type State struct {
+	Migration
+	AppliedAt time.Time
+}
+
+func (s State) Applied() bool { return !s.AppliedAt.IsZero() }
+
+// All 返回按版本排序的全部内嵌迁移。
+func All() ([]Migration, error) {
+	return load(files, "sql")
+}
+
+func load(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+	byVersion := map[int]*Migration{}
+	for _, e := range entries {
+		name := e.Name()
+		base, dirn, ok := strings.Cut(strings.TrimSuffix(name, ".sql"), ".")
+		if !ok || (dirn != "up" && dirn != "down") {
+			return nil, fmt.Errorf("migration %s: want NNNN_name.up.sql or NNNN_name.down.sql", name)
+		}
+		num, label, _ := strings.Cut(base, "_")
+		v, err := strconv.Atoi(num)
+		if err != nil || v <= 0 {
+			return nil, fmt.Errorf("migration %s: bad version %q", name, num)
+		}
+		body, err := fs.ReadFile(fsys, path.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+		m := byVersion[v]
+		if m == nil {
+			m = &Migration{Version: v, Name: label}
+			byVersion[v] = m
+		} else if m.Name != label {
+			return nil, fmt.Errorf("migration %d has two names: %s and %s", v, m.Name, label)
+		}
+		if dirn == "up" {
+			m.Up = string(body)
+		} else {
+			m.Down = string(body)
+		}
+	}
+	out := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %04d_%s needs both up and down files", m.Version, m.Name)
+		}
+		out = append(out, *m)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Version < out[j].Version })
+	for i, m := range out {
+		if m.Version != i+1 {
+			return nil, fmt.Errorf("migration versions must be contiguous from 1, missing %d", i+1)
+		}
+	}
+	return out, nil
+}
+
+const (
+	createTable = `CREATE TABLE IF NOT EXISTS schema_migrations (
+  version    INTEGER PRIMARY KEY,
+  name       TEXT NOT NULL,
+  applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+)`
+	selectApplied = "SELECT version, applied_at FROM schema_migrations"
+	insertApplied = "INSERT INTO schema_migrations (version, name) VALUES ($1, $2)"
+	deleteApplied = "DELETE FROM schema_migrations WHERE version = $1"
+
+	// lockKey 是 pg_advisory_lock 的键，防止两个 migrate 同时执行
+	lockKey = 0x6d6f7371 // "mosq"
+)
+
+// VersionQuery 返回已执行的最高版本，没有 schema_migrations 表时为 0；只读，不会建表。
+// 供 waitfor 与插件检测库的版本。
+const VersionQuery = `SELECT CASE WHEN to_regclass('schema_migrations') IS NULL THEN 0
+  ELSE (SELECT coalesce(max(version), 0) FROM schema_migrations) END`
+
+// Latest 返回内嵌迁移的最高版本。
+func Latest() int {
+	all, err := All()
+	if err != nil || len(all) == 0 {
+		return 0
+	}
+	return all[len(all)-1].Version
+}
+
+// Status 返回每个内嵌版本的执行状态。
+func Status(ctx context.Context, conn *pgx.Conn) ([]State, error) {
+	all, err := All()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := conn.Exec(ctx, createTable); err != nil {
+		return nil, err
+	}
+	rows, err := conn.Query(ctx, selectApplied)
+	if err != nil {
+		return nil, err
+	}
+	applied := map[int]time.Time{}
+	var v int
+	var at time.Time
+	if _, err := pgx.ForEachRow(rows, []any{&v, &at}, func() error {
+		applied[v] = at
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	states := make([]State, len(all))
+	for i, m := range all {
+		states[i] = State{Migration: m, AppliedAt: applied[m.Version]}
+		delete(applied, m.Version)
+	}
+	for v := range applied {
+		// 库里记录了本二进制不认识的版本：通常是用更新的 migrate 执行过
+		return nil, fmt.Errorf("database is at migration %d, newer than this binary (latest %d)", v, len(all))
+	}
+	return states, nil
+}
+
+// Up 依次执行未执行的版本，直到 target（0 表示最新）。
+func Up(ctx context.Context, conn *pgx.Conn, target int, done func(Migration)) error {
+	return locked(ctx, conn, func() error {
+		states, err := Status(ctx, conn)
+		if err != nil {
+			return err
+		}
+		if target == 0 {
+			target = len(states)
+		}
+		if target < 0 || target > len(states) {
+			return fmt.Errorf("no migration %d (latest is %d)", target, len(states))
+		}
+		for _, s := range states[:target] {
+			if s.Applied() {
+				continue
+			}
+			if err := apply(ctx, conn, s.Up, insertApplied, s.Version, s.Name); err != nil {
+				return fmt.Errorf("migration %04d_%s: %w", s.Version, s.Name, err)
+			}
+			done(s.Migration)
+		}
+		return nil
+	})
+}
+
+// Down 回滚最近执行的 steps 个版本。
+func Down(ctx context.Context, conn *pgx.Conn, steps int, done func(Migration)) error {
+	return locked(ctx, conn, func() error {
+		states, err := Status(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for i := len(states) - 1; i >= 0 && steps > 0; i-- {
+			s := states[i]
+			if !s.Applied() {
+				continue
+			}
+			if err := apply(ctx, conn, s.Down, deleteApplied, s.Version); err != nil {
+				return fmt.Errorf("migration %04d_%s down: %w", s.Version, s.Name, err)
+			}
+			done(s.Migration)
+			steps--
+		}
+		return nil
+	})
+}
+
+func apply(ctx context.Context, conn *pgx.Conn, ddl, record string, args ...any) error {
+	return pgx.BeginFunc(ctx, conn, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, ddl); err != nil {
+			return err
+		}
+		_, err := tx.Exec(ctx, record, args...)
+		return err
+	})
+}
+
+func locked(ctx context.Context, conn *pgx.Conn, fn func() error) error {
+	if _, err := conn.Exec(ctx, "SELECT pg_advisory_lock($1)", lockKey); err != nil {
+		return err
+	}
+	defer conn.Exec(context.Background(), "SELECT pg_advisory_unlock($1)", lockKey)
+	return fn()
+}
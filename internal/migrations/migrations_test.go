@@ -0,0 +1,60 @@
+package migrations
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestAll(t *testing.T) {
+	t.Parallel()
+	all, err := All()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) == 0 || all[0].Version != 1 || all[0].Name != "core" {
+		t.Fatalf("All() = %+v", all)
+	}
+	// 插件内置查询依赖的表必须由迁移创建
+	for _, table := range []string{"iot_devices", "client_bindings", "acls", "mosq_pg_config", "mosq_pg_stats", "mosq_pg_config_audit"} {
+		found := false
+		for _, m := range all {
+			if strings.Contains(m.Up, "CREATE TABLE IF NOT EXISTS "+table+" ") {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("no migration creates %s", table)
+		}
+	}
+}
+
+func TestLatest(t *testing.T) {
+	t.Parallel()
+	all, _ := All()
+	if Latest() != all[len(all)-1].Version || Latest() < 9 {
+		t.Fatalf("Latest() = %d with %d migrations", Latest(), len(all))
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	t.Parallel()
+	sql := &fstest.MapFile{Data: []byte("SELECT 1;")}
+	tests := map[string]fstest.MapFS{
+		"missing down": {"d/0001_a.up.sql": sql},
+		"gap":          {"d/0001_a.up.sql": sql, "d/0001_a.down.sql": sql, "d/0003_c.up.sql": sql, "d/0003_c.down.sql": sql},
+		"bad name":     {"d/init.sql": sql},
+		"bad version":  {"d/x_a.up.sql": sql, "d/x_a.down.sql": sql},
+		"two names":    {"d/0001_a.up.sql": sql, "d/0001_b.down.sql": sql},
+	}
+	for name, fsys := range tests {
+		if _, err := load(fsys, "d"); err == nil {
+			t.Errorf("%s: load should fail", name)
+		}
+	}
+	ok := fstest.MapFS{"d/0002_b.up.sql": sql, "d/0002_b.down.sql": sql, "d/0001_a.up.sql": sql, "d/0001_a.down.sql": sql}
+	ms, err := load(ok, "d")
+	if err != nil || len(ms) != 2 || ms[0].Name != "a" || ms[1].Version != 2 {
+		t.Fatalf("load = %+v, %v", ms, err)
+	}
+}
@@ -0,0 +1,306 @@
+package migrations
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// 日志表分区：mosq_pg_stats 与 mosq_pg_config_audit 只追加、按时间查询，长期运行后单个堆表越来越大，
+// 删除旧数据也只能逐行 DELETE。Partition 把它们按 ts 分区：
+//
+//   - timescale：转换成 TimescaleDB hypertable（已有数据一并迁移），chunk 与保留策略由扩展自己维护；
+//   - native：PostgreSQL 原生范围分区，分区名带起始时间与粒度（_d20240131、_w20240129、_m202401）。
+//     首次执行把原表换成分区表并复制数据；之后每次执行预建后续分区、删除超过保留期的分区，
+//     需要定期运行（例如每天一次 cron）。
+//
+// 粒度在原生分区建好后不能再改（新旧分区范围会重叠）。
+
+const (
+	PartitionNative    = "native"
+	PartitionTimescale = "timescale"
+)
+
+// LogTables 是可以分区的日志表，值为原生分区转换后在父表上重建的索引。
+var LogTables = map[string][]string{
+	"mosq_pg_stats":        {"CREATE INDEX IF NOT EXISTS mosq_pg_stats_instance_ts_idx ON mosq_pg_stats(instance, ts)"},
+	"mosq_pg_config_audit": {"CREATE INDEX IF NOT EXISTS mosq_pg_config_audit_ts_idx ON mosq_pg_config_audit(ts)"},
+}
+
+// PartitionOptions 控制 Partition；Interval 为 day、week 或 month。
+type PartitionOptions struct {
+	Mode     string
+	Interval string
+	Retain   time.Duration // 0 表示不删除旧数据
+	Premake  int           // 原生分区在当前分区之后预建的个数
+}
+
+var intervalCodes = map[string]byte{"day": 'd', "week": 'w', "month": 'm'}
+
+// Check 检查选项取值。
+func (o PartitionOptions) Check() error {
+	if o.Mode != PartitionNative && o.Mode != PartitionTimescale {
+		return fmt.Errorf("partition mode %q: want native or timescale", o.Mode)
+	}
+	if _, ok := intervalCodes[o.Interval]; !ok {
+		return fmt.Errorf("partition interval %q: want day, week or month", o.Interval)
+	}
+	if o.Retain < 0 || o.Premake < 0 {
+		return errors.New("retention and premake cannot be negative")
+	}
+	return nil
+}
+
+// bucketStart 返回 t 所在分区的起点（UTC）；周从周一开始。
+func bucketStart(t time.Time, interval string) time.Time {
+	t = t.UTC()
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	switch interval {
+	case "week":
+		return day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+	case "month":
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	}
+	return day
+}
+
+func bucketNext(start time.Time, interval string) time.Time {
+	switch interval {
+	case "week":
+		return start.AddDate(0, 0, 7)
+	case "month":
+		return start.AddDate(0, 1, 0)
+	}
+	return start.AddDate(0, 0, 1)
+}
+
+func partitionName(table string, start time.Time, interval string) string {
+	if interval == "month" {
+		return fmt.Sprintf("%s_m%s", table, start.Format("200601"))
+	}
+	return fmt.Sprintf("%s_%c%s", table, intervalCodes[interval], start.Format("20060102"))
+}
+
+// parsePartitionName 从分区名还原范围；不是本包创建的分区返回 false。
+func parsePartitionName(table, name string) (start, end time.Time, ok bool) {
+	rest, found := strings.CutPrefix(name, table+"_")
+	if !found || len(rest) < 2 {
+		return start, end, false
+	}
+	layout := "20060102"
+	var interval string
+	switch rest[0] {
+	case 'd':
+		interval = "day"
+	case 'w':
+		interval = "week"
+	case 'm':
+		interval, layout = "month", "200601"
+	default:
+		return start, end, false
+	}
+	start, err := time.ParseInLocation(layout, rest[1:], time.UTC)
+	if err != nil || bucketStart(start, interval) != start {
+		return start, end, false
+	}
+	return start, bucketNext(start, interval), true
+}
+
+// wantedPartitions 返回从 from 所在分区到 now 之后 premake 个分区的起点。
+func wantedPartitions(from, now time.Time, interval string, premake int) []time.Time {
+	var out []time.Time
+	last := bucketStart(now, interval)
+	for i := 0; i < premake; i++ {
+		last = bucketNext(last, interval)
+	}
+	for s := bucketStart(from, interval); !s.After(last); s = bucketNext(s, interval) {
+		out = append(out, s)
+	}
+	return out
+}
+
+// expiredPartitions 返回范围整体早于 cutoff 的分区，按名字排序。
+func expiredPartitions(table string, names []string, cutoff time.Time) []string {
+	var out []string
+	for _, n := range names {
+		if _, end, ok := parsePartitionName(table, n); ok && !end.After(cutoff) {
+			out = append(out, n)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+func pgInterval(interval string) string {
+	switch interval {
+	case "week":
+		return "7 days"
+	case "month":
+		return "30 days"
+	}
+	return "1 day"
+}
+
+// Partition 按 opts 分区 tables（都必须在 LogTables 中），report 输出每一步做了什么。
+func Partition(ctx context.Context, conn *pgx.Conn, tables []string, opts PartitionOptions, report func(string)) error {
+	if err := opts.Check(); err != nil {
+		return err
+	}
+	for _, t := range tables {
+		if _, ok := LogTables[t]; !ok {
+			return fmt.Errorf("%s is not a log table (want one of mosq_pg_stats, mosq_pg_config_audit)", t)
+		}
+	}
+	return locked(ctx, conn, func() error {
+		if opts.Mode == PartitionTimescale {
+			var ok bool
+			if err := conn.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM pg_extension WHERE extname = 'timescaledb')").Scan(&ok); err != nil {
+				return err
+			}
+			if !ok {
+				return errors.New("the timescaledb extension is not installed in this database (CREATE EXTENSION timescaledb)")
+			}
+		}
+		for _, t := range tables {
+			var err error
+			if opts.Mode == PartitionTimescale {
+				err = hypertable(ctx, conn, t, opts, report)
+			} else {
+				err = nativePartitions(ctx, conn, t, opts, time.Now(), report)
+			}
+			if err != nil {
+				return fmt.Errorf("%s: %w", t, err)
+			}
+		}
+		return nil
+	})
+}
+
+func hypertable(ctx context.Context, conn *pgx.Conn, table string, opts PartitionOptions, report func(string)) error {
+	if _, err := conn.Exec(ctx,
+		"SELECT create_hypertable($1::regclass, 'ts', chunk_time_interval => $2::interval, migrate_data => true, if_not_exists => true)",
+		table, pgInterval(opts.Interval)); err != nil {
+		return err
+	}
+	report(fmt.Sprintf("%s is a hypertable (chunks of %s)", table, pgInterval(opts.Interval)))
+	// 保留期可能改过：先删除旧策略再按当前值添加
+	if _, err := conn.Exec(ctx, "SELECT remove_retention_policy($1::regclass, if_exists => true)", table); err != nil {
+		return err
+	}
+	if opts.Retain > 0 {
+		retain := fmt.Sprintf("%d seconds", int64(opts.Retain/time.Second))
+		if _, err := conn.Exec(ctx, "SELECT add_retention_policy($1::regclass, $2::interval)", table, retain); err != nil {
+			return err
+		}
+		report(fmt.Sprintf("%s drops chunks older than %s", table, opts.Retain))
+	}
+	return nil
+}
+
+func nativePartitions(ctx context.Context, conn *pgx.Conn, table string, opts PartitionOptions, now time.Time, report func(string)) error {
+	var kind *string
+	if err := conn.QueryRow(ctx, "SELECT relkind::text FROM pg_class WHERE oid = to_regclass($1)", table).Scan(&kind); err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return err
+	}
+	switch {
+	case kind == nil:
+		return errors.New("table does not exist; run migrate up first")
+	case *kind == "r":
+		if err := convertToPartitioned(ctx, conn, table, opts, now, report); err != nil {
+			return err
+		}
+	case *kind != "p":
+		return fmt.Errorf("unexpected relkind %q", *kind)
+	}
+
+	for _, s := range wantedPartitions(now, now, opts.Interval, opts.Premake) {
+		if err := createPartition(ctx, conn, table, s, opts.Interval, report); err != nil {
+			return err
+		}
+	}
+	if opts.Retain <= 0 {
+		return nil
+	}
+	rows, err := conn.Query(ctx, `SELECT c.relname::text FROM pg_inherits i JOIN pg_class c ON c.oid = i.inhrelid
+WHERE i.inhparent = to_regclass($1)`, table)
+	if err != nil {
+		return err
+	}
+	names, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return err
+	}
+	for _, n := range expiredPartitions(table, names, now.Add(-opts.Retain)) {
+		if _, err := conn.Exec(ctx, "DROP TABLE "+pgx.Identifier{n}.Sanitize()); err != nil {
+			return err
+		}
+		report("dropped " + n)
+	}
+	return nil
+}
+
+// execer 由 *pgx.Conn 与 pgx.Tx 实现。
+type execer interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+}
+
+func createPartition(ctx context.Context, db execer, table string, start time.Time, interval string, report func(string)) error {
+	name := partitionName(table, start, interval)
+	if _, err := db.Exec(ctx, fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s PARTITION OF %s FOR VALUES FROM ('%s') TO ('%s')",
+		pgx.Identifier{name}.Sanitize(), pgx.Identifier{table}.Sanitize(),
+		start.Format(time.RFC3339), bucketNext(start, interval).Format(time.RFC3339))); err != nil {
+		return err
+	}
+	report("partition " + name + " ready")
+	return nil
+}
+
+// convertToPartitioned 在一个事务里把普通表换成分区表：改名、建分区表、复制数据、删除原表、重建索引。
+func convertToPartitioned(ctx context.Context, conn *pgx.Conn, table string, opts PartitionOptions, now time.Time, report func(string)) error {
+	old := table + "_unpartitioned"
+	return pgx.BeginFunc(ctx, conn, func(tx pgx.Tx) error {
+		var oldest *time.Time
+		if err := tx.QueryRow(ctx, "SELECT min(ts) FROM "+pgx.Identifier{table}.Sanitize()).Scan(&oldest); err != nil {
+			return err
+		}
+		from := now
+		if oldest != nil && oldest.Before(now) {
+			from = *oldest
+		}
+		stmts := []string{
+			fmt.Sprintf("ALTER TABLE %s RENAME TO %s", pgx.Identifier{table}.Sanitize(), pgx.Identifier{old}.Sanitize()),
+			fmt.Sprintf("CREATE TABLE %s (LIKE %s INCLUDING DEFAULTS INCLUDING CONSTRAINTS) PARTITION BY RANGE (ts)",
+				pgx.Identifier{table}.Sanitize(), pgx.Identifier{old}.Sanitize()),
+		}
+		for _, s := range stmts {
+			if _, err := tx.Exec(ctx, s); err != nil {
+				return err
+			}
+		}
+		for _, s := range wantedPartitions(from, now, opts.Interval, 0) {
+			if err := createPartition(ctx, tx, table, s, opts.Interval, report); err != nil {
+				return err
+			}
+		}
+		tag, err := tx.Exec(ctx, fmt.Sprintf("INSERT INTO %s SELECT * FROM %s", pgx.Identifier{table}.Sanitize(), pgx.Identifier{old}.Sanitize()))
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(ctx, "DROP TABLE "+pgx.Identifier{old}.Sanitize()); err != nil {
+			return err
+		}
+		for _, idx := range LogTables[table] {
+			if _, err := tx.Exec(ctx, idx); err != nil {
+				return err
+			}
+		}
+		report(fmt.Sprintf("converted %s to a partitioned table (%d row(s) moved)", table, tag.RowsAffected()))
+		return nil
+	})
+}
@@ -0,0 +1,85 @@
+package migrations
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBucketStart(t *testing.T) {
+	t.Parallel()
+	at := time.Date(2024, 2, 29, 17, 30, 0, 0, time.FixedZone("UTC+8", 8*3600)) // 09:30 UTC，周四
+	tests := map[string]time.Time{
+		"day":   time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC),
+		"week":  time.Date(2024, 2, 26, 0, 0, 0, 0, time.UTC),
+		"month": time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC),
+	}
+	for interval, want := range tests {
+		if got := bucketStart(at, interval); !got.Equal(want) {
+			t.Errorf("bucketStart(%s) = %v, want %v", interval, got, want)
+		}
+	}
+	if got := bucketNext(tests["month"], "month"); !got.Equal(time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("bucketNext(month) = %v", got)
+	}
+}
+
+func TestPartitionNames(t *testing.T) {
+	t.Parallel()
+	start := time.Date(2024, 1, 29, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		interval, name string
+		end            time.Time
+	}{
+		{"day", "mosq_pg_stats_d20240129", time.Date(2024, 1, 30, 0, 0, 0, 0, time.UTC)},
+		{"week", "mosq_pg_stats_w20240129", time.Date(2024, 2, 5, 0, 0, 0, 0, time.UTC)},
+		{"month", "mosq_pg_stats_m202401", time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		s := bucketStart(start, tt.interval)
+		name := partitionName("mosq_pg_stats", s, tt.interval)
+		if name != tt.name {
+			t.Errorf("partitionName(%s) = %q, want %q", tt.interval, name, tt.name)
+		}
+		gotStart, gotEnd, ok := parsePartitionName("mosq_pg_stats", name)
+		if !ok || !gotStart.Equal(s) || !gotEnd.Equal(tt.end) {
+			t.Errorf("parsePartitionName(%q) = %v, %v, %v", name, gotStart, gotEnd, ok)
+		}
+	}
+	for _, name := range []string{"mosq_pg_stats_x20240129", "mosq_pg_stats_w20240130", "mosq_pg_stats_dlegacy", "other_d20240129"} {
+		if _, _, ok := parsePartitionName("mosq_pg_stats", name); ok {
+			t.Errorf("parsePartitionName(%q) should not match", name)
+		}
+	}
+}
+
+func TestWantedAndExpiredPartitions(t *testing.T) {
+	t.Parallel()
+	now := time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC)
+	got := wantedPartitions(time.Date(2024, 3, 8, 23, 0, 0, 0, time.UTC), now, "day", 2)
+	if len(got) != 5 || got[0].Day() != 8 || got[4].Day() != 12 {
+		t.Fatalf("wantedPartitions = %v", got)
+	}
+
+	names := []string{"mosq_pg_stats_d20240307", "mosq_pg_stats_d20240308", "mosq_pg_stats_d20240306", "mosq_pg_stats_d20240309", "mosq_pg_stats_manual"}
+	expired := expiredPartitions("mosq_pg_stats", names, now.Add(-48*time.Hour)) // 截止 3 月 8 日 12:00
+	if len(expired) != 2 || expired[0] != "mosq_pg_stats_d20240306" || expired[1] != "mosq_pg_stats_d20240307" {
+		t.Fatalf("expiredPartitions = %v", expired)
+	}
+}
+
+func TestPartitionOptionsCheck(t *testing.T) {
+	t.Parallel()
+	good := PartitionOptions{Mode: PartitionNative, Interval: "week", Premake: 2}
+	if err := good.Check(); err != nil {
+		t.Fatal(err)
+	}
+	for _, bad := range []PartitionOptions{
+		{Mode: "citus", Interval: "day"},
+		{Mode: PartitionTimescale, Interval: "hour"},
+		{Mode: PartitionNative, Interval: "day", Premake: -1},
+	} {
+		if bad.Check() == nil {
+			t.Errorf("Check(%+v) should fail", bad)
+		}
+	}
+}
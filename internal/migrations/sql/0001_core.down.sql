@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS acls;
+DROP TABLE IF EXISTS client_bindings;
+DROP TABLE IF EXISTS iot_devices;
@@ -0,0 +1,24 @@
+-- 插件认证与 ACL 使用的表（plugin.go authQuery/bindQuery、acl.go aclQuery）。
+-- IF NOT EXISTS 让已用 init_db.sql 建过表的库也能直接纳入迁移管理。
+CREATE TABLE IF NOT EXISTS iot_devices (
+  username      TEXT PRIMARY KEY,
+  password_hash TEXT NOT NULL,
+  salt          TEXT NOT NULL DEFAULT '',
+  enabled       SMALLINT NOT NULL DEFAULT 1,
+  created_at    TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS client_bindings (
+  username  TEXT NOT NULL REFERENCES iot_devices(username) ON DELETE CASCADE,
+  client_id TEXT NOT NULL,
+  PRIMARY KEY (username, client_id)
+);
+
+-- acc 位掩码：1=read 2=write 4=subscribe；username '*' 为全局规则
+CREATE TABLE IF NOT EXISTS acls (
+  username TEXT NOT NULL,
+  pattern  TEXT NOT NULL,
+  acc      INTEGER NOT NULL CHECK (acc > 0 AND acc <= 7),
+  PRIMARY KEY (username, pattern)
+);
+CREATE INDEX IF NOT EXISTS acls_user_idx ON acls(username);
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS mosq_pg_config;
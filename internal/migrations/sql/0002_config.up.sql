@@ -0,0 +1,7 @@
+-- plugin_opt_config_instance 的共享配置；instance '*' 对所有 broker 生效
+CREATE TABLE IF NOT EXISTS mosq_pg_config (
+  instance TEXT NOT NULL,
+  key      TEXT NOT NULL,
+  value    TEXT NOT NULL,
+  PRIMARY KEY (instance, key)
+);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS mosq_pg_config_audit;
+DROP TABLE IF EXISTS mosq_pg_stats;
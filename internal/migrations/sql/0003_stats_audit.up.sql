@@ -0,0 +1,29 @@
+-- plugin_opt_stats_table_interval 的周期统计，计数器按 broker 启动累计
+CREATE TABLE IF NOT EXISTS mosq_pg_stats (
+  ts                  TIMESTAMPTZ NOT NULL DEFAULT now(),
+  instance            TEXT NOT NULL,
+  pool_total_conns    INTEGER NOT NULL,
+  pool_acquired_conns INTEGER NOT NULL,
+  pool_idle_conns     INTEGER NOT NULL,
+  grace_cache_entries INTEGER NOT NULL,
+  auth_allowed        BIGINT NOT NULL,
+  auth_denied         BIGINT NOT NULL,
+  auth_errors         BIGINT NOT NULL,
+  acl_allowed         BIGINT NOT NULL,
+  acl_denied          BIGINT NOT NULL,
+  acl_errors          BIGINT NOT NULL,
+  stats               JSONB NOT NULL
+);
+CREATE INDEX IF NOT EXISTS mosq_pg_stats_instance_ts_idx ON mosq_pg_stats(instance, ts);
+
+-- plugin_opt_config_audit_table 的配置变更审计；密钥类选项以掩码存储
+CREATE TABLE IF NOT EXISTS mosq_pg_config_audit (
+  ts        TIMESTAMPTZ NOT NULL DEFAULT now(),
+  instance  TEXT NOT NULL,
+  source    TEXT NOT NULL,
+  actor     TEXT NOT NULL,
+  key       TEXT NOT NULL,
+  old_value TEXT NOT NULL,
+  new_value TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS mosq_pg_config_audit_ts_idx ON mosq_pg_config_audit(ts);
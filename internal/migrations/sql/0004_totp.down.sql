@@ -0,0 +1 @@
+ALTER TABLE iot_devices DROP COLUMN IF EXISTS totp_secret;
@@ -0,0 +1,2 @@
+-- plugin_opt_totp_users 的第二因素密钥（base32），只有需要 TOTP 的账号才设置
+ALTER TABLE iot_devices ADD COLUMN IF NOT EXISTS totp_secret TEXT;
@@ -0,0 +1,16 @@
+-- plugin_opt_cert_auto_register 登记的待审批设备：证书有效但 iot_devices 中没有对应行时，
+-- 插件建一条停用的设备行，并在这里记下证书与首次连接的信息
+CREATE TABLE IF NOT EXISTS device_registrations (
+  username         TEXT PRIMARY KEY REFERENCES iot_devices(username) ON DELETE CASCADE,
+  cert_subject     TEXT NOT NULL,
+  cert_issuer      TEXT NOT NULL,
+  cert_serial      TEXT NOT NULL,
+  cert_sha256      TEXT NOT NULL,
+  cert_not_after   TIMESTAMPTZ NOT NULL,
+  client_id        TEXT NOT NULL,
+  address          TEXT NOT NULL,
+  protocol_version INTEGER NOT NULL,
+  first_seen       TIMESTAMPTZ NOT NULL DEFAULT now(),
+  last_seen        TIMESTAMPTZ NOT NULL DEFAULT now(),
+  attempts         BIGINT NOT NULL DEFAULT 1
+);
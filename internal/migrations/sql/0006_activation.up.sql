@@ -0,0 +1,2 @@
+-- plugin_opt_activation_webhook_url 的首次上线时间；为 NULL 表示设备还没有成功登录过（或通知未送达）
+ALTER TABLE iot_devices ADD COLUMN IF NOT EXISTS activated_at TIMESTAMPTZ;
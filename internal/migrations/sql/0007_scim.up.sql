@@ -0,0 +1,25 @@
+-- cmd/scim 的 SCIM 资源；账号本身仍在 iot_devices，删除账号时 SCIM 记录随之删除。
+CREATE TABLE IF NOT EXISTS scim_users (
+  id           TEXT PRIMARY KEY,
+  username     TEXT NOT NULL UNIQUE REFERENCES iot_devices(username) ON DELETE CASCADE,
+  external_id  TEXT NOT NULL DEFAULT '',
+  display_name TEXT NOT NULL DEFAULT '',
+  created_at   TIMESTAMPTZ NOT NULL DEFAULT now(),
+  modified_at  TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS scim_groups (
+  id           TEXT PRIMARY KEY,
+  display_name TEXT NOT NULL,
+  external_id  TEXT NOT NULL DEFAULT '',
+  created_at   TIMESTAMPTZ NOT NULL DEFAULT now(),
+  modified_at  TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+-- -role-map 按组名（不区分大小写）映射角色，组名必须唯一
+CREATE UNIQUE INDEX IF NOT EXISTS scim_groups_name_idx ON scim_groups (lower(display_name));
+
+CREATE TABLE IF NOT EXISTS scim_group_members (
+  group_id TEXT NOT NULL REFERENCES scim_groups(id) ON DELETE CASCADE,
+  user_id  TEXT NOT NULL REFERENCES scim_users(id) ON DELETE CASCADE,
+  PRIMARY KEY (group_id, user_id)
+);
@@ -0,0 +1,8 @@
+-- cmd/kafkasync 已应用到的位置；与事件在同一个事务里更新，重启后从 next_offset 继续。
+CREATE TABLE IF NOT EXISTS kafka_offsets (
+  topic       TEXT NOT NULL,
+  partition   INTEGER NOT NULL,
+  next_offset BIGINT NOT NULL,
+  updated_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+  PRIMARY KEY (topic, partition)
+);
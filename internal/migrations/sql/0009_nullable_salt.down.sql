@@ -0,0 +1,2 @@
+UPDATE iot_devices SET salt = '' WHERE salt IS NULL;
+ALTER TABLE iot_devices ALTER COLUMN salt SET NOT NULL;
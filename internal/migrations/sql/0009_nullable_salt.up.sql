@@ -0,0 +1,4 @@
+-- salt 只用于旧的 sha256(password+salt) 哈希；PHC 格式（bcrypt、argon2id、pbkdf2、$7$）的哈希自带盐，
+-- 从这个版本起新行可以不填。插件从 schema_migrations 读到 9 及以上时按 coalesce(salt, '') 查询，
+-- 更早的插件会拒绝这个版本的库：先升级 broker，再执行本迁移。
+ALTER TABLE iot_devices ALTER COLUMN salt DROP NOT NULL;
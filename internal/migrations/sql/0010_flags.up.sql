@@ -0,0 +1,8 @@
+-- plugin_opt_flags_poll_interval 的运行时功能开关；instance 为 config_instance 或主机名，'*' 对所有 broker 生效
+CREATE TABLE IF NOT EXISTS mosq_pg_flags (
+  instance   TEXT NOT NULL,
+  flag       TEXT NOT NULL,
+  enabled    BOOLEAN NOT NULL,
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  PRIMARY KEY (instance, flag)
+);
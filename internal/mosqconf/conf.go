@@ -0,0 +1,216 @@
+// Package mosqconf 生成并校验 mosquitto.conf 中与本插件有关的部分（监听端口、TLS 文件、plugin 与 plugin_opt_*），
+// 供 genconfig 和容器入口 entrypoint 共用。选项校验规则与插件一致，见 validate.go。
+package mosqconf
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DefaultPlugin 是 Docker 镜像中插件的位置。
+const DefaultPlugin = "/mosquitto/plugins/auth-plugin"
+
+// generatedPrefix 标记生成的文件，entrypoint 据此判断能否覆盖（用户挂载的配置不覆盖）。
+const generatedPrefix = "# Generated by "
+
+// Listener 是一个监听端口；TLS 监听使用 Config.TLS 中的证书文件。
+type Listener struct {
+	Port       int
+	WebSockets bool
+	TLS        bool
+}
+
+type TLS struct {
+	CertFile, KeyFile, CAFile string
+	RequireCert               bool
+}
+
+type Config struct {
+	Generator string // 写进文件头的工具名
+	Plugin    string
+	Full      bool // 输出完整配置，而不只是插件块
+	Listeners []Listener
+	TLS       TLS
+	Options   map[string]string
+}
+
+// ParseListeners 解析逗号分隔的监听说明：<port>[:tls|:ws|:wss]，如 1883,8883:tls,9001:ws。
+func ParseListeners(vals []string) ([]Listener, error) {
+	var out []Listener
+	seen := map[int]bool{}
+	for _, v := range vals {
+		for _, spec := range strings.Split(v, ",") {
+			spec = strings.TrimSpace(spec)
+			if spec == "" {
+				continue
+			}
+			port, kind, _ := strings.Cut(spec, ":")
+			n, err := strconv.Atoi(port)
+			if err != nil || n <= 0 || n > 65535 {
+				return nil, fmt.Errorf("listener %q: %q is not a port", spec, port)
+			}
+			l := Listener{Port: n}
+			switch strings.ToLower(kind) {
+			case "", "mqtt":
+			case "tls", "mqtts":
+				l.TLS = true
+			case "ws", "websockets":
+				l.WebSockets = true
+			case "wss":
+				l.WebSockets, l.TLS = true, true
+			default:
+				return nil, fmt.Errorf("listener %q: unknown kind %q (want tls, ws or wss)", spec, kind)
+			}
+			if seen[n] {
+				return nil, fmt.Errorf("listener port %d given twice", n)
+			}
+			seen[n] = true
+			out = append(out, l)
+		}
+	}
+	return out, nil
+}
+
+// EnvOptions 收集 PLUGIN_OPT_<NAME>=value 形式的环境变量。
+func EnvOptions(environ []string) map[string]string {
+	opts := map[string]string{}
+	for _, kv := range environ {
+		k, v, _ := strings.Cut(kv, "=")
+		if name, ok := strings.CutPrefix(k, "PLUGIN_OPT_"); ok && name != "" {
+			opts[strings.ToLower(name)] = v
+		}
+	}
+	return opts
+}
+
+func (c Config) ports() []int {
+	ports := make([]int, len(c.Listeners))
+	for i, l := range c.Listeners {
+		ports[i] = l.Port
+	}
+	return ports
+}
+
+// Validate 返回所有问题，而不是遇到第一个就停止。
+func (c Config) Validate() []string {
+	var problems []string
+	if c.Plugin == "" {
+		problems = append(problems, "plugin path is empty")
+	}
+	for k, v := range c.Options {
+		if err := CheckOption(k, v); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+	tls := false
+	for _, l := range c.Listeners {
+		tls = tls || l.TLS
+	}
+	switch {
+	case tls && (c.TLS.CertFile == "" || c.TLS.KeyFile == ""):
+		problems = append(problems, "TLS listeners need both a certificate and a key file")
+	case !tls && (c.TLS.CertFile != "" || c.TLS.KeyFile != "" || c.TLS.RequireCert):
+		problems = append(problems, "TLS files are set but no listener uses TLS")
+	}
+	if c.TLS.RequireCert && c.TLS.CAFile == "" {
+		problems = append(problems, "requiring client certificates needs a CA file")
+	}
+	sort.Strings(problems)
+	return append(problems, checkCombos(c.Options, c.ports())...)
+}
+
+// Warnings 是不阻止生成、但值得提醒的情况。
+func (c Config) Warnings() []string {
+	var w []string
+	o := c.Options
+	for _, b := range Backends(o) {
+		switch {
+		case b == "mysql":
+			if o["mysql_dsn"] == "" && o["mysql_dsn_file"] == "" {
+				w = append(w, "no mysql_dsn or mysql_dsn_file; the broker needs MYSQL_DSN in its environment")
+			}
+			if user, _, ok := strings.Cut(o["mysql_dsn"], "@"); ok && strings.Contains(user, ":") {
+				w = append(w, "mysql_dsn contains a password; use mysql_dsn_file to keep it out of mosquitto.conf")
+			}
+		case b == "redis":
+			if o["redis_url"] == "" {
+				w = append(w, "no redis_url; the broker needs REDIS_URL in its environment")
+			}
+		case b == "grpc":
+			if o["grpc_addr"] == "" {
+				w = append(w, "no grpc_addr; the broker needs GRPC_ADDR in its environment")
+			}
+		case GoAuthCompat(o):
+			if o["pg_password"] != "" {
+				w = append(w, "pg_password is written in clear text; prefer pg_dsn_file or pg_password_file")
+			}
+		case o["pg_dsn"] == "" && o["pg_dsn_file"] == "" && o["config_instance"] == "" && o["cloudsql_instance"] == "":
+			w = append(w, "no pg_dsn or pg_dsn_file; the broker needs PG_DSN or PG_DSN_FILE in its environment")
+		}
+	}
+	if dsnHasPassword(o["pg_dsn"]) {
+		w = append(w, "pg_dsn contains a password; use pg_dsn_file or pg_password_file to keep it out of mosquitto.conf")
+	}
+	if o["vault_token"] != "" {
+		w = append(w, "vault_token is written in clear text; prefer vault_token_file")
+	}
+	if o["kafka_password"] != "" {
+		w = append(w, "kafka_password is written in clear text; prefer kafka_password_file")
+	}
+	if b, _ := ParseBool(o["fail_open_auth"]); b {
+		w = append(w, "fail_open_auth lets every client connect while the database is unreachable; consider auth_grace_minutes")
+	} else if b, _ := ParseBool(o["fail_open"]); b {
+		w = append(w, "fail_open lets every client connect while the database is unreachable; consider auth_grace_minutes")
+	}
+	return w
+}
+
+// IsGenerated 判断已有文件内容是否由本包生成。
+func IsGenerated(content []byte) bool {
+	return strings.HasPrefix(string(content), generatedPrefix)
+}
+
+func (c Config) Render(w io.Writer) error {
+	if c.Plugin == "" {
+		return errors.New("plugin path is empty")
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s%s; edit the inputs and regenerate instead of changing this file.\n", generatedPrefix, c.Generator)
+	if c.Full {
+		b.WriteString("per_listener_settings false\nallow_anonymous false\n")
+		b.WriteString("persistence true\npersistence_location /mosquitto/data/\nlog_dest stdout\n\n")
+		for _, l := range c.Listeners {
+			fmt.Fprintf(&b, "listener %d\n", l.Port)
+			if l.WebSockets {
+				b.WriteString("protocol websockets\n")
+			}
+			if l.TLS {
+				fmt.Fprintf(&b, "certfile %s\nkeyfile %s\n", c.TLS.CertFile, c.TLS.KeyFile)
+				if c.TLS.CAFile != "" {
+					fmt.Fprintf(&b, "cafile %s\n", c.TLS.CAFile)
+				}
+				if c.TLS.RequireCert {
+					b.WriteString("require_certificate true\n")
+				}
+			}
+			b.WriteString("\n")
+		}
+	}
+	fmt.Fprintf(&b, "plugin %s\n", c.Plugin)
+	names := make([]string, 0, len(c.Options))
+	width := 0
+	for k := range c.Options {
+		names = append(names, k)
+		width = max(width, len(k))
+	}
+	sort.Strings(names)
+	for _, k := range names {
+		fmt.Fprintf(&b, "plugin_opt_%-*s %s\n", width, k, strings.TrimSpace(c.Options[k]))
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
@@ -0,0 +1,190 @@
+package mosqconf
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestParseListeners(t *testing.T) {
+	t.Parallel()
+	got, err := ParseListeners([]string{"1883, 8883:tls", "9001:ws,9443:wss"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Listener{{Port: 1883}, {Port: 8883, TLS: true}, {Port: 9001, WebSockets: true}, {Port: 9443, WebSockets: true, TLS: true}}
+	if len(got) != len(want) {
+		t.Fatalf("got %+v", got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("listener %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+	for _, bad := range []string{"http", "1883:quic", "1883,1883:tls", "70000"} {
+		if _, err := ParseListeners([]string{bad}); err == nil {
+			t.Errorf("ParseListeners(%q) should fail", bad)
+		}
+	}
+}
+
+func TestValidateTLS(t *testing.T) {
+	t.Parallel()
+	cases := []struct {
+		c    Config
+		want string
+	}{
+		{Config{Listeners: []Listener{{Port: 8883, TLS: true}}}, "need both a certificate and a key file"},
+		{Config{Listeners: []Listener{{Port: 1883}}, TLS: TLS{CertFile: "c", KeyFile: "k"}}, "no listener uses TLS"},
+		{Config{Listeners: []Listener{{Port: 8883, TLS: true}}, TLS: TLS{CertFile: "c", KeyFile: "k", RequireCert: true}}, "needs a CA file"},
+	}
+	for _, tc := range cases {
+		tc.c.Plugin = DefaultPlugin
+		if got := strings.Join(tc.c.Validate(), "; "); !strings.Contains(got, tc.want) {
+			t.Errorf("Validate(%+v) = %q, want %q", tc.c, got, tc.want)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	t.Parallel()
+	cases := []struct {
+		opts      map[string]string
+		listeners []int
+		want      string // 空表示没有问题
+	}{
+		{map[string]string{"pg_dsn_file": "/x", "timeout_ms": "1500", "acl_check": "true", "fail_open_acl": "yes", "listener_8883.timeout_ms": "500"}, []int{1883, 8883}, ""},
+		{map[string]string{"timeout_msec": "10"}, nil, "did you mean timeout_ms?"},
+		{map[string]string{"timeout_ms": "90000"}, nil, "want 1-60000"},
+		{map[string]string{"fail_open_auth": "maybe"}, nil, "want true or false"},
+		{map[string]string{"log_level": "verbose"}, nil, "want one of error/warn/info/debug/trace"},
+		{map[string]string{"listener_8883.log_level": "debug"}, nil, "cannot be overridden per listener"},
+		{map[string]string{"listener_9999.fail_open_acl": "true"}, []int{1883}, "not a configured listener"},
+		{map[string]string{"fail_open_auth": "true", "auth_grace_minutes": "10"}, nil, "auth_grace_minutes has no effect"},
+		{map[string]string{"health_down_after": "0", "health_ping_interval": "5"}, nil, "health_ping_interval has no effect without health_down_after"},
+		{map[string]string{"azure_ad_auth": "off", "azure_client_id": "x"}, nil, "azure_client_id has no effect"},
+		{map[string]string{"kafka_brokers": "k:9092"}, nil, "kafka_brokers needs kafka_topic"},
+		{map[string]string{"pg_dsn_file": "/x", "kafka_brokers": "k:9092", "kafka_topic": "t", "kafka_sasl_mechanism": "SCRAM-SHA-256", "kafka_username": "u", "kafka_password_file": "/p", "kafka_format": "avro", "kafka_schema_registry": "http://sr:8081"}, nil, ""},
+		{map[string]string{"kafka_brokers": "k:9092", "kafka_topic": "t", "kafka_sasl_mechanism": "gssapi"}, nil, "want one of /plain/scram-sha-256/scram-sha-512"},
+		{map[string]string{"kafka_brokers": "k:9092", "kafka_topic": "t", "kafka_sasl_mechanism": "plain"}, nil, "kafka_sasl_mechanism needs kafka_username"},
+		{map[string]string{"kafka_brokers": "k:9092", "kafka_topic": "t", "kafka_password": "p"}, nil, "kafka_password has no effect without kafka_sasl_mechanism"},
+		{map[string]string{"kafka_brokers": "k:9092", "kafka_topic": "t", "kafka_format": "avro"}, nil, "kafka_format=avro needs kafka_schema_registry"},
+		{map[string]string{"latency_budget_ms": "2000"}, nil, "is not below timeout_ms=1500"},
+		{map[string]string{"pprof_listen": "0.0.0.0:6060"}, nil, "not a loopback address"},
+		{map[string]string{"redact_salt": "a\nb"}, nil, "cannot span lines"},
+		{map[string]string{"pg_dsn_file": "/x", "go_memory_limit": "512MiB", "go_gc_percent": "50", "go_memory_ballast": "64MiB"}, nil, ""},
+		{map[string]string{"go_memory_limit": "512MB"}, nil, "want a size such as 512MiB"},
+		{map[string]string{"go_gc_percent": "-5"}, nil, "want a percentage >= 0 or off"},
+		{map[string]string{"pg_dsn_file": "/x", "go_gc_percent": "off"}, nil, "lets the plugin's heap grow without bound"},
+		{map[string]string{"db_driver": "mariadb", "mysql_dsn_file": "/x"}, nil, ""},
+		{map[string]string{"db_driver": "mysql", "pg_schema": "mqtt"}, nil, "pg_schema is PostgreSQL-only"},
+		{map[string]string{"mysql_dsn": "u@tcp(db)/iot"}, nil, "mysql_dsn/mysql_dsn_file have no effect without db_driver=mysql"},
+		{map[string]string{"db_driver": "sqlite"}, nil, "want one of"},
+		{map[string]string{"db_driver": "redis", "redis_url": "redis://r:6379", "config_instance": "x"}, nil, "config_instance is PostgreSQL-only"},
+		{map[string]string{"pg_dsn_file": "/x", "redis_url": "redis://r:6379", "redis_cache_ttl": "30"}, nil, ""},
+		{map[string]string{"pg_dsn_file": "/x", "redis_prefix": "a:"}, nil, "redis_url/redis_prefix have no effect"},
+		{map[string]string{"db_driver": "grpc", "grpc_addr": "127.0.0.1:9000"}, nil, ""},
+		{map[string]string{"db_driver": "grpc", "grpc_addr": "dns:///authz:9000"}, nil, "passwords are sent in clear text"},
+		{map[string]string{"db_driver": "grpc", "grpc_addr": "authz:9000", "grpc_tls": "on", "grpc_cert_file": "/c"}, nil, "must be set together"},
+		{map[string]string{"db_driver": "grpc", "grpc_addr": "unix:///run/a.sock", "enforce_bind": "true"}, nil, "enforce_bind has no effect"},
+		{map[string]string{"pg_dsn_file": "/x", "grpc_addr": "authz:9000"}, nil, "grpc_addr has no effect without db_driver=grpc"},
+		{map[string]string{"backends": "postgres:required,grpc", "pg_dsn_file": "/x", "grpc_addr": "127.0.0.1:9000"}, nil, ""},
+		{map[string]string{"backends": "redis,grpc", "redis_url": "redis://r", "grpc_addr": "127.0.0.1:9000", "self_test": "true"}, nil, "self_test is PostgreSQL-only and has no effect with backends=redis,grpc"},
+		{map[string]string{"backends": "mysql", "db_driver": "mysql", "mysql_dsn_file": "/x"}, nil, "db_driver has no effect when backends is set"},
+		{map[string]string{"backends": "postgres:off"}, nil, "no backend enabled"},
+		{map[string]string{"pg_dsn_file": "/x", "fallback_password_file": "/p"}, nil, "need health_down_after"},
+		{map[string]string{"pg_dsn_file": "/x", "acl_check": "true", "fallback_acl_file": "/a", "health_down_after": "3"}, nil, ""},
+		{map[string]string{"compat": "mosquitto-go-auth", "pg_host": "db", "pg_userquery": "SELECT password_hash FROM test_user WHERE username = $1"}, nil, ""},
+		{map[string]string{"compat": "go-auth", "pg_host": "db", "enforce_bind": "true"}, nil, "needs pg_userquery"},
+		{map[string]string{"pg_dsn_file": "/x", "pg_aclquery": "SELECT topic FROM test_acl"}, nil, "pg_aclquery is a mosquitto-go-auth option"},
+		{map[string]string{"pg_dsn_file": "/x", "pg_flavor": "crdb", "crdb_follower_reads": "true", "crdb_max_retries": "5"}, nil, ""},
+		{map[string]string{"pg_dsn_file": "/x", "crdb_follower_reads": "true"}, nil, "crdb_follower_reads has no effect without pg_flavor cockroachdb"},
+		{map[string]string{"pg_dsn_file": "/x", "pg_flavor": "cockroachdb", "crdb_max_retries": "11"}, nil, "crdb_max_retries"},
+		{map[string]string{"pg_dsn_file": "/x", "shard_column": "tenant_id", "shard_separator": "/"}, nil, ""},
+		{map[string]string{"pg_dsn_file": "/x", "shard_value": "acme"}, nil, "shard_value has no effect without shard_column"},
+		{map[string]string{"pg_dsn_file": "/x", "krb5_keytab": "/etc/mqtt.keytab", "krb5_principal_map": "*@CORP.EXAMPLE=ops-viewer"}, nil, ""},
+		{map[string]string{"pg_dsn_file": "/x", "krb5_keytab": "/etc/mqtt.keytab"}, nil, "krb5_principal_map is empty"},
+		{map[string]string{"pg_dsn_file": "/x", "krb5_keytab": "/etc/mqtt.keytab", "krb5_principal_map": "alice=ops"}, nil, "needs a realm"},
+		{map[string]string{"pg_dsn_file": "/x", "krb5_principal_map": "*=ops"}, nil, "krb5_principal_map has no effect without krb5_keytab"},
+		{map[string]string{"pg_dsn_file": "/x", "totp_users": "ops-*,dashboard", "totp_skew": "2"}, nil, ""},
+		{map[string]string{"pg_dsn_file": "/x", "totp_skew": "1"}, nil, "totp_skew has no effect without totp_users"},
+		{map[string]string{"pg_dsn_file": "/x", "acl_check": "true", "cert_auto_register": "true"}, nil, ""},
+		{map[string]string{"pg_dsn_file": "/x", "admin_listen": ":8443", "admin_tls_cert": "/c", "admin_tls_key": "/k", "admin_client_ca": "/ca"}, nil, ""},
+		{map[string]string{"pg_dsn_file": "/x", "admin_listen": ":8443", "admin_tls_cert": "/c", "admin_tls_key": "/k"}, nil, "admin_listen needs"},
+		{map[string]string{"pg_dsn_file": "/x", "admin_allowed_clients": "operator"}, nil, "admin_allowed_clients has no effect without admin_listen"},
+		{map[string]string{"pg_dsn_file": "/x", "activation_webhook_url": "https://erp.example/hooks/activated", "activation_webhook_secret": "s"}, nil, ""},
+		{map[string]string{"pg_dsn_file": "/x", "activation_webhook_url": "erp.example/hooks"}, nil, "must be an http(s) URL"},
+		{map[string]string{"pg_dsn_file": "/x", "activation_webhook_secret": "s"}, nil, "activation_webhook_secret has no effect"},
+		{map[string]string{"pg_dsn_file": "/x", "acl_check": "true", "bootstrap_topic": "bootstrap/register", "bootstrap_users": "factory"}, nil, ""},
+		{map[string]string{"pg_dsn_file": "/x", "bootstrap_topic": "bootstrap/register"}, nil, "bootstrap_topic needs bootstrap_users"},
+		{map[string]string{"pg_dsn_file": "/x", "bootstrap_topic": "bootstrap/#", "bootstrap_users": "factory"}, nil, "without wildcards"},
+		{map[string]string{"pg_dsn_file": "/x", "bootstrap_topic": "bootstrap/response/x", "bootstrap_users": "factory"}, nil, "must not be under bootstrap_response_prefix"},
+		{map[string]string{"pg_dsn_file": "/x", "bootstrap_users": "factory"}, nil, "bootstrap_users has no effect without bootstrap_topic"},
+		{map[string]string{"pg_dsn_file": "/x", "cert_auto_register": "true"}, nil, "cert_auto_register has no effect without acl_check"},
+		{map[string]string{"pg_dsn_file": "/x", "cert_auto_register": "true", "disable_acl_check": "false"}, nil, ""},
+		{map[string]string{"pg_dsn_file": "/x", "acl_check": "true", "disable_acl_check": "true"}, nil, "disable_acl_check is deprecated"},
+		{map[string]string{"pg_dsn_file": "/x", "pg_aclquery": "SELECT topic FROM test_acl", "compat": "mosquitto-go-auth"}, nil, "pg_aclquery has no effect without acl_check"},
+		{map[string]string{"pg_dsn_file": "/x", "acl_check": "true", "cert_auto_register": "true", "shard_column": "tenant_id"}, nil, "does not support shard_column"},
+		{map[string]string{"db_driver": "mysql", "mysql_dsn": "u@tcp(h)/db", "cert_auto_register": "true"}, nil, "cert_auto_register is PostgreSQL-only"},
+		{map[string]string{"pg_dsn_file": "/x", "totp_users": "dashboard", "totp_skew": "5"}, nil, "want 0-2"},
+		{map[string]string{"db_driver": "redis", "redis_url": "redis://r", "totp_users": "dashboard"}, nil, "totp_users needs a postgres or mysql backend"},
+		{map[string]string{"backends": "postgres,grpc", "pg_dsn_file": "/x", "grpc_addr": "127.0.0.1:9000", "totp_users": "dashboard"}, nil, "totp_users cannot be combined with the grpc backend"},
+		{map[string]string{"pg_dsn_file": "/x", "shard_column": "tenant id"}, nil, "not a column name"},
+		{map[string]string{"pg_dsn_file": "/x", "shard_column": "tenant_id", "shard_separator": ""}, nil, "needs shard_value or a non-empty shard_separator"},
+		{map[string]string{"compat": "go-auth", "pg_host": "db", "pg_userquery": "SELECT 1", "shard_column": "tenant_id"}, nil, "shard_column has no effect with compat"},
+	}
+	for _, tc := range cases {
+		var ls []Listener
+		for _, p := range tc.listeners {
+			ls = append(ls, Listener{Port: p})
+		}
+		got := strings.Join(Config{Plugin: DefaultPlugin, Options: tc.opts, Listeners: ls}.Validate(), "; ")
+		if tc.want == "" && got != "" || !strings.Contains(got, tc.want) {
+			t.Errorf("validate(%v) = %q, want %q", tc.opts, got, tc.want)
+		}
+	}
+}
+
+func TestRender(t *testing.T) {
+	t.Parallel()
+	c := Config{Generator: "test", Plugin: DefaultPlugin, Full: true,
+		Listeners: []Listener{{Port: 1883}, {Port: 8883, TLS: true}, {Port: 9001, WebSockets: true}},
+		TLS:       TLS{CertFile: "/tls/cert.pem", KeyFile: "/tls/key.pem"},
+		Options:   map[string]string{"timeout_ms": "1000", "pg_dsn_file": "/run/secrets/dsn"}}
+	var b bytes.Buffer
+	if err := c.Render(&b); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"allow_anonymous false\n",
+		"listener 1883\n\nlistener 8883\ncertfile /tls/cert.pem\nkeyfile /tls/key.pem\n\nlistener 9001\nprotocol websockets\n",
+		"plugin /mosquitto/plugins/auth-plugin\nplugin_opt_pg_dsn_file /run/secrets/dsn\nplugin_opt_timeout_ms  1000\n",
+	} {
+		if !strings.Contains(b.String(), want) {
+			t.Errorf("output missing %q:\n%s", want, b.String())
+		}
+	}
+
+	if !IsGenerated(b.Bytes()) {
+		t.Error("rendered file should be recognised as generated")
+	}
+	c.Full = false
+	b.Reset()
+	c.Render(&b)
+	if strings.Contains(b.String(), "listener") {
+		t.Errorf("plugin block should not contain listeners:\n%s", b.String())
+	}
+}
+
+func TestWarnings(t *testing.T) {
+	t.Parallel()
+	w := strings.Join(Config{Options: map[string]string{"pg_dsn": "postgres://u:secret@db/iot", "fail_open_auth": "true"}}.Warnings(), "\n")
+	for _, want := range []string{"pg_dsn contains a password", "fail_open_auth lets every client"} {
+		if !strings.Contains(w, want) {
+			t.Errorf("warnings missing %q:\n%s", want, w)
+		}
+	}
+	if w := (Config{Options: map[string]string{}}).Warnings(); len(w) != 1 || !strings.Contains(w[0], "PG_DSN") {
+		t.Errorf("warnings = %q", w)
+	}
+}
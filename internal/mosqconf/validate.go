@@ -0,0 +1,638 @@
+package mosqconf
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"auth-plugin/internal/optnames"
+)
+
+// 取值与组合检查与插件的 applyOption/validateOptions 保持一致；插件只在 strict_options 下拒绝启动，
+// 这里在生成前就把这些问题当作错误，避免带着无效配置启动 broker。
+
+var boolOptions = map[string]bool{
+	"acl_check": true, "azure_ad_auth": true, "cert_auto_register": true, "cloudsql_iam_auth": true, "config_audit_table": true, "crdb_follower_reads": true, "disable_acl_check": true, "disable_superuser": true,
+	"disable_basic_auth": true, "enforce_bind": true, "fail_open": true, "fail_open_acl": true,
+	"fail_open_auth": true, "grpc_tls": true, "kafka_tls": true, "self_test": true, "sha256_migration": true, "strict_options": true,
+}
+
+type intRange struct{ min, max int }
+
+var intOptions = map[string]intRange{
+	"alert_dedup_interval":      {0, -1},
+	"crdb_max_retries":          {0, 10},
+	"auth_grace_minutes":        {0, -1},
+	"fail_open_warn_per_minute": {0, -1},
+	"drain_timeout_ms":          {0, 60000},
+	"failure_topk":              {0, 10000},
+	"flags_poll_interval":       {0, -1},
+	"grpc_conns":                {1, 64},
+	"health_down_after":         {0, -1},
+	"health_ping_interval":      {1, -1},
+	"latency_budget_ms":         {0, -1},
+	"latency_window":            {1, -1},
+	"log_dedup_interval":        {0, -1},
+	"log_sample_acl_allow":      {0, -1},
+	"log_sample_auth_allow":     {0, -1},
+	"min_bcrypt_cost":           {4, 31},
+	"pg_dns_refresh":            {0, -1},
+	"pg_max_life_time":          {0, -1},
+	"pg_port":                   {1, 65535},
+	"redis_cache_ttl":           {0, -1},
+	"stats_table_interval":      {0, -1},
+	"statsd_interval":           {1, -1},
+	"sys_interval":              {0, -1},
+	"timeout_ms":                {1, 60000},
+	"totp_skew":                 {0, 2},
+}
+
+// sizeOptions 接受 GOMEMLIMIT 的写法（与插件 parseByteSize 相同）。
+var sizeOptions = map[string]bool{"go_memory_limit": true, "go_memory_ballast": true}
+
+var sizeRe = regexp.MustCompile(`^(?i:off)$|^\d+\s*(B|KiB|MiB|GiB|TiB)?$`)
+
+var choiceOptions = map[string][]string{
+	"cloudsql_ip_type":     {"public", "private"},
+	"compat":               {"", "none", "off", "mosquitto-go-auth", "go-auth", "goauth"},
+	"hasher_salt_encoding": {"base64", "utf-8", "utf8"},
+	"kafka_format":         {"json", "avro"},
+	"kafka_sasl_mechanism": {"", "plain", "scram-sha-256", "scram-sha-512"},
+	"db_driver":            {"postgres", "postgresql", "pg", "mysql", "mariadb", "redis", "grpc"},
+	"log_format":           {"text", "json"},
+	"pg_flavor":            {"postgres", "postgresql", "pg", "cockroachdb", "cockroach", "crdb"},
+	"log_level":            {"error", "warn", "info", "debug", "trace"},
+	"redact_identifiers":   {"off", "hash", "truncate"},
+	"weak_hash_policy":     {"allow", "warn", "reject"},
+}
+
+// aclOnlyOptions 与插件 aclOnlyOptions 相同。
+var aclOnlyOptions = []string{"fail_open_acl", "fallback_acl_file", "pg_aclquery", "pg_superquery", "disable_superuser"}
+
+// postgresOnly 与插件 postgresOnlyOptions 相同。
+var postgresOnly = []string{
+	"pg_dsn", "pg_dsn_file", "pg_password_file", "pg_schema", "pg_session_params",
+	"pg_flavor", "crdb_max_retries", "crdb_follower_reads", "shard_column", "shard_value", "shard_separator",
+	"config_instance", "config_audit_table", "stats_table_interval", "flags_poll_interval", "pg_dns_refresh", "self_test",
+	"cloudsql_instance", "cloudsql_iam_auth", "cloudsql_ip_type", "azure_ad_auth", "azure_client_id", "vault_db_role",
+	"cert_auto_register", "bootstrap_topic", "activation_webhook_url",
+}
+
+// columnName 与插件 shard_column 接受的列名相同。
+var columnName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// checkBootstrap 与插件 checkBootstrap 相同；未设置 bootstrap_response_prefix 时使用默认值。
+func checkBootstrap(topic, users, prefix string, prefixSet bool) string {
+	if !prefixSet {
+		prefix = "bootstrap/response"
+	}
+	switch {
+	case strings.ContainsAny(topic, "+#") || strings.HasPrefix(topic, "$"):
+		return fmt.Sprintf("bootstrap_topic %q must be a plain topic without wildcards or $", topic)
+	case strings.Trim(users, ", ") == "":
+		return "bootstrap_topic needs bootstrap_users"
+	case strings.Trim(prefix, "/") == "" || strings.ContainsAny(prefix, "+#"):
+		return fmt.Sprintf("bootstrap_response_prefix %q must be a non-empty topic without wildcards", prefix)
+	case strings.HasPrefix(topic, strings.TrimSuffix(prefix, "/")+"/"):
+		return "bootstrap_topic must not be under bootstrap_response_prefix"
+	}
+	return ""
+}
+
+// checkPrincipalMap 与插件 parsePrincipalMap 的检查相同。
+func checkPrincipalMap(v string) error {
+	seen := map[string]bool{}
+	for _, item := range strings.Split(v, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		principal, user, ok := strings.Cut(item, "=")
+		principal, user = strings.TrimSpace(principal), strings.TrimSpace(user)
+		if !ok || principal == "" || user == "" {
+			return fmt.Errorf("krb5_principal_map entry %q: want principal=username", item)
+		}
+		if principal != "*" && !strings.Contains(principal, "@") {
+			return fmt.Errorf("krb5_principal_map entry %q: principal needs a realm (name@REALM, *@REALM or *)", item)
+		}
+		if seen[principal] {
+			return fmt.Errorf("krb5_principal_map: %s mapped twice", principal)
+		}
+		seen[principal] = true
+	}
+	if len(seen) == 0 {
+		return errors.New("krb5_principal_map is empty")
+	}
+	return nil
+}
+
+// Driver 返回选项选择的存储：postgres、mysql、redis 或 grpc，写法与插件 parseDBDriver 相同。
+func Driver(opts map[string]string) string {
+	if d, ok := driverName(opts["db_driver"]); ok {
+		return d
+	}
+	return "postgres"
+}
+
+func driverName(v string) (string, bool) {
+	switch strings.ToLower(strings.TrimSpace(v)) {
+	case "postgres", "postgresql", "pg":
+		return "postgres", true
+	case "mysql", "mariadb":
+		return "mysql", true
+	case "redis":
+		return "redis", true
+	case "grpc":
+		return "grpc", true
+	}
+	return "", false
+}
+
+// Backends 返回启用的后端，顺序与写法同插件 parseBackends；未设置 backends（或无法解析）时只有 Driver(opts)。
+func Backends(opts map[string]string) []string {
+	if b, err := parseBackends(opts["backends"]); err == nil {
+		return b
+	}
+	return []string{Driver(opts)}
+}
+
+func parseBackends(v string) ([]string, error) {
+	var out []string
+	seen := map[string]bool{}
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item == "" {
+			continue
+		}
+		parts := strings.Split(item, ":")
+		name, ok := driverName(parts[0])
+		if !ok {
+			return nil, fmt.Errorf("unknown backend %q (want postgres, mysql, redis or grpc)", parts[0])
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("backend %s listed twice", name)
+		}
+		seen[name] = true
+		enabled := true
+		for _, flag := range parts[1:] {
+			switch strings.ToLower(strings.TrimSpace(flag)) {
+			case "required":
+			case "off", "disabled":
+				enabled = false
+			case "on", "enabled":
+				enabled = true
+			default:
+				return nil, fmt.Errorf("backend %s: unknown flag %q (want required or off)", name, flag)
+			}
+		}
+		if enabled {
+			out = append(out, name)
+		}
+	}
+	if len(out) == 0 {
+		return nil, errors.New("no backend enabled")
+	}
+	return out, nil
+}
+
+// goAuthConn 与 goAuthOnly 与插件 goAuthConnOptions/goAuthOnlyOptions 相同。
+var goAuthConn = []string{
+	"pg_host", "pg_port", "pg_user", "pg_password", "pg_dbname",
+	"pg_sslmode", "pg_sslcert", "pg_sslkey", "pg_sslrootcert",
+}
+
+var goAuthOnly = append([]string{
+	"pg_userquery", "pg_superquery", "pg_aclquery", "pg_max_life_time", "disable_superuser", "hasher_salt_encoding",
+}, goAuthConn...)
+
+// GoAuthCompat 判断选项是否打开了 compat mosquitto-go-auth。
+func GoAuthCompat(opts map[string]string) bool {
+	switch strings.ToLower(strings.TrimSpace(opts["compat"])) {
+	case "mosquitto-go-auth", "go-auth", "goauth":
+		return true
+	}
+	return false
+}
+
+// listenerOptions 是可以按端口覆盖的选项。
+var listenerOptions = map[string]bool{
+	"fail_open_auth": true, "fail_open_acl": true, "fail_open": true, "enforce_bind": true, "timeout_ms": true,
+}
+
+// ParseBool 与插件 parseBoolOption 接受的写法相同。
+func ParseBool(v string) (bool, bool) {
+	switch strings.ToLower(strings.TrimSpace(v)) {
+	case "1", "true", "t", "yes", "y", "on":
+		return true, true
+	case "0", "false", "f", "no", "n", "off":
+		return false, true
+	}
+	return false, false
+}
+
+// CheckOption 检查单个选项；name 为 plugin_opt_ 之后的部分。
+func CheckOption(name, v string) error {
+	if strings.ContainsAny(v, "\r\n") {
+		return fmt.Errorf("%s: value cannot span lines", name)
+	}
+	if port, opt, ok := strings.Cut(strings.TrimPrefix(name, optnames.ListenerPrefix), "."); ok && strings.HasPrefix(name, optnames.ListenerPrefix) {
+		if n, err := strconv.Atoi(port); err != nil || n <= 0 || n > 65535 {
+			return fmt.Errorf("%s: %q is not a port", name, port)
+		}
+		if !listenerOptions[opt] {
+			return fmt.Errorf("%s: %s cannot be overridden per listener", name, opt)
+		}
+		return CheckOption(opt, v)
+	}
+	if !optnames.Known(name) {
+		if s := optnames.Suggest(name); s != "" {
+			return fmt.Errorf("unknown option %s (did you mean %s?)", name, s)
+		}
+		return fmt.Errorf("unknown option %s", name)
+	}
+	if boolOptions[name] {
+		if _, ok := ParseBool(v); !ok {
+			return fmt.Errorf("%s=%q: want true or false", name, v)
+		}
+	}
+	if r, ok := intOptions[name]; ok {
+		n, err := strconv.Atoi(strings.TrimSpace(v))
+		if err != nil || n < r.min || (r.max >= 0 && n > r.max) {
+			if r.max >= 0 {
+				return fmt.Errorf("%s=%q: want %d-%d", name, v, r.min, r.max)
+			}
+			return fmt.Errorf("%s=%q: want an integer >= %d", name, v, r.min)
+		}
+	}
+	if sizeOptions[name] && !sizeRe.MatchString(strings.TrimSpace(v)) {
+		return fmt.Errorf("%s=%q: want a size such as 512MiB or 2GiB", name, v)
+	}
+	if name == "go_gc_percent" {
+		if n, err := strconv.Atoi(strings.TrimSpace(v)); (err != nil || n < -1) && !strings.EqualFold(strings.TrimSpace(v), "off") {
+			return fmt.Errorf("%s=%q: want a percentage >= 0 or off", name, v)
+		}
+	}
+	if name == "backends" {
+		if _, err := parseBackends(v); err != nil {
+			return fmt.Errorf("%s=%q: %v", name, v, err)
+		}
+	}
+	if choices, ok := choiceOptions[name]; ok {
+		lv := strings.ToLower(strings.TrimSpace(v))
+		found := false
+		for _, c := range choices {
+			found = found || c == lv
+		}
+		if !found {
+			return fmt.Errorf("%s=%q: want one of %s", name, v, strings.Join(choices, "/"))
+		}
+	}
+	return nil
+}
+
+// checkCombos 对应插件 validateOptions 中的组合规则，opts 为最终要写出的选项。
+func checkCombos(opts map[string]string, listeners []int) []string {
+	set := func(k string) bool { _, ok := opts[k]; return ok }
+	isTrue := func(k string) bool { b, _ := ParseBool(opts[k]); return b }
+	num := func(k string, def int) int {
+		if n, err := strconv.Atoi(strings.TrimSpace(opts[k])); err == nil {
+			return n
+		}
+		return def
+	}
+	var problems []string
+	if set("fail_open") && (set("fail_open_auth") || set("fail_open_acl")) {
+		problems = append(problems, "fail_open is deprecated and conflicts with fail_open_auth/fail_open_acl")
+	}
+	if (isTrue("fail_open_auth") || isTrue("fail_open")) && num("auth_grace_minutes", 0) > 0 {
+		problems = append(problems, "auth_grace_minutes has no effect while fail_open_auth=true")
+	}
+	if gc := strings.TrimSpace(opts["go_gc_percent"]); (strings.EqualFold(gc, "off") || gc == "-1") && !set("go_memory_limit") {
+		problems = append(problems, "go_gc_percent=off without go_memory_limit lets the plugin's heap grow without bound")
+	}
+	// ACL 检查默认关闭；旧选项 disable_acl_check 与 acl_check 相反
+	aclCheck := isTrue("acl_check")
+	if set("disable_acl_check") {
+		if set("acl_check") {
+			problems = append(problems, "disable_acl_check is deprecated and conflicts with acl_check")
+		}
+		aclCheck = !isTrue("disable_acl_check")
+	}
+	if !aclCheck {
+		for _, k := range aclOnlyOptions {
+			if set(k) {
+				problems = append(problems, k+" has no effect without acl_check=true")
+			}
+		}
+	}
+	if isTrue("disable_basic_auth") {
+		if !aclCheck {
+			problems = append(problems, "disable_basic_auth is set and acl_check is off; the plugin checks nothing")
+		}
+		for _, k := range []string{"fail_open_auth", "auth_grace_minutes", "enforce_bind"} {
+			if set(k) {
+				problems = append(problems, k+" has no effect with disable_basic_auth=true")
+			}
+		}
+	}
+	if p := opts["weak_hash_policy"]; p == "" || strings.EqualFold(p, "allow") {
+		if set("min_bcrypt_cost") || set("sha256_migration") {
+			problems = append(problems, "min_bcrypt_cost/sha256_migration have no effect with weak_hash_policy=allow")
+		}
+	}
+	for _, dep := range []struct {
+		on   string
+		deps []string
+	}{
+		{"otel_endpoint", []string{"otel_service_name", "otel_sample_ratio"}},
+		{"health_down_after", []string{"health_ping_interval"}},
+		{"kafka_brokers", []string{"kafka_topic", "kafka_tls", "kafka_sasl_mechanism", "kafka_username", "kafka_password",
+			"kafka_password_file", "kafka_format", "kafka_schema_registry"}},
+		{"kafka_sasl_mechanism", []string{"kafka_username", "kafka_password", "kafka_password_file"}},
+		{"statsd_addr", []string{"statsd_prefix", "statsd_tags", "statsd_interval"}},
+		{"latency_budget_ms", []string{"latency_window"}},
+		{"cloudsql_instance", []string{"cloudsql_iam_auth", "cloudsql_ip_type"}},
+		{"azure_ad_auth", []string{"azure_client_id"}},
+		{"admin_listen", []string{"admin_tls_cert", "admin_tls_key", "admin_client_ca", "admin_allowed_clients"}},
+		{"vault_db_role", []string{"vault_addr", "vault_token", "vault_token_file", "vault_namespace", "vault_ca_file", "vault_db_mount"}},
+	} {
+		// 空值、0 和布尔假都视为未启用
+		v := strings.TrimSpace(opts[dep.on])
+		if v != "" && v != "0" && (!boolOptions[dep.on] || isTrue(dep.on)) {
+			continue
+		}
+		for _, k := range dep.deps {
+			if set(k) {
+				problems = append(problems, k+" has no effect without "+dep.on)
+			}
+		}
+	}
+	if set("admin_listen") {
+		if !set("admin_tls_cert") || !set("admin_tls_key") || !set("admin_client_ca") {
+			problems = append(problems, "admin_listen needs admin_tls_cert, admin_tls_key and admin_client_ca")
+		} else if strings.TrimSpace(opts["shard_column"]) != "" || GoAuthCompat(opts) {
+			problems = append(problems, "admin_listen does not support shard_column or compat mosquitto-go-auth")
+		}
+	}
+	if set("kafka_brokers") && !set("kafka_topic") {
+		problems = append(problems, "kafka_brokers needs kafka_topic")
+	}
+	if strings.TrimSpace(opts["kafka_sasl_mechanism"]) != "" && !set("kafka_username") {
+		problems = append(problems, "kafka_sasl_mechanism needs kafka_username")
+	}
+	if set("kafka_password") && set("kafka_password_file") {
+		problems = append(problems, "kafka_password and kafka_password_file both set; kafka_password_file takes precedence")
+	}
+	if avro := strings.EqualFold(strings.TrimSpace(opts["kafka_format"]), "avro"); avro && !set("kafka_schema_registry") {
+		problems = append(problems, "kafka_format=avro needs kafka_schema_registry")
+	} else if !avro && set("kafka_schema_registry") {
+		problems = append(problems, "kafka_schema_registry has no effect without kafka_format=avro")
+	}
+	if set("log_file") && !strings.EqualFold(opts["log_format"], "json") {
+		problems = append(problems, "log_file has no effect without log_format=json")
+	}
+	if b := num("latency_budget_ms", 0); b > 0 && b >= num("timeout_ms", 1500) {
+		problems = append(problems, fmt.Sprintf("latency_budget_ms=%d is not below timeout_ms=%d", b, num("timeout_ms", 1500)))
+	}
+	if set("redact_salt") && !strings.EqualFold(opts["redact_identifiers"], "hash") {
+		problems = append(problems, "redact_salt has no effect without redact_identifiers=hash")
+	}
+	if set("pg_dsn") && set("pg_dsn_file") {
+		problems = append(problems, "pg_dsn and pg_dsn_file both set; pg_dsn_file takes precedence")
+	}
+	if set("pg_password_file") && (set("vault_db_role") || isTrue("azure_ad_auth") || isTrue("cloudsql_iam_auth")) {
+		problems = append(problems, "pg_password_file is overridden by token/Vault credentials")
+	}
+	if num("health_down_after", 0) <= 0 && (set("fallback_password_file") || set("fallback_acl_file")) {
+		problems = append(problems, "fallback_password_file/fallback_acl_file are only used while the database is marked down and need health_down_after")
+	}
+	backends := Backends(opts)
+	uses := func(name string) bool {
+		for _, b := range backends {
+			if b == name {
+				return true
+			}
+		}
+		return false
+	}
+	desc := "db_driver=" + Driver(opts)
+	if GoAuthCompat(opts) {
+		if opts["pg_userquery"] == "" {
+			problems = append(problems, "compat mosquitto-go-auth needs pg_userquery")
+		}
+		if !uses("postgres") {
+			problems = append(problems, "compat mosquitto-go-auth only applies to the postgres backend")
+		}
+		for _, k := range []string{"enforce_bind", "self_test"} {
+			if set(k) {
+				problems = append(problems, k+" has no effect with compat mosquitto-go-auth; it needs this plugin's tables")
+			}
+		}
+		if set("pg_dsn") || set("pg_dsn_file") {
+			for _, k := range goAuthConn {
+				if set(k) {
+					problems = append(problems, k+" is ignored because pg_dsn/pg_dsn_file is set")
+				}
+			}
+		}
+	} else {
+		for _, k := range goAuthOnly {
+			if set(k) {
+				problems = append(problems, k+" is a mosquitto-go-auth option and has no effect without compat mosquitto-go-auth")
+			}
+		}
+	}
+	switch strings.ToLower(strings.TrimSpace(opts["pg_flavor"])) {
+	case "cockroachdb", "cockroach", "crdb":
+		if isTrue("crdb_follower_reads") && GoAuthCompat(opts) {
+			problems = append(problems, "crdb_follower_reads has no effect with compat mosquitto-go-auth; pg_userquery and pg_aclquery run as written")
+		}
+	default:
+		for _, k := range []string{"crdb_max_retries", "crdb_follower_reads"} {
+			if set(k) {
+				problems = append(problems, k+" has no effect without pg_flavor cockroachdb")
+			}
+		}
+	}
+	if col := strings.TrimSpace(opts["shard_column"]); col == "" {
+		for _, k := range []string{"shard_value", "shard_separator"} {
+			if set(k) {
+				problems = append(problems, k+" has no effect without shard_column")
+			}
+		}
+	} else if !columnName.MatchString(col) {
+		problems = append(problems, fmt.Sprintf("shard_column %q is not a column name", col))
+	} else if GoAuthCompat(opts) {
+		problems = append(problems, "shard_column has no effect with compat mosquitto-go-auth; pg_userquery and pg_aclquery run as written")
+	} else if sep, ok := opts["shard_separator"]; strings.TrimSpace(opts["shard_value"]) == "" && ok && strings.TrimSpace(sep) == "" {
+		problems = append(problems, "shard_column needs shard_value or a non-empty shard_separator to find the shard key")
+	}
+	if strings.TrimSpace(opts["krb5_keytab"]) == "" {
+		for _, k := range []string{"krb5_service", "krb5_principal_map"} {
+			if set(k) {
+				problems = append(problems, k+" has no effect without krb5_keytab")
+			}
+		}
+	} else if err := checkPrincipalMap(opts["krb5_principal_map"]); err != nil {
+		problems = append(problems, err.Error())
+	}
+	if isTrue("cert_auto_register") {
+		switch {
+		case !aclCheck:
+			problems = append(problems, "cert_auto_register has no effect without acl_check=true")
+		case strings.TrimSpace(opts["shard_column"]) != "":
+			problems = append(problems, "cert_auto_register does not support shard_column")
+		case GoAuthCompat(opts):
+			problems = append(problems, "cert_auto_register has no effect with compat mosquitto-go-auth")
+		}
+	}
+	if topic := strings.TrimSpace(opts["bootstrap_topic"]); topic == "" {
+		for _, k := range []string{"bootstrap_users", "bootstrap_response_prefix"} {
+			if set(k) {
+				problems = append(problems, k+" has no effect without bootstrap_topic")
+			}
+		}
+	} else if problem := checkBootstrap(topic, opts["bootstrap_users"], opts["bootstrap_response_prefix"], set("bootstrap_response_prefix")); problem != "" {
+		problems = append(problems, problem)
+	} else if !aclCheck {
+		problems = append(problems, "bootstrap_topic has no effect without acl_check=true")
+	} else if strings.TrimSpace(opts["shard_column"]) != "" || GoAuthCompat(opts) {
+		problems = append(problems, "bootstrap_topic does not support shard_column or compat mosquitto-go-auth")
+	}
+	if hook := strings.TrimSpace(opts["activation_webhook_url"]); hook == "" {
+		if set("activation_webhook_secret") {
+			problems = append(problems, "activation_webhook_secret has no effect without activation_webhook_url")
+		}
+	} else if u, err := url.Parse(hook); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		problems = append(problems, "activation_webhook_url must be an http(s) URL")
+	} else if strings.TrimSpace(opts["shard_column"]) != "" || GoAuthCompat(opts) {
+		problems = append(problems, "activation_webhook_url does not support shard_column or compat mosquitto-go-auth")
+	}
+	if set("backends") {
+		desc = "backends=" + strings.Join(backends, ",")
+		if set("db_driver") {
+			problems = append(problems, "db_driver has no effect when backends is set")
+		}
+	}
+	if !uses("postgres") {
+		for _, k := range postgresOnly {
+			if set(k) {
+				problems = append(problems, k+" is PostgreSQL-only and has no effect with "+desc)
+			}
+		}
+	}
+	if !uses("mysql") && (set("mysql_dsn") || set("mysql_dsn_file")) {
+		problems = append(problems, "mysql_dsn/mysql_dsn_file have no effect without db_driver=mysql or mysql in backends")
+	}
+	cacheTTL := num("redis_cache_ttl", 0)
+	if !uses("postgres") && !uses("mysql") && cacheTTL > 0 {
+		problems = append(problems, "redis_cache_ttl has no effect with "+desc)
+	}
+	if strings.TrimSpace(opts["totp_users"]) == "" {
+		if set("totp_skew") {
+			problems = append(problems, "totp_skew has no effect without totp_users")
+		}
+	} else if !uses("postgres") && !uses("mysql") {
+		problems = append(problems, "totp_users needs a postgres or mysql backend (totp_secret column); those accounts cannot log in with "+desc)
+	} else if uses("grpc") {
+		problems = append(problems, "totp_users cannot be combined with the grpc backend: the authorizer does not check the code, so those accounts cannot log in through it")
+	}
+	if uses("grpc") {
+		if len(backends) == 1 {
+			for _, k := range []string{"enforce_bind", "weak_hash_policy", "min_bcrypt_cost", "sha256_migration"} {
+				if set(k) {
+					problems = append(problems, k+" has no effect with db_driver=grpc; the authorizer decides")
+				}
+			}
+		}
+		if addr := opts["grpc_addr"]; addr != "" && !isTrue("grpc_tls") && !loopbackTarget(addr) {
+			problems = append(problems, "grpc_addr "+addr+" is not a loopback address and grpc_tls is off; passwords are sent in clear text")
+		}
+	} else {
+		for _, k := range []string{"grpc_addr", "grpc_tls", "grpc_ca_file", "grpc_cert_file", "grpc_key_file", "grpc_conns"} {
+			if set(k) {
+				problems = append(problems, k+" has no effect without db_driver=grpc or grpc in backends")
+			}
+		}
+	}
+	if !isTrue("grpc_tls") && (set("grpc_ca_file") || set("grpc_cert_file") || set("grpc_key_file")) {
+		problems = append(problems, "grpc_ca_file/grpc_cert_file/grpc_key_file have no effect without grpc_tls")
+	}
+	if set("grpc_cert_file") != set("grpc_key_file") {
+		problems = append(problems, "grpc_cert_file and grpc_key_file must be set together")
+	}
+	if !uses("redis") && cacheTTL == 0 && (set("redis_url") || set("redis_prefix")) {
+		problems = append(problems, "redis_url/redis_prefix have no effect without db_driver=redis, redis in backends or redis_cache_ttl")
+	}
+	if set("mysql_dsn") && set("mysql_dsn_file") {
+		problems = append(problems, "mysql_dsn and mysql_dsn_file both set; mysql_dsn_file takes precedence")
+	}
+	if addr := opts["pprof_listen"]; addr != "" && !loopback(addr) {
+		problems = append(problems, "pprof_listen "+addr+" is not a loopback address")
+	}
+	if len(listeners) > 0 {
+		for k := range opts {
+			port, _, ok := strings.Cut(strings.TrimPrefix(k, optnames.ListenerPrefix), ".")
+			if !ok || !strings.HasPrefix(k, optnames.ListenerPrefix) {
+				continue
+			}
+			if n, _ := strconv.Atoi(port); !containsInt(listeners, n) {
+				problems = append(problems, k+" overrides port "+port+", which is not a configured listener")
+			}
+		}
+	}
+	sort.Strings(problems)
+	return problems
+}
+
+// loopback 与插件 isLoopbackAddr 相同。
+func loopback(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip, err := netip.ParseAddr(host)
+	return err == nil && ip.Unmap().IsLoopback()
+}
+
+// loopbackTarget 与插件 isLoopbackTarget 相同。
+func loopbackTarget(target string) bool {
+	if strings.HasPrefix(target, "unix:") {
+		return true
+	}
+	if _, rest, ok := strings.Cut(target, ":///"); ok {
+		target = rest
+	}
+	return loopback(target)
+}
+
+func containsInt(s []int, n int) bool {
+	for _, v := range s {
+		if v == n {
+			return true
+		}
+	}
+	return false
+}
+
+// dsnHasPassword 用于提示不要把密码写进 mosquitto.conf。
+func dsnHasPassword(dsn string) bool {
+	if u, err := url.Parse(dsn); err == nil && (u.Scheme == "postgres" || u.Scheme == "postgresql") {
+		_, ok := u.User.Password()
+		return ok
+	}
+	for _, f := range strings.Fields(dsn) {
+		if strings.HasPrefix(f, "password=") {
+			return true
+		}
+	}
+	return false
+}
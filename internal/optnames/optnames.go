@@ -0,0 +1,209 @@
+// Package optnames 列出插件认识的 plugin_opt_ 选项名，供不能链接插件本体的命令行工具
+// （doctor）检查 mosquitto.conf。插件的 TestOptionNamesInSync 保证与 pluginOptions 一致。
+package optnames
+
+import "strings"
+
+// ListenerPrefix 开头的键是按端口的覆盖项：listener_<port>.<option>。
+const ListenerPrefix = "listener_"
+
+// Names 按字母排序。
+var Names = []string{
+	"acl_cache_seconds",
+	"acl_check",
+	"acl_jitter_seconds",
+	"activation_webhook_secret",
+	"activation_webhook_url",
+	"admin_allowed_clients",
+	"admin_client_ca",
+	"admin_listen",
+	"admin_tls_cert",
+	"admin_tls_key",
+	"alert_dedup_interval",
+	"alert_webhook_url",
+	"application_name",
+	"auth_cache_seconds",
+	"auth_grace_minutes",
+	"auth_jitter_seconds",
+	"azure_ad_auth",
+	"azure_client_id",
+	"backends",
+	"bootstrap_response_prefix",
+	"bootstrap_topic",
+	"bootstrap_users",
+	"cache",
+	"cache_refresh",
+	"cache_reset",
+	"cache_type",
+	"cert_auto_register",
+	"cloudsql_iam_auth",
+	"cloudsql_instance",
+	"cloudsql_ip_type",
+	"compat",
+	"config_audit_table",
+	"config_instance",
+	"control_users",
+	"crdb_follower_reads",
+	"crdb_max_retries",
+	"db_driver",
+	"disable_acl_check",
+	"disable_basic_auth",
+	"disable_superuser",
+	"drain_timeout_ms",
+	"enforce_bind",
+	"fail_open",
+	"fail_open_acl",
+	"fail_open_auth",
+	"fail_open_warn_per_minute",
+	"failure_topk",
+	"fallback_acl_file",
+	"fallback_password_file",
+	"flags_poll_interval",
+	"go_gc_percent",
+	"go_memory_ballast",
+	"go_memory_limit",
+	"grpc_addr",
+	"grpc_ca_file",
+	"grpc_cert_file",
+	"grpc_conns",
+	"grpc_key_file",
+	"grpc_tls",
+	"hasher",
+	"hasher_algorithm",
+	"hasher_cost",
+	"hasher_iterations",
+	"hasher_keylen",
+	"hasher_memory",
+	"hasher_parallelism",
+	"hasher_salt_encoding",
+	"hasher_salt_size",
+	"health_down_after",
+	"health_ping_interval",
+	"kafka_brokers",
+	"kafka_format",
+	"kafka_password",
+	"kafka_password_file",
+	"kafka_sasl_mechanism",
+	"kafka_schema_registry",
+	"kafka_tls",
+	"kafka_topic",
+	"kafka_username",
+	"krb5_keytab",
+	"krb5_principal_map",
+	"krb5_service",
+	"latency_budget_ms",
+	"latency_window",
+	"log_dedup_interval",
+	"log_dest",
+	"log_file",
+	"log_format",
+	"log_level",
+	"log_sample_acl_allow",
+	"log_sample_auth_allow",
+	"min_bcrypt_cost",
+	"mysql_dsn",
+	"mysql_dsn_file",
+	"otel_endpoint",
+	"otel_sample_ratio",
+	"otel_service_name",
+	"pg_aclquery",
+	"pg_connect_tries",
+	"pg_dbname",
+	"pg_dns_refresh",
+	"pg_dsn",
+	"pg_dsn_file",
+	"pg_flavor",
+	"pg_host",
+	"pg_max_life_time",
+	"pg_password",
+	"pg_password_file",
+	"pg_port",
+	"pg_schema",
+	"pg_session_params",
+	"pg_sslcert",
+	"pg_sslkey",
+	"pg_sslmode",
+	"pg_sslrootcert",
+	"pg_superquery",
+	"pg_user",
+	"pg_userquery",
+	"pprof_listen",
+	"pyroscope_app_name",
+	"pyroscope_tenant_id",
+	"pyroscope_url",
+	"redact_identifiers",
+	"redact_salt",
+	"redis_cache_ttl",
+	"redis_prefix",
+	"redis_url",
+	"self_test",
+	"sha256_migration",
+	"shard_column",
+	"shard_separator",
+	"shard_value",
+	"stats_table_interval",
+	"statsd_addr",
+	"statsd_interval",
+	"statsd_prefix",
+	"statsd_tags",
+	"strict_options",
+	"sys_interval",
+	"timeout_ms",
+	"totp_skew",
+	"totp_users",
+	"vault_addr",
+	"vault_ca_file",
+	"vault_db_mount",
+	"vault_db_role",
+	"vault_namespace",
+	"vault_token",
+	"vault_token_file",
+	"weak_hash_policy",
+}
+
+// Known 判断 k（plugin_opt_ 之后的部分）是否为插件选项；监听端口覆盖项检查点号后的选项名。
+func Known(k string) bool {
+	if rest, ok := strings.CutPrefix(k, ListenerPrefix); ok {
+		_, k, ok = strings.Cut(rest, ".")
+		if !ok {
+			return false
+		}
+	}
+	for _, n := range Names {
+		if n == k {
+			return true
+		}
+	}
+	return false
+}
+
+// Suggest 为拼写错误的键找编辑距离不超过 2 的已知选项，没有则返回空串。
+func Suggest(k string) string {
+	best, bestDist := "", 3
+	for _, name := range Names {
+		if d := EditDistance(k, name); d < bestDist {
+			best, bestDist = name, d
+		}
+	}
+	return best
+}
+
+func EditDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
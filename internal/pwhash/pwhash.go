@@ -0,0 +1,133 @@
+// Package pwhash 生成 iot_devices.password_hash 可用的密码哈希，供 bcryptgen 使用；
+// 每种格式都能被插件的 verifyPassword 校验（见 hash.go、goauthhash.go 与根目录的 TestVerifyGeneratedHashes）。
+//
+// Params.Algo 选择格式：
+//
+//	sha256       hex(sha256(password+salt))，salt 单独存放在 salt 列（插件当前格式）
+//	sha256-salt  同 sha256，但每个密码随机生成 16 字节（hex）盐，忽略 Salt
+//	bcrypt       $2a$<cost>$...
+//	argon2id     PHC 格式 $argon2id$v=19$m=<KiB>,t=<time>,p=<threads>$<salt>$<hash>，无填充标准 base64
+//	pbkdf2       mosquitto-go-auth 格式 PBKDF2$<sha256|sha512>$<iter>$<salt>$<hash>，带填充标准 base64
+//
+// 后三种的盐内嵌在哈希串中，salt 列为空。
+package pwhash
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"hash"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// Params 是生成哈希的参数，未使用的字段按 Algo 忽略。
+type Params struct {
+	Algo                   string
+	Salt                   string // 仅 sha256
+	Cost                   int    // bcrypt
+	ArgonTime, ArgonMemory uint32
+	ArgonThreads           uint8
+	PBKDF2Iter             int
+	PBKDF2Hash             string // sha256 或 sha512
+}
+
+// Func 返回写入 password_hash 与 salt 两列的值。
+type Func func(password string) (hash, salt string, err error)
+
+func randomSalt(n int) ([]byte, error) {
+	b := make([]byte, n)
+	_, err := rand.Read(b)
+	return b, err
+}
+
+// New 检查参数并返回对应格式的哈希函数。
+func New(p Params) (Func, error) {
+	switch p.Algo {
+	case "sha256":
+		return func(pw string) (string, string, error) {
+			return SHA256Salt(pw, p.Salt), p.Salt, nil
+		}, nil
+	case "sha256-salt":
+		return func(pw string) (string, string, error) {
+			b, err := randomSalt(16)
+			if err != nil {
+				return "", "", err
+			}
+			salt := hex.EncodeToString(b)
+			return SHA256Salt(pw, salt), salt, nil
+		}, nil
+	case "bcrypt":
+		if p.Cost < bcrypt.MinCost || p.Cost > bcrypt.MaxCost {
+			return nil, fmt.Errorf("bcrypt cost must be %d-%d", bcrypt.MinCost, bcrypt.MaxCost)
+		}
+		return func(pw string) (string, string, error) {
+			h, err := bcrypt.GenerateFromPassword([]byte(pw), p.Cost)
+			return string(h), "", err
+		}, nil
+	case "argon2id":
+		if p.ArgonTime < 1 || p.ArgonMemory < 8*uint32(p.ArgonThreads) || p.ArgonThreads < 1 {
+			return nil, fmt.Errorf("argon2id needs time >= 1, threads >= 1 and memory >= 8*threads KiB")
+		}
+		return func(pw string) (string, string, error) {
+			salt, err := randomSalt(16)
+			if err != nil {
+				return "", "", err
+			}
+			key := argon2.IDKey([]byte(pw), salt, p.ArgonTime, p.ArgonMemory, p.ArgonThreads, 32)
+			return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version,
+				p.ArgonMemory, p.ArgonTime, p.ArgonThreads,
+				base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), "", nil
+		}, nil
+	case "pbkdf2":
+		var newHash func() hash.Hash
+		var keyLen int
+		switch p.PBKDF2Hash {
+		case "sha256":
+			newHash, keyLen = sha256.New, sha256.Size
+		case "sha512":
+			newHash, keyLen = sha512.New, sha512.Size
+		default:
+			return nil, fmt.Errorf("pbkdf2 hash must be sha256 or sha512")
+		}
+		if p.PBKDF2Iter < 1 {
+			return nil, fmt.Errorf("pbkdf2 iterations must be >= 1")
+		}
+		return func(pw string) (string, string, error) {
+			salt, err := randomSalt(16)
+			if err != nil {
+				return "", "", err
+			}
+			key := pbkdf2.Key([]byte(pw), salt, p.PBKDF2Iter, keyLen, newHash)
+			return fmt.Sprintf("PBKDF2$%s$%d$%s$%s", p.PBKDF2Hash, p.PBKDF2Iter,
+				base64.StdEncoding.EncodeToString(salt), base64.StdEncoding.EncodeToString(key)), "", nil
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown algo %q (want sha256, sha256-salt, bcrypt, argon2id or pbkdf2)", p.Algo)
+}
+
+// SHA256Salt 是旧格式 hex(sha256(password+salt))。
+func SHA256Salt(pwd, salt string) string {
+	sum := sha256.Sum256([]byte(pwd + salt))
+	return hex.EncodeToString(sum[:])
+}
+
+// mosquitto password_file（mosquitto_passwd 2.x）格式：$7$<iterations>$<salt>$<hash>，
+// PBKDF2-HMAC-SHA512，12 字节盐、64 字节哈希，带填充的标准 base64。
+const mosquittoIterations = 101
+
+// Mosquitto 生成 mosquitto password_file 中的哈希，与 Params 无关。
+func Mosquitto(password string) (string, error) {
+	salt, err := randomSalt(12)
+	if err != nil {
+		return "", err
+	}
+	key := pbkdf2.Key([]byte(password), salt, mosquittoIterations, sha512.Size, sha512.New)
+	return fmt.Sprintf("$7$%d$%s$%s", mosquittoIterations,
+		base64.StdEncoding.EncodeToString(salt), base64.StdEncoding.EncodeToString(key)), nil
+}
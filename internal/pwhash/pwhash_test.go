@@ -0,0 +1,57 @@
+package pwhash
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestHashFormats(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		p      Params
+		prefix string
+	}{
+		{Params{Algo: "bcrypt", Cost: 4}, "$2a$04$"},
+		{Params{Algo: "argon2id", ArgonTime: 1, ArgonMemory: 64, ArgonThreads: 1}, "$argon2id$v=19$m=64,t=1,p=1$"},
+		{Params{Algo: "pbkdf2", PBKDF2Iter: 10, PBKDF2Hash: "sha512"}, "PBKDF2$sha512$10$"},
+	}
+	for _, tc := range tests {
+		hf, err := New(tc.p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		h1, salt, err := hf("pw")
+		if err != nil {
+			t.Fatal(err)
+		}
+		h2, _, _ := hf("pw")
+		if !strings.HasPrefix(h1, tc.prefix) || salt != "" || h1 == h2 {
+			t.Fatalf("%s: hash %q salt %q, want prefix %s, empty salt and a fresh salt per call", tc.p.Algo, h1, salt, tc.prefix)
+		}
+	}
+
+	for _, bad := range []Params{
+		{Algo: "md5"},
+		{Algo: "bcrypt", Cost: 99},
+		{Algo: "pbkdf2", PBKDF2Iter: 1, PBKDF2Hash: "md5"},
+		{Algo: "pbkdf2", PBKDF2Iter: 0, PBKDF2Hash: "sha256"},
+		{Algo: "argon2id", ArgonTime: 0, ArgonMemory: 64, ArgonThreads: 1},
+	} {
+		if _, err := New(bad); err == nil {
+			t.Fatalf("New(%+v) should fail", bad)
+		}
+	}
+}
+
+func TestSHA256RandomSalt(t *testing.T) {
+	t.Parallel()
+	hf, err := New(Params{Algo: "sha256-salt", Salt: "ignored"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h1, s1, _ := hf("pw")
+	_, s2, _ := hf("pw")
+	if len(s1) != 32 || h1 != SHA256Salt("pw", s1) || s1 == s2 {
+		t.Fatalf("hash %q salt %q, want a fresh 16-byte hex salt per call", h1, s1)
+	}
+}
@@ -0,0 +1,219 @@
+// Package shacrypt 是 glibc crypt(3) 的 SHA-256-crypt（$5$）与 SHA-512-crypt（$6$）实现，
+// 插件校验这两种哈希，命令行工具（import、useradm）用它识别格式，使旧嵌入式 Linux 设备
+// /etc/shadow 中的密码可以原样导入。
+//
+// 格式：$5$[rounds=N$]<salt>$<hash>，盐最多 16 个字符，rounds 默认 5000、范围 1000-999999999；
+// 哈希为 crypt 专用的 base64（./0-9A-Za-z，无填充），$5$ 为 43 个字符、$6$ 为 86 个字符。
+// mosquitto 1.x 的 $6$<salt>$<hash> 使用标准 base64（88 个字符，带 == 填充），据此与 SHA-512-crypt 区分。
+package shacrypt
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"hash"
+	"strconv"
+	"strings"
+)
+
+const (
+	DefaultRounds = 5000
+	minRounds     = 1000
+	maxRounds     = 999999999
+	maxSaltLen    = 16
+)
+
+const itoa64 = "./0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// Parsed 是拆开的 SHA-crypt 哈希。
+type Parsed struct {
+	Variant      string // "5" 或 "6"
+	Rounds       int
+	CustomRounds bool // 哈希中写了 rounds=，重新计算时要原样输出
+	Salt         string
+	Hash         string
+}
+
+// Parse 拆开 SHA-crypt 哈希；不是 SHA-crypt（包括 mosquitto 的 $6$）时 ok 为 false。
+func Parse(h string) (p Parsed, ok bool) {
+	switch {
+	case strings.HasPrefix(h, "$5$"):
+		p.Variant = "5"
+	case strings.HasPrefix(h, "$6$"):
+		p.Variant = "6"
+	default:
+		return p, false
+	}
+	rest := h[3:]
+	p.Rounds = DefaultRounds
+	if r, ok := strings.CutPrefix(rest, "rounds="); ok {
+		n, after, found := strings.Cut(r, "$")
+		v, err := strconv.Atoi(n)
+		if !found || err != nil || v < 1 {
+			return p, false
+		}
+		p.Rounds, p.CustomRounds, rest = min(max(v, minRounds), maxRounds), true, after
+	}
+	salt, sum, found := strings.Cut(rest, "$")
+	if !found || len(salt) > maxSaltLen || strings.Contains(sum, "$") {
+		return p, false
+	}
+	want := 43
+	if p.Variant == "6" {
+		want = 86
+	}
+	if len(sum) != want || strings.Trim(sum, itoa64) != "" {
+		return p, false
+	}
+	p.Salt, p.Hash = salt, sum
+	return p, true
+}
+
+// Is 判断 h 是否为 SHA-crypt 哈希。
+func Is(h string) bool {
+	_, ok := Parse(h)
+	return ok
+}
+
+// Verify 判断密码是否与哈希匹配；格式错误视为不匹配。
+func Verify(h, password string) bool {
+	p, ok := Parse(h)
+	if !ok {
+		return false
+	}
+	got := Crypt(p.Variant, password, p.Salt, p.Rounds, p.CustomRounds)
+	return subtle.ConstantTimeCompare([]byte(got), []byte(h)) == 1
+}
+
+// Crypt 计算完整的哈希字符串（含 $5$/$6$ 前缀），与 glibc crypt(3) 的输出一致。
+func Crypt(variant, password, salt string, rounds int, customRounds bool) string {
+	newHash := sha256.New
+	if variant == "6" {
+		newHash = sha512.New
+	}
+	if len(salt) > maxSaltLen {
+		salt = salt[:maxSaltLen]
+	}
+	rounds = min(max(rounds, minRounds), maxRounds)
+	sum := digest(newHash, []byte(password), []byte(salt), rounds)
+
+	var b strings.Builder
+	b.WriteString("$" + variant + "$")
+	if customRounds {
+		b.WriteString("rounds=" + strconv.Itoa(rounds) + "$")
+	}
+	b.WriteString(salt + "$")
+	if variant == "6" {
+		encode(&b, sum, sha512Order)
+	} else {
+		encode(&b, sum, sha256Order)
+	}
+	return b.String()
+}
+
+func digest(newHash func() hash.Hash, pw, salt []byte, rounds int) []byte {
+	h := newHash()
+	size := h.Size()
+
+	// B = H(P S P)
+	h.Write(pw)
+	h.Write(salt)
+	h.Write(pw)
+	b := h.Sum(nil)
+
+	// A = H(P S B... 按密码长度的二进制位交替加入 B 与 P)
+	h.Reset()
+	h.Write(pw)
+	h.Write(salt)
+	n := len(pw)
+	for ; n > size; n -= size {
+		h.Write(b)
+	}
+	h.Write(b[:n])
+	for n = len(pw); n > 0; n >>= 1 {
+		if n&1 != 0 {
+			h.Write(b)
+		} else {
+			h.Write(pw)
+		}
+	}
+	a := h.Sum(nil)
+
+	// P' 与 S'
+	h.Reset()
+	for range pw {
+		h.Write(pw)
+	}
+	p := repeat(h.Sum(nil), len(pw))
+	h.Reset()
+	for i := 0; i < 16+int(a[0]); i++ {
+		h.Write(salt)
+	}
+	s := repeat(h.Sum(nil), len(salt))
+
+	for i := 0; i < rounds; i++ {
+		h.Reset()
+		if i&1 != 0 {
+			h.Write(p)
+		} else {
+			h.Write(a)
+		}
+		if i%3 != 0 {
+			h.Write(s)
+		}
+		if i%7 != 0 {
+			h.Write(p)
+		}
+		if i&1 != 0 {
+			h.Write(a)
+		} else {
+			h.Write(p)
+		}
+		a = h.Sum(a[:0])
+	}
+	return a
+}
+
+// repeat 把 block 重复拼接并截断到 n 字节。
+func repeat(block []byte, n int) []byte {
+	out := make([]byte, 0, n)
+	for len(out) < n {
+		out = append(out, block[:min(len(block), n-len(out))]...)
+	}
+	return out
+}
+
+// 每组三个字节按 crypt 规定的顺序取出，转换成 4 个字符；最后一组不足三字节。
+var (
+	sha256Order = [][3]int{
+		{0, 10, 20}, {21, 1, 11}, {12, 22, 2}, {3, 13, 23}, {24, 4, 14},
+		{15, 25, 5}, {6, 16, 26}, {27, 7, 17}, {18, 28, 8}, {9, 19, 29},
+		{-1, 31, 30},
+	}
+	sha512Order = [][3]int{
+		{0, 21, 42}, {22, 43, 1}, {44, 2, 23}, {3, 24, 45}, {25, 46, 4},
+		{47, 5, 26}, {6, 27, 48}, {28, 49, 7}, {50, 8, 29}, {9, 30, 51},
+		{31, 52, 10}, {53, 11, 32}, {12, 33, 54}, {34, 55, 13}, {56, 14, 35},
+		{15, 36, 57}, {37, 58, 16}, {59, 17, 38}, {18, 39, 60}, {40, 61, 19},
+		{62, 20, 41}, {-1, -1, 63},
+	}
+)
+
+func encode(b *strings.Builder, sum []byte, order [][3]int) {
+	for _, o := range order {
+		var w uint32
+		chars := 4
+		for _, i := range o {
+			w <<= 8
+			if i < 0 {
+				chars--
+				continue
+			}
+			w |= uint32(sum[i])
+		}
+		for ; chars > 0; chars-- {
+			b.WriteByte(itoa64[w&0x3f])
+			w >>= 6
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package shacrypt
+
+import (
+	"strings"
+	"testing"
+)
+
+// 期望值来自 glibc crypt(3)。
+var vectors = []struct{ password, hash string }{
+	{"Hello world!", "$5$saltstring$5B8vYYiY.CVt1RlTTf8KbXBH3hsxY/GNooZaBBGWEc5"},
+	{"Hello world!", "$6$saltstring$svn8UoSVapNtMuq1ukKS4tPQd8iKwSMHWjl/O817G3uBnIFNjnQJuesI68u4OTLiBFdcbYEdFCoEOfaS35inz1"},
+	{"Hello world!", "$5$rounds=10000$saltstringsaltst$3xv.VbSHBb41AL9AvLeujZkZRBAwqFMz2.opqey6IcA"},
+	{"Hello world!", "$6$rounds=10000$saltstringsaltst$OW1/O6BYHV6BcXZu8QVeXbDWra3Oeqh0sbHbbMCVNSnCM/UrjmM0Dp8vOuZeHBy/YTBmSK6H9qs/y3RnOaw5v."},
+	{"", "$5$abc$bBHLwRRW2Li0XKaX13kz/g2fkDil4Jx46aNvd.48MS8"},
+	{strings.Repeat("a", 70), "$5$abc$gcCXVpno.S5ZvEYJ.yPlNi5AHu3o.baf3N8qTZUwwJ."},
+	{"pässwörd", "$6$0123456789abcdef$SbYrq9vmP3mhdocMu6pAC/f.xWxY2daFD3BB.LQwWeU2vm9Kk529r2RRD35SLt1PrlKfEVlyiymFPnfNDWfx6."},
+	{strings.Repeat("a", 70), "$6$rounds=1000$s$4bXcaupns/PBbLFh5spHQowZ0F2Ts19sX7fv5m1ZOJxnh3CWI3z6nE2QTn1oCGJzKUBEE3qxd/2MbHAuhSQRq."},
+}
+
+func TestVerify(t *testing.T) {
+	t.Parallel()
+	for _, v := range vectors {
+		if !Verify(v.hash, v.password) {
+			p, _ := Parse(v.hash)
+			t.Errorf("Verify(%q, %q) = false, computed %s", v.hash, v.password, Crypt(p.Variant, v.password, p.Salt, p.Rounds, p.CustomRounds))
+		}
+		if Verify(v.hash, v.password+"x") {
+			t.Errorf("Verify(%q) accepted a wrong password", v.hash)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	t.Parallel()
+	p, ok := Parse(vectors[3].hash)
+	if !ok || p.Variant != "6" || p.Rounds != 10000 || !p.CustomRounds || p.Salt != "saltstringsaltst" {
+		t.Fatalf("Parse = %+v, %v", p, ok)
+	}
+	for _, h := range []string{
+		"$6$c2FsdA==$" + strings.Repeat("A", 86) + "==", // mosquitto 1.x 的 $6$（标准 base64）
+		"$7$101$c2FsdA==$aGFzaA==",
+		"$2a$10$abcdefghijklmnopqrstuu",
+		"$5$salt$tooshort",
+		"$5$rounds=x$salt$" + strings.Repeat("a", 43),
+		"$5$saltsaltsaltsaltsalt$" + strings.Repeat("a", 43),
+		"$6$salt$" + strings.Repeat("+", 86),
+	} {
+		if Is(h) {
+			t.Errorf("Is(%q) = true", h)
+		}
+	}
+}
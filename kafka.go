@@ -0,0 +1,315 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/hamba/avro/v2"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"github.com/twmb/franz-go/pkg/sr"
+
+	"auth-plugin/internal/kafkasasl"
+)
+
+// 把认证/ACL 判定事件写入 Kafka topic，供安全团队实时消费。客户端是 franz-go：acks=all 且幂等写入，
+// key 为用户名（murmur2 分区，与 Java 客户端默认分区器一致），同一用户的事件保持有序；支持 TLS 与
+// SASL（PLAIN、SCRAM-SHA-256/512）。kafka_format=json 时 value 与 log_format json 的结构相同；
+// avro 时按 Confluent Schema Registry 的格式编码（magic 0 + 4 字节 schema ID + Avro 二进制），
+// schema 在后台注册到 <topic>-value，注册完成前的事件计为丢弃。
+// 事件进入客户端缓冲区异步发送，绝不阻塞 broker 回调；缓冲区满或投递失败的事件计数并记录告警。
+
+const (
+	kafkaMaxBuffered     = 10000
+	kafkaDeliveryTimeout = 30 * time.Second
+	kafkaFlushTimeout    = 5 * time.Second
+	kafkaRegistryTimeout = 10 * time.Second
+	kafkaRegistryRetry   = 10 * time.Second
+	kafkaClientID        = "mosq-pg"
+
+	kafkaFormatJSON = "json"
+	kafkaFormatAvro = "avro"
+)
+
+var (
+	kafkaBrokers        string // host:port,host:port
+	kafkaTopic          string
+	kafkaTLS            bool
+	kafkaSASLMechanism  string // 空表示不使用 SASL
+	kafkaUsername       string
+	kafkaPassword       string
+	kafkaPasswordFile   string // 优先于 kafka_password
+	kafkaFormat         = kafkaFormatJSON
+	kafkaSchemaRegistry string // kafka_format=avro 时必需
+
+	kafkaClient   *kgo.Client // nil 表示未启用
+	kafkaSchemaID atomic.Int32
+	kafkaStop     chan struct{}
+	kafkaDone     chan struct{}
+	kafkaDropped  atomic.Int64 // 缓冲区满或 schema 尚未注册而丢弃
+	kafkaFailed   atomic.Int64 // 编码失败或投递失败
+)
+
+func parseKafkaFormat(v string) (string, bool) {
+	switch f := strings.ToLower(strings.TrimSpace(v)); f {
+	case kafkaFormatJSON, kafkaFormatAvro:
+		return f, true
+	}
+	return "", false
+}
+
+// decisionAvroSchema 与判定事件的 JSON 字段一一对应（判定事件没有 change）；可选字段为 null 联合类型。
+const decisionAvroSchema = `{
+  "type": "record",
+  "name": "Decision",
+  "namespace": "mosq_pg",
+  "fields": [
+    {"name": "timestamp", "type": "string"},
+    {"name": "level", "type": "string"},
+    {"name": "event", "type": "string"},
+    {"name": "conn_id", "type": ["null", "string"], "default": null},
+    {"name": "username", "type": ["null", "string"], "default": null},
+    {"name": "clientid", "type": ["null", "string"], "default": null},
+    {"name": "topic", "type": ["null", "string"], "default": null},
+    {"name": "result", "type": ["null", "string"], "default": null},
+    {"name": "backend", "type": ["null", "string"], "default": null},
+    {"name": "reason", "type": ["null", "string"], "default": null},
+    {"name": "rule", "type": ["null", "string"], "default": null},
+    {"name": "mqtt_rc", "type": ["null", "int"], "default": null},
+    {"name": "latency_ms", "type": ["null", "double"], "default": null},
+    {"name": "sample_rate", "type": ["null", "int"], "default": null},
+    {"name": "error", "type": ["null", "string"], "default": null},
+    {"name": "msg", "type": ["null", "string"], "default": null}
+  ]
+}`
+
+var decisionSchema = avro.MustParse(decisionAvroSchema)
+
+type avroDecision struct {
+	Timestamp  string   `avro:"timestamp"`
+	Level      string   `avro:"level"`
+	Event      string   `avro:"event"`
+	ConnID     *string  `avro:"conn_id"`
+	Username   *string  `avro:"username"`
+	ClientID   *string  `avro:"clientid"`
+	Topic      *string  `avro:"topic"`
+	Result     *string  `avro:"result"`
+	Backend    *string  `avro:"backend"`
+	Reason     *string  `avro:"reason"`
+	Rule       *string  `avro:"rule"`
+	MQTTReason *int     `avro:"mqtt_rc"`
+	LatencyMS  *float64 `avro:"latency_ms"`
+	SampleRate *int     `avro:"sample_rate"`
+	Error      *string  `avro:"error"`
+	Message    *string  `avro:"msg"`
+}
+
+// optional 把零值转换为 null，与 JSON 的 omitempty 一致。
+func optional[T comparable](v T) *T {
+	var zero T
+	if v == zero {
+		return nil
+	}
+	return &v
+}
+
+func toAvroDecision(rec logRecord) avroDecision {
+	return avroDecision{
+		Timestamp: rec.Timestamp, Level: rec.Level, Event: rec.Event,
+		ConnID: optional(rec.ConnID), Username: optional(rec.Username), ClientID: optional(rec.ClientID),
+		Topic: optional(rec.Topic), Result: optional(rec.Result), Backend: optional(rec.Backend),
+		Reason: optional(rec.Reason), Rule: optional(rec.Rule), MQTTReason: optional(rec.MQTTReason),
+		LatencyMS: rec.LatencyMS, SampleRate: optional(rec.SampleRate),
+		Error: optional(rec.Error), Message: optional(rec.Message),
+	}
+}
+
+// encodeDecision 按 kafka_format 编码事件；avro 的 schema 尚未注册时返回 ok=false。
+func encodeDecision(rec logRecord) (value []byte, ok bool, err error) {
+	if kafkaFormat != kafkaFormatAvro {
+		value, err = json.Marshal(rec)
+		return value, true, err
+	}
+	id := kafkaSchemaID.Load()
+	if id == 0 {
+		return nil, false, nil
+	}
+	var h sr.ConfluentHeader
+	value, err = h.AppendEncode(nil, int(id), nil)
+	if err != nil {
+		return nil, true, err
+	}
+	body, err := avro.Marshal(decisionSchema, toAvroDecision(rec))
+	return append(value, body...), true, err
+}
+
+// --- 客户端 ---
+
+// kafkaClientOptions 把 kafka_* 选项转换为 franz-go 客户端选项。
+func kafkaClientOptions() ([]kgo.Opt, error) {
+	var brokers []string
+	for _, b := range strings.Split(kafkaBrokers, ",") {
+		if b = strings.TrimSpace(b); b != "" {
+			brokers = append(brokers, b)
+		}
+	}
+	opts := []kgo.Opt{
+		kgo.SeedBrokers(brokers...),
+		kgo.ClientID(kafkaClientID),
+		kgo.DefaultProduceTopic(kafkaTopic),
+		kgo.RequiredAcks(kgo.AllISRAcks()),
+		kgo.MaxBufferedRecords(kafkaMaxBuffered),
+		kgo.RecordDeliveryTimeout(kafkaDeliveryTimeout),
+	}
+	if kafkaTLS {
+		opts = append(opts, kgo.DialTLSConfig(&tls.Config{MinVersion: tls.VersionTLS12}))
+	}
+	password := kafkaPassword
+	if kafkaPasswordFile != "" {
+		var err error
+		if password, err = readSecretFile(kafkaPasswordFile); err != nil {
+			return nil, fmt.Errorf("read kafka_password_file: %w", err)
+		}
+	}
+	m, err := kafkasasl.Mechanism(kafkaSASLMechanism, kafkaUsername, password)
+	if err != nil {
+		return nil, fmt.Errorf("kafka: %w", err)
+	}
+	if m != nil {
+		opts = append(opts, kgo.SASL(m))
+	}
+	return opts, nil
+}
+
+// newSchemaRegistry 建立 Schema Registry 客户端；URL 中的 user:password 用作 basic auth。
+func newSchemaRegistry(raw string) (*sr.Client, error) {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil || u.Host == "" {
+		return nil, errors.New("invalid kafka_schema_registry, want http(s)://[user:password@]host[:port]")
+	}
+	opts := []sr.ClientOpt{sr.UserAgent("mosq-pg-auth")}
+	if u.User != nil {
+		pass, _ := u.User.Password()
+		opts = append(opts, sr.BasicAuth(u.User.Username(), pass))
+		u.User = nil
+	}
+	opts = append(opts, sr.URLs(u.String()))
+	return sr.NewClient(opts...)
+}
+
+// registerDecisionSchema 注册（或查到已有的）schema 并记下其 ID，失败时按固定间隔重试直到 stop。
+func registerDecisionSchema(rc *sr.Client, subject string, stop chan struct{}) {
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), kafkaRegistryTimeout)
+		ss, err := rc.CreateSchema(ctx, subject, sr.Schema{Schema: decisionAvroSchema, Type: sr.TypeAvro})
+		cancel()
+		if err == nil {
+			kafkaSchemaID.Store(int32(ss.ID))
+			mosqLog(logInfo, "auth-plugin: kafka: Avro schema registered as %s id %d", subject, ss.ID)
+			return
+		}
+		mosqLogDeduped(logWarning, "auth-plugin: kafka: cannot register Avro schema %s: %v (retrying in %s, events are dropped meanwhile)",
+			subject, err, kafkaRegistryRetry)
+		select {
+		case <-stop:
+			return
+		case <-time.After(kafkaRegistryRetry):
+		}
+	}
+}
+
+func startKafka() error {
+	if kafkaBrokers == "" {
+		return nil
+	}
+	if kafkaTopic == "" {
+		return errors.New("kafka_brokers requires kafka_topic")
+	}
+	if kafkaFormat == kafkaFormatAvro && kafkaSchemaRegistry == "" {
+		return errors.New("kafka_format=avro requires kafka_schema_registry")
+	}
+	opts, err := kafkaClientOptions()
+	if err != nil {
+		return err
+	}
+	var rc *sr.Client
+	if kafkaFormat == kafkaFormatAvro {
+		if rc, err = newSchemaRegistry(kafkaSchemaRegistry); err != nil {
+			return fmt.Errorf("kafka: %w", err)
+		}
+	}
+	// 客户端在第一次发送时才连接 broker，Kafka 不可用不会阻止插件启动
+	cl, err := kgo.NewClient(opts...)
+	if err != nil {
+		return fmt.Errorf("kafka: %w", err)
+	}
+	stop, done := make(chan struct{}), make(chan struct{})
+	kafkaClient, kafkaStop, kafkaDone = cl, stop, done
+	kafkaSchemaID.Store(0)
+	go func() {
+		defer close(done)
+		if rc != nil {
+			registerDecisionSchema(rc, kafkaTopic+"-value", stop)
+		}
+	}()
+	return nil
+}
+
+// stopKafka 在 kafkaFlushTimeout 内发送缓冲区中剩余的事件后关闭客户端。
+func stopKafka() {
+	cl := kafkaClient
+	if cl == nil {
+		return
+	}
+	close(kafkaStop)
+	<-kafkaDone
+	kafkaClient, kafkaStop, kafkaDone = nil, nil, nil
+
+	ctx, cancel := context.WithTimeout(context.Background(), kafkaFlushTimeout)
+	defer cancel()
+	if err := cl.Flush(ctx); err != nil {
+		mosqLog(logWarning, "auth-plugin: kafka: %d decision events not delivered before shutdown", cl.BufferedProduceRecords())
+	}
+	cl.Close()
+}
+
+// kafkaDelivered 是每条事件的投递回调，在 franz-go 的协程中执行。
+func kafkaDelivered(_ *kgo.Record, err error) {
+	switch {
+	case err == nil:
+	case errors.Is(err, kgo.ErrMaxBuffered):
+		kafkaDropped.Add(1)
+		mosqLogDeduped(logWarning, "auth-plugin: kafka: %d decision events waiting for delivery, dropping new ones", kafkaMaxBuffered)
+	default:
+		kafkaFailed.Add(1)
+		mosqLogDeduped(logWarning, "auth-plugin: kafka: decision event not delivered: %v", err)
+	}
+}
+
+// publishDecision 把判定事件交给客户端缓冲区，立即返回。
+func publishDecision(rec logRecord) {
+	cl := kafkaClient
+	if cl == nil || !featureFlags.on(flagKafka) {
+		return
+	}
+	if rec.Timestamp == "" {
+		rec.Timestamp = time.Now().UTC().Format(time.RFC3339Nano)
+	}
+	value, ok, err := encodeDecision(rec)
+	switch {
+	case err != nil:
+		kafkaFailed.Add(1)
+		mosqLogDeduped(logWarning, "auth-plugin: kafka: cannot encode decision event: %v", err)
+		return
+	case !ok:
+		kafkaDropped.Add(1)
+		return
+	}
+	cl.TryProduce(context.Background(), &kgo.Record{Key: []byte(rec.Username), Value: value}, kafkaDelivered)
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hamba/avro/v2"
+	"github.com/twmb/franz-go/pkg/kfake"
+	"github.com/twmb/franz-go/pkg/kgo"
+	"github.com/twmb/franz-go/pkg/sasl/scram"
+)
+
+// startFakeKafka 启动一个要求 SCRAM-SHA-256 的单节点集群，并让插件以对应选项连接它。
+func startFakeKafka(t *testing.T, topic string) *kfake.Cluster {
+	t.Helper()
+	c, err := kfake.NewCluster(
+		kfake.NumBrokers(1),
+		kfake.SeedTopics(1, topic),
+		kfake.EnableSASL(),
+		kfake.Superuser("SCRAM-SHA-256", "mqtt", "secret"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(c.Close)
+
+	pwFile := filepath.Join(t.TempDir(), "kafka-password")
+	if err := os.WriteFile(pwFile, []byte("secret\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	old := []string{kafkaBrokers, kafkaTopic, kafkaSASLMechanism, kafkaUsername, kafkaPasswordFile, kafkaFormat, kafkaSchemaRegistry}
+	t.Cleanup(func() {
+		stopKafka()
+		kafkaBrokers, kafkaTopic, kafkaSASLMechanism, kafkaUsername = old[0], old[1], old[2], old[3]
+		kafkaPasswordFile, kafkaFormat, kafkaSchemaRegistry = old[4], old[5], old[6]
+	})
+	kafkaBrokers, kafkaTopic = c.ListenAddrs()[0], topic
+	kafkaSASLMechanism, kafkaUsername, kafkaPasswordFile = "scram-sha-256", "mqtt", pwFile
+	kafkaFormat, kafkaSchemaRegistry = kafkaFormatJSON, ""
+	return c
+}
+
+// consumeAll 读取 topic 中的 n 条记录。
+func consumeAll(t *testing.T, c *kfake.Cluster, topic string, n int) []*kgo.Record {
+	t.Helper()
+	cl, err := kgo.NewClient(
+		kgo.SeedBrokers(c.ListenAddrs()...),
+		kgo.SASL(scram.Auth{User: "mqtt", Pass: "secret"}.AsSha256Mechanism()),
+		kgo.ConsumeTopics(topic),
+		kgo.ConsumeResetOffset(kgo.NewOffset().AtStart()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cl.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	var recs []*kgo.Record
+	for len(recs) < n {
+		fs := cl.PollFetches(ctx)
+		if err := ctx.Err(); err != nil {
+			t.Fatalf("got %d of %d records: %v", len(recs), n, err)
+		}
+		recs = append(recs, fs.Records()...)
+	}
+	return recs
+}
+
+func TestKafkaPublishJSON(t *testing.T) {
+	c := startFakeKafka(t, "decisions")
+	if err := startKafka(); err != nil {
+		t.Fatal(err)
+	}
+	publishDecision(logRecord{Level: "info", Event: "auth", Username: "alice", Result: "allow"})
+	publishDecision(logRecord{Level: "info", Event: "acl", Username: "bob", Topic: "t/1", Result: "deny", Reason: "no_rule"})
+	stopKafka() // 发送剩余事件
+
+	recs := consumeAll(t, c, "decisions", 2)
+	for i, want := range []struct{ key, event string }{{"alice", "auth"}, {"bob", "acl"}} {
+		var got logRecord
+		if err := json.Unmarshal(recs[i].Value, &got); err != nil {
+			t.Fatal(err)
+		}
+		if string(recs[i].Key) != want.key || got.Event != want.event || got.Timestamp == "" {
+			t.Fatalf("record %d = %s %s, want key %s event %s", i, recs[i].Key, recs[i].Value, want.key, want.event)
+		}
+	}
+}
+
+func TestKafkaPublishAvro(t *testing.T) {
+	c := startFakeKafka(t, "decisions")
+	// 注册后 sr 客户端还会按 ID 查回 subject 与版本
+	replies := map[string]string{
+		"POST /subjects/decisions-value/versions":  `{"id":7}`,
+		"GET /schemas/ids/7/versions":              `[{"subject":"decisions-value","version":1}]`,
+		"GET /subjects/decisions-value/versions/1": `{"subject":"decisions-value","version":1,"id":7,"schema":"{}"}`,
+	}
+	registry := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reply, ok := replies[r.Method+" "+r.URL.Path]
+		if user, pass, _ := r.BasicAuth(); !ok || user != "sr" || pass != "pw" {
+			http.Error(w, `{"error_code":404,"message":"not found"}`, http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/vnd.schemaregistry.v1+json")
+		w.Write([]byte(reply))
+	}))
+	defer registry.Close()
+	kafkaFormat = kafkaFormatAvro
+	kafkaSchemaRegistry = "http://sr:pw@" + registry.Listener.Addr().String()
+
+	if err := startKafka(); err != nil {
+		t.Fatal(err)
+	}
+	for deadline := time.Now().Add(5 * time.Second); kafkaSchemaID.Load() == 0; time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("schema not registered")
+		}
+	}
+	latency := 1.5
+	publishDecision(logRecord{Level: "info", Event: "auth", Username: "alice", Result: "allow", LatencyMS: &latency})
+	stopKafka()
+
+	v := consumeAll(t, c, "decisions", 1)[0].Value
+	if v[0] != 0 || binary.BigEndian.Uint32(v[1:5]) != 7 {
+		t.Fatalf("Confluent header = % x, want 00 00000007", v[:5])
+	}
+	var got avroDecision
+	if err := avro.Unmarshal(decisionSchema, v[5:], &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Event != "auth" || got.Username == nil || *got.Username != "alice" || got.Topic != nil || got.LatencyMS == nil || *got.LatencyMS != 1.5 {
+		t.Fatalf("decoded %+v", got)
+	}
+}
+
+func TestKafkaDelivered(t *testing.T) {
+	dropped, failed := kafkaDropped.Load(), kafkaFailed.Load()
+	kafkaDelivered(nil, nil)
+	kafkaDelivered(nil, kgo.ErrMaxBuffered)
+	kafkaDelivered(nil, errors.New("record timed out"))
+	if kafkaDropped.Load()-dropped != 1 || kafkaFailed.Load()-failed != 1 {
+		t.Fatalf("dropped +%d failed +%d, want +1 each", kafkaDropped.Load()-dropped, kafkaFailed.Load()-failed)
+	}
+}
+
+func TestKafkaStartErrors(t *testing.T) {
+	startFakeKafka(t, "decisions")
+	kafkaUsername = ""
+	if err := startKafka(); err == nil {
+		stopKafka()
+		t.Fatal("SASL without a username must fail")
+	}
+	kafkaUsername, kafkaFormat = "mqtt", kafkaFormatAvro
+	if err := startKafka(); err == nil {
+		stopKafka()
+		t.Fatal("kafka_format=avro without kafka_schema_registry must fail")
+	}
+}
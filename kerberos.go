@@ -0,0 +1,184 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jcmturner/gokrb5/v8/keytab"
+	"github.com/jcmturner/gokrb5/v8/service"
+	"github.com/jcmturner/gokrb5/v8/spnego"
+
+	"auth-plugin/pkg/mosqplugin"
+)
+
+// Kerberos（GSSAPI）认证：给运维人员用的看板/工具通过 MQTT v5 增强认证登录，不必在 iot_devices 里发密码。
+//
+//   - 客户端在 CONNECT 中带 Authentication Method "GSSAPI"，Authentication Data 为 GSS-API 初始上下文
+//     令牌（KRB5 OID + AP-REQ，即 gss_init_sec_context 的第一个输出令牌）；单轮完成，不返回 AP-REP（无双向认证）；
+//   - 票据用 krb5_keytab 中的服务密钥校验（krb5_service 指定使用的主体，默认按票据的 sname 查找），
+//     重放由 gokrb5 的重放缓存拦截；
+//   - 校验通过的主体按 krb5_principal_map 映射成插件用户名（角色），并设置为该连接的用户名，
+//     之后的 ACL 判定按这个用户名在 acls 中查规则；没有映射的主体被拒绝。
+//   - 其他 Authentication Method 返回 MOSQ_ERR_PLUGIN_DEFER，交给其他插件处理。
+
+const krb5AuthMethod = "GSSAPI"
+
+var (
+	krb5Keytab       string
+	krb5Service      string
+	krb5PrincipalMap string
+
+	krb5Mu       sync.Mutex
+	krb5Settings *service.Settings
+	krb5Roles    principalMap
+)
+
+// principalMap 把 Kerberos 主体映射成用户名：先精确匹配 name@REALM，再匹配 *@REALM，最后匹配 *。
+type principalMap map[string]string
+
+// parsePrincipalMap 解析 "alice@CORP.EXAMPLE=ops-admin,*@CORP.EXAMPLE=ops-viewer"。
+func parsePrincipalMap(v string) (principalMap, error) {
+	m := principalMap{}
+	for _, item := range strings.Split(v, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		principal, user, ok := strings.Cut(item, "=")
+		principal, user = strings.TrimSpace(principal), strings.TrimSpace(user)
+		if !ok || principal == "" || user == "" {
+			return nil, fmt.Errorf("krb5_principal_map entry %q: want principal=username", item)
+		}
+		if principal != "*" && !strings.Contains(principal, "@") {
+			return nil, fmt.Errorf("krb5_principal_map entry %q: principal needs a realm (name@REALM, *@REALM or *)", item)
+		}
+		if _, dup := m[principal]; dup {
+			return nil, fmt.Errorf("krb5_principal_map: %s mapped twice", principal)
+		}
+		m[principal] = user
+	}
+	if len(m) == 0 {
+		return nil, errors.New("krb5_principal_map is empty")
+	}
+	return m, nil
+}
+
+func (m principalMap) lookup(name, realm string) (string, bool) {
+	for _, k := range []string{name + "@" + realm, "*@" + realm, "*"} {
+		if u, ok := m[k]; ok {
+			return u, true
+		}
+	}
+	return "", false
+}
+
+// loadKerberos 读取 keytab 与主体映射；krb5_keytab 为空时不启用。
+func loadKerberos() error {
+	krb5Mu.Lock()
+	defer krb5Mu.Unlock()
+	krb5Settings, krb5Roles = nil, nil
+	if krb5Keytab == "" {
+		return nil
+	}
+	kt, err := keytab.Load(krb5Keytab)
+	if err != nil {
+		return fmt.Errorf("krb5_keytab: %w", err)
+	}
+	roles, err := parsePrincipalMap(krb5PrincipalMap)
+	if err != nil {
+		return err
+	}
+	opts := []func(*service.Settings){service.MaxClockSkew(5 * time.Minute)}
+	if krb5Service != "" {
+		opts = append(opts, service.KeytabPrincipal(krb5Service))
+	}
+	krb5Settings, krb5Roles = service.NewSettings(kt, opts...), roles
+	return nil
+}
+
+// verifyKRB5Token 校验 GSS-API KRB5 初始令牌，返回映射后的用户名与主体（name@REALM）。
+func verifyKRB5Token(data []byte) (username, principal string, err error) {
+	krb5Mu.Lock()
+	settings, roles := krb5Settings, krb5Roles
+	krb5Mu.Unlock()
+	if settings == nil {
+		return "", "", errors.New("kerberos is not configured")
+	}
+	var tok spnego.KRB5Token
+	if err := tok.Unmarshal(data); err != nil {
+		return "", "", err
+	}
+	if !tok.IsAPReq() {
+		return "", "", errors.New("token is not an AP-REQ")
+	}
+	ok, creds, err := service.VerifyAPREQ(&tok.APReq, settings)
+	if err != nil {
+		return "", "", err
+	}
+	if !ok {
+		return "", "", errors.New("AP-REQ not valid")
+	}
+	name, realm := creds.CName().PrincipalNameString(), creds.Domain()
+	principal = name + "@" + realm
+	username, ok = roles.lookup(name, realm)
+	if !ok {
+		return "", principal, fmt.Errorf("principal %s is not in krb5_principal_map", principal)
+	}
+	return username, principal, nil
+}
+
+// registerKerberos 在配置了 krb5_keytab 时加载 keytab 并注册 EXT_AUTH_START 回调。
+func registerKerberos(h *mosqplugin.Handle) error {
+	if krb5Keytab == "" {
+		return nil
+	}
+	if err := loadKerberos(); err != nil {
+		return err
+	}
+	if err := h.OnExtAuthStart(kerberosAuthStart); err != nil {
+		return err
+	}
+	mosqLog(logInfo, "auth-plugin: kerberos enabled (auth method %s, keytab %s)", krb5AuthMethod, krb5Keytab)
+	return nil
+}
+
+// kerberosAuthStart 是 EXT_AUTH_START 回调：校验 GSSAPI 令牌，把连接的用户名设为主体映射出的用户名。
+func kerberosAuthStart(c mosqplugin.Client, method string, data []byte) mosqplugin.Result {
+	if method != krb5AuthMethod {
+		return mosqplugin.Defer
+	}
+	clientID, address := c.ID(), clientAddress(c)
+	connID := connIDs.assign(c.Key())
+
+	start, result := time.Now(), resultDeny
+	var err error
+	var username, principal string
+	defer func() {
+		recordLatency("auth", start)
+		logDecision("auth", connID, username, clientID, "", start, result, decision{backend: backendKerberos}, err)
+		if result != resultAllow {
+			connIDs.remove(c.Key())
+		}
+	}()
+
+	username, principal, err = verifyKRB5Token(data)
+	if err != nil {
+		authDenied.Add(1)
+		recordAuthFailure(principal, address)
+		mosqLogDeduped(logNotice, "auth-plugin: kerberos login refused: "+err.Error())
+		return mosqplugin.AuthDenied
+	}
+	if err = c.SetUsername(username); err != nil {
+		authErrors.Add(1)
+		result = resultError
+		return mosqplugin.AuthDenied
+	}
+	authAllowed.Add(1)
+	result = resultAllow
+	mosqLog(logInfo, "auth-plugin: kerberos principal %s logged in as %s (client %s, conn %s)",
+		redactID(principal), redactID(username), redactID(clientID), connID)
+	return mosqplugin.Success
+}
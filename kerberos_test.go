@@ -0,0 +1,115 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jcmturner/gokrb5/v8/client"
+	"github.com/jcmturner/gokrb5/v8/config"
+	"github.com/jcmturner/gokrb5/v8/iana/etypeID"
+	"github.com/jcmturner/gokrb5/v8/iana/nametype"
+	"github.com/jcmturner/gokrb5/v8/keytab"
+	"github.com/jcmturner/gokrb5/v8/messages"
+	"github.com/jcmturner/gokrb5/v8/spnego"
+	"github.com/jcmturner/gokrb5/v8/types"
+)
+
+func TestParsePrincipalMap(t *testing.T) {
+	t.Parallel()
+	m, err := parsePrincipalMap("alice@CORP.EXAMPLE=ops-admin, *@CORP.EXAMPLE=ops-viewer,*=guest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct{ name, realm, want string }{
+		{"alice", "CORP.EXAMPLE", "ops-admin"},
+		{"bob", "CORP.EXAMPLE", "ops-viewer"},
+		{"carol", "OTHER.EXAMPLE", "guest"},
+	}
+	for _, tt := range tests {
+		if got, ok := m.lookup(tt.name, tt.realm); !ok || got != tt.want {
+			t.Errorf("lookup(%s@%s) = %q, %v, want %q", tt.name, tt.realm, got, ok, tt.want)
+		}
+	}
+	strict, _ := parsePrincipalMap("alice@CORP.EXAMPLE=ops-admin")
+	if _, ok := strict.lookup("bob", "CORP.EXAMPLE"); ok {
+		t.Error("unmapped principal should not match")
+	}
+	for _, bad := range []string{"", "alice=ops", "alice@R", "*=a,*=b"} {
+		if _, err := parsePrincipalMap(bad); err == nil {
+			t.Errorf("parsePrincipalMap(%q) should fail", bad)
+		}
+	}
+}
+
+// krb5Token 不经过 KDC，直接用服务密钥签发票据并生成客户端的 AP-REQ 令牌。
+func krb5Token(t *testing.T, kt *keytab.Keytab, user, realm string) []byte {
+	t.Helper()
+	now := time.Now().UTC()
+	cname := types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, user)
+	sname := types.NewPrincipalName(nametype.KRB_NT_SRV_INST, "mqtt/broker.corp.example")
+	tkt, key, err := messages.NewTicket(cname, realm, sname, "CORP.EXAMPLE", types.NewKrbFlags(), kt,
+		etypeID.AES256_CTS_HMAC_SHA1_96, 1, now, now, now.Add(time.Hour), now.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cl := client.NewWithPassword(user, realm, "unused", config.New())
+	tok, err := spnego.NewKRB5TokenAPREQ(cl, tkt, key, []int{}, []int{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := tok.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestVerifyKRB5Token(t *testing.T) {
+	oldKeytab, oldService, oldMap := krb5Keytab, krb5Service, krb5PrincipalMap
+	t.Cleanup(func() {
+		krb5Keytab, krb5Service, krb5PrincipalMap = oldKeytab, oldService, oldMap
+		_ = loadKerberos()
+	})
+
+	kt := keytab.New()
+	if err := kt.AddEntry("mqtt/broker.corp.example", "CORP.EXAMPLE", "service-secret", time.Now(), 1, etypeID.AES256_CTS_HMAC_SHA1_96); err != nil {
+		t.Fatal(err)
+	}
+	raw, err := kt.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "mqtt.keytab")
+	if err := os.WriteFile(path, raw, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := verifyKRB5Token([]byte{0x60}); err == nil {
+		t.Fatal("tokens should be refused while kerberos is not configured")
+	}
+	krb5Keytab, krb5Service, krb5PrincipalMap = path, "mqtt/broker.corp.example", "alice@CORP.EXAMPLE=ops-admin"
+	if err := loadKerberos(); err != nil {
+		t.Fatal(err)
+	}
+
+	user, principal, err := verifyKRB5Token(krb5Token(t, kt, "alice", "CORP.EXAMPLE"))
+	if err != nil || user != "ops-admin" || principal != "alice@CORP.EXAMPLE" {
+		t.Fatalf("verify(alice) = %q, %q, %v", user, principal, err)
+	}
+	_, principal, err = verifyKRB5Token(krb5Token(t, kt, "mallory", "CORP.EXAMPLE"))
+	if err == nil || principal != "mallory@CORP.EXAMPLE" || !strings.Contains(err.Error(), "not in krb5_principal_map") {
+		t.Fatalf("verify(mallory) = %q, %v", principal, err)
+	}
+
+	other := keytab.New()
+	_ = other.AddEntry("mqtt/broker.corp.example", "CORP.EXAMPLE", "wrong-secret", time.Now(), 1, etypeID.AES256_CTS_HMAC_SHA1_96)
+	if _, _, err := verifyKRB5Token(krb5Token(t, other, "alice", "CORP.EXAMPLE")); err == nil {
+		t.Fatal("a ticket for another service key should be refused")
+	}
+	if _, _, err := verifyKRB5Token([]byte("not a token")); err == nil {
+		t.Fatal("garbage should be refused")
+	}
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// 认证 / ACL 耗时直方图：固定桶，累计计数供 getLatency 查看；另按 latency_window 滚动一个窗口，
+// 窗口结束时计算 p50/p99，若 p99 超过 latency_budget_ms 则输出警告——通常早于超时与 fail-open。
+// 桶上界即分位数估计值（偏保守）；超出最大桶的部分以窗口内最大值计。
+
+var latencyBounds = []time.Duration{
+	250 * time.Microsecond, 500 * time.Microsecond,
+	time.Millisecond, 2500 * time.Microsecond, 5 * time.Millisecond,
+	10 * time.Millisecond, 25 * time.Millisecond, 50 * time.Millisecond,
+	100 * time.Millisecond, 250 * time.Millisecond, 500 * time.Millisecond,
+	time.Second, 2500 * time.Millisecond, 5 * time.Second,
+}
+
+// latencyMinSamples 窗口内样本过少时不做预算判断，避免个别慢请求触发告警。
+const latencyMinSamples = 100
+
+var (
+	latencyBudget = time.Duration(0) // 0 表示不检查
+	latencyWindow = time.Minute
+
+	authLatency = newLatencyHist()
+	aclLatency  = newLatencyHist()
+)
+
+type latencyCounts struct {
+	buckets []int64 // len(latencyBounds)+1，最后一个为溢出桶
+	count   int64
+	max     time.Duration
+}
+
+func (c *latencyCounts) add(d time.Duration) {
+	i := 0
+	for i < len(latencyBounds) && d > latencyBounds[i] {
+		i++
+	}
+	c.buckets[i]++
+	c.count++
+	if d > c.max {
+		c.max = d
+	}
+}
+
+func (c *latencyCounts) quantile(q float64) time.Duration {
+	if c.count == 0 {
+		return 0
+	}
+	rank := int64(q*float64(c.count) + 0.999999)
+	var seen int64
+	for i, n := range c.buckets {
+		seen += n
+		if seen >= rank {
+			if i < len(latencyBounds) && latencyBounds[i] < c.max {
+				return latencyBounds[i]
+			}
+			return c.max
+		}
+	}
+	return c.max
+}
+
+type latencyReport struct {
+	count    int64
+	p50, p99 time.Duration
+	window   time.Duration
+}
+
+type latencyHist struct {
+	mu          sync.Mutex
+	total       latencyCounts
+	win         latencyCounts
+	winStart    time.Time
+	last        latencyReport // 最近一个完整窗口
+	lastPresent bool
+}
+
+func newLatencyHist() *latencyHist {
+	return &latencyHist{
+		total: latencyCounts{buckets: make([]int64, len(latencyBounds)+1)},
+		win:   latencyCounts{buckets: make([]int64, len(latencyBounds)+1)},
+	}
+}
+
+// observe 记录一次耗时；窗口到期时返回该窗口的统计并开始新窗口。
+func (h *latencyHist) observe(d time.Duration, now time.Time, window time.Duration) (latencyReport, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.winStart.IsZero() {
+		h.winStart = now
+	}
+	var rep latencyReport
+	rolled := false
+	if window > 0 && now.Sub(h.winStart) >= window {
+		rep = latencyReport{count: h.win.count, p50: h.win.quantile(0.5), p99: h.win.quantile(0.99), window: now.Sub(h.winStart)}
+		h.last, h.lastPresent, rolled = rep, true, true
+		h.win = latencyCounts{buckets: make([]int64, len(latencyBounds)+1)}
+		h.winStart = now
+	}
+	h.total.add(d)
+	h.win.add(d)
+	return rep, rolled
+}
+
+func (h *latencyHist) lastP99() time.Duration {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.last.p99
+}
+
+// snapshot 返回 getLatency 的数据：累计桶（键为上界毫秒数）与最近一个窗口的分位数。
+func (h *latencyHist) snapshot() map[string]any {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	buckets := make(map[string]int64, len(h.total.buckets))
+	var cum int64
+	for i, n := range h.total.buckets {
+		cum += n
+		le := "+Inf"
+		if i < len(latencyBounds) {
+			le = strconv.FormatFloat(float64(latencyBounds[i].Microseconds())/1000, 'f', -1, 64)
+		}
+		buckets[le] = cum
+	}
+	out := map[string]any{"count": h.total.count, "buckets_le_ms": buckets}
+	if h.lastPresent {
+		out["window_seconds"] = int(h.last.window / time.Second)
+		out["window_count"] = h.last.count
+		out["window_p50_ms"] = float64(h.last.p50.Microseconds()) / 1000
+		out["window_p99_ms"] = float64(h.last.p99.Microseconds()) / 1000
+	}
+	return out
+}
+
+func latencyHistFor(event string) *latencyHist {
+	switch event {
+	case "auth":
+		return authLatency
+	case "acl":
+		return aclLatency
+	}
+	return nil
+}
+
+func overBudget(rep latencyReport, budget time.Duration) bool {
+	return budget > 0 && rep.count >= latencyMinSamples && rep.p99 > budget
+}
+
+// recordLatency 记录一次检查的耗时：更新直方图、检查预算，并在配置了 StatsD 时发送。
+func recordLatency(event string, start time.Time) {
+	d := time.Since(start)
+	if h := latencyHistFor(event); h != nil {
+		if rep, ok := h.observe(d, time.Now(), latencyWindow); ok && overBudget(rep, latencyBudget) {
+			mosqLog(logWarning, "auth-plugin: %s p99 latency %s exceeds latency_budget_ms=%d over the last %s (%d checks, p50 %s)",
+				event, rep.p99, int(latencyBudget/time.Millisecond), rep.window.Round(time.Second), rep.count, rep.p50)
+		}
+	}
+	if statsdAddr != "" {
+		ms := float64(d.Microseconds()) / 1000
+		statsdSend([]string{formatStatsd(event+"_latency", fmt.Sprintf("%.3f", ms), "ms")})
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLatencyQuantile(t *testing.T) {
+	t.Parallel()
+	c := latencyCounts{buckets: make([]int64, len(latencyBounds)+1)}
+	for i := 0; i < 98; i++ {
+		c.add(800 * time.Microsecond)
+	}
+	c.add(40 * time.Millisecond)
+	c.add(40 * time.Millisecond)
+
+	if got := c.quantile(0.5); got != time.Millisecond {
+		t.Fatalf("p50 = %s, want 1ms bucket", got)
+	}
+	if got := c.quantile(0.99); got != 40*time.Millisecond {
+		t.Fatalf("p99 = %s, want max 40ms inside the 50ms bucket", got)
+	}
+
+	c.add(9 * time.Second)
+	if got := c.quantile(1); got != 9*time.Second {
+		t.Fatalf("overflow quantile = %s, want observed max", got)
+	}
+}
+
+func TestLatencyWindow(t *testing.T) {
+	t.Parallel()
+	h := newLatencyHist()
+	base := time.Unix(1_700_000_000, 0)
+
+	for i := 0; i < 150; i++ {
+		if _, rolled := h.observe(300*time.Millisecond, base.Add(time.Duration(i)*100*time.Millisecond), time.Minute); rolled {
+			t.Fatalf("window rolled early at sample %d", i)
+		}
+	}
+	rep, rolled := h.observe(time.Millisecond, base.Add(time.Minute), time.Minute)
+	if !rolled || rep.count != 150 || rep.p99 != 300*time.Millisecond {
+		t.Fatalf("report = %+v rolled=%v", rep, rolled)
+	}
+	if !overBudget(rep, 200*time.Millisecond) || overBudget(rep, 500*time.Millisecond) || overBudget(rep, 0) {
+		t.Fatal("budget check mismatch")
+	}
+	if overBudget(latencyReport{count: latencyMinSamples - 1, p99: time.Second}, time.Millisecond) {
+		t.Fatal("small windows must not trigger the budget warning")
+	}
+	if got := h.lastP99(); got != 300*time.Millisecond {
+		t.Fatalf("lastP99 = %s", got)
+	}
+
+	snap := h.snapshot()
+	if snap["count"] != int64(151) || snap["window_count"] != int64(150) {
+		t.Fatalf("snapshot = %v", snap)
+	}
+	if b := snap["buckets_le_ms"].(map[string]int64); b["1"] != 1 || b["500"] != 151 || b["+Inf"] != 151 {
+		t.Fatalf("cumulative buckets = %v", b)
+	}
+}
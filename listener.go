@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 按监听端口覆盖请求级策略：plugin_opt_listener_8883.fail_open_acl true。
+// 端口来自 broker 导出的 mosquitto_client_port（见 pkg/mosqplugin）；
+// 不支持的 broker 上覆盖项不生效，init 时会提示。
+
+const listenerOptionPrefix = "listener_"
+
+// requestPolicy 是单次回调实际使用的策略，默认取全局选项，再叠加监听端口的覆盖项。
+type requestPolicy struct {
+	timeout      time.Duration
+	failOpenAuth bool
+	failOpenACL  bool
+	enforceBind  bool
+}
+
+// listenerOverrides: 端口 -> 选项名 -> 原始值（写入时已校验）
+var listenerOverrides = map[int]map[string]string{}
+
+var policyOverrides = map[string]func(p *requestPolicy, v string) bool{
+	"timeout_ms": func(p *requestPolicy, v string) bool {
+		d, ok := parseTimeoutMS(v)
+		if ok {
+			p.timeout = d
+		}
+		return ok
+	},
+	"fail_open": func(p *requestPolicy, v string) bool {
+		b, ok := parseBoolOption(v)
+		if ok {
+			p.failOpenAuth, p.failOpenACL = b, b
+		}
+		return ok
+	},
+	"fail_open_auth": func(p *requestPolicy, v string) bool {
+		b, ok := parseBoolOption(v)
+		if ok {
+			p.failOpenAuth = b
+		}
+		return ok
+	},
+	"fail_open_acl": func(p *requestPolicy, v string) bool {
+		b, ok := parseBoolOption(v)
+		if ok {
+			p.failOpenACL = b
+		}
+		return ok
+	},
+	"enforce_bind": func(p *requestPolicy, v string) bool {
+		b, ok := parseBoolOption(v)
+		if ok {
+			p.enforceBind = b
+		}
+		return ok
+	},
+}
+
+func (in *instance) defaultPolicy() requestPolicy {
+	return requestPolicy{timeout: in.timeout.get(), failOpenAuth: in.failOpenAuth, failOpenACL: in.failOpenACL, enforceBind: in.enforceBind}
+}
+
+// parseListenerOption 拆分 listener_<port>.<option>。
+func parseListenerOption(k string) (port int, opt string, err error) {
+	rest := strings.TrimPrefix(k, listenerOptionPrefix)
+	portStr, opt, found := strings.Cut(rest, ".")
+	if !found || opt == "" {
+		return 0, "", fmt.Errorf("invalid listener override %s, want listener_<port>.<option>", k)
+	}
+	port, err = strconv.Atoi(portStr)
+	if err != nil || port <= 0 || port > 65535 {
+		return 0, "", fmt.Errorf("invalid listener port in %s", k)
+	}
+	return port, opt, nil
+}
+
+func setListenerOverride(k, v string) error {
+	port, opt, err := parseListenerOption(k)
+	if err != nil {
+		return err
+	}
+	apply, ok := policyOverrides[opt]
+	if !ok {
+		return fmt.Errorf("option %s cannot be overridden per listener (in %s)", opt, k)
+	}
+	var probe requestPolicy
+	if !apply(&probe, v) {
+		return fmt.Errorf("invalid %s=%q, ignoring override", k, v)
+	}
+	optionsMu.Lock()
+	defer optionsMu.Unlock()
+	if listenerOverrides[port] == nil {
+		listenerOverrides[port] = map[string]string{}
+	}
+	listenerOverrides[port][opt] = v
+	return nil
+}
+
+// copyListenerOverrides 返回覆盖项的深拷贝，可在任意协程中调用。
+func copyListenerOverrides() map[int]map[string]string {
+	optionsMu.RLock()
+	defer optionsMu.RUnlock()
+	out := make(map[int]map[string]string, len(listenerOverrides))
+	for port, o := range listenerOverrides {
+		out[port] = make(map[string]string, len(o))
+		for k, v := range o {
+			out[port][k] = v
+		}
+	}
+	return out
+}
+
+// policyForPort 返回某监听端口的生效策略；port<=0 表示未知，使用实例的策略。
+// listener_* 覆盖项是 primary 的配置，其他实例本身就按 listener 加载，不叠加。
+// 覆盖项只在 broker 线程上写入，这里同在 broker 线程，读取无需加锁。
+func (in *instance) policyForPort(port int) requestPolicy {
+	p := in.defaultPolicy()
+	if port <= 0 || in != primary {
+		return p
+	}
+	for opt, v := range listenerOverrides[port] {
+		policyOverrides[opt](&p, v)
+	}
+	return p
+}
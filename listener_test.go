@@ -0,0 +1,64 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseListenerOption(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		key     string
+		port    int
+		opt     string
+		wantErr bool
+	}{
+		{"listener_8883.fail_open", 8883, "fail_open", false},
+		{"listener_1883.timeout_ms", 1883, "timeout_ms", false},
+		{"listener_8883", 0, "", true},
+		{"listener_abc.fail_open", 0, "", true},
+		{"listener_70000.fail_open", 0, "", true},
+		{"listener_8883.", 0, "", true},
+	}
+	for _, tc := range tests {
+		port, opt, err := parseListenerOption(tc.key)
+		if (err != nil) != tc.wantErr || port != tc.port || opt != tc.opt {
+			t.Fatalf("parseListenerOption(%q) = (%d, %q, %v)", tc.key, port, opt, err)
+		}
+	}
+}
+
+func TestPolicyForPort(t *testing.T) {
+	oldOverrides, oldFailOpen, oldTimeout := listenerOverrides, primary.failOpenAuth, primary.timeout.get()
+	t.Cleanup(func() {
+		listenerOverrides, primary.failOpenAuth = oldOverrides, oldFailOpen
+		primary.timeout.set(oldTimeout)
+	})
+
+	listenerOverrides = map[int]map[string]string{}
+	primary.failOpenAuth = false
+	primary.timeout.set(1500 * time.Millisecond)
+
+	if err := applyOption(primary, "listener_1883.fail_open_auth", "true"); err != nil {
+		t.Fatalf("applyOption(listener_1883.fail_open_auth) = %v", err)
+	}
+	if err := applyOption(primary, "listener_1883.timeout_ms", "300"); err != nil {
+		t.Fatalf("applyOption(listener_1883.timeout_ms) = %v", err)
+	}
+	if err := applyOption(primary, "listener_1883.pg_dsn", "postgres://x"); err == nil {
+		t.Fatal("connection options must not be overridable per listener")
+	}
+	if err := applyOption(primary, "listener_1883.fail_open", "perhaps"); err == nil {
+		t.Fatal("invalid override values must be rejected")
+	}
+
+	if p := primary.policyForPort(1883); !p.failOpenAuth || p.failOpenACL || p.timeout != 300*time.Millisecond {
+		t.Fatalf("policyForPort(1883) = %+v", p)
+	}
+	if p := primary.policyForPort(8883); p.failOpenAuth || p.timeout != 1500*time.Millisecond {
+		t.Fatalf("policyForPort(8883) = %+v, want global defaults", p)
+	}
+	if p := primary.policyForPort(-1); p.failOpenAuth {
+		t.Fatalf("policyForPort(-1) = %+v, want global defaults", p)
+	}
+}
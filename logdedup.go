@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// 错误日志去重：PG 故障期间每个回调都会打同样的告警。同一条消息在 log_dedup_interval 内
+// 只输出第一次，窗口结束后补一条 "repeated N times in the last ..." 汇总。
+// 汇总在下一次去重日志调用或 cleanup 时输出。
+
+var logDedupInterval = time.Minute
+
+type dedupEntry struct {
+	level   int // mosquitto 日志级别
+	first   time.Time
+	repeats int
+}
+
+type dedupLine struct {
+	level int
+	msg   string
+}
+
+type logDeduper struct {
+	mu      sync.Mutex
+	entries map[string]*dedupEntry
+	now     func() time.Time
+}
+
+var errorLogDedup = newLogDeduper()
+
+func newLogDeduper() *logDeduper {
+	return &logDeduper{entries: map[string]*dedupEntry{}, now: time.Now}
+}
+
+// observe 返回需要输出的行：到期的汇总，以及（首次出现时）消息本身。
+func (d *logDeduper) observe(level int, msg string, window time.Duration) []dedupLine {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	now := d.now()
+	out := d.expire(now, window)
+	if e, ok := d.entries[msg]; ok {
+		e.repeats++
+		return out
+	}
+	d.entries[msg] = &dedupEntry{level: level, first: now}
+	return append(out, dedupLine{level, msg})
+}
+
+// flush 输出所有待汇总的重复次数并清空。
+func (d *logDeduper) flush() []dedupLine {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.expire(time.Time{}, 0)
+}
+
+// expire 移除窗口已结束的条目；window<=0 时全部移除。
+func (d *logDeduper) expire(now time.Time, window time.Duration) []dedupLine {
+	var out []dedupLine
+	for msg, e := range d.entries {
+		if window > 0 && now.Sub(e.first) < window {
+			continue
+		}
+		delete(d.entries, msg)
+		if e.repeats > 0 {
+			span := window
+			if span <= 0 {
+				span = logDedupInterval
+			}
+			out = append(out, dedupLine{e.level, fmt.Sprintf("%s (repeated %d times in the last %s)", msg, e.repeats, span)})
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].msg < out[j].msg })
+	return out
+}
+
+// mosqLogDeduped 用于可能在故障期间被每个回调触发的日志。
+func mosqLogDeduped(level int, msg string, args ...any) {
+	if len(args) > 0 {
+		msg = fmt.Sprintf(msg, args...)
+	}
+	if logDedupInterval <= 0 {
+		mosqLog(level, msg)
+		return
+	}
+	for _, l := range errorLogDedup.observe(level, msg, logDedupInterval) {
+		mosqLog(l.level, l.msg)
+	}
+}
+
+func flushDedupedLogs() {
+	for _, l := range errorLogDedup.flush() {
+		mosqLog(l.level, l.msg)
+	}
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLogDeduper(t *testing.T) {
+	t.Parallel()
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	d := newLogDeduper()
+	d.now = func() time.Time { return now }
+	const window = time.Minute
+
+	if out := d.observe(4, "db down", window); len(out) != 1 || out[0].msg != "db down" {
+		t.Fatalf("first occurrence should be logged, got %+v", out)
+	}
+	for i := 0; i < 3; i++ {
+		if out := d.observe(4, "db down", window); len(out) != 0 {
+			t.Fatalf("repeat within window should be suppressed, got %+v", out)
+		}
+	}
+	if out := d.observe(4, "other", window); len(out) != 1 {
+		t.Fatalf("different message should be logged, got %+v", out)
+	}
+
+	now = now.Add(window)
+	out := d.observe(4, "db down", window)
+	if len(out) != 2 || out[0].msg != "db down (repeated 3 times in the last 1m0s)" || out[1].msg != "db down" {
+		t.Fatalf("expected summary then fresh message, got %+v", out)
+	}
+
+	d.observe(4, "db down", window)
+	if out := d.flush(); len(out) != 1 || out[0].level != 4 {
+		t.Fatalf("flush should emit pending summary, got %+v", out)
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"auth-plugin/pkg/mosqplugin"
+)
+
+// mosquitto 的日志级别（MOSQ_LOG_*）。
+const (
+	logInfo    = mosqplugin.LogInfo
+	logNotice  = mosqplugin.LogNotice
+	logWarning = mosqplugin.LogWarning
+	logErr     = mosqplugin.LogErr
+	logDebug   = mosqplugin.LogDebug
+)
+
+// log_level：插件自己的日志级别，独立于 mosquitto 的 log_type。
+// trace 额外记录每条 SQL（绑定参数脱敏）及耗时；mosquitto 没有 trace 级别，按 debug 输出。
+
+const (
+	logLevelError = iota
+	logLevelWarn
+	logLevelInfo
+	logLevelDebug
+	logLevelTrace
+)
+
+var logLevelNames = []string{"error", "warn", "info", "debug", "trace"}
+
+// logLevel 由 log_level 与 setConfig 在 broker 线程上修改，各协程写日志前读取。
+var logLevel atomic.Int32
+
+func init() { logLevel.Store(logLevelInfo) }
+
+func parseLogLevel(v string) (int, bool) {
+	v = strings.ToLower(strings.TrimSpace(v))
+	if v == "warning" {
+		v = "warn"
+	}
+	for i, name := range logLevelNames {
+		if v == name {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// levelRank 把 mosquitto 日志级别映射到 log_level 的档位。
+func levelRank(level int) int {
+	switch level {
+	case logErr:
+		return logLevelError
+	case logWarning:
+		return logLevelWarn
+	case logDebug:
+		return logLevelDebug
+	default:
+		return logLevelInfo
+	}
+}
+
+func logEnabled(level int) bool {
+	return levelRank(level) <= int(logLevel.Load())
+}
+
+// redactArgs 只保留参数个数与类型，避免用户名、client id 等写进日志。
+func redactArgs(args []any) string {
+	parts := make([]string, len(args))
+	for i, a := range args {
+		switch a.(type) {
+		case string:
+			parts[i] = "<string>"
+		case nil:
+			parts[i] = "NULL"
+		default:
+			parts[i] = "<redacted>"
+		}
+	}
+	return "[" + strings.Join(parts, ", ") + "]"
+}
+
+type traceStartKey struct{}
+
+type traceQuery struct {
+	sql   string
+	args  string
+	conn  string
+	start time.Time
+	span  trace.Span // 未启用 OpenTelemetry 时为 nil
+	log   bool
+}
+
+// sqlTracer 在 log_level=trace 时记录 SQL，启用 OpenTelemetry 时为每条 SQL 生成子 span；
+// 两者都关闭时只做两次比较。
+type sqlTracer struct{}
+
+func (sqlTracer) TraceQueryStart(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	logSQL := logLevel.Load() >= logLevelTrace
+	traced := tracerProvider != nil && featureFlags.on(flagTracing)
+	if !logSQL && !traced {
+		return ctx
+	}
+	q := traceQuery{sql: data.SQL, conn: connIDFrom(ctx), start: time.Now(), log: logSQL}
+	if logSQL {
+		q.args = redactArgs(data.Args)
+	}
+	if traced {
+		ctx, q.span = tracer.Start(ctx, "db.query", trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(attribute.String("db.system", "postgresql"), attribute.String("db.statement", data.SQL)))
+	}
+	return context.WithValue(ctx, traceStartKey{}, q)
+}
+
+func (sqlTracer) TraceQueryEnd(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryEndData) {
+	q, ok := ctx.Value(traceStartKey{}).(traceQuery)
+	if !ok {
+		return
+	}
+	if q.span != nil {
+		if data.Err != nil {
+			q.span.RecordError(data.Err)
+			q.span.SetStatus(codes.Error, data.Err.Error())
+		}
+		q.span.End()
+	}
+	if !q.log {
+		return
+	}
+	elapsed := time.Since(q.start)
+	if data.Err != nil {
+		mosqLog(logDebug, "auth-plugin: conn=%s sql %q args=%s failed after %s: %v", q.conn, q.sql, q.args, elapsed, data.Err)
+		return
+	}
+	mosqLog(logDebug, "auth-plugin: conn=%s sql %q args=%s -> %s in %s", q.conn, q.sql, q.args, data.CommandTag, elapsed)
+}
+
+// mosqLog 按 log_level 过滤后写入 mosquitto 日志（纯 Go 构建中写到标准错误），并同步到 log_file。
+func mosqLog(level int, msg string, args ...any) {
+	if !logEnabled(level) {
+		return
+	}
+	if len(args) > 0 {
+		msg = fmt.Sprintf(msg, args...)
+	}
+	logMessage(level, msg)
+	mosqplugin.Log(level, msg)
+}
@@ -0,0 +1,31 @@
+package main
+
+import "testing"
+
+func TestParseLogLevel(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		input  string
+		want   int
+		wantOK bool
+	}{
+		{"error", logLevelError, true},
+		{" WARNING ", logLevelWarn, true},
+		{"debug", logLevelDebug, true},
+		{"trace", logLevelTrace, true},
+		{"verbose", 0, false},
+	}
+	for _, tc := range tests {
+		got, ok := parseLogLevel(tc.input)
+		if got != tc.want || ok != tc.wantOK {
+			t.Fatalf("parseLogLevel(%q) = (%d, %v), want (%d, %v)", tc.input, got, ok, tc.want, tc.wantOK)
+		}
+	}
+}
+
+func TestRedactArgs(t *testing.T) {
+	t.Parallel()
+	if got := redactArgs([]any{"alice", 42, nil}); got != "[<string>, <redacted>, NULL]" {
+		t.Fatalf("redactArgs = %s", got)
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// 判定日志采样：拒绝、错误、fail_open、grace 每条都记录；allow 按事件类型每 N 条记录 1 条
+// （log_sample_auth_allow / log_sample_acl_allow，1 = 全部记录，0 = 不记录 allow）。
+// 采样同时作用于 debug 日志、JSON 事件流和 Kafka；被记录的 allow 带上 sample_rate，便于下游按比例还原。
+
+type allowSampler struct {
+	every int
+	seen  atomic.Uint64
+}
+
+var (
+	authAllowSampler = &allowSampler{every: 1}
+	aclAllowSampler  = &allowSampler{every: 1}
+)
+
+func samplerFor(event string) *allowSampler {
+	switch event {
+	case "auth":
+		return authAllowSampler
+	case "acl":
+		return aclAllowSampler
+	}
+	return nil
+}
+
+// keep 判断本次判定是否记录，返回记录时应附带的采样率（1 表示未采样）。
+func (s *allowSampler) keep(result string) (bool, int) {
+	if s == nil || result != resultAllow || s.every == 1 {
+		return true, 1
+	}
+	if s.every <= 0 {
+		return false, 0
+	}
+	n := s.seen.Add(1)
+	return (n-1)%uint64(s.every) == 0, s.every
+}
+
+func parseSampleEvery(v string) (int, error) {
+	n, err := strconv.Atoi(strings.TrimSpace(v))
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("want N >= 0 (1 = log every allow, 0 = none)")
+	}
+	return n, nil
+}
+
+func sampleOption(s *allowSampler) func(string) error {
+	return func(v string) error {
+		n, err := parseSampleEvery(v)
+		if err != nil {
+			return fmt.Errorf("%v, keeping existing value %d", err, s.every)
+		}
+		s.every = n
+		return nil
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestAllowSampler(t *testing.T) {
+	t.Parallel()
+	s := &allowSampler{every: 3}
+	var kept int
+	for i := 0; i < 9; i++ {
+		if ok, rate := s.keep(resultAllow); ok {
+			kept++
+			if rate != 3 {
+				t.Fatalf("rate = %d, want 3", rate)
+			}
+		}
+	}
+	if kept != 3 {
+		t.Fatalf("kept %d of 9 allows, want 3", kept)
+	}
+	for _, r := range []string{resultDeny, resultError, resultFailOpen, resultGrace} {
+		if ok, rate := s.keep(r); !ok || rate != 1 {
+			t.Fatalf("%s must always be logged unsampled, got (%v, %d)", r, ok, rate)
+		}
+	}
+
+	none := &allowSampler{every: 0}
+	if ok, _ := none.keep(resultAllow); ok {
+		t.Fatal("every=0 must drop allows")
+	}
+	if ok, _ := (*allowSampler)(nil).keep(resultAllow); !ok {
+		t.Fatal("unknown event types must not be sampled")
+	}
+}
+
+func TestLogDecisionSampling(t *testing.T) {
+	oldFormat, oldSink, oldEvery := logFormat, eventSink, authAllowSampler.every
+	t.Cleanup(func() { logFormat, eventSink, authAllowSampler.every = oldFormat, oldSink, oldEvery })
+
+	var buf bytes.Buffer
+	logFormat, eventSink, authAllowSampler.every = logFormatJSON, &buf, 2
+	authAllowSampler.seen.Store(0)
+	for i := 0; i < 4; i++ {
+		logDecision("auth", "", "bob", "c2", "", time.Now(), resultAllow, allowed(reasonOK), nil)
+	}
+	logDecision("auth", "", "bob", "c2", "", time.Now(), resultDeny, denied(reasonBadPassword), nil)
+
+	lines := bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n"))
+	if len(lines) != 3 {
+		t.Fatalf("got %d lines, want 2 sampled allows + 1 deny: %s", len(lines), buf.String())
+	}
+	var rec map[string]any
+	if err := json.Unmarshal(lines[0], &rec); err != nil {
+		t.Fatal(err)
+	}
+	if rec["sample_rate"] != float64(2) {
+		t.Fatalf("sample_rate = %v, want 2", rec["sample_rate"])
+	}
+	rec = nil
+	if err := json.Unmarshal(lines[2], &rec); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := rec["sample_rate"]; ok || rec["result"] != resultDeny {
+		t.Fatalf("deny record should be unsampled: %v", rec)
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base64"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/pbkdf2"
+
+	"auth-plugin/internal/shacrypt"
+)
+
+// mosquitto password_file 的哈希格式，便于从文件认证迁移（cmd/import 原样导入）：
+//   $7$<iterations>$<salt>$<hash>  mosquitto 2.x，PBKDF2-HMAC-SHA512
+//   $6$<salt>$<hash>               mosquitto 1.x，sha512(password+salt)
+// 盐与哈希均为带填充的标准 base64。两种都按弱哈希计（迭代次数低或无迭代）。
+// $6$ 与 SHA-512-crypt 同前缀，SHA-512-crypt 的哈希部分不是标准 base64，先排除。
+
+func isMosquittoHash(hash string) bool {
+	return strings.HasPrefix(hash, "$7$") || strings.HasPrefix(hash, "$6$") && !shacrypt.Is(hash)
+}
+
+// verifyMosquittoHash 返回是否匹配；格式错误视为不匹配。
+func verifyMosquittoHash(hash, password string) bool {
+	parts := strings.Split(hash, "$")
+	var iter int
+	var salt64, hash64 string
+	switch {
+	case len(parts) == 5 && parts[1] == "7":
+		n, err := strconv.Atoi(parts[2])
+		if err != nil || n < 1 {
+			return false
+		}
+		iter, salt64, hash64 = n, parts[3], parts[4]
+	case len(parts) == 4 && parts[1] == "6":
+		salt64, hash64 = parts[2], parts[3]
+	default:
+		return false
+	}
+	salt, err1 := base64.StdEncoding.DecodeString(salt64)
+	want, err2 := base64.StdEncoding.DecodeString(hash64)
+	if err1 != nil || err2 != nil || len(want) != sha512.Size {
+		return false
+	}
+	var got []byte
+	if iter > 0 {
+		got = pbkdf2.Key([]byte(password), salt, iter, sha512.Size, sha512.New)
+	} else {
+		sum := sha512.Sum512(append([]byte(password), salt...))
+		got = sum[:]
+	}
+	return subtle.ConstantTimeCompare(got, want) == 1
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// MySQL/MariaDB 存储（db_driver=mysql）：与 PostgreSQL 相同的三张表和查询，
+// 只是占位符换成 ?。PostgreSQL 专有的功能（pg_schema、config_instance、统计表、
+// Cloud SQL/Azure/Vault 凭据、setDSN 轮换）在此模式下不可用，由 validateOptions 报告。
+
+var (
+	mysqlDSN     string // user:pass@tcp(host:3306)/db?tls=true
+	mysqlDSNFile string
+	mysqlDB      *sql.DB
+	mysqlMu      sync.RWMutex
+)
+
+const (
+	mysqlAuthQuery = "SELECT password_hash, salt, enabled FROM iot_devices WHERE username = ?"
+	mysqlBindQuery = "SELECT 1 FROM client_bindings WHERE username = ? AND client_id = ?"
+	mysqlACLQuery  = "SELECT pattern, acc FROM acls WHERE username = ? OR username = '*'"
+)
+
+// mysqlConfig 解析 DSN，并补上与 PostgreSQL 连接池一致的超时。
+func mysqlConfig(dsn string) (*mysql.Config, error) {
+	cfg, err := mysql.ParseDSN(dsn)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Timeout == 0 {
+		cfg.Timeout = primary.timeout.get()
+	}
+	if primary.pgAppName != "" {
+		// 相当于 PostgreSQL 的 application_name，出现在 performance_schema.session_connect_attrs
+		cfg.ConnectionAttributes = "program_name:" + primary.pgAppName
+	}
+	return cfg, nil
+}
+
+// safeMySQLDSN 隐去密码，用于日志。
+func safeMySQLDSN(dsn string) string {
+	cfg, err := mysql.ParseDSN(dsn)
+	if err != nil {
+		return "(unparsable dsn)"
+	}
+	if cfg.Passwd != "" {
+		cfg.Passwd = "xxxxx"
+	}
+	return cfg.FormatDSN()
+}
+
+func ensureMySQL(ctx context.Context) (*sql.DB, error) {
+	mysqlMu.RLock()
+	current := mysqlDB
+	mysqlMu.RUnlock()
+	if current != nil {
+		return current, nil
+	}
+
+	mysqlMu.Lock()
+	defer mysqlMu.Unlock()
+	if mysqlDB != nil {
+		return mysqlDB, nil
+	}
+	cfg, err := mysqlConfig(mysqlDSN)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := mysql.NewConnector(cfg)
+	if err != nil {
+		return nil, err
+	}
+	db := sql.OpenDB(conn)
+	db.SetMaxOpenConns(16)
+	db.SetMaxIdleConns(2)
+	db.SetConnMaxIdleTime(60 * time.Second)
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, err
+	}
+	mysqlDB = db
+	mosqLog(logInfo, "auth-plugin: connected to MySQL successfully")
+	return db, nil
+}
+
+func closeMySQL() {
+	mysqlMu.Lock()
+	defer mysqlMu.Unlock()
+	if mysqlDB != nil {
+		mysqlDB.Close()
+		mysqlDB = nil
+	}
+}
+
+// loadMySQLDSN 在初始化时读取 mysql_dsn_file；与 pg_dsn_file 不同，文件变化不会自动重连。
+func loadMySQLDSN() error {
+	if mysqlDSNFile != "" {
+		dsn, err := readSecretFile(mysqlDSNFile)
+		if err != nil {
+			return fmt.Errorf("read mysql_dsn_file: %w", err)
+		}
+		mysqlDSN = dsn
+	}
+	if mysqlDSN == "" {
+		return errors.New("mysql_dsn or mysql_dsn_file must be set with db_driver=mysql")
+	}
+	if _, err := mysqlConfig(mysqlDSN); err != nil {
+		return fmt.Errorf("invalid mysql_dsn (%s): %w", safeMySQLDSN(mysqlDSN), err)
+	}
+	return nil
+}
+
+// mysqlPoolStats 返回与 pgxpool 统计同名的数值，供 getStatus/$SYS 使用。
+func mysqlPoolStats() (sql.DBStats, bool) {
+	mysqlMu.RLock()
+	db := mysqlDB
+	mysqlMu.RUnlock()
+	if db == nil {
+		return sql.DBStats{}, false
+	}
+	return db.Stats(), true
+}
+
+type mysqlStore struct{ db *sql.DB }
+
+func (s mysqlStore) user(ctx context.Context, username string) (deviceRow, bool, error) {
+	var d deviceRow
+	var enabled int16
+	err := s.db.QueryRowContext(ctx, mysqlAuthQuery, username).Scan(&d.hash, &d.salt, &enabled)
+	if errors.Is(err, sql.ErrNoRows) {
+		return d, false, nil
+	}
+	d.enabled = enabled != 0
+	return d, err == nil, err
+}
+
+func (s mysqlStore) bound(ctx context.Context, username, clientID string) (bool, error) {
+	var ok int
+	err := s.db.QueryRowContext(ctx, mysqlBindQuery, username, clientID).Scan(&ok)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (s mysqlStore) rules(ctx context.Context, username string) ([]aclRule, error) {
+	rows, err := s.db.QueryContext(ctx, mysqlACLQuery, username)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var rules []aclRule
+	for rows.Next() {
+		var r aclRule
+		if err := rows.Scan(&r.Pattern, &r.Acc); err != nil {
+			return nil, err
+		}
+		rules = append(rules, r)
+	}
+	return rules, rows.Err()
+}
+
+func (s mysqlStore) ping(ctx context.Context) error { return s.db.PingContext(ctx) }
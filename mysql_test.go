@@ -0,0 +1,56 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseDBDriver(t *testing.T) {
+	t.Parallel()
+	for in, want := range map[string]string{"postgres": driverPostgres, " PG ": driverPostgres, "MariaDB": driverMySQL, "mysql": driverMySQL} {
+		if got, ok := parseDBDriver(in); !ok || got != want {
+			t.Errorf("parseDBDriver(%q) = %q, %t; want %q", in, got, ok, want)
+		}
+	}
+	if _, ok := parseDBDriver("sqlite"); ok {
+		t.Error("parseDBDriver(sqlite) should fail")
+	}
+}
+
+func TestMySQLConfig(t *testing.T) {
+	t.Parallel()
+	cfg, err := mysqlConfig("mqtt:s3cret@tcp(db:3306)/iot?tls=true")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Timeout != primary.timeout.get() || cfg.DBName != "iot" {
+		t.Errorf("mysqlConfig = %+v, want the plugin timeout and database iot", cfg)
+	}
+	if cfg, _ := mysqlConfig("mqtt@tcp(db)/iot?timeout=3s"); cfg.Timeout != 3*time.Second {
+		t.Errorf("an explicit timeout in the DSN should win, got %s", cfg.Timeout)
+	}
+	if _, err := mysqlConfig("postgres://db/iot"); err == nil {
+		t.Error("a PostgreSQL URL should not parse as a MySQL DSN")
+	}
+	if got := safeMySQLDSN("mqtt:s3cret@tcp(db:3306)/iot"); strings.Contains(got, "s3cret") || !strings.Contains(got, "mqtt:xxxxx@") {
+		t.Errorf("safeMySQLDSN = %q", got)
+	}
+}
+
+func TestValidateMySQLOptions(t *testing.T) {
+	old := dbDriver
+	t.Cleanup(func() { dbDriver = old })
+
+	dbDriver = driverMySQL
+	problems := strings.Join(validateOptions(primary, map[string]bool{"mysql_dsn": true, "config_instance": true, "self_test": true}), "; ")
+	for _, want := range []string{"config_instance is PostgreSQL-only", "self_test is PostgreSQL-only"} {
+		if !strings.Contains(problems, want) {
+			t.Errorf("validateOptions = %q, want %q", problems, want)
+		}
+	}
+	dbDriver = driverPostgres
+	if problems := validateOptions(primary, map[string]bool{"mysql_dsn": true}); len(problems) != 1 {
+		t.Errorf("validateOptions = %v, want mysql_dsn without db_driver=mysql", problems)
+	}
+}
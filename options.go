@@ -0,0 +1,772 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"auth-plugin/internal/kafkasasl"
+	"auth-plugin/internal/optnames"
+)
+
+// 插件选项注册表：键为 plugin_opt_ 之后的名字，值负责解析并写入对应的全局配置。
+// 解析失败时返回错误并保持原值，由调用方决定告警还是（strict_options 下）拒绝启动。
+
+// maxTimeout 回调在 broker 主线程上同步执行，超时过长会拖住所有客户端。
+const maxTimeout = 60 * time.Second
+
+var errUnknownOption = errors.New("unknown option")
+
+var strictOptions bool
+
+type optionSetter func(v string) error
+
+var pluginOptions map[string]optionSetter
+
+func init() {
+	pluginOptions = map[string]optionSetter{
+		"pg_dsn_file":            stringOption(&pgDSNFile),
+		"pg_password_file":       stringOption(&pgPasswordFile),
+		"db_driver":              choiceOption(&dbDriver, parseDBDriver),
+		"pg_flavor":              choiceOption(&pgFlavor, parsePGFlavor),
+		"crdb_max_retries":       intOption(&crdbMaxRetries, 0, 10, ""),
+		"crdb_follower_reads":    boolOption(&crdbFollowerReads),
+		"shard_column":           setShardColumn,
+		"krb5_keytab":            stringOption(&krb5Keytab),
+		"krb5_service":           stringOption(&krb5Service),
+		"krb5_principal_map":     stringOption(&krb5PrincipalMap),
+		"totp_users":             stringOption(&totpUsers),
+		"totp_skew":              intOption(&totpSkew, 0, 2, ""),
+		"shard_value":            stringOption(&shardValue),
+		"shard_separator":        stringOption(&shardSeparator),
+		"compat":                 choiceOption(&compatMode, parseCompatMode),
+		"pg_host":                stringOption(&goAuthHost),
+		"pg_port":                stringOption(&goAuthPort),
+		"pg_user":                stringOption(&goAuthUser),
+		"pg_password":            stringOption(&goAuthPassword),
+		"pg_dbname":              stringOption(&goAuthDBName),
+		"pg_sslmode":             stringOption(&goAuthSSLMode),
+		"pg_sslcert":             stringOption(&goAuthSSLCert),
+		"pg_sslkey":              stringOption(&goAuthSSLKey),
+		"pg_sslrootcert":         stringOption(&goAuthSSLRootCert),
+		"pg_userquery":           stringOption(&goAuthUserQuery),
+		"pg_superquery":          stringOption(&goAuthSuperQuery),
+		"pg_aclquery":            stringOption(&goAuthACLQuery),
+		"pg_max_life_time":       secondsOption(&goAuthMaxLifeTime, 0),
+		"disable_superuser":      boolOption(&goAuthDisableSuperuser),
+		"hasher_salt_encoding":   parseSaltEncoding,
+		"fallback_password_file": stringOption(&fallbackPasswordFile),
+		"fallback_acl_file":      stringOption(&fallbackACLFile),
+		"backends": func(v string) error {
+			chain, err := parseBackends(v)
+			if err != nil {
+				return fmt.Errorf("%v, keeping existing value %q", err, formatBackends(backendChain))
+			}
+			backendChain = chain
+			return nil
+		},
+		"mysql_dsn":       stringOption(&mysqlDSN),
+		"mysql_dsn_file":  stringOption(&mysqlDSNFile),
+		"redis_url":       stringOption(&redisURL),
+		"grpc_addr":       stringOption(&grpcAddr),
+		"grpc_tls":        boolOption(&grpcTLS),
+		"grpc_ca_file":    stringOption(&grpcCAFile),
+		"grpc_cert_file":  stringOption(&grpcCertFile),
+		"grpc_key_file":   stringOption(&grpcKeyFile),
+		"grpc_conns":      intOption(&grpcConns, 1, 64, ""),
+		"redis_prefix":    stringOption(&redisPrefix),
+		"redis_cache_ttl": atomicDurationOption(&redisCacheTTL, func(p *time.Duration) optionSetter { return secondsOption(p, 0) }),
+		"auth_grace_minutes": func(v string) error {
+			d, err := parseGraceMinutes(v)
+			if err != nil {
+				return err
+			}
+			authGrace = d
+			return nil
+		},
+		"cert_auto_register":        boolOption(&certAutoRegister),
+		"bootstrap_topic":           stringOption(&bootstrapTopic),
+		"bootstrap_users":           stringOption(&bootstrapUsers),
+		"bootstrap_response_prefix": stringOption(&bootstrapResponsePrefix),
+		"strict_options":            boolOption(&strictOptions),
+		"log_format":                choiceOption(&logFormat, parseLogFormat),
+		"log_level": func(v string) error {
+			lvl, ok := parseLogLevel(v)
+			if !ok {
+				return fmt.Errorf("want one of %s, keeping existing value %s",
+					strings.Join(logLevelNames, "/"), logLevelNames[logLevel.Load()])
+			}
+			logLevel.Store(int32(lvl))
+			return nil
+		},
+		"log_file":              stringOption(&logFile),
+		"log_sample_auth_allow": sampleOption(authAllowSampler),
+		"log_sample_acl_allow":  sampleOption(aclAllowSampler),
+		"redact_identifiers":    choiceOption(&redactMode, parseRedactMode),
+		"redact_salt":           stringOption(&redactSalt),
+		"log_dedup_interval":    secondsOption(&logDedupInterval, 0),
+		"go_memory_limit": func(v string) error {
+			n, err := parseByteSize(v)
+			if err != nil {
+				return err
+			}
+			goMemoryLimit = n
+			return nil
+		},
+		"go_gc_percent": func(v string) error {
+			n, err := parseGCPercent(v)
+			if err != nil {
+				return err
+			}
+			goGCPercent = n
+			return nil
+		},
+		"go_memory_ballast": func(v string) error {
+			n, err := parseByteSize(v)
+			if err != nil {
+				return err
+			}
+			goMemoryBallast = n
+			return nil
+		},
+		"pprof_listen":          stringOption(&pprofListen),
+		"admin_listen":          stringOption(&adminListen),
+		"admin_tls_cert":        stringOption(&adminTLSCert),
+		"admin_tls_key":         stringOption(&adminTLSKey),
+		"admin_client_ca":       stringOption(&adminClientCA),
+		"admin_allowed_clients": stringOption(&adminAllowedClients),
+		"pyroscope_url":         stringOption(&pyroscopeURL),
+		"pyroscope_app_name":    stringOption(&pyroscopeAppName),
+		"pyroscope_tenant_id":   stringOption(&pyroscopeTenantID),
+		"otel_endpoint":         stringOption(&otelEndpoint),
+		"otel_service_name":     stringOption(&otelServiceName),
+		"otel_sample_ratio": func(v string) error {
+			f, err := parseSampleRatio(v)
+			if err != nil {
+				return err
+			}
+			otelSampleRatio = f
+			return nil
+		},
+		"self_test": boolOption(&selfTestEnabled),
+		"failure_topk": func(v string) error {
+			n, err := parseTopK(v)
+			if err != nil {
+				return err
+			}
+			failureTopK = n
+			return nil
+		},
+		"config_audit_table":   boolOption(&configAuditTable),
+		"pg_dns_refresh":       secondsOption(&pgDNSRefresh, 0),
+		"flags_poll_interval":  secondsOption(&flagsPollInterval, 0),
+		"stats_table_interval": secondsOption(&statsTableInterval, 0),
+		"latency_budget_ms":    millisecondsOption(&latencyBudget, 0, noMax),
+		"latency_window":       secondsOption(&latencyWindow, 1),
+		"drain_timeout_ms":     millisecondsOption(&drainTimeout, 0, 60000),
+		"health_down_after":    intOption(&healthDownAfter, 0, noMax, "failures"),
+		"health_ping_interval": secondsOption(&healthPingInterval, 1),
+		"fail_open_warn_per_minute": func(v string) error {
+			n, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+			if err != nil || n < 0 {
+				return fmt.Errorf("want requests >= 0, keeping existing value %d", failOpenWarnPerMinute)
+			}
+			failOpenWarnPerMinute = n
+			return nil
+		},
+		"alert_webhook_url":         stringOption(&alertWebhookURL),
+		"activation_webhook_url":    stringOption(&activationWebhookURL),
+		"activation_webhook_secret": stringOption(&activationWebhookSecret),
+		"alert_dedup_interval":      secondsOption(&alertDedupInterval, 0),
+		"kafka_brokers":             stringOption(&kafkaBrokers),
+		"kafka_topic":               stringOption(&kafkaTopic),
+		"kafka_tls":                 boolOption(&kafkaTLS),
+		"kafka_sasl_mechanism":      choiceOption(&kafkaSASLMechanism, kafkasasl.Parse),
+		"kafka_username":            stringOption(&kafkaUsername),
+		"kafka_password":            stringOption(&kafkaPassword),
+		"kafka_password_file":       stringOption(&kafkaPasswordFile),
+		"kafka_format":              choiceOption(&kafkaFormat, parseKafkaFormat),
+		"kafka_schema_registry":     stringOption(&kafkaSchemaRegistry),
+		"statsd_addr":               stringOption(&statsdAddr),
+		"statsd_prefix":             stringOption(&statsdPrefix),
+		"statsd_tags":               stringOption(&statsdTags),
+		"statsd_interval":           secondsOption(&statsdInterval, 1),
+		"sys_interval":              secondsOption(&sysInterval, 0),
+		"weak_hash_policy":          choiceOption(&weakHashPolicy, parseWeakHashPolicy),
+		"min_bcrypt_cost":           intOption(&minBcryptCost, bcrypt.MinCost, bcrypt.MaxCost, ""),
+		"sha256_migration":          boolOption(&sha256Migration),
+		"control_users": func(v string) error {
+			controlUsers = parseControlUsers(v)
+			return nil
+		},
+		"config_instance":   stringOption(&configInstance),
+		"cloudsql_instance": stringOption(&cloudSQLInstance),
+		"cloudsql_iam_auth": boolOption(&cloudSQLIAMAuth),
+		"cloudsql_ip_type":  choiceOption(&cloudSQLIPType, parseCloudSQLIPType),
+		"azure_ad_auth":     boolOption(&azureADAuth),
+		"azure_client_id":   stringOption(&azureClientID),
+		"vault_addr":        stringOption(&vaultAddr),
+		"vault_token":       stringOption(&vaultToken),
+		"vault_token_file":  stringOption(&vaultTokenFile),
+		"vault_namespace":   stringOption(&vaultNamespace),
+		"vault_ca_file":     stringOption(&vaultCAFile),
+		"vault_db_mount":    stringOption(&vaultDBMount),
+		"vault_db_role":     stringOption(&vaultDBRole),
+	}
+	for _, k := range goAuthIgnoredOptions {
+		pluginOptions[k] = func(string) error { return nil }
+	}
+}
+
+// instanceOptions 返回每个插件实例各自持有的选项（见 instance.go）；其余选项是进程级的，只由 primary 配置。
+func instanceOptions(in *instance) map[string]optionSetter {
+	return map[string]optionSetter{
+		"pg_dsn":           stringOption(&in.pgDSN),
+		"pg_schema":        stringOption(&in.pgSchema),
+		"application_name": stringOption(&in.pgAppName),
+		"pg_session_params": func(v string) error {
+			params, err := parseSessionParams(v)
+			if err != nil {
+				return err
+			}
+			in.pgSessionParams = params
+			return nil
+		},
+		"timeout_ms": atomicDurationOption(&in.timeout, timeoutOption),
+		// fail_open 为旧选项，同时设置认证与 ACL 两侧
+		"fail_open": func(v string) error {
+			parsed, ok := parseBoolOption(v)
+			if !ok {
+				return fmt.Errorf("keeping existing values fail_open_auth=%t fail_open_acl=%t", in.failOpenAuth, in.failOpenACL)
+			}
+			in.failOpenAuth, in.failOpenACL = parsed, parsed
+			return nil
+		},
+		"fail_open_auth": boolOption(&in.failOpenAuth),
+		"fail_open_acl":  boolOption(&in.failOpenACL),
+		"enforce_bind":   boolOption(&in.enforceBind),
+		"acl_check":      boolOption(&in.enableACLCheck),
+		// disable_acl_check 为旧选项，与 acl_check 相反
+		"disable_acl_check": func(v string) error {
+			parsed, ok := parseBoolOption(v)
+			if !ok {
+				return fmt.Errorf("keeping existing value acl_check=%t", in.enableACLCheck)
+			}
+			in.enableACLCheck = !parsed
+			return nil
+		},
+		"disable_basic_auth": boolOption(&in.disableBasicAuth),
+	}
+}
+
+func stringOption(p *string) optionSetter {
+	return func(v string) error {
+		*p = strings.TrimSpace(v)
+		return nil
+	}
+}
+
+func boolOption(p *bool) optionSetter {
+	return func(v string) error {
+		parsed, ok := parseBoolOption(v)
+		if !ok {
+			return fmt.Errorf("keeping existing value %t", *p)
+		}
+		*p = parsed
+		return nil
+	}
+}
+
+func timeoutOption(p *time.Duration) optionSetter {
+	return func(v string) error {
+		dur, ok := parseTimeoutMS(v)
+		if !ok {
+			return fmt.Errorf("keeping existing value %dms", int(*p/time.Millisecond))
+		}
+		*p = dur
+		return nil
+	}
+}
+
+// atomicDuration 是可在运行时调整的时长：broker 线程写入，后台协程与管理 API 读取。
+type atomicDuration struct{ v atomic.Int64 }
+
+func (d *atomicDuration) get() time.Duration  { return time.Duration(d.v.Load()) }
+func (d *atomicDuration) set(v time.Duration) { d.v.Store(int64(v)) }
+
+// atomicDurationOption 用 setter 解析到临时值，成功后原子写入 p。
+func atomicDurationOption(p *atomicDuration, setter func(*time.Duration) optionSetter) optionSetter {
+	return func(v string) error {
+		d := p.get()
+		if err := setter(&d)(v); err != nil {
+			return err
+		}
+		p.set(d)
+		return nil
+	}
+}
+
+// noMax 表示整数选项没有上限。
+const noMax = math.MaxInt
+
+// intOption 接受 lo 到 hi 之间的整数；unit 只用于错误信息，例如 "want failures >= 0"。
+func intOption(p *int, lo, hi int, unit string) optionSetter {
+	return func(v string) error {
+		n, err := strconv.Atoi(strings.TrimSpace(v))
+		if err != nil || n < lo || n > hi {
+			return fmt.Errorf("want %s, keeping existing value %d", rangeText(unit, lo, hi), *p)
+		}
+		*p = n
+		return nil
+	}
+}
+
+// secondsOption 接受不小于 lo 的整数秒。
+func secondsOption(p *time.Duration, lo int) optionSetter {
+	return durationOption(p, time.Second, "seconds", lo, noMax)
+}
+
+// millisecondsOption 接受 lo 到 hi 之间的整数毫秒。
+func millisecondsOption(p *time.Duration, lo, hi int) optionSetter {
+	return durationOption(p, time.Millisecond, "milliseconds", lo, hi)
+}
+
+func durationOption(p *time.Duration, unit time.Duration, unitName string, lo, hi int) optionSetter {
+	return func(v string) error {
+		n, err := strconv.Atoi(strings.TrimSpace(v))
+		if err != nil || n < lo || n > hi {
+			return fmt.Errorf("want %s, keeping existing value %d", rangeText(unitName, lo, hi), int(*p/unit))
+		}
+		*p = time.Duration(n) * unit
+		return nil
+	}
+}
+
+// rangeText 描述取值范围：0-10、seconds > 0、failures >= 0。
+func rangeText(unit string, lo, hi int) string {
+	var r string
+	switch {
+	case hi != noMax:
+		r = fmt.Sprintf("%d-%d", lo, hi)
+	case lo == 1:
+		r = "> 0"
+	default:
+		r = fmt.Sprintf(">= %d", lo)
+	}
+	if unit == "" {
+		return r
+	}
+	return unit + " " + r
+}
+
+func choiceOption(p *string, parse func(string) (string, bool)) optionSetter {
+	return func(v string) error {
+		parsed, ok := parse(v)
+		if !ok {
+			return fmt.Errorf("keeping existing value %s", *p)
+		}
+		*p = parsed
+		return nil
+	}
+}
+
+// applyOption 把单个插件选项应用到实例 in，来源可以是 plugin_opt_* 或配置表。
+// 进程级选项只接受来自 primary 的设置。
+func applyOption(in *instance, k, v string) error {
+	set, ok := instanceOptions(in)[k]
+	if !ok && in != primary {
+		if _, known := pluginOptions[k]; known || strings.HasPrefix(k, listenerOptionPrefix) {
+			return fmt.Errorf("%s is process-wide and only accepted by the first plugin instance", k)
+		}
+	} else if !ok {
+		if strings.HasPrefix(k, listenerOptionPrefix) {
+			return setListenerOverride(k, v)
+		}
+		set, ok = pluginOptions[k]
+	}
+	if !ok {
+		if s := suggestOption(k); s != "" {
+			return fmt.Errorf("%w %s (did you mean %s?)", errUnknownOption, k, s)
+		}
+		return fmt.Errorf("%w %s", errUnknownOption, k)
+	}
+	if err := set(v); err != nil {
+		return fmt.Errorf("invalid %s=%q, %w", k, v, err)
+	}
+	if in == primary {
+		optionsMu.Lock()
+		configuredOptions[k] = v
+		optionsMu.Unlock()
+	}
+	return nil
+}
+
+// suggestOption 为拼写错误的键找编辑距离不超过 2 的已知选项（名单见 internal/optnames）。
+func suggestOption(k string) string {
+	return optnames.Suggest(k)
+}
+
+func editDistance(a, b string) int {
+	return optnames.EditDistance(a, b)
+}
+
+// aclOnlyOptions 只影响 ACL 检查，acl_check 关闭时不生效。
+var aclOnlyOptions = []string{"fail_open_acl", "fallback_acl_file", "pg_aclquery", "pg_superquery", "disable_superuser"}
+
+// kafkaOptions 只在设置了 kafka_brokers 时生效。
+var kafkaOptions = []string{
+	"kafka_topic", "kafka_tls", "kafka_sasl_mechanism", "kafka_username", "kafka_password", "kafka_password_file",
+	"kafka_format", "kafka_schema_registry",
+}
+
+// kafkaProblems 检查 kafka_brokers 已设置时 SASL 与 Avro 选项的组合。
+func kafkaProblems(set map[string]bool) []string {
+	var problems []string
+	if kafkaSASLMechanism == "" {
+		for _, k := range []string{"kafka_username", "kafka_password", "kafka_password_file"} {
+			if set[k] {
+				problems = append(problems, k+" has no effect without kafka_sasl_mechanism")
+			}
+		}
+	} else if kafkaUsername == "" {
+		problems = append(problems, "kafka_sasl_mechanism needs kafka_username")
+	}
+	if set["kafka_password"] && set["kafka_password_file"] {
+		problems = append(problems, "kafka_password and kafka_password_file both set; kafka_password_file takes precedence")
+	}
+	if kafkaFormat == kafkaFormatAvro && kafkaSchemaRegistry == "" {
+		problems = append(problems, "kafka_format=avro needs kafka_schema_registry")
+	}
+	if kafkaFormat != kafkaFormatAvro && set["kafka_schema_registry"] {
+		problems = append(problems, "kafka_schema_registry has no effect without kafka_format=avro")
+	}
+	return problems
+}
+
+// postgresOnlyOptions 依赖 pgx 连接池或 PostgreSQL 专有表，链上没有 postgres 后端时不生效。
+var postgresOnlyOptions = []string{
+	"pg_dsn", "pg_dsn_file", "pg_password_file", "pg_schema", "pg_session_params",
+	"pg_flavor", "crdb_max_retries", "crdb_follower_reads", "shard_column", "shard_value", "shard_separator",
+	"config_instance", "config_audit_table", "stats_table_interval", "flags_poll_interval", "pg_dns_refresh", "self_test",
+	"cloudsql_instance", "cloudsql_iam_auth", "cloudsql_ip_type", "azure_ad_auth", "azure_client_id", "vault_db_role",
+	"cert_auto_register", "bootstrap_topic", "activation_webhook_url",
+}
+
+// validateOptions 检查实例 in 的取值范围与组合冲突；set 为显式设置过的键。
+// 返回的问题在 strict_options 下导致启动失败，否则仅告警。进程级的检查只对 primary 进行。
+func validateOptions(in *instance, set map[string]bool) []string {
+	var problems []string
+	if in.timeout.get() > maxTimeout {
+		problems = append(problems, fmt.Sprintf("timeout_ms=%d exceeds %dms; callbacks block the broker while waiting",
+			int(in.timeout.get()/time.Millisecond), int(maxTimeout/time.Millisecond)))
+	}
+	if set["fail_open"] && (set["fail_open_auth"] || set["fail_open_acl"]) {
+		problems = append(problems, "fail_open is deprecated and conflicts with fail_open_auth/fail_open_acl; the last one set wins")
+	}
+	if set["disable_acl_check"] && set["acl_check"] {
+		problems = append(problems, "disable_acl_check is deprecated and conflicts with acl_check; the last one set wins")
+	}
+	if !in.enableACLCheck {
+		for _, k := range aclOnlyOptions {
+			if set[k] {
+				problems = append(problems, k+" has no effect without acl_check=true")
+			}
+		}
+	}
+	if in.disableBasicAuth {
+		if !in.enableACLCheck {
+			problems = append(problems, "disable_basic_auth is set and acl_check is off; the plugin checks nothing")
+		}
+		for _, k := range []string{"fail_open_auth", "auth_grace_minutes", "enforce_bind"} {
+			if set[k] {
+				problems = append(problems, k+" has no effect with disable_basic_auth=true")
+			}
+		}
+	}
+	if in != primary {
+		return problems
+	}
+	if in.failOpenAuth && authGrace > 0 {
+		problems = append(problems, "auth_grace_minutes has no effect while fail_open_auth=true")
+	}
+	if weakHashPolicy == weakHashAllow && (set["min_bcrypt_cost"] || set["sha256_migration"]) {
+		problems = append(problems, "min_bcrypt_cost/sha256_migration have no effect with weak_hash_policy=allow")
+	}
+	if otelEndpoint == "" && (set["otel_service_name"] || set["otel_sample_ratio"]) {
+		problems = append(problems, "otel_service_name/otel_sample_ratio have no effect without otel_endpoint")
+	}
+	if healthDownAfter == 0 && set["health_ping_interval"] {
+		problems = append(problems, "health_ping_interval has no effect without health_down_after")
+	}
+	if kafkaBrokers == "" {
+		for _, k := range kafkaOptions {
+			if set[k] {
+				problems = append(problems, k+" has no effect without kafka_brokers")
+			}
+		}
+	} else {
+		problems = append(problems, kafkaProblems(set)...)
+	}
+	if statsdAddr == "" {
+		for _, k := range []string{"statsd_prefix", "statsd_tags", "statsd_interval"} {
+			if set[k] {
+				problems = append(problems, k+" has no effect without statsd_addr")
+			}
+		}
+	}
+	if goGCPercent == -1 && goMemoryLimit == 0 {
+		problems = append(problems, "go_gc_percent=off without go_memory_limit lets the plugin's heap grow without bound")
+	}
+	if goMemoryBallast > 0 && goMemoryLimit > 0 && goMemoryBallast >= goMemoryLimit {
+		problems = append(problems, "go_memory_ballast is not smaller than go_memory_limit; the GC would run continuously")
+	}
+	if pprofListen != "" && !isLoopbackAddr(pprofListen) {
+		problems = append(problems, "pprof_listen "+pprofListen+" is not a loopback address; profiles expose process internals without authentication")
+	}
+	if adminListen == "" {
+		for _, k := range []string{"admin_tls_cert", "admin_tls_key", "admin_client_ca", "admin_allowed_clients"} {
+			if set[k] {
+				problems = append(problems, k+" has no effect without admin_listen")
+			}
+		}
+	} else if adminTLSCert == "" || adminTLSKey == "" || adminClientCA == "" {
+		problems = append(problems, "admin_listen needs admin_tls_cert, admin_tls_key and admin_client_ca (the API only accepts client certificates)")
+	} else if shardColumn != "" || compatMode == compatGoAuth {
+		problems = append(problems, "admin_listen does not support shard_column or compat mosquitto-go-auth")
+	}
+	if logFile != "" && logFormat != logFormatJSON {
+		problems = append(problems, "log_file has no effect without log_format=json")
+	}
+	if set["latency_window"] && latencyBudget == 0 {
+		problems = append(problems, "latency_window has no effect without latency_budget_ms")
+	}
+	if latencyBudget > 0 && latencyBudget >= in.timeout.get() {
+		problems = append(problems, fmt.Sprintf("latency_budget_ms=%d is not below timeout_ms=%d; checks time out before the budget warns",
+			int(latencyBudget/time.Millisecond), int(in.timeout.get()/time.Millisecond)))
+	}
+	if set["redact_salt"] && redactMode != redactHash {
+		problems = append(problems, "redact_salt has no effect without redact_identifiers=hash")
+	}
+	if set["pg_dsn"] && set["pg_dsn_file"] {
+		problems = append(problems, "pg_dsn and pg_dsn_file both set; pg_dsn_file takes precedence")
+	}
+	if cloudSQLInstance == "" {
+		for _, k := range []string{"cloudsql_iam_auth", "cloudsql_ip_type"} {
+			if set[k] {
+				problems = append(problems, k+" has no effect without cloudsql_instance")
+			}
+		}
+	} else if pgDNSRefresh > 0 {
+		problems = append(problems, "pg_dns_refresh has no effect with cloudsql_instance")
+	}
+	if !azureADAuth && set["azure_client_id"] {
+		problems = append(problems, "azure_client_id has no effect without azure_ad_auth")
+	}
+	if vaultDBRole == "" {
+		for _, k := range []string{"vault_addr", "vault_token", "vault_token_file", "vault_namespace", "vault_ca_file", "vault_db_mount"} {
+			if set[k] {
+				problems = append(problems, k+" has no effect without vault_db_role")
+			}
+		}
+	}
+	if pgPasswordFile != "" && (vaultDBRole != "" || azureADAuth || cloudSQLIAMAuth) {
+		problems = append(problems, "pg_password_file is overridden by token/Vault credentials")
+	}
+	if healthDownAfter <= 0 && (set["fallback_password_file"] || set["fallback_acl_file"]) {
+		problems = append(problems, "fallback_password_file/fallback_acl_file are only used while the database is marked down and need health_down_after")
+	}
+	if compatMode == compatGoAuth {
+		if goAuthUserQuery == "" {
+			problems = append(problems, "compat mosquitto-go-auth needs pg_userquery")
+		}
+		if !usesBackend(driverPostgres) {
+			problems = append(problems, "compat mosquitto-go-auth only applies to the postgres backend")
+		}
+		for _, k := range []string{"enforce_bind", "self_test"} {
+			if set[k] {
+				problems = append(problems, k+" has no effect with compat mosquitto-go-auth; it needs this plugin's tables")
+			}
+		}
+		if set["pg_dsn"] || set["pg_dsn_file"] {
+			for _, k := range goAuthConnOptions {
+				if set[k] {
+					problems = append(problems, k+" is ignored because pg_dsn/pg_dsn_file is set")
+				}
+			}
+		}
+	} else {
+		for _, k := range goAuthOnlyOptions {
+			if set[k] {
+				problems = append(problems, k+" is a mosquitto-go-auth option and has no effect without compat mosquitto-go-auth")
+			}
+		}
+	}
+	if pgFlavor != flavorCockroach {
+		for _, k := range []string{"crdb_max_retries", "crdb_follower_reads"} {
+			if set[k] {
+				problems = append(problems, k+" has no effect without pg_flavor cockroachdb")
+			}
+		}
+	} else if crdbFollowerReads && compatMode == compatGoAuth {
+		problems = append(problems, "crdb_follower_reads has no effect with compat mosquitto-go-auth; pg_userquery and pg_aclquery run as written")
+	}
+	if shardColumn == "" {
+		for _, k := range []string{"shard_value", "shard_separator"} {
+			if set[k] {
+				problems = append(problems, k+" has no effect without shard_column")
+			}
+		}
+	} else if compatMode == compatGoAuth {
+		problems = append(problems, "shard_column has no effect with compat mosquitto-go-auth; pg_userquery and pg_aclquery run as written")
+	} else if shardValue == "" && shardSeparator == "" {
+		problems = append(problems, "shard_column needs shard_value or a non-empty shard_separator to find the shard key")
+	}
+	if krb5Keytab == "" {
+		for _, k := range []string{"krb5_service", "krb5_principal_map"} {
+			if set[k] {
+				problems = append(problems, k+" has no effect without krb5_keytab")
+			}
+		}
+	} else if _, err := parsePrincipalMap(krb5PrincipalMap); err != nil {
+		problems = append(problems, err.Error())
+	}
+	if certAutoRegister {
+		switch {
+		case !in.enableACLCheck:
+			problems = append(problems, "cert_auto_register has no effect without acl_check=true")
+		case shardColumn != "":
+			problems = append(problems, "cert_auto_register does not support shard_column")
+		case compatMode == compatGoAuth:
+			problems = append(problems, "cert_auto_register has no effect with compat mosquitto-go-auth")
+		}
+	}
+	if bootstrapTopic == "" {
+		for _, k := range []string{"bootstrap_users", "bootstrap_response_prefix"} {
+			if set[k] {
+				problems = append(problems, k+" has no effect without bootstrap_topic")
+			}
+		}
+	} else if problem := checkBootstrap(bootstrapTopic, bootstrapUsers, bootstrapResponsePrefix); problem != "" {
+		problems = append(problems, problem)
+	} else if !in.enableACLCheck {
+		problems = append(problems, "bootstrap_topic has no effect without acl_check=true")
+	} else if shardColumn != "" || compatMode == compatGoAuth {
+		problems = append(problems, "bootstrap_topic does not support shard_column or compat mosquitto-go-auth")
+	}
+	if activationWebhookURL == "" {
+		if set["activation_webhook_secret"] {
+			problems = append(problems, "activation_webhook_secret has no effect without activation_webhook_url")
+		}
+	} else if u, err := url.Parse(activationWebhookURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		problems = append(problems, "activation_webhook_url must be an http(s) URL")
+	} else if shardColumn != "" || compatMode == compatGoAuth {
+		problems = append(problems, "activation_webhook_url does not support shard_column or compat mosquitto-go-auth")
+	}
+	if set["backends"] && set["db_driver"] {
+		problems = append(problems, "db_driver has no effect when backends is set")
+	}
+	if !usesBackend(driverPostgres) {
+		for _, k := range postgresOnlyOptions {
+			if set[k] {
+				problems = append(problems, k+" is PostgreSQL-only and has no effect with "+backendNames())
+			}
+		}
+	}
+	if !usesBackend(driverMySQL) && (set["mysql_dsn"] || set["mysql_dsn_file"]) {
+		problems = append(problems, "mysql_dsn/mysql_dsn_file have no effect without db_driver=mysql or mysql in backends")
+	}
+	sqlBackend := usesBackend(driverPostgres) || usesBackend(driverMySQL)
+	if !sqlBackend && redisCacheTTL.get() > 0 {
+		problems = append(problems, "redis_cache_ttl has no effect with "+backendNames())
+	}
+	if strings.TrimSpace(totpUsers) == "" {
+		if set["totp_skew"] {
+			problems = append(problems, "totp_skew has no effect without totp_users")
+		}
+	} else if !sqlBackend {
+		problems = append(problems, "totp_users needs a postgres or mysql backend (totp_secret column); those accounts cannot log in with "+backendNames())
+	} else if usesBackend(driverGRPC) {
+		problems = append(problems, "totp_users cannot be combined with the grpc backend: the authorizer does not check the code, so those accounts cannot log in through it")
+	}
+	if usesBackend(driverGRPC) {
+		if !usesStore() {
+			for _, k := range []string{"enforce_bind", "weak_hash_policy", "min_bcrypt_cost", "sha256_migration"} {
+				if set[k] {
+					problems = append(problems, k+" has no effect with db_driver=grpc; the authorizer decides")
+				}
+			}
+		}
+		if !grpcTLS && grpcAddr != "" && !isLoopbackTarget(grpcAddr) {
+			problems = append(problems, "grpc_addr "+grpcAddr+" is not a loopback address and grpc_tls is off; passwords are sent in clear text")
+		}
+	} else {
+		for _, k := range []string{"grpc_addr", "grpc_tls", "grpc_ca_file", "grpc_cert_file", "grpc_key_file", "grpc_conns"} {
+			if set[k] {
+				problems = append(problems, k+" has no effect without db_driver=grpc or grpc in backends")
+			}
+		}
+	}
+	if !grpcTLS && (set["grpc_ca_file"] || set["grpc_cert_file"] || set["grpc_key_file"]) {
+		problems = append(problems, "grpc_ca_file/grpc_cert_file/grpc_key_file have no effect without grpc_tls")
+	}
+	if (grpcCertFile == "") != (grpcKeyFile == "") {
+		problems = append(problems, "grpc_cert_file and grpc_key_file must be set together")
+	}
+	if !usesBackend(driverRedis) && redisCacheTTL.get() == 0 && (set["redis_url"] || set["redis_prefix"]) {
+		problems = append(problems, "redis_url/redis_prefix have no effect without db_driver=redis, redis in backends or redis_cache_ttl")
+	}
+	if set["mysql_dsn"] && set["mysql_dsn_file"] {
+		problems = append(problems, "mysql_dsn and mysql_dsn_file both set; mysql_dsn_file takes precedence")
+	}
+	return problems
+}
+
+func envBool(name string) bool {
+	if v, ok := parseBoolOption(os.Getenv(name)); ok {
+		return v
+	}
+	return false
+}
+
+func parseBoolOption(v string) (value bool, ok bool) {
+	switch strings.ToLower(strings.TrimSpace(v)) {
+	case "1", "true", "t", "yes", "y", "on":
+		return true, true
+	case "0", "false", "f", "no", "n", "off":
+		return false, true
+	default:
+		return false, false
+	}
+}
+
+func parseTimeoutMS(v string) (time.Duration, bool) {
+	n, err := strconv.Atoi(strings.TrimSpace(v))
+	if err != nil || n <= 0 {
+		return 0, false
+	}
+	return time.Duration(n) * time.Millisecond, true
+}
+
+// reportOptionProblems 记录选项问题；strict_options 下有问题即返回 false 以拒绝加载。
+func reportOptionProblems(problems []string) bool {
+	level := logWarning
+	if strictOptions {
+		level = logErr
+	}
+	for _, p := range problems {
+		mosqLog(level, "auth-plugin: %s", p)
+	}
+	if strictOptions && len(problems) > 0 {
+		mosqLog(logErr, "auth-plugin: strict_options=true, refusing to start with %d option problem(s)", len(problems))
+		return false
+	}
+	return true
+}
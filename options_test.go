@@ -0,0 +1,165 @@
+package main
+
+import (
+	"errors"
+	"slices"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"auth-plugin/internal/optnames"
+)
+
+func TestApplyOption(t *testing.T) {
+	oldTimeout, oldEnforce := primary.timeout.get(), primary.enforceBind
+	t.Cleanup(func() {
+		primary.timeout.set(oldTimeout)
+		primary.enforceBind = oldEnforce
+	})
+
+	if err := applyOption(primary, "timeout_ms", "250"); err != nil || primary.timeout.get() != 250*time.Millisecond {
+		t.Fatalf("applyOption(timeout_ms) = %v, timeout=%v", err, primary.timeout.get())
+	}
+	if err := applyOption(primary, "enforce_bind", "yes"); err != nil || !primary.enforceBind {
+		t.Fatalf("applyOption(enforce_bind) = %v", err)
+	}
+	if err := applyOption(primary, "timeout_ms", "abc"); err == nil || primary.timeout.get() != 250*time.Millisecond {
+		t.Fatalf("applyOption(timeout_ms=abc) = %v, timeout=%v; want error and unchanged value", err, primary.timeout.get())
+	}
+	err := applyOption(primary, "fail_opne", "true")
+	if !errors.Is(err, errUnknownOption) || !strings.Contains(err.Error(), "did you mean fail_open?") {
+		t.Fatalf("applyOption(fail_opne) = %v, want unknown option with suggestion", err)
+	}
+}
+
+func TestNumericOptions(t *testing.T) {
+	t.Parallel()
+	n := 5
+	set := intOption(&n, 0, 10, "")
+	if err := set(" 7 "); err != nil || n != 7 {
+		t.Fatalf("intOption(7) = %v, n=%d", err, n)
+	}
+	if err := set("11"); err == nil || err.Error() != "want 0-10, keeping existing value 7" || n != 7 {
+		t.Fatalf("intOption(11) = %v, n=%d", err, n)
+	}
+
+	d := 30 * time.Second
+	sec := secondsOption(&d, 1)
+	if err := sec("0"); err == nil || err.Error() != "want seconds > 0, keeping existing value 30" {
+		t.Fatalf("secondsOption(0) = %v", err)
+	}
+	if err := sec("45"); err != nil || d != 45*time.Second {
+		t.Fatalf("secondsOption(45) = %v, d=%v", err, d)
+	}
+	ms := millisecondsOption(&d, 0, noMax)
+	if err := ms("-1"); err == nil || err.Error() != "want milliseconds >= 0, keeping existing value 45000" {
+		t.Fatalf("millisecondsOption(-1) = %v", err)
+	}
+}
+
+func TestEditDistance(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"fail_open", "fail_open", 0},
+		{"fail_opne", "fail_open", 2},
+		{"timeout", "timeout_ms", 3},
+		{"", "abc", 3},
+	}
+	for _, tc := range tests {
+		if got := editDistance(tc.a, tc.b); got != tc.want {
+			t.Fatalf("editDistance(%q, %q) = %d, want %d", tc.a, tc.b, got, tc.want)
+		}
+	}
+}
+
+// internal/optnames 是 doctor 等工具使用的选项名单，必须与注册表一致。
+func TestOptionNamesInSync(t *testing.T) {
+	t.Parallel()
+	var names []string
+	for k := range pluginOptions {
+		names = append(names, k)
+	}
+	for k := range instanceOptions(primary) {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	if !slices.Equal(names, optnames.Names) {
+		t.Fatalf("internal/optnames.Names is out of date; want:\n%q", names)
+	}
+}
+
+func TestValidateOptions(t *testing.T) {
+	oldTimeout, oldAzure, oldVault := primary.timeout.get(), azureADAuth, vaultDBRole
+	t.Cleanup(func() {
+		primary.timeout.set(oldTimeout)
+		azureADAuth, vaultDBRole = oldAzure, oldVault
+	})
+
+	primary.timeout.set(1500 * time.Millisecond)
+	azureADAuth, vaultDBRole = false, ""
+	if problems := validateOptions(primary, map[string]bool{"pg_dsn": true}); len(problems) != 0 {
+		t.Fatalf("validateOptions with defaults = %v, want none", problems)
+	}
+
+	primary.timeout.set(2 * maxTimeout)
+	problems := validateOptions(primary, map[string]bool{"azure_client_id": true, "vault_addr": true})
+	if len(problems) != 3 {
+		t.Fatalf("validateOptions = %v, want timeout range + 2 orphaned options", problems)
+	}
+
+	oldACLCheck := primary.enableACLCheck
+	t.Cleanup(func() { primary.enableACLCheck = oldACLCheck })
+	primary.timeout.set(1500 * time.Millisecond)
+	primary.enableACLCheck = false
+	if problems := validateOptions(primary, map[string]bool{"fail_open_acl": true}); len(problems) != 1 {
+		t.Fatalf("validateOptions = %v, want fail_open_acl without ACL checks", problems)
+	}
+	// ACL 检查默认关闭，disable_acl_check 是与 acl_check 相反的旧选项
+	if err := applyOption(primary, "disable_acl_check", "false"); err != nil || !primary.enableACLCheck {
+		t.Fatalf("disable_acl_check=false must enable ACL checks: %v", err)
+	}
+	if problems := validateOptions(primary, map[string]bool{"fail_open_acl": true}); len(problems) != 0 {
+		t.Fatalf("validateOptions = %v, want none with ACL checks on", problems)
+	}
+	primary.enableACLCheck = false
+
+	oldDisableAuth := primary.disableBasicAuth
+	t.Cleanup(func() { primary.disableBasicAuth = oldDisableAuth })
+	primary.disableBasicAuth = true
+	if problems := validateOptions(primary, map[string]bool{"enforce_bind": true}); len(problems) != 2 {
+		t.Fatalf("validateOptions = %v, want nothing-to-check + enforce_bind without auth", problems)
+	}
+	primary.disableBasicAuth = false
+
+	oldChain, oldTOTP, oldGRPC := backendChain, totpUsers, grpcAddr
+	t.Cleanup(func() { backendChain, totpUsers, grpcAddr = oldChain, oldTOTP, oldGRPC })
+	backendChain, _ = parseBackends("postgres,grpc")
+	totpUsers, grpcAddr = "dashboard", "127.0.0.1:9000"
+	problems = validateOptions(primary, map[string]bool{"totp_users": true})
+	if len(problems) != 1 || !strings.Contains(problems[0], "cannot be combined with the grpc backend") {
+		t.Fatalf("validateOptions = %v, want totp_users rejected with grpc", problems)
+	}
+	backendChain, totpUsers = nil, ""
+
+	oldBrokers, oldMechanism, oldUser, oldFormat, oldRegistry := kafkaBrokers, kafkaSASLMechanism, kafkaUsername, kafkaFormat, kafkaSchemaRegistry
+	t.Cleanup(func() {
+		kafkaBrokers, kafkaSASLMechanism, kafkaUsername, kafkaFormat, kafkaSchemaRegistry = oldBrokers, oldMechanism, oldUser, oldFormat, oldRegistry
+	})
+	kafkaUsername = "mqtt"
+	if problems := validateOptions(primary, map[string]bool{"kafka_username": true}); len(problems) != 1 {
+		t.Fatalf("validateOptions = %v, want kafka_username without kafka_brokers", problems)
+	}
+	kafkaBrokers, kafkaFormat = "k:9092", kafkaFormatAvro
+	problems = validateOptions(primary, map[string]bool{"kafka_brokers": true, "kafka_username": true, "kafka_format": true})
+	if strings.Join(problems, "; ") != "kafka_username has no effect without kafka_sasl_mechanism; kafka_format=avro needs kafka_schema_registry" {
+		t.Fatalf("validateOptions = %v, want SASL and Avro problems", problems)
+	}
+	kafkaSASLMechanism, kafkaSchemaRegistry = "scram-sha-512", "http://registry:8081"
+	if problems := validateOptions(primary, map[string]bool{"kafka_brokers": true, "kafka_username": true, "kafka_format": true}); len(problems) != 0 {
+		t.Fatalf("validateOptions = %v, want none", problems)
+	}
+}
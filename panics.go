@@ -0,0 +1,34 @@
+package main
+
+import (
+	"fmt"
+	"runtime/debug"
+	"sync/atomic"
+
+	"auth-plugin/pkg/mosqplugin"
+)
+
+// BASIC_AUTH / ACL_CHECK 回调中的 panic 按一次内部错误处理：记录堆栈、计入 callback_panics 并告警，
+// 然后与数据库出错时一样由 fail_open_auth / fail_open_acl 决定放行还是拒绝。其他回调中的 panic
+// 由 pkg/mosqplugin 兜底（拒绝或忽略），同样计入 callback_panics。
+
+var callbackPanics atomic.Int64
+
+// callbackPanic 处理 event（"auth" 或 "acl"）回调中恢复的 panic r，返回给 broker 的值、
+// 事件日志中的结论与错误。
+func callbackPanic(event string, r any, failOpen bool) (mosqplugin.Result, string, error) {
+	callbackPanics.Add(1)
+	err := fmt.Errorf("panic: %v", r)
+	mosqLog(logErr, "auth-plugin: panic in %s callback: %v\n%s", event, r, debug.Stack())
+	raiseAlert("callback_panic", "recovered from a panic in the %s callback: %v", event, r)
+	if failOpen {
+		recordFailOpen(event)
+		return mosqplugin.Success, resultFailOpen, err
+	}
+	if event == "auth" {
+		authErrors.Add(1)
+		return mosqplugin.AuthDenied, resultError, err
+	}
+	aclErrors.Add(1)
+	return mosqplugin.ACLDenied, resultError, err
+}
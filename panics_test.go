@@ -0,0 +1,26 @@
+package main
+
+import (
+	"testing"
+
+	"auth-plugin/pkg/mosqplugin"
+)
+
+func TestCallbackPanic(t *testing.T) {
+	before, beforeOpen := callbackPanics.Load(), aclFailOpen.Load()
+	if rc, result, err := callbackPanic("auth", "boom", false); rc != mosqplugin.AuthDenied || result != resultError || err == nil {
+		t.Fatalf("auth panic, fail-closed = %d, %q, %v", rc, result, err)
+	}
+	if rc, result, _ := callbackPanic("acl", "boom", false); rc != mosqplugin.ACLDenied || result != resultError {
+		t.Fatalf("acl panic, fail-closed = %d, %q", rc, result)
+	}
+	if rc, result, _ := callbackPanic("acl", "boom", true); rc != mosqplugin.Success || result != resultFailOpen {
+		t.Fatalf("acl panic with fail_open_acl = %d, %q", rc, result)
+	}
+	if callbackPanics.Load() != before+3 || aclFailOpen.Load() != beforeOpen+1 {
+		t.Fatal("panics and fail-open allows must be counted")
+	}
+	if statsMap()["callback_panics"] < 3 {
+		t.Fatal("callback_panics missing from stats")
+	}
+}
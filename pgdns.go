@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// pg_dns_refresh：PostgreSQL 主机是 Kubernetes Service 或靠 DNS 切换的故障转移域名时，pgx 只在建立连接时解析，
+// 池里的连接会一直连着旧地址，直到出错或到期。开启后后台每隔这么多秒重新解析 DSN 中的主机（含多主机 DSN 的备用主机），
+// 地址变化时连接旧地址的连接被替换：空闲的立即关闭，借出的在归还时关闭，新连接按新地址建立。
+// 解析失败时保留上一次的结果。unix socket、IP 字面量与 Cloud SQL（自己拨号）不需要也不做重新解析。
+
+var (
+	pgDNSRefresh time.Duration // 0 表示不重新解析
+
+	dnsStop chan struct{}
+	dnsDone chan struct{}
+
+	dnsChanges  atomic.Int64 // 解析结果变化的次数
+	dnsReplaced atomic.Int64 // 因地址变化关闭的连接数
+
+	lookupHost = net.DefaultResolver.LookupNetIP
+)
+
+// pgHostAddrs 是一个连接池的主机名与最近一次解析到的地址；addrs 为 nil 时还没有解析过，所有连接都视为有效。
+type pgHostAddrs struct {
+	hosts []string
+	addrs map[netip.Addr]bool
+}
+
+// dnsHosts 返回 cfg 中需要重新解析的主机名；没有时返回 nil。
+func dnsHosts(cfg *pgxpool.Config) []string {
+	if cloudSQLInstance != "" {
+		return nil
+	}
+	var hosts []string
+	add := func(h string) {
+		if h == "" || strings.HasPrefix(h, "/") || slices.Contains(hosts, h) {
+			return
+		}
+		if _, err := netip.ParseAddr(h); err == nil {
+			return
+		}
+		hosts = append(hosts, h)
+	}
+	add(cfg.ConnConfig.Host)
+	for _, fb := range cfg.ConnConfig.Fallbacks {
+		add(fb.Host)
+	}
+	return hosts
+}
+
+// watchDNS 让连接池在取出与归还连接时检查连接的地址，由 poolConfigFor 调用。
+func (in *instance) watchDNS(cfg *pgxpool.Config) {
+	hosts := dnsHosts(cfg)
+	if pgDNSRefresh <= 0 || len(hosts) == 0 {
+		in.pgAddrs.Store(nil)
+		return
+	}
+	in.pgAddrs.Store(&pgHostAddrs{hosts: hosts})
+	cfg.PrepareConn = func(_ context.Context, c *pgx.Conn) (bool, error) { return in.connCurrent(c), nil }
+	cfg.AfterRelease = in.connCurrent
+}
+
+// connCurrent 报告连接是否仍连着主机当前解析到的地址。
+func (in *instance) connCurrent(c *pgx.Conn) bool {
+	a := in.pgAddrs.Load()
+	if a == nil || a.addrs == nil {
+		return true
+	}
+	ta, ok := c.PgConn().Conn().RemoteAddr().(*net.TCPAddr)
+	if !ok {
+		return true
+	}
+	if a.addrs[ta.AddrPort().Addr().Unmap()] {
+		return true
+	}
+	dnsReplaced.Add(1)
+	return false
+}
+
+// resolvePGHosts 解析全部主机，返回地址集合；任一主机解析失败时返回错误。
+func resolvePGHosts(ctx context.Context, hosts []string) (map[netip.Addr]bool, error) {
+	addrs := map[netip.Addr]bool{}
+	for _, h := range hosts {
+		ips, err := lookupHost(ctx, "ip", h)
+		if err != nil {
+			return nil, err
+		}
+		for _, ip := range ips {
+			addrs[ip.Unmap()] = true
+		}
+	}
+	return addrs, nil
+}
+
+// refreshDNS 重新解析实例的主机；地址变化时关闭空闲连接中连着旧地址的那些。
+func (in *instance) refreshDNS(ctx context.Context) {
+	cur := in.pgAddrs.Load()
+	p := in.currentPool()
+	if cur == nil || p == nil {
+		return
+	}
+	addrs, err := resolvePGHosts(ctx, cur.hosts)
+	if err != nil {
+		mosqLogDeduped(logWarning, "auth-plugin: cannot re-resolve PostgreSQL host: %v (keeping current connections)", err)
+		return
+	}
+	if cur.addrs != nil && sameAddrs(cur.addrs, addrs) {
+		return
+	}
+	in.pgAddrs.CompareAndSwap(cur, &pgHostAddrs{hosts: cur.hosts, addrs: addrs})
+	if cur.addrs == nil {
+		return
+	}
+	dnsChanges.Add(1)
+	mosqLog(logNotice, "auth-plugin: PostgreSQL host %s now resolves to %s, replacing connections to old addresses",
+		strings.Join(cur.hosts, ","), formatAddrs(addrs))
+	// AcquireAllIdle 对每个空闲连接调用 PrepareConn，连着旧地址的随即被销毁
+	for _, c := range p.AcquireAllIdle(ctx) {
+		c.Release()
+	}
+}
+
+func sameAddrs(a, b map[netip.Addr]bool) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for ip := range a {
+		if !b[ip] {
+			return false
+		}
+	}
+	return true
+}
+
+func formatAddrs(addrs map[netip.Addr]bool) string {
+	out := make([]string, 0, len(addrs))
+	for ip := range addrs {
+		out = append(out, ip.String())
+	}
+	slices.Sort(out)
+	return strings.Join(out, ",")
+}
+
+// refreshAllDNS 依次处理所有实例；每个实例使用自己的 timeout_ms。
+func refreshAllDNS() {
+	instancesMu.Lock()
+	var all []*instance
+	for _, in := range instances {
+		if in != nil {
+			all = append(all, in)
+		}
+	}
+	instancesMu.Unlock()
+	for _, in := range all {
+		ctx, cancel := in.ctxTimeout()
+		in.refreshDNS(ctx)
+		cancel()
+	}
+}
+
+func startDNSRefresh() {
+	if pgDNSRefresh <= 0 {
+		return
+	}
+	stop, done := make(chan struct{}), make(chan struct{})
+	dnsStop, dnsDone = stop, done
+	go func() {
+		defer close(done)
+		t := time.NewTicker(pgDNSRefresh)
+		defer t.Stop()
+		refreshAllDNS()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-t.C:
+				refreshAllDNS()
+			}
+		}
+	}()
+}
+
+func stopDNSRefresh() {
+	if dnsStop == nil {
+		return
+	}
+	close(dnsStop)
+	<-dnsDone
+	dnsStop, dnsDone = nil, nil
+}
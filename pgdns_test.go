@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+func TestDNSHosts(t *testing.T) {
+	for _, tc := range []struct {
+		dsn  string
+		want []string
+	}{
+		{"postgres://u@pg.default.svc:5432/db", []string{"pg.default.svc"}},
+		{"postgres://u@pg-a:5432,pg-b:5433,pg-a:5434/db", []string{"pg-a", "pg-b"}},
+		{"postgres://u@10.0.0.5/db", nil},
+		{"postgres://u@[::1]/db", nil},
+		{"host=/var/run/postgresql user=u", nil},
+		{"postgres://u@10.0.0.5,pg-b/db", []string{"pg-b"}},
+	} {
+		cfg, err := pgxpool.ParseConfig(tc.dsn)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.dsn, err)
+		}
+		if got := dnsHosts(cfg); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("dnsHosts(%s) = %v, want %v", tc.dsn, got, tc.want)
+		}
+	}
+
+	old := cloudSQLInstance
+	t.Cleanup(func() { cloudSQLInstance = old })
+	cloudSQLInstance = "proj:region:db"
+	cfg, _ := pgxpool.ParseConfig("postgres://u@pg.default.svc/db")
+	if got := dnsHosts(cfg); got != nil {
+		t.Fatalf("Cloud SQL dials by itself, got %v", got)
+	}
+}
+
+func TestWatchDNS(t *testing.T) {
+	old := pgDNSRefresh
+	t.Cleanup(func() { pgDNSRefresh = old })
+	in := &instance{}
+
+	pgDNSRefresh = 0
+	cfg, _ := pgxpool.ParseConfig("postgres://u@pg.default.svc/db")
+	in.watchDNS(cfg)
+	if cfg.PrepareConn != nil || cfg.AfterRelease != nil || in.pgAddrs.Load() != nil {
+		t.Fatal("pg_dns_refresh=0 must not install hooks")
+	}
+
+	pgDNSRefresh = 30 * time.Second
+	in.watchDNS(cfg)
+	a := in.pgAddrs.Load()
+	if cfg.PrepareConn == nil || cfg.AfterRelease == nil || a == nil || a.addrs != nil {
+		t.Fatalf("hooks not installed, addrs %+v", a)
+	}
+	// 尚未解析时所有连接都有效
+	if !in.connCurrent(nil) {
+		t.Fatal("connections must be kept before the first resolution")
+	}
+
+	ip, _ := pgxpool.ParseConfig("postgres://u@10.0.0.5/db")
+	in.watchDNS(ip)
+	if ip.PrepareConn != nil || in.pgAddrs.Load() != nil {
+		t.Fatal("IP literal hosts need no re-resolution")
+	}
+}
+
+func TestResolvePGHosts(t *testing.T) {
+	old := lookupHost
+	t.Cleanup(func() { lookupHost = old })
+	table := map[string][]netip.Addr{
+		"pg-a": {netip.MustParseAddr("10.0.0.1"), netip.MustParseAddr("::ffff:10.0.0.2")},
+		"pg-b": {netip.MustParseAddr("10.0.0.1"), netip.MustParseAddr("fd00::3")},
+	}
+	lookupHost = func(_ context.Context, _, host string) ([]netip.Addr, error) {
+		if ips, ok := table[host]; ok {
+			return ips, nil
+		}
+		return nil, errors.New("no such host")
+	}
+
+	got, err := resolvePGHosts(context.Background(), []string{"pg-a", "pg-b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if formatAddrs(got) != "10.0.0.1,10.0.0.2,fd00::3" {
+		t.Fatalf("resolved %s", formatAddrs(got))
+	}
+	if _, err := resolvePGHosts(context.Background(), []string{"pg-a", "missing"}); err == nil {
+		t.Fatal("a failed lookup must be reported so the old addresses are kept")
+	}
+
+	same := map[netip.Addr]bool{netip.MustParseAddr("10.0.0.1"): true, netip.MustParseAddr("10.0.0.2"): true, netip.MustParseAddr("fd00::3"): true}
+	if !sameAddrs(got, same) {
+		t.Fatal("equal sets reported as changed")
+	}
+	delete(same, netip.MustParseAddr("fd00::3"))
+	same[netip.MustParseAddr("10.0.0.9")] = true
+	if sameAddrs(got, same) {
+		t.Fatal("changed set reported as equal")
+	}
+}
@@ -0,0 +1,152 @@
+//go:build cgo
+
+package mosqplugin
+
+/*
+#include <stdlib.h>
+#include <mosquitto.h>
+#include <mosquitto_broker.h>
+
+int mosqplugin_register(mosquitto_plugin_id_t *id, int slot, int event, const char *event_data);
+int mosqplugin_unregister(mosquitto_plugin_id_t *id, int slot, int event, const char *event_data);
+int mosqplugin_publish(const char *clientid, const char *topic, int payloadlen, const void *payload, bool retain);
+int mosqplugin_kick(const char *name, int by_username);
+int mosqplugin_client_protocol_version(const struct mosquitto *client);
+void mosqplugin_log(int level, const char *msg);
+int mosqplugin_listener_port_supported(void);
+int mosqplugin_client_port(const struct mosquitto *client);
+int mosqplugin_client_certificate_der(const struct mosquitto *client, unsigned char **der);
+void mosqplugin_free_der(unsigned char *der);
+*/
+import "C"
+
+import (
+	"fmt"
+	"unsafe"
+)
+
+// controlTopics 保存已注册的 $CONTROL 主题：broker 按指针比较，注销时必须传回同一个字符串。
+var controlTopics = map[*Handle]*C.char{}
+
+// v4 没有回调注册，broker 直接调用 shim.c 中的 mosquitto_auth_* 入口；on 已经拒绝了 v4 没有的事件。
+func registerEvent(h *Handle, event int, topic string) error {
+	if apiVersion < 5 {
+		return nil
+	}
+	var data *C.char
+	if event == evtControl {
+		data = C.CString(topic)
+	}
+	rc := C.mosqplugin_register((*C.mosquitto_plugin_id_t)(h.pid), C.int(h.slot), C.int(event), data)
+	if rc != C.MOSQ_ERR_SUCCESS {
+		C.free(unsafe.Pointer(data))
+		return Result(rc)
+	}
+	if data != nil {
+		controlTopics[h] = data
+	}
+	return nil
+}
+
+func unregisterEvent(h *Handle, event int) {
+	if apiVersion < 5 {
+		return
+	}
+	var data *C.char
+	if event == evtControl {
+		data = controlTopics[h]
+		delete(controlTopics, h)
+	}
+	C.mosqplugin_unregister((*C.mosquitto_plugin_id_t)(h.pid), C.int(h.slot), C.int(event), data)
+	C.free(unsafe.Pointer(data))
+}
+
+// Log 写入 mosquitto 日志。
+func Log(level int, msg string) {
+	cs := C.CString(msg)
+	defer C.free(unsafe.Pointer(cs))
+	C.mosqplugin_log(C.int(level), cs)
+}
+
+// ListenerPortSupported 报告 broker 是否导出 mosquitto_client_port（Client.Port 是否可用）。
+func ListenerPortSupported() bool {
+	return C.mosqplugin_listener_port_supported() != 0
+}
+
+// Publish 发布一条 QoS 0 消息（broker 复制 payload）；clientID 非空时只发给该客户端。
+// broker 没有导出 mosquitto_broker_publish_copy（只支持 v4）时返回 NotSupported。
+func Publish(clientID, topic string, payload []byte, retain bool) error {
+	var cid *C.char
+	if clientID != "" {
+		cid = C.CString(clientID)
+		defer C.free(unsafe.Pointer(cid))
+	}
+	ctopic := C.CString(topic)
+	defer C.free(unsafe.Pointer(ctopic))
+	var p unsafe.Pointer
+	if len(payload) > 0 {
+		p = unsafe.Pointer(&payload[0])
+	}
+	if rc := C.mosqplugin_publish(cid, ctopic, C.int(len(payload)), p, C.bool(retain)); rc != C.MOSQ_ERR_SUCCESS {
+		return Result(rc)
+	}
+	return nil
+}
+
+// KickClientID 断开客户端 ID 为 clientID 的连接（不发送遗嘱）；broker 不支持时返回 NotSupported。
+func KickClientID(clientID string) error {
+	cid := C.CString(clientID)
+	defer C.free(unsafe.Pointer(cid))
+	return kickResult(C.mosqplugin_kick(cid, 0))
+}
+
+// KickUsername 断开用户名为 username 的所有连接（不发送遗嘱）。
+func KickUsername(username string) error {
+	u := C.CString(username)
+	defer C.free(unsafe.Pointer(u))
+	return kickResult(C.mosqplugin_kick(u, 1))
+}
+
+func kickResult(rc C.int) error {
+	switch rc {
+	case C.MOSQ_ERR_SUCCESS:
+		return nil
+	case C.MOSQ_ERR_NOT_FOUND:
+		return ErrNotConnected
+	}
+	return Result(rc)
+}
+
+func (c Client) mosq() *C.struct_mosquitto { return (*C.struct_mosquitto)(c.p) }
+
+func (c Client) ID() string { return cstr(C.mosquitto_client_id(c.mosq())) }
+
+func (c Client) Username() string { return cstr(C.mosquitto_client_username(c.mosq())) }
+
+func (c Client) Address() string { return cstr(C.mosquitto_client_address(c.mosq())) }
+
+func (c Client) ProtocolVersion() int { return int(C.mosqplugin_client_protocol_version(c.mosq())) }
+
+// Port 返回连接所在监听器的端口；broker 不支持（见 ListenerPortSupported）时为 -1。
+func (c Client) Port() int { return int(C.mosqplugin_client_port(c.mosq())) }
+
+// Certificate 返回连接的客户端证书（DER）；没有证书时返回 nil。
+func (c Client) Certificate() []byte {
+	var der *C.uchar
+	n := C.mosqplugin_client_certificate_der(c.mosq(), &der)
+	if n <= 0 || der == nil {
+		return nil
+	}
+	defer C.mosqplugin_free_der(der)
+	return C.GoBytes(unsafe.Pointer(der), n)
+}
+
+// SetUsername 替换连接的用户名，用于扩展认证得出用户名之后。
+func (c Client) SetUsername(username string) error {
+	cuser := C.CString(username)
+	defer C.free(unsafe.Pointer(cuser))
+	if rc := C.mosquitto_set_username(c.mosq(), cuser); rc != C.MOSQ_ERR_SUCCESS {
+		return fmt.Errorf("mosquitto_set_username: rc=%d", int(rc))
+	}
+	return nil
+}
@@ -0,0 +1,181 @@
+//go:build cgo
+
+package mosqplugin
+
+/*
+#include <mosquitto.h>
+#include <mosquitto_plugin.h>
+#include <mosquitto_broker.h>
+
+void *mosqplugin_slot_userdata(int slot);
+*/
+import "C"
+
+import "unsafe"
+
+// 纯 Go 文件中的常量必须与头文件一致：不一致时这些数组下标越界，编译失败。
+var (
+	_ = [1]struct{}{}[int(Success)-C.MOSQ_ERR_SUCCESS]
+	_ = [1]struct{}{}[int(Inval)-C.MOSQ_ERR_INVAL]
+	_ = [1]struct{}{}[int(NotFound)-C.MOSQ_ERR_NOT_FOUND]
+	_ = [1]struct{}{}[int(NotSupported)-C.MOSQ_ERR_NOT_SUPPORTED]
+	_ = [1]struct{}{}[int(AuthDenied)-C.MOSQ_ERR_AUTH]
+	_ = [1]struct{}{}[int(ACLDenied)-C.MOSQ_ERR_ACL_DENIED]
+	_ = [1]struct{}{}[int(Unknown)-C.MOSQ_ERR_UNKNOWN]
+	_ = [1]struct{}{}[int(Defer)-C.MOSQ_ERR_PLUGIN_DEFER]
+
+	_ = [1]struct{}{}[evtReload-C.MOSQ_EVT_RELOAD]
+	_ = [1]struct{}{}[evtACLCheck-C.MOSQ_EVT_ACL_CHECK]
+	_ = [1]struct{}{}[evtBasicAuth-C.MOSQ_EVT_BASIC_AUTH]
+	_ = [1]struct{}{}[evtExtAuthStart-C.MOSQ_EVT_EXT_AUTH_START]
+	_ = [1]struct{}{}[evtControl-C.MOSQ_EVT_CONTROL]
+	_ = [1]struct{}{}[evtTick-C.MOSQ_EVT_TICK]
+	_ = [1]struct{}{}[evtDisconnect-C.MOSQ_EVT_DISCONNECT]
+
+	_ = [1]struct{}{}[LogInfo-C.MOSQ_LOG_INFO]
+	_ = [1]struct{}{}[LogNotice-C.MOSQ_LOG_NOTICE]
+	_ = [1]struct{}{}[LogWarning-C.MOSQ_LOG_WARNING]
+	_ = [1]struct{}{}[LogErr-C.MOSQ_LOG_ERR]
+	_ = [1]struct{}{}[LogDebug-C.MOSQ_LOG_DEBUG]
+)
+
+// --- Version negotiation ---
+//
+// mosqplugin_version 优先选择 v5，broker 不提供时退回 v4（见 negotiate）。
+//
+//export mosqplugin_version
+func mosqplugin_version(count C.int, versions *C.int) C.int {
+	var offered []int
+	for _, v := range unsafe.Slice(versions, int(count)) {
+		offered = append(offered, int(v))
+	}
+	v := negotiate(offered)
+	if v > 0 {
+		apiVersion = v
+	}
+	return C.int(v)
+}
+
+//export mosqplugin_init
+func mosqplugin_init(id *C.mosquitto_plugin_id_t, userdata *unsafe.Pointer,
+	opts *C.struct_mosquitto_opt, optCount C.int) C.int {
+
+	if plugin == nil {
+		logf(LogErr, "no plugin registered (call mosqplugin.Register from init)")
+		return C.MOSQ_ERR_UNKNOWN
+	}
+	h := newHandle(unsafe.Pointer(id))
+	if h == nil {
+		logf(LogErr, "at most %d plugin instances are supported", MaxInstances)
+		return C.MOSQ_ERR_UNKNOWN
+	}
+	rc := guard("plugin_init", Unknown, func() Result {
+		return initResult(plugin.Init(h, options(opts, optCount)))
+	})
+	if rc != Success {
+		h.unregisterAll()
+		releaseHandle(h)
+		return C.int(rc)
+	}
+	*userdata = C.mosqplugin_slot_userdata(C.int(h.slot))
+	return C.MOSQ_ERR_SUCCESS
+}
+
+//export mosqplugin_cleanup
+func mosqplugin_cleanup(userdata unsafe.Pointer, opts *C.struct_mosquitto_opt, optCount C.int) C.int {
+	h := handleFor(int(uintptr(userdata)))
+	if h == nil {
+		return C.MOSQ_ERR_SUCCESS
+	}
+	h.unregisterAll()
+	guard("plugin_cleanup", Success, func() Result {
+		plugin.Cleanup(h, options(opts, optCount))
+		return Success
+	})
+	releaseHandle(h)
+	return C.MOSQ_ERR_SUCCESS
+}
+
+// mosqplugin_dispatch 把槽位 slot 上的事件交给对应 Handle 注册的 Go 函数。
+//
+//export mosqplugin_dispatch
+func mosqplugin_dispatch(event C.int, eventData unsafe.Pointer, slot C.int) C.int {
+	h := handleFor(int(slot))
+	if h == nil {
+		return C.MOSQ_ERR_PLUGIN_DEFER
+	}
+	what := eventNames[int(event)] + " callback"
+	return C.int(guard(what, panicResult(int(event)), func() Result {
+		return dispatch(h, event, eventData)
+	}))
+}
+
+func dispatch(h *Handle, event C.int, eventData unsafe.Pointer) Result {
+	switch event {
+	case C.MOSQ_EVT_BASIC_AUTH:
+		ed := (*C.struct_mosquitto_evt_basic_auth)(eventData)
+		if h.basicAuth != nil {
+			return h.basicAuth(client(ed.client), cstr(ed.username), cstr(ed.password))
+		}
+	case C.MOSQ_EVT_ACL_CHECK:
+		ed := (*C.struct_mosquitto_evt_acl_check)(eventData)
+		if h.aclCheck != nil {
+			return h.aclCheck(client(ed.client), ACLRequest{
+				Topic:      cstr(ed.topic),
+				Access:     int(ed.access),
+				QoS:        int(ed.qos),
+				Retain:     bool(ed.retain),
+				payload:    ed.payload,
+				payloadLen: int(ed.payloadlen),
+			})
+		}
+	case C.MOSQ_EVT_CONTROL:
+		ed := (*C.struct_mosquitto_evt_control)(eventData)
+		if h.control != nil {
+			return h.control(client(ed.client), C.GoBytes(ed.payload, C.int(ed.payloadlen)))
+		}
+	case C.MOSQ_EVT_EXT_AUTH_START:
+		ed := (*C.struct_mosquitto_evt_extended_auth)(eventData)
+		if h.extAuthStart != nil {
+			return h.extAuthStart(client(ed.client), cstr(ed.auth_method), C.GoBytes(ed.data_in, C.int(ed.data_in_len)))
+		}
+	case C.MOSQ_EVT_DISCONNECT:
+		ed := (*C.struct_mosquitto_evt_disconnect)(eventData)
+		if h.disconnect != nil {
+			h.disconnect(client(ed.client), int(ed.reason))
+		}
+		return Success
+	case C.MOSQ_EVT_RELOAD:
+		ed := (*C.struct_mosquitto_evt_reload)(eventData)
+		if h.reload != nil {
+			h.reload(options(ed.options, C.int(ed.option_count)))
+		}
+		return Success
+	case C.MOSQ_EVT_TICK:
+		if h.tick != nil {
+			h.tick()
+		}
+		return Success
+	}
+	return Defer
+}
+
+func options(opts *C.struct_mosquitto_opt, n C.int) []Option {
+	if opts == nil || n <= 0 {
+		return nil
+	}
+	out := make([]Option, 0, int(n))
+	for _, o := range unsafe.Slice(opts, int(n)) {
+		out = append(out, Option{Key: cstr(o.key), Value: cstr(o.value)})
+	}
+	return out
+}
+
+func client(c *C.struct_mosquitto) Client { return Client{unsafe.Pointer(c)} }
+
+func cstr(s *C.char) string {
+	if s == nil {
+		return ""
+	}
+	return C.GoString(s)
+}
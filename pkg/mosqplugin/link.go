@@ -0,0 +1,12 @@
+//go:build cgo && !mosq_static
+
+package mosqplugin
+
+// 默认构建：编译与链接参数来自 pkg-config，.so 动态链接 libmosquitto 与 libcrypto。
+
+/*
+#cgo darwin pkg-config: libmosquitto libcrypto
+#cgo darwin LDFLAGS: -Wl,-undefined,dynamic_lookup
+#cgo linux  pkg-config: libmosquitto libcrypto
+*/
+import "C"
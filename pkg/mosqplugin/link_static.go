@@ -0,0 +1,13 @@
+//go:build cgo && mosq_static
+
+package mosqplugin
+
+// mosq_static 构建（make build-musl）：除 libc 外不链接任何共享库。插件用到的 mosquitto_* 与 OpenSSL 函数
+// 都由加载它的 broker 进程提供（mosquitto 可执行文件与它链接的 libcrypto），加载时才解析，
+// 所以同一个 .so 不依赖镜像里装了哪些 -dev 或 -libs 包，也不会与 broker 加载两份不同版本的 libcrypto。
+// 头文件仍需在编译时找到：默认搜索路径之外的位置用 CGO_CFLAGS 指定。
+
+/*
+#cgo darwin LDFLAGS: -Wl,-undefined,dynamic_lookup
+*/
+import "C"
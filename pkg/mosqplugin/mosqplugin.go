@@ -0,0 +1,356 @@
+// Package mosqplugin 是用 Go 编写 mosquitto v5 插件的垫片：它实现 mosquitto_plugin_version/init/cleanup
+// 三个入口、把插件选项转换成 Go 值、为每次加载的实例注册回调并把事件分发给 Go 函数，同时提供日志、
+// 发布消息与踢下线等 broker 函数。cgo 只出现在本包中，插件本身是普通 Go 代码。
+//
+// 用法：main 包在 init() 中调用 Register，并以 -buildmode=c-shared 构建：
+//
+//	func init() { mosqplugin.Register("my-plugin", myPlugin{}) }
+//
+//	func (myPlugin) Init(h *mosqplugin.Handle, opts []mosqplugin.Option) error {
+//		return h.OnTick(func() { ... })
+//	}
+//
+// 同一个 .so 可以被 mosquitto 加载多次（per_listener_settings，或以不同选项加载两次），每次加载得到
+// 自己的 Handle。mosquitto 不允许同一个函数在一个事件上注册两次，所以 C 侧为每个槽位准备了一个回调
+// 函数，回调通过它找回所属的 Handle；一个进程最多 MaxInstances 个实例。
+//
+// 回调都在 broker 主线程中执行，On* 与 Publish、Kick* 也只能在主线程（Init 或回调中）调用。
+// Init、Cleanup 与回调中的 panic 不会传到 broker：本包记录堆栈，认证与 ACL 回调按拒绝处理，
+// Init 按失败处理，其余事件忽略。需要别的结论（例如 fail-open）的插件应在回调中自己 recover。
+// broker 不支持 v5 时（mosquitto 1.6，或协商时只提供 4 的 2.0.x）退回插件 API v4：C 侧提供 mosquitto_auth_*
+// 入口，把调用转换成同样的事件。v4 只有认证、ACL、扩展认证与重读配置，其余事件的 On* 返回 NotSupported，
+// 插件用 APIVersion 检查后关闭依赖它们的功能；旧 broker 没有导出的 Publish、Kick* 也返回 NotSupported。
+// 不使用 cgo 构建时（CGO_ENABLED=0）本包仍可编译：日志写到标准错误，其余 broker 函数不做任何事，
+// 供插件在没有 mosquitto 头文件的机器上运行测试。
+package mosqplugin
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+	"unsafe"
+)
+
+// MaxInstances 是一个进程中同时加载的插件实例上限。
+const MaxInstances = 8
+
+// 日志级别，与 MOSQ_LOG_* 一致。
+const (
+	LogInfo    = 1 << 0
+	LogNotice  = 1 << 1
+	LogWarning = 1 << 2
+	LogErr     = 1 << 3
+	LogDebug   = 1 << 4
+)
+
+// Result 是回调的返回值，与 MOSQ_ERR_* 一致；它同时实现 error，注册失败时 On* 返回它。
+type Result int
+
+const (
+	Success      Result = 0
+	Inval        Result = 3
+	NotFound     Result = 6
+	NotSupported Result = 10 // broker 协商出的插件 API 或 broker 版本不提供该事件或函数
+	AuthDenied   Result = 11
+	ACLDenied    Result = 12
+	Unknown      Result = 13
+	// Defer 表示本插件不做判断，交给下一个插件或 broker 的默认行为。
+	Defer Result = 17
+)
+
+var resultNames = map[Result]string{
+	Success:      "success",
+	Inval:        "invalid arguments",
+	NotFound:     "not found",
+	NotSupported: "not supported",
+	AuthDenied:   "authentication denied",
+	ACLDenied:    "access denied",
+	Unknown:      "unknown error",
+	Defer:        "deferred",
+}
+
+func (r Result) Error() string {
+	if name, ok := resultNames[r]; ok {
+		return name
+	}
+	return fmt.Sprintf("mosquitto error %d", int(r))
+}
+
+// ErrNotConnected 表示 Kick* 没有找到对应的连接。
+var ErrNotConnected = errors.New("client not connected")
+
+// Option 是一条 plugin_opt_*（Key 不含 plugin_opt_ 前缀），按配置文件中的顺序给出。
+type Option struct {
+	Key, Value string
+}
+
+// Plugin 由插件实现。Init 返回错误时本次加载失败：错误是 Result 时原样返回给 broker，否则为 Unknown；
+// 错误由插件自己记录。Cleanup 之前本包已注销该实例的所有回调。
+type Plugin interface {
+	Init(h *Handle, opts []Option) error
+	Cleanup(h *Handle, opts []Option)
+}
+
+// Register 设置进程中的插件；name 用作本包日志的前缀。应在 main 包的 init() 中调用。
+func Register(name string, p Plugin) {
+	pluginName, plugin = name, p
+}
+
+var (
+	pluginName = "mosqplugin"
+	plugin     Plugin
+)
+
+// Client 是回调中的 broker 连接，只在回调期间有效。
+type Client struct {
+	p unsafe.Pointer // struct mosquitto *
+}
+
+// Key 在连接存续期间唯一标识它，可用作按连接记录状态的 map 键（断开后可能被复用）。
+func (c Client) Key() uintptr { return uintptr(c.p) }
+
+// ACLRequest 是一次 ACL 检查。Access 与 MOSQ_ACL_* 一致：1 读、2 写、4 订阅、8 取消订阅。
+type ACLRequest struct {
+	Topic  string
+	Access int
+	QoS    int
+	Retain bool
+
+	payload    unsafe.Pointer
+	payloadLen int
+}
+
+// Payload 复制发布的消息内容，最多 max 个字节（max < 0 时不限）；只有写检查带消息内容。
+func (r ACLRequest) Payload(max int) []byte {
+	n := r.payloadLen
+	if max >= 0 && n > max {
+		n = max
+	}
+	if r.payload == nil || n <= 0 {
+		return nil
+	}
+	return bytes.Clone(unsafe.Slice((*byte)(r.payload), n))
+}
+
+// 回调函数。
+type (
+	// BasicAuthFunc 校验 CONNECT 中的用户名与密码，返回 Success、AuthDenied 或 Defer。
+	BasicAuthFunc func(c Client, username, password string) Result
+	// ACLCheckFunc 判断一次发布、订阅或投递，返回 Success、ACLDenied 或 Defer。
+	ACLCheckFunc func(c Client, req ACLRequest) Result
+	// ControlFunc 处理发布到 $CONTROL 主题的消息。
+	ControlFunc func(c Client, payload []byte) Result
+	// ExtAuthStartFunc 处理 MQTT 5 扩展认证的第一步；不认识 method 时返回 Defer。
+	ExtAuthStartFunc func(c Client, method string, data []byte) Result
+	// DisconnectFunc 在连接断开时调用，reason 是 broker 给出的原因码。
+	DisconnectFunc func(c Client, reason int)
+)
+
+// 事件编号，与 MOSQ_EVT_* 一致。
+const (
+	evtReload       = 1
+	evtACLCheck     = 2
+	evtBasicAuth    = 3
+	evtExtAuthStart = 4
+	evtControl      = 6
+	evtTick         = 9
+	evtDisconnect   = 10
+)
+
+// v4Events 是插件 API v4 中也有的事件（见 shim.c 的 mosquitto_auth_* 入口）。
+var v4Events = map[int]bool{evtReload: true, evtACLCheck: true, evtBasicAuth: true, evtExtAuthStart: true}
+
+// apiVersion 是与 broker 协商出的插件 API 版本，在 plugin_init 之前确定；没有 broker 时按 5。
+var apiVersion = 5
+
+// APIVersion 返回与 broker 协商出的插件 API 版本：5，或旧 broker 上的 4。
+func APIVersion() int { return apiVersion }
+
+var eventNames = map[int]string{
+	evtReload:       "RELOAD",
+	evtACLCheck:     "ACL_CHECK",
+	evtBasicAuth:    "BASIC_AUTH",
+	evtExtAuthStart: "EXT_AUTH_START",
+	evtControl:      "CONTROL",
+	evtTick:         "TICK",
+	evtDisconnect:   "DISCONNECT",
+}
+
+// Handle 是一次插件加载（一个 mosquitto_plugin_id_t），Init 与 Cleanup 收到的是同一个 Handle。
+type Handle struct {
+	slot int
+	pid  unsafe.Pointer // mosquitto_plugin_id_t *
+
+	basicAuth    BasicAuthFunc
+	aclCheck     ACLCheckFunc
+	control      ControlFunc
+	extAuthStart ExtAuthStartFunc
+	disconnect   DisconnectFunc
+	reload       func(opts []Option)
+	tick         func()
+
+	registered []int
+}
+
+// Slot 是实例的槽位：第一次加载为 0，之后的加载依次使用空闲的槽位。
+func (h *Handle) Slot() int { return h.slot }
+
+// OnBasicAuth 注册 MOSQ_EVT_BASIC_AUTH。
+func (h *Handle) OnBasicAuth(fn BasicAuthFunc) error {
+	return h.on(evtBasicAuth, "", func() { h.basicAuth = fn })
+}
+
+// OnACLCheck 注册 MOSQ_EVT_ACL_CHECK。
+func (h *Handle) OnACLCheck(fn ACLCheckFunc) error {
+	return h.on(evtACLCheck, "", func() { h.aclCheck = fn })
+}
+
+// OnControl 接管一个 $CONTROL/... 主题；每个实例只能接管一个主题。
+func (h *Handle) OnControl(topic string, fn ControlFunc) error {
+	return h.on(evtControl, topic, func() { h.control = fn })
+}
+
+// OnExtAuthStart 注册 MOSQ_EVT_EXT_AUTH_START。
+func (h *Handle) OnExtAuthStart(fn ExtAuthStartFunc) error {
+	return h.on(evtExtAuthStart, "", func() { h.extAuthStart = fn })
+}
+
+// OnDisconnect 注册 MOSQ_EVT_DISCONNECT。
+func (h *Handle) OnDisconnect(fn DisconnectFunc) error {
+	return h.on(evtDisconnect, "", func() { h.disconnect = fn })
+}
+
+// OnReload 注册 MOSQ_EVT_RELOAD（broker 收到 SIGHUP 重读配置后），opts 是新的插件选项。
+func (h *Handle) OnReload(fn func(opts []Option)) error {
+	return h.on(evtReload, "", func() { h.reload = fn })
+}
+
+// OnTick 注册 MOSQ_EVT_TICK，broker 主循环大约每秒调用一次。
+func (h *Handle) OnTick(fn func()) error {
+	return h.on(evtTick, "", func() { h.tick = fn })
+}
+
+// on 向 broker 注册事件并记下回调；同一事件重复注册返回 Inval，v4 没有的事件返回 NotSupported。
+func (h *Handle) on(event int, topic string, set func()) error {
+	if apiVersion < 5 && !v4Events[event] {
+		return NotSupported
+	}
+	for _, e := range h.registered {
+		if e == event {
+			return Inval
+		}
+	}
+	if err := registerEvent(h, event, topic); err != nil {
+		return err
+	}
+	set()
+	h.registered = append(h.registered, event)
+	return nil
+}
+
+// unregisterAll 注销实例注册过的所有事件，Cleanup 之前与 Init 失败时调用。
+func (h *Handle) unregisterAll() {
+	for i := len(h.registered) - 1; i >= 0; i-- {
+		unregisterEvent(h, h.registered[i])
+	}
+	h.registered = nil
+}
+
+var (
+	handlesMu sync.Mutex
+	handles   [MaxInstances]*Handle
+)
+
+// newHandle 为又一次 plugin_init 分配最小的空闲槽位；槽位用完时返回 nil。
+func newHandle(pid unsafe.Pointer) *Handle {
+	handlesMu.Lock()
+	defer handlesMu.Unlock()
+	for slot, h := range handles {
+		if h == nil {
+			h = &Handle{slot: slot, pid: pid}
+			handles[slot] = h
+			return h
+		}
+	}
+	return nil
+}
+
+func handleFor(slot int) *Handle {
+	handlesMu.Lock()
+	defer handlesMu.Unlock()
+	if slot < 0 || slot >= MaxInstances {
+		return nil
+	}
+	return handles[slot]
+}
+
+func releaseHandle(h *Handle) {
+	handlesMu.Lock()
+	defer handlesMu.Unlock()
+	if handles[h.slot] == h {
+		handles[h.slot] = nil
+	}
+}
+
+// negotiate 从 broker 提供的插件 API 版本中选择 5，其次 4；都没有时返回 -1，broker 拒绝加载。
+func negotiate(offered []int) int {
+	best := -1
+	for _, v := range offered {
+		if v == 5 {
+			return 5
+		}
+		if v == 4 {
+			best = 4
+		}
+	}
+	return best
+}
+
+// initResult 把 Init 的错误转换为返回给 broker 的值。
+func initResult(err error) Result {
+	var r Result
+	if errors.As(err, &r) && r != Success {
+		return r
+	}
+	if err != nil {
+		return Unknown
+	}
+	return Success
+}
+
+var panics atomic.Int64
+
+// Panics 返回本包从 Init、Cleanup 与回调中恢复的 panic 次数。
+func Panics() int64 { return panics.Load() }
+
+// panicResult 是回调 panic 时返回给 broker 的值：认证与 ACL 一律拒绝，其余事件按已处理。
+func panicResult(event int) Result {
+	switch event {
+	case evtBasicAuth, evtExtAuthStart:
+		return AuthDenied
+	case evtACLCheck:
+		return ACLDenied
+	case evtControl:
+		return Unknown
+	}
+	return Success
+}
+
+// guard 调用 fn；fn panic 时记录堆栈并返回 onPanic，panic 不会沿 cgo 回调展开到 broker 把进程带崩。
+func guard(what string, onPanic Result, fn func() Result) (rc Result) {
+	defer func() {
+		if r := recover(); r != nil {
+			panics.Add(1)
+			logf(LogErr, "panic in %s: %v\n%s", what, r, debug.Stack())
+			rc = onPanic
+		}
+	}()
+	return fn()
+}
+
+func logf(level int, format string, args ...any) {
+	Log(level, pluginName+": "+fmt.Sprintf(format, args...))
+}
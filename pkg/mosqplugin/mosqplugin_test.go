@@ -0,0 +1,156 @@
+package mosqplugin
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"unsafe"
+)
+
+func TestHandles(t *testing.T) {
+	var got []*Handle
+	t.Cleanup(func() {
+		for _, h := range got {
+			releaseHandle(h)
+		}
+	})
+	for i := 0; i < MaxInstances; i++ {
+		h := newHandle(nil)
+		if h == nil || h.Slot() != i || handleFor(i) != h {
+			t.Fatalf("newHandle #%d = %+v", i, h)
+		}
+		got = append(got, h)
+	}
+	if newHandle(nil) != nil {
+		t.Fatal("more than MaxInstances handles")
+	}
+	releaseHandle(got[2])
+	if h := newHandle(nil); h == nil || h.Slot() != 2 {
+		t.Fatalf("a released slot should be reused first, got %+v", h)
+	} else {
+		got[2] = h
+	}
+	if handleFor(-1) != nil || handleFor(MaxInstances) != nil {
+		t.Fatal("out-of-range slots must not resolve")
+	}
+}
+
+func TestRegisterOnce(t *testing.T) {
+	h := &Handle{}
+	calls := 0
+	if err := h.OnTick(func() { calls++ }); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.OnTick(func() {}); !errors.Is(err, Inval) {
+		t.Fatalf("second OnTick = %v, want Inval", err)
+	}
+	if err := h.OnControl("$CONTROL/test/v1", func(Client, []byte) Result { return Success }); err != nil {
+		t.Fatal(err)
+	}
+	h.tick()
+	if calls != 1 || len(h.registered) != 2 {
+		t.Fatalf("tick calls %d, registered %v", calls, h.registered)
+	}
+	h.unregisterAll()
+	if len(h.registered) != 0 {
+		t.Fatal("unregisterAll left events registered")
+	}
+}
+
+func TestInitResult(t *testing.T) {
+	for _, tc := range []struct {
+		err  error
+		want Result
+	}{
+		{nil, Success},
+		{errors.New("boom"), Unknown},
+		{AuthDenied, AuthDenied},
+		{fmt.Errorf("register: %w", Result(19)), Result(19)},
+	} {
+		if got := initResult(tc.err); got != tc.want {
+			t.Errorf("initResult(%v) = %d, want %d", tc.err, got, tc.want)
+		}
+	}
+	if Defer.Error() != "deferred" || Result(99).Error() != "mosquitto error 99" {
+		t.Fatal("Result.Error")
+	}
+}
+
+func TestACLPayload(t *testing.T) {
+	msg := []byte("hello")
+	req := ACLRequest{payload: unsafe.Pointer(&msg[0]), payloadLen: len(msg)}
+	if got := req.Payload(-1); string(got) != "hello" {
+		t.Fatalf("Payload(-1) = %q", got)
+	}
+	got := req.Payload(3)
+	if string(got) != "hel" {
+		t.Fatalf("Payload(3) = %q", got)
+	}
+	got[0] = 'X'
+	if msg[0] != 'h' {
+		t.Fatal("Payload must copy the broker's buffer")
+	}
+	if (ACLRequest{}).Payload(10) != nil {
+		t.Fatal("no payload should give nil")
+	}
+}
+
+func TestGuard(t *testing.T) {
+	before := Panics()
+	if rc := guard("ACL_CHECK callback", panicResult(evtACLCheck), func() Result { panic("boom") }); rc != ACLDenied {
+		t.Fatalf("panicking ACL check = %d, want ACLDenied", rc)
+	}
+	if rc := guard("BASIC_AUTH callback", panicResult(evtBasicAuth), func() Result { return Defer }); rc != Defer {
+		t.Fatalf("guard must return fn's result, got %d", rc)
+	}
+	if Panics() != before+1 {
+		t.Fatalf("Panics() = %d, want %d", Panics(), before+1)
+	}
+	for event, want := range map[int]Result{evtBasicAuth: AuthDenied, evtExtAuthStart: AuthDenied, evtTick: Success, evtDisconnect: Success} {
+		if got := panicResult(event); got != want {
+			t.Errorf("panicResult(%s) = %d, want %d", eventNames[event], got, want)
+		}
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	for _, tc := range []struct {
+		offered []int
+		want    int
+	}{
+		{[]int{5, 4, 3, 2}, 5},
+		{[]int{4, 5}, 5},
+		{[]int{4, 3, 2}, 4},
+		{[]int{3, 2}, -1},
+		{nil, -1},
+	} {
+		if got := negotiate(tc.offered); got != tc.want {
+			t.Errorf("negotiate(%v) = %d, want %d", tc.offered, got, tc.want)
+		}
+	}
+}
+
+func TestV4Events(t *testing.T) {
+	old := apiVersion
+	t.Cleanup(func() { apiVersion = old })
+	apiVersion = 4
+	h := &Handle{}
+	if err := h.OnBasicAuth(func(Client, string, string) Result { return Success }); err != nil {
+		t.Fatalf("OnBasicAuth on v4 = %v", err)
+	}
+	if err := h.OnReload(func([]Option) {}); err != nil {
+		t.Fatalf("OnReload on v4 = %v", err)
+	}
+	if err := h.OnTick(func() {}); !errors.Is(err, NotSupported) {
+		t.Fatalf("OnTick on v4 = %v, want NotSupported", err)
+	}
+	if err := h.OnControl("$CONTROL/test/v1", nil); !errors.Is(err, NotSupported) {
+		t.Fatalf("OnControl on v4 = %v, want NotSupported", err)
+	}
+	if len(h.registered) != 2 || h.tick != nil {
+		t.Fatalf("registered %v", h.registered)
+	}
+	if APIVersion() != 4 {
+		t.Fatal("APIVersion")
+	}
+}
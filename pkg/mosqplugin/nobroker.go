@@ -0,0 +1,47 @@
+//go:build !cgo
+
+package mosqplugin
+
+import (
+	"fmt"
+	"os"
+)
+
+// 纯 Go 构建没有 broker：注册只记录回调，日志写到标准错误，其余 broker 函数不做任何事。
+
+func registerEvent(*Handle, int, string) error { return nil }
+
+func unregisterEvent(*Handle, int) {}
+
+var levelNames = map[int]string{LogErr: "error", LogWarning: "warn", LogNotice: "notice", LogDebug: "debug"}
+
+// Log 写到标准错误。
+func Log(level int, msg string) {
+	name, ok := levelNames[level]
+	if !ok {
+		name = "info"
+	}
+	fmt.Fprintf(os.Stderr, "%s %s\n", name, msg)
+}
+
+func ListenerPortSupported() bool { return false }
+
+func Publish(clientID, topic string, payload []byte, retain bool) error { return nil }
+
+func KickClientID(string) error { return ErrNotConnected }
+
+func KickUsername(string) error { return ErrNotConnected }
+
+func (Client) ID() string { return "" }
+
+func (Client) Username() string { return "" }
+
+func (Client) Address() string { return "" }
+
+func (Client) ProtocolVersion() int { return 0 }
+
+func (Client) Port() int { return -1 }
+
+func (Client) Certificate() []byte { return nil }
+
+func (Client) SetUsername(string) error { return Unknown }
@@ -0,0 +1,240 @@
+//go:build cgo
+
+#include <stdint.h>
+#include <mosquitto.h>
+#include <mosquitto_plugin.h>
+#include <mosquitto_broker.h>
+#include <openssl/crypto.h>
+#include <openssl/x509.h>
+
+/*
+ * Mosquitto <-> Go 桥接层
+ * -------------------------------------------------
+ * 该文件提供 Mosquitto 插件的 C 侧入口，并把所有调用转发给 Go 侧实现（export.go）。
+ * 其核心职责包括：
+ *   1. 维护 Mosquitto 期望的函数签名，避免 Go 导出符号与官方实现冲突。
+ *   2. 为每个实例槽位提供独立的回调函数，事件统一交给 mosqplugin_dispatch。
+ *   3. 为 Go 提供少量包装函数（如日志输出、证书转换），屏蔽 C API 的变参与 OpenSSL 对象。
+ *   4. 提供插件 API v4 的入口（mosquitto_auth_*），把调用转换成 v5 的事件结构后同样交给 mosqplugin_dispatch。
+ */
+
+#define MOSQPLUGIN_MAX_INSTANCES 8
+
+/* Go 导出的别名函数（避免与官方符号重名） */
+int mosqplugin_version(int supported_version_count, int *supported_versions);
+int mosqplugin_init(mosquitto_plugin_id_t *identifier, void **userdata,
+                    struct mosquitto_opt *options, int option_count);
+int mosqplugin_cleanup(void *userdata, struct mosquitto_opt *options, int option_count);
+int mosqplugin_dispatch(int event, void *event_data, int slot);
+
+/* —— 官方要求的 3 个入口：C 层精确匹配原型，再转调 Go —— */
+int mosquitto_plugin_version(int supported_version_count, const int *supported_versions) {
+    /* 版本协商必须保持 const 签名，因此在此处做一次安全的类型转换 */
+    return mosqplugin_version(supported_version_count, (int*)supported_versions);
+}
+
+int mosquitto_plugin_init(mosquitto_plugin_id_t *identifier, void **userdata,
+                          struct mosquitto_opt *options, int option_count) {
+    return mosqplugin_init(identifier, userdata, options, option_count);
+}
+
+/* cleanup 的第一个参数是 void *（单指针），不是 void ** */
+int mosquitto_plugin_cleanup(void *userdata, struct mosquitto_opt *options, int option_count) {
+    return mosqplugin_cleanup(userdata, options, option_count);
+}
+
+/* —— 插件 API v4 入口 ——
+ * 只提供 v4 的 broker（mosquitto 1.6，或协商时不提供 5 的 2.0.x）加载时使用：mosquitto_plugin_version 协商出 4，
+ * 或 broker 只认 mosquitto_auth_plugin_version。v4 没有回调注册，broker 直接调用下面的函数；
+ * 每次调用构造对应的 v5 事件结构，所以 Go 侧的分发与 v5 完全相同。v4 没有的事件（CONTROL、TICK、DISCONNECT）
+ * 在 Go 侧注册时返回 MOSQ_ERR_NOT_SUPPORTED。 */
+int mosquitto_auth_plugin_version(void) {
+    const int v4 = MOSQ_AUTH_PLUGIN_VERSION;
+    return mosqplugin_version(1, (int*)&v4);
+}
+
+int mosquitto_auth_plugin_init(void **userdata, struct mosquitto_opt *options, int option_count) {
+    return mosqplugin_init(NULL, userdata, options, option_count);
+}
+
+int mosquitto_auth_plugin_cleanup(void *userdata, struct mosquitto_opt *options, int option_count) {
+    return mosqplugin_cleanup(userdata, options, option_count);
+}
+
+static int slot_of(void *userdata) {
+    return (int)(intptr_t)userdata;
+}
+
+/* 启动时与每次重读配置后调用；只有重读对应 MOSQ_EVT_RELOAD */
+int mosquitto_auth_security_init(void *userdata, struct mosquitto_opt *options, int option_count, bool reload) {
+    if (!reload) {
+        return MOSQ_ERR_SUCCESS;
+    }
+    struct mosquitto_evt_reload ed = {.options = options, .option_count = option_count};
+    return mosqplugin_dispatch(MOSQ_EVT_RELOAD, &ed, slot_of(userdata));
+}
+
+int mosquitto_auth_security_cleanup(void *userdata, struct mosquitto_opt *options, int option_count, bool reload) {
+    (void)userdata; (void)options; (void)option_count; (void)reload;
+    return MOSQ_ERR_SUCCESS;
+}
+
+int mosquitto_auth_acl_check(void *userdata, int access, struct mosquitto *client, const struct mosquitto_acl_msg *msg) {
+    struct mosquitto_evt_acl_check ed = {
+        .client = client,
+        .topic = msg->topic,
+        .payload = msg->payload,
+        .access = access,
+        .payloadlen = (uint32_t)msg->payloadlen,
+        .qos = (uint8_t)msg->qos,
+        .retain = msg->retain,
+    };
+    return mosqplugin_dispatch(MOSQ_EVT_ACL_CHECK, &ed, slot_of(userdata));
+}
+
+int mosquitto_auth_unpwd_check(void *userdata, struct mosquitto *client, const char *username, const char *password) {
+    struct mosquitto_evt_basic_auth ed = {.client = client, .username = (char*)username, .password = (char*)password};
+    return mosqplugin_dispatch(MOSQ_EVT_BASIC_AUTH, &ed, slot_of(userdata));
+}
+
+int mosquitto_auth_psk_key_get(void *userdata, struct mosquitto *client, const char *hint,
+                               const char *identity, char *key, int max_key_len) {
+    (void)userdata; (void)client; (void)hint; (void)identity; (void)key; (void)max_key_len;
+    return MOSQ_ERR_PLUGIN_DEFER;
+}
+
+/* v4 用 MOSQ_ERR_NOT_SUPPORTED 表示不处理该认证方法 */
+int mosquitto_auth_start(void *userdata, struct mosquitto *client, const char *method, bool reauth,
+                         const void *data_in, uint16_t data_in_len, void **data_out, uint16_t *data_out_len) {
+    (void)reauth;
+    *data_out = NULL;
+    *data_out_len = 0;
+    struct mosquitto_evt_extended_auth ed = {
+        .client = client, .data_in = data_in, .data_in_len = data_in_len, .auth_method = method,
+    };
+    int rc = mosqplugin_dispatch(MOSQ_EVT_EXT_AUTH_START, &ed, slot_of(userdata));
+    return rc == MOSQ_ERR_PLUGIN_DEFER ? MOSQ_ERR_NOT_SUPPORTED : rc;
+}
+
+/* 扩展认证只有一步（与 v5 一样不注册 EXT_AUTH_CONTINUE） */
+int mosquitto_auth_continue(void *userdata, struct mosquitto *client, const char *method,
+                            const void *data_in, uint16_t data_in_len, void **data_out, uint16_t *data_out_len) {
+    (void)userdata; (void)client; (void)method; (void)data_in; (void)data_in_len;
+    *data_out = NULL;
+    *data_out_len = 0;
+    return MOSQ_ERR_NOT_SUPPORTED;
+}
+
+/* 同一个 .so 加载多次时函数地址相同，而 mosquitto 不允许在同一事件上重复注册同一个函数：
+ * 每个槽位一个回调函数，所有事件都经它转给 Go，槽位随调用传入 */
+typedef int (*mosq_event_cb)(int event, void *event_data, void *userdata);
+
+#define SLOT_CB(n) \
+    static int slot_cb_##n(int event, void *event_data, void *userdata) { \
+        (void)userdata; return mosqplugin_dispatch(event, event_data, n); }
+SLOT_CB(0) SLOT_CB(1) SLOT_CB(2) SLOT_CB(3)
+SLOT_CB(4) SLOT_CB(5) SLOT_CB(6) SLOT_CB(7)
+
+static const mosq_event_cb slot_cbs[MOSQPLUGIN_MAX_INSTANCES] = {
+    slot_cb_0, slot_cb_1, slot_cb_2, slot_cb_3,
+    slot_cb_4, slot_cb_5, slot_cb_6, slot_cb_7,
+};
+
+/* 只有 v5 的 broker 才导出的函数一律弱引用：只支持 v4 的 broker 加载时（RTLD_NOW）不因缺少它们而失败，
+ * 缺少时解析为 NULL，包装函数返回 MOSQ_ERR_NOT_SUPPORTED */
+extern int mosquitto_callback_register(mosquitto_plugin_id_t *identifier, int event,
+    MOSQ_FUNC_generic_callback cb_func, const void *event_data, void *userdata) __attribute__((weak));
+extern int mosquitto_callback_unregister(mosquitto_plugin_id_t *identifier, int event,
+    MOSQ_FUNC_generic_callback cb_func, const void *event_data) __attribute__((weak));
+extern int mosquitto_broker_publish_copy(const char *clientid, const char *topic, int payloadlen,
+    const void *payload, int qos, bool retain, mosquitto_property *properties) __attribute__((weak));
+extern int mosquitto_kick_client_by_clientid(const char *clientid, bool with_will) __attribute__((weak));
+extern int mosquitto_kick_client_by_username(const char *username, bool with_will) __attribute__((weak));
+extern int mosquitto_client_protocol_version(const struct mosquitto *client) __attribute__((weak));
+
+/* event_data 只用于 MOSQ_EVT_CONTROL：要接管的主题，例如 $CONTROL/mosq-pg/v1 */
+int mosqplugin_register(mosquitto_plugin_id_t *id, int slot, int event, const char *event_data) {
+    if (slot < 0 || slot >= MOSQPLUGIN_MAX_INSTANCES) {
+        return MOSQ_ERR_INVAL;
+    }
+    if (mosquitto_callback_register == NULL) {
+        return MOSQ_ERR_NOT_SUPPORTED;
+    }
+    return mosquitto_callback_register(id, event, slot_cbs[slot], event_data, NULL);
+}
+
+int mosqplugin_unregister(mosquitto_plugin_id_t *id, int slot, int event, const char *event_data) {
+    if (slot < 0 || slot >= MOSQPLUGIN_MAX_INSTANCES) {
+        return MOSQ_ERR_INVAL;
+    }
+    if (mosquitto_callback_unregister == NULL) {
+        return MOSQ_ERR_NOT_SUPPORTED;
+    }
+    return mosquitto_callback_unregister(id, event, slot_cbs[slot], event_data);
+}
+
+int mosqplugin_publish(const char *clientid, const char *topic, int payloadlen, const void *payload, bool retain) {
+    if (mosquitto_broker_publish_copy == NULL) {
+        return MOSQ_ERR_NOT_SUPPORTED;
+    }
+    return mosquitto_broker_publish_copy(clientid, topic, payloadlen, payload, 0, retain, NULL);
+}
+
+/* by_username 非 0 时 name 是用户名，否则是客户端 ID */
+int mosqplugin_kick(const char *name, int by_username) {
+    if (by_username) {
+        return mosquitto_kick_client_by_username == NULL ? MOSQ_ERR_NOT_SUPPORTED
+                                                         : mosquitto_kick_client_by_username(name, false);
+    }
+    return mosquitto_kick_client_by_clientid == NULL ? MOSQ_ERR_NOT_SUPPORTED
+                                                     : mosquitto_kick_client_by_clientid(name, false);
+}
+
+/* 不知道时返回 0 */
+int mosqplugin_client_protocol_version(const struct mosquitto *client) {
+    if (mosquitto_client_protocol_version == NULL) {
+        return 0;
+    }
+    return mosquitto_client_protocol_version(client);
+}
+
+/* plugin_init 写入 *userdata 的值，cleanup 时 broker 原样传回 */
+void *mosqplugin_slot_userdata(int slot) {
+    return (void *)(intptr_t)slot;
+}
+
+/* 避免 Go 直接调可变参 */
+void mosqplugin_log(int level, const char *msg) {
+    mosquitto_log_printf(level, "%s", msg);
+}
+
+/* mosquitto_client_port 只在较新的 broker 中导出：弱引用，旧版本上解析为 NULL */
+extern int mosquitto_client_port(const struct mosquitto *client) __attribute__((weak));
+
+int mosqplugin_listener_port_supported(void) {
+    return mosquitto_client_port != NULL;
+}
+
+int mosqplugin_client_port(const struct mosquitto *client) {
+    /* 无法获知时返回 -1 */
+    if (mosquitto_client_port == NULL || client == NULL) {
+        return -1;
+    }
+    return mosquitto_client_port(client);
+}
+
+/* mosquitto_client_certificate 返回增加过引用计数的 X509：转成 DER 后立即释放，Go 侧不接触 OpenSSL 对象。
+ * 没有证书时返回 0；*der 由 mosqplugin_free_der 释放 */
+int mosqplugin_client_certificate_der(const struct mosquitto *client, unsigned char **der) {
+    X509 *cert = mosquitto_client_certificate(client);
+    if (cert == NULL) {
+        return 0;
+    }
+    int n = i2d_X509(cert, der);
+    X509_free(cert);
+    return n;
+}
+
+void mosqplugin_free_der(unsigned char *der) {
+    OPENSSL_free(der);
+}
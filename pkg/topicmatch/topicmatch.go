@@ -0,0 +1,133 @@
+// Package topicmatch 实现 MQTT 主题与主题过滤器的匹配（MQTT 3.1.1 §4.7 / MQTT 5 §4.7、§4.8.2），
+// 插件的 ACL 检查、aclsim 与 watch 共用，不依赖本仓库的其他代码。
+//
+// 与逐层比较相比需要注意的规则：
+//   - 以 '$' 开头的主题（$SYS/...、$CONTROL/...）不会被首层为 '+' 或 '#' 的过滤器匹配，只能由显式写出
+//     首层的过滤器匹配；
+//   - 共享订阅 "$share/<group>/<filter>" 按 <filter> 匹配，除非规则本身也写成 $share/... 形式；
+//   - 层可以为空："/a" 是两层（"" 与 "a"），"+" 不匹配它而 "+/+" 匹配；"a/#" 也匹配父层 "a"。
+package topicmatch
+
+import (
+	"errors"
+	"strings"
+	"unicode/utf8"
+)
+
+// MaxLen 是 MQTT UTF-8 字符串的长度上限。
+const MaxLen = 65535
+
+const sharePrefix = "$share/"
+
+// Match 判断 topic 是否落在过滤器 filter 内。topic 也可以是订阅过滤器（订阅时的 ACL 检查）：
+// topic 中的 '+' 只能被 filter 的 '+' 或 '#' 覆盖，'#' 只能被 filter 的 '#' 覆盖。
+// 空的 topic 或 filter 不匹配任何东西。
+func Match(filter, topic string) bool {
+	if filter == "" || topic == "" {
+		return false
+	}
+	if !strings.HasPrefix(filter, sharePrefix) {
+		if _, f, ok := SplitShared(topic); ok {
+			topic = f
+		} else if strings.HasPrefix(topic, sharePrefix) {
+			// 格式错误的共享订阅 broker 会拒绝，这里不放行
+			return false
+		}
+	}
+	if strings.HasPrefix(topic, "$") && (filter[0] == '+' || filter[0] == '#') {
+		return false
+	}
+	fl := strings.Split(filter, "/")
+	tl := strings.Split(topic, "/")
+	for i, f := range fl {
+		if f == "#" {
+			return i == len(fl)-1
+		}
+		if i >= len(tl) {
+			return false
+		}
+		switch {
+		case f == "+":
+			if tl[i] == "#" {
+				return false
+			}
+		case f != tl[i]:
+			return false
+		}
+	}
+	return len(fl) == len(tl)
+}
+
+// SplitShared 拆分共享订阅 "$share/<group>/<filter>"；不是共享订阅或格式错误时 ok 为 false。
+func SplitShared(s string) (group, filter string, ok bool) {
+	rest, found := strings.CutPrefix(s, sharePrefix)
+	if !found {
+		return "", "", false
+	}
+	group, filter, found = strings.Cut(rest, "/")
+	if !found || group == "" || filter == "" || strings.ContainsAny(group, "+#") {
+		return "", "", false
+	}
+	return group, filter, true
+}
+
+var (
+	errEmpty    = errors.New("empty topic")
+	errTooLong  = errors.New("topic longer than 65535 bytes")
+	errUTF8     = errors.New("topic is not valid UTF-8")
+	errNUL      = errors.New("topic contains a NUL character")
+	errWildcard = errors.New("topic name contains a wildcard")
+	errHash     = errors.New("'#' must be the whole last level")
+	errPlus     = errors.New("'+' must be a whole level")
+	errShared   = errors.New("malformed $share/<group>/<filter>")
+)
+
+func validString(s string) error {
+	switch {
+	case s == "":
+		return errEmpty
+	case len(s) > MaxLen:
+		return errTooLong
+	case !utf8.ValidString(s):
+		return errUTF8
+	case strings.ContainsRune(s, 0):
+		return errNUL
+	}
+	return nil
+}
+
+// ValidTopic 检查发布用的主题名：非空、合法 UTF-8、不含 NUL 与通配符。
+func ValidTopic(topic string) error {
+	if err := validString(topic); err != nil {
+		return err
+	}
+	if strings.ContainsAny(topic, "+#") {
+		return errWildcard
+	}
+	return nil
+}
+
+// ValidFilter 检查订阅过滤器：'#' 只能单独作为最后一层，'+' 只能单独成层；
+// 以 $share/ 开头时 group 与其后的过滤器都必须合法。
+func ValidFilter(filter string) error {
+	if err := validString(filter); err != nil {
+		return err
+	}
+	if strings.HasPrefix(filter, sharePrefix) {
+		_, f, ok := SplitShared(filter)
+		if !ok {
+			return errShared
+		}
+		filter = f
+	}
+	levels := strings.Split(filter, "/")
+	for i, l := range levels {
+		if strings.Contains(l, "#") && (l != "#" || i != len(levels)-1) {
+			return errHash
+		}
+		if strings.Contains(l, "+") && l != "+" {
+			return errPlus
+		}
+	}
+	return nil
+}
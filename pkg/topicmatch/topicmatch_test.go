@@ -0,0 +1,178 @@
+package topicmatch
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+	"testing/quick"
+)
+
+func TestMatch(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		filter, topic string
+		want          bool
+	}{
+		{"devices/alice/up", "devices/alice/up", true},
+		{"devices/alice/up", "devices/alice/down", false},
+		{"devices/+/up", "devices/bob/up", true},
+		{"devices/+/up", "devices/bob/x/up", false},
+		{"devices/#", "devices", true},
+		{"devices/#", "devices/a/b/c", true},
+		{"#", "anything/at/all", true},
+		{"devices/alice", "devices/alice/up", false},
+		{"", "a", false},
+		{"#", "", false},
+		// 订阅过滤器中的通配符只能被过滤器中的通配符覆盖
+		{"devices/+/up", "devices/+/up", true},
+		{"devices/alice/up", "devices/+/up", false},
+		{"devices/+", "devices/#", false},
+		{"devices/#", "devices/#", true},
+		// 空层
+		{"+", "/a", false},
+		{"+/+", "/a", true},
+		{"/+", "/a", true},
+		{"#", "/a", true},
+		{"a/+", "a/", true},
+		{"a/+/b", "a//b", true},
+		{"a/b", "a/b/", false},
+		// $ 主题只能被显式写出首层的过滤器匹配
+		{"#", "$SYS/broker/uptime", false},
+		{"+/broker/uptime", "$SYS/broker/uptime", false},
+		{"$SYS/#", "$SYS/broker/uptime", true},
+		{"$SYS/+/uptime", "$SYS/broker/uptime", true},
+		{"#", "$SYS/#", false},
+		{"+/#", "$CONTROL/x", false},
+		// 共享订阅按其中的过滤器匹配
+		{"devices/+/up", "$share/g1/devices/bob/up", true},
+		{"devices/#", "$share/g1/devices/#", true},
+		{"devices/alice/up", "$share/g1/devices/+/up", false},
+		{"#", "$share/g1/$SYS/#", false},
+		{"$share/g1/devices/#", "$share/g1/devices/x", true},
+		{"$share/g1/devices/#", "$share/g2/devices/x", false},
+		{"#", "$share/g1", false},
+		{"#", "$share//devices/x", false},
+		{"#", "$share/g+/devices/x", false},
+	}
+	for _, tc := range tests {
+		if got := Match(tc.filter, tc.topic); got != tc.want {
+			t.Errorf("Match(%q, %q) = %v, want %v", tc.filter, tc.topic, got, tc.want)
+		}
+	}
+}
+
+func TestSplitShared(t *testing.T) {
+	t.Parallel()
+	if g, f, ok := SplitShared("$share/workers/jobs/+"); !ok || g != "workers" || f != "jobs/+" {
+		t.Fatalf("SplitShared = %q, %q, %v", g, f, ok)
+	}
+	for _, s := range []string{"jobs/+", "$share/workers", "$share/workers/", "$share//jobs", "$share/w#/jobs", "$SHARE/w/jobs"} {
+		if _, _, ok := SplitShared(s); ok {
+			t.Errorf("SplitShared(%q) should fail", s)
+		}
+	}
+}
+
+func TestValid(t *testing.T) {
+	t.Parallel()
+	for s, ok := range map[string]bool{
+		"a/b": true, "/a": true, "a//b": true, "$SYS/x": true,
+		"": false, "a/+": false, "a/#": false, "bad\x00": false, "bad\xff": false,
+		strings.Repeat("a", MaxLen+1): false,
+	} {
+		if err := ValidTopic(s); (err == nil) != ok {
+			t.Errorf("ValidTopic(%q) = %v, want ok=%v", s, err, ok)
+		}
+	}
+	for s, ok := range map[string]bool{
+		"#": true, "+": true, "a/+/b": true, "a/#": true, "/+": true, "$share/g/a/#": true,
+		"": false, "a/#/b": false, "a#": false, "a/b+": false, "$share/g": false, "$share/g/a/b#": false,
+	} {
+		if err := ValidFilter(s); (err == nil) != ok {
+			t.Errorf("ValidFilter(%q) = %v, want ok=%v", s, err, ok)
+		}
+	}
+}
+
+// randomTopic 由少量层名组成，方便产生相同的层与空层。
+func randomTopic(r *rand.Rand) string {
+	names := []string{"", "a", "b", "dev", "$SYS", "$x"}
+	levels := make([]string, 1+r.Intn(5))
+	for i := range levels {
+		levels[i] = names[r.Intn(len(names))]
+	}
+	if levels[0] == "" && len(levels) == 1 {
+		levels[0] = "a"
+	}
+	return strings.Join(levels, "/")
+}
+
+// generalize 把主题的部分层换成 '+'，并可能把尾部换成 '#'，得到一定匹配它的过滤器
+// （首层以 '$' 开头时保持不变）。
+func generalize(r *rand.Rand, topic string) string {
+	levels := strings.Split(topic, "/")
+	for i := range levels {
+		if i == 0 && strings.HasPrefix(levels[0], "$") {
+			continue
+		}
+		if r.Intn(3) == 0 {
+			levels[i] = "+"
+		}
+	}
+	if cut := r.Intn(len(levels) + 1); cut < len(levels) && (cut > 0 || !strings.HasPrefix(topic, "$")) {
+		levels = append(levels[:cut], "#")
+	}
+	return strings.Join(levels, "/")
+}
+
+type topicPair struct{ filter, topic string }
+
+func TestMatchProperties(t *testing.T) {
+	t.Parallel()
+	cfg := &quick.Config{MaxCount: 2000}
+
+	// 主题总能匹配自己，也能被由它泛化出的过滤器匹配
+	generalized := func(seed int64) bool {
+		r := rand.New(rand.NewSource(seed))
+		topic := randomTopic(r)
+		filter := generalize(r, topic)
+		return Match(topic, topic) && Match(filter, topic) && Match(filter, filter)
+	}
+	if err := quick.Check(generalized, cfg); err != nil {
+		t.Error(err)
+	}
+
+	// '#' 匹配且只匹配不以 '$' 开头的主题；共享订阅与其中的过滤器结论一致
+	dollar := func(seed int64) bool {
+		r := rand.New(rand.NewSource(seed))
+		topic := randomTopic(r)
+		filter := generalize(r, randomTopic(r))
+		return Match("#", topic) == !strings.HasPrefix(topic, "$") &&
+			Match(filter, "$share/g/"+topic) == Match(filter, topic)
+	}
+	if err := quick.Check(dollar, cfg); err != nil {
+		t.Error(err)
+	}
+}
+
+func FuzzMatch(f *testing.F) {
+	for _, s := range []topicPair{
+		{"devices/+/up", "devices/a/up"}, {"#", "$SYS/x"}, {"+/+", "/a"}, {"a/#", "$share/g/a/b"}, {"$share/g/#", "x"},
+	} {
+		f.Add(s.filter, s.topic)
+	}
+	f.Fuzz(func(t *testing.T, filter, topic string) {
+		got := Match(filter, topic)
+		if got && (filter == "" || topic == "") {
+			t.Fatalf("Match(%q, %q) matched an empty string", filter, topic)
+		}
+		// 过滤器覆盖 topic 时，'#' 也覆盖它（$ 主题与共享订阅除外）
+		if got && !strings.HasPrefix(topic, "$") && !Match("#", topic) {
+			t.Fatalf("Match(%q, %q) but '#' does not match the topic", filter, topic)
+		}
+		// 不含通配符的过滤器只能精确匹配
+		if ValidTopic(filter) == nil && !strings.HasPrefix(filter, "$") && !strings.HasPrefix(topic, "$") && got != (filter == topic) {
+			t.Fatalf("Match(%q, %q) = %v for a literal filter", filter, topic, got)
+		}
+	})
+}
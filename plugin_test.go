@@ -89,10 +89,10 @@ func TestEnvBool(t *testing.T) {
 }
 
 func TestCtxTimeout(t *testing.T) {
-	oldTimeout := timeout
-	t.Cleanup(func() { timeout = oldTimeout })
+	oldTimeout := primary.timeout.get()
+	t.Cleanup(func() { primary.timeout.set(oldTimeout) })
 
-	timeout = 100 * time.Millisecond
+	primary.timeout.set(100 * time.Millisecond)
 	ctx, cancel := ctxTimeout()
 	defer cancel()
 	if deadline, ok := ctx.Deadline(); !ok {
@@ -101,10 +101,52 @@ func TestCtxTimeout(t *testing.T) {
 		t.Fatalf("ctxTimeout deadline remaining %v outside expected range", remaining)
 	}
 
-	timeout = 0
+	primary.timeout.set(0)
 	ctx, cancel = ctxTimeout()
 	cancel()
 	if ctx != context.Background() {
 		t.Fatalf("ctxTimeout with timeout<=0 should return Background context")
 	}
 }
+
+func TestPoolConfigForSchema(t *testing.T) {
+	oldSchema := primary.pgSchema
+	t.Cleanup(func() { primary.pgSchema = oldSchema })
+
+	primary.pgSchema = "iot"
+	cfg, err := primary.poolConfigFor("postgres://u:p@localhost/db?search_path=public", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := cfg.ConnConfig.RuntimeParams["search_path"]; got != `"iot"` {
+		t.Fatalf("search_path = %q, want quoted pg_schema", got)
+	}
+}
+
+func TestAPIProblems(t *testing.T) {
+	oldUsers, oldSys, oldAdmin := controlUsers, sysInterval, adminListen
+	oldTopic, oldCertReg := bootstrapTopic, certAutoRegister
+	t.Cleanup(func() {
+		controlUsers, sysInterval, adminListen = oldUsers, oldSys, oldAdmin
+		bootstrapTopic, certAutoRegister = oldTopic, oldCertReg
+	})
+	controlUsers = map[string]bool{"admin": true}
+	sysInterval = 10 * time.Second
+	adminListen, bootstrapTopic, certAutoRegister = "", "", false
+
+	if got := apiProblems(5); got != nil {
+		t.Fatalf("plugin API v5 reported %v", got)
+	}
+	got := apiProblems(4)
+	if len(got) != 2 {
+		t.Fatalf("apiProblems(4) = %v, want control_users and sys_interval", got)
+	}
+	adminListen = "127.0.0.1:9100"
+	if got := apiProblems(4); len(got) != 3 {
+		t.Fatalf("admin_listen not reported: %v", got)
+	}
+	bootstrapTopic, certAutoRegister = "bootstrap/register", true
+	if got := apiProblems(4); len(got) != 5 {
+		t.Fatalf("bootstrap_topic and cert_auto_register need DISCONNECT: %v", got)
+	}
+}
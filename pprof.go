@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"time"
+)
+
+// pprof_listen：在 broker 进程内开启 net/http/pprof，用于线上抓取 heap/CPU profile。
+// 使用独立的 ServeMux，不向 http.DefaultServeMux 注册任何东西。
+
+var (
+	pprofListen string
+	pprofServer *http.Server
+)
+
+func pprofMux() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	return mux
+}
+
+// isLoopbackAddr 判断监听地址是否只在本机可达。
+func isLoopbackAddr(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip, ok := parseAddr(host)
+	return ok && ip.IsLoopback()
+}
+
+// startPprof 同步绑定端口，端口被占用时直接返回错误。
+func startPprof() error {
+	if pprofListen == "" {
+		return nil
+	}
+	ln, err := net.Listen("tcp", pprofListen)
+	if err != nil {
+		return fmt.Errorf("pprof_listen: %w", err)
+	}
+	srv := &http.Server{Handler: pprofMux(), ReadHeaderTimeout: 10 * time.Second}
+	pprofServer = srv
+	go srv.Serve(ln)
+	return nil
+}
+
+func stopPprof() {
+	if pprofServer == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	pprofServer.Shutdown(ctx)
+	pprofServer = nil
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestIsLoopbackAddr(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		addr string
+		want bool
+	}{
+		{"127.0.0.1:6060", true},
+		{"[::1]:6060", true},
+		{"localhost:6060", true},
+		{"0.0.0.0:6060", false},
+		{":6060", false},
+		{"10.0.0.5:6060", false},
+		{"6060", false},
+	}
+	for _, tc := range tests {
+		if got := isLoopbackAddr(tc.addr); got != tc.want {
+			t.Fatalf("isLoopbackAddr(%q) = %v, want %v", tc.addr, got, tc.want)
+		}
+	}
+}
+
+func TestPprofMux(t *testing.T) {
+	t.Parallel()
+	srv := httptest.NewServer(pprofMux())
+	defer srv.Close()
+	resp, err := srv.Client().Get(srv.URL + "/debug/pprof/heap?debug=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != 200 {
+		t.Fatalf("heap profile status %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+
+	"github.com/grafana/pyroscope-go"
+)
+
+// pyroscope_url：把 broker 进程内 Go 运行时的 CPU / 内存 / goroutine profile 持续推送到
+// Pyroscope（push 模式），便于线上长期采集。URL 中的 user:password 用作 basic auth。
+// CPU profile 同一时刻只能有一个采集者，启用后 pprof_listen 的 /debug/pprof/profile 会返回错误。
+
+var (
+	pyroscopeURL      string
+	pyroscopeAppName  = "mosq-pg-auth"
+	pyroscopeTenantID string
+
+	profiler *pyroscope.Profiler
+)
+
+// pyroscopeLogger 把 pyroscope 的错误写入 mosquitto 日志（同类错误按 log_dedup_interval 去重）。
+type pyroscopeLogger struct{}
+
+func (pyroscopeLogger) Infof(string, ...any)  {}
+func (pyroscopeLogger) Debugf(string, ...any) {}
+func (pyroscopeLogger) Errorf(format string, args ...any) {
+	mosqLogDeduped(logWarning, "auth-plugin: pyroscope: "+format, args...)
+}
+
+// pyroscopeConfig 从 pyroscope_url 拆出服务地址与 basic auth。
+func pyroscopeConfig() (pyroscope.Config, error) {
+	u, err := url.Parse(pyroscopeURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return pyroscope.Config{}, fmt.Errorf("pyroscope_url %q must be an http(s) URL", pyroscopeURL)
+	}
+	cfg := pyroscope.Config{
+		ApplicationName: pyroscopeAppName,
+		TenantID:        pyroscopeTenantID,
+		Logger:          pyroscopeLogger{},
+		Tags:            map[string]string{"version": currentBuild().Version},
+		ProfileTypes: []pyroscope.ProfileType{
+			pyroscope.ProfileCPU,
+			pyroscope.ProfileAllocObjects, pyroscope.ProfileAllocSpace,
+			pyroscope.ProfileInuseObjects, pyroscope.ProfileInuseSpace,
+			pyroscope.ProfileGoroutines,
+		},
+	}
+	if u.User != nil {
+		cfg.BasicAuthUser = u.User.Username()
+		cfg.BasicAuthPassword, _ = u.User.Password()
+		u.User = nil
+	}
+	cfg.ServerAddress = u.String()
+	if host, err := os.Hostname(); err == nil {
+		cfg.Tags["hostname"] = host
+	}
+	if configInstance != "" {
+		cfg.Tags["instance"] = configInstance
+	}
+	return cfg, nil
+}
+
+func startProfiling() error {
+	if pyroscopeURL == "" {
+		return nil
+	}
+	cfg, err := pyroscopeConfig()
+	if err != nil {
+		return err
+	}
+	p, err := pyroscope.Start(cfg)
+	if err != nil {
+		return fmt.Errorf("pyroscope: %w", err)
+	}
+	profiler = p
+	return nil
+}
+
+func stopProfiling() {
+	if profiler == nil {
+		return
+	}
+	profiler.Stop()
+	profiler = nil
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/url"
+	"strings"
+)
+
+// redact_identifiers：日志、JSON 事件、Kafka 与 trace 中的用户名 / client id / 客户端地址
+// 按 hash 或 truncate 处理后输出，供共享日志平台使用；数据库查询与 $CONTROL 响应不受影响。
+//   hash     同一标识总得到同一摘要（可按设备关联日志），redact_salt 防止字典反查
+//   truncate 保留前 3 个字符；IPv4 保留 /24，IPv6 保留 /48
+
+const (
+	redactOff      = "off"
+	redactHash     = "hash"
+	redactTruncate = "truncate"
+)
+
+var (
+	redactMode = redactOff
+	redactSalt string
+)
+
+func parseRedactMode(v string) (string, bool) {
+	switch m := strings.ToLower(strings.TrimSpace(v)); m {
+	case redactOff, redactHash, redactTruncate:
+		return m, true
+	case "false", "0", "no":
+		return redactOff, true
+	}
+	return "", false
+}
+
+// redactID 按 redact_identifiers 处理一个标识；空值原样返回。
+func redactID(s string) string {
+	if s == "" || redactMode == redactOff {
+		return s
+	}
+	if redactMode == redactHash {
+		sum := sha256.Sum256([]byte(redactSalt + s))
+		return "h:" + hex.EncodeToString(sum[:6])
+	}
+	if ip, ok := parseAddr(s); ok {
+		bits := 48
+		if ip.Is4() {
+			bits = 24
+		}
+		p, _ := ip.Prefix(bits)
+		return p.String()
+	}
+	r := []rune(s)
+	if len(r) <= 3 {
+		return strings.Repeat("*", len(r))
+	}
+	return string(r[:3]) + "***"
+}
+
+// safeDSN 隐去 DSN 中的密码，用于日志。
+func safeDSN(dsn string) string {
+	if dsn == "" {
+		return ""
+	}
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return dsn
+	}
+	if u.User != nil {
+		if _, has := u.User.Password(); has {
+			u.User = url.UserPassword(u.User.Username(), "xxxxx")
+		}
+	}
+	return u.String()
+}
@@ -0,0 +1,38 @@
+package main
+
+import "testing"
+
+func TestRedactID(t *testing.T) {
+	oldMode, oldSalt := redactMode, redactSalt
+	t.Cleanup(func() { redactMode, redactSalt = oldMode, oldSalt })
+
+	tests := []struct {
+		mode, in, want string
+	}{
+		{redactOff, "alice", "alice"},
+		{redactTruncate, "alice", "ali***"},
+		{redactTruncate, "bo", "**"},
+		{redactTruncate, "设备一号机", "设备一***"},
+		{redactTruncate, "192.168.7.42", "192.168.7.0/24"},
+		{redactTruncate, "2001:db8:1:2::5", "2001:db8:1::/48"},
+		{redactTruncate, "::ffff:192.168.7.42", "192.168.7.0/24"},
+		{redactTruncate, "[2001:DB8:1:2::5]", "2001:db8:1::/48"},
+		{redactHash, "", ""},
+	}
+	for _, tc := range tests {
+		redactMode = tc.mode
+		if got := redactID(tc.in); got != tc.want {
+			t.Fatalf("redactID(%q) with %s = %q, want %q", tc.in, tc.mode, got, tc.want)
+		}
+	}
+
+	redactMode = redactHash
+	a := redactID("alice")
+	if a != redactID("alice") || a == redactID("bob") || len(a) != 14 {
+		t.Fatalf("hash must be stable and distinct, got %q", a)
+	}
+	redactSalt = "pepper"
+	if redactID("alice") == a {
+		t.Fatal("redact_salt must change the digest")
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func newTestRedis(t *testing.T) (*miniredis.Miniredis, *redis.Client) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	c := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	t.Cleanup(func() { c.Close() })
+	return mr, c
+}
+
+func TestRedisStore(t *testing.T) {
+	t.Parallel()
+	mr, c := newTestRedis(t)
+	mr.HSet("t:user:alice", "password_hash", "$2a$04$x", "salt", "")
+	mr.HSet("t:user:bob", "password_hash", "h", "enabled", "0")
+	mr.SAdd("t:bind:alice", "sensor-1")
+	mr.HSet("t:acl:alice", "devices/{username}/#", "5")
+	mr.HSet("t:acl:*", "public/#", "1")
+	s := redisStore{c, "t:"}
+	ctx := context.Background()
+
+	if d, found, err := s.user(ctx, "alice"); err != nil || !found || !d.enabled || d.hash != "$2a$04$x" {
+		t.Errorf("user(alice) = %+v, %t, %v; want enabled by default", d, found, err)
+	}
+	if d, found, _ := s.user(ctx, "bob"); !found || d.enabled {
+		t.Errorf("user(bob) = %+v, %t; want disabled", d, found)
+	}
+	if _, found, err := s.user(ctx, "carol"); found || err != nil {
+		t.Errorf("user(carol) = %t, %v; want not found", found, err)
+	}
+	if ok, _ := s.bound(ctx, "alice", "sensor-1"); !ok {
+		t.Error("alice should be bound to sensor-1")
+	}
+	if ok, _ := s.bound(ctx, "alice", "sensor-2"); ok {
+		t.Error("alice should not be bound to sensor-2")
+	}
+	rules, err := s.rules(ctx, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Slice(rules, func(i, j int) bool { return rules[i].Pattern < rules[j].Pattern })
+	if len(rules) != 2 || rules[0] != (aclRule{Pattern: "devices/{username}/#", Acc: 5}) || rules[1] != (aclRule{Pattern: "public/#", Acc: 1}) {
+		t.Errorf("rules(alice) = %+v", rules)
+	}
+	mr.HSet("t:acl:*", "broken", "rw")
+	if _, err := s.rules(ctx, "alice"); err == nil {
+		t.Error("a non-numeric acc should be an error")
+	}
+}
+
+type countingStore struct {
+	users, binds, rulesCalls int
+}
+
+func (s *countingStore) user(context.Context, string) (deviceRow, bool, error) {
+	s.users++
+	return deviceRow{hash: "h", salt: "s", enabled: true}, s.users == 1, nil
+}
+
+func (s *countingStore) bound(context.Context, string, string) (bool, error) {
+	s.binds++
+	return true, nil
+}
+
+func (s *countingStore) rules(context.Context, string) ([]aclRule, error) {
+	s.rulesCalls++
+	return []aclRule{{Pattern: "a/#", Acc: 1}}, nil
+}
+
+func (s *countingStore) ping(context.Context) error { return nil }
+
+func TestCachedStore(t *testing.T) {
+	t.Parallel()
+	mr, c := newTestRedis(t)
+	inner := &countingStore{}
+	s := cachedStore{inner, c, "t:", time.Minute}
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		d, found, err := s.user(ctx, "alice")
+		if err != nil || !found || d.hash != "h" || !d.enabled {
+			t.Fatalf("user = %+v, %t, %v", d, found, err)
+		}
+		if ok, _ := s.bound(ctx, "alice", "c1"); !ok {
+			t.Fatal("bound = false")
+		}
+		if r, _ := s.rules(ctx, "alice"); len(r) != 1 || r[0].Pattern != "a/#" {
+			t.Fatalf("rules = %+v", r)
+		}
+	}
+	if inner.users != 1 || inner.binds != 1 || inner.rulesCalls != 1 {
+		t.Errorf("inner store queried %d/%d/%d times, want once each", inner.users, inner.binds, inner.rulesCalls)
+	}
+	// 后写入的字段不延长整个 hash 的过期时间
+	if ttl := mr.TTL("t:cache:alice"); ttl <= 0 || ttl > time.Minute {
+		t.Errorf("cache TTL = %s, want (0, 1m]", ttl)
+	}
+
+	if n, err := flushCacheKeys(ctx, c, "t:", "alice"); err != nil || n != 1 {
+		t.Fatalf("flush alice = %d, %v", n, err)
+	}
+	// 第二次查询 countingStore 返回不存在，缓存后也应保持不存在
+	for i := 0; i < 2; i++ {
+		if _, found, _ := s.user(ctx, "alice"); found {
+			t.Error("negative result should be cached as not found")
+		}
+	}
+	if inner.users != 2 {
+		t.Errorf("inner user lookups = %d, want 2", inner.users)
+	}
+
+	s.rules(ctx, "bob")
+	if n, err := flushCacheKeys(ctx, c, "t:", ""); err != nil || n != 2 {
+		t.Errorf("flush all = %d, %v; want 2 keys", n, err)
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"sort"
+
+	"auth-plugin/pkg/mosqplugin"
+)
+
+// SIGHUP 重载：broker 重读配置后带着新的 plugin_opt_* 触发 MOSQ_EVT_RELOAD。
+// 可运行时调整的选项（与 setConfig 相同）原子地应用并审计；其余选项的变化只提示需要重启。
+// 从配置中删除的选项保持当前值。
+
+// reloadPlan 对比新的选项与已应用的值，拆分为可直接应用的与需要重启的。
+func reloadPlan(newOpts, applied map[string]string) (tunable map[string]string, restart []string) {
+	tunable = map[string]string{}
+	for k, v := range newOpts {
+		if old, ok := applied[k]; ok && old == v {
+			continue
+		}
+		if isTunable(k) {
+			tunable[k] = v
+		} else {
+			restart = append(restart, k)
+		}
+	}
+	sort.Strings(restart)
+	return tunable, restart
+}
+
+// reloadOptions 是 RELOAD 回调（SIGHUP）。
+func reloadOptions(opts []mosqplugin.Option) {
+	newOpts := make(map[string]string, len(opts))
+	for _, o := range opts {
+		newOpts[o.Key] = o.Value
+	}
+
+	tunable, restart := reloadPlan(newOpts, configuredOptions)
+	if len(restart) > 0 {
+		mosqLog(logWarning, "auth-plugin: reload: changes to %v require a broker restart, keeping current values", restart)
+	}
+	if len(tunable) == 0 {
+		return
+	}
+	before := effectiveConfig()
+	if err := setRuntimeOptions(tunable); err != nil {
+		mosqLog(logErr, "auth-plugin: reload: %v, no options changed", err)
+		return
+	}
+	auditConfigChange("reload", "SIGHUP", before, effectiveConfig())
+}
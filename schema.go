@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"auth-plugin/internal/migrations"
+)
+
+// 库的版本：每次建立连接池时从 schema_migrations 读出已执行的最高迁移版本（没有这个表时为 0，
+// 即用 init_db.sql 或自己建的表，不做检查）。数据库与 broker 因此可以分开升级：
+//   - 版本高于插件内嵌的最新迁移时拒绝使用这个库（init 时启动失败，之后的连接按数据库错误处理），
+//     因为更新的库可能改了插件依赖的列；应先升级 broker，再执行迁移；
+//   - 版本低于某个功能所需的迁移时，init 时关闭该功能并提示执行 migrate；关闭会削弱安全性的功能
+//     （totp_users、cert_auto_register）则拒绝启动；
+//   - 查询按版本选择写法：0009 起 salt 可以为 NULL。
+
+// schemaNullableSalt 是 salt 列允许 NULL 的迁移版本（0009_nullable_salt）。
+const schemaNullableSalt = 9
+
+var errSchemaTooNew = errors.New("database schema is newer than this plugin")
+
+// detectSchema 读出库的版本；高于内嵌的最新迁移时返回 errSchemaTooNew。
+func detectSchema(ctx context.Context, p *pgxpool.Pool) (int, error) {
+	var v int
+	if err := p.QueryRow(ctx, migrations.VersionQuery).Scan(&v); err != nil {
+		return 0, fmt.Errorf("read schema_migrations: %w", err)
+	}
+	if latest := migrations.Latest(); v > latest {
+		return v, fmt.Errorf("%w: schema_migrations is at version %d, this plugin knows up to %d; upgrade the plugin first",
+			errSchemaTooNew, v, latest)
+	}
+	return v, nil
+}
+
+// authQueryFor 按库的版本调整认证查询。
+func authQueryFor(q string, version int) string {
+	if version >= schemaNullableSalt {
+		return strings.Replace(q, "SELECT password_hash, salt,", "SELECT password_hash, coalesce(salt, ''),", 1)
+	}
+	return q
+}
+
+// schemaFeature 是依赖某个迁移的功能；disable 为 nil 表示缺少迁移时拒绝启动。
+type schemaFeature struct {
+	option  string
+	version int
+	enabled func() bool
+	disable func()
+}
+
+var schemaFeatures = []schemaFeature{
+	{"config_instance", 2, func() bool { return configInstance != "" }, func() { configInstance = "" }},
+	{"config_audit_table", 3, func() bool { return configAuditTable }, func() { configAuditTable = false }},
+	{"stats_table_interval", 3, func() bool { return statsTableInterval > 0 }, func() { statsTableInterval = 0 }},
+	{"totp_users", 4, func() bool { return strings.TrimSpace(totpUsers) != "" }, nil},
+	{"cert_auto_register", 5, func() bool { return certAutoRegister }, nil},
+	{"flags_poll_interval", 10, func() bool { return flagsPollInterval > 0 }, func() { flagsPollInterval = 0 }},
+	{"activation_webhook_url", 6, func() bool { return activationWebhookURL != "" }, func() { activationWebhookURL = ""; stopActivation() }},
+}
+
+// checkSchemaFeatures 关闭库的版本不支持的功能；有不能关闭的功能时返回错误。版本 0 不检查。
+func checkSchemaFeatures(version int) error {
+	if version == 0 {
+		return nil
+	}
+	var missing []string
+	for _, f := range schemaFeatures {
+		if version >= f.version || !f.enabled() {
+			continue
+		}
+		if f.disable == nil {
+			missing = append(missing, fmt.Sprintf("%s needs migration %04d", f.option, f.version))
+			continue
+		}
+		f.disable()
+		mosqLog(logWarning, "auth-plugin: %s disabled: it needs schema version %d, the database is at %d (run migrate up)",
+			f.option, f.version, version)
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("database schema is at version %d: %s (run migrate up)", version, strings.Join(missing, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAuthQueryFor(t *testing.T) {
+	if got := authQueryFor(authQuery, schemaNullableSalt-1); got != authQuery {
+		t.Fatalf("older schemas keep the query: %q", got)
+	}
+	for _, q := range []string{authQuery, crdbAuthQuery, shardedQueries("tenant_id").auth} {
+		got := authQueryFor(q, schemaNullableSalt)
+		if !strings.Contains(got, "coalesce(salt, '')") || !strings.HasSuffix(got, strings.TrimPrefix(q, "SELECT password_hash, salt,")) {
+			t.Errorf("authQueryFor(%q) = %q", q, got)
+		}
+	}
+}
+
+func TestCheckSchemaFeatures(t *testing.T) {
+	oldAudit, oldStats, oldTOTP := configAuditTable, statsTableInterval, totpUsers
+	t.Cleanup(func() { configAuditTable, statsTableInterval, totpUsers = oldAudit, oldStats, oldTOTP })
+
+	configAuditTable, statsTableInterval, totpUsers = true, time.Minute, ""
+	if err := checkSchemaFeatures(2); err != nil || configAuditTable || statsTableInterval != 0 {
+		t.Fatalf("features from migration 3 should be disabled at version 2: %v audit=%t stats=%s", err, configAuditTable, statsTableInterval)
+	}
+	configAuditTable = true
+	if err := checkSchemaFeatures(0); err != nil || !configAuditTable {
+		t.Fatal("untracked schemas (version 0) must not be checked")
+	}
+	totpUsers = "sensor-*"
+	if err := checkSchemaFeatures(3); err == nil || !strings.Contains(err.Error(), "totp_users needs migration 0004") {
+		t.Fatalf("totp_users without its column must refuse to start, got %v", err)
+	}
+	if err := checkSchemaFeatures(schemaNullableSalt); err != nil {
+		t.Fatal(err)
+	}
+}
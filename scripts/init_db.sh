@@ -36,7 +36,7 @@ psql -h "$PGHOST" -p "$PGPORT" -U "$PGUSER" -d "$PGDATABASE" -v ON_ERROR_STOP=1
 
 # minimal privileges
 psql -h "$PGHOST" -p "$PGPORT" -U "$PGUSER" -d "$PGDATABASE" -v ON_ERROR_STOP=1 <<SQL
-GRANT SELECT ON TABLE users, acls, client_bindings TO "$MQTT_DB_USER";
+GRANT SELECT ON TABLE users, acls, client_bindings, mosq_pg_config TO "$MQTT_DB_USER";
 SQL
 
 echo "DB initialized. DSN example:"
@@ -22,3 +22,50 @@ CREATE TABLE IF NOT EXISTS acls (
   PRIMARY KEY (username, pattern)
 );
 CREATE INDEX IF NOT EXISTS acls_user_idx ON acls(username);
+
+-- optional shared plugin configuration (plugin_opt_config_instance); instance '*' applies to every broker
+CREATE TABLE IF NOT EXISTS mosq_pg_config (
+  instance TEXT NOT NULL,
+  key      TEXT NOT NULL,
+  value    TEXT NOT NULL,
+  PRIMARY KEY (instance, key)
+);
+
+-- optional periodic plugin statistics (plugin_opt_stats_table_interval); counters are cumulative per broker start
+CREATE TABLE IF NOT EXISTS mosq_pg_stats (
+  ts                  TIMESTAMPTZ NOT NULL DEFAULT now(),
+  instance            TEXT NOT NULL,
+  pool_total_conns    INTEGER NOT NULL,
+  pool_acquired_conns INTEGER NOT NULL,
+  pool_idle_conns     INTEGER NOT NULL,
+  grace_cache_entries INTEGER NOT NULL,
+  auth_allowed        BIGINT NOT NULL,
+  auth_denied         BIGINT NOT NULL,
+  auth_errors         BIGINT NOT NULL,
+  acl_allowed         BIGINT NOT NULL,
+  acl_denied          BIGINT NOT NULL,
+  acl_errors          BIGINT NOT NULL,
+  stats               JSONB NOT NULL
+);
+CREATE INDEX IF NOT EXISTS mosq_pg_stats_instance_ts_idx ON mosq_pg_stats(instance, ts);
+
+-- optional audit trail of option changes (plugin_opt_config_audit_table); secrets are stored masked
+CREATE TABLE IF NOT EXISTS mosq_pg_config_audit (
+  ts        TIMESTAMPTZ NOT NULL DEFAULT now(),
+  instance  TEXT NOT NULL,
+  source    TEXT NOT NULL,    -- setConfig / setDSN / secret_file / reload
+  actor     TEXT NOT NULL,
+  key       TEXT NOT NULL,
+  old_value TEXT NOT NULL,
+  new_value TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS mosq_pg_config_audit_ts_idx ON mosq_pg_config_audit(ts);
+
+-- optional runtime feature flags (plugin_opt_flags_poll_interval); a missing row means the flag is on
+CREATE TABLE IF NOT EXISTS mosq_pg_flags (
+  instance   TEXT NOT NULL,   -- config_instance or hostname, '*' for every broker
+  flag       TEXT NOT NULL,
+  enabled    BOOLEAN NOT NULL,
+  updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+  PRIMARY KEY (instance, flag)
+);
@@ -0,0 +1,32 @@
+-- MySQL 8 / MariaDB 10.5+ schema for plugin_opt_db_driver mysql; same tables and columns as
+-- internal/migrations/sql/0001_core.up.sql. The PostgreSQL-only tables (mosq_pg_config, mosq_pg_stats,
+-- mosq_pg_config_audit) are not used with MySQL.
+--
+-- utf8mb4_bin keeps usernames, client ids and topic patterns case-sensitive, as they are in PostgreSQL
+-- and in MQTT; the default *_ci collations would let "Alice" log in as "alice".
+-- Apply with: mysql -u root -p iot < scripts/init_db_mysql.sql
+
+CREATE TABLE IF NOT EXISTS iot_devices (
+  username      VARCHAR(191) NOT NULL PRIMARY KEY,
+  password_hash VARCHAR(255) NOT NULL,
+  salt          VARCHAR(255) NOT NULL DEFAULT '',
+  enabled       SMALLINT NOT NULL DEFAULT 1,
+  totp_secret   VARCHAR(64) NULL,
+  created_at    TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+
+CREATE TABLE IF NOT EXISTS client_bindings (
+  username  VARCHAR(191) NOT NULL,
+  client_id VARCHAR(191) NOT NULL,
+  PRIMARY KEY (username, client_id),
+  FOREIGN KEY (username) REFERENCES iot_devices(username) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
+
+-- acc bitmask: 1=read 2=write 4=subscribe; username '*' holds global rules.
+-- The primary key's username prefix serves the plugin's lookup, no extra index needed.
+CREATE TABLE IF NOT EXISTS acls (
+  username VARCHAR(191) NOT NULL,
+  pattern  VARCHAR(512) NOT NULL,
+  acc      INT NOT NULL CHECK (acc > 0 AND acc <= 7),
+  PRIMARY KEY (username, pattern)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// 从挂载的 Secret 文件读取 DSN / 密码，并监听变更。
+// Kubernetes 轮换 Secret 时通过替换 ..data 符号链接原子更新文件，
+// 因此监听的是所在目录，任何事件后重新读取文件、比较内容再决定是否重建连接池。
+
+const (
+	secretReloadDebounce = time.Second
+	secretReloadRetry    = 10 * time.Second
+)
+
+var (
+	pgDSNFile      string
+	pgPasswordFile string
+	pgPassword     string // 来自 pg_password_file，覆盖 DSN 中的密码
+
+	credMu sync.RWMutex
+
+	secretWatchMu   sync.Mutex
+	secretWatchStop context.CancelFunc
+	secretWatchDone chan struct{}
+)
+
+// pgCredentials 返回当前生效的 DSN 与覆盖密码；文件监听协程会并发更新它们。
+func pgCredentials() (dsn, password string) {
+	credMu.RLock()
+	defer credMu.RUnlock()
+	return primary.pgDSN, pgPassword
+}
+
+// credentialOptions 以选项形式返回当前凭据，供配置审计比较（输出时遮蔽）。
+func credentialOptions() map[string]string {
+	dsn, password := pgCredentials()
+	return map[string]string{"pg_dsn": dsn, "pg_password": password}
+}
+
+func readSecretFile(path string) (string, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(raw)), nil
+}
+
+// loadSecretFiles 读取已配置的 Secret 文件，返回是否有变化。
+func loadSecretFiles() (changed bool, err error) {
+	var dsn, password string
+	if pgDSNFile != "" {
+		if dsn, err = readSecretFile(pgDSNFile); err != nil {
+			return false, fmt.Errorf("read pg_dsn_file: %w", err)
+		}
+		if dsn == "" {
+			return false, fmt.Errorf("pg_dsn_file %s is empty", pgDSNFile)
+		}
+	}
+	if pgPasswordFile != "" {
+		if password, err = readSecretFile(pgPasswordFile); err != nil {
+			return false, fmt.Errorf("read pg_password_file: %w", err)
+		}
+	}
+
+	credMu.Lock()
+	defer credMu.Unlock()
+	if pgDSNFile != "" && dsn != primary.pgDSN {
+		primary.pgDSN = dsn
+		changed = true
+	}
+	if pgPasswordFile != "" && password != pgPassword {
+		pgPassword = password
+		changed = true
+	}
+	return changed, nil
+}
+
+// startSecretWatcher 监听 Secret 文件所在目录，内容变化时重建并原子替换连接池。
+func startSecretWatcher() error {
+	dirs := map[string]struct{}{}
+	for _, f := range []string{pgDSNFile, pgPasswordFile} {
+		if f != "" {
+			dirs[filepath.Dir(f)] = struct{}{}
+		}
+	}
+	if len(dirs) == 0 {
+		return nil
+	}
+
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	for dir := range dirs {
+		if err := w.Add(dir); err != nil {
+			w.Close()
+			return fmt.Errorf("watch %s: %w", dir, err)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	secretWatchMu.Lock()
+	secretWatchStop, secretWatchDone = cancel, done
+	secretWatchMu.Unlock()
+
+	go func() {
+		defer close(done)
+		defer w.Close()
+		var reload <-chan time.Time
+		rebuildPending := false
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case ev, ok := <-w.Events:
+				if !ok {
+					return
+				}
+				if ev.Op == fsnotify.Chmod {
+					continue
+				}
+				// 合并 Secret 更新时的一串事件
+				reload = time.After(secretReloadDebounce)
+			case err, ok := <-w.Errors:
+				if !ok {
+					return
+				}
+				mosqLog(logWarning, "auth-plugin: secret file watcher error: %v", err)
+			case <-reload:
+				reload = nil
+				before := credentialOptions()
+				changed, err := loadSecretFiles()
+				if changed {
+					auditConfigChange("secret_file", "file watcher", before, credentialOptions())
+				}
+				if err == nil && (changed || rebuildPending) {
+					// 重建失败时新值已生效，需记住待重建，否则重试时会因内容未变而跳过
+					err = rebuildPoolForSecrets(ctx)
+					rebuildPending = err != nil
+				}
+				if err != nil {
+					mosqLog(logWarning, "auth-plugin: credential reload failed: %v (retrying in %s)",
+						err, secretReloadRetry)
+					reload = time.After(secretReloadRetry)
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+func stopSecretWatcher() {
+	secretWatchMu.Lock()
+	cancel, done := secretWatchStop, secretWatchDone
+	secretWatchStop, secretWatchDone = nil, nil
+	secretWatchMu.Unlock()
+	if cancel != nil {
+		cancel()
+		<-done
+	}
+}
+
+func rebuildPoolForSecrets(ctx context.Context) error {
+	dsn, _ := pgCredentials()
+	mosqLog(logInfo, "auth-plugin: credential files changed, rebuilding pool (pg_dsn=%s)", safeDSN(dsn))
+
+	buildCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	newPool, err := primary.buildPool(buildCtx)
+	if err != nil {
+		return err
+	}
+	primary.swapPool(newPool)
+	mosqLog(logInfo, "auth-plugin: pool swapped after credential rotation")
+	return nil
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadSecretFiles(t *testing.T) {
+	oldDSN, oldDSNFile, oldPwd, oldPwdFile := primary.pgDSN, pgDSNFile, pgPassword, pgPasswordFile
+	t.Cleanup(func() {
+		primary.pgDSN, pgDSNFile, pgPassword, pgPasswordFile = oldDSN, oldDSNFile, oldPwd, oldPwdFile
+	})
+
+	dir := t.TempDir()
+	pgDSNFile = filepath.Join(dir, "dsn")
+	pgPasswordFile = filepath.Join(dir, "password")
+	primary.pgDSN, pgPassword = "", ""
+	if err := os.WriteFile(pgDSNFile, []byte("postgres://iot@db/iot\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(pgPasswordFile, []byte("first\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	changed, err := loadSecretFiles()
+	if err != nil || !changed {
+		t.Fatalf("initial load = (%v, %v), want (true, nil)", changed, err)
+	}
+	if dsn, pwd := pgCredentials(); dsn != "postgres://iot@db/iot" || pwd != "first" {
+		t.Fatalf("pgCredentials() = (%q, %q)", dsn, pwd)
+	}
+	if changed, _ := loadSecretFiles(); changed {
+		t.Fatal("reload without modification should report unchanged")
+	}
+
+	if err := os.WriteFile(pgPasswordFile, []byte("second"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if changed, err := loadSecretFiles(); err != nil || !changed {
+		t.Fatalf("reload after rotation = (%v, %v), want (true, nil)", changed, err)
+	}
+	if _, pwd := pgCredentials(); pwd != "second" {
+		t.Fatalf("password after rotation = %q", pwd)
+	}
+
+	if err := os.WriteFile(pgDSNFile, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadSecretFiles(); err == nil {
+		t.Fatal("empty pg_dsn_file should be rejected")
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// self_test：启动时检查内置查询依赖的表、列和索引，并 EXPLAIN 热点查询，
+// 把问题（如 username 上缺索引）在启动日志里指出来，而不是等第一个客户端连接时才失败。
+
+var selfTestEnabled bool
+
+type selfTestTable struct {
+	name       string
+	columns    []string
+	indexedCol string // 需要以该列开头的索引；空表示不检查
+	query      string // 需要 EXPLAIN 的热点查询
+	args       []any
+}
+
+// selfTestTables 按当前启用的功能列出需要检查的表。
+func selfTestTables() []selfTestTable {
+	authQ, bindQ, aclQ := pgQueries()
+	var tables []selfTestTable
+	if !primary.disableBasicAuth {
+		tables = append(tables, selfTestTable{
+			name: "iot_devices", columns: []string{"username", "password_hash", "salt", "enabled"},
+			indexedCol: "username", query: authQ, args: []any{""},
+		})
+		if primary.enforceBind {
+			tables = append(tables, selfTestTable{
+				name: "client_bindings", columns: []string{"username", "client_id"},
+				indexedCol: "username", query: bindQ, args: []any{"", ""},
+			})
+		}
+	}
+	if primary.enableACLCheck {
+		tables = append(tables, selfTestTable{
+			name: "acls", columns: []string{"username", "pattern", "acc"},
+			indexedCol: "username", query: aclQ, args: []any{""},
+		})
+	}
+	// 分布式表：查询带分布列，索引应以分布列开头
+	if shardColumn != "" {
+		for i := range tables {
+			tables[i].columns = append(tables[i].columns, shardColumn)
+			tables[i].indexedCol = shardColumn
+			tables[i].args = append(tables[i].args, "")
+		}
+	}
+	return tables
+}
+
+const (
+	pgIndexQuery = `SELECT EXISTS (
+				SELECT 1 FROM pg_index i
+				JOIN pg_attribute a ON a.attrelid = i.indrelid AND a.attnum = i.indkey[0]
+				WHERE i.indrelid = to_regclass($1) AND a.attname = $2)`
+	crdbIndexQuery = `SELECT EXISTS (
+				SELECT 1 FROM information_schema.statistics
+				WHERE table_schema = current_schema() AND table_name = $1 AND column_name = $2 AND seq_in_index = 1)`
+)
+
+// indexQuery 判断表上是否有以某列开头的索引。
+func indexQuery() string {
+	if pgFlavor == flavorCockroach {
+		return crdbIndexQuery
+	}
+	return pgIndexQuery
+}
+
+// missingColumns 返回 want 中不在 have 里的列。
+func missingColumns(have map[string]bool, want []string) []string {
+	var missing []string
+	for _, c := range want {
+		if !have[c] {
+			missing = append(missing, c)
+		}
+	}
+	return missing
+}
+
+// runSelfTest 返回发现的问题；每条都应说明如何修复。
+func runSelfTest(ctx context.Context, p *pgxpool.Pool) []string {
+	var problems []string
+	for _, t := range selfTestTables() {
+		var exists bool
+		if err := p.QueryRow(ctx, "SELECT to_regclass($1) IS NOT NULL", t.name).Scan(&exists); err != nil {
+			return append(problems, fmt.Sprintf("self-test aborted: %v", err))
+		}
+		if !exists {
+			problems = append(problems, fmt.Sprintf("table %s not found in search_path (see scripts/init_db.sql, or set pg_schema)", t.name))
+			continue
+		}
+
+		rows, err := p.Query(ctx,
+			"SELECT attname FROM pg_attribute WHERE attrelid = to_regclass($1) AND attnum > 0 AND NOT attisdropped", t.name)
+		if err != nil {
+			return append(problems, fmt.Sprintf("self-test aborted: %v", err))
+		}
+		have := map[string]bool{}
+		for rows.Next() {
+			var col string
+			if err := rows.Scan(&col); err != nil {
+				rows.Close()
+				return append(problems, fmt.Sprintf("self-test aborted: %v", err))
+			}
+			have[col] = true
+		}
+		rows.Close()
+		if missing := missingColumns(have, t.columns); len(missing) > 0 {
+			problems = append(problems, fmt.Sprintf("table %s is missing column(s) %s", t.name, strings.Join(missing, ", ")))
+			continue
+		}
+
+		if t.indexedCol != "" {
+			var indexed bool
+			err := p.QueryRow(ctx, indexQuery(), t.name, t.indexedCol).Scan(&indexed)
+			if err != nil {
+				return append(problems, fmt.Sprintf("self-test aborted: %v", err))
+			}
+			if !indexed {
+				problems = append(problems, fmt.Sprintf("no index on %s(%s); every lookup scans the table: CREATE INDEX ON %s(%s)",
+					t.name, t.indexedCol, t.name, t.indexedCol))
+			}
+		}
+
+		if t.query != "" {
+			if _, err := p.Exec(ctx, "EXPLAIN "+t.query, t.args...); err != nil {
+				problems = append(problems, fmt.Sprintf("query on %s failed to plan: %v", t.name, err))
+			}
+		}
+	}
+	return problems
+}
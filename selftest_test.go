@@ -0,0 +1,35 @@
+package main
+
+import "testing"
+
+func TestSelfTestTables(t *testing.T) {
+	oldAuth, oldACL, oldBind := primary.disableBasicAuth, primary.enableACLCheck, primary.enforceBind
+	t.Cleanup(func() {
+		primary.disableBasicAuth, primary.enableACLCheck, primary.enforceBind = oldAuth, oldACL, oldBind
+	})
+
+	names := func() []string {
+		var out []string
+		for _, tb := range selfTestTables() {
+			out = append(out, tb.name)
+		}
+		return out
+	}
+	primary.disableBasicAuth, primary.enableACLCheck, primary.enforceBind = false, true, true
+	if got := names(); len(got) != 3 {
+		t.Fatalf("selfTestTables = %v, want iot_devices, client_bindings, acls", got)
+	}
+	primary.disableBasicAuth = true
+	if got := names(); len(got) != 1 || got[0] != "acls" {
+		t.Fatalf("selfTestTables with disable_basic_auth = %v, want acls", got)
+	}
+}
+
+func TestMissingColumns(t *testing.T) {
+	t.Parallel()
+	have := map[string]bool{"username": true, "enabled": true}
+	got := missingColumns(have, []string{"username", "password_hash", "enabled", "salt"})
+	if len(got) != 2 || got[0] != "password_hash" || got[1] != "salt" {
+		t.Fatalf("missingColumns = %v", got)
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// shard_column：在按租户分布的 Citus / YugabyteDB 上运行。iot_devices、client_bindings 与 acls
+// 以 shard_column（如 tenant_id）为分布列时，只带 username 的查询要广播到所有分片；
+// 设置后每条认证、绑定与 ACL 查询都带上分布列条件，由协调节点路由到单个分片：
+//
+//   - 分片键取 shard_value（每个 broker 只服务一个租户时），否则取用户名中 shard_separator 之前的部分
+//     （如 acme:sensor-1 → acme）；用户名中没有分隔符时按账号不存在处理；
+//   - ACL 查询变为 WHERE tenant_id = $2 AND (username = $1 OR username = '*')，
+//     '*' 规则因此按租户存放，每个租户一份，不再是跨分片的全局行；
+//   - self_test 要求以分布列开头的索引（Citus 上唯一约束本来就要包含分布列，如 PRIMARY KEY (tenant_id, username)）。
+
+var (
+	shardColumn    string
+	shardValue     string
+	shardSeparator = ":"
+
+	shardQ, crdbShardQ querySet
+)
+
+type querySet struct{ auth, bind, acl string }
+
+var columnName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+func setShardColumn(v string) error {
+	v = strings.TrimSpace(v)
+	if v != "" && !columnName.MatchString(v) {
+		return fmt.Errorf("want a column name, keeping existing value %q", shardColumn)
+	}
+	shardColumn = v
+	shardQ = shardedQueries(v)
+	crdbShardQ = querySet{
+		asOfFollower(shardQ.auth, "iot_devices"),
+		asOfFollower(shardQ.bind, "client_bindings"),
+		asOfFollower(shardQ.acl, "acls"),
+	}
+	return nil
+}
+
+// shardedQueries 返回带分布列条件的查询；分片键总是最后一个参数。
+func shardedQueries(column string) querySet {
+	c := pgx.Identifier{column}.Sanitize()
+	return querySet{
+		auth: authQuery + " AND " + c + "=$2",
+		bind: bindQuery + " AND " + c + "=$3",
+		acl:  "SELECT pattern, acc FROM acls WHERE " + c + " = $2 AND (username = $1 OR username = '*')",
+	}
+}
+
+// shardKey 返回用户所在分片的键；取不到时 ok 为 false。
+func shardKey(username string) (string, bool) {
+	if shardValue != "" {
+		return shardValue, true
+	}
+	tenant, _, found := strings.Cut(username, shardSeparator)
+	return tenant, found && tenant != "" && shardSeparator != ""
+}
+
+// shardArgs 在查询参数后面追加分片键；未开启 shard_column 时原样返回。
+// ok 为 false 表示用户名中取不到分片键，调用方按账号不存在处理。
+func shardArgs(username string, args ...any) ([]any, bool) {
+	if shardColumn == "" {
+		return args, true
+	}
+	key, ok := shardKey(username)
+	if !ok {
+		return nil, false
+	}
+	return append(args, key), true
+}
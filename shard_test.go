@@ -0,0 +1,74 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestShardedQueries(t *testing.T) {
+	oldCol, oldFlavor, oldFollower := shardColumn, pgFlavor, crdbFollowerReads
+	t.Cleanup(func() {
+		_ = setShardColumn(oldCol)
+		pgFlavor, crdbFollowerReads = oldFlavor, oldFollower
+	})
+
+	if err := setShardColumn("tenant id"); err == nil {
+		t.Fatal("column names with spaces should be rejected")
+	}
+	if err := setShardColumn("tenant_id"); err != nil {
+		t.Fatal(err)
+	}
+	pgFlavor = flavorPostgres
+	auth, bind, acl := pgQueries()
+	if auth != authQuery+` AND "tenant_id"=$2` || bind != bindQuery+` AND "tenant_id"=$3` {
+		t.Errorf("auth = %q, bind = %q", auth, bind)
+	}
+	if acl != `SELECT pattern, acc FROM acls WHERE "tenant_id" = $2 AND (username = $1 OR username = '*')` {
+		t.Errorf("acl = %q", acl)
+	}
+
+	pgFlavor, crdbFollowerReads = flavorCockroach, true
+	auth, _, acl = pgQueries()
+	for _, q := range []string{auth, acl} {
+		if !strings.Contains(q, "follower_read_timestamp()") || !strings.Contains(q, `"tenant_id"`) {
+			t.Errorf("query %q should have both the follower read clause and the shard condition", q)
+		}
+	}
+
+	if err := setShardColumn(""); err != nil {
+		t.Fatal(err)
+	}
+	if auth, _, _ := pgQueries(); strings.Contains(auth, "tenant_id") {
+		t.Errorf("auth = %q after clearing shard_column", auth)
+	}
+}
+
+func TestShardArgs(t *testing.T) {
+	oldCol, oldValue, oldSep := shardColumn, shardValue, shardSeparator
+	t.Cleanup(func() {
+		_ = setShardColumn(oldCol)
+		shardValue, shardSeparator = oldValue, oldSep
+	})
+
+	_ = setShardColumn("")
+	if args, ok := shardArgs("acme:s1", "acme:s1"); !ok || len(args) != 1 {
+		t.Fatalf("without shard_column args = %v, %v", args, ok)
+	}
+
+	_ = setShardColumn("tenant_id")
+	shardValue, shardSeparator = "", ":"
+	args, ok := shardArgs("acme:s1", "acme:s1", "cid")
+	if !ok || len(args) != 3 || args[2] != "acme" {
+		t.Fatalf("args = %v, %v", args, ok)
+	}
+	for _, u := range []string{"no-tenant", ":s1"} {
+		if _, ok := shardArgs(u, u); ok {
+			t.Errorf("shardArgs(%q) should find no shard key", u)
+		}
+	}
+
+	shardValue = "fixed"
+	if args, ok := shardArgs("no-tenant", "no-tenant"); !ok || args[1] != "fixed" {
+		t.Fatalf("shard_value args = %v, %v", args, ok)
+	}
+}
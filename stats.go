@@ -0,0 +1,154 @@
+package main
+
+import (
+	"errors"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"auth-plugin/pkg/mosqplugin"
+)
+
+// 插件统计：计数器由各回调累加，getStats 控制命令和 $SYS/mosq-pg/# 共用同一份快照。
+// $SYS 发布在 TICK 回调中完成（broker 主线程），mosquitto_broker_publish_* 不能在其他线程调用。
+
+const sysTopicPrefix = "$SYS/mosq-pg/"
+
+var (
+	sysInterval time.Duration // 0 表示不发布 $SYS
+	sysLastPub  time.Time
+
+	authAllowed  atomic.Int64
+	authDenied   atomic.Int64
+	authErrors   atomic.Int64
+	graceAllowed atomic.Int64
+	aclAllowed   atomic.Int64
+	aclDenied    atomic.Int64
+	aclErrors    atomic.Int64
+	dbHealthy    atomic.Bool // 最近一次数据库访问是否成功
+)
+
+// gaugeStats 是瞬时值，其余统计项均为累计计数。
+var gaugeStats = map[string]bool{
+	"db_up":                  true,
+	"db_health_state":        true,
+	"db_pool_total_conns":    true,
+	"db_pool_idle_conns":     true,
+	"db_pool_acquired_conns": true,
+	"grace_cache_entries":    true,
+	"auth_latency_p99_us":    true,
+	"acl_latency_p99_us":     true,
+}
+
+type statValue struct {
+	name  string // getStats 中的键
+	topic string // $SYS/mosq-pg/ 之后的部分
+	value int64
+}
+
+func statsSnapshot() []statValue {
+	var up int64
+	if dbHealthy.Load() {
+		up = 1
+	}
+	stats := []statValue{
+		{"auth_allowed", "auth/allowed", authAllowed.Load()},
+		{"auth_denied", "auth/denied", authDenied.Load()},
+		{"auth_errors", "auth/errors", authErrors.Load()},
+		{"auth_grace_allowed", "auth/grace_allowed", graceAllowed.Load()},
+		{"auth_fail_open", "auth/fail_open", authFailOpen.Load()},
+		{"auth_fallback", "auth/fallback", authFallback.Load()},
+		{"grace_cache_entries", "auth/grace_cache_entries", int64(recentAuth.size())},
+		{"weak_hash_logins", "auth/weak_hash_logins", weakHashLogins.Load()},
+		{"weak_hash_rejected", "auth/weak_hash_rejected", weakHashRejected.Load()},
+		{"pending_registered", "auth/pending_registered", pendingRegistered.Load()},
+		{"bootstrap_registered", "auth/bootstrap_registered", bootstrapRegistered.Load()},
+		{"activations_notified", "auth/activations_notified", activationsNotified.Load()},
+		{"activations_failed", "auth/activations_failed", activationsFailed.Load()},
+		{"activations_dropped", "auth/activations_dropped", activationsDropped.Load()},
+		{"acl_allowed", "acl/allowed", aclAllowed.Load()},
+		{"acl_denied", "acl/denied", aclDenied.Load()},
+		{"acl_errors", "acl/errors", aclErrors.Load()},
+		{"acl_fail_open", "acl/fail_open", aclFailOpen.Load()},
+		{"acl_fallback", "acl/fallback", aclFallback.Load()},
+		{"callback_panics", "plugin/callback_panics", callbackPanics.Load() + mosqplugin.Panics()},
+		{"auth_latency_p99_us", "auth/latency_p99_us", authLatency.lastP99().Microseconds()},
+		{"acl_latency_p99_us", "acl/latency_p99_us", aclLatency.lastP99().Microseconds()},
+		{"db_up", "db/up", up},
+		{"db_health_state", "db/health_state", int64(health.current())},
+		{"backend_skipped", "db/backend_skipped", backendSkipped.Load()},
+		{"db_retries", "db/retries", dbRetries.Load()},
+		{"db_dns_changes", "db/dns_changes", dnsChanges.Load()},
+		{"db_dns_replaced_conns", "db/dns_replaced_conns", dnsReplaced.Load()},
+		{"cache_hits", "cache/hits", cacheHits.Load()},
+		{"cache_misses", "cache/misses", cacheMisses.Load()},
+		{"cache_errors", "cache/errors", cacheErrors.Load()},
+		{"kafka_dropped", "kafka/dropped", kafkaDropped.Load()},
+		{"kafka_failed", "kafka/failed", kafkaFailed.Load()},
+	}
+	stats = append(stats, denyStats()...)
+	p := primary.currentPool()
+	if p != nil {
+		st := p.Stat()
+		stats = append(stats,
+			statValue{"db_pool_total_conns", "db/pool/total_conns", int64(st.TotalConns())},
+			statValue{"db_pool_idle_conns", "db/pool/idle_conns", int64(st.IdleConns())},
+			statValue{"db_pool_acquired_conns", "db/pool/acquired_conns", int64(st.AcquiredConns())},
+			statValue{"db_pool_acquire_count", "db/pool/acquire_count", st.AcquireCount()},
+			statValue{"db_pool_empty_acquire_count", "db/pool/empty_acquire_count", st.EmptyAcquireCount()},
+		)
+	}
+	if st, ok := mysqlPoolStats(); ok {
+		stats = append(stats,
+			statValue{"db_pool_total_conns", "db/pool/total_conns", int64(st.OpenConnections)},
+			statValue{"db_pool_idle_conns", "db/pool/idle_conns", int64(st.Idle)},
+			statValue{"db_pool_acquired_conns", "db/pool/acquired_conns", int64(st.InUse)},
+		)
+	}
+	return stats
+}
+
+func statsMap() map[string]int64 {
+	out := map[string]int64{}
+	for _, s := range statsSnapshot() {
+		out[s.name] = s.value
+	}
+	return out
+}
+
+// recordDBResult 根据一次数据库访问的结果更新健康状态；只在确实访问过数据库时调用。
+func recordDBResult(err error) {
+	if errors.Is(err, errDatabaseDown) {
+		return
+	}
+	dbHealthy.Store(err == nil)
+	observeHealth(err)
+}
+
+// registerStats 在需要时注册 TICK 回调。
+func registerStats(h *mosqplugin.Handle) error {
+	// admin_listen 的踢下线请求与 setDSN 的连接池切换也在 TICK 回调中执行
+	if sysInterval <= 0 && adminListen == "" && len(controlUsers) == 0 {
+		return nil
+	}
+	return h.OnTick(tick)
+}
+
+func publishSys(topic string, payload []byte) {
+	// 与 broker 自身的 $SYS 一致使用保留消息，新订阅者立即拿到最新值
+	mosqplugin.Publish("", topic, payload, true)
+}
+
+// tick 是 TICK 回调（broker 主线程，约每秒一次）。
+func tick() {
+	runAdminKicks()
+	finishDSNRotation()
+	if now := time.Now(); sysInterval > 0 && now.Sub(sysLastPub) >= sysInterval {
+		sysLastPub = now
+		for _, s := range statsSnapshot() {
+			publishSys(sysTopicPrefix+s.topic, []byte(strconv.FormatInt(s.value, 10)))
+		}
+		publishSys(sysTopicPrefix+"db/health", []byte(health.current().String()))
+		publishSys(sysTopicPrefix+"version", []byte(currentBuild().String()))
+	}
+}
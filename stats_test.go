@@ -0,0 +1,34 @@
+package main
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestStatsSnapshot(t *testing.T) {
+	oldHealthy := dbHealthy.Load()
+	t.Cleanup(func() { dbHealthy.Store(oldHealthy) })
+
+	before := statsMap()
+	aclDenied.Add(1)
+	recordDBResult(nil)
+	after := statsMap()
+	if after["acl_denied"] != before["acl_denied"]+1 {
+		t.Fatalf("acl_denied = %d, want %d", after["acl_denied"], before["acl_denied"]+1)
+	}
+	if after["db_up"] != 1 {
+		t.Fatalf("db_up = %d after a successful query", after["db_up"])
+	}
+	recordDBResult(errors.New("down"))
+	if statsMap()["db_up"] != 0 {
+		t.Fatal("db_up should drop to 0 after a failed query")
+	}
+
+	names, topics := map[string]bool{}, map[string]bool{}
+	for _, s := range statsSnapshot() {
+		if names[s.name] || topics[s.topic] {
+			t.Fatalf("duplicate stat %s (%s)", s.name, s.topic)
+		}
+		names[s.name], topics[s.topic] = true, true
+	}
+}
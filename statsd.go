@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// StatsD / DogStatsD 导出：按 statsd_interval 发送与 getStats / $SYS 相同的统计项
+// （计数器发送增量，gauge 发送当前值），并为每次认证/ACL 检查发送耗时 timer。
+// 设置 statsd_tags 时使用 DogStatsD 的 |#tag 扩展。
+
+var (
+	statsdAddr     string
+	statsdPrefix   = "mosq_pg."
+	statsdTags     string
+	statsdInterval = 10 * time.Second
+
+	statsdMu   sync.Mutex
+	statsdConn net.Conn
+	statsdStop chan struct{}
+	statsdDone chan struct{}
+)
+
+// formatStatsd 生成一行 statsd 协议文本。
+func formatStatsd(name, value, kind string) string {
+	line := statsdPrefix + name + ":" + value + "|" + kind
+	if statsdTags != "" {
+		line += "|#" + statsdTags
+	}
+	return line
+}
+
+func statsdSend(lines []string) {
+	statsdMu.Lock()
+	conn := statsdConn
+	statsdMu.Unlock()
+	if conn == nil || len(lines) == 0 {
+		return
+	}
+	// 分批发送，避免超过常见的 1432 字节 UDP 负载上限
+	var buf strings.Builder
+	for _, l := range lines {
+		if buf.Len() > 0 && buf.Len()+len(l)+1 > 1432 {
+			conn.Write([]byte(buf.String()))
+			buf.Reset()
+		}
+		if buf.Len() > 0 {
+			buf.WriteByte('\n')
+		}
+		buf.WriteString(l)
+	}
+	conn.Write([]byte(buf.String()))
+}
+
+// statsdLines 根据上一次发送的值计算计数器增量。
+func statsdLines(stats []statValue, last map[string]int64) []string {
+	var lines []string
+	for _, s := range stats {
+		if gaugeStats[s.name] {
+			lines = append(lines, formatStatsd(s.name, fmt.Sprint(s.value), "g"))
+			continue
+		}
+		delta := s.value - last[s.name]
+		last[s.name] = s.value
+		if delta > 0 {
+			lines = append(lines, formatStatsd(s.name, fmt.Sprint(delta), "c"))
+		}
+	}
+	return lines
+}
+
+func startStatsd() error {
+	if statsdAddr == "" {
+		return nil
+	}
+	conn, err := net.Dial("udp", statsdAddr)
+	if err != nil {
+		return fmt.Errorf("statsd_addr: %w", err)
+	}
+	stop, done := make(chan struct{}), make(chan struct{})
+	statsdMu.Lock()
+	statsdConn, statsdStop, statsdDone = conn, stop, done
+	statsdMu.Unlock()
+
+	go func() {
+		defer close(done)
+		last := map[string]int64{}
+		t := time.NewTicker(statsdInterval)
+		defer t.Stop()
+		for {
+			select {
+			case <-stop:
+				statsdSend(statsdLines(statsSnapshot(), last))
+				return
+			case <-t.C:
+				statsdSend(statsdLines(statsSnapshot(), last))
+			}
+		}
+	}()
+	return nil
+}
+
+func stopStatsd() {
+	statsdMu.Lock()
+	stop, done := statsdStop, statsdDone
+	statsdStop, statsdDone = nil, nil
+	statsdMu.Unlock()
+	if stop == nil {
+		return
+	}
+	close(stop)
+	<-done
+	statsdMu.Lock()
+	statsdConn.Close()
+	statsdConn = nil
+	statsdMu.Unlock()
+}
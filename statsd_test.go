@@ -0,0 +1,30 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestStatsdLines(t *testing.T) {
+	oldPrefix, oldTags := statsdPrefix, statsdTags
+	t.Cleanup(func() { statsdPrefix, statsdTags = oldPrefix, oldTags })
+	statsdPrefix, statsdTags = "mq.", ""
+
+	last := map[string]int64{}
+	stats := []statValue{{name: "auth_denied", value: 5}, {name: "db_up", value: 1}}
+	want := []string{"mq.auth_denied:5|c", "mq.db_up:1|g"}
+	if got := statsdLines(stats, last); !reflect.DeepEqual(got, want) {
+		t.Fatalf("statsdLines = %v, want %v", got, want)
+	}
+
+	// 只发送增量，未变化的计数器不发送；gauge 每次都发送
+	statsdTags = "env:test"
+	stats[0].value = 7
+	want = []string{"mq.auth_denied:2|c|#env:test", "mq.db_up:1|g|#env:test"}
+	if got := statsdLines(stats, last); !reflect.DeepEqual(got, want) {
+		t.Fatalf("statsdLines = %v, want %v", got, want)
+	}
+	if got := statsdLines(stats, last); len(got) != 1 {
+		t.Fatalf("unchanged counters should be skipped, got %v", got)
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// stats_table_interval：定期把统计快照写入 mosq_pg_stats，没有 Prometheus 的环境可以直接用 SQL 作图。
+// 常用项单独成列，完整快照（与 getStats 相同）写入 stats jsonb；计数器为加载以来的累计值。
+// 数据库被标记为 down 或连接池尚未建立时跳过本次写入。
+
+const statsTableInsert = `INSERT INTO mosq_pg_stats
+  (instance, pool_total_conns, pool_acquired_conns, pool_idle_conns, grace_cache_entries,
+   auth_allowed, auth_denied, auth_errors, acl_allowed, acl_denied, acl_errors, stats)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)`
+
+var (
+	statsTableInterval time.Duration // 0 表示不写入
+	statsTableStop     chan struct{}
+	statsTableDone     chan struct{}
+)
+
+// statsInstance 标识写入行的 broker：优先 config_instance，否则主机名。
+func statsInstance() string {
+	if configInstance != "" {
+		return configInstance
+	}
+	host, _ := os.Hostname()
+	return host
+}
+
+func statsTableArgs(instance string, stats map[string]int64) []any {
+	args := []any{instance}
+	for _, k := range []string{
+		"db_pool_total_conns", "db_pool_acquired_conns", "db_pool_idle_conns", "grace_cache_entries",
+		"auth_allowed", "auth_denied", "auth_errors", "acl_allowed", "acl_denied", "acl_errors",
+	} {
+		args = append(args, stats[k])
+	}
+	return append(args, stats)
+}
+
+func writeStatsRow(instance string) error {
+	if databaseDown() {
+		return nil
+	}
+	p := primary.currentPool()
+	if p == nil {
+		return nil
+	}
+	ctx, cancel := ctxWithTimeout(context.Background(), primary.timeout.get())
+	defer cancel()
+	args := statsTableArgs(instance, statsMap())
+	return withRetry(ctx, func() error {
+		_, err := p.Exec(ctx, statsTableInsert, args...)
+		return err
+	})
+}
+
+// partitionHint 在写入因缺少分区失败时（migrate partition native 没有按时执行）提示如何修复。
+func partitionHint(err error) string {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23514" && strings.HasPrefix(pgErr.Message, "no partition of relation") {
+		return " (no partition covers the current time; run migrate partition native)"
+	}
+	return ""
+}
+
+func startStatsTable() {
+	if statsTableInterval <= 0 {
+		return
+	}
+	instance := statsInstance()
+	stop, done := make(chan struct{}), make(chan struct{})
+	statsTableStop, statsTableDone = stop, done
+	go func() {
+		defer close(done)
+		t := time.NewTicker(statsTableInterval)
+		defer t.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-t.C:
+				if !featureFlags.on(flagStatsTable) {
+					continue
+				}
+				if err := writeStatsRow(instance); err != nil {
+					mosqLogDeduped(logWarning, "auth-plugin: cannot write mosq_pg_stats: %v%s", err, partitionHint(err))
+				}
+			}
+		}
+	}()
+}
+
+func stopStatsTable() {
+	if statsTableStop == nil {
+		return
+	}
+	close(statsTableStop)
+	<-statsTableDone
+	statsTableStop, statsTableDone = nil, nil
+}
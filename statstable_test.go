@@ -0,0 +1,51 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+func TestStatsTableArgs(t *testing.T) {
+	t.Parallel()
+	stats := map[string]int64{"db_pool_total_conns": 4, "db_pool_idle_conns": 3, "auth_allowed": 10, "acl_errors": 2}
+	args := statsTableArgs("broker-1", stats)
+	if len(args) != 12 {
+		t.Fatalf("got %d args, want 12 to match statsTableInsert", len(args))
+	}
+	if args[0] != "broker-1" || args[1] != int64(4) || args[3] != int64(3) || args[5] != int64(10) || args[10] != int64(2) {
+		t.Fatalf("args = %v", args)
+	}
+	if args[2] != int64(0) {
+		t.Fatalf("missing stats should be written as 0, got %v", args[2])
+	}
+}
+
+func TestStatsInstance(t *testing.T) {
+	old := configInstance
+	t.Cleanup(func() { configInstance = old })
+
+	configInstance = "edge-7"
+	if got := statsInstance(); got != "edge-7" {
+		t.Fatalf("statsInstance = %q, want config_instance", got)
+	}
+	configInstance = ""
+	if statsInstance() == "" {
+		t.Fatal("statsInstance should fall back to the hostname")
+	}
+}
+
+func TestPartitionHint(t *testing.T) {
+	t.Parallel()
+	missing := fmt.Errorf("insert: %w", &pgconn.PgError{Code: "23514", Message: `no partition of relation "mosq_pg_stats" found for row`})
+	if partitionHint(missing) == "" {
+		t.Error("missing partition should get a hint")
+	}
+	for _, err := range []error{errors.New("boom"), &pgconn.PgError{Code: "23514", Message: "new row violates check constraint"}} {
+		if h := partitionHint(err); h != "" {
+			t.Errorf("partitionHint(%v) = %q", err, h)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// getStatus 控制命令：一次返回数据库健康、连接池、缓存大小、选项值（密钥已遮蔽）、
+// 运行时长与计数器，便于通过 MQTT 本身做脚本化健康检查。
+
+var (
+	pluginStarted time.Time
+
+	// configuredOptions 记录成功应用过的选项原始值（plugin_opt_*、mosq_pg_config 与 setConfig）。
+	configuredOptions = map[string]string{}
+
+	// optionsMu 保护 configuredOptions 与 listenerOverrides：写入只发生在 broker 线程上，
+	// 管理 API 的协程会并发读取状态。
+	optionsMu sync.RWMutex
+)
+
+// secretOptions 的值在状态输出中整体遮蔽；pg_dsn、mysql_dsn 与 redis_url 只遮蔽其中的密码。
+var secretOptions = map[string]bool{
+	"vault_token":               true,
+	"pg_password":               true, // pg_password_file 的内容，或 compat 下的 pg_password
+	"redact_salt":               true,
+	"alert_webhook_url":         true, // Slack 等 webhook 的 URL 本身就是凭据
+	"activation_webhook_url":    true,
+	"activation_webhook_secret": true,
+	"pyroscope_url":             true, // 可能带 basic auth
+	"kafka_password":            true,
+	"kafka_schema_registry":     true, // 可能带 basic auth
+}
+
+var kvPasswordRe = regexp.MustCompile(`(?i)(password\s*=\s*)('[^']*'|\S+)`)
+
+func redactOptionValue(k, v string) string {
+	switch {
+	case v == "":
+		return v
+	case secretOptions[k]:
+		return "xxxxx"
+	case k == "pg_dsn":
+		if !strings.Contains(v, "://") {
+			return kvPasswordRe.ReplaceAllString(v, "${1}xxxxx")
+		}
+		return safeDSN(v)
+	case k == "mysql_dsn":
+		return safeMySQLDSN(v)
+	case k == "redis_url":
+		return safeRedisURL(v)
+	}
+	return v
+}
+
+// statusOptions 合并已配置的选项与可调选项的当前值。
+func statusOptions() map[string]string {
+	optionsMu.RLock()
+	out := make(map[string]string, len(configuredOptions)+len(tunableOptions))
+	for k, v := range configuredOptions {
+		out[k] = v
+	}
+	optionsMu.RUnlock()
+	for k, v := range effectiveConfig() {
+		out[k] = v
+	}
+	if dsn, _ := pgCredentials(); dsn != "" {
+		out["pg_dsn"] = dsn // setDSN 或 pg_dsn_file 轮换后的当前值
+	}
+	for k, v := range out {
+		out[k] = redactOptionValue(k, v)
+	}
+	return out
+}
+
+func pluginStatus() map[string]any {
+	db := map[string]any{
+		"driver": dbDriver,
+		"health": health.current().String(),
+		"up":     dbHealthy.Load(),
+	}
+	if len(backendChain) > 0 {
+		db["backends"] = formatBackends(backendChain)
+	}
+	p := primary.currentPool()
+	if p != nil {
+		st := p.Stat()
+		db["schema_version"] = primary.schemaVersion.Load()
+		db["pool"] = map[string]int64{
+			"max_conns":      int64(st.MaxConns()),
+			"total_conns":    int64(st.TotalConns()),
+			"acquired_conns": int64(st.AcquiredConns()),
+			"idle_conns":     int64(st.IdleConns()),
+		}
+	}
+	if st, ok := mysqlPoolStats(); ok {
+		key := "pool"
+		if p != nil {
+			key = "mysql_pool" // 链上同时有 PostgreSQL
+		}
+		db[key] = map[string]int64{
+			"max_conns":      int64(st.MaxOpenConnections),
+			"total_conns":    int64(st.OpenConnections),
+			"acquired_conns": int64(st.InUse),
+			"idle_conns":     int64(st.Idle),
+		}
+	}
+	return map[string]any{
+		"build":          currentBuild(),
+		"started_at":     pluginStarted.UTC().Format(time.RFC3339),
+		"uptime_seconds": int64(time.Since(pluginStarted) / time.Second),
+		"db":             db,
+		"caches": map[string]int{
+			"grace_entries":  recentAuth.size(),
+			"connection_ids": connIDs.size(),
+		},
+		"flags":      featureFlags.snapshot(),
+		"go_runtime": goRuntimeStatus(),
+		"options":    statusOptions(),
+		"stats":      statsMap(),
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import "testing"
+
+func TestRedactOptionValue(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		key, in, want string
+	}{
+		{"vault_token", "s.abcdef", "xxxxx"},
+		{"alert_webhook_url", "https://hooks.slack.com/services/T/B/x", "xxxxx"},
+		{"redact_salt", "", ""},
+		{"pg_dsn", "postgres://mosq:secret@db:5432/mqtt", "postgres://mosq:xxxxx@db:5432/mqtt"},
+		{"pg_dsn", "host=db user=mosq password=secret dbname=mqtt", "host=db user=mosq password=xxxxx dbname=mqtt"},
+		{"pg_dsn", "host=db password='se cret'", "host=db password=xxxxx"},
+		{"mysql_dsn", "mqtt:secret@tcp(db:3306)/iot", "mqtt:xxxxx@tcp(db:3306)/iot"},
+		{"redis_url", "redis://:secret@cache:6379/0", "redis://:xxxxx@cache:6379/0"},
+		{"timeout_ms", "1500", "1500"},
+	}
+	for _, tc := range tests {
+		if got := redactOptionValue(tc.key, tc.in); got != tc.want {
+			t.Fatalf("redactOptionValue(%s, %q) = %q, want %q", tc.key, tc.in, got, tc.want)
+		}
+	}
+}
+
+func TestStatusOptions(t *testing.T) {
+	oldOpts, oldDSN, oldToken := configuredOptions, primary.pgDSN, vaultToken
+	t.Cleanup(func() { configuredOptions, primary.pgDSN, vaultToken = oldOpts, oldDSN, oldToken })
+
+	configuredOptions = map[string]string{}
+	if err := applyOption(primary, "vault_token", "s.topsecret"); err != nil {
+		t.Fatal(err)
+	}
+	primary.pgDSN = "postgres://mosq:pw@db/mqtt"
+
+	opts := statusOptions()
+	if opts["vault_token"] != "xxxxx" || opts["pg_dsn"] != "postgres://mosq:xxxxx@db/mqtt" {
+		t.Fatalf("secrets not redacted: %v", opts)
+	}
+	if _, ok := opts["timeout_ms"]; !ok {
+		t.Fatal("tunable options should be included")
+	}
+}
+
+// 管理 API 在自己的协程里读取状态，与 broker 线程上的写入并发（go test -race 可检测）。
+func TestStatusOptionsConcurrentWrites(t *testing.T) {
+	oldOpts, oldOverrides, oldPrefix := configuredOptions, listenerOverrides, redisPrefix
+	t.Cleanup(func() { configuredOptions, listenerOverrides, redisPrefix = oldOpts, oldOverrides, oldPrefix })
+	configuredOptions, listenerOverrides = map[string]string{}, map[int]map[string]string{}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			statusOptions()
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		if err := applyOption(primary, "redis_prefix", "mosq:"); err != nil {
+			t.Fatal(err)
+		}
+		if err := applyOption(primary, "listener_8883.fail_open_acl", "true"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	<-done
+	if opts := statusOptions(); opts["redis_prefix"] != "mosq:" || opts["listener_8883.fail_open_acl"] != "true" {
+		t.Fatalf("statusOptions = %v", opts)
+	}
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// store 是回调需要的三类查询。PostgreSQL 与 MySQL/MariaDB 各有一个实现，
+// 表结构与查询语义相同（见 scripts/init_db.sql 与 scripts/init_db_mysql.sql），
+// 由 db_driver 选择；连接池的建立、轮换等仍按驱动各自处理。
+type store interface {
+	// user 返回账号的密码哈希；账号不存在时 found 为 false。
+	user(ctx context.Context, username string) (d deviceRow, found bool, err error)
+	// bound 判断 client_bindings 中是否有该用户名与客户端 ID 的绑定。
+	bound(ctx context.Context, username, clientID string) (bool, error)
+	// rules 返回该用户与 '*' 的全部 ACL 规则。
+	rules(ctx context.Context, username string) ([]aclRule, error)
+	ping(ctx context.Context) error
+}
+
+type deviceRow struct {
+	hash, salt string
+	enabled    bool
+}
+
+const (
+	driverPostgres = "postgres"
+	driverMySQL    = "mysql"
+	driverRedis    = "redis"
+	driverGRPC     = "grpc"
+)
+
+var dbDriver = driverPostgres
+
+const (
+	authQuery = "SELECT password_hash, salt, enabled FROM iot_devices WHERE username=$1"
+	bindQuery = "SELECT 1 FROM client_bindings WHERE username=$1 AND client_id=$2"
+)
+
+func parseDBDriver(v string) (string, bool) {
+	switch v = strings.ToLower(strings.TrimSpace(v)); v {
+	case driverPostgres, driverMySQL, driverRedis, driverGRPC:
+		return v, true
+	case "postgresql", "pg":
+		return driverPostgres, true
+	case "mariadb":
+		return driverMySQL, true
+	}
+	return "", false
+}
+
+// openStore 返回实例 in 上名为 name 的存储后端，必要时建立连接池；redis_cache_ttl 开启时在外面包一层缓存。
+// 兼容模式与缓存是 primary 的配置，其他实例直接查询自己的 PostgreSQL。
+func openStore(ctx context.Context, in *instance, name string) (store, error) {
+	var st store
+	switch name {
+	case driverRedis:
+		c, err := ensureRedis(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return redisStore{c, redisPrefix}, nil
+	case driverMySQL:
+		db, err := ensureMySQL(ctx)
+		if err != nil {
+			return nil, err
+		}
+		st = mysqlStore{db}
+	default:
+		p, err := in.ensurePool(ctx)
+		if err != nil {
+			return nil, err
+		}
+		st = pgStore{p, int(in.schemaVersion.Load())}
+		if in != primary {
+			return st, nil
+		}
+		if compatMode == compatGoAuth {
+			st = goAuthStore{p}
+		}
+	}
+	if redisCacheTTL.get() <= 0 {
+		return st, nil
+	}
+	c, err := ensureRedis(ctx)
+	if err != nil {
+		// 缓存不可用时直接查数据库
+		cacheErrors.Add(1)
+		mosqLogDeduped(logWarning, "auth-plugin: redis cache unavailable: "+err.Error())
+		return st, nil
+	}
+	return cachedStore{st, c, redisPrefix, redisCacheTTL.get()}, nil
+}
+
+type pgStore struct {
+	p      *pgxpool.Pool
+	schema int // 库的版本，决定查询写法
+}
+
+// openPGStore 返回直接访问 PostgreSQL 的 pgStore（不经 Redis 缓存），供需要写表的功能使用。
+func openPGStore(ctx context.Context) (pgStore, error) {
+	if compatMode == compatGoAuth {
+		return pgStore{}, errors.New("not supported with compat mosquitto-go-auth")
+	}
+	p, err := primary.ensurePool(ctx)
+	if err != nil {
+		return pgStore{}, err
+	}
+	return pgStore{p, int(primary.schemaVersion.Load())}, nil
+}
+
+func (s pgStore) user(ctx context.Context, username string) (deviceRow, bool, error) {
+	var d deviceRow
+	var enabled int16
+	q, _, _ := pgQueries()
+	q = authQueryFor(q, s.schema)
+	args, ok := shardArgs(username, username)
+	if !ok {
+		return d, false, nil
+	}
+	err := withRetry(ctx, func() error {
+		return s.p.QueryRow(ctx, q, args...).Scan(&d.hash, &d.salt, &enabled)
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return d, false, nil
+	}
+	d.enabled = enabled != 0
+	return d, err == nil, err
+}
+
+func (s pgStore) bound(ctx context.Context, username, clientID string) (bool, error) {
+	var ok int
+	_, q, _ := pgQueries()
+	args, sharded := shardArgs(username, username, clientID)
+	if !sharded {
+		return false, nil
+	}
+	err := withRetry(ctx, func() error {
+		return s.p.QueryRow(ctx, q, args...).Scan(&ok)
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (s pgStore) rules(ctx context.Context, username string) ([]aclRule, error) {
+	_, _, q := pgQueries()
+	args, ok := shardArgs(username, username)
+	if !ok {
+		return nil, nil
+	}
+	var rules []aclRule
+	err := withRetry(ctx, func() error {
+		rules = rules[:0]
+		rows, err := s.p.Query(ctx, q, args...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var r aclRule
+			if err := rows.Scan(&r.Pattern, &r.Acc); err != nil {
+				return err
+			}
+			rules = append(rules, r)
+		}
+		return rows.Err()
+	})
+	return rules, err
+}
+
+func (s pgStore) ping(ctx context.Context) error { return s.p.Ping(ctx) }
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// 认证失败的 top-K 统计（Space-Saving 算法）：按用户名和来源地址各保留 failure_topk 个计数器，
+// 内存与基数无关；被挤出的键把最小计数带给新键，error 是计数可能高估的上限。
+
+var failureTopK = 50
+
+type topKEntry struct {
+	Key   string `json:"key"`
+	Count int64  `json:"count"`
+	Error int64  `json:"error,omitempty"`
+}
+
+type topK struct {
+	mu      sync.Mutex
+	entries map[string]*topKEntry
+}
+
+var (
+	failuresByUser = newTopK()
+	failuresByAddr = newTopK()
+)
+
+func newTopK() *topK {
+	return &topK{entries: map[string]*topKEntry{}}
+}
+
+func (t *topK) add(key string, capacity int) {
+	if capacity <= 0 {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if e, ok := t.entries[key]; ok {
+		e.Count++
+		return
+	}
+	if len(t.entries) < capacity {
+		t.entries[key] = &topKEntry{Key: key, Count: 1}
+		return
+	}
+	var min *topKEntry
+	for _, e := range t.entries {
+		if min == nil || e.Count < min.Count {
+			min = e
+		}
+	}
+	delete(t.entries, min.Key)
+	t.entries[key] = &topKEntry{Key: key, Count: min.Count + 1, Error: min.Count}
+}
+
+// top 返回按计数降序的前 n 项（n<=0 表示全部）。
+func (t *topK) top(n int) []topKEntry {
+	t.mu.Lock()
+	out := make([]topKEntry, 0, len(t.entries))
+	for _, e := range t.entries {
+		out = append(out, *e)
+	}
+	t.mu.Unlock()
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Count != out[j].Count {
+			return out[i].Count > out[j].Count
+		}
+		return out[i].Key < out[j].Key
+	})
+	if n > 0 && len(out) > n {
+		out = out[:n]
+	}
+	return out
+}
+
+func (t *topK) reset() {
+	t.mu.Lock()
+	t.entries = map[string]*topKEntry{}
+	t.mu.Unlock()
+}
+
+// recordAuthFailure 记录一次被拒绝的认证。
+func recordAuthFailure(username, address string) {
+	if username == "" {
+		username = "<anonymous>"
+	}
+	failuresByUser.add(username, failureTopK)
+	if address != "" {
+		failuresByAddr.add(address, failureTopK)
+	}
+}
+
+func parseTopK(v string) (int, error) {
+	n, err := strconv.Atoi(strings.TrimSpace(v))
+	if err != nil || n < 0 || n > 10000 {
+		return 0, fmt.Errorf("want 0-10000, keeping existing value %d", failureTopK)
+	}
+	return n, nil
+}
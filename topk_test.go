@@ -0,0 +1,36 @@
+package main
+
+import "testing"
+
+func TestTopK(t *testing.T) {
+	t.Parallel()
+	k := newTopK()
+	for i := 0; i < 5; i++ {
+		k.add("storm", 3)
+	}
+	k.add("a", 3)
+	k.add("a", 3)
+	k.add("b", 3)
+	// 容量已满：c 挤掉计数最小的 b，继承其计数
+	k.add("c", 3)
+
+	got := k.top(0)
+	if len(got) != 3 {
+		t.Fatalf("top = %+v, want 3 entries", got)
+	}
+	if got[0].Key != "storm" || got[0].Count != 5 || got[0].Error != 0 {
+		t.Fatalf("top[0] = %+v", got[0])
+	}
+	if got[1].Key != "a" || got[2].Key != "c" || got[2].Count != 2 || got[2].Error != 1 {
+		t.Fatalf("top = %+v", got)
+	}
+	if len(k.top(1)) != 1 {
+		t.Fatal("top(1) should return a single entry")
+	}
+
+	k.add("x", 0)
+	k.reset()
+	if len(k.top(0)) != 0 {
+		t.Fatal("reset should clear all entries")
+	}
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// totp_users：高权限账号（能读所有主题的超级用户、运维看板）除密码外还要求 TOTP 第二因素。
+// 这些账号登录时在密码后面直接拼上 6 位验证码（password123456），插件拆出验证码，
+// 密码部分照常校验，验证码按 RFC 6238（HMAC-SHA1、30 秒、6 位）用 iot_devices.totp_secret
+// （base32，与验证器 App 扫描的 otpauth:// 中的 secret 相同）校验。
+//
+//   - totp_users 中的账号没有设置 totp_secret 时拒绝登录，不会退化成只校验密码；
+//   - totp_skew 允许前后各若干个时间步，容忍设备时钟偏差；
+//   - 同一账号用过的时间步不能再用（本 broker 内），截获的密码+验证码无法在有效期内重放；
+//   - 只支持 PostgreSQL 与 MySQL 后端（totp_secret 列）；宽限缓存与兜底文件不保存验证码，
+//     数据库不可用时这些账号无法登录。
+
+const (
+	totpDigits = 6
+	totpPeriod = 30 * time.Second
+)
+
+var (
+	totpUsers string
+	totpSkew  = 1
+
+	totpUsed = &totpReplay{last: map[string]int64{}}
+)
+
+const (
+	totpSecretQuery      = "SELECT COALESCE(totp_secret, '') FROM iot_devices WHERE username=$1"
+	mysqlTOTPSecretQuery = "SELECT COALESCE(totp_secret, '') FROM iot_devices WHERE username = ?"
+)
+
+// totpStore 由能读取 totp_secret 列的后端实现。
+type totpStore interface {
+	totpSecret(ctx context.Context, username string) (string, error)
+}
+
+func (s pgStore) totpSecret(ctx context.Context, username string) (string, error) {
+	q := totpSecretQuery
+	if shardColumn != "" {
+		q += " AND " + pgx.Identifier{shardColumn}.Sanitize() + "=$2"
+	}
+	args, ok := shardArgs(username, username)
+	if !ok {
+		return "", nil
+	}
+	var secret string
+	err := withRetry(ctx, func() error {
+		return s.p.QueryRow(ctx, q, args...).Scan(&secret)
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", nil
+	}
+	return secret, err
+}
+
+func (s mysqlStore) totpSecret(ctx context.Context, username string) (string, error) {
+	var secret string
+	err := s.db.QueryRowContext(ctx, mysqlTOTPSecretQuery, username).Scan(&secret)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	return secret, err
+}
+
+// totpSecret 不经过 Redis 缓存：密钥不应出现在缓存里。
+func (s cachedStore) totpSecret(ctx context.Context, username string) (string, error) {
+	if ts, ok := s.inner.(totpStore); ok {
+		return ts.totpSecret(ctx, username)
+	}
+	return "", errTOTPUnsupported
+}
+
+var errTOTPUnsupported = errors.New("totp_users needs a postgres or mysql backend (totp_secret column)")
+
+// totpRequired 判断账号是否在 totp_users 中；条目以 * 结尾时按前缀匹配。
+func totpRequired(username string) bool {
+	for _, u := range strings.Split(totpUsers, ",") {
+		u = strings.TrimSpace(u)
+		if u == "" {
+			continue
+		}
+		if prefix, ok := strings.CutSuffix(u, "*"); ok && strings.HasPrefix(username, prefix) || u == username {
+			return true
+		}
+	}
+	return false
+}
+
+// splitTOTP 拆出密码末尾的验证码；密码部分不能为空。
+func splitTOTP(password string) (string, string, bool) {
+	if len(password) <= totpDigits {
+		return "", "", false
+	}
+	pw, code := password[:len(password)-totpDigits], password[len(password)-totpDigits:]
+	if strings.Trim(code, "0123456789") != "" {
+		return "", "", false
+	}
+	return pw, code, true
+}
+
+func decodeTOTPSecret(secret string) ([]byte, error) {
+	s := strings.ToUpper(strings.NewReplacer(" ", "", "-", "").Replace(secret))
+	return base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(strings.TrimRight(s, "="))
+}
+
+// totpCode 计算某个时间步的验证码（RFC 4226 的动态截断）。
+func totpCode(key []byte, step int64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(step))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+	off := sum[len(sum)-1] & 0x0f
+	v := binary.BigEndian.Uint32(sum[off:off+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, v%1000000)
+}
+
+// checkTOTP 返回与验证码匹配的时间步；不匹配时 ok 为 false。
+func checkTOTP(secret, code string, now time.Time, skew int) (step int64, ok bool) {
+	key, err := decodeTOTPSecret(secret)
+	if err != nil || len(key) == 0 {
+		return 0, false
+	}
+	cur := now.Unix() / int64(totpPeriod/time.Second)
+	for d := -int64(skew); d <= int64(skew); d++ {
+		if subtle.ConstantTimeCompare([]byte(totpCode(key, cur+d)), []byte(code)) == 1 {
+			return cur + d, true
+		}
+	}
+	return 0, false
+}
+
+// totpReplay 记录每个账号最近一次用过的时间步。
+type totpReplay struct {
+	mu   sync.Mutex
+	last map[string]int64
+}
+
+// use 在时间步比上次新时记下并返回 true。
+func (r *totpReplay) use(username string, step int64) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if last, ok := r.last[username]; ok && step <= last {
+		return false
+	}
+	r.last[username] = step
+	return true
+}
+
+// verifyTOTP 校验 totp_users 账号的验证码；返回的 reason 用于日志，ok 为 false 时拒绝登录。
+func verifyTOTP(ctx context.Context, st store, username, code string) (ok bool, reason string, err error) {
+	ts, supported := st.(totpStore)
+	if !supported {
+		return false, "", errTOTPUnsupported
+	}
+	secret, err := ts.totpSecret(ctx, username)
+	if err != nil {
+		return false, "", err
+	}
+	if secret == "" {
+		return false, "no totp_secret set", nil
+	}
+	step, ok := checkTOTP(secret, code, time.Now(), totpSkew)
+	if !ok {
+		return false, "wrong TOTP code", nil
+	}
+	if !totpUsed.use(username, step) {
+		return false, "TOTP code already used", nil
+	}
+	return true, "", nil
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"encoding/base32"
+	"testing"
+	"time"
+)
+
+// RFC 6238 附录 B 的 SHA1 测试向量（取低 6 位）。
+func TestCheckTOTP(t *testing.T) {
+	t.Parallel()
+	secret := base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+	vectors := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, v := range vectors {
+		step, ok := checkTOTP(secret, v.code, time.Unix(v.unix, 0), 0)
+		if !ok || step != v.unix/30 {
+			t.Errorf("checkTOTP(%d, %s) = %d, %v", v.unix, v.code, step, ok)
+		}
+	}
+
+	// 小写、空格与填充都可以
+	if _, ok := checkTOTP("gezd gnbv gy3t qojq gezd gnbv gy3t qojq====", "287082", time.Unix(59, 0), 0); !ok {
+		t.Error("secret formatting should not matter")
+	}
+	// 上一个时间步的验证码只在 skew 允许时通过
+	now := time.Unix(59+30, 0)
+	if _, ok := checkTOTP(secret, "287082", now, 0); ok {
+		t.Error("skew 0 accepted the previous step")
+	}
+	if _, ok := checkTOTP(secret, "287082", now, 1); !ok {
+		t.Error("skew 1 refused the previous step")
+	}
+	if _, ok := checkTOTP("not base32!", "287082", time.Unix(59, 0), 1); ok {
+		t.Error("an invalid secret should never match")
+	}
+}
+
+func TestTOTPRequired(t *testing.T) {
+	old := totpUsers
+	t.Cleanup(func() { totpUsers = old })
+	totpUsers = "dashboard, ops-*"
+	for user, want := range map[string]bool{
+		"dashboard":  true,
+		"ops-alice":  true,
+		"ops-":       true,
+		"dashboard2": false,
+		"sensor-1":   false,
+	} {
+		if got := totpRequired(user); got != want {
+			t.Errorf("totpRequired(%q) = %v, want %v", user, got, want)
+		}
+	}
+	totpUsers = ""
+	if totpRequired("dashboard") {
+		t.Error("empty totp_users should not require TOTP")
+	}
+}
+
+func TestSplitTOTP(t *testing.T) {
+	t.Parallel()
+	if pw, code, ok := splitTOTP("s3cret123456"); !ok || pw != "s3cret" || code != "123456" {
+		t.Fatalf("splitTOTP = %q, %q, %v", pw, code, ok)
+	}
+	for _, bad := range []string{"123456", "short", "s3cret12345x", ""} {
+		if _, _, ok := splitTOTP(bad); ok {
+			t.Errorf("splitTOTP(%q) should fail", bad)
+		}
+	}
+}
+
+func TestTOTPReplay(t *testing.T) {
+	t.Parallel()
+	r := &totpReplay{last: map[string]int64{}}
+	if !r.use("dashboard", 10) || r.use("dashboard", 10) || r.use("dashboard", 9) {
+		t.Fatal("a step should be accepted once and older steps refused")
+	}
+	if !r.use("dashboard", 11) || !r.use("ops", 10) {
+		t.Fatal("newer steps and other users should be accepted")
+	}
+}
+
+// fakeTOTPStore 只实现 totpSecret，其他 store 方法不会被调用。
+type fakeTOTPStore struct {
+	store
+	secret string
+}
+
+func (s fakeTOTPStore) totpSecret(context.Context, string) (string, error) { return s.secret, nil }
+
+func TestVerifyTOTP(t *testing.T) {
+	ctx := context.Background()
+	secret := base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+	key, _ := decodeTOTPSecret(secret)
+	code := totpCode(key, time.Now().Unix()/30)
+
+	if _, _, err := verifyTOTP(ctx, struct{ store }{}, "dashboard", code); err == nil {
+		t.Fatal("a store without totp_secret should be an error")
+	}
+	if ok, reason, _ := verifyTOTP(ctx, fakeTOTPStore{}, "dashboard", code); ok || reason != "no totp_secret set" {
+		t.Fatalf("missing secret: %v %q", ok, reason)
+	}
+	st := fakeTOTPStore{secret: secret}
+	if ok, reason, err := verifyTOTP(ctx, st, "totp-verify-test", code); !ok || err != nil {
+		t.Fatalf("valid code refused: %q %v", reason, err)
+	}
+	if ok, reason, _ := verifyTOTP(ctx, st, "totp-verify-test", code); ok || reason != "TOTP code already used" {
+		t.Fatalf("replayed code: %v %q", ok, reason)
+	}
+}
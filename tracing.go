@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// OpenTelemetry：设置 otel_endpoint 后为 basic_auth / acl_check 生成 span，
+// 其下的 SQL 由 pgx tracer（sqlTracer）生成子 span，通过 OTLP/HTTP 导出。
+// 未启用时使用 noop tracer，回调路径上没有额外开销。
+
+var (
+	otelEndpoint    string // 如 http://otel-collector:4318
+	otelServiceName        = "mosquitto-auth-plugin"
+	otelSampleRatio        = 1.0
+
+	tracer         trace.Tracer = noop.NewTracerProvider().Tracer("")
+	noopTracer     trace.Tracer = noop.NewTracerProvider().Tracer("")
+	tracerProvider *sdktrace.TracerProvider
+)
+
+func parseSampleRatio(v string) (float64, error) {
+	f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+	if err != nil || f < 0 || f > 1 {
+		return 0, fmt.Errorf("want 0-1, keeping existing value %g", otelSampleRatio)
+	}
+	return f, nil
+}
+
+func startTracing() error {
+	if otelEndpoint == "" {
+		return nil
+	}
+	exp, err := otlptracehttp.New(context.Background(), otlptracehttp.WithEndpointURL(otelEndpoint))
+	if err != nil {
+		return fmt.Errorf("otel exporter: %w", err)
+	}
+	tracerProvider = sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exp),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(otelSampleRatio))),
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", otelServiceName))),
+	)
+	tracer = tracerProvider.Tracer("auth-plugin")
+	return nil
+}
+
+// stopTracing 刷出缓冲的 span 后关闭导出器。
+func stopTracing() {
+	if tracerProvider == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	tracerProvider.Shutdown(ctx)
+	tracerProvider = nil
+	tracer = noop.NewTracerProvider().Tracer("")
+}
+
+func startSpan(name, connID, username, clientID, topic string) (context.Context, trace.Span) {
+	attrs := []attribute.KeyValue{
+		attribute.String("mqtt.connection_id", connID),
+		attribute.String("mqtt.username", redactID(username)),
+		attribute.String("mqtt.client_id", redactID(clientID)),
+	}
+	if topic != "" {
+		attrs = append(attrs, attribute.String("mqtt.topic", topic))
+	}
+	if !featureFlags.on(flagTracing) {
+		return noopTracer.Start(context.Background(), name)
+	}
+	return tracer.Start(context.Background(), name, trace.WithAttributes(attrs...))
+}
+
+func endSpan(span trace.Span, result string, d decision, err error) {
+	span.SetAttributes(attribute.String("auth.result", result), attribute.String("auth.backend", decisionBackend(result, d, err)))
+	if d.reason != "" {
+		span.SetAttributes(attribute.String("auth.reason", d.reason))
+	}
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
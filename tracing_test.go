@@ -0,0 +1,50 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestParseSampleRatio(t *testing.T) {
+	t.Parallel()
+	if f, err := parseSampleRatio(" 0.25 "); err != nil || f != 0.25 {
+		t.Fatalf("parseSampleRatio = (%v, %v)", f, err)
+	}
+	for _, v := range []string{"-0.1", "1.5", "half"} {
+		if _, err := parseSampleRatio(v); err == nil {
+			t.Fatalf("parseSampleRatio(%q) should fail", v)
+		}
+	}
+}
+
+func TestAuthSpan(t *testing.T) {
+	oldTracer, oldProvider := tracer, tracerProvider
+	t.Cleanup(func() { tracer, tracerProvider = oldTracer, oldProvider })
+
+	rec := tracetest.NewSpanRecorder()
+	tracerProvider = sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec))
+	tracer = tracerProvider.Tracer("test")
+
+	_, span := startSpan("mosquitto.acl_check", "0123456789abcdef", "alice", "c1", "devices/alice/up")
+	endSpan(span, resultError, decision{}, errors.New("timeout"))
+
+	spans := rec.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("got %d spans, want 1", len(spans))
+	}
+	s := spans[0]
+	if s.Name() != "mosquitto.acl_check" || s.Status().Code != codes.Error {
+		t.Fatalf("span %s status %v", s.Name(), s.Status())
+	}
+	attrs := map[string]string{}
+	for _, kv := range s.Attributes() {
+		attrs[string(kv.Key)] = kv.Value.AsString()
+	}
+	if attrs["mqtt.topic"] != "devices/alice/up" || attrs["mqtt.connection_id"] != "0123456789abcdef" || attrs["auth.result"] != resultError {
+		t.Fatalf("span attributes = %v", attrs)
+	}
+}
@@ -0,0 +1,360 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Vault 动态数据库凭据：init 时从 database secrets engine 申请短期账号，
+// 后台在租约到期前续租；无法续租（到达 max_ttl 或续租失败）时申请新账号、
+// 新建连接池并原子替换，旧池排空后撤销旧租约。MQTT 客户端不受影响。
+
+const vaultHTTPTimeout = 10 * time.Second
+
+// vaultRetryInterval 是申请或轮换凭据失败后的重试间隔；测试中会调小。
+var vaultRetryInterval = 10 * time.Second
+
+var (
+	vaultAddr      string
+	vaultToken     string
+	vaultTokenFile string
+	vaultNamespace string
+	vaultCAFile    string
+	vaultDBMount   = "database"
+	vaultDBRole    string
+
+	vaultMu    sync.Mutex
+	vaultCreds *vaultCredentials
+)
+
+type vaultLease struct {
+	id        string
+	duration  time.Duration
+	renewable bool
+	username  string
+	password  string
+}
+
+type vaultCredentials struct {
+	addr      string
+	token     string
+	tokenFile string
+	namespace string
+	mount     string
+	role      string
+	client    *http.Client
+
+	mu    sync.Mutex
+	lease *vaultLease
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func newVaultCredentials() (*vaultCredentials, error) {
+	addr := strings.TrimRight(vaultAddr, "/")
+	if addr == "" {
+		return nil, errors.New("vault_addr (or VAULT_ADDR) must be set when vault_db_role is used")
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if vaultCAFile != "" {
+		pem, err := os.ReadFile(vaultCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("read vault_ca_file: %w", err)
+		}
+		roots := x509.NewCertPool()
+		if !roots.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("vault_ca_file %s contains no certificates", vaultCAFile)
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: roots, MinVersion: tls.VersionTLS12}
+	}
+	return &vaultCredentials{
+		addr:      addr,
+		token:     vaultToken,
+		tokenFile: vaultTokenFile,
+		namespace: vaultNamespace,
+		mount:     strings.Trim(vaultDBMount, "/"),
+		role:      vaultDBRole,
+		client:    &http.Client{Timeout: vaultHTTPTimeout, Transport: transport},
+	}, nil
+}
+
+// startVaultCredentials 在 init 阶段调用：尽量先取到一份凭据，再启动续租协程。
+// Vault 暂不可用时不阻塞加载，由后台协程与 BeforeConnect 重试。
+func startVaultCredentials() error {
+	v, err := newVaultCredentials()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), vaultHTTPTimeout)
+	if _, err := v.current(ctx); err != nil {
+		mosqLog(logWarning, "auth-plugin: initial vault credential fetch failed: %v (will retry)", err)
+	}
+	cancel()
+
+	loopCtx, loopCancel := context.WithCancel(context.Background())
+	v.cancel = loopCancel
+	v.done = make(chan struct{})
+	go v.run(loopCtx)
+
+	vaultMu.Lock()
+	vaultCreds = v
+	vaultMu.Unlock()
+	return nil
+}
+
+// stopVaultCredentials 停止续租并撤销当前租约；应在连接池关闭之后调用。
+func stopVaultCredentials() {
+	vaultMu.Lock()
+	v := vaultCreds
+	vaultCreds = nil
+	vaultMu.Unlock()
+	if v == nil {
+		return
+	}
+	v.cancel()
+	<-v.done
+
+	v.mu.Lock()
+	lease := v.lease
+	v.lease = nil
+	v.mu.Unlock()
+	if lease != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), vaultHTTPTimeout)
+		defer cancel()
+		if err := v.revoke(ctx, lease.id); err != nil {
+			mosqLog(logWarning, "auth-plugin: vault lease revoke failed: %v", err)
+		}
+	}
+}
+
+// configure 让每个新连接使用当前租约中的账号密码。
+func (v *vaultCredentials) configure(cfg *pgxpool.Config) {
+	prev := cfg.BeforeConnect
+	cfg.BeforeConnect = func(ctx context.Context, conf *pgx.ConnConfig) error {
+		if prev != nil {
+			if err := prev(ctx, conf); err != nil {
+				return err
+			}
+		}
+		lease, err := v.current(ctx)
+		if err != nil {
+			return err
+		}
+		conf.User = lease.username
+		conf.Password = lease.password
+		return nil
+	}
+}
+
+// current 返回当前租约，尚无租约时同步申请。
+func (v *vaultCredentials) current(ctx context.Context) (*vaultLease, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.lease != nil {
+		return v.lease, nil
+	}
+	lease, err := v.issue(ctx)
+	if err != nil {
+		return nil, err
+	}
+	v.lease = lease
+	mosqLog(logInfo, "auth-plugin: vault issued database credentials user=%s lease_duration=%s",
+		lease.username, lease.duration)
+	return lease, nil
+}
+
+// run 在租约 2/3 处续租，续租失败或剩余时长不足时轮换凭据。
+// 轮换失败时保留旧租约（时长不变），按 vaultRetryInterval 单独重试。
+func (v *vaultCredentials) run(ctx context.Context) {
+	defer close(v.done)
+	retry := false
+	for {
+		wait := vaultRetryInterval
+		v.mu.Lock()
+		lease := v.lease
+		v.mu.Unlock()
+		if lease != nil && lease.duration > 0 && !retry {
+			wait = lease.duration * 2 / 3
+		}
+		retry = false
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+
+		if lease == nil {
+			reqCtx, cancel := context.WithTimeout(ctx, vaultHTTPTimeout)
+			_, err := v.current(reqCtx)
+			cancel()
+			if err != nil {
+				mosqLog(logWarning, "auth-plugin: vault credential fetch failed: %v", err)
+			}
+			continue
+		}
+		if lease.renewable && v.renewLease(ctx, lease) {
+			continue
+		}
+		if err := v.rotate(ctx, lease); err != nil {
+			mosqLog(logWarning, "auth-plugin: vault credential rotation failed: %v (retrying in %s)",
+				err, vaultRetryInterval)
+			v.mu.Lock()
+			// 新凭据已生效（只是重建连接池失败）时不需要重试
+			retry = v.lease == lease
+			v.mu.Unlock()
+		}
+	}
+}
+
+// renewLease 续租成功且新时长不少于原时长的一半时返回 true；
+// 时长被 max_ttl 截断时返回 false，让调用方轮换凭据。
+func (v *vaultCredentials) renewLease(ctx context.Context, lease *vaultLease) bool {
+	reqCtx, cancel := context.WithTimeout(ctx, vaultHTTPTimeout)
+	defer cancel()
+	increment := int(lease.duration / time.Second)
+	var out vaultSecret
+	if err := v.do(reqCtx, http.MethodPut, "/v1/sys/leases/renew",
+		map[string]any{"lease_id": lease.id, "increment": increment}, &out); err != nil {
+		mosqLog(logWarning, "auth-plugin: vault lease renew failed: %v", err)
+		return false
+	}
+	renewed := time.Duration(out.LeaseDuration) * time.Second
+	if renewed < lease.duration/2 {
+		mosqLog(logInfo, "auth-plugin: vault lease nearing max_ttl (%s left), rotating credentials", renewed)
+		return false
+	}
+	v.mu.Lock()
+	lease.duration = renewed
+	v.mu.Unlock()
+	return true
+}
+
+// rotate 申请新凭据并重建连接池，旧池排空后撤销旧租约。
+func (v *vaultCredentials) rotate(ctx context.Context, old *vaultLease) error {
+	reqCtx, cancel := context.WithTimeout(ctx, vaultHTTPTimeout)
+	defer cancel()
+	lease, err := v.issue(reqCtx)
+	if err != nil {
+		return err
+	}
+	v.mu.Lock()
+	v.lease = lease
+	v.mu.Unlock()
+	mosqLog(logInfo, "auth-plugin: vault rotated database credentials user=%s lease_duration=%s",
+		lease.username, lease.duration)
+
+	if primary.currentPool() != nil {
+		newPool, err := primary.buildPool(reqCtx)
+		if err != nil {
+			// 新凭据已生效，旧池中的新连接会使用它；旧租约保留到自然过期
+			return fmt.Errorf("rebuild pool with rotated credentials: %w", err)
+		}
+		closed := primary.swapPool(newPool)
+		go func() {
+			<-closed
+			revokeCtx, cancel := context.WithTimeout(context.Background(), vaultHTTPTimeout)
+			defer cancel()
+			if err := v.revoke(revokeCtx, old.id); err != nil {
+				mosqLog(logWarning, "auth-plugin: vault revoke of previous lease failed: %v", err)
+			}
+		}()
+	}
+	return nil
+}
+
+type vaultSecret struct {
+	LeaseID       string `json:"lease_id"`
+	LeaseDuration int    `json:"lease_duration"`
+	Renewable     bool   `json:"renewable"`
+	Data          struct {
+		Username string `json:"username"`
+		Password string `json:"password"`
+	} `json:"data"`
+}
+
+func (v *vaultCredentials) issue(ctx context.Context) (*vaultLease, error) {
+	var out vaultSecret
+	if err := v.do(ctx, http.MethodGet, "/v1/"+v.mount+"/creds/"+v.role, nil, &out); err != nil {
+		return nil, err
+	}
+	if out.Data.Username == "" || out.Data.Password == "" {
+		return nil, errors.New("vault: response contains no database credentials")
+	}
+	return &vaultLease{
+		id:        out.LeaseID,
+		duration:  time.Duration(out.LeaseDuration) * time.Second,
+		renewable: out.Renewable,
+		username:  out.Data.Username,
+		password:  out.Data.Password,
+	}, nil
+}
+
+func (v *vaultCredentials) revoke(ctx context.Context, leaseID string) error {
+	if leaseID == "" {
+		return nil
+	}
+	return v.do(ctx, http.MethodPut, "/v1/sys/leases/revoke", map[string]any{"lease_id": leaseID}, nil)
+}
+
+func (v *vaultCredentials) authToken() (string, error) {
+	if v.tokenFile != "" {
+		// Vault Agent 会原地更新 token 文件，每次请求都重新读取
+		raw, err := os.ReadFile(v.tokenFile)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(string(raw)), nil
+	}
+	if v.token == "" {
+		return "", errors.New("vault_token, vault_token_file or VAULT_TOKEN must be set")
+	}
+	return v.token, nil
+}
+
+func (v *vaultCredentials) do(ctx context.Context, method, path string, body, out any) error {
+	token, err := v.authToken()
+	if err != nil {
+		return err
+	}
+	var reader *bytes.Reader
+	if body != nil {
+		raw, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(raw)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, v.addr+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-Vault-Token", token)
+	req.Header.Set("X-Vault-Request", "true")
+	if v.namespace != "" {
+		req.Header.Set("X-Vault-Namespace", v.namespace)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if err := fetchJSON(v.client, req, out); err != nil {
+		return fmt.Errorf("vault %s %s: %w", method, path, err)
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestVaultCredentialsIssueAndRenew(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "root" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		switch r.URL.Path {
+		case "/v1/database/creds/mqtt":
+			w.Write([]byte(`{"lease_id":"database/creds/mqtt/abc","lease_duration":3600,"renewable":true,
+				"data":{"username":"v-mqtt-1","password":"secret"}}`))
+		case "/v1/sys/leases/renew":
+			var body struct {
+				LeaseID string `json:"lease_id"`
+			}
+			json.NewDecoder(r.Body).Decode(&body)
+			if body.LeaseID != "database/creds/mqtt/abc" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			// 模拟接近 max_ttl：续租后只剩 10 分钟
+			w.Write([]byte(`{"lease_id":"database/creds/mqtt/abc","lease_duration":600,"renewable":true}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	v := &vaultCredentials{addr: srv.URL, token: "root", mount: "database", role: "mqtt", client: srv.Client()}
+	lease, err := v.current(context.Background())
+	if err != nil {
+		t.Fatalf("current() error: %v", err)
+	}
+	if lease.username != "v-mqtt-1" || lease.password != "secret" || lease.duration != time.Hour || !lease.renewable {
+		t.Fatalf("unexpected lease %+v", lease)
+	}
+	if again, _ := v.current(context.Background()); again != lease {
+		t.Fatal("current() should reuse the existing lease")
+	}
+	if v.renewLease(context.Background(), lease) {
+		t.Fatal("renewLease should report false when the renewed duration is cut by max_ttl")
+	}
+}
+
+func TestVaultRotationRetryKeepsLease(t *testing.T) {
+	old := vaultRetryInterval
+	t.Cleanup(func() { vaultRetryInterval = old })
+	vaultRetryInterval = 20 * time.Millisecond
+
+	var issued atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// 第一次申请成功，之后 Vault 不可用
+		if issued.Add(1) > 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"lease_id":"database/creds/mqtt/abc","lease_duration":1,"renewable":false,
+			"data":{"username":"v-mqtt-1","password":"secret"}}`))
+	}))
+	defer srv.Close()
+
+	v := &vaultCredentials{addr: srv.URL, token: "root", mount: "database", role: "mqtt", client: srv.Client(),
+		done: make(chan struct{})}
+	lease, err := v.current(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	go v.run(ctx)
+	deadline := time.Now().Add(5 * time.Second)
+	for issued.Load() < 4 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	<-v.done
+
+	if n := issued.Load(); n < 4 {
+		t.Fatalf("rotation retried %d times, want retries every vaultRetryInterval", n-1)
+	}
+	if v.lease != lease || lease.duration != time.Second {
+		t.Fatalf("failed rotation must keep the old lease unchanged, got %+v", v.lease)
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+)
+
+// 构建信息由 Makefile 通过 -ldflags "-X main.version=... -X main.commit=... -X main.buildDate=..." 注入；
+// 未注入时回退到 go build 自动记录的 VCS 信息（需在 git 工作区内构建）。
+
+var (
+	version   = "dev"
+	commit    = ""
+	buildDate = ""
+)
+
+type buildInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit,omitempty"`
+	BuildDate string `json:"build_date,omitempty"`
+	GoVersion string `json:"go_version"`
+}
+
+func currentBuild() buildInfo {
+	b := buildInfo{Version: version, Commit: commit, BuildDate: buildDate, GoVersion: runtime.Version()}
+	if b.Commit != "" && b.BuildDate != "" {
+		return b
+	}
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return b
+	}
+	dirty := false
+	for _, s := range info.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			if b.Commit == "" && len(s.Value) >= 12 {
+				b.Commit = s.Value[:12]
+			} else if b.Commit == "" {
+				b.Commit = s.Value
+			}
+		case "vcs.time":
+			if b.BuildDate == "" {
+				b.BuildDate = s.Value
+			}
+		case "vcs.modified":
+			dirty = s.Value == "true"
+		}
+	}
+	if dirty && commit == "" && b.Commit != "" {
+		b.Commit += "-dirty"
+	}
+	return b
+}
+
+func (b buildInfo) String() string {
+	s := b.Version
+	if b.Commit != "" {
+		s += " (" + b.Commit
+		if b.BuildDate != "" {
+			s += ", " + b.BuildDate
+		}
+		s += ")"
+	}
+	return fmt.Sprintf("%s %s", s, b.GoVersion)
+}
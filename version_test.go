@@ -0,0 +1,31 @@
+package main
+
+import "testing"
+
+func TestBuildInfoString(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		b    buildInfo
+		want string
+	}{
+		{buildInfo{Version: "v1.4.0", Commit: "3f2a9c1", BuildDate: "2026-10-01T08:00:00Z", GoVersion: "go1.23.4"},
+			"v1.4.0 (3f2a9c1, 2026-10-01T08:00:00Z) go1.23.4"},
+		{buildInfo{Version: "dev", GoVersion: "go1.23.4"}, "dev go1.23.4"},
+	}
+	for _, tc := range tests {
+		if got := tc.b.String(); got != tc.want {
+			t.Fatalf("String() = %q, want %q", got, tc.want)
+		}
+	}
+}
+
+func TestCurrentBuildLdflags(t *testing.T) {
+	oldV, oldC, oldD := version, commit, buildDate
+	t.Cleanup(func() { version, commit, buildDate = oldV, oldC, oldD })
+
+	version, commit, buildDate = "v2.0.0", "abc1234", "2026-10-16"
+	b := currentBuild()
+	if b.Version != "v2.0.0" || b.Commit != "abc1234" || b.BuildDate != "2026-10-16" || b.GoVersion == "" {
+		t.Fatalf("currentBuild = %+v, want ldflags values kept", b)
+	}
+}